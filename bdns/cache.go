@@ -0,0 +1,180 @@
+package bdns
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jmhodges/clock"
+	"github.com/letsencrypt/boulder/metrics"
+	"github.com/miekg/dns"
+)
+
+// cacheKey identifies a cached DNS response by its question.
+type cacheKey struct {
+	qname string
+	qtype uint16
+}
+
+type cacheEntry struct {
+	key     cacheKey
+	msg     *dns.Msg
+	expires time.Time
+}
+
+// DNSCache is a bounded, TTL-aware cache of DNS responses. Positive responses
+// are cached for the lowest TTL in their answer section, and negative
+// responses (NXDOMAIN and NODATA) are cached using the SOA in their authority
+// section as described in RFC 2308 Section 5. All lifetimes are clamped to
+// maxTTL. Responses with any other RCODE (e.g. SERVFAIL) are never cached.
+//
+// Messages stored in and returned from the cache are shared between callers
+// and must not be modified.
+type DNSCache struct {
+	mu         sync.Mutex
+	entries    map[cacheKey]*list.Element
+	lru        *list.List
+	maxEntries int
+	maxTTL     time.Duration
+	clk        clock.Clock
+	stats      metrics.Scope
+}
+
+// NewDNSCache constructs a DNSCache holding at most maxEntries responses, each
+// for no longer than maxTTL.
+func NewDNSCache(maxEntries int, maxTTL time.Duration, clk clock.Clock, stats metrics.Scope) *DNSCache {
+	return &DNSCache{
+		entries:    make(map[cacheKey]*list.Element),
+		lru:        list.New(),
+		maxEntries: maxEntries,
+		maxTTL:     maxTTL,
+		clk:        clk,
+		stats:      stats.NewScope("Cache"),
+	}
+}
+
+func newCacheKey(hostname string, qtype uint16) cacheKey {
+	return cacheKey{qname: strings.ToLower(dns.Fqdn(hostname)), qtype: qtype}
+}
+
+// get returns the cached response for the given question, or nil if there is
+// no unexpired response in the cache.
+func (c *DNSCache) get(hostname string, qtype uint16) *dns.Msg {
+	key := newCacheKey(hostname, qtype)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, present := c.entries[key]
+	if !present {
+		c.stats.Inc("Misses", 1)
+		return nil
+	}
+	entry := elem.Value.(*cacheEntry)
+	if !c.clk.Now().Before(entry.expires) {
+		c.remove(elem)
+		c.stats.Inc("Expirations", 1)
+		c.stats.Inc("Misses", 1)
+		return nil
+	}
+	c.lru.MoveToFront(elem)
+	if entry.msg.Rcode != dns.RcodeSuccess || len(entry.msg.Answer) == 0 {
+		c.stats.Inc("NegativeHits", 1)
+	}
+	c.stats.Inc("Hits", 1)
+	return entry.msg
+}
+
+// set stores msg as the response to the given question if it is cacheable.
+func (c *DNSCache) set(hostname string, qtype uint16, msg *dns.Msg) {
+	ttl := c.ttlFor(msg, qtype)
+	if ttl <= 0 {
+		c.stats.Inc("Uncacheable", 1)
+		return
+	}
+	key := newCacheKey(hostname, qtype)
+	entry := &cacheEntry{key: key, msg: msg, expires: c.clk.Now().Add(ttl)}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, present := c.entries[key]; present {
+		elem.Value = entry
+		c.lru.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(entry)
+	c.stats.Inc("Stores", 1)
+	for c.maxEntries > 0 && c.lru.Len() > c.maxEntries {
+		c.remove(c.lru.Back())
+		c.stats.Inc("Evictions", 1)
+	}
+	c.stats.Gauge("Size", int64(c.lru.Len()))
+}
+
+// remove deletes elem from the cache. The caller must hold c.mu.
+func (c *DNSCache) remove(elem *list.Element) {
+	c.lru.Remove(elem)
+	delete(c.entries, elem.Value.(*cacheEntry).key)
+}
+
+// ttlFor computes how long msg may be cached for, returning zero if it must
+// not be cached at all.
+func (c *DNSCache) ttlFor(msg *dns.Msg, qtype uint16) time.Duration {
+	// A truncated response may be missing records, so an empty one isn't a
+	// real negative answer.
+	if msg.Truncated {
+		return 0
+	}
+	var ttl uint32
+	switch {
+	case msg.Rcode == dns.RcodeSuccess && hasAnswerOfType(msg, qtype):
+		ttl = minTTL(msg.Answer)
+	case msg.Rcode == dns.RcodeSuccess || msg.Rcode == dns.RcodeNameError:
+		// Negative responses without an SOA in the authority section must not
+		// be cached (RFC 2308 Section 5).
+		soa := findSOA(msg.Ns)
+		if soa == nil {
+			return 0
+		}
+		ttl = soa.Hdr.Ttl
+		if soa.Minttl < ttl {
+			ttl = soa.Minttl
+		}
+	default:
+		return 0
+	}
+	d := time.Duration(ttl) * time.Second
+	if d > c.maxTTL {
+		d = c.maxTTL
+	}
+	return d
+}
+
+// hasAnswerOfType returns true if msg answers the question with at least one
+// record of type qtype, as opposed to only with aliases (NODATA).
+func hasAnswerOfType(msg *dns.Msg, qtype uint16) bool {
+	for _, rr := range msg.Answer {
+		if rr.Header().Rrtype == qtype {
+			return true
+		}
+	}
+	return false
+}
+
+func minTTL(rrs []dns.RR) uint32 {
+	var min uint32
+	for i, rr := range rrs {
+		if ttl := rr.Header().Ttl; i == 0 || ttl < min {
+			min = ttl
+		}
+	}
+	return min
+}
+
+func findSOA(rrs []dns.RR) *dns.SOA {
+	for _, rr := range rrs {
+		if soa, ok := rr.(*dns.SOA); ok {
+			return soa
+		}
+	}
+	return nil
+}
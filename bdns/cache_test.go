@@ -0,0 +1,204 @@
+package bdns
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jmhodges/clock"
+	"github.com/letsencrypt/boulder/test"
+	"github.com/miekg/dns"
+	"golang.org/x/net/context"
+)
+
+// countingExchanger answers every query with the response built by respond
+// and counts the number of queries it has seen.
+type countingExchanger struct {
+	sync.Mutex
+	count   int
+	respond func(q dns.Question) *dns.Msg
+}
+
+func (ce *countingExchanger) Exchange(m *dns.Msg, a string) (*dns.Msg, time.Duration, error) {
+	ce.Lock()
+	defer ce.Unlock()
+	ce.count++
+	return ce.respond(m.Question[0]), time.Millisecond, nil
+}
+
+func (ce *countingExchanger) queries() int {
+	ce.Lock()
+	defer ce.Unlock()
+	return ce.count
+}
+
+func testSOA(ttl, minTTL uint32) *dns.SOA {
+	return &dns.SOA{
+		Hdr:    dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: ttl},
+		Ns:     "ns.example.com.",
+		Mbox:   "master.example.com.",
+		Minttl: minTTL,
+	}
+}
+
+func cachingResolver(ce *countingExchanger, clk clock.Clock, maxEntries int, maxTTL time.Duration) *DNSResolverImpl {
+	dr := NewTestDNSResolverImpl(time.Second, []string{dnsLoopbackAddr}, testStats, clk, 1)
+	dr.dnsClient = ce
+	dr.Cache = NewDNSCache(maxEntries, maxTTL, clk, testStats)
+	return dr
+}
+
+func TestCachePositiveTTL(t *testing.T) {
+	clk := clock.NewFake()
+	ce := &countingExchanger{respond: func(q dns.Question) *dns.Msg {
+		m := new(dns.Msg)
+		if q.Qtype == dns.TypeA {
+			m.Answer = append(m.Answer, &dns.A{
+				Hdr: dns.RR_Header{Name: q.Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+				A:   net.ParseIP("10.0.0.1"),
+			})
+		}
+		return m
+	}}
+	dr := cachingResolver(ce, clk, 10, time.Hour)
+
+	for i := 0; i < 3; i++ {
+		ips, err := dr.LookupHost(context.Background(), "example.com")
+		test.AssertNotError(t, err, "LookupHost failed")
+		test.AssertEquals(t, len(ips), 1)
+	}
+	test.AssertEquals(t, ce.queries(), 1)
+
+	// Names are case-insensitive
+	_, err := dr.LookupHost(context.Background(), "EXAMPLE.com.")
+	test.AssertNotError(t, err, "LookupHost failed")
+	test.AssertEquals(t, ce.queries(), 1)
+
+	clk.Add(59 * time.Second)
+	_, err = dr.LookupHost(context.Background(), "example.com")
+	test.AssertNotError(t, err, "LookupHost failed")
+	test.AssertEquals(t, ce.queries(), 1)
+
+	clk.Add(time.Second)
+	_, err = dr.LookupHost(context.Background(), "example.com")
+	test.AssertNotError(t, err, "LookupHost failed")
+	test.AssertEquals(t, ce.queries(), 2)
+}
+
+func TestCacheMaxTTL(t *testing.T) {
+	clk := clock.NewFake()
+	ce := &countingExchanger{respond: func(q dns.Question) *dns.Msg {
+		m := new(dns.Msg)
+		m.Answer = append(m.Answer, &dns.CAA{
+			Hdr:   dns.RR_Header{Name: q.Name, Rrtype: dns.TypeCAA, Class: dns.ClassINET, Ttl: 86400},
+			Tag:   "issue",
+			Value: "letsencrypt.org",
+		})
+		return m
+	}}
+	dr := cachingResolver(ce, clk, 10, 5*time.Minute)
+
+	_, _, err := dr.LookupCAA(context.Background(), "example.com")
+	test.AssertNotError(t, err, "LookupCAA failed")
+	clk.Add(5 * time.Minute)
+	caas, _, err := dr.LookupCAA(context.Background(), "example.com")
+	test.AssertNotError(t, err, "LookupCAA failed")
+	test.AssertEquals(t, len(caas), 1)
+	test.AssertEquals(t, ce.queries(), 2)
+}
+
+func TestCacheNegative(t *testing.T) {
+	clk := clock.NewFake()
+	ce := &countingExchanger{respond: func(q dns.Question) *dns.Msg {
+		m := new(dns.Msg)
+		switch q.Name {
+		case "nxdomain.example.com.":
+			m.Rcode = dns.RcodeNameError
+			m.Ns = append(m.Ns, testSOA(3600, 30))
+		case "nodata.example.com.":
+			m.Ns = append(m.Ns, testSOA(20, 300))
+		case "nosoa.example.com.":
+		case "servfail.example.com.":
+			m.Rcode = dns.RcodeServerFailure
+		case "truncated.example.com.":
+			m.Truncated = true
+			m.Ns = append(m.Ns, testSOA(3600, 300))
+		}
+		return m
+	}}
+	dr := cachingResolver(ce, clk, 10, time.Hour)
+	dr.caaSERVFAILExceptions = map[string]bool{}
+
+	lookupTwice := func(name string) int {
+		before := ce.queries()
+		for i := 0; i < 2; i++ {
+			_, _, _ = dr.LookupCAA(context.Background(), name)
+		}
+		return ce.queries() - before
+	}
+
+	// NXDOMAIN is cached for the lesser of the SOA TTL and minimum.
+	test.AssertEquals(t, lookupTwice("nxdomain.example.com"), 1)
+	_, _, err := dr.LookupCAA(context.Background(), "nxdomain.example.com")
+	test.AssertNotError(t, err, "LookupCAA of cached NXDOMAIN failed")
+	clk.Add(30 * time.Second)
+	test.AssertEquals(t, lookupTwice("nxdomain.example.com"), 1)
+
+	// NODATA likewise.
+	test.AssertEquals(t, lookupTwice("nodata.example.com"), 1)
+	clk.Add(20 * time.Second)
+	test.AssertEquals(t, lookupTwice("nodata.example.com"), 1)
+
+	// Negative responses without an SOA, SERVFAILs and truncated responses
+	// are not cached.
+	test.AssertEquals(t, lookupTwice("nosoa.example.com"), 2)
+	test.AssertEquals(t, lookupTwice("servfail.example.com"), 2)
+	test.AssertEquals(t, lookupTwice("truncated.example.com"), 2)
+}
+
+func TestCacheEviction(t *testing.T) {
+	clk := clock.NewFake()
+	ce := &countingExchanger{respond: func(q dns.Question) *dns.Msg {
+		m := new(dns.Msg)
+		m.Answer = append(m.Answer, &dns.MX{
+			Hdr: dns.RR_Header{Name: q.Name, Rrtype: dns.TypeMX, Class: dns.ClassINET, Ttl: 60},
+			Mx:  "mail.example.com.",
+		})
+		return m
+	}}
+	dr := cachingResolver(ce, clk, 2, time.Hour)
+
+	for _, name := range []string{"a.com", "b.com", "a.com", "c.com"} {
+		_, err := dr.LookupMX(context.Background(), name)
+		test.AssertNotError(t, err, "LookupMX failed")
+	}
+	test.AssertEquals(t, ce.queries(), 3)
+	test.AssertEquals(t, len(dr.Cache.entries), 2)
+
+	// b.com was the least recently used, so it was evicted for c.com.
+	_, _ = dr.LookupMX(context.Background(), "a.com")
+	test.AssertEquals(t, ce.queries(), 3)
+	_, _ = dr.LookupMX(context.Background(), "b.com")
+	test.AssertEquals(t, ce.queries(), 4)
+}
+
+func TestCacheBypassedForTXT(t *testing.T) {
+	clk := clock.NewFake()
+	ce := &countingExchanger{respond: func(q dns.Question) *dns.Msg {
+		m := new(dns.Msg)
+		m.Answer = append(m.Answer, &dns.TXT{
+			Hdr: dns.RR_Header{Name: q.Name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 3600},
+			Txt: []string{"token"},
+		})
+		return m
+	}}
+	dr := cachingResolver(ce, clk, 10, time.Hour)
+
+	for i := 0; i < 2; i++ {
+		_, _, err := dr.LookupTXT(context.Background(), "_acme-challenge.example.com")
+		test.AssertNotError(t, err, "LookupTXT failed")
+	}
+	test.AssertEquals(t, ce.queries(), 2)
+	test.AssertEquals(t, len(dr.Cache.entries), 0)
+}
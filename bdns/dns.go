@@ -145,7 +145,7 @@ var (
 type DNSResolver interface {
 	LookupTXT(context.Context, string) (txts []string, authorities []string, err error)
 	LookupHost(context.Context, string) ([]net.IP, error)
-	LookupCAA(context.Context, string) ([]*dns.CAA, error)
+	LookupCAA(context.Context, string) ([]*dns.CAA, []dns.RR, error)
 	LookupMX(context.Context, string) ([]string, error)
 }
 
@@ -153,6 +153,9 @@ type DNSResolver interface {
 type DNSResolverImpl struct {
 	dnsClient                exchanger
 	servers                  []string
+	readTimeout              time.Duration
+	upstreamExchangers       map[string]exchanger // See SetUpstreams
+	health                   *healthTracker       // See TrackServerHealth
 	allowRestrictedAddresses bool
 	// If non-nil, these are already-issued names whose registrar returns SERVFAIL
 	// for CAA queries that get a temporary pass during a notification period.
@@ -166,6 +169,11 @@ type DNSResolverImpl struct {
 	aaaaStats             metrics.Scope
 	caaStats              metrics.Scope
 	mxStats               metrics.Scope
+
+	// If non-nil, responses to A, AAAA, CAA and MX queries are cached here.
+	// TXT queries are never cached since they are used for DNS-01 validation,
+	// which must see the records as they are at the time of the challenge.
+	Cache *DNSCache
 }
 
 var _ DNSResolver = &DNSResolverImpl{}
@@ -194,6 +202,7 @@ func NewDNSResolverImpl(
 	return &DNSResolverImpl{
 		dnsClient:                dnsClient,
 		servers:                  servers,
+		readTimeout:              readTimeout,
 		allowRestrictedAddresses: false,
 		caaSERVFAILExceptions:    caaSERVFAILExceptions,
 		maxTries:                 maxTries,
@@ -216,6 +225,31 @@ func NewTestDNSResolverImpl(readTimeout time.Duration, servers []string, stats m
 	return resolver
 }
 
+// SetUpstreams replaces the resolver's servers with the given upstreams, each
+// of which is reached over its own transport. Connections to DNS over TLS and
+// DNS over HTTPS upstreams are reused across queries.
+func (dnsResolver *DNSResolverImpl) SetUpstreams(upstreams []Upstream) error {
+	if len(upstreams) < 1 {
+		return fmt.Errorf("Not configured with at least one DNS Server")
+	}
+	servers := make([]string, 0, len(upstreams))
+	exchangers := make(map[string]exchanger, len(upstreams))
+	for _, u := range upstreams {
+		if _, present := exchangers[u.Address]; present {
+			return fmt.Errorf("duplicate DNS upstream %q", u.Address)
+		}
+		e, err := newExchanger(u, dnsResolver.readTimeout)
+		if err != nil {
+			return fmt.Errorf("configuring DNS upstream %q: %s", u.Address, err)
+		}
+		servers = append(servers, u.Address)
+		exchangers[u.Address] = e
+	}
+	dnsResolver.servers = servers
+	dnsResolver.upstreamExchangers = exchangers
+	return nil
+}
+
 // exchangeOne performs a single DNS exchange with a randomly chosen server
 // out of the server list, returning the response, time, and error (if any).
 // This method sets the DNSSEC OK bit on the message to true before sending
@@ -233,10 +267,15 @@ func (dnsResolver *DNSResolverImpl) exchangeOne(ctx context.Context, hostname st
 
 	dnsResolver.stats.Inc("Rate", 1)
 
-	// Randomly pick a server
+	// Randomly pick a server, or let the health tracker pick one if it is
+	// enabled.
+	var tried map[string]bool
 	chosenServer := dnsResolver.servers[rand.Intn(len(dnsResolver.servers))]
-
-	client := dnsResolver.dnsClient
+	if dnsResolver.health != nil {
+		tried = make(map[string]bool)
+		chosenServer = dnsResolver.health.pick(dnsResolver.servers, tried)
+	}
+	client := dnsResolver.exchangerFor(chosenServer)
 
 	tries := 1
 	start := dnsResolver.clk.Now()
@@ -246,19 +285,29 @@ func (dnsResolver *DNSResolverImpl) exchangeOne(ctx context.Context, hostname st
 	}()
 	for {
 		msgStats.Inc("Tries", 1)
+		tryStart := dnsResolver.clk.Now()
 		ch := make(chan dnsResp, 1)
 
 		go func() {
 			rsp, rtt, err := client.Exchange(m, chosenServer)
 			msgStats.TimingDuration("SingleTryLatency", rtt)
-			ch <- dnsResp{m: rsp, err: err}
+			ch <- dnsResp{m: rsp, rtt: rtt, err: err}
 		}()
 		select {
 		case <-ctx.Done():
 			msgStats.Inc("Cancels", 1)
 			msgStats.Inc("Errors", 1)
+			// A server that doesn't answer before the deadline counts against
+			// its health, but one whose query was cancelled by the caller
+			// doesn't.
+			if dnsResolver.health != nil && ctx.Err() == context.DeadlineExceeded {
+				dnsResolver.health.record(chosenServer, dnsResolver.clk.Now().Sub(tryStart), ctx.Err())
+			}
 			return nil, ctx.Err()
 		case r := <-ch:
+			if dnsResolver.health != nil {
+				dnsResolver.health.record(chosenServer, r.rtt, r.err)
+			}
 			if r.err != nil {
 				msgStats.Inc("Errors", 1)
 				operr, ok := r.err.(*net.OpError)
@@ -266,6 +315,13 @@ func (dnsResolver *DNSResolverImpl) exchangeOne(ctx context.Context, hostname st
 				hasRetriesLeft := tries < dnsResolver.maxTries
 				if isRetryable && hasRetriesLeft {
 					tries++
+					if dnsResolver.health != nil {
+						// Retry against a different healthy server if
+						// there is one.
+						tried[chosenServer] = true
+						chosenServer = dnsResolver.health.pick(dnsResolver.servers, tried)
+						client = dnsResolver.exchangerFor(chosenServer)
+					}
 					continue
 				} else if isRetryable && !hasRetriesLeft {
 					msgStats.Inc("RanOutOfTries", 1)
@@ -278,8 +334,58 @@ func (dnsResolver *DNSResolverImpl) exchangeOne(ctx context.Context, hostname st
 	}
 }
 
+// exchangeCached behaves like exchangeOne but first consults the resolver's
+// cache, if one is configured, and stores cacheable responses in it.
+func (dnsResolver *DNSResolverImpl) exchangeCached(ctx context.Context, hostname string, qtype uint16, msgStats metrics.Scope) (*dns.Msg, error) {
+	if dnsResolver.Cache == nil {
+		return dnsResolver.exchangeOne(ctx, hostname, qtype, msgStats)
+	}
+	if r := dnsResolver.Cache.get(hostname, qtype); r != nil {
+		return r, nil
+	}
+	r, err := dnsResolver.exchangeOne(ctx, hostname, qtype, msgStats)
+	if err != nil {
+		return nil, err
+	}
+	dnsResolver.Cache.set(hostname, qtype, r)
+	return r, nil
+}
+
+// exchangerFor returns the exchanger used to talk to server.
+func (dnsResolver *DNSResolverImpl) exchangerFor(server string) exchanger {
+	if e, present := dnsResolver.upstreamExchangers[server]; present {
+		return e
+	}
+	return dnsResolver.dnsClient
+}
+
+// TrackServerHealth enables tracking of the error rate and latency of each
+// configured server. Servers that cross the thresholds in config are avoided
+// until a periodic probe shows they have recovered. Only errors talking to a
+// server count against it; DNS response codes like SERVFAIL do not, since
+// they are usually caused by the authoritative servers.
+func (dnsResolver *DNSResolverImpl) TrackServerHealth(config ServerHealthConfig) {
+	dnsResolver.health = newHealthTracker(config, dnsResolver.clk, dnsResolver.stats, dnsResolver.probeServer)
+}
+
+// probeServer sends server a query for the root zone's SOA record and returns
+// an error if it doesn't answer successfully.
+func (dnsResolver *DNSResolverImpl) probeServer(server string) error {
+	m := new(dns.Msg)
+	m.SetQuestion(".", dns.TypeSOA)
+	r, _, err := dnsResolver.exchangerFor(server).Exchange(m, server)
+	if err != nil {
+		return err
+	}
+	if r.Rcode != dns.RcodeSuccess {
+		return fmt.Errorf("probe of %s returned %s", server, dns.RcodeToString[r.Rcode])
+	}
+	return nil
+}
+
 type dnsResp struct {
 	m   *dns.Msg
+	rtt time.Duration
 	err error
 }
 
@@ -289,6 +395,7 @@ type dnsResp struct {
 func (dnsResolver *DNSResolverImpl) LookupTXT(ctx context.Context, hostname string) ([]string, []string, error) {
 	var txt []string
 	dnsType := dns.TypeTXT
+	// TXT lookups deliberately bypass the cache, see DNSResolverImpl.Cache.
 	r, err := dnsResolver.exchangeOne(ctx, hostname, dnsType, dnsResolver.txtStats)
 	if err != nil {
 		return nil, nil, &DNSError{dnsType, hostname, err, -1}
@@ -331,8 +438,17 @@ func isPrivateV6(ip net.IP) bool {
 	return false
 }
 
+// IsReservedIP returns true if ip is in one of the private or otherwise
+// reserved ranges that LookupHost filters out of its results.
+func IsReservedIP(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		return isPrivateV4(ip4)
+	}
+	return isPrivateV6(ip)
+}
+
 func (dnsResolver *DNSResolverImpl) lookupIP(ctx context.Context, hostname string, ipType uint16, stats metrics.Scope) ([]dns.RR, error) {
-	resp, err := dnsResolver.exchangeOne(ctx, hostname, ipType, stats)
+	resp, err := dnsResolver.exchangeCached(ctx, hostname, ipType, stats)
 	if err != nil {
 		return nil, &DNSError{ipType, hostname, err, -1}
 	}
@@ -392,12 +508,14 @@ func (dnsResolver *DNSResolverImpl) LookupHost(ctx context.Context, hostname str
 }
 
 // LookupCAA sends a DNS query to find all CAA records associated with
-// the provided hostname.
-func (dnsResolver *DNSResolverImpl) LookupCAA(ctx context.Context, hostname string) ([]*dns.CAA, error) {
+// the provided hostname. It also returns any CNAME and DNAME records in the
+// response, in order, which describe the aliases the resolver followed to find
+// the CAA records.
+func (dnsResolver *DNSResolverImpl) LookupCAA(ctx context.Context, hostname string) ([]*dns.CAA, []dns.RR, error) {
 	dnsType := dns.TypeCAA
-	r, err := dnsResolver.exchangeOne(ctx, hostname, dnsType, dnsResolver.caaStats)
+	r, err := dnsResolver.exchangeCached(ctx, hostname, dnsType, dnsResolver.caaStats)
 	if err != nil {
-		return nil, &DNSError{dnsType, hostname, err, -1}
+		return nil, nil, &DNSError{dnsType, hostname, err, -1}
 	}
 
 	// If the resolver returns SERVFAIL for a certain list of FQDNs, return an
@@ -407,30 +525,32 @@ func (dnsResolver *DNSResolverImpl) LookupCAA(ctx context.Context, hostname stri
 	// SERVFAIL, but will need certificate renewals. After a suitable notice
 	// period we will remove these exceptions.
 	var CAAs []*dns.CAA
+	var aliases []dns.RR
 	if r.Rcode == dns.RcodeServerFailure {
 		if dnsResolver.caaSERVFAILExceptions == nil ||
 			dnsResolver.caaSERVFAILExceptions[hostname] {
-			return nil, nil
+			return nil, nil, nil
 		} else {
-			return nil, &DNSError{dnsType, hostname, nil, r.Rcode}
+			return nil, nil, &DNSError{dnsType, hostname, nil, r.Rcode}
 		}
 	}
 
 	for _, answer := range r.Answer {
-		if answer.Header().Rrtype == dnsType {
-			if caaR, ok := answer.(*dns.CAA); ok {
-				CAAs = append(CAAs, caaR)
-			}
+		switch rr := answer.(type) {
+		case *dns.CAA:
+			CAAs = append(CAAs, rr)
+		case *dns.CNAME, *dns.DNAME:
+			aliases = append(aliases, rr)
 		}
 	}
-	return CAAs, nil
+	return CAAs, aliases, nil
 }
 
 // LookupMX sends a DNS query to find a MX record associated hostname and returns the
 // record target.
 func (dnsResolver *DNSResolverImpl) LookupMX(ctx context.Context, hostname string) ([]string, error) {
 	dnsType := dns.TypeMX
-	r, err := dnsResolver.exchangeOne(ctx, hostname, dnsType, dnsResolver.mxStats)
+	r, err := dnsResolver.exchangeCached(ctx, hostname, dnsType, dnsResolver.mxStats)
 	if err != nil {
 		return nil, &DNSError{dnsType, hostname, err, -1}
 	}
@@ -132,6 +132,32 @@ func mockDNSQuery(w dns.ResponseWriter, r *dns.Msg) {
 				record.Flag = 1
 				appendAnswer(record)
 			}
+			if q.Name == "cname-caa.example.com." {
+				cname := new(dns.CNAME)
+				cname.Hdr = dns.RR_Header{Name: "cname-caa.example.com.", Rrtype: dns.TypeCNAME, Class: dns.ClassINET, Ttl: 30}
+				cname.Target = "caa.example.com."
+				appendAnswer(cname)
+				record := new(dns.CAA)
+				record.Hdr = dns.RR_Header{Name: "caa.example.com.", Rrtype: dns.TypeCAA, Class: dns.ClassINET, Ttl: 0}
+				record.Tag = "issue"
+				record.Value = "letsencrypt.org"
+				appendAnswer(record)
+			}
+			if q.Name == "www.dname-caa.example.com." {
+				dname := new(dns.DNAME)
+				dname.Hdr = dns.RR_Header{Name: "dname-caa.example.com.", Rrtype: dns.TypeDNAME, Class: dns.ClassINET, Ttl: 30}
+				dname.Target = "example.net."
+				appendAnswer(dname)
+				cname := new(dns.CNAME)
+				cname.Hdr = dns.RR_Header{Name: "www.example.net.", Rrtype: dns.TypeCNAME, Class: dns.ClassINET, Ttl: 30}
+				cname.Target = "caa.example.com."
+				appendAnswer(cname)
+				record := new(dns.CAA)
+				record.Hdr = dns.RR_Header{Name: "caa.example.com.", Rrtype: dns.TypeCAA, Class: dns.ClassINET, Ttl: 0}
+				record.Tag = "issue"
+				record.Value = "letsencrypt.org"
+				appendAnswer(record)
+			}
 			if q.Name == "cname.example.com." {
 				record := new(dns.CAA)
 				record.Hdr = dns.RR_Header{Name: "caa.example.com.", Rrtype: dns.TypeCAA, Class: dns.ClassINET, Ttl: 0}
@@ -259,7 +285,7 @@ func TestDNSLookupsNoServer(t *testing.T) {
 	_, err = obj.LookupHost(context.Background(), "letsencrypt.org")
 	test.AssertError(t, err, "No servers")
 
-	_, err = obj.LookupCAA(context.Background(), "letsencrypt.org")
+	_, _, err = obj.LookupCAA(context.Background(), "letsencrypt.org")
 	test.AssertError(t, err, "No servers")
 }
 
@@ -275,18 +301,18 @@ func TestDNSServFail(t *testing.T) {
 
 	// CAA lookup ignores validation failures from the resolver for now
 	// and returns an empty list of CAA records.
-	emptyCaa, err := obj.LookupCAA(context.Background(), bad)
+	emptyCaa, _, err := obj.LookupCAA(context.Background(), bad)
 	test.Assert(t, len(emptyCaa) == 0, "Query returned non-empty list of CAA records")
 	test.AssertNotError(t, err, "LookupCAA returned an error")
 
 	// When we turn on enforceCAASERVFAIL, such lookups should fail.
 	obj.caaSERVFAILExceptions = map[string]bool{"servfailexception.example.com": true}
-	emptyCaa, err = obj.LookupCAA(context.Background(), bad)
+	emptyCaa, _, err = obj.LookupCAA(context.Background(), bad)
 	test.Assert(t, len(emptyCaa) == 0, "Query returned non-empty list of CAA records")
 	test.AssertError(t, err, "LookupCAA should have returned an error")
 
 	// Unless they are on the exception list
-	emptyCaa, err = obj.LookupCAA(context.Background(), "servfailexception.example.com")
+	emptyCaa, _, err = obj.LookupCAA(context.Background(), "servfailexception.example.com")
 	test.Assert(t, len(emptyCaa) == 0, "Query returned non-empty list of CAA records")
 	test.AssertNotError(t, err, "LookupCAA for servfail exception returned an error")
 }
@@ -421,17 +447,31 @@ func TestDNSNXDOMAIN(t *testing.T) {
 func TestDNSLookupCAA(t *testing.T) {
 	obj := NewTestDNSResolverImpl(time.Second*10, []string{dnsLoopbackAddr}, testStats, clock.NewFake(), 1)
 
-	caas, err := obj.LookupCAA(context.Background(), "bracewel.net")
+	caas, _, err := obj.LookupCAA(context.Background(), "bracewel.net")
 	test.AssertNotError(t, err, "CAA lookup failed")
 	test.Assert(t, len(caas) > 0, "Should have CAA records")
 
-	caas, err = obj.LookupCAA(context.Background(), "nonexistent.letsencrypt.org")
+	caas, _, err = obj.LookupCAA(context.Background(), "nonexistent.letsencrypt.org")
 	test.AssertNotError(t, err, "CAA lookup failed")
 	test.Assert(t, len(caas) == 0, "Shouldn't have CAA records")
 
-	caas, err = obj.LookupCAA(context.Background(), "cname.example.com")
+	caas, aliases, err := obj.LookupCAA(context.Background(), "cname.example.com")
 	test.AssertNotError(t, err, "CAA lookup failed")
 	test.Assert(t, len(caas) > 0, "Should follow CNAME to find CAA")
+	test.AssertEquals(t, len(aliases), 0)
+
+	caas, aliases, err = obj.LookupCAA(context.Background(), "cname-caa.example.com")
+	test.AssertNotError(t, err, "CAA lookup failed")
+	test.AssertEquals(t, len(caas), 1)
+	test.AssertEquals(t, len(aliases), 1)
+	test.AssertEquals(t, aliases[0].(*dns.CNAME).Target, "caa.example.com.")
+
+	caas, aliases, err = obj.LookupCAA(context.Background(), "www.dname-caa.example.com")
+	test.AssertNotError(t, err, "CAA lookup failed")
+	test.AssertEquals(t, len(caas), 1)
+	test.AssertEquals(t, len(aliases), 2)
+	test.AssertEquals(t, aliases[0].(*dns.DNAME).Target, "example.net.")
+	test.AssertEquals(t, aliases[1].(*dns.CNAME).Target, "caa.example.com.")
 }
 
 func TestDNSTXTAuthorities(t *testing.T) {
@@ -473,6 +513,11 @@ func TestIsPrivateIP(t *testing.T) {
 	test.Assert(t, isPrivateV6(net.ParseIP("0100::")), "should be private")
 	test.Assert(t, isPrivateV6(net.ParseIP("0100::0000:ffff:ffff:ffff:ffff")), "should be private")
 	test.Assert(t, !isPrivateV6(net.ParseIP("0100::0001:0000:0000:0000:0000")), "should be private")
+
+	test.Assert(t, IsReservedIP(net.ParseIP("10.1.2.3")), "should be reserved")
+	test.Assert(t, IsReservedIP(net.ParseIP("::1")), "should be reserved")
+	test.Assert(t, !IsReservedIP(net.ParseIP("8.8.8.8")), "should not be reserved")
+	test.Assert(t, !IsReservedIP(net.ParseIP("2001:4860:4860::8888")), "should not be reserved")
 }
 
 type testExchanger struct {
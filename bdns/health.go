@@ -0,0 +1,172 @@
+package bdns
+
+import (
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jmhodges/clock"
+	"github.com/letsencrypt/boulder/metrics"
+)
+
+// healthDecay is the weight given to the newest sample in each server's
+// moving averages of error rate and latency.
+const healthDecay = 0.2
+
+// minHealthSamples is the number of exchanges a server must have seen before
+// its averages are trusted enough to mark it unhealthy.
+const minHealthSamples = 5
+
+// ServerHealthConfig controls when DNSResolverImpl considers an upstream
+// server unhealthy and stops sending it queries.
+type ServerHealthConfig struct {
+	// ErrorRateThreshold is the moving average fraction of failed exchanges
+	// above which a server is considered unhealthy.
+	ErrorRateThreshold float64
+	// MaxLatency, if non-zero, is the moving average exchange latency above
+	// which a server is considered unhealthy.
+	MaxLatency time.Duration
+	// ProbeInterval is how long an unhealthy server is avoided before it is
+	// sent a probe query to check whether it has recovered.
+	ProbeInterval time.Duration
+}
+
+type serverHealth struct {
+	errorRate float64
+	latency   float64 // nanoseconds
+	samples   int
+	unhealthy bool
+	probing   bool
+	nextProbe time.Time
+	stats     metrics.Scope
+}
+
+// healthTracker keeps moving averages of the error rate and latency of each
+// upstream server and uses them to steer queries towards healthy servers.
+// Servers marked unhealthy receive no queries except periodic probes, and are
+// returned to service when a probe succeeds.
+type healthTracker struct {
+	config ServerHealthConfig
+	clk    clock.Clock
+	stats  metrics.Scope
+	// probe sends a single test query to a server and reports whether it
+	// answered usefully.
+	probe func(server string) error
+
+	mu      sync.Mutex
+	servers map[string]*serverHealth
+}
+
+func newHealthTracker(config ServerHealthConfig, clk clock.Clock, stats metrics.Scope, probe func(string) error) *healthTracker {
+	return &healthTracker{
+		config:  config,
+		clk:     clk,
+		stats:   stats.NewScope("Servers"),
+		probe:   probe,
+		servers: make(map[string]*serverHealth),
+	}
+}
+
+// get returns the health record for server, creating it if needed. The caller
+// must hold ht.mu.
+func (ht *healthTracker) get(server string) *serverHealth {
+	sh, present := ht.servers[server]
+	if !present {
+		// Statsd uses periods as separators, so they can't appear in a
+		// server's scope name.
+		name := strings.NewReplacer(".", "_", ":", "_", "/", "_").Replace(server)
+		sh = &serverHealth{stats: ht.stats.NewScope(name)}
+		ht.servers[server] = sh
+	}
+	return sh
+}
+
+// pick chooses a server for the next exchange. It prefers healthy servers that
+// are not in tried, then any healthy server, and only when none are healthy
+// falls back to an unhealthy one. As a side effect it starts probes of any
+// unhealthy servers that are due for one.
+func (ht *healthTracker) pick(servers []string, tried map[string]bool) string {
+	ht.mu.Lock()
+	defer ht.mu.Unlock()
+	now := ht.clk.Now()
+	var fresh, healthy []string
+	for _, s := range servers {
+		sh := ht.get(s)
+		if sh.unhealthy {
+			if !sh.probing && !now.Before(sh.nextProbe) {
+				sh.probing = true
+				go ht.runProbe(s)
+			}
+			continue
+		}
+		healthy = append(healthy, s)
+		if !tried[s] {
+			fresh = append(fresh, s)
+		}
+	}
+	switch {
+	case len(fresh) > 0:
+		return fresh[rand.Intn(len(fresh))]
+	case len(healthy) > 0:
+		return healthy[rand.Intn(len(healthy))]
+	default:
+		ht.stats.Inc("NoHealthyServers", 1)
+		return servers[rand.Intn(len(servers))]
+	}
+}
+
+func (ht *healthTracker) runProbe(server string) {
+	err := ht.probe(server)
+	ht.mu.Lock()
+	defer ht.mu.Unlock()
+	sh := ht.get(server)
+	sh.probing = false
+	if err != nil {
+		sh.stats.Inc("ProbeFailures", 1)
+		sh.nextProbe = ht.clk.Now().Add(ht.config.ProbeInterval)
+		return
+	}
+	sh.stats.Inc("ProbeSuccesses", 1)
+	sh.unhealthy = false
+	sh.errorRate = 0
+	sh.latency = 0
+	sh.samples = 0
+	sh.stats.Gauge("Healthy", 1)
+}
+
+// record updates server's averages with the outcome of an exchange, marking
+// it unhealthy if it has crossed one of the configured thresholds.
+func (ht *healthTracker) record(server string, rtt time.Duration, err error) {
+	ht.mu.Lock()
+	defer ht.mu.Unlock()
+	sh := ht.get(server)
+	var failed float64
+	if err != nil {
+		failed = 1
+		sh.stats.Inc("Errors", 1)
+	} else {
+		sh.stats.Inc("Successes", 1)
+		sh.stats.TimingDuration("Latency", rtt)
+	}
+	if sh.samples == 0 {
+		sh.errorRate = failed
+		sh.latency = float64(rtt)
+	} else {
+		sh.errorRate = healthDecay*failed + (1-healthDecay)*sh.errorRate
+		if err == nil {
+			sh.latency = healthDecay*float64(rtt) + (1-healthDecay)*sh.latency
+		}
+	}
+	sh.samples++
+	if sh.unhealthy || sh.samples < minHealthSamples {
+		return
+	}
+	tooSlow := ht.config.MaxLatency > 0 && time.Duration(sh.latency) > ht.config.MaxLatency
+	if sh.errorRate > ht.config.ErrorRateThreshold || tooSlow {
+		sh.unhealthy = true
+		sh.nextProbe = ht.clk.Now().Add(ht.config.ProbeInterval)
+		sh.stats.Inc("MarkedUnhealthy", 1)
+		sh.stats.Gauge("Healthy", 0)
+	}
+}
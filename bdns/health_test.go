@@ -0,0 +1,222 @@
+package bdns
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jmhodges/clock"
+	"github.com/letsencrypt/boulder/test"
+	"github.com/miekg/dns"
+	"golang.org/x/net/context"
+)
+
+// scriptedExchanger answers every query successfully after rtt, unless
+// failing is set, in which case it returns a temporary network error.
+type scriptedExchanger struct {
+	sync.Mutex
+	failing bool
+	rtt     time.Duration
+	count   int
+}
+
+func (se *scriptedExchanger) Exchange(m *dns.Msg, a string) (*dns.Msg, time.Duration, error) {
+	se.Lock()
+	defer se.Unlock()
+	se.count++
+	if se.failing {
+		return nil, 0, &net.OpError{Op: "read", Err: tempError(true)}
+	}
+	r := new(dns.Msg)
+	r.SetReply(m)
+	return r, se.rtt, nil
+}
+
+func (se *scriptedExchanger) queries() int {
+	se.Lock()
+	defer se.Unlock()
+	return se.count
+}
+
+func (se *scriptedExchanger) setFailing(failing bool) {
+	se.Lock()
+	defer se.Unlock()
+	se.failing = failing
+}
+
+func healthTestResolver(clk clock.Clock, config ServerHealthConfig) (*DNSResolverImpl, *scriptedExchanger, *scriptedExchanger) {
+	good := &scriptedExchanger{rtt: time.Millisecond}
+	bad := &scriptedExchanger{rtt: time.Millisecond, failing: true}
+	dr := NewTestDNSResolverImpl(time.Second, []string{"good:53", "bad:53"}, testStats, clk, 2)
+	dr.upstreamExchangers = map[string]exchanger{"good:53": good, "bad:53": bad}
+	dr.TrackServerHealth(config)
+	return dr, good, bad
+}
+
+func TestHealthFailover(t *testing.T) {
+	clk := clock.NewFake()
+	dr, good, bad := healthTestResolver(clk, ServerHealthConfig{
+		ErrorRateThreshold: 0.5,
+		ProbeInterval:      time.Minute,
+	})
+
+	// Every lookup succeeds, since a failure against the bad server is
+	// retried against the good one.
+	for i := 0; i < 50; i++ {
+		_, err := dr.LookupMX(context.Background(), "example.com")
+		test.AssertNotError(t, err, "LookupMX failed")
+	}
+	test.Assert(t, good.queries() >= 50, "good server didn't answer every lookup")
+	test.AssertEquals(t, bad.queries(), minHealthSamples)
+
+	// Once the probe interval passes the next lookup triggers a probe, which
+	// brings the recovered server back into rotation.
+	bad.setFailing(false)
+	clk.Add(time.Minute)
+	_, err := dr.LookupMX(context.Background(), "example.com")
+	test.AssertNotError(t, err, "LookupMX failed")
+	waitForHealthy(t, dr, "bad:53")
+	before := bad.queries()
+	for i := 0; i < 50; i++ {
+		_, err := dr.LookupMX(context.Background(), "example.com")
+		test.AssertNotError(t, err, "LookupMX failed")
+	}
+	test.Assert(t, bad.queries() > before, "recovered server received no queries")
+}
+
+func TestHealthFailedProbe(t *testing.T) {
+	clk := clock.NewFake()
+	dr, _, bad := healthTestResolver(clk, ServerHealthConfig{
+		ErrorRateThreshold: 0.5,
+		ProbeInterval:      time.Minute,
+	})
+	for i := 0; i < 20; i++ {
+		_, _ = dr.LookupMX(context.Background(), "example.com")
+	}
+	test.AssertEquals(t, bad.queries(), minHealthSamples)
+
+	clk.Add(time.Minute)
+	_, _ = dr.LookupMX(context.Background(), "example.com")
+	waitForQueries(t, bad, minHealthSamples+1)
+
+	// The failed probe pushes the next one back by ProbeInterval.
+	waitForProbeDone(t, dr, "bad:53")
+	for i := 0; i < 20; i++ {
+		_, _ = dr.LookupMX(context.Background(), "example.com")
+	}
+	test.AssertEquals(t, bad.queries(), minHealthSamples+1)
+}
+
+func TestHealthLatency(t *testing.T) {
+	clk := clock.NewFake()
+	dr, _, slow := healthTestResolver(clk, ServerHealthConfig{
+		ErrorRateThreshold: 0.5,
+		MaxLatency:         time.Second,
+		ProbeInterval:      time.Minute,
+	})
+	slow.setFailing(false)
+	slow.rtt = 2 * time.Second
+
+	for i := 0; i < 50; i++ {
+		_, err := dr.LookupMX(context.Background(), "example.com")
+		test.AssertNotError(t, err, "LookupMX failed")
+	}
+	test.AssertEquals(t, slow.queries(), minHealthSamples)
+}
+
+func TestHealthAllUnhealthy(t *testing.T) {
+	clk := clock.NewFake()
+	dr, good, bad := healthTestResolver(clk, ServerHealthConfig{
+		ErrorRateThreshold: 0.5,
+		ProbeInterval:      time.Minute,
+	})
+	good.setFailing(true)
+	for i := 0; i < 20; i++ {
+		_, _ = dr.LookupMX(context.Background(), "example.com")
+	}
+	// With no healthy servers left queries still go out rather than failing
+	// without trying.
+	before := good.queries() + bad.queries()
+	_, _ = dr.LookupMX(context.Background(), "example.com")
+	test.AssertEquals(t, good.queries()+bad.queries(), before+2)
+}
+
+func waitForHealthy(t *testing.T, dr *DNSResolverImpl, server string) {
+	waitFor(t, func() bool {
+		dr.health.mu.Lock()
+		defer dr.health.mu.Unlock()
+		return !dr.health.get(server).unhealthy
+	})
+}
+
+func waitForProbeDone(t *testing.T, dr *DNSResolverImpl, server string) {
+	waitFor(t, func() bool {
+		dr.health.mu.Lock()
+		defer dr.health.mu.Unlock()
+		return !dr.health.get(server).probing
+	})
+}
+
+func waitForQueries(t *testing.T, se *scriptedExchanger, n int) {
+	waitFor(t, func() bool { return se.queries() >= n })
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// hangingExchanger never answers until released.
+type hangingExchanger struct {
+	scriptedExchanger
+	release chan struct{}
+}
+
+func (he *hangingExchanger) Exchange(m *dns.Msg, a string) (*dns.Msg, time.Duration, error) {
+	he.Lock()
+	he.count++
+	he.Unlock()
+	<-he.release
+	return nil, 0, &net.OpError{Op: "read", Err: tempError(true)}
+}
+
+func TestHealthTimeouts(t *testing.T) {
+	clk := clock.NewFake()
+	dr, good, _ := healthTestResolver(clk, ServerHealthConfig{
+		ErrorRateThreshold: 0.5,
+		ProbeInterval:      time.Minute,
+	})
+	hanging := &hangingExchanger{release: make(chan struct{})}
+	defer close(hanging.release)
+	dr.upstreamExchangers["bad:53"] = hanging
+
+	// Lookups sent to the hanging server time out, and those timeouts mark it
+	// unhealthy just like errors would.
+	for i := 0; i < 50; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+		_, _ = dr.LookupMX(ctx, "example.com")
+		cancel()
+	}
+	test.AssertEquals(t, hanging.queries(), minHealthSamples)
+	test.Assert(t, good.queries() > 0, "good server answered no lookups")
+
+	// Cancellation by the caller isn't held against a server.
+	dr.upstreamExchangers["good:53"] = hanging
+	samples := func() int {
+		dr.health.mu.Lock()
+		defer dr.health.mu.Unlock()
+		return dr.health.get("good:53").samples + dr.health.get("bad:53").samples
+	}
+	before := samples()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := dr.LookupMX(ctx, "example.com")
+	test.AssertError(t, err, "LookupMX succeeded after cancellation")
+	test.AssertEquals(t, samples(), before)
+}
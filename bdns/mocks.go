@@ -74,12 +74,12 @@ func (mock *MockDNSResolver) LookupHost(_ context.Context, hostname string) ([]n
 }
 
 // LookupCAA returns mock records for use in tests.
-func (mock *MockDNSResolver) LookupCAA(_ context.Context, domain string) ([]*dns.CAA, error) {
+func (mock *MockDNSResolver) LookupCAA(_ context.Context, domain string) ([]*dns.CAA, []dns.RR, error) {
 	var results []*dns.CAA
 	var record dns.CAA
 	switch strings.TrimRight(domain, ".") {
 	case "caa-timeout.com":
-		return nil, &DNSError{dns.TypeCAA, "always.timeout", MockTimeoutError(), -1}
+		return nil, nil, &DNSError{dns.TypeCAA, "always.timeout", MockTimeoutError(), -1}
 	case "reserved.com":
 		record.Tag = "issue"
 		record.Value = "ca.com"
@@ -95,9 +95,9 @@ func (mock *MockDNSResolver) LookupCAA(_ context.Context, domain string) ([]*dns
 		results = append(results, &record)
 	case "com":
 		// com has no CAA records.
-		return nil, nil
+		return nil, nil, nil
 	case "servfail.com", "servfail.present.com":
-		return results, fmt.Errorf("SERVFAIL")
+		return results, nil, fmt.Errorf("SERVFAIL")
 	case "multi-crit-present.com":
 		record.Flag = 1
 		record.Tag = "issue"
@@ -129,10 +129,20 @@ func (mock *MockDNSResolver) LookupCAA(_ context.Context, domain string) ([]*dns
 		record.Tag = "issue"
 		record.Value = ";"
 		results = append(results, &record)
+	case "cname-present.com":
+		// The resolver followed a CNAME to present.com's CAA records.
+		cname := &dns.CNAME{
+			Hdr:    dns.RR_Header{Name: "cname-present.com.", Rrtype: dns.TypeCNAME, Class: dns.ClassINET},
+			Target: "present.com.",
+		}
+		record.Hdr = dns.RR_Header{Name: "present.com.", Rrtype: dns.TypeCAA, Class: dns.ClassINET}
+		record.Tag = "issue"
+		record.Value = "letsencrypt.org"
+		return []*dns.CAA{&record}, []dns.RR{cname}, nil
 	case "bad-local-resolver.com":
-		return nil, DNSError{underlying: MockTimeoutError()}
+		return nil, nil, DNSError{underlying: MockTimeoutError()}
 	}
-	return results, nil
+	return results, nil, nil
 }
 
 // LookupMX is a mock
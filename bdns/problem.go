@@ -49,6 +49,18 @@ func (d DNSError) Timeout() bool {
 	return false
 }
 
+// Temporary returns true if the error is one that a later query might not
+// encounter: a network failure or timeout talking to the resolver, or a
+// SERVFAIL. An expired or canceled context is not considered temporary, since
+// a retry under the same context would fail the same way.
+func (d DNSError) Temporary() bool {
+	if d.underlying != nil {
+		_, ok := d.underlying.(*net.OpError)
+		return ok
+	}
+	return d.rCode == dns.RcodeServerFailure
+}
+
 const detailDNSTimeout = "query timed out"
 const detailDNSNetFailure = "networking error"
 const detailServerFailure = "server failure at resolver"
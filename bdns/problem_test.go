@@ -46,3 +46,23 @@ func TestProblemDetailsFromDNSError(t *testing.T) {
 		}
 	}
 }
+
+func TestDNSErrorTemporary(t *testing.T) {
+	testCases := []struct {
+		err      DNSError
+		expected bool
+	}{
+		{DNSError{dns.TypeA, "hostname", MockTimeoutError(), -1}, true},
+		{DNSError{dns.TypeMX, "hostname", &net.OpError{Err: errors.New("some net error")}, -1}, true},
+		{DNSError{dns.TypeTXT, "hostname", nil, dns.RcodeServerFailure}, true},
+		{DNSError{dns.TypeTXT, "hostname", nil, dns.RcodeNameError}, false},
+		{DNSError{dns.TypeTXT, "hostname", nil, dns.RcodeRefused}, false},
+		{DNSError{dns.TypeTXT, "hostname", context.DeadlineExceeded, -1}, false},
+		{DNSError{dns.TypeTXT, "hostname", errors.New("other failure"), -1}, false},
+	}
+	for _, tc := range testCases {
+		if tc.err.Temporary() != tc.expected {
+			t.Errorf("(%q).Temporary() = %t, expected %t", tc.err, !tc.expected, tc.expected)
+		}
+	}
+}
@@ -0,0 +1,337 @@
+package bdns
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Transport names the protocol used to reach an upstream resolver.
+type Transport string
+
+const (
+	// TransportTCP is plain DNS over TCP, the default.
+	TransportTCP = Transport("tcp")
+	// TransportUDP is plain DNS over UDP. Truncated responses are retried
+	// over TCP.
+	TransportUDP = Transport("udp")
+	// TransportTLS is DNS over TLS (RFC 7858).
+	TransportTLS = Transport("tls")
+	// TransportHTTPS is DNS over HTTPS (RFC 8484).
+	TransportHTTPS = Transport("https")
+)
+
+const dnsMessageMediaType = "application/dns-message"
+
+// maxDoHResponseSize bounds the body read from a DoH upstream. It is the
+// largest possible DNS message.
+const maxDoHResponseSize = 65535
+
+// maxIdleConnsPerUpstream bounds how many idle connections are kept open to
+// each DoT or DoH upstream for reuse.
+const maxIdleConnsPerUpstream = 8
+
+// Upstream describes a single upstream resolver and how to reach it.
+type Upstream struct {
+	// Address is a host:port for the tcp, udp and tls transports, and an
+	// https:// URL for the https transport.
+	Address   string
+	Transport Transport
+	// ServerName overrides the name used to verify the upstream's
+	// certificate. If empty, the host part of Address is used.
+	ServerName string
+	// RootCAs, if non-nil, is used instead of the system roots to verify the
+	// upstream's certificate.
+	RootCAs *x509.CertPool
+	// PinnedSPKIHashes is a list of base64-encoded SHA-256 hashes of
+	// SubjectPublicKeyInfos. If non-empty, one of the certificates presented
+	// by the upstream must match one of them.
+	PinnedSPKIHashes []string
+}
+
+// ErrPinMismatch is returned when an upstream presents a certificate chain
+// that doesn't match any of its configured pins.
+var ErrPinMismatch = errors.New("upstream certificate chain does not match any pinned key")
+
+// newExchanger builds the exchanger used to talk to upstream u.
+func newExchanger(u Upstream, readTimeout time.Duration) (exchanger, error) {
+	switch u.Transport {
+	case "", TransportTCP:
+		return &dns.Client{Net: string(TransportTCP), ReadTimeout: readTimeout}, nil
+	case TransportUDP:
+		return &udpExchanger{
+			udp: &dns.Client{Net: string(TransportUDP), ReadTimeout: readTimeout},
+			tcp: &dns.Client{Net: string(TransportTCP), ReadTimeout: readTimeout},
+		}, nil
+	case TransportTLS:
+		host, _, err := net.SplitHostPort(u.Address)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig, pins, err := upstreamTLSConfig(u, host)
+		if err != nil {
+			return nil, err
+		}
+		return &dotExchanger{
+			tlsConfig: tlsConfig,
+			pins:      pins,
+			timeout:   readTimeout,
+			idle:      make(map[string][]*dns.Conn),
+		}, nil
+	case TransportHTTPS:
+		endpoint, err := url.Parse(u.Address)
+		if err != nil {
+			return nil, err
+		}
+		if endpoint.Scheme != "https" {
+			return nil, fmt.Errorf("DoH upstream %q must be an https URL", u.Address)
+		}
+		tlsConfig, pins, err := upstreamTLSConfig(u, endpoint.Host)
+		if err != nil {
+			return nil, err
+		}
+		dialer := &net.Dialer{Timeout: readTimeout}
+		return &dohExchanger{
+			client: &http.Client{
+				Timeout: readTimeout,
+				Transport: &http.Transport{
+					DialTLS: func(network, addr string) (net.Conn, error) {
+						return dialPinnedTLS(dialer, network, addr, tlsConfig, pins)
+					},
+					MaxIdleConnsPerHost: maxIdleConnsPerUpstream,
+				},
+			},
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown DNS transport %q", u.Transport)
+	}
+}
+
+// upstreamTLSConfig builds the TLS configuration for an upstream and decodes
+// its pins.
+func upstreamTLSConfig(u Upstream, host string) (*tls.Config, [][]byte, error) {
+	serverName := u.ServerName
+	if serverName == "" {
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		serverName = host
+	}
+	var pins [][]byte
+	for _, p := range u.PinnedSPKIHashes {
+		pin, err := base64.StdEncoding.DecodeString(p)
+		if err != nil {
+			return nil, nil, fmt.Errorf("decoding pin %q: %s", p, err)
+		}
+		if len(pin) != sha256.Size {
+			return nil, nil, fmt.Errorf("pin %q is not a SHA-256 hash", p)
+		}
+		pins = append(pins, pin)
+	}
+	return &tls.Config{
+		ServerName: serverName,
+		RootCAs:    u.RootCAs,
+		MinVersion: tls.VersionTLS12,
+	}, pins, nil
+}
+
+// dialPinnedTLS dials a TLS connection, completes the handshake and checks
+// the presented chain against pins.
+func dialPinnedTLS(dialer *net.Dialer, network, addr string, config *tls.Config, pins [][]byte) (net.Conn, error) {
+	conn, err := tls.DialWithDialer(dialer, network, addr, config)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkPins(conn.ConnectionState(), pins); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// checkPins returns nil if pins is empty or any certificate in the verified
+// chain has a SubjectPublicKeyInfo whose SHA-256 hash is in pins.
+func checkPins(state tls.ConnectionState, pins [][]byte) error {
+	if len(pins) == 0 {
+		return nil
+	}
+	for _, chain := range state.VerifiedChains {
+		for _, cert := range chain {
+			hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+			for _, pin := range pins {
+				if subtle.ConstantTimeCompare(hash[:], pin) == 1 {
+					return nil
+				}
+			}
+		}
+	}
+	return ErrPinMismatch
+}
+
+// udpExchanger performs plain DNS exchanges over UDP, and repeats them over
+// TCP when the response is truncated, so that a partial answer is never used.
+type udpExchanger struct {
+	udp *dns.Client
+	tcp *dns.Client
+}
+
+func (u *udpExchanger) Exchange(m *dns.Msg, a string) (*dns.Msg, time.Duration, error) {
+	r, rtt, err := u.udp.Exchange(m, a)
+	// Depending on how much of it fits, a truncated response is either
+	// returned with ErrTruncated or parses cleanly with the TC bit set.
+	if err != dns.ErrTruncated && (err != nil || !r.Truncated) {
+		return r, rtt, err
+	}
+	r, tcpRTT, err := u.tcp.Exchange(m, a)
+	return r, rtt + tcpRTT, err
+}
+
+// dotExchanger performs DNS over TLS exchanges, keeping connections to each
+// upstream open between queries.
+type dotExchanger struct {
+	tlsConfig *tls.Config
+	pins      [][]byte
+	timeout   time.Duration
+
+	mu   sync.Mutex
+	idle map[string][]*dns.Conn
+}
+
+func (d *dotExchanger) Exchange(m *dns.Msg, a string) (*dns.Msg, time.Duration, error) {
+	start := time.Now()
+	co, reused, err := d.getConn(a)
+	if err != nil {
+		return nil, 0, err
+	}
+	r, err := d.exchangeConn(co, m)
+	if err != nil && reused {
+		// The upstream may have closed an idle connection since we last used
+		// it, so give a fresh connection one chance before failing.
+		_ = co.Close()
+		co, err = d.dial(a)
+		if err != nil {
+			return nil, 0, err
+		}
+		r, err = d.exchangeConn(co, m)
+	}
+	if err != nil {
+		_ = co.Close()
+		return nil, 0, err
+	}
+	d.putConn(a, co)
+	return r, time.Since(start), nil
+}
+
+func (d *dotExchanger) exchangeConn(co *dns.Conn, m *dns.Msg) (*dns.Msg, error) {
+	if err := co.SetDeadline(time.Now().Add(d.timeout)); err != nil {
+		return nil, err
+	}
+	if err := co.WriteMsg(m); err != nil {
+		return nil, err
+	}
+	r, err := co.ReadMsg()
+	if err != nil {
+		return nil, err
+	}
+	if r.Id != m.Id {
+		return nil, dns.ErrId
+	}
+	return r, nil
+}
+
+func (d *dotExchanger) getConn(a string) (*dns.Conn, bool, error) {
+	d.mu.Lock()
+	if conns := d.idle[a]; len(conns) > 0 {
+		co := conns[len(conns)-1]
+		d.idle[a] = conns[:len(conns)-1]
+		d.mu.Unlock()
+		return co, true, nil
+	}
+	d.mu.Unlock()
+	co, err := d.dial(a)
+	return co, false, err
+}
+
+func (d *dotExchanger) putConn(a string, co *dns.Conn) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.idle[a]) >= maxIdleConnsPerUpstream {
+		_ = co.Close()
+		return
+	}
+	d.idle[a] = append(d.idle[a], co)
+}
+
+func (d *dotExchanger) dial(a string) (*dns.Conn, error) {
+	conn, err := dialPinnedTLS(&net.Dialer{Timeout: d.timeout}, "tcp", a, d.tlsConfig, d.pins)
+	if err != nil {
+		return nil, err
+	}
+	return &dns.Conn{Conn: conn}, nil
+}
+
+// dohExchanger performs DNS over HTTPS exchanges using the POST method from
+// RFC 8484. The server address passed to Exchange is the endpoint URL.
+type dohExchanger struct {
+	client *http.Client
+}
+
+func (d *dohExchanger) Exchange(m *dns.Msg, a string) (*dns.Msg, time.Duration, error) {
+	packed, err := m.Pack()
+	if err != nil {
+		return nil, 0, err
+	}
+	req, err := http.NewRequest("POST", a, bytes.NewReader(packed))
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Content-Type", dnsMessageMediaType)
+	req.Header.Set("Accept", dnsMessageMediaType)
+
+	start := time.Now()
+	resp, err := d.client.Do(req)
+	if err != nil {
+		// Unwrap url.Errors so that network errors are classified the same
+		// way as they are for the other transports.
+		if urlErr, ok := err.(*url.Error); ok {
+			err = urlErr.Err
+		}
+		return nil, 0, err
+	}
+	defer func() {
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("DoH upstream returned HTTP status %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != dnsMessageMediaType {
+		return nil, 0, fmt.Errorf("DoH upstream returned unexpected Content-Type %q", ct)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxDoHResponseSize))
+	if err != nil {
+		return nil, 0, err
+	}
+	r := new(dns.Msg)
+	if err := r.Unpack(body); err != nil {
+		return nil, 0, err
+	}
+	if r.Id != m.Id {
+		return nil, 0, dns.ErrId
+	}
+	return r, time.Since(start), nil
+}
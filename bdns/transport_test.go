@@ -0,0 +1,204 @@
+package bdns
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jmhodges/clock"
+	"github.com/letsencrypt/boulder/test"
+	"github.com/miekg/dns"
+	"golang.org/x/net/context"
+)
+
+// answerA replies to every question with a single A record for 10.10.10.10.
+func answerA(r *dns.Msg) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetReply(r)
+	for _, q := range r.Question {
+		if q.Qtype == dns.TypeA {
+			m.Answer = append(m.Answer, &dns.A{
+				Hdr: dns.RR_Header{Name: q.Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+				A:   net.ParseIP("10.10.10.10"),
+			})
+		}
+	}
+	return m
+}
+
+func spkiPin(cert *x509.Certificate) string {
+	hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+func newDoHServer(t *testing.T) *httptest.Server {
+	return httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.Header.Get("Content-Type") != dnsMessageMediaType {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		body, err := ioutil.ReadAll(r.Body)
+		test.AssertNotError(t, err, "reading DoH request")
+		q := new(dns.Msg)
+		test.AssertNotError(t, q.Unpack(body), "unpacking DoH request")
+		packed, err := answerA(q).Pack()
+		test.AssertNotError(t, err, "packing DoH response")
+		w.Header().Set("Content-Type", dnsMessageMediaType)
+		_, _ = w.Write(packed)
+	}))
+}
+
+func TestDoHUpstream(t *testing.T) {
+	srv := newDoHServer(t)
+	defer srv.Close()
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+
+	dr := NewTestDNSResolverImpl(time.Second, nil, testStats, clock.NewFake(), 1)
+	err := dr.SetUpstreams([]Upstream{{
+		Address:          srv.URL + "/dns-query",
+		Transport:        TransportHTTPS,
+		RootCAs:          roots,
+		PinnedSPKIHashes: []string{spkiPin(srv.Certificate())},
+	}})
+	test.AssertNotError(t, err, "SetUpstreams failed")
+
+	ips, err := dr.LookupHost(context.Background(), "example.com")
+	test.AssertNotError(t, err, "LookupHost over DoH failed")
+	test.AssertEquals(t, len(ips), 1)
+	test.AssertEquals(t, ips[0].String(), "10.10.10.10")
+
+	// A pin that doesn't match the server's key must cause lookups to fail.
+	err = dr.SetUpstreams([]Upstream{{
+		Address:          srv.URL + "/dns-query",
+		Transport:        TransportHTTPS,
+		RootCAs:          roots,
+		PinnedSPKIHashes: []string{base64.StdEncoding.EncodeToString(make([]byte, sha256.Size))},
+	}})
+	test.AssertNotError(t, err, "SetUpstreams failed")
+	_, err = dr.LookupHost(context.Background(), "example.com")
+	test.AssertError(t, err, "LookupHost with mismatched pin succeeded")
+}
+
+func TestDoTUpstream(t *testing.T) {
+	// Borrow httptest's self-signed certificate for the DoT listener.
+	certSrv := httptest.NewTLSServer(http.NotFoundHandler())
+	defer certSrv.Close()
+	roots := x509.NewCertPool()
+	roots.AddCert(certSrv.Certificate())
+
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: certSrv.TLS.Certificates})
+	test.AssertNotError(t, err, "listening for DoT")
+	var connsMu sync.Mutex
+	conns := map[string]bool{}
+	server := &dns.Server{
+		Listener: l,
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+			connsMu.Lock()
+			conns[w.RemoteAddr().String()] = true
+			connsMu.Unlock()
+			_ = w.WriteMsg(answerA(r))
+		}),
+	}
+	go func() { _ = server.ActivateAndServe() }()
+	defer func() { _ = server.Shutdown() }()
+
+	dr := NewTestDNSResolverImpl(time.Second, nil, testStats, clock.NewFake(), 1)
+	err = dr.SetUpstreams([]Upstream{{
+		Address:          l.Addr().String(),
+		Transport:        TransportTLS,
+		RootCAs:          roots,
+		PinnedSPKIHashes: []string{spkiPin(certSrv.Certificate())},
+	}})
+	test.AssertNotError(t, err, "SetUpstreams failed")
+
+	for i := 0; i < 3; i++ {
+		ips, err := dr.LookupHost(context.Background(), "example.com")
+		test.AssertNotError(t, err, "LookupHost over DoT failed")
+		test.AssertEquals(t, len(ips), 1)
+		test.AssertEquals(t, ips[0].String(), "10.10.10.10")
+	}
+	connsMu.Lock()
+	test.AssertEquals(t, len(conns), 1)
+	connsMu.Unlock()
+
+	// Without the test root the upstream's certificate must be rejected.
+	err = dr.SetUpstreams([]Upstream{{Address: l.Addr().String(), Transport: TransportTLS}})
+	test.AssertNotError(t, err, "SetUpstreams failed")
+	_, err = dr.LookupHost(context.Background(), "example.com")
+	test.AssertError(t, err, "LookupHost to untrusted DoT upstream succeeded")
+}
+
+func TestUDPUpstreamTruncated(t *testing.T) {
+	// The UDP listener only ever sends empty, truncated responses, so lookups
+	// can only succeed by retrying over TCP on the same port.
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	test.AssertNotError(t, err, "listening for UDP")
+	l, err := net.Listen("tcp", pc.LocalAddr().String())
+	test.AssertNotError(t, err, "listening for TCP")
+	var udpQueries, tcpQueries int
+	var queriesMu sync.Mutex
+	udpServer := &dns.Server{
+		PacketConn: pc,
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+			queriesMu.Lock()
+			udpQueries++
+			queriesMu.Unlock()
+			m := new(dns.Msg)
+			m.SetReply(r)
+			m.Truncated = true
+			_ = w.WriteMsg(m)
+		}),
+	}
+	tcpServer := &dns.Server{
+		Listener: l,
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+			queriesMu.Lock()
+			tcpQueries++
+			queriesMu.Unlock()
+			_ = w.WriteMsg(answerA(r))
+		}),
+	}
+	go func() { _ = udpServer.ActivateAndServe() }()
+	defer func() { _ = udpServer.Shutdown() }()
+	go func() { _ = tcpServer.ActivateAndServe() }()
+	defer func() { _ = tcpServer.Shutdown() }()
+
+	dr := NewTestDNSResolverImpl(time.Second, nil, testStats, clock.NewFake(), 1)
+	err = dr.SetUpstreams([]Upstream{{Address: pc.LocalAddr().String(), Transport: TransportUDP}})
+	test.AssertNotError(t, err, "SetUpstreams failed")
+
+	ips, err := dr.LookupHost(context.Background(), "example.com")
+	test.AssertNotError(t, err, "LookupHost over UDP failed")
+	test.AssertEquals(t, len(ips), 1)
+	test.AssertEquals(t, ips[0].String(), "10.10.10.10")
+	queriesMu.Lock()
+	defer queriesMu.Unlock()
+	test.Assert(t, udpQueries > 0, "No queries were sent over UDP")
+	test.AssertEquals(t, tcpQueries, udpQueries)
+}
+
+func TestSetUpstreamsErrors(t *testing.T) {
+	dr := NewTestDNSResolverImpl(time.Second, nil, testStats, clock.NewFake(), 1)
+	testCases := [][]Upstream{
+		nil,
+		{{Address: "127.0.0.1:53", Transport: "carrier-pigeon"}},
+		{{Address: "http://127.0.0.1/dns-query", Transport: TransportHTTPS}},
+		{{Address: "127.0.0.1", Transport: TransportTLS}},
+		{{Address: "127.0.0.1:853", Transport: TransportTLS, PinnedSPKIHashes: []string{"aGk="}}},
+		{{Address: "127.0.0.1:53"}, {Address: "127.0.0.1:53"}},
+	}
+	for i, tc := range testCases {
+		if err := dr.SetUpstreams(tc); err == nil {
+			t.Errorf("#%d: expected error from SetUpstreams(%v)", i, tc)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"crypto"
 	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
@@ -14,6 +15,7 @@ import (
 	"fmt"
 	"math/big"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/cactus/go-statsd-client/statsd"
@@ -30,7 +32,9 @@ import (
 	"github.com/letsencrypt/boulder/core"
 	csrlib "github.com/letsencrypt/boulder/csr"
 	"github.com/letsencrypt/boulder/goodkey"
+	"github.com/letsencrypt/boulder/lint"
 	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/reloader"
 	oldx509 "github.com/letsencrypt/go/src/crypto/x509"
 	"github.com/letsencrypt/go/src/encoding/asn1"
 )
@@ -74,6 +78,10 @@ var (
 
 // Metrics for CA statistics
 const (
+	// Increments for each certificate issued through CFSSL, or natively
+	metricIssuedCFSSL  = "CA.Issued.CFSSL"
+	metricIssuedNative = "CA.Issued.Native"
+
 	// Increments when CA observes an HSM or signing error
 	metricSigningError = "CA.SigningError"
 	metricHSMError     = metricSigningError + ".HSMError"
@@ -98,6 +106,11 @@ const (
 
 type certificateStorage interface {
 	AddCertificate(context.Context, []byte, int64) (string, error)
+	AddPrecertificate(context.Context, []byte, int64) error
+	ClaimPrecertificate(context.Context, string) error
+	GetCertificate(context.Context, string) (core.Certificate, error)
+	GetPrecertificate(context.Context, string) (core.Certificate, error)
+	GetRevokedCertificates(context.Context, string, time.Time, int) ([]core.RevokedCertificate, error)
 }
 
 // CertificateAuthorityImpl represents a CA that signs certificates, CRLs, and
@@ -105,10 +118,21 @@ type certificateStorage interface {
 type CertificateAuthorityImpl struct {
 	rsaProfile   string
 	ecdsaProfile string
+	// The profile used for certificates for email addresses. If empty, the CA
+	// refuses to issue them.
+	emailProfile string
 	// A map from issuer cert common name to an internalIssuer struct
 	issuers map[string]*internalIssuer
 	// The common name of the default issuer cert
-	defaultIssuer    *internalIssuer
+	defaultIssuer *internalIssuer
+	// Issuers chosen by subscriber key type, and by profile. An issuer chosen
+	// by profile takes precedence.
+	keyTypeIssuers map[string]*internalIssuer
+	profileIssuers map[string]*internalIssuer
+	// Profiles issued natively rather than through CFSSL
+	nativeProfiles map[string]*issuanceProfile
+	// If set, certificates are linted before they're issued
+	linter           *lint.Linter
 	SA               certificateStorage
 	PA               core.PolicyAuthority
 	Publisher        core.Publisher
@@ -118,15 +142,25 @@ type CertificateAuthorityImpl struct {
 	stats            statsd.Statter
 	prefix           int // Prepended to the serial number
 	validityPeriod   time.Duration
+	lifespanOCSP     time.Duration
+	// The number of revoked certificates read from the SA at a time when
+	// signing a CRL
+	crlPageSize int
 	maxNames         int
 	forceCNFromSAN   bool
 	enableMustStaple bool
+
+	// How long before an OCSP delegate expires to warn about it
+	ocspDelegateWarning time.Duration
 }
 
 // Issuer represents a single issuer certificate, along with its key.
 type Issuer struct {
 	Signer crypto.Signer
 	Cert   *x509.Certificate
+	// If set, a PEM file holding a delegated OCSP responder certificate
+	// followed by its key, which signs OCSP responses in place of Signer
+	OCSPDelegateFile string
 }
 
 // internalIssuer represents the fully initialized internal state for a single
@@ -135,12 +169,27 @@ type internalIssuer struct {
 	cert       *x509.Certificate
 	eeSigner   signer.Signer
 	ocspSigner ocsp.Signer
+	// The issuer's own key and signature algorithm, for native issuance and
+	// for CRLs, which CFSSL can't sign with the extensions we need.
+	key    crypto.Signer
+	sigAlg x509.SignatureAlgorithm
+	// If linting is enabled, an issuer with a throwaway key that signs the
+	// certificates to be linted
+	lintIssuer *internalIssuer
+	// If set, the delegated responder that signs OCSP in place of ocspSigner.
+	// It's replaced when its file changes.
+	delegateMu   sync.RWMutex
+	ocspDelegate *ocspDelegate
+	// delegateReloader reloads ocspDelegate from its file, until Close stops
+	// it
+	delegateReloader *reloader.Reloader
 }
 
 func makeInternalIssuers(
 	issuers []Issuer,
 	policy *cfsslConfig.Signing,
 	lifespanOCSP time.Duration,
+	lint bool,
 ) (map[string]*internalIssuer, error) {
 	if len(issuers) == 0 {
 		return nil, errors.New("No issuers specified.")
@@ -150,7 +199,11 @@ func makeInternalIssuers(
 		if iss.Cert == nil || iss.Signer == nil {
 			return nil, errors.New("Issuer with nil cert or signer specified.")
 		}
-		eeSigner, err := local.NewSigner(iss.Signer, iss.Cert, x509.SHA256WithRSA, policy)
+		sigAlg, err := issuerSignatureAlgorithm(iss.Signer)
+		if err != nil {
+			return nil, err
+		}
+		eeSigner, err := local.NewSigner(iss.Signer, iss.Cert, sigAlg, policy)
 		if err != nil {
 			return nil, err
 		}
@@ -169,14 +222,65 @@ func makeInternalIssuers(
 			cert:       iss.Cert,
 			eeSigner:   eeSigner,
 			ocspSigner: ocspSigner,
+			key:        iss.Signer,
+			sigAlg:     sigAlg,
+		}
+		if lint {
+			internalIssuers[cn].lintIssuer, err = makeLintIssuer(internalIssuers[cn], policy)
+			if err != nil {
+				return nil, err
+			}
 		}
 	}
 	return internalIssuers, nil
 }
 
+// issuerSignatureAlgorithm returns the algorithm an issuer with the given key
+// signs certificates with.
+func issuerSignatureAlgorithm(key crypto.Signer) (x509.SignatureAlgorithm, error) {
+	switch pub := key.Public().(type) {
+	case *rsa.PublicKey:
+		return x509.SHA256WithRSA, nil
+	case *ecdsa.PublicKey:
+		switch pub.Curve {
+		case elliptic.P256():
+			return x509.ECDSAWithSHA256, nil
+		case elliptic.P384():
+			return x509.ECDSAWithSHA384, nil
+		}
+		return x509.UnknownSignatureAlgorithm, fmt.Errorf("Unsupported issuer ECDSA curve %s", pub.Curve.Params().Name)
+	}
+	return x509.UnknownSignatureAlgorithm, fmt.Errorf("Unsupported issuer key type %T", key.Public())
+}
+
+// Key types that issuers may be chosen by
+const (
+	keyTypeRSA   = "RSA"
+	keyTypeECDSA = "ECDSA"
+)
+
+// issuersByName looks up the issuer for each common name in names, which maps
+// key types or profiles to issuer common names, and checks each key using
+// valid.
+func issuersByName(names map[string]string, issuers map[string]*internalIssuer, valid func(string) bool) (map[string]*internalIssuer, error) {
+	result := make(map[string]*internalIssuer)
+	for key, cn := range names {
+		if !valid(key) {
+			return nil, fmt.Errorf("unknown key type or profile %q", key)
+		}
+		issuer := issuers[cn]
+		if issuer == nil {
+			return nil, fmt.Errorf("no issuer cert with CommonName %q for %q", cn, key)
+		}
+		result[key] = issuer
+	}
+	return result, nil
+}
+
 // NewCertificateAuthorityImpl creates a CA instance that can sign certificates
-// from a single issuer (the first first in the issers slice), and can sign OCSP
-// for any of the issuer certificates provided.
+// from any of the issuers provided, using the first in the issuers slice unless
+// the config chooses another by key type or profile, and can sign OCSP for any
+// of the issuer certificates provided.
 func NewCertificateAuthorityImpl(
 	config cmd.CAConfig,
 	clk clock.Clock,
@@ -211,12 +315,33 @@ func NewCertificateAuthorityImpl(
 	internalIssuers, err := makeInternalIssuers(
 		issuers,
 		cfsslConfigObj.Signing,
-		config.LifespanOCSP.Duration)
+		config.LifespanOCSP.Duration,
+		config.Lint != nil)
 	if err != nil {
 		return nil, err
 	}
 	defaultIssuer := internalIssuers[issuers[0].Cert.Subject.CommonName]
 
+	keyTypeIssuers, err := issuersByName(config.KeyTypeIssuers, internalIssuers, func(keyType string) bool {
+		return keyType == keyTypeRSA || keyType == keyTypeECDSA
+	})
+	if err != nil {
+		return nil, err
+	}
+	nativeProfiles := make(map[string]*issuanceProfile)
+	for name, pc := range config.Profiles {
+		nativeProfiles[name], err = newIssuanceProfile(pc)
+		if err != nil {
+			return nil, fmt.Errorf("invalid profile %q: %s", name, err)
+		}
+	}
+	profileIssuers, err := issuersByName(config.ProfileIssuers, internalIssuers, func(profile string) bool {
+		return nativeProfiles[profile] != nil || cfsslConfigObj.Signing.Profiles[profile] != nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
 	rsaProfile := config.RSAProfile
 	ecdsaProfile := config.ECDSAProfile
 
@@ -227,9 +352,15 @@ func NewCertificateAuthorityImpl(
 	ca = &CertificateAuthorityImpl{
 		issuers:          internalIssuers,
 		defaultIssuer:    defaultIssuer,
+		keyTypeIssuers:   keyTypeIssuers,
+		profileIssuers:   profileIssuers,
+		nativeProfiles:   nativeProfiles,
 		rsaProfile:       rsaProfile,
 		ecdsaProfile:     ecdsaProfile,
+		emailProfile:     config.EmailProfile,
 		prefix:           config.SerialPrefix,
+		lifespanOCSP:     config.LifespanOCSP.Duration,
+		crlPageSize:      defaultCRLPageSize,
 		clk:              clk,
 		log:              logger,
 		stats:            stats,
@@ -248,6 +379,28 @@ func NewCertificateAuthorityImpl(
 
 	ca.maxNames = config.MaxNames
 
+	if config.Lint != nil {
+		ca.linter, err = lint.New(config.Lint.Disabled, &ca.keyPolicy, config.Lint.MaxValidity.Duration)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ca.ocspDelegateWarning = config.OCSPDelegateWarning.Duration
+	if ca.ocspDelegateWarning == 0 {
+		ca.ocspDelegateWarning = defaultOCSPDelegateWarning
+	}
+	for _, iss := range issuers {
+		if iss.OCSPDelegateFile == "" {
+			continue
+		}
+		issuer := internalIssuers[iss.Cert.Subject.CommonName]
+		if err = ca.watchOCSPDelegate(issuer, iss.OCSPDelegateFile); err != nil {
+			ca.Close()
+			return nil, fmt.Errorf("loading OCSP delegate for issuer %q: %s", iss.Cert.Subject.CommonName, err)
+		}
+	}
+
 	return ca, nil
 }
 
@@ -344,6 +497,11 @@ func (ca *CertificateAuthorityImpl) GenerateOCSP(ctx context.Context, xferObj co
 		return nil, err
 	}
 
+	if core.IsShortLived(cert) {
+		return nil, fmt.Errorf("GenerateOCSP was asked to sign OCSP for cert %s, "+
+			"which is short-lived and has no OCSP URL", core.SerialToString(cert.SerialNumber))
+	}
+
 	signRequest := ocsp.SignRequest{
 		Certificate: cert,
 		Status:      xferObj.Status,
@@ -364,16 +522,99 @@ func (ca *CertificateAuthorityImpl) GenerateOCSP(ctx context.Context, xferObj co
 			core.SerialToString(cert.SerialNumber), cn, err)
 	}
 
-	ocspResponse, err := issuer.ocspSigner.Sign(signRequest)
+	ocspResponse, err := ca.ocspSigner(issuer).Sign(signRequest)
 	ca.noteSignError(err)
 	return ocspResponse, err
 }
 
+// signCFSSL signs a certificate through the issuer's CFSSL signer, and returns
+// it DER encoded.
+func (ca *CertificateAuthorityImpl) signCFSSL(issuer *internalIssuer, req signer.SignRequest, serialHex string) ([]byte, error) {
+	certPEM, err := issuer.eeSigner.Sign(req)
+	ca.noteSignError(err)
+	if err != nil {
+		err = core.InternalServerError(err.Error())
+		// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+		ca.log.AuditErr(fmt.Sprintf("Signing failed: serial=[%s] err=[%v]", serialHex, err))
+		return nil, err
+	}
+
+	if len(certPEM) == 0 {
+		err = core.InternalServerError("No certificate returned by server")
+		// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+		ca.log.AuditErr(fmt.Sprintf("PEM empty from Signer: serial=[%s] err=[%v]", serialHex, err))
+		return nil, err
+	}
+
+	block, _ := pem.Decode(certPEM)
+	if block == nil || block.Type != "CERTIFICATE" {
+		err = core.InternalServerError("Invalid certificate value returned")
+		// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+		ca.log.AuditErr(fmt.Sprintf("PEM decode error, aborting: serial=[%s] pem=[%s] err=[%v]",
+			serialHex, certPEM, err))
+		return nil, err
+	}
+	ca.stats.Inc(metricIssuedCFSSL, 1, 1.0)
+	return block.Bytes, nil
+}
+
+// signNative signs a certificate built from profile, without CFSSL, and
+// returns it DER encoded.
+func (ca *CertificateAuthorityImpl) signNative(issuer *internalIssuer, profile *issuanceProfile, req issuanceRequest, serialHex string) ([]byte, error) {
+	certDER, err := issuer.issue(profile, req, ca.clk.Now())
+	ca.noteSignError(err)
+	if err != nil {
+		err = core.InternalServerError(err.Error())
+		// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+		ca.log.AuditErr(fmt.Sprintf("Signing failed: serial=[%s] err=[%v]", serialHex, err))
+		return nil, err
+	}
+	ca.stats.Inc(metricIssuedNative, 1, 1.0)
+	return certDER, nil
+}
+
+// profileForKey returns the profile used for, and the type of, a subscriber
+// key. Certificates for email addresses use the email profile instead.
+func (ca *CertificateAuthorityImpl) profileForKey(key interface{}) (profile, keyType string, err error) {
+	switch key.(type) {
+	case *rsa.PublicKey:
+		return ca.rsaProfile, keyTypeRSA, nil
+	case *ecdsa.PublicKey:
+		return ca.ecdsaProfile, keyTypeECDSA, nil
+	}
+	return "", "", core.InternalServerError(fmt.Sprintf("unsupported key type %T", key))
+}
+
+// chooseIssuer returns the issuer that signs certificates using profile for
+// subscriber keys of keyType.
+func (ca *CertificateAuthorityImpl) chooseIssuer(keyType, profile string) *internalIssuer {
+	if issuer := ca.profileIssuers[profile]; issuer != nil {
+		return issuer
+	}
+	if issuer := ca.keyTypeIssuers[keyType]; issuer != nil {
+		return issuer
+	}
+	return ca.defaultIssuer
+}
+
 // IssueCertificate attempts to convert a CSR into a signed Certificate, while
 // enforcing all policies. Names (domains) in the CertificateRequest will be
 // lowercased before storage.
-// Currently it will always sign with the defaultIssuer.
+// It signs with the issuer chosen for the CSR's key type and profile, or the
+// defaultIssuer if none is.
 func (ca *CertificateAuthorityImpl) IssueCertificate(ctx context.Context, csr oldx509.CertificateRequest, regID int64) (core.Certificate, error) {
+	return ca.issueCertificateOrPrecertificate(ctx, csr, regID, false)
+}
+
+// IssuePrecertificate is like IssueCertificate, but issues a precertificate
+// to be submitted to CT logs. The precertificate is stored, but not itself
+// submitted. Only native profiles that allow embedded SCTs can issue
+// precertificates.
+func (ca *CertificateAuthorityImpl) IssuePrecertificate(ctx context.Context, csr oldx509.CertificateRequest, regID int64) (core.Certificate, error) {
+	return ca.issueCertificateOrPrecertificate(ctx, csr, regID, true)
+}
+
+func (ca *CertificateAuthorityImpl) issueCertificateOrPrecertificate(ctx context.Context, csr oldx509.CertificateRequest, regID int64, precertificate bool) (core.Certificate, error) {
 	emptyCert := core.Certificate{}
 
 	if err := csrlib.VerifyCSR(&csr, ca.maxNames, &ca.keyPolicy, ca.PA, ca.forceCNFromSAN, regID); err != nil {
@@ -387,16 +628,6 @@ func (ca *CertificateAuthorityImpl) IssueCertificate(ctx context.Context, csr ol
 		return emptyCert, err
 	}
 
-	issuer := ca.defaultIssuer
-	notAfter := ca.clk.Now().Add(ca.validityPeriod)
-
-	if issuer.cert.NotAfter.Before(notAfter) {
-		err = core.InternalServerError("Cannot issue a certificate that expires after the issuer certificate.")
-		// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
-		ca.log.AuditErr(err.Error())
-		return emptyCert, err
-	}
-
 	// Convert the CSR to PEM
 	csrPEM := string(pem.EncodeToMemory(&pem.Block{
 		Type:  "CERTIFICATE REQUEST",
@@ -418,69 +649,134 @@ func (ca *CertificateAuthorityImpl) IssueCertificate(ctx context.Context, csr ol
 	serialBigInt = serialBigInt.SetBytes(serialBytes)
 	serialHex := core.SerialToString(serialBigInt)
 
-	var profile string
-	switch csr.PublicKey.(type) {
-	case *rsa.PublicKey:
-		profile = ca.rsaProfile
-	case *ecdsa.PublicKey:
-		profile = ca.ecdsaProfile
-	default:
-		err = core.InternalServerError(fmt.Sprintf("unsupported key type %T", csr.PublicKey))
+	profile, keyType, err := ca.profileForKey(csr.PublicKey)
+	if err != nil {
 		// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
 		ca.log.AuditErr(err.Error())
 		return emptyCert, err
 	}
 
-	// Send the cert off for signing
-	req := signer.SignRequest{
-		Request: csrPEM,
-		Profile: profile,
-		Hosts:   csr.DNSNames,
-		Subject: &signer.Subject{
-			CN: csr.Subject.CommonName,
-		},
-		Serial:     serialBigInt,
-		Extensions: requestedExtensions,
-	}
-	if !ca.forceCNFromSAN {
-		req.Subject.SerialNumber = serialHex
+	// Certificates for email addresses use their own profile regardless of key
+	// type. VerifyCSR ensures the CSR doesn't also contain DNS names.
+	hosts := csr.DNSNames
+	if len(csr.EmailAddresses) > 0 {
+		if ca.emailProfile == "" {
+			err = core.MalformedRequestError("Issuance for email addresses not supported")
+			// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
+			ca.log.AuditErr(err.Error())
+			return emptyCert, err
+		}
+		profile = ca.emailProfile
+		hosts = csr.EmailAddresses
 	}
 
-	ca.log.AuditInfo(fmt.Sprintf("Signing: serial=[%s] names=[%s] csr=[%s]",
-		serialHex, strings.Join(csr.DNSNames, ", "), hex.EncodeToString(csr.Raw)))
+	issuer := ca.chooseIssuer(keyType, profile)
+	nativeProfile := ca.nativeProfiles[profile]
+	validity := ca.validityPeriod
+	if nativeProfile != nil {
+		validity = nativeProfile.validity
+	}
+	notAfter := ca.clk.Now().Add(validity)
 
-	certPEM, err := issuer.eeSigner.Sign(req)
-	ca.noteSignError(err)
-	if err != nil {
-		err = core.InternalServerError(err.Error())
-		// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
-		ca.log.AuditErr(fmt.Sprintf("Signing failed: serial=[%s] err=[%v]", serialHex, err))
+	if precertificate && (nativeProfile == nil || !nativeProfile.allowSCTList) {
+		err = core.InternalServerError(fmt.Sprintf("Profile %q can't issue precertificates", profile))
+		// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
+		ca.log.AuditErr(err.Error())
 		return emptyCert, err
 	}
 
-	if len(certPEM) == 0 {
-		err = core.InternalServerError("No certificate returned by server")
-		// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
-		ca.log.AuditErr(fmt.Sprintf("PEM empty from Signer: serial=[%s] err=[%v]", serialHex, err))
+	if issuer.cert.NotAfter.Before(notAfter) {
+		err = core.InternalServerError("Cannot issue a certificate that expires after the issuer certificate.")
+		// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
+		ca.log.AuditErr(fmt.Sprintf("%s issuer=[%s]", err, issuer.cert.Subject.CommonName))
 		return emptyCert, err
 	}
 
-	block, _ := pem.Decode(certPEM)
-	if block == nil || block.Type != "CERTIFICATE" {
-		err = core.InternalServerError("Invalid certificate value returned")
-		// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
-		ca.log.AuditErr(fmt.Sprintf("PEM decode error, aborting: serial=[%s] pem=[%s] err=[%v]",
-			serialHex, certPEM, err))
+	ca.log.AuditInfo(fmt.Sprintf("Signing: serial=[%s] names=[%s] csr=[%s]",
+		serialHex, strings.Join(hosts, ", "), hex.EncodeToString(csr.Raw)))
+
+	var nativeReq issuanceRequest
+	var cfsslReq signer.SignRequest
+	if nativeProfile != nil {
+		nativeReq = issuanceRequest{
+			PublicKey:  csr.PublicKey,
+			Serial:     serialBigInt,
+			CommonName: csr.Subject.CommonName,
+		}
+		if len(csr.EmailAddresses) > 0 {
+			nativeReq.EmailAddresses = hosts
+		} else {
+			nativeReq.DNSNames = hosts
+		}
+		if !ca.forceCNFromSAN {
+			nativeReq.SubjectSerial = serialHex
+		}
+		nativeReq.Precertificate = precertificate
+		for _, ext := range requestedExtensions {
+			if asn1.ObjectIdentifier(ext.ID).Equal(oidTLSFeature) {
+				nativeReq.MustStaple = true
+			}
+		}
+	} else {
+		cfsslReq = signer.SignRequest{
+			Request: csrPEM,
+			Profile: profile,
+			Hosts:   hosts,
+			Subject: &signer.Subject{
+				CN: csr.Subject.CommonName,
+			},
+			Serial:     serialBigInt,
+			Extensions: requestedExtensions,
+		}
+		if !ca.forceCNFromSAN {
+			cfsslReq.Subject.SerialNumber = serialHex
+		}
+	}
+
+	if ca.linter != nil {
+		err = ca.lintCertificate(issuer, nativeProfile, nativeReq, cfsslReq, serialHex)
+		if err != nil {
+			return emptyCert, err
+		}
+	}
+
+	// Send the cert off for signing
+	var certDER []byte
+	if nativeProfile != nil {
+		certDER, err = ca.signNative(issuer, nativeProfile, nativeReq, serialHex)
+	} else {
+		certDER, err = ca.signCFSSL(issuer, cfsslReq, serialHex)
+	}
+	if err != nil {
 		return emptyCert, err
 	}
-	certDER := block.Bytes
 
 	cert := core.Certificate{
 		DER: certDER,
 	}
 
+	if precertificate {
+		ca.log.AuditInfo(fmt.Sprintf("Precertificate signing success: serial=[%s] names=[%s] csr=[%s] precert=[%s]",
+			serialHex, strings.Join(hosts, ", "), hex.EncodeToString(csr.Raw),
+			hex.EncodeToString(certDER)))
+		err = ca.SA.AddPrecertificate(ctx, certDER, regID)
+		if err != nil {
+			err = core.InternalServerError(err.Error())
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			ca.log.AuditErr(fmt.Sprintf(
+				"Failed RPC to store precertificate at SA: serial=[%s] precert=[%s] err=[%v], regID=[%d]",
+				serialHex,
+				hex.EncodeToString(certDER),
+				err,
+				regID,
+			))
+			return emptyCert, err
+		}
+		return cert, nil
+	}
+
 	ca.log.AuditInfo(fmt.Sprintf("Signing success: serial=[%s] names=[%s] csr=[%s] cert=[%s]",
-		serialHex, strings.Join(csr.DNSNames, ", "), hex.EncodeToString(csr.Raw),
+		serialHex, strings.Join(hosts, ", "), hex.EncodeToString(csr.Raw),
 		hex.EncodeToString(certDER)))
 
 	// This is one last check for uncaught errors
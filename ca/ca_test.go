@@ -3,10 +3,15 @@ package ca
 import (
 	"bytes"
 	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/asn1"
 	"fmt"
 	"io/ioutil"
+	"math/big"
 	"sort"
 	"testing"
 	"time"
@@ -111,12 +116,20 @@ var (
 	// * DNSNames = [none]
 	LongCNCSR = mustRead("./testdata/long_cn.der.csr")
 
+	// CSR generated by Go:
+	// * Random ECDSA public key.
+	// * CN = [none]
+	// * DNSNames = [none]
+	// * EmailAddresses = Alice@not-example.com
+	EmailCSR = mustRead("./testdata/email.der.csr")
+
 	log = blog.UseMock()
 )
 
 // CFSSL config
 const rsaProfileName = "rsaEE"
 const ecdsaProfileName = "ecdsaEE"
+const emailProfileName = "smimeEE"
 const caKeyFile = "../test/test-ca.key"
 const caCertFile = "../test/test-ca.pem"
 
@@ -139,7 +152,13 @@ type testCtx struct {
 }
 
 type mockSA struct {
-	certificate core.Certificate
+	certificate    core.Certificate
+	precertificate core.Certificate
+	// claimed is set by ClaimPrecertificate
+	claimed bool
+	// revoked is served by GetRevokedCertificates, and must be in serial order
+	revoked []core.RevokedCertificate
+	pages   int
 }
 
 func (m *mockSA) AddCertificate(ctx context.Context, der []byte, _ int64) (string, error) {
@@ -147,6 +166,45 @@ func (m *mockSA) AddCertificate(ctx context.Context, der []byte, _ int64) (strin
 	return "", nil
 }
 
+func (m *mockSA) AddPrecertificate(ctx context.Context, der []byte, regID int64) error {
+	m.precertificate.DER = der
+	m.precertificate.RegistrationID = regID
+	return nil
+}
+
+func (m *mockSA) ClaimPrecertificate(ctx context.Context, serial string) error {
+	if m.precertificate.DER == nil || m.claimed {
+		return core.NotFoundError("No unclaimed precertificate")
+	}
+	m.claimed = true
+	return nil
+}
+
+func (m *mockSA) GetCertificate(ctx context.Context, serial string) (core.Certificate, error) {
+	if m.certificate.DER == nil {
+		return core.Certificate{}, core.NotFoundError("No certificate")
+	}
+	return m.certificate, nil
+}
+
+func (m *mockSA) GetPrecertificate(ctx context.Context, serial string) (core.Certificate, error) {
+	if m.precertificate.DER == nil {
+		return core.Certificate{}, core.NotFoundError("No precertificate")
+	}
+	return m.precertificate, nil
+}
+
+func (m *mockSA) GetRevokedCertificates(_ context.Context, after string, now time.Time, limit int) ([]core.RevokedCertificate, error) {
+	m.pages++
+	var page []core.RevokedCertificate
+	for _, rc := range m.revoked {
+		if rc.Serial > after && rc.Expires.After(now) && len(page) < limit {
+			page = append(page, rc)
+		}
+	}
+	return page, nil
+}
+
 var caKey crypto.Signer
 var caCert *x509.Certificate
 var ctx = context.Background()
@@ -176,6 +234,7 @@ func setup(t *testing.T) *testCtx {
 	caConfig := cmd.CAConfig{
 		RSAProfile:   rsaProfileName,
 		ECDSAProfile: ecdsaProfileName,
+		EmailProfile: emailProfileName,
 		SerialPrefix: 17,
 		Expiry:       "8760h",
 		LifespanOCSP: cmd.ConfigDuration{Duration: 45 * time.Minute},
@@ -229,6 +288,21 @@ func setup(t *testing.T) *testCtx {
 						},
 						ClientProvidesSerialNumbers: true,
 					},
+					emailProfileName: {
+						Usage:        []string{"digital signature", "key encipherment", "email protection"},
+						CA:           false,
+						IssuerURL:    []string{"http://not-example.com/issuer-url"},
+						OCSP:         "http://not-example.com/ocsp",
+						CRL:          "http://not-example.com/crl",
+						ExpiryString: "8760h",
+						Backdate:     time.Hour,
+						CSRWhitelist: &cfsslConfig.CSRWhitelist{
+							PublicKeyAlgorithm: true,
+							PublicKey:          true,
+							SignatureAlgorithm: true,
+						},
+						ClientProvidesSerialNumbers: true,
+					},
 				},
 				Default: &cfsslConfig.SigningProfile{
 					ExpiryString: "8760h",
@@ -239,7 +313,7 @@ func setup(t *testing.T) *testCtx {
 
 	stats := mocks.NewStatter()
 
-	issuers := []Issuer{{caKey, caCert}}
+	issuers := []Issuer{{Signer: caKey, Cert: caCert}}
 
 	keyPolicy := goodkey.KeyPolicy{
 		AllowRSA:           true,
@@ -360,6 +434,110 @@ func TestIssueCertificateMultipleIssuers(t *testing.T) {
 	test.AssertNotError(t, err, "Certificate failed signature validation")
 }
 
+// makeECDSAIssuer returns an ECDSA issuer with a self-signed cert that is
+// valid until notAfter.
+func makeECDSAIssuer(t *testing.T, cn string, notAfter time.Time) Issuer {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	test.AssertNotError(t, err, "Failed to generate ECDSA issuer key")
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Unix(0, 0),
+		NotAfter:              notAfter,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	test.AssertNotError(t, err, "Failed to create ECDSA issuer cert")
+	cert, err := x509.ParseCertificate(der)
+	test.AssertNotError(t, err, "Failed to parse ECDSA issuer cert")
+	return Issuer{Signer: key, Cert: cert}
+}
+
+// Test choosing issuers by key type and profile.
+func TestIssueCertificateChoosesIssuer(t *testing.T) {
+	testCtx := setup(t)
+	ecdsaIssuer := makeECDSAIssuer(t, "ECDSA issuer", testCtx.fc.Now().Add(2*8760*time.Hour))
+	issuers := []Issuer{{Signer: caKey, Cert: caCert}, ecdsaIssuer}
+
+	issue := func(config cmd.CAConfig, csrDER []byte) (*x509.Certificate, error) {
+		ca, err := NewCertificateAuthorityImpl(
+			config,
+			testCtx.fc,
+			testCtx.stats,
+			issuers,
+			testCtx.keyPolicy,
+			testCtx.logger)
+		test.AssertNotError(t, err, "Failed to create CA")
+		ca.Publisher = &mocks.Publisher{}
+		ca.PA = testCtx.pa
+		ca.SA = &mockSA{}
+		csr, err := oldx509.ParseCertificateRequest(csrDER)
+		test.AssertNotError(t, err, "Failed to parse CSR")
+		issuedCert, err := ca.IssueCertificate(ctx, *csr, 1001)
+		if err != nil {
+			return nil, err
+		}
+		return x509.ParseCertificate(issuedCert.DER)
+	}
+
+	// ECDSA keys get the ECDSA issuer, RSA keys the default one.
+	config := testCtx.caConfig
+	config.KeyTypeIssuers = map[string]string{"ECDSA": "ECDSA issuer"}
+	cert, err := issue(config, ECDSACSR)
+	test.AssertNotError(t, err, "Failed to issue ECDSA certificate")
+	test.AssertNotError(t, cert.CheckSignatureFrom(ecdsaIssuer.Cert), "ECDSA certificate not signed by ECDSA issuer")
+	test.AssertEquals(t, cert.SignatureAlgorithm, x509.ECDSAWithSHA256)
+	cert, err = issue(config, CNandSANCSR)
+	test.AssertNotError(t, err, "Failed to issue RSA certificate")
+	test.AssertNotError(t, cert.CheckSignatureFrom(caCert), "RSA certificate not signed by default issuer")
+
+	// Profiles take precedence over key types.
+	config.KeyTypeIssuers = map[string]string{"RSA": caCert.Subject.CommonName}
+	config.ProfileIssuers = map[string]string{rsaProfileName: "ECDSA issuer"}
+	cert, err = issue(config, CNandSANCSR)
+	test.AssertNotError(t, err, "Failed to issue RSA certificate")
+	test.AssertNotError(t, cert.CheckSignatureFrom(ecdsaIssuer.Cert), "RSA certificate not signed by profile's issuer")
+
+	// Refuse to issue when the chosen issuer expires first, even though the
+	// default issuer doesn't.
+	ecdsaIssuer = makeECDSAIssuer(t, "ECDSA issuer", testCtx.fc.Now().Add(time.Hour))
+	issuers = []Issuer{{Signer: caKey, Cert: caCert}, ecdsaIssuer}
+	config.KeyTypeIssuers = map[string]string{"ECDSA": "ECDSA issuer"}
+	config.ProfileIssuers = nil
+	_, err = issue(config, ECDSACSR)
+	test.AssertError(t, err, "Issued certificate expiring after its issuer")
+	_, err = issue(config, CNandSANCSR)
+	test.AssertNotError(t, err, "Failed to issue RSA certificate")
+}
+
+func TestIssuerSelectionConfig(t *testing.T) {
+	testCtx := setup(t)
+	issuers := []Issuer{{Signer: caKey, Cert: caCert}}
+	for _, tc := range []struct {
+		keyTypeIssuers map[string]string
+		profileIssuers map[string]string
+	}{
+		{keyTypeIssuers: map[string]string{"DSA": caCert.Subject.CommonName}},
+		{keyTypeIssuers: map[string]string{"RSA": "not an issuer"}},
+		{profileIssuers: map[string]string{"not a profile": caCert.Subject.CommonName}},
+		{profileIssuers: map[string]string{rsaProfileName: "not an issuer"}},
+	} {
+		config := testCtx.caConfig
+		config.KeyTypeIssuers = tc.keyTypeIssuers
+		config.ProfileIssuers = tc.profileIssuers
+		_, err := NewCertificateAuthorityImpl(
+			config,
+			testCtx.fc,
+			testCtx.stats,
+			issuers,
+			testCtx.keyPolicy,
+			testCtx.logger)
+		test.AssertError(t, err, fmt.Sprintf("Accepted issuer selection %v %v", tc.keyTypeIssuers, tc.profileIssuers))
+	}
+}
+
 func TestOCSP(t *testing.T) {
 	testCtx := setup(t)
 	ca, err := NewCertificateAuthorityImpl(
@@ -670,6 +848,40 @@ func TestProfileSelection(t *testing.T) {
 	}
 }
 
+func TestIssueEmailCertificate(t *testing.T) {
+	testCtx := setup(t)
+	ca, err := NewCertificateAuthorityImpl(
+		testCtx.caConfig,
+		testCtx.fc,
+		testCtx.stats,
+		testCtx.issuers,
+		testCtx.keyPolicy,
+		testCtx.logger)
+	test.AssertNotError(t, err, "Failed to create CA")
+	ca.Publisher = &mocks.Publisher{}
+	ca.PA = testCtx.pa
+	ca.SA = &mockSA{}
+
+	csr, err := oldx509.ParseCertificateRequest(EmailCSR)
+	test.AssertNotError(t, err, "Cannot parse CSR")
+	issuedCert, err := ca.IssueCertificate(ctx, *csr, 1001)
+	test.AssertNotError(t, err, "Failed to sign certificate")
+
+	cert, err := x509.ParseCertificate(issuedCert.DER)
+	test.AssertNotError(t, err, "Certificate failed to parse")
+	test.AssertDeepEquals(t, cert.EmailAddresses, []string{"alice@not-example.com"})
+	test.AssertEquals(t, len(cert.DNSNames), 0)
+	test.AssertDeepEquals(t, cert.ExtKeyUsage, []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection})
+
+	// Without an email profile the CA refuses to issue for email addresses.
+	ca.emailProfile = ""
+	csr, _ = oldx509.ParseCertificateRequest(EmailCSR)
+	_, err = ca.IssueCertificate(ctx, *csr, 1001)
+	test.AssertError(t, err, "Issued email certificate without an email profile")
+	_, ok := err.(core.MalformedRequestError)
+	test.Assert(t, ok, "Incorrect error type returned")
+}
+
 func countMustStaple(t *testing.T, cert *x509.Certificate) (count int) {
 	oidTLSFeature := asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 24}
 	for _, ext := range cert.Extensions {
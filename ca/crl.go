@@ -0,0 +1,303 @@
+package ca
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/letsencrypt/boulder/core"
+)
+
+var (
+	oidAuthorityKeyID           = asn1.ObjectIdentifier{2, 5, 29, 35}
+	oidCRLNumber                = asn1.ObjectIdentifier{2, 5, 29, 20}
+	oidReasonCode               = asn1.ObjectIdentifier{2, 5, 29, 21}
+	oidIssuingDistributionPoint = asn1.ObjectIdentifier{2, 5, 29, 28}
+)
+
+// crlSignatureAlgorithms are the signature algorithm identifiers and hashes
+// used to sign CRLs for each issuer signature algorithm.
+var crlSignatureAlgorithms = map[x509.SignatureAlgorithm]struct {
+	oid  asn1.ObjectIdentifier
+	hash crypto.Hash
+}{
+	x509.SHA256WithRSA:   {asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}, crypto.SHA256},
+	x509.ECDSAWithSHA256: {asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}, crypto.SHA256},
+	x509.ECDSAWithSHA384: {asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}, crypto.SHA384},
+}
+
+type authorityKeyID struct {
+	ID []byte `asn1:"optional,tag:0"`
+}
+
+// Metrics for CA statistics
+const (
+	// Increments each time a CRL is signed
+	metricCRLsSigned = "CA.CRLs.Signed"
+	// Increments by the number of entries on each CRL signed
+	metricCRLEntries = "CA.CRLs.Entries"
+	// Increments for each revoked certificate that couldn't be parsed
+	metricCRLUnparseable = "CA.CRLs.UnparseableCertificates"
+)
+
+// defaultCRLPageSize is the number of revoked certificates read from the SA
+// at a time when signing a CRL.
+const defaultCRLPageSize = 1000
+
+// issuingDistributionPoint is the ASN.1 structure of the issuing distribution
+// point CRL extension (RFC 5280, Section 5.2.5). Only the fields we set are
+// included.
+type issuingDistributionPoint struct {
+	DistributionPoint     distributionPointName `asn1:"optional,tag:0"`
+	OnlyContainsUserCerts bool                  `asn1:"optional,tag:1"`
+}
+
+type distributionPointName struct {
+	FullName []asn1.RawValue `asn1:"optional,tag:0"`
+}
+
+// makeIDPExtension returns a critical issuing distribution point extension
+// naming url, and saying the CRL only covers end-entity certificates.
+func makeIDPExtension(url string) (pkix.Extension, error) {
+	value, err := asn1.Marshal(issuingDistributionPoint{
+		DistributionPoint: distributionPointName{
+			FullName: []asn1.RawValue{
+				// GeneralName uniformResourceIdentifier [6] IA5String
+				{Class: asn1.ClassContextSpecific, Tag: 6, Bytes: []byte(url)},
+			},
+		},
+		OnlyContainsUserCerts: true,
+	})
+	if err != nil {
+		return pkix.Extension{}, err
+	}
+	return pkix.Extension{
+		Id:       oidIssuingDistributionPoint,
+		Critical: true,
+		Value:    value,
+	}, nil
+}
+
+// createCRL signs a v2 CRL listing revoked, with the given CRL extensions. It
+// builds the CRL as x509.Certificate.CreateCRL does, which can't include the
+// CRL number or issuing distribution point extensions.
+func createCRL(issuer *internalIssuer, revoked []pkix.RevokedCertificate, thisUpdate, nextUpdate time.Time, extensions []pkix.Extension) ([]byte, error) {
+	alg, ok := crlSignatureAlgorithms[issuer.sigAlg]
+	if !ok {
+		return nil, fmt.Errorf("Unsupported CRL signature algorithm %v", issuer.sigAlg)
+	}
+	sigAlg := pkix.AlgorithmIdentifier{Algorithm: alg.oid}
+	if issuer.sigAlg == x509.SHA256WithRSA {
+		sigAlg.Parameters = asn1.RawValue{Tag: asn1.TagNull}
+	}
+	tbs := pkix.TBSCertificateList{
+		Version:             1, // v2
+		Signature:           sigAlg,
+		Issuer:              issuer.cert.Subject.ToRDNSequence(),
+		ThisUpdate:          thisUpdate.UTC(),
+		NextUpdate:          nextUpdate.UTC(),
+		RevokedCertificates: revoked,
+		Extensions:          extensions,
+	}
+	tbsDER, err := asn1.Marshal(tbs)
+	if err != nil {
+		return nil, err
+	}
+	h := alg.hash.New()
+	h.Write(tbsDER)
+	signature, err := issuer.key.Sign(rand.Reader, h.Sum(nil), alg.hash)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(pkix.CertificateList{
+		TBSCertList:        tbs,
+		SignatureAlgorithm: sigAlg,
+		SignatureValue:     asn1.BitString{Bytes: signature, BitLength: len(signature) * 8},
+	})
+}
+
+// revokedEntries reads the revoked certificates from the SA, a page at a time,
+// and returns the CRL entries for each request: those of the request's issuer
+// that fall in its shard. Each certificate is read and parsed once, however
+// many requests there are. Certificates that expired before thisUpdate are
+// left out. A certificate that can't be parsed is an error, since leaving it
+// off its CRL would unrevoke it for relying parties that only check CRLs.
+func (ca *CertificateAuthorityImpl) revokedEntries(ctx context.Context, issuers []*internalIssuer, reqs []core.CRLSigningRequest, thisUpdate time.Time) ([][]pkix.RevokedCertificate, error) {
+	entries := make([][]pkix.RevokedCertificate, len(reqs))
+	after := ""
+	for {
+		page, err := ca.SA.GetRevokedCertificates(ctx, after, thisUpdate, ca.crlPageSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read revoked certificates: %s", err)
+		}
+		for _, rc := range page {
+			cert, err := x509.ParseCertificate(rc.DER)
+			if err != nil {
+				ca.log.AuditErr(fmt.Sprintf("Failed to parse revoked certificate %s: %s", rc.Serial, err))
+				ca.stats.Inc(metricCRLUnparseable, 1, 1.0)
+				return nil, fmt.Errorf("failed to parse revoked certificate %s: %s", rc.Serial, err)
+			}
+			var entry *pkix.RevokedCertificate
+			for i, req := range reqs {
+				if !bytes.Equal(cert.RawIssuer, issuers[i].cert.RawSubject) {
+					continue
+				}
+				if req.Sharding.ShardFor(cert.SerialNumber, rc.Expires) != req.Shard {
+					continue
+				}
+				if entry == nil {
+					e, err := crlEntry(rc)
+					if err != nil {
+						return nil, err
+					}
+					entry = &e
+				}
+				entries[i] = append(entries[i], *entry)
+			}
+		}
+		if len(page) < ca.crlPageSize {
+			return entries, nil
+		}
+		after = page[len(page)-1].Serial
+	}
+}
+
+// crlEntry returns the CRL entry for a revoked certificate.
+func crlEntry(rc core.RevokedCertificate) (pkix.RevokedCertificate, error) {
+	serial, err := core.StringToSerial(rc.Serial)
+	if err != nil {
+		return pkix.RevokedCertificate{}, fmt.Errorf("CRL entry has invalid serial %q", rc.Serial)
+	}
+	if _, ok := core.RevocationReasons[rc.RevokedReason]; !ok {
+		return pkix.RevokedCertificate{}, fmt.Errorf("CRL entry for %s has invalid revocation reason %d", rc.Serial, rc.RevokedReason)
+	}
+	if rc.RevokedDate.IsZero() {
+		return pkix.RevokedCertificate{}, fmt.Errorf("CRL entry for %s has no revocation time", rc.Serial)
+	}
+	entry := pkix.RevokedCertificate{
+		SerialNumber:   serial,
+		RevocationTime: rc.RevokedDate.UTC(),
+	}
+	// The reason code extension should be absent rather than say the reason
+	// is unspecified (RFC 5280, Section 5.3.1).
+	if rc.RevokedReason != 0 {
+		reason, err := asn1.Marshal(asn1.Enumerated(rc.RevokedReason))
+		if err != nil {
+			return pkix.RevokedCertificate{}, err
+		}
+		entry.Extensions = []pkix.Extension{{Id: oidReasonCode, Value: reason}}
+	}
+	return entry, nil
+}
+
+// checkCRLRequest checks a CRL signing request, and returns the issuer it's
+// for.
+func (ca *CertificateAuthorityImpl) checkCRLRequest(req core.CRLSigningRequest) (*internalIssuer, error) {
+	issuer := ca.issuers[req.IssuerCommonName]
+	if issuer == nil {
+		return nil, fmt.Errorf("This CA doesn't have an issuer cert with CommonName %q", req.IssuerCommonName)
+	}
+	if req.Number <= 0 {
+		return nil, errors.New("CRL number must be positive")
+	}
+	if !req.NextUpdate.After(req.ThisUpdate) {
+		return nil, errors.New("CRL nextUpdate must be after thisUpdate")
+	}
+	shards := req.Sharding.Shards
+	if shards < 1 {
+		shards = 1
+	}
+	if req.Shard < 0 || req.Shard >= shards {
+		return nil, fmt.Errorf("CRL shard %d is out of range", req.Shard)
+	}
+	switch req.Sharding.By {
+	case "", "serial":
+	case "expiry":
+		if req.Sharding.Width < time.Second {
+			return nil, errors.New("CRL shard width must be at least a second when sharding by expiry")
+		}
+	default:
+		return nil, fmt.Errorf("unknown CRL sharding %q", req.Sharding.By)
+	}
+	return issuer, nil
+}
+
+// GenerateCRLs signs a CRL for the issuer and shard named in each request,
+// listing the revoked certificates it reads from the SA, and returns them DER
+// encoded, in the order of the requests. The requests must share a
+// thisUpdate. The revoked certificates are read once for all of the requests,
+// so a full set of CRLs for every issuer costs one pass over them, and only
+// one page is requested from the SA at a time, so the size of each RPC is
+// bounded however many there are.
+func (ca *CertificateAuthorityImpl) GenerateCRLs(ctx context.Context, reqs []core.CRLSigningRequest) ([][]byte, error) {
+	if len(reqs) == 0 {
+		return nil, nil
+	}
+	thisUpdate := reqs[0].ThisUpdate
+	issuers := make([]*internalIssuer, len(reqs))
+	for i, req := range reqs {
+		issuer, err := ca.checkCRLRequest(req)
+		if err != nil {
+			return nil, err
+		}
+		if !req.ThisUpdate.Equal(thisUpdate) {
+			return nil, errors.New("CRL requests must share a thisUpdate")
+		}
+		issuers[i] = issuer
+	}
+
+	revoked, err := ca.revokedEntries(ctx, issuers, reqs, thisUpdate)
+	if err != nil {
+		return nil, err
+	}
+
+	crls := make([][]byte, len(reqs))
+	for i, req := range reqs {
+		crls[i], err = ca.signCRL(issuers[i], req, revoked[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return crls, nil
+}
+
+// signCRL signs the CRL for req, listing revoked.
+func (ca *CertificateAuthorityImpl) signCRL(issuer *internalIssuer, req core.CRLSigningRequest, revoked []pkix.RevokedCertificate) ([]byte, error) {
+	number, err := asn1.Marshal(big.NewInt(req.Number))
+	if err != nil {
+		return nil, err
+	}
+	extensions := []pkix.Extension{{Id: oidCRLNumber, Value: number}}
+	if len(issuer.cert.SubjectKeyId) > 0 {
+		aki, err := asn1.Marshal(authorityKeyID{ID: issuer.cert.SubjectKeyId})
+		if err != nil {
+			return nil, err
+		}
+		extensions = append(extensions, pkix.Extension{Id: oidAuthorityKeyID, Value: aki})
+	}
+	if req.IssuingDistributionPoint != "" {
+		idp, err := makeIDPExtension(req.IssuingDistributionPoint)
+		if err != nil {
+			return nil, err
+		}
+		extensions = append(extensions, idp)
+	}
+
+	crl, err := createCRL(issuer, revoked, req.ThisUpdate, req.NextUpdate, extensions)
+	ca.noteSignError(err)
+	if err != nil {
+		return nil, err
+	}
+	ca.stats.Inc(metricCRLsSigned, 1, 1.0)
+	ca.stats.Inc(metricCRLEntries, int64(len(revoked)), 1.0)
+	return crl, nil
+}
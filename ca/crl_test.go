@@ -0,0 +1,189 @@
+package ca
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/test"
+)
+
+// makeRevoked returns a revoked certificate with the given serial, signed by
+// issuer with issuerKey.
+func makeRevoked(t *testing.T, issuer *x509.Certificate, issuerKey crypto.Signer, serial int64, reason core.RevocationCode, revokedAt, expires time.Time) core.RevokedCertificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	test.AssertNotError(t, err, "Failed to generate key")
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		NotAfter:     expires,
+	}
+	if issuer == nil {
+		issuer = template
+		issuerKey = key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, key.Public(), issuerKey)
+	test.AssertNotError(t, err, "Failed to create certificate")
+	return core.RevokedCertificate{
+		Serial:        core.SerialToString(big.NewInt(serial)),
+		RevokedDate:   revokedAt,
+		RevokedReason: reason,
+		Expires:       expires,
+		DER:           der,
+	}
+}
+
+func TestGenerateCRLs(t *testing.T) {
+	testCtx := setup(t)
+	ca, err := NewCertificateAuthorityImpl(
+		testCtx.caConfig,
+		testCtx.fc,
+		testCtx.stats,
+		testCtx.issuers,
+		testCtx.keyPolicy,
+		testCtx.logger)
+	test.AssertNotError(t, err, "Failed to create CA")
+	ca.crlPageSize = 2
+
+	now := testCtx.fc.Now()
+	expires := now.Add(24 * time.Hour)
+	sa := &mockSA{
+		revoked: []core.RevokedCertificate{
+			makeRevoked(t, caCert, caKey, 0xa1, 0, now.Add(-time.Hour), expires),
+			makeRevoked(t, caCert, caKey, 0xa3, 1, now.Add(-time.Minute), expires),
+			// Issued by another CA
+			makeRevoked(t, nil, nil, 0xa5, 1, now.Add(-time.Minute), expires),
+			// Already expired
+			makeRevoked(t, caCert, caKey, 0xa7, 1, now.Add(-time.Hour), now.Add(-time.Minute)),
+			makeRevoked(t, caCert, caKey, 0xb2, 1, now.Add(-time.Minute), expires),
+		},
+	}
+	ca.SA = sa
+
+	req := core.CRLSigningRequest{
+		IssuerCommonName:         caCert.Subject.CommonName,
+		Number:                   now.UnixNano(),
+		ThisUpdate:               now,
+		NextUpdate:               now.Add(24 * time.Hour),
+		IssuingDistributionPoint: "http://crl.example.com/1.crl",
+		Sharding:                 core.CRLSharding{Shards: 2, By: "serial"},
+		Shard:                    1,
+	}
+	req0 := req
+	req0.Shard = 0
+	req0.IssuingDistributionPoint = "http://crl.example.com/0.crl"
+	crls, err := ca.GenerateCRLs(ctx, []core.CRLSigningRequest{req0, req})
+	test.AssertNotError(t, err, "Failed to generate CRLs")
+	test.AssertEquals(t, len(crls), 2)
+	// Two full pages of unexpired certificates, then the last one, read once
+	// for both shards
+	test.AssertEquals(t, sa.pages, 3)
+
+	crl, err := x509.ParseDERCRL(crls[1])
+	test.AssertNotError(t, err, "Failed to parse CRL")
+	test.AssertNotError(t, caCert.CheckCRLSignature(crl), "CRL signature invalid")
+	tbs := crl.TBSCertList
+	test.AssertEquals(t, tbs.Version, 1)
+	test.AssertEquals(t, tbs.NextUpdate.Unix(), req.NextUpdate.Unix())
+	// Only the odd serials from this issuer are in shard 1
+	revoked := tbs.RevokedCertificates
+	test.AssertEquals(t, len(revoked), 2)
+	test.AssertEquals(t, core.SerialToString(revoked[0].SerialNumber), sa.revoked[0].Serial)
+	test.AssertEquals(t, revoked[0].RevocationTime.Unix(), sa.revoked[0].RevokedDate.Unix())
+	test.AssertEquals(t, core.SerialToString(revoked[1].SerialNumber), sa.revoked[1].Serial)
+	// An unspecified reason is left out.
+	test.AssertEquals(t, len(revoked[0].Extensions), 0)
+	test.AssertEquals(t, len(revoked[1].Extensions), 1)
+	test.Assert(t, revoked[1].Extensions[0].Id.Equal(oidReasonCode), "CRL entry has no reason code")
+	var reason asn1.Enumerated
+	_, err = asn1.Unmarshal(revoked[1].Extensions[0].Value, &reason)
+	test.AssertNotError(t, err, "Failed to parse reason code")
+	test.AssertEquals(t, int(reason), 1)
+
+	var idp *issuingDistributionPoint
+	var number *big.Int
+	for _, ext := range tbs.Extensions {
+		if ext.Id.Equal(oidCRLNumber) {
+			_, err = asn1.Unmarshal(ext.Value, &number)
+			test.AssertNotError(t, err, "Failed to parse CRL number")
+		}
+		if ext.Id.Equal(oidIssuingDistributionPoint) {
+			test.Assert(t, ext.Critical, "Issuing distribution point not critical")
+			idp = &issuingDistributionPoint{}
+			_, err = asn1.Unmarshal(ext.Value, idp)
+			test.AssertNotError(t, err, "Failed to parse issuing distribution point")
+		}
+	}
+	test.Assert(t, number != nil, "CRL has no number")
+	test.AssertEquals(t, number.Int64(), req.Number)
+	test.Assert(t, idp != nil, "CRL has no issuing distribution point")
+	test.Assert(t, idp.OnlyContainsUserCerts, "CRL doesn't say it only contains user certs")
+	test.AssertEquals(t, len(idp.DistributionPoint.FullName), 1)
+	test.AssertEquals(t, string(idp.DistributionPoint.FullName[0].Bytes), req.IssuingDistributionPoint)
+	test.AssertEquals(t, testCtx.stats.Counters[metricCRLEntries], int64(3))
+	test.AssertEquals(t, testCtx.stats.Counters[metricCRLsSigned], int64(2))
+
+	req = req0
+	crl, err = x509.ParseDERCRL(crls[0])
+	test.AssertNotError(t, err, "Failed to parse CRL for shard 0")
+	test.AssertEquals(t, len(crl.TBSCertList.RevokedCertificates), 1)
+	test.AssertEquals(t, core.SerialToString(crl.TBSCertList.RevokedCertificates[0].SerialNumber), sa.revoked[4].Serial)
+
+	ca.SA = &mockSA{}
+	req.Sharding = core.CRLSharding{}
+	req.IssuingDistributionPoint = ""
+	crls, err = ca.GenerateCRLs(ctx, []core.CRLSigningRequest{req})
+	test.AssertNotError(t, err, "Failed to generate empty CRL")
+	crl, err = x509.ParseDERCRL(crls[0])
+	test.AssertNotError(t, err, "Failed to parse empty CRL")
+	test.AssertNotError(t, caCert.CheckCRLSignature(crl), "Empty CRL signature invalid")
+	test.AssertEquals(t, len(crl.TBSCertList.RevokedCertificates), 0)
+
+	badReq := req
+	badReq.IssuerCommonName = "not the issuer"
+	_, err = ca.GenerateCRLs(ctx, []core.CRLSigningRequest{badReq})
+	test.AssertError(t, err, "Generated CRL for unknown issuer")
+
+	badReq = req
+	badReq.NextUpdate = badReq.ThisUpdate
+	_, err = ca.GenerateCRLs(ctx, []core.CRLSigningRequest{badReq})
+	test.AssertError(t, err, "Generated CRL with nextUpdate not after thisUpdate")
+
+	badReq = req
+	badReq.Shard = 1
+	_, err = ca.GenerateCRLs(ctx, []core.CRLSigningRequest{badReq})
+	test.AssertError(t, err, "Generated CRL for shard out of range")
+
+	badReq = req
+	badReq.Sharding = core.CRLSharding{Shards: 2, By: "expiry"}
+	_, err = ca.GenerateCRLs(ctx, []core.CRLSigningRequest{badReq})
+	test.AssertError(t, err, "Generated CRL sharded by expiry without a width")
+
+	badReq = req
+	badReq.ThisUpdate = badReq.ThisUpdate.Add(time.Second)
+	_, err = ca.GenerateCRLs(ctx, []core.CRLSigningRequest{req, badReq})
+	test.AssertError(t, err, "Generated CRLs with different thisUpdates")
+
+	ca.SA = &mockSA{
+		revoked: []core.RevokedCertificate{makeRevoked(t, caCert, caKey, 0xa1, 7, now, expires)},
+	}
+	_, err = ca.GenerateCRLs(ctx, []core.CRLSigningRequest{req})
+	test.AssertError(t, err, "Generated CRL with invalid reason")
+
+	// A certificate that can't be parsed could be on any CRL, so none are
+	// signed without it.
+	unparseable := makeRevoked(t, caCert, caKey, 0xa1, 1, now, expires)
+	unparseable.DER = []byte{1, 2, 3}
+	ca.SA = &mockSA{revoked: []core.RevokedCertificate{unparseable}}
+	_, err = ca.GenerateCRLs(ctx, []core.CRLSigningRequest{req})
+	test.AssertError(t, err, "Generated CRL without an unparseable certificate")
+	test.AssertEquals(t, testCtx.stats.Counters[metricCRLUnparseable], int64(1))
+}
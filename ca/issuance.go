@@ -0,0 +1,201 @@
+package ca
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/letsencrypt/boulder/cmd"
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/precert"
+)
+
+var extKeyUsages = map[string]x509.ExtKeyUsage{
+	"server auth":      x509.ExtKeyUsageServerAuth,
+	"client auth":      x509.ExtKeyUsageClientAuth,
+	"email protection": x509.ExtKeyUsageEmailProtection,
+}
+
+// issuanceProfile defines the contents of certificates issued natively,
+// rather than through CFSSL.
+type issuanceProfile struct {
+	validity        time.Duration
+	backdate        time.Duration
+	extKeyUsages    []x509.ExtKeyUsage
+	policies        []asn1.ObjectIdentifier
+	issuerURL       string
+	ocspURL         string
+	crlURL          string
+	allowMustStaple bool
+	allowSCTList    bool
+}
+
+func newIssuanceProfile(c cmd.IssuanceProfileConfig) (*issuanceProfile, error) {
+	if c.Validity.Duration <= 0 {
+		return nil, errors.New("validity must be positive")
+	}
+	if c.Backdate.Duration < 0 || c.Backdate.Duration >= c.Validity.Duration {
+		return nil, errors.New("backdate must be non-negative and less than validity")
+	}
+	if len(c.ExtKeyUsages) == 0 {
+		return nil, errors.New("at least one extended key usage is required")
+	}
+	if c.NoOCSP {
+		if c.OCSPURL != "" || c.AllowMustStaple {
+			return nil, errors.New("profiles without OCSP can't have an OCSP URL or allow Must Staple")
+		}
+		// Certificates are valid from the backdated notBefore.
+		if c.Validity.Duration+c.Backdate.Duration > core.MaxNoOCSPValidity {
+			return nil, fmt.Errorf("profiles without OCSP can't have validity plus backdate longer than %s", core.MaxNoOCSPValidity)
+		}
+	} else if c.OCSPURL == "" {
+		return nil, errors.New("an OCSP URL is required, unless the profile is without OCSP")
+	}
+	p := &issuanceProfile{
+		validity:        c.Validity.Duration,
+		backdate:        c.Backdate.Duration,
+		issuerURL:       c.IssuerURL,
+		ocspURL:         c.OCSPURL,
+		crlURL:          c.CRLURL,
+		allowMustStaple: c.AllowMustStaple,
+		allowSCTList:    c.AllowSCTList,
+	}
+	for _, name := range c.ExtKeyUsages {
+		eku, ok := extKeyUsages[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown extended key usage %q", name)
+		}
+		p.extKeyUsages = append(p.extKeyUsages, eku)
+	}
+	for _, dotted := range c.Policies {
+		oid, err := core.ParseOID(dotted)
+		if err != nil {
+			return nil, fmt.Errorf("invalid policy OID %q", dotted)
+		}
+		p.policies = append(p.policies, oid)
+	}
+	return p, nil
+}
+
+// issuanceRequest describes the subscriber-specific contents of a certificate
+// to be issued natively.
+type issuanceRequest struct {
+	PublicKey      crypto.PublicKey
+	Serial         *big.Int
+	CommonName     string
+	DNSNames       []string
+	EmailAddresses []string
+	// If set, included as the subject's serialNumber attribute
+	SubjectSerial string
+	// Whether to include the Must Staple TLS Feature extension
+	MustStaple bool
+	// If set, the TLS encoded SignedCertificateTimestampList to embed
+	SCTList []byte
+	// Whether to issue a precertificate, with the CT poison extension
+	Precertificate bool
+	// If set, used as the notBefore instead of now less the profile's
+	// backdate, so a final certificate can match its precertificate
+	NotBefore time.Time
+}
+
+// template builds the certificate described by the profile and req, valid
+// from now (less the profile's backdate).
+func (p *issuanceProfile) template(req issuanceRequest, now time.Time) (*x509.Certificate, error) {
+	if req.MustStaple && !p.allowMustStaple {
+		return nil, errors.New("profile doesn't allow Must Staple")
+	}
+	if req.SCTList != nil && !p.allowSCTList {
+		return nil, errors.New("profile doesn't allow embedded SCTs")
+	}
+	if req.Precertificate && !p.allowSCTList {
+		return nil, errors.New("profile doesn't allow precertificates")
+	}
+	if req.Precertificate && req.SCTList != nil {
+		return nil, errors.New("precertificates can't embed SCTs")
+	}
+	var keyUsage x509.KeyUsage
+	switch req.PublicKey.(type) {
+	case *rsa.PublicKey:
+		keyUsage = x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment
+	case *ecdsa.PublicKey:
+		keyUsage = x509.KeyUsageDigitalSignature
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", req.PublicKey)
+	}
+	ski, err := core.SubjectKeyID(req.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	notBefore := now.Add(-p.backdate)
+	if !req.NotBefore.IsZero() {
+		notBefore = req.NotBefore
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: req.Serial,
+		Subject: pkix.Name{
+			CommonName:   req.CommonName,
+			SerialNumber: req.SubjectSerial,
+		},
+		NotBefore:             notBefore,
+		NotAfter:              notBefore.Add(p.backdate + p.validity),
+		KeyUsage:              keyUsage,
+		ExtKeyUsage:           p.extKeyUsages,
+		BasicConstraintsValid: true,
+		IsCA:                  false,
+		SubjectKeyId:          ski,
+		DNSNames:              req.DNSNames,
+		EmailAddresses:        req.EmailAddresses,
+		PolicyIdentifiers:     p.policies,
+	}
+	if p.issuerURL != "" {
+		template.IssuingCertificateURL = []string{p.issuerURL}
+	}
+	if p.ocspURL != "" {
+		template.OCSPServer = []string{p.ocspURL}
+	}
+	if p.crlURL != "" {
+		template.CRLDistributionPoints = []string{p.crlURL}
+	}
+	if req.MustStaple {
+		template.ExtraExtensions = append(template.ExtraExtensions, pkix.Extension{
+			Id:    asn1.ObjectIdentifier(oidTLSFeature),
+			Value: mustStapleFeatureValue,
+		})
+	}
+	if req.Precertificate {
+		template.ExtraExtensions = append(template.ExtraExtensions, precert.PoisonExtension)
+	}
+	if req.SCTList != nil {
+		// The extension value is the SCT list wrapped in an OCTET STRING
+		// (RFC 6962, Section 3.3).
+		value, err := asn1.Marshal(req.SCTList)
+		if err != nil {
+			return nil, err
+		}
+		template.ExtraExtensions = append(template.ExtraExtensions, pkix.Extension{
+			Id:    precert.OIDSCTList,
+			Value: value,
+		})
+	}
+	return template, nil
+}
+
+// issue signs the certificate described by profile and req with the issuer's
+// key, and returns it DER encoded.
+func (iss *internalIssuer) issue(profile *issuanceProfile, req issuanceRequest, now time.Time) ([]byte, error) {
+	template, err := profile.template(req, now)
+	if err != nil {
+		return nil, err
+	}
+	template.SignatureAlgorithm = iss.sigAlg
+	return x509.CreateCertificate(rand.Reader, template, iss.cert, req.PublicKey, iss.key)
+}
@@ -0,0 +1,226 @@
+package ca
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/asn1"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/boulder/cmd"
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/mocks"
+	"github.com/letsencrypt/boulder/precert"
+	"github.com/letsencrypt/boulder/test"
+	oldx509 "github.com/letsencrypt/go/src/crypto/x509"
+)
+
+func nativeProfileConfig() cmd.IssuanceProfileConfig {
+	return cmd.IssuanceProfileConfig{
+		Validity:        cmd.ConfigDuration{Duration: 2160 * time.Hour},
+		Backdate:        cmd.ConfigDuration{Duration: time.Hour},
+		ExtKeyUsages:    []string{"server auth", "client auth"},
+		Policies:        []string{"2.23.140.1.2.1"},
+		IssuerURL:       "http://not-example.com/issuer-url",
+		OCSPURL:         "http://not-example.com/ocsp",
+		CRLURL:          "http://not-example.com/crl",
+		AllowMustStaple: true,
+	}
+}
+
+func TestNewIssuanceProfile(t *testing.T) {
+	_, err := newIssuanceProfile(nativeProfileConfig())
+	test.AssertNotError(t, err, "Rejected valid profile")
+
+	for _, mutate := range []func(*cmd.IssuanceProfileConfig){
+		func(c *cmd.IssuanceProfileConfig) { c.Validity.Duration = 0 },
+		func(c *cmd.IssuanceProfileConfig) { c.Backdate.Duration = c.Validity.Duration },
+		func(c *cmd.IssuanceProfileConfig) { c.ExtKeyUsages = nil },
+		func(c *cmd.IssuanceProfileConfig) { c.ExtKeyUsages = []string{"code signing"} },
+		func(c *cmd.IssuanceProfileConfig) { c.Policies = []string{"2.23.x"} },
+		func(c *cmd.IssuanceProfileConfig) { c.Policies = []string{"2"} },
+		func(c *cmd.IssuanceProfileConfig) { c.OCSPURL = "" },
+		func(c *cmd.IssuanceProfileConfig) { c.NoOCSP = true },
+	} {
+		c := nativeProfileConfig()
+		mutate(&c)
+		_, err := newIssuanceProfile(c)
+		test.AssertError(t, err, "Accepted invalid profile")
+	}
+}
+
+// shortLivedProfileConfig returns a profile for short-lived certificates
+// without OCSP.
+func shortLivedProfileConfig() cmd.IssuanceProfileConfig {
+	c := nativeProfileConfig()
+	c.Validity.Duration = 6 * 24 * time.Hour
+	c.OCSPURL = ""
+	c.AllowMustStaple = false
+	c.NoOCSP = true
+	return c
+}
+
+func TestNewShortLivedIssuanceProfile(t *testing.T) {
+	_, err := newIssuanceProfile(shortLivedProfileConfig())
+	test.AssertNotError(t, err, "Rejected valid short-lived profile")
+
+	for _, mutate := range []func(*cmd.IssuanceProfileConfig){
+		func(c *cmd.IssuanceProfileConfig) { c.OCSPURL = "http://not-example.com/ocsp" },
+		func(c *cmd.IssuanceProfileConfig) { c.AllowMustStaple = true },
+		func(c *cmd.IssuanceProfileConfig) { c.Validity.Duration = core.MaxNoOCSPValidity },
+	} {
+		c := shortLivedProfileConfig()
+		mutate(&c)
+		_, err := newIssuanceProfile(c)
+		test.AssertError(t, err, "Accepted invalid short-lived profile")
+	}
+}
+
+func TestShortLivedIssuance(t *testing.T) {
+	testCtx := setup(t)
+	testCtx.caConfig.Profiles = map[string]cmd.IssuanceProfileConfig{
+		rsaProfileName: shortLivedProfileConfig(),
+	}
+	ca, err := NewCertificateAuthorityImpl(
+		testCtx.caConfig,
+		testCtx.fc,
+		testCtx.stats,
+		testCtx.issuers,
+		testCtx.keyPolicy,
+		testCtx.logger)
+	test.AssertNotError(t, err, "Failed to create CA")
+	ca.Publisher = &mocks.Publisher{}
+	ca.PA = testCtx.pa
+	ca.SA = &mockSA{}
+
+	csr, _ := oldx509.ParseCertificateRequest(CNandSANCSR)
+	issuedCert, err := ca.IssueCertificate(ctx, *csr, 1001)
+	test.AssertNotError(t, err, "Failed to issue short-lived certificate")
+	cert, err := x509.ParseCertificate(issuedCert.DER)
+	test.AssertNotError(t, err, "Failed to parse certificate")
+	test.AssertEquals(t, len(cert.OCSPServer), 0)
+	test.Assert(t, core.IsShortLived(cert), "Certificate isn't short-lived")
+
+	_, err = ca.GenerateOCSP(ctx, core.OCSPSigningRequest{
+		CertDER: issuedCert.DER,
+		Status:  string(core.OCSPStatusGood),
+	})
+	test.AssertError(t, err, "Generated OCSP for short-lived certificate")
+}
+
+func TestNativeIssuance(t *testing.T) {
+	testCtx := setup(t)
+	testCtx.caConfig.EnableMustStaple = true
+	testCtx.caConfig.Profiles = map[string]cmd.IssuanceProfileConfig{
+		rsaProfileName: nativeProfileConfig(),
+	}
+	ca, err := NewCertificateAuthorityImpl(
+		testCtx.caConfig,
+		testCtx.fc,
+		testCtx.stats,
+		testCtx.issuers,
+		testCtx.keyPolicy,
+		testCtx.logger)
+	test.AssertNotError(t, err, "Failed to create CA")
+	ca.Publisher = &mocks.Publisher{}
+	ca.PA = testCtx.pa
+	sa := &mockSA{}
+	ca.SA = sa
+
+	csr, _ := oldx509.ParseCertificateRequest(CNandSANCSR)
+	issuedCert, err := ca.IssueCertificate(ctx, *csr, 1001)
+	test.AssertNotError(t, err, "Failed to issue natively")
+	test.AssertByteEquals(t, sa.certificate.DER, issuedCert.DER)
+	test.AssertEquals(t, testCtx.stats.Counters[metricIssuedNative], int64(1))
+
+	cert, err := x509.ParseCertificate(issuedCert.DER)
+	test.AssertNotError(t, err, "Failed to parse certificate")
+	test.AssertNotError(t, cert.CheckSignatureFrom(caCert), "Certificate not signed by issuer")
+	now := testCtx.fc.Now()
+	test.AssertEquals(t, cert.NotBefore, now.Add(-time.Hour).UTC())
+	test.AssertEquals(t, cert.NotAfter, now.Add(2160*time.Hour).UTC())
+	test.AssertEquals(t, cert.Subject.CommonName, "not-example.com")
+	test.AssertEquals(t, cert.Subject.SerialNumber, core.SerialToString(cert.SerialNumber))
+	test.AssertDeepEquals(t, cert.DNSNames, []string{"not-example.com", "www.not-example.com"})
+	test.AssertEquals(t, cert.KeyUsage, x509.KeyUsageDigitalSignature|x509.KeyUsageKeyEncipherment)
+	test.AssertDeepEquals(t, cert.ExtKeyUsage, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth})
+	test.Assert(t, cert.BasicConstraintsValid && !cert.IsCA, "Certificate is a CA")
+	test.AssertEquals(t, len(cert.PolicyIdentifiers), 1)
+	test.Assert(t, cert.PolicyIdentifiers[0].Equal(asn1.ObjectIdentifier{2, 23, 140, 1, 2, 1}), "Wrong policy")
+	test.AssertDeepEquals(t, cert.IssuingCertificateURL, []string{"http://not-example.com/issuer-url"})
+	test.AssertDeepEquals(t, cert.OCSPServer, []string{"http://not-example.com/ocsp"})
+	test.AssertDeepEquals(t, cert.CRLDistributionPoints, []string{"http://not-example.com/crl"})
+	test.AssertEquals(t, len(cert.SubjectKeyId), 20)
+	test.AssertByteEquals(t, cert.AuthorityKeyId, caCert.SubjectKeyId)
+
+	// ECDSA keys still go through CFSSL, since only the RSA profile is native.
+	csr, _ = oldx509.ParseCertificateRequest(ECDSACSR)
+	_, err = ca.IssueCertificate(ctx, *csr, 1001)
+	test.AssertNotError(t, err, "Failed to issue through CFSSL")
+	test.AssertEquals(t, testCtx.stats.Counters[metricIssuedCFSSL], int64(1))
+
+	csr, _ = oldx509.ParseCertificateRequest(MustStapleCSR)
+	issuedCert, err = ca.IssueCertificate(ctx, *csr, 1001)
+	test.AssertNotError(t, err, "Failed to issue Must Staple certificate natively")
+	cert, err = x509.ParseCertificate(issuedCert.DER)
+	test.AssertNotError(t, err, "Failed to parse certificate")
+	found := false
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(asn1.ObjectIdentifier(oidTLSFeature)) {
+			found = bytes.Equal(ext.Value, mustStapleFeatureValue)
+		}
+	}
+	test.Assert(t, found, "Certificate doesn't have the Must Staple extension")
+
+	// Profiles must allow Must Staple explicitly.
+	profile := nativeProfileConfig()
+	profile.AllowMustStaple = false
+	testCtx.caConfig.Profiles[rsaProfileName] = profile
+	ca, err = NewCertificateAuthorityImpl(
+		testCtx.caConfig,
+		testCtx.fc,
+		testCtx.stats,
+		testCtx.issuers,
+		testCtx.keyPolicy,
+		testCtx.logger)
+	test.AssertNotError(t, err, "Failed to create CA")
+	ca.Publisher = &mocks.Publisher{}
+	ca.PA = testCtx.pa
+	ca.SA = &mockSA{}
+	_, err = ca.IssueCertificate(ctx, *csr, 1001)
+	test.AssertError(t, err, "Issued Must Staple certificate with profile that doesn't allow it")
+}
+
+func TestTemplateSCTList(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	test.AssertNotError(t, err, "Failed to generate key")
+	req := issuanceRequest{
+		PublicKey: key.Public(),
+		Serial:    big.NewInt(1),
+		DNSNames:  []string{"not-example.com"},
+		SCTList:   []byte{0, 1, 2},
+	}
+
+	profile, err := newIssuanceProfile(nativeProfileConfig())
+	test.AssertNotError(t, err, "Failed to create profile")
+	_, err = profile.template(req, time.Now())
+	test.AssertError(t, err, "Embedded SCTs with profile that doesn't allow them")
+
+	c := nativeProfileConfig()
+	c.AllowSCTList = true
+	profile, err = newIssuanceProfile(c)
+	test.AssertNotError(t, err, "Failed to create profile")
+	template, err := profile.template(req, time.Now())
+	test.AssertNotError(t, err, "Failed to build template")
+	test.AssertEquals(t, template.KeyUsage, x509.KeyUsageDigitalSignature)
+	test.AssertEquals(t, len(template.ExtraExtensions), 1)
+	test.Assert(t, template.ExtraExtensions[0].Id.Equal(precert.OIDSCTList), "Wrong extension")
+	var sctList []byte
+	_, err = asn1.Unmarshal(template.ExtraExtensions[0].Value, &sctList)
+	test.AssertNotError(t, err, "SCT list extension isn't an OCTET STRING")
+	test.AssertByteEquals(t, sctList, req.SCTList)
+}
@@ -0,0 +1,116 @@
+package ca
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	cfsslConfig "github.com/cloudflare/cfssl/config"
+	"github.com/cloudflare/cfssl/signer"
+	"github.com/cloudflare/cfssl/signer/local"
+
+	"github.com/letsencrypt/boulder/core"
+)
+
+// Increments when a certificate fails pre-issuance linting
+const metricLintFailed = "CA.LintFailed"
+
+// makeLintIssuer returns an issuer that mimics iss, but with a freshly
+// generated key that nothing trusts. Certificates it signs are identical to
+// those iss would sign, except for the signature, so they can be linted
+// without the risk of a bad certificate ever being signed by a real key.
+func makeLintIssuer(iss *internalIssuer, policy *cfsslConfig.Signing) (*internalIssuer, error) {
+	var key crypto.Signer
+	var err error
+	switch pub := iss.key.Public().(type) {
+	case *rsa.PublicKey:
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+	case *ecdsa.PublicKey:
+		key, err = ecdsa.GenerateKey(pub.Curve, rand.Reader)
+	default:
+		err = fmt.Errorf("Unsupported issuer key type %T", pub)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          iss.cert.SerialNumber,
+		Subject:               iss.cert.Subject,
+		NotBefore:             iss.cert.NotBefore,
+		NotAfter:              iss.cert.NotAfter,
+		KeyUsage:              iss.cert.KeyUsage,
+		ExtKeyUsage:           iss.cert.ExtKeyUsage,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		SubjectKeyId:          iss.cert.SubjectKeyId,
+		SignatureAlgorithm:    iss.sigAlg,
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(certDER)
+	if err != nil {
+		return nil, err
+	}
+	eeSigner, err := local.NewSigner(key, cert, iss.sigAlg, policy)
+	if err != nil {
+		return nil, err
+	}
+	return &internalIssuer{
+		cert:     cert,
+		eeSigner: eeSigner,
+		key:      key,
+		sigAlg:   iss.sigAlg,
+	}, nil
+}
+
+// lintCertificate signs the certificate that is about to be issued with the
+// issuer's lint key, and runs the configured lints against it. Exactly one of
+// nativeProfile and cfsslReq is used, matching the path the real certificate
+// will be signed through.
+func (ca *CertificateAuthorityImpl) lintCertificate(
+	issuer *internalIssuer,
+	nativeProfile *issuanceProfile,
+	nativeReq issuanceRequest,
+	cfsslReq signer.SignRequest,
+	serialHex string,
+) error {
+	var certDER []byte
+	var err error
+	if nativeProfile != nil {
+		certDER, err = issuer.lintIssuer.issue(nativeProfile, nativeReq, ca.clk.Now())
+	} else {
+		var certPEM []byte
+		certPEM, err = issuer.lintIssuer.eeSigner.Sign(cfsslReq)
+		if err == nil {
+			block, _ := pem.Decode(certPEM)
+			if block == nil || block.Type != "CERTIFICATE" {
+				err = errors.New("invalid lint certificate PEM")
+			} else {
+				certDER = block.Bytes
+			}
+		}
+	}
+	var cert *x509.Certificate
+	if err == nil {
+		cert, err = x509.ParseCertificate(certDER)
+	}
+	if err == nil {
+		err = ca.linter.Check(cert, ca.PA)
+	}
+	if err != nil {
+		ca.stats.Inc(metricLintFailed, 1, 1.0)
+		err = core.InternalServerError(err.Error())
+		// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+		ca.log.AuditErr(fmt.Sprintf("Lint failed: serial=[%s] err=[%v]", serialHex, err))
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package ca
+
+import (
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/boulder/cmd"
+	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/mocks"
+	"github.com/letsencrypt/boulder/test"
+	oldx509 "github.com/letsencrypt/go/src/crypto/x509"
+)
+
+func TestMakeLintIssuer(t *testing.T) {
+	testCtx := setup(t)
+	testCtx.caConfig.Lint = &cmd.CALintConfig{}
+	ca, err := NewCertificateAuthorityImpl(
+		testCtx.caConfig,
+		testCtx.fc,
+		testCtx.stats,
+		testCtx.issuers,
+		testCtx.keyPolicy,
+		testCtx.logger)
+	test.AssertNotError(t, err, "Failed to create CA")
+	lintIssuer := ca.defaultIssuer.lintIssuer
+	test.Assert(t, lintIssuer != nil, "No lint issuer")
+	test.AssertEquals(t, lintIssuer.cert.Subject.CommonName, caCert.Subject.CommonName)
+	test.AssertByteEquals(t, lintIssuer.cert.SubjectKeyId, caCert.SubjectKeyId)
+	test.AssertEquals(t, lintIssuer.cert.NotAfter, caCert.NotAfter)
+	test.AssertError(t, lintIssuer.cert.CheckSignatureFrom(caCert), "Lint issuer uses the real issuer's key")
+}
+
+func TestLintBeforeIssuance(t *testing.T) {
+	testCtx := setup(t)
+	testCtx.caConfig.Profiles = map[string]cmd.IssuanceProfileConfig{
+		rsaProfileName: nativeProfileConfig(),
+	}
+	// The native RSA profile issues 2161 hour certificates, including the
+	// backdate, and the CFSSL ECDSA profile 8761 hour ones.
+	testCtx.caConfig.Lint = &cmd.CALintConfig{
+		MaxValidity: cmd.ConfigDuration{Duration: 2200 * time.Hour},
+	}
+	ca, err := NewCertificateAuthorityImpl(
+		testCtx.caConfig,
+		testCtx.fc,
+		testCtx.stats,
+		testCtx.issuers,
+		testCtx.keyPolicy,
+		testCtx.logger)
+	test.AssertNotError(t, err, "Failed to create CA")
+	ca.Publisher = &mocks.Publisher{}
+	ca.PA = testCtx.pa
+	sa := &mockSA{}
+	ca.SA = sa
+
+	csr, _ := oldx509.ParseCertificateRequest(CNandSANCSR)
+	issuedCert, err := ca.IssueCertificate(ctx, *csr, 1001)
+	test.AssertNotError(t, err, "Failed to issue certificate that passes lints")
+	cert, err := x509.ParseCertificate(issuedCert.DER)
+	test.AssertNotError(t, err, "Failed to parse certificate")
+	test.AssertNotError(t, cert.CheckSignatureFrom(caCert), "Certificate not signed by the real issuer")
+
+	sa.certificate.DER = nil
+	csr, _ = oldx509.ParseCertificateRequest(ECDSACSR)
+	_, err = ca.IssueCertificate(ctx, *csr, 1001)
+	test.AssertError(t, err, "Issued certificate that fails lints")
+	test.Assert(t, sa.certificate.DER == nil, "Stored certificate that fails lints")
+	test.AssertEquals(t, testCtx.stats.Counters[metricLintFailed], int64(1))
+	test.AssertEquals(t, testCtx.stats.Counters[metricIssuedCFSSL], int64(0))
+	logs := testCtx.logger.(*blog.Mock).GetAllMatching("Lint failed: .*validity_length")
+	test.AssertEquals(t, len(logs), 1)
+
+	// With the failing lint disabled, the same request succeeds.
+	testCtx.caConfig.Lint.Disabled = []string{"validity_length"}
+	ca, err = NewCertificateAuthorityImpl(
+		testCtx.caConfig,
+		testCtx.fc,
+		testCtx.stats,
+		testCtx.issuers,
+		testCtx.keyPolicy,
+		testCtx.logger)
+	test.AssertNotError(t, err, "Failed to create CA")
+	ca.Publisher = &mocks.Publisher{}
+	ca.PA = testCtx.pa
+	ca.SA = sa
+	_, err = ca.IssueCertificate(ctx, *csr, 1001)
+	test.AssertNotError(t, err, "Failed to issue with validity_length disabled")
+	test.AssertEquals(t, testCtx.stats.Counters[metricIssuedCFSSL], int64(1))
+
+	testCtx.caConfig.Lint.Disabled = []string{"no_such_lint"}
+	_, err = NewCertificateAuthorityImpl(
+		testCtx.caConfig,
+		testCtx.fc,
+		testCtx.stats,
+		testCtx.issuers,
+		testCtx.keyPolicy,
+		testCtx.logger)
+	test.AssertError(t, err, "Created CA disabling an unknown lint")
+}
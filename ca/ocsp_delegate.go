@@ -0,0 +1,194 @@
+package ca
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/cloudflare/cfssl/helpers"
+	"github.com/cloudflare/cfssl/ocsp"
+
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/reloader"
+)
+
+// Increments when an OCSP response is signed with an issuer's own key
+// because its delegate expires too soon to sign it
+const metricOCSPDelegateExpiring = "CA.OCSPDelegateExpiring"
+
+// Increments when an OCSP response is signed with an issuer's own key
+// because its delegate isn't valid yet
+const metricOCSPDelegateNotYetValid = "CA.OCSPDelegateNotYetValid"
+
+// How long before an OCSP delegate expires to start warning about it, if the
+// config doesn't say
+const defaultOCSPDelegateWarning = 30 * 24 * time.Hour
+
+// id-pkix-ocsp-nocheck (RFC 6960, Section 4.2.2.2.1)
+var oidOCSPNoCheck = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 5}
+
+// ocspDelegate is a delegated OCSP responder for an issuer: a certificate the
+// issuer signed for OCSP signing only, along with its own key.
+type ocspDelegate struct {
+	cert   *x509.Certificate
+	signer ocsp.Signer
+	// Set once the delegate has been warned about, so each problem is
+	// logged once rather than for every response.
+	warnedExpiring    int32
+	warnedTooShort    int32
+	warnedNotYetValid int32
+}
+
+// parseOCSPDelegate parses contents, which is a PEM certificate followed by
+// its PEM private key, into a delegate for issuer. The certificate must be
+// signed by issuer, have only the OCSP signing extended key usage, and have
+// the ocsp-nocheck extension.
+func parseOCSPDelegate(contents []byte, issuer *x509.Certificate, lifespanOCSP time.Duration) (*ocspDelegate, error) {
+	var cert *x509.Certificate
+	var key crypto.Signer
+	for {
+		var block *pem.Block
+		block, contents = pem.Decode(contents)
+		if block == nil {
+			break
+		}
+		var err error
+		if block.Type == "CERTIFICATE" {
+			if cert != nil {
+				return nil, errors.New("more than one certificate")
+			}
+			cert, err = x509.ParseCertificate(block.Bytes)
+		} else {
+			if key != nil {
+				return nil, errors.New("more than one private key")
+			}
+			key, err = helpers.ParsePrivateKeyPEM(pem.EncodeToMemory(block))
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if cert == nil || key == nil {
+		return nil, errors.New("a certificate and a private key are required")
+	}
+
+	if err := cert.CheckSignatureFrom(issuer); err != nil {
+		return nil, fmt.Errorf("not signed by issuer %q: %s", issuer.Subject.CommonName, err)
+	}
+	if !core.KeyDigestEquals(key.Public(), cert.PublicKey) {
+		return nil, errors.New("private key doesn't match certificate")
+	}
+	if cert.IsCA {
+		return nil, errors.New("certificate is a CA")
+	}
+	if len(cert.ExtKeyUsage) != 1 || cert.ExtKeyUsage[0] != x509.ExtKeyUsageOCSPSigning {
+		return nil, errors.New("certificate must have only the OCSP signing extended key usage")
+	}
+	noCheck := false
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(oidOCSPNoCheck) {
+			noCheck = true
+		}
+	}
+	if !noCheck {
+		return nil, errors.New("certificate doesn't have the ocsp-nocheck extension")
+	}
+
+	signer, err := ocsp.NewSigner(issuer, cert, key, lifespanOCSP)
+	if err != nil {
+		return nil, err
+	}
+	return &ocspDelegate{cert: cert, signer: signer}, nil
+}
+
+// watchOCSPDelegate loads issuer's OCSP delegate from filename, and reloads it
+// whenever the file changes, so the delegate can be rotated without
+// restarting the CA. Only the first load's errors are returned; later ones
+// are logged, and the previous delegate is kept.
+func (ca *CertificateAuthorityImpl) watchOCSPDelegate(issuer *internalIssuer, filename string) error {
+	r, err := reloader.New(filename, func(contents []byte) error {
+		return ca.setOCSPDelegate(issuer, contents)
+	}, func(err error) {
+		ca.log.Err(fmt.Sprintf("Failed to reload OCSP delegate for issuer %q from %s: %s",
+			issuer.cert.Subject.CommonName, filename, err))
+	})
+	if err != nil {
+		return err
+	}
+	issuer.delegateReloader = r
+	return nil
+}
+
+// Close stops reloading the issuers' OCSP delegates. The delegates last loaded
+// stay in use.
+func (ca *CertificateAuthorityImpl) Close() {
+	for _, issuer := range ca.issuers {
+		if issuer.delegateReloader != nil {
+			issuer.delegateReloader.Stop()
+			issuer.delegateReloader = nil
+		}
+	}
+}
+
+// setOCSPDelegate replaces issuer's OCSP delegate with the one in contents.
+func (ca *CertificateAuthorityImpl) setOCSPDelegate(issuer *internalIssuer, contents []byte) error {
+	delegate, err := parseOCSPDelegate(contents, issuer.cert, ca.lifespanOCSP)
+	if err != nil {
+		return err
+	}
+	issuer.delegateMu.Lock()
+	issuer.ocspDelegate = delegate
+	issuer.delegateMu.Unlock()
+	ca.log.Info(fmt.Sprintf("Loaded OCSP delegate for issuer %q: serial=[%s] notAfter=[%s]",
+		issuer.cert.Subject.CommonName, core.SerialToString(delegate.cert.SerialNumber), delegate.cert.NotAfter))
+	ca.checkOCSPDelegate(issuer, delegate)
+	return nil
+}
+
+// ocspSigner returns the signer for issuer's OCSP responses: its delegate if
+// it has one that is valid now and for longer than the responses will be,
+// otherwise the issuer's own key.
+func (ca *CertificateAuthorityImpl) ocspSigner(issuer *internalIssuer) ocsp.Signer {
+	issuer.delegateMu.RLock()
+	delegate := issuer.ocspDelegate
+	issuer.delegateMu.RUnlock()
+	if delegate != nil && ca.checkOCSPDelegate(issuer, delegate) {
+		return delegate.signer
+	}
+	return issuer.ocspSigner
+}
+
+// checkOCSPDelegate returns false if delegate isn't valid yet, since clients
+// reject responses it signs until it is, or if it expires before an OCSP
+// response signed now would. It warns once if it expires within the warning
+// period. A delegate rotated in ahead of its notBefore is used from then on.
+func (ca *CertificateAuthorityImpl) checkOCSPDelegate(issuer *internalIssuer, delegate *ocspDelegate) bool {
+	now := ca.clk.Now()
+	if now.Before(delegate.cert.NotBefore) {
+		ca.stats.Inc(metricOCSPDelegateNotYetValid, 1, 1.0)
+		if atomic.CompareAndSwapInt32(&delegate.warnedNotYetValid, 0, 1) {
+			ca.log.Warning(fmt.Sprintf("OCSP delegate for issuer %q isn't valid until %s; signing with the issuer key until then",
+				issuer.cert.Subject.CommonName, delegate.cert.NotBefore))
+		}
+		return false
+	}
+	notAfter := delegate.cert.NotAfter
+	if now.Add(ca.lifespanOCSP).After(notAfter) {
+		ca.stats.Inc(metricOCSPDelegateExpiring, 1, 1.0)
+		if atomic.CompareAndSwapInt32(&delegate.warnedTooShort, 0, 1) {
+			ca.log.Err(fmt.Sprintf("OCSP delegate for issuer %q expires at %s, before the responses it would sign; signing with the issuer key instead",
+				issuer.cert.Subject.CommonName, notAfter))
+		}
+		return false
+	}
+	if now.Add(ca.ocspDelegateWarning).After(notAfter) && atomic.CompareAndSwapInt32(&delegate.warnedExpiring, 0, 1) {
+		ca.log.Warning(fmt.Sprintf("OCSP delegate for issuer %q expires at %s, and should be rotated",
+			issuer.cert.Subject.CommonName, notAfter))
+	}
+	return true
+}
@@ -0,0 +1,194 @@
+package ca
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/letsencrypt/boulder/core"
+	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/mocks"
+	"github.com/letsencrypt/boulder/test"
+	oldx509 "github.com/letsencrypt/go/src/crypto/x509"
+)
+
+// makeOCSPDelegate returns a PEM OCSP delegate certificate and key, signed by
+// the test issuer and valid from now until notAfter. modify can change the
+// template before it is signed.
+func makeOCSPDelegate(t *testing.T, now, notAfter time.Time, modify func(*x509.Certificate)) ([]byte, *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	test.AssertNotError(t, err, "Failed to generate key")
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(now.UnixNano()),
+		Subject:               pkix.Name{CommonName: "OCSP delegate"},
+		NotBefore:             now,
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageOCSPSigning},
+		BasicConstraintsValid: true,
+		ExtraExtensions:       []pkix.Extension{{Id: oidOCSPNoCheck, Value: []byte{0x05, 0x00}}},
+	}
+	if modify != nil {
+		modify(template)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, key.Public(), caKey)
+	test.AssertNotError(t, err, "Failed to sign delegate")
+	cert, err := x509.ParseCertificate(der)
+	test.AssertNotError(t, err, "Failed to parse delegate")
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	test.AssertNotError(t, err, "Failed to marshal key")
+	contents := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	contents = append(contents, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})...)
+	return contents, cert
+}
+
+func TestParseOCSPDelegate(t *testing.T) {
+	now := time.Now()
+	notAfter := now.Add(48 * time.Hour)
+	contents, cert := makeOCSPDelegate(t, now, notAfter, nil)
+	delegate, err := parseOCSPDelegate(contents, caCert, time.Hour)
+	test.AssertNotError(t, err, "Failed to parse valid delegate")
+	test.AssertByteEquals(t, delegate.cert.Raw, cert.Raw)
+
+	testCases := []struct {
+		name   string
+		modify func(*x509.Certificate)
+	}{
+		{"CA", func(c *x509.Certificate) { c.IsCA = true }},
+		{"no EKU", func(c *x509.Certificate) { c.ExtKeyUsage = nil }},
+		{"extra EKU", func(c *x509.Certificate) {
+			c.ExtKeyUsage = append(c.ExtKeyUsage, x509.ExtKeyUsageServerAuth)
+		}},
+		{"no nocheck", func(c *x509.Certificate) { c.ExtraExtensions = nil }},
+	}
+	for _, tc := range testCases {
+		contents, _ := makeOCSPDelegate(t, now, notAfter, tc.modify)
+		_, err := parseOCSPDelegate(contents, caCert, time.Hour)
+		test.AssertError(t, err, "Parsed invalid delegate: "+tc.name)
+	}
+
+	// A delegate must be signed by the issuer it's loaded for.
+	otherIssuer := makeECDSAIssuer(t, "Other issuer", notAfter)
+	_, err = parseOCSPDelegate(contents, otherIssuer.Cert, time.Hour)
+	test.AssertError(t, err, "Parsed delegate for the wrong issuer")
+
+	// Both the certificate and its key are required.
+	certBlock, keyBlock := pem.Decode(contents)
+	_, err = parseOCSPDelegate(pem.EncodeToMemory(certBlock), caCert, time.Hour)
+	test.AssertError(t, err, "Parsed delegate without a key")
+	otherContents, _ := makeOCSPDelegate(t, now, notAfter, nil)
+	_, otherKey := pem.Decode(otherContents)
+	_, err = parseOCSPDelegate(append(pem.EncodeToMemory(certBlock), otherKey...), caCert, time.Hour)
+	test.AssertError(t, err, "Parsed delegate with a mismatched key")
+	_, err = parseOCSPDelegate(append(keyBlock, otherKey...), caCert, time.Hour)
+	test.AssertError(t, err, "Parsed delegate without a certificate")
+	_, err = parseOCSPDelegate(append(contents, contents...), caCert, time.Hour)
+	test.AssertError(t, err, "Parsed delegate with two certificates")
+}
+
+func TestOCSPDelegate(t *testing.T) {
+	testCtx := setup(t)
+	now := testCtx.fc.Now()
+	contents, delegateCert := makeOCSPDelegate(t, now, now.Add(48*time.Hour), nil)
+	f, err := ioutil.TempFile("", "ocsp-delegate")
+	test.AssertNotError(t, err, "Failed to create delegate file")
+	defer os.Remove(f.Name())
+	_, err = f.Write(contents)
+	test.AssertNotError(t, err, "Failed to write delegate file")
+	f.Close()
+
+	log := blog.NewMock()
+	testCtx.logger = log
+	testCtx.issuers[0].OCSPDelegateFile = f.Name()
+	testCtx.caConfig.OCSPDelegateWarning.Duration = 24 * time.Hour
+	ca, err := NewCertificateAuthorityImpl(
+		testCtx.caConfig,
+		testCtx.fc,
+		testCtx.stats,
+		testCtx.issuers,
+		testCtx.keyPolicy,
+		testCtx.logger)
+	test.AssertNotError(t, err, "Failed to create CA")
+	defer ca.Close()
+	ca.Publisher = &mocks.Publisher{}
+	ca.PA = testCtx.pa
+	ca.SA = &mockSA{}
+	test.Assert(t, ca.defaultIssuer.delegateReloader != nil, "Delegate file isn't being watched")
+
+	csr, _ := oldx509.ParseCertificateRequest(CNandSANCSR)
+	cert, err := ca.IssueCertificate(ctx, *csr, 1001)
+	test.AssertNotError(t, err, "Failed to issue")
+	generate := func() *ocsp.Response {
+		ocspResp, err := ca.GenerateOCSP(ctx, core.OCSPSigningRequest{
+			CertDER: cert.DER,
+			Status:  string(core.OCSPStatusGood),
+		})
+		test.AssertNotError(t, err, "Failed to generate OCSP")
+		parsed, err := ocsp.ParseResponse(ocspResp, caCert)
+		test.AssertNotError(t, err, "Failed to parse OCSP")
+		return parsed
+	}
+
+	// Responses are signed by the delegate, and include it.
+	parsed := generate()
+	test.Assert(t, parsed.Certificate != nil, "Response doesn't include the delegate")
+	test.AssertByteEquals(t, parsed.Certificate.Raw, delegateCert.Raw)
+	test.AssertEquals(t, len(log.GetAllMatching("WARNING: OCSP delegate")), 0)
+
+	// Rotating the delegate takes effect for the next response.
+	issuer := ca.defaultIssuer
+	contents, rotatedCert := makeOCSPDelegate(t, now, now.Add(30*time.Hour), nil)
+	test.AssertNotError(t, ca.setOCSPDelegate(issuer, contents), "Failed to rotate delegate")
+	parsed = generate()
+	test.AssertByteEquals(t, parsed.Certificate.Raw, rotatedCert.Raw)
+
+	// A delegate rotated in before it's valid isn't used until it is.
+	contents, earlyCert := makeOCSPDelegate(t, now.Add(time.Hour), now.Add(30*time.Hour), nil)
+	test.AssertNotError(t, ca.setOCSPDelegate(issuer, contents), "Failed to rotate in a delegate that isn't valid yet")
+	parsed = generate()
+	test.Assert(t, parsed.Certificate == nil, "Response signed by a delegate that isn't valid yet")
+	// Counted once when it was loaded, and for each response
+	test.AssertEquals(t, testCtx.stats.Counters[metricOCSPDelegateNotYetValid], int64(2))
+	test.AssertEquals(t, len(log.GetAllMatching("WARNING: OCSP delegate .* isn't valid until")), 1)
+	testCtx.fc.Add(time.Hour)
+	parsed = generate()
+	test.AssertByteEquals(t, parsed.Certificate.Raw, earlyCert.Raw)
+	testCtx.fc.Add(-time.Hour)
+	contents, rotatedCert = makeOCSPDelegate(t, now, now.Add(30*time.Hour), nil)
+	test.AssertNotError(t, ca.setOCSPDelegate(issuer, contents), "Failed to rotate delegate")
+
+	// An invalid delegate is rejected, and the previous one kept.
+	test.AssertError(t, ca.setOCSPDelegate(issuer, []byte("not a delegate")), "Loaded invalid delegate")
+	parsed = generate()
+	test.AssertByteEquals(t, parsed.Certificate.Raw, rotatedCert.Raw)
+
+	// Once the delegate is within the warning period, it's warned about once.
+	testCtx.fc.Add(7 * time.Hour)
+	generate()
+	generate()
+	test.AssertEquals(t, len(log.GetAllMatching("WARNING: OCSP delegate .* should be rotated")), 1)
+	test.AssertEquals(t, testCtx.stats.Counters[metricOCSPDelegateExpiring], int64(0))
+
+	// Once the delegate would expire before a response signed now, responses
+	// are signed by the issuer itself.
+	testCtx.fc.Add(22*time.Hour + 30*time.Minute)
+	parsed = generate()
+	test.Assert(t, parsed.Certificate == nil, "Response signed by expiring delegate")
+	generate()
+	test.AssertEquals(t, testCtx.stats.Counters[metricOCSPDelegateExpiring], int64(2))
+	test.AssertEquals(t, len(log.GetAllMatching("ERR: .*OCSP delegate .* signing with the issuer key")), 1)
+
+	// Closing the CA stops watching the delegate file
+	ca.Close()
+	test.Assert(t, ca.defaultIssuer.delegateReloader == nil, "Delegate file is still watched after Close")
+}
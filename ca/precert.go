@@ -0,0 +1,172 @@
+package ca
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/cloudflare/cfssl/signer"
+	"golang.org/x/net/context"
+
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/precert"
+)
+
+// IssueCertificateForPrecertificate issues the final certificate for a
+// precertificate this CA issued, embedding scts, the TLS encoded SCTs that CT
+// logs returned for the precertificate. The precertificate must be the one
+// stored for its serial when it was issued to regID, and only one certificate
+// is issued for it, since the precertificate is claimed in the SA before the
+// certificate is signed. The certificate is built from the precertificate
+// alone, and is checked to match it before it is stored.
+func (ca *CertificateAuthorityImpl) IssueCertificateForPrecertificate(ctx context.Context, precertDER []byte, scts [][]byte, regID int64) (core.Certificate, error) {
+	emptyCert := core.Certificate{}
+
+	parsed, err := x509.ParseCertificate(precertDER)
+	if err != nil {
+		return emptyCert, core.MalformedRequestError(fmt.Sprintf("Invalid precertificate: %s", err))
+	}
+	if !precert.IsPrecertificate(parsed) {
+		return emptyCert, core.MalformedRequestError("Certificate isn't a precertificate")
+	}
+	serialHex := core.SerialToString(parsed.SerialNumber)
+
+	if err = ca.checkPrecertificate(ctx, precertDER, serialHex, regID); err != nil {
+		// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
+		ca.log.AuditErr(fmt.Sprintf("%s: serial=[%s] regID=[%d]", err, serialHex, regID))
+		return emptyCert, err
+	}
+
+	var issuer *internalIssuer
+	for _, iss := range ca.issuers {
+		if parsed.CheckSignatureFrom(iss.cert) == nil {
+			issuer = iss
+			break
+		}
+	}
+	if issuer == nil {
+		err = core.MalformedRequestError("Precertificate wasn't issued by this CA")
+		// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
+		ca.log.AuditErr(fmt.Sprintf("%s: serial=[%s]", err, serialHex))
+		return emptyCert, err
+	}
+
+	profile, _, err := ca.profileForKey(parsed.PublicKey)
+	if err != nil {
+		return emptyCert, err
+	}
+	hosts := parsed.DNSNames
+	if len(parsed.EmailAddresses) > 0 {
+		profile = ca.emailProfile
+		hosts = parsed.EmailAddresses
+	}
+	nativeProfile := ca.nativeProfiles[profile]
+	if nativeProfile == nil || !nativeProfile.allowSCTList {
+		err = core.InternalServerError(fmt.Sprintf("Profile %q can't issue certificates for precertificates", profile))
+		// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
+		ca.log.AuditErr(err.Error())
+		return emptyCert, err
+	}
+
+	sctList, err := precert.SCTList(scts)
+	if err != nil {
+		return emptyCert, core.MalformedRequestError(fmt.Sprintf("Invalid SCTs: %s", err))
+	}
+	req := issuanceRequest{
+		PublicKey:      parsed.PublicKey,
+		Serial:         parsed.SerialNumber,
+		CommonName:     parsed.Subject.CommonName,
+		DNSNames:       parsed.DNSNames,
+		EmailAddresses: parsed.EmailAddresses,
+		SubjectSerial:  parsed.Subject.SerialNumber,
+		SCTList:        sctList,
+		NotBefore:      parsed.NotBefore,
+	}
+	for _, ext := range parsed.Extensions {
+		if ext.Id.Equal(asn1.ObjectIdentifier(oidTLSFeature)) {
+			req.MustStaple = true
+		}
+	}
+
+	if ca.linter != nil {
+		err = ca.lintCertificate(issuer, nativeProfile, req, signer.SignRequest{}, serialHex)
+		if err != nil {
+			return emptyCert, err
+		}
+	}
+
+	// Claiming the precertificate is what makes sure only one certificate is
+	// signed for it, since concurrent requests can all pass the checks above.
+	// A claim whose signing then fails isn't released: the precertificate gets
+	// no final certificate rather than risk two.
+	err = ca.SA.ClaimPrecertificate(ctx, serialHex)
+	if _, ok := err.(core.NotFoundError); ok {
+		err = core.MalformedRequestError("A certificate was already issued for this precertificate")
+		// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
+		ca.log.AuditErr(fmt.Sprintf("%s: serial=[%s] regID=[%d]", err, serialHex, regID))
+		return emptyCert, err
+	} else if err != nil {
+		return emptyCert, core.InternalServerError(fmt.Sprintf("Failed to claim precertificate: %s", err))
+	}
+
+	ca.log.AuditInfo(fmt.Sprintf("Signing for precertificate: serial=[%s] names=[%s] scts=[%d]",
+		serialHex, strings.Join(hosts, ", "), len(scts)))
+
+	certDER, err := ca.signNative(issuer, nativeProfile, req, serialHex)
+	if err != nil {
+		return emptyCert, err
+	}
+
+	// The final certificate must be exactly what the logs were promised.
+	if err = precert.Correspond(precertDER, certDER); err != nil {
+		err = core.InternalServerError(err.Error())
+		// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+		ca.log.AuditErr(fmt.Sprintf("Certificate doesn't match precertificate, aborting: serial=[%s] cert=[%s] err=[%v]",
+			serialHex, hex.EncodeToString(certDER), err))
+		return emptyCert, err
+	}
+
+	ca.log.AuditInfo(fmt.Sprintf("Signing success: serial=[%s] names=[%s] precert=[%s] cert=[%s]",
+		serialHex, strings.Join(hosts, ", "), hex.EncodeToString(precertDER),
+		hex.EncodeToString(certDER)))
+
+	_, err = ca.SA.AddCertificate(ctx, certDER, regID)
+	if err != nil {
+		err = core.InternalServerError(err.Error())
+		// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+		ca.log.AuditErr(fmt.Sprintf(
+			"Failed RPC to store at SA, orphaning certificate: serial=[%s] cert=[%s] err=[%v], regID=[%d]",
+			serialHex,
+			hex.EncodeToString(certDER),
+			err,
+			regID,
+		))
+		return emptyCert, err
+	}
+
+	// The certificate isn't submitted to CT, since its precertificate already
+	// was and it carries the SCTs for it.
+	return core.Certificate{DER: certDER}, nil
+}
+
+// checkPrecertificate checks that precertDER is the precertificate stored with
+// the given serial for regID. Whether a certificate was already issued for it
+// is left to ClaimPrecertificate, which can tell atomically.
+func (ca *CertificateAuthorityImpl) checkPrecertificate(ctx context.Context, precertDER []byte, serialHex string, regID int64) error {
+	stored, err := ca.SA.GetPrecertificate(ctx, serialHex)
+	if _, ok := err.(core.NotFoundError); ok {
+		return core.MalformedRequestError("Precertificate wasn't issued by this CA")
+	} else if err != nil {
+		return core.InternalServerError(fmt.Sprintf("Failed to look up precertificate: %s", err))
+	}
+	if stored.RegistrationID != regID {
+		return core.UnauthorizedError("Precertificate was issued to another registration")
+	}
+	if !bytes.Equal(stored.DER, precertDER) {
+		return core.MalformedRequestError("Precertificate doesn't match the one issued with its serial")
+	}
+	return nil
+}
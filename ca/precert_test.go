@@ -0,0 +1,101 @@
+package ca
+
+import (
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/boulder/cmd"
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/mocks"
+	"github.com/letsencrypt/boulder/precert"
+	"github.com/letsencrypt/boulder/test"
+	oldx509 "github.com/letsencrypt/go/src/crypto/x509"
+)
+
+func TestIssuePrecertificate(t *testing.T) {
+	testCtx := setup(t)
+	profile := nativeProfileConfig()
+	profile.AllowSCTList = true
+	testCtx.caConfig.Profiles = map[string]cmd.IssuanceProfileConfig{
+		rsaProfileName: profile,
+	}
+	ca, err := NewCertificateAuthorityImpl(
+		testCtx.caConfig,
+		testCtx.fc,
+		testCtx.stats,
+		testCtx.issuers,
+		testCtx.keyPolicy,
+		testCtx.logger)
+	test.AssertNotError(t, err, "Failed to create CA")
+	ca.Publisher = &mocks.Publisher{}
+	ca.PA = testCtx.pa
+	sa := &mockSA{}
+	ca.SA = sa
+
+	csr, _ := oldx509.ParseCertificateRequest(CNandSANCSR)
+	issuedPrecert, err := ca.IssuePrecertificate(ctx, *csr, 1001)
+	test.AssertNotError(t, err, "Failed to issue precertificate")
+	test.AssertByteEquals(t, sa.precertificate.DER, issuedPrecert.DER)
+	test.Assert(t, sa.certificate.DER == nil, "Precertificate stored as a certificate")
+	parsedPrecert, err := x509.ParseCertificate(issuedPrecert.DER)
+	test.AssertNotError(t, err, "Failed to parse precertificate")
+	test.Assert(t, precert.IsPrecertificate(parsedPrecert), "Precertificate doesn't have the poison extension")
+
+	// Time passing between the two issuances mustn't change the validity.
+	testCtx.fc.Add(time.Minute)
+	scts := [][]byte{{1, 2, 3}, {4, 5}}
+
+	// The precertificate must be the one stored for its registration.
+	_, err = ca.IssueCertificateForPrecertificate(ctx, issuedPrecert.DER, scts, 1002)
+	test.AssertError(t, err, "Issued certificate for another registration's precertificate")
+	_, ok := err.(core.UnauthorizedError)
+	test.Assert(t, ok, "Wrong error type for another registration's precertificate")
+	storedDER := sa.precertificate.DER
+	sa.precertificate.DER = []byte{1, 2, 3}
+	_, err = ca.IssueCertificateForPrecertificate(ctx, issuedPrecert.DER, scts, 1001)
+	test.AssertError(t, err, "Issued certificate for a precertificate that doesn't match the stored one")
+	sa.precertificate.DER = nil
+	_, err = ca.IssueCertificateForPrecertificate(ctx, issuedPrecert.DER, scts, 1001)
+	test.AssertError(t, err, "Issued certificate for a precertificate that wasn't stored")
+	sa.precertificate.DER = storedDER
+	test.Assert(t, sa.certificate.DER == nil, "Certificate stored for a rejected precertificate")
+
+	issuedCert, err := ca.IssueCertificateForPrecertificate(ctx, issuedPrecert.DER, scts, 1001)
+	test.AssertNotError(t, err, "Failed to issue certificate for precertificate")
+	test.AssertByteEquals(t, sa.certificate.DER, issuedCert.DER)
+	test.AssertNotError(t, precert.Correspond(issuedPrecert.DER, issuedCert.DER), "Certificate doesn't match precertificate")
+	cert, err := x509.ParseCertificate(issuedCert.DER)
+	test.AssertNotError(t, err, "Failed to parse certificate")
+	test.AssertNotError(t, cert.CheckSignatureFrom(caCert), "Certificate not signed by issuer")
+	test.Assert(t, !precert.IsPrecertificate(cert), "Certificate has the poison extension")
+	found := false
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(precert.OIDSCTList) {
+			found = true
+		}
+	}
+	test.Assert(t, found, "Certificate doesn't embed the SCTs")
+
+	// Only one certificate is issued for a precertificate, even if the first
+	// hasn't been stored yet.
+	_, err = ca.IssueCertificateForPrecertificate(ctx, issuedPrecert.DER, scts, 1001)
+	test.AssertError(t, err, "Issued a second certificate for a precertificate")
+	sa.certificate.DER = nil
+	_, err = ca.IssueCertificateForPrecertificate(ctx, issuedPrecert.DER, scts, 1001)
+	test.AssertError(t, err, "Issued a second certificate for a claimed precertificate")
+	test.Assert(t, sa.certificate.DER == nil, "Certificate stored for a claimed precertificate")
+
+	// Only precertificates can be turned into certificates, and only with SCTs.
+	_, err = ca.IssueCertificateForPrecertificate(ctx, issuedCert.DER, scts, 1001)
+	test.AssertError(t, err, "Issued certificate for a certificate")
+	_, err = ca.IssueCertificateForPrecertificate(ctx, []byte{1, 2, 3}, scts, 1001)
+	test.AssertError(t, err, "Issued certificate for garbage")
+	_, err = ca.IssueCertificateForPrecertificate(ctx, issuedPrecert.DER, nil, 1001)
+	test.AssertError(t, err, "Issued certificate without SCTs")
+
+	// ECDSA keys go through CFSSL, which can't issue precertificates.
+	csr, _ = oldx509.ParseCertificateRequest(ECDSACSR)
+	_, err = ca.IssuePrecertificate(ctx, *csr, 1001)
+	test.AssertError(t, err, "Issued precertificate with a CFSSL profile")
+}
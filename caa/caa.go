@@ -0,0 +1,240 @@
+// Package caa implements the Certification Authority Authorization checks
+// described in RFC 8659, shared by the VA and the standalone CAA checker.
+package caa
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/miekg/dns"
+	"golang.org/x/net/context"
+
+	"github.com/letsencrypt/boulder/core"
+)
+
+// Reasons a CAA check reached its decision. They are suitable for use as stat
+// names.
+const (
+	ReasonNone            = "None"
+	ReasonUnknownCritical = "UnknownCritical"
+	ReasonNoneRelevant    = "NoneRelevant"
+	ReasonAuthorized      = "Authorized"
+	ReasonUnauthorized    = "Unauthorized"
+)
+
+// Set consists of filtered CAA records
+type Set struct {
+	Issue     []*dns.CAA
+	Issuewild []*dns.CAA
+	Iodef     []*dns.CAA
+	Unknown   []*dns.CAA
+}
+
+// CriticalUnknown returns true if any CAA records have unknown tag properties
+// and are flagged critical.
+func (s Set) CriticalUnknown() bool {
+	for _, caaRecord := range s.Unknown {
+		// The critical flag is the bit with significance 128. However, many CAA
+		// record users have misinterpreted the RFC and concluded that the bit
+		// with significance 1 is the critical bit. This is sufficiently
+		// widespread that that bit must reasonably be considered an alias for
+		// the critical bit. The remaining bits are 0/ignore as proscribed by the
+		// RFC.
+		if (caaRecord.Flag & (128 | 1)) != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// NewSet filters CAA records by property. Property tags are matched case
+// insensitively (RFC 8659 Section 4.1).
+func NewSet(CAAs []*dns.CAA) *Set {
+	var filtered Set
+
+	for _, caaRecord := range CAAs {
+		switch strings.ToLower(caaRecord.Tag) {
+		case "issue":
+			filtered.Issue = append(filtered.Issue, caaRecord)
+		case "issuewild":
+			filtered.Issuewild = append(filtered.Issuewild, caaRecord)
+		case "iodef":
+			filtered.Iodef = append(filtered.Iodef, caaRecord)
+		default:
+			filtered.Unknown = append(filtered.Unknown, caaRecord)
+		}
+	}
+
+	return &filtered
+}
+
+// LookupFunc performs a CAA query for a single name. It returns the CAA
+// records found and any CNAME or DNAME records the resolver followed to find
+// them, in the order they appeared in the answer.
+type LookupFunc func(ctx context.Context, name string) ([]*dns.CAA, []dns.RR, error)
+
+// Result is the outcome of checking CAA for a name.
+type Result struct {
+	// Present is true if a relevant CAA RRset was found.
+	Present bool
+	// Valid is true if issuance is permitted.
+	Valid bool
+	// Reason is one of the Reason constants.
+	Reason string
+	// Set is the relevant CAA RRset, or nil if none was found.
+	Set *Set
+	// Path records each query made, in tree climbing order, up to and
+	// including the one that found the relevant RRset or failed.
+	Path []core.CAALookupStep
+	// RecordUsed is the issue property that permitted issuance, in
+	// presentation format, if there was one.
+	RecordUsed string
+}
+
+type lookupResult struct {
+	records []*dns.CAA
+	aliases []dns.RR
+	err     error
+}
+
+// aliasTargets follows the chain of CNAME and DNAME records starting at name
+// and returns the name each one led to, in order. A DNAME redirects every name
+// below its owner, so its target is synthesized from the part of the current
+// name below the owner, as a resolver would for the CNAME it synthesizes (RFC
+// 6672 Section 2.2). A synthesized CNAME that accompanies a DNAME only repeats
+// the step the DNAME already took, and isn't recorded twice.
+func aliasTargets(name string, aliases []dns.RR) []string {
+	var targets []string
+	current := dns.Fqdn(name)
+	for _, rr := range aliases {
+		owner := rr.Header().Name
+		var next string
+		switch alias := rr.(type) {
+		case *dns.CNAME:
+			if !strings.EqualFold(owner, current) {
+				continue
+			}
+			next = alias.Target
+		case *dns.DNAME:
+			if len(current) <= len(owner) || !dns.IsSubDomain(owner, current) {
+				continue
+			}
+			next = current[:len(current)-len(owner)] + alias.Target
+		default:
+			continue
+		}
+		targets = append(targets, next)
+		current = next
+	}
+	return targets
+}
+
+// Check finds the relevant CAA RRset for hostname and determines whether it
+// permits issuerDomain to issue for it.
+//
+// See RFC 8659 Section 3. The relevant RRset is found by querying hostname
+// and then each of its parent domains, stopping short of the root, and
+// taking the first non-empty RRset. CNAME and DNAME aliases are followed by
+// the resolver as for any other query, and the tree climb continues from the
+// parent of the queried name rather than that of the alias target. The
+// lookups are performed in parallel in order to avoid timing out the RPC
+// call.
+//
+// If any query up to the one finding the relevant RRset fails, Check returns
+// the error along with a Result whose Path describes the queries made.
+func Check(ctx context.Context, lookup LookupFunc, hostname, issuerDomain string) (*Result, error) {
+	hostname = strings.TrimRight(strings.ToLower(hostname), ".")
+	labels := strings.Split(hostname, ".")
+	results := make([]lookupResult, len(labels))
+	var wg sync.WaitGroup
+	for i := 0; i < len(labels); i++ {
+		// Start the concurrent DNS lookup.
+		wg.Add(1)
+		go func(name string, r *lookupResult) {
+			r.records, r.aliases, r.err = lookup(ctx, name)
+			wg.Done()
+		}(strings.Join(labels[i:], "."), &results[i])
+	}
+	wg.Wait()
+
+	result := &Result{}
+	for i, res := range results {
+		step := core.CAALookupStep{Name: strings.Join(labels[i:], ".")}
+		step.Aliases = aliasTargets(step.Name, res.aliases)
+		for _, record := range res.records {
+			step.Records = append(step.Records, record.String())
+		}
+		if res.err != nil {
+			step.Error = res.err.Error()
+		}
+		result.Path = append(result.Path, step)
+		if res.err != nil {
+			return result, res.err
+		}
+		if len(res.records) > 0 {
+			result.Set = NewSet(res.records)
+			break
+		}
+	}
+	result.evaluate(issuerDomain)
+	return result, nil
+}
+
+// evaluate sets the Present, Valid, Reason and RecordUsed fields of r based on
+// its Set.
+func (r *Result) evaluate(issuerDomain string) {
+	if r.Set == nil {
+		// No CAA records found, can issue
+		r.Present, r.Valid, r.Reason = false, true, ReasonNone
+		return
+	}
+	r.Present = true
+
+	if r.Set.CriticalUnknown() {
+		// Contains unknown critical directives.
+		r.Valid, r.Reason = false, ReasonUnknownCritical
+		return
+	}
+
+	if len(r.Set.Issue) == 0 {
+		// Although CAA records exist, none of them pertain to issuance in this case.
+		// (e.g. there is only an issuewild directive, but we are checking for a
+		// non-wildcard identifier, or there is only an iodef or non-critical unknown
+		// directive.)
+		r.Valid, r.Reason = true, ReasonNoneRelevant
+		return
+	}
+
+	// There are CAA records pertaining to issuance in our case. Note that this
+	// includes the case of the unsatisfiable CAA record value ";", used to
+	// prevent issuance by any CA under any circumstance.
+	//
+	// Our CAA identity must be found in the chosen checkSet.
+	for _, caa := range r.Set.Issue {
+		if strings.EqualFold(ExtractIssuerDomain(caa), issuerDomain) {
+			r.Valid, r.Reason, r.RecordUsed = true, ReasonAuthorized, caa.String()
+			return
+		}
+	}
+
+	// The list of authorized issuers is non-empty, but we are not in it. Fail.
+	r.Valid, r.Reason = false, ReasonUnauthorized
+}
+
+// ExtractIssuerDomain assumes that the Value of a CAA record is in the
+// issue/issuewild format, that is, a domain name with zero or more additional
+// key-value parameters. Returns the domain name, which may be ""
+// (unsatisfiable).
+func ExtractIssuerDomain(caa *dns.CAA) string {
+	v := caa.Value
+	v = strings.Trim(v, " \t") // Value can start and end with whitespace.
+	idx := strings.IndexByte(v, ';')
+	if idx < 0 {
+		return v // no parameters; domain only
+	}
+
+	// Currently, ignore parameters. Unfortunately, the RFC makes no statement on
+	// whether any parameters are critical. Treat unknown parameters as
+	// non-critical.
+	return strings.Trim(v[0:idx], " \t")
+}
@@ -0,0 +1,175 @@
+package caa
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/miekg/dns"
+	"golang.org/x/net/context"
+
+	"github.com/letsencrypt/boulder/test"
+)
+
+func issue(owner, value string) *dns.CAA {
+	return &dns.CAA{
+		Hdr:   dns.RR_Header{Name: owner, Rrtype: dns.TypeCAA, Class: dns.ClassINET},
+		Tag:   "issue",
+		Value: value,
+	}
+}
+
+type answer struct {
+	records []*dns.CAA
+	aliases []dns.RR
+	err     error
+}
+
+func fakeLookup(answers map[string]answer) LookupFunc {
+	return func(_ context.Context, name string) ([]*dns.CAA, []dns.RR, error) {
+		a := answers[name]
+		return a.records, a.aliases, a.err
+	}
+}
+
+func TestCheck(t *testing.T) {
+	lookup := fakeLookup(map[string]answer{
+		"present.com": {records: []*dns.CAA{issue("present.com.", "ca.com")}},
+		"other.com":   {records: []*dns.CAA{issue("other.com.", "other-ca.com")}},
+		"alias.com": {
+			aliases: []dns.RR{&dns.CNAME{
+				Hdr:    dns.RR_Header{Name: "alias.com.", Rrtype: dns.TypeCNAME, Class: dns.ClassINET},
+				Target: "present.com.",
+			}},
+			records: []*dns.CAA{issue("present.com.", "ca.com")},
+		},
+		"wild.com":  {records: []*dns.CAA{{Tag: "issuewild", Value: "ca.com"}}},
+		"crit.com":  {records: []*dns.CAA{{Flag: 128, Tag: "tbs", Value: "x"}, issue("crit.com.", "ca.com")}},
+		"upper.com": {records: []*dns.CAA{{Tag: "ISSUE", Value: "CA.com"}}},
+	})
+
+	testCases := []struct {
+		name    string
+		present bool
+		valid   bool
+		reason  string
+		path    int
+	}{
+		{"absent.com", false, true, ReasonNone, 2},
+		{"www.present.com", true, true, ReasonAuthorized, 2},
+		{"present.com.", true, true, ReasonAuthorized, 1},
+		{"other.com", true, false, ReasonUnauthorized, 1},
+		{"a.b.alias.com", true, true, ReasonAuthorized, 3},
+		{"wild.com", true, true, ReasonNoneRelevant, 1},
+		{"crit.com", true, false, ReasonUnknownCritical, 1},
+		{"upper.com", true, true, ReasonAuthorized, 1},
+	}
+	for _, tc := range testCases {
+		result, err := Check(context.Background(), lookup, tc.name, "ca.com")
+		test.AssertNotError(t, err, tc.name)
+		test.AssertEquals(t, result.Present, tc.present)
+		test.AssertEquals(t, result.Valid, tc.valid)
+		test.AssertEquals(t, result.Reason, tc.reason)
+		test.AssertEquals(t, len(result.Path), tc.path)
+	}
+}
+
+func TestCheckPath(t *testing.T) {
+	record := issue("present.com.", "ca.com")
+	lookup := fakeLookup(map[string]answer{
+		"alias.com": {
+			aliases: []dns.RR{&dns.CNAME{
+				Hdr:    dns.RR_Header{Name: "alias.com.", Rrtype: dns.TypeCNAME, Class: dns.ClassINET},
+				Target: "present.com.",
+			}},
+			records: []*dns.CAA{record},
+		},
+	})
+	result, err := Check(context.Background(), lookup, "www.alias.com", "ca.com")
+	test.AssertNotError(t, err, "Check failed")
+	test.AssertEquals(t, len(result.Path), 2)
+	test.AssertEquals(t, result.Path[0].Name, "www.alias.com")
+	test.AssertEquals(t, len(result.Path[0].Aliases), 0)
+	test.AssertEquals(t, len(result.Path[0].Records), 0)
+	test.AssertEquals(t, result.Path[1].Name, "alias.com")
+	test.AssertDeepEquals(t, result.Path[1].Aliases, []string{"present.com."})
+	test.AssertDeepEquals(t, result.Path[1].Records, []string{record.String()})
+	test.AssertEquals(t, result.RecordUsed, record.String())
+
+	// An error stops the tree climb, and is recorded in the path.
+	lookup = fakeLookup(map[string]answer{
+		"www.example.com": {err: errors.New("SERVFAIL")},
+		"example.com":     {records: []*dns.CAA{record}},
+	})
+	result, err = Check(context.Background(), lookup, "www.example.com", "ca.com")
+	test.AssertError(t, err, "Check should have failed")
+	test.Assert(t, !result.Present, "Present should be false")
+	test.Assert(t, !result.Valid, "Valid should be false")
+	test.AssertEquals(t, len(result.Path), 1)
+	test.AssertEquals(t, result.Path[0].Error, "SERVFAIL")
+}
+
+func TestCheckDNAMEPath(t *testing.T) {
+	record := issue("www.present.com.", "ca.com")
+	lookup := fakeLookup(map[string]answer{
+		// www.moved.com is redirected by moved.com's DNAME to
+		// www.renamed.com, which is in turn a CNAME for www.present.com.
+		// The resolver includes the CNAME it synthesized from the DNAME, which
+		// doesn't add a step to the chain.
+		"www.moved.com": {
+			aliases: []dns.RR{
+				&dns.DNAME{
+					Hdr:    dns.RR_Header{Name: "moved.com.", Rrtype: dns.TypeDNAME, Class: dns.ClassINET},
+					Target: "renamed.com.",
+				},
+				&dns.CNAME{
+					Hdr:    dns.RR_Header{Name: "www.moved.com.", Rrtype: dns.TypeCNAME, Class: dns.ClassINET},
+					Target: "www.renamed.com.",
+				},
+				&dns.CNAME{
+					Hdr:    dns.RR_Header{Name: "www.renamed.com.", Rrtype: dns.TypeCNAME, Class: dns.ClassINET},
+					Target: "www.present.com.",
+				},
+			},
+			records: []*dns.CAA{record},
+		},
+	})
+	result, err := Check(context.Background(), lookup, "www.moved.com", "ca.com")
+	test.AssertNotError(t, err, "Check failed")
+	test.Assert(t, result.Valid, "Valid should be true")
+	test.AssertEquals(t, len(result.Path), 1)
+	test.AssertDeepEquals(t, result.Path[0].Aliases, []string{"www.renamed.com.", "www.present.com."})
+
+	// Without the synthesized CNAME the target is synthesized from the DNAME.
+	lookup = fakeLookup(map[string]answer{
+		"a.b.moved.com": {
+			aliases: []dns.RR{&dns.DNAME{
+				Hdr:    dns.RR_Header{Name: "moved.com.", Rrtype: dns.TypeDNAME, Class: dns.ClassINET},
+				Target: "renamed.com.",
+			}},
+		},
+	})
+	result, err = Check(context.Background(), lookup, "a.b.moved.com", "ca.com")
+	test.AssertNotError(t, err, "Check failed")
+	test.AssertDeepEquals(t, result.Path[0].Aliases, []string{"a.b.renamed.com."})
+
+	// A DNAME doesn't redirect its own owner name.
+	dname := &dns.DNAME{
+		Hdr:    dns.RR_Header{Name: "moved.com.", Rrtype: dns.TypeDNAME, Class: dns.ClassINET},
+		Target: "renamed.com.",
+	}
+	test.AssertEquals(t, len(aliasTargets("moved.com", []dns.RR{dname})), 0)
+}
+
+func TestExtractIssuerDomain(t *testing.T) {
+	testCases := map[string]string{
+		"ca.com":                   "ca.com",
+		"  ca.com  ":               "ca.com",
+		"ca.com; account=1234":     "ca.com",
+		" ca.com ;foo=bar;baz=bar": "ca.com",
+		";":                        "",
+		"":                         "",
+	}
+	for value, expected := range testCases {
+		test.AssertEquals(t, ExtractIssuerDomain(&dns.CAA{Value: value}), expected)
+	}
+}
@@ -55,8 +55,9 @@ func loadIssuers(c config) ([]ca.Issuer, error) {
 		priv, cert, err := loadIssuer(issuerConfig)
 		cmd.FailOnError(err, "Couldn't load private key")
 		issuers = append(issuers, ca.Issuer{
-			Signer: priv,
-			Cert:   cert,
+			Signer:           priv,
+			Cert:             cert,
+			OCSPDelegateFile: issuerConfig.OCSPDelegateFile,
 		})
 	}
 	return issuers, nil
@@ -157,6 +158,7 @@ func main() {
 		goodkey.NewKeyPolicy(),
 		logger)
 	cmd.FailOnError(err, "Failed to create CA impl")
+	defer cai.Close()
 	cai.PA = pa
 
 	go cmd.ProfileCmd("CA", stats)
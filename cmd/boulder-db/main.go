@@ -0,0 +1,163 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/jmhodges/clock"
+
+	"github.com/letsencrypt/boulder/cmd"
+	"github.com/letsencrypt/boulder/sa"
+)
+
+var usageString = `
+name:
+  boulder-db - Applies, rolls back and reports on the SA's schema migrations
+
+usage:
+  boulder-db status --config <path>
+  boulder-db up --config <path> [--to <version>]
+  boulder-db down --config <path> [--to <version>]
+
+command descriptions:
+  status    Prints every migration, and when it was applied
+  up        Applies pending migrations, up to and including --to if it's given
+  down      Rolls back applied migrations newer than --to, or just the newest one
+            if --to isn't given
+`
+
+type config struct {
+	DB struct {
+		cmd.DBConfig
+
+		// MigrationsDir is the directory holding the migration files, usually
+		// sa/_db/migrations.
+		MigrationsDir string
+
+		// BatchSize is how many rows each run of a batched backfill affects.
+		// Zero means 1000.
+		BatchSize int
+		// BatchPause is how long to wait between runs of a batched backfill.
+		BatchPause cmd.ConfigDuration
+	}
+
+	Statsd cmd.StatsdConfig
+
+	Syslog cmd.SyslogConfig
+}
+
+func printStatus(statuses []sa.MigrationStatus, w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tNAME\tAPPLIED")
+	for _, s := range statuses {
+		applied := "pending"
+		if s.AppliedAt != nil {
+			applied = s.AppliedAt.UTC().Format("2006-01-02 15:04:05")
+		}
+		if s.Modified {
+			applied += " (file modified since)"
+		}
+		if s.Missing {
+			applied += " (file missing)"
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\n", s.Version, s.Name, applied)
+	}
+	return tw.Flush()
+}
+
+// previousVersion returns the version of the applied migration before the
+// newest applied one, which is where rolling back a single migration leaves
+// the database.
+func previousVersion(statuses []sa.MigrationStatus) int64 {
+	var newest, previous int64
+	for _, s := range statuses {
+		if s.AppliedAt != nil {
+			previous, newest = newest, s.Version
+		}
+	}
+	return previous
+}
+
+func setup(configFile, dbConnect string) *sa.Migrator {
+	var c config
+	err := cmd.ReadJSONFile(configFile, &c)
+	cmd.FailOnError(err, "Reading JSON config file into config structure")
+	_, logger := cmd.StatsAndLogging(c.Statsd, c.Syslog)
+
+	if dbConnect == "" {
+		dbConnect, err = c.DB.DBConfig.URL()
+		cmd.FailOnError(err, "Couldn't load DB URL")
+	}
+	dbMap, err := sa.NewDbMap(dbConnect, c.DB.DBConfig.MaxDBConns)
+	cmd.FailOnError(err, "Couldn't connect to database")
+
+	migrations, err := sa.LoadMigrations(c.DB.MigrationsDir)
+	cmd.FailOnError(err, "Couldn't load migrations")
+
+	migrator := sa.NewMigrator(dbMap, migrations, clock.Default(), logger)
+	if c.DB.BatchSize > 0 {
+		migrator.BatchSize = c.DB.BatchSize
+	}
+	migrator.BatchPause = c.DB.BatchPause.Duration
+	return migrator
+}
+
+func main() {
+	if len(os.Args) <= 2 {
+		fmt.Fprint(os.Stderr, usageString)
+		os.Exit(1)
+	}
+
+	command := os.Args[1]
+	flagSet := flag.NewFlagSet(command, flag.ContinueOnError)
+	configFile := flagSet.String("config", "", "File path to the configuration file for this service")
+	dbConnect := flagSet.String("db-connect", "", "Database connect URL, overriding the one in the config")
+	to := flagSet.Int64("to", -1, "Version to migrate the database to")
+	err := flagSet.Parse(os.Args[2:])
+	cmd.FailOnError(err, "Error parsing flagset")
+
+	usage := func() {
+		fmt.Fprintf(os.Stderr, "%s\nargs:", usageString)
+		flagSet.PrintDefaults()
+		os.Exit(1)
+	}
+
+	if *configFile == "" {
+		usage()
+	}
+
+	switch command {
+	case "status":
+		statuses, err := setup(*configFile, *dbConnect).Status()
+		cmd.FailOnError(err, "Failed to get migration status")
+		err = printStatus(statuses, os.Stdout)
+		cmd.FailOnError(err, "Failed to print migration status")
+
+	case "up":
+		target := *to
+		if target < 0 {
+			target = 0
+		}
+		applied, err := setup(*configFile, *dbConnect).Up(target)
+		cmd.FailOnError(err, "Failed to apply migrations")
+		fmt.Printf("Applied %d migrations\n", applied)
+
+	case "down":
+		migrator := setup(*configFile, *dbConnect)
+		target := *to
+		if target < 0 {
+			statuses, err := migrator.Status()
+			cmd.FailOnError(err, "Failed to get migration status")
+			target = previousVersion(statuses)
+		}
+		rolledBack, err := migrator.Down(target)
+		cmd.FailOnError(err, "Failed to roll back migrations")
+		fmt.Printf("Rolled back %d migrations\n", rolledBack)
+
+	default:
+		usage()
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/boulder/sa"
+	"github.com/letsencrypt/boulder/test"
+)
+
+func TestPrintStatus(t *testing.T) {
+	applied := time.Date(2016, 9, 19, 12, 0, 0, 0, time.UTC)
+	var out bytes.Buffer
+	err := printStatus([]sa.MigrationStatus{
+		{Version: 1, Name: "First", AppliedAt: &applied},
+		{Version: 2, Name: "Second", AppliedAt: &applied, Modified: true},
+		{Version: 3, Name: "Third"},
+	}, &out)
+	test.AssertNotError(t, err, "Failed to print status")
+	test.AssertEquals(t, out.String(), ""+
+		"VERSION  NAME    APPLIED\n"+
+		"1        First   2016-09-19 12:00:00\n"+
+		"2        Second  2016-09-19 12:00:00 (file modified since)\n"+
+		"3        Third   pending\n")
+}
+
+func TestPreviousVersion(t *testing.T) {
+	applied := time.Now()
+	statuses := []sa.MigrationStatus{
+		{Version: 1, AppliedAt: &applied},
+		{Version: 2, AppliedAt: &applied},
+		{Version: 3},
+	}
+	test.AssertEquals(t, previousVersion(statuses), int64(1))
+	test.AssertEquals(t, previousVersion(statuses[:1]), int64(0))
+	test.AssertEquals(t, previousVersion(statuses[2:]), int64(0))
+}
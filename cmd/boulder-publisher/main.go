@@ -3,8 +3,10 @@ package main
 import (
 	"flag"
 	"os"
+	"time"
 
 	ct "github.com/google/certificate-transparency/go"
+	"github.com/jmhodges/clock"
 
 	"github.com/letsencrypt/boulder/cmd"
 	"github.com/letsencrypt/boulder/core"
@@ -22,6 +24,12 @@ type config struct {
 		cmd.ServiceConfig
 		SubmissionTimeout              cmd.ConfigDuration
 		MaxConcurrentRPCServerRequests int64
+
+		// If set, the logs and policy to submit to, instead of Common.CT.Logs
+		LogPolicy *cmd.CTLogPolicyConfig
+
+		// If set, failed submissions are queued in the SA, and retried
+		RetryQueue *cmd.CTRetryQueueConfig
 	}
 
 	Statsd cmd.StatsdConfig
@@ -56,7 +64,7 @@ func main() {
 
 	logs := make([]*publisher.Log, len(c.Common.CT.Logs))
 	for i, ld := range c.Common.CT.Logs {
-		logs[i], err = publisher.NewLog(ld.URI, ld.Key)
+		logs[i], err = publisher.NewShardedLog(ld.URI, ld.Key, ld.NotAfterStart, ld.NotAfterEnd)
 		cmd.FailOnError(err, "Unable to parse CT log description")
 	}
 
@@ -72,6 +80,15 @@ func main() {
 	}
 
 	pubi := publisher.New(bundle, logs, c.Publisher.SubmissionTimeout.Duration, logger)
+	if c.Publisher.LogPolicy != nil {
+		err = pubi.LoadLogPolicy(c.Publisher.LogPolicy.LogListFile, c.Publisher.LogPolicy.Groups)
+		cmd.FailOnError(err, "Failed to load CT log policy")
+		defer pubi.Close()
+	} else {
+		for _, gap := range cmd.NotAfterGaps(c.Common.CT.Logs, time.Now()) {
+			logger.Warning(gap)
+		}
+	}
 
 	go cmd.ProfileCmd("Publisher", stats)
 
@@ -79,6 +96,12 @@ func main() {
 	pubi.SA, err = rpc.NewStorageAuthorityClient(clientName, amqpConf, stats)
 	cmd.FailOnError(err, "Unable to create SA client")
 
+	if c.Publisher.RetryQueue != nil {
+		err = pubi.EnableRetryQueue(*c.Publisher.RetryQueue, clock.Default(), stats)
+		cmd.FailOnError(err, "Failed to enable retry queue")
+		go pubi.RetryQueueLoop()
+	}
+
 	if c.Publisher.GRPC != nil {
 		s, l, err := bgrpc.NewServer(c.Publisher.GRPC, metrics.NewStatsdScope(stats, "Publisher"))
 		cmd.FailOnError(err, "Failed to setup gRPC server")
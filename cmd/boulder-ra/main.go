@@ -15,6 +15,7 @@ import (
 	bgrpc "github.com/letsencrypt/boulder/grpc"
 	"github.com/letsencrypt/boulder/metrics"
 	"github.com/letsencrypt/boulder/policy"
+	pubPB "github.com/letsencrypt/boulder/publisher/proto"
 	"github.com/letsencrypt/boulder/ra"
 	"github.com/letsencrypt/boulder/rpc"
 )
@@ -62,6 +63,14 @@ type config struct {
 		// the pending state. If you can't respond to a challenge this quickly, then
 		// you need to request a new challenge.
 		PendingAuthorizationLifetimeDays int
+
+		// PrecertificateSCTs is how many SCTs certificates for DNS names must
+		// embed. If non-zero, the CA issues a precertificate which the
+		// Publisher submits to CT logs, and the final certificate embeds the
+		// SCTs they return.
+		PrecertificateSCTs int
+
+		PublisherService *cmd.GRPCClientConfig
 	}
 
 	PA cmd.PAConfig
@@ -126,6 +135,19 @@ func main() {
 	sac, err := rpc.NewStorageAuthorityClient(clientName, amqpConf, stats)
 	cmd.FailOnError(err, "Unable to create SA client")
 
+	// The RA only talks to the Publisher to submit precertificates
+	var pubc core.Publisher
+	if c.RA.PrecertificateSCTs > 0 {
+		if c.RA.PublisherService != nil {
+			conn, err := bgrpc.ClientSetup(c.RA.PublisherService)
+			cmd.FailOnError(err, "Unable to create Publisher client")
+			pubc = bgrpc.NewPublisherClientWrapper(pubPB.NewPublisherClient(conn), c.RA.PublisherService.Timeout.Duration)
+		} else {
+			pubc, err = rpc.NewPublisherClient(clientName, amqpConf, stats)
+			cmd.FailOnError(err, "Unable to create Publisher client")
+		}
+	}
+
 	// TODO(patf): remove once RA.authorizationLifetimeDays is deployed
 	authorizationLifetime := 300 * 24 * time.Hour
 	if c.RA.AuthorizationLifetimeDays != 0 {
@@ -148,7 +170,8 @@ func main() {
 		c.RA.DoNotForceCN,
 		c.RA.ReuseValidAuthz,
 		authorizationLifetime,
-		pendingAuthorizationLifetime)
+		pendingAuthorizationLifetime,
+		c.RA.PrecertificateSCTs)
 
 	policyErr := rai.SetRateLimitPoliciesFile(c.RA.RateLimitPoliciesFilename)
 	cmd.FailOnError(policyErr, "Couldn't load rate limit policies file")
@@ -181,6 +204,7 @@ func main() {
 	rai.VA = vac
 	rai.CA = cac
 	rai.SA = sac
+	rai.Publisher = pubc
 
 	ras, err := rpc.NewAmqpRPCServer(amqpConf, c.RA.MaxConcurrentRPCServerRequests, stats, logger)
 	cmd.FailOnError(err, "Unable to create RA RPC server")
@@ -3,6 +3,7 @@ package main
 import (
 	"flag"
 	"os"
+	"time"
 
 	"github.com/jmhodges/clock"
 
@@ -19,6 +20,10 @@ type config struct {
 		cmd.ServiceConfig
 		cmd.DBConfig
 
+		// Replica, if present, is a read replica that reads which tolerate
+		// some staleness, like rate limit counts, are sent to.
+		Replica *cmd.ReplicaConfig
+
 		MaxConcurrentRPCServerRequests int64
 	}
 
@@ -53,11 +58,34 @@ func main() {
 	dbMap, err := sa.NewDbMap(dbURL, saConf.DBConfig.MaxDBConns)
 	cmd.FailOnError(err, "Couldn't connect to SA database")
 
+	err = sa.CheckSchemaVersions(dbMap, sa.SchemaVersions)
+	cmd.FailOnError(err, "SA database hasn't been migrated")
+
 	go sa.ReportDbConnCount(dbMap, metrics.NewStatsdScope(stats, "SA"))
 
 	sai, err := sa.NewSQLStorageAuthority(dbMap, clock.Default(), logger)
 	cmd.FailOnError(err, "Failed to create SA impl")
 
+	if replicaConf := saConf.Replica; replicaConf != nil {
+		replicaURL, err := replicaConf.DBConfig.URL()
+		cmd.FailOnError(err, "Couldn't load replica DB URL")
+
+		replicaMap, err := sa.NewDbMap(replicaURL, replicaConf.DBConfig.MaxDBConns)
+		cmd.FailOnError(err, "Couldn't connect to SA replica database")
+
+		replicaStats := metrics.NewStatsdScope(stats, "SA", "Replica")
+		go sa.ReportDbConnCount(replicaMap, replicaStats)
+
+		sai.SetReplica(replicaMap, replicaConf.MaxLag.Duration, replicaConf.FallbackOnError, replicaStats)
+		if replicaConf.MaxLag.Duration > 0 {
+			period := replicaConf.LagCheckPeriod.Duration
+			if period == 0 {
+				period = 10 * time.Second
+			}
+			go sai.ReplicaLagLoop(period)
+		}
+	}
+
 	go cmd.ProfileCmd("SA", stats)
 
 	amqpConf := saConf.AMQP
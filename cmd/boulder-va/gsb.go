@@ -6,6 +6,8 @@ import (
 	"os"
 
 	"github.com/letsencrypt/boulder/cmd"
+	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/metrics"
 	"github.com/letsencrypt/boulder/va"
 	safebrowsing "github.com/letsencrypt/go-safe-browsing-api"
 )
@@ -39,3 +41,36 @@ func newGoogleSafeBrowsing(gsb *cmd.GoogleSafeBrowsingConfig) va.SafeBrowsing {
 	}
 	return sbc
 }
+
+// newCompositeSafeBrowsing returns a va.CompositeSafeBrowsing consulting each
+// of the configured sources, and the blocklists among them, which the caller
+// should close when it's done. It runs cmd.FailOnError if any source is
+// misconfigured or can't be loaded.
+func newCompositeSafeBrowsing(configs []cmd.SafeBrowsingSourceConfig, stats metrics.Scope, logger blog.Logger) (va.SafeBrowsing, []*va.Blocklist) {
+	var sources []va.SafeBrowsingSource
+	var blocklists []*va.Blocklist
+	names := make(map[string]bool)
+	for _, c := range configs {
+		if c.Name == "" {
+			cmd.FailOnError(errors.New(""), "a safe browsing source was given without a Name")
+		}
+		if names[c.Name] {
+			cmd.FailOnError(errors.New(""), fmt.Sprintf("safe browsing source name %q is used more than once", c.Name))
+		}
+		names[c.Name] = true
+		source := va.SafeBrowsingSource{Name: c.Name, FailClosed: c.FailClosed}
+		switch {
+		case c.Google != nil && c.Blocklist == "":
+			source.Client = newGoogleSafeBrowsing(c.Google)
+		case c.Blocklist != "" && c.Google == nil:
+			bl, err := va.NewBlocklist(c.Blocklist, logger)
+			cmd.FailOnError(err, fmt.Sprintf("unable to load blocklist for safe browsing source %q", c.Name))
+			source.Client = bl
+			blocklists = append(blocklists, bl)
+		default:
+			cmd.FailOnError(errors.New(""), fmt.Sprintf("safe browsing source %q must set exactly one of Google and Blocklist", c.Name))
+		}
+		sources = append(sources, source)
+	}
+	return va.NewCompositeSafeBrowsing(sources, stats), blocklists
+}
@@ -7,10 +7,7 @@ import (
 
 	"github.com/jmhodges/clock"
 
-	"github.com/letsencrypt/boulder/bdns"
-	"github.com/letsencrypt/boulder/cdr"
 	"github.com/letsencrypt/boulder/cmd"
-	caaPB "github.com/letsencrypt/boulder/cmd/caa-checker/proto"
 	bgrpc "github.com/letsencrypt/boulder/grpc"
 	"github.com/letsencrypt/boulder/metrics"
 	"github.com/letsencrypt/boulder/rpc"
@@ -20,33 +17,7 @@ import (
 const clientName = "VA"
 
 type config struct {
-	VA struct {
-		cmd.ServiceConfig
-
-		UserAgent string
-
-		IssuerDomain string
-
-		PortConfig cmd.PortConfig
-
-		MaxConcurrentRPCServerRequests int64
-
-		LookupIPv6 bool
-
-		GoogleSafeBrowsing *cmd.GoogleSafeBrowsingConfig
-
-		CAAService *cmd.GRPCClientConfig
-
-		CAADistributedResolver *cmd.CAADistributedResolverConfig
-
-		// The number of times to try a DNS query (that has a temporary error)
-		// before giving up. May be short-circuited by deadlines. A zero value
-		// will be turned into 1.
-		DNSTries int
-
-		// Feature flag to enable enforcement of CAA SERVFAILs.
-		CAASERVFAILExceptions string
-	}
+	VA cmd.VAConfig
 
 	Statsd cmd.StatsdConfig
 
@@ -79,80 +50,21 @@ func main() {
 
 	go cmd.ProfileCmd("VA", stats)
 
-	pc := &cmd.PortConfig{
-		HTTPPort:  80,
-		HTTPSPort: 443,
-		TLSPort:   443,
-	}
-	if c.VA.PortConfig.HTTPPort != 0 {
-		pc.HTTPPort = c.VA.PortConfig.HTTPPort
-	}
-	if c.VA.PortConfig.HTTPSPort != 0 {
-		pc.HTTPSPort = c.VA.PortConfig.HTTPSPort
-	}
-	if c.VA.PortConfig.TLSPort != 0 {
-		pc.TLSPort = c.VA.PortConfig.TLSPort
-	}
-
-	var caaClient caaPB.CAACheckerClient
-	if c.VA.CAAService != nil {
-		conn, err := bgrpc.ClientSetup(c.VA.CAAService)
-		cmd.FailOnError(err, "Failed to load credentials and create connection to service")
-		caaClient = caaPB.NewCAACheckerClient(conn)
-	}
-
-	scoped := metrics.NewStatsdScope(stats, "VA", "DNS")
 	sbc := newGoogleSafeBrowsing(c.VA.GoogleSafeBrowsing)
-
-	var cdrClient *cdr.CAADistributedResolver
-	if c.VA.CAADistributedResolver != nil {
-		var err error
-		cdrClient, err = cdr.New(
-			scoped,
-			c.VA.CAADistributedResolver.Timeout.Duration,
-			c.VA.CAADistributedResolver.MaxFailures,
-			c.VA.CAADistributedResolver.Proxies,
-			logger)
-		cmd.FailOnError(err, "Failed to create CAADistributedResolver")
+	var blocklists []*va.Blocklist
+	if len(c.VA.SafeBrowsingSources) > 0 {
+		sbc, blocklists = newCompositeSafeBrowsing(c.VA.SafeBrowsingSources, metrics.NewStatsdScope(stats, "VA"), logger)
 	}
 
 	dnsTimeout, err := time.ParseDuration(c.Common.DNSTimeout)
 	cmd.FailOnError(err, "Couldn't parse DNS timeout")
-	dnsTries := c.VA.DNSTries
-	if dnsTries < 1 {
-		dnsTries = 1
-	}
-	clk := clock.Default()
-	caaSERVFAILExceptions, err := bdns.ReadHostList(c.VA.CAASERVFAILExceptions)
-	cmd.FailOnError(err, "Couldn't read CAASERVFAILExceptions file")
-	var resolver bdns.DNSResolver
-	if !c.Common.DNSAllowLoopbackAddresses {
-		r := bdns.NewDNSResolverImpl(
-			dnsTimeout,
-			[]string{c.Common.DNSResolver},
-			caaSERVFAILExceptions,
-			scoped,
-			clk,
-			dnsTries)
-		r.LookupIPv6 = c.VA.LookupIPv6
-		resolver = r
-	} else {
-		r := bdns.NewTestDNSResolverImpl(dnsTimeout, []string{c.Common.DNSResolver}, scoped, clk, dnsTries)
-		r.LookupIPv6 = c.VA.LookupIPv6
-		resolver = r
+	dnsConfig := va.DNSConfig{
+		Resolver:               c.Common.DNSResolver,
+		Timeout:                dnsTimeout,
+		AllowLoopbackAddresses: c.Common.DNSAllowLoopbackAddresses,
 	}
-
-	vai := va.NewValidationAuthorityImpl(
-		pc,
-		sbc,
-		caaClient,
-		cdrClient,
-		resolver,
-		c.VA.UserAgent,
-		c.VA.IssuerDomain,
-		stats,
-		clk,
-		logger)
+	vai, err := va.NewFromConfig(c.VA, dnsConfig, sbc, stats, clock.Default(), logger)
+	cmd.FailOnError(err, "Unable to create VA")
 
 	amqpConf := c.VA.AMQP
 	if c.VA.GRPC != nil {
@@ -171,6 +83,11 @@ func main() {
 	err = rpc.NewValidationAuthorityServer(vas, vai)
 	cmd.FailOnError(err, "Unable to setup VA RPC server")
 
+	// Start only returns without an error once a signal has stopped the RPC
+	// server and the messages already received have been processed.
 	err = vas.Start(amqpConf)
 	cmd.FailOnError(err, "Unable to run VA RPC server")
+	for _, bl := range blocklists {
+		bl.Close()
+	}
 }
@@ -11,6 +11,7 @@ It is generated from these files:
 It has these top-level messages:
 	Check
 	Result
+	LookupStep
 */
 package caaChecker
 
@@ -60,9 +61,11 @@ func (m *Check) GetIssuerDomain() string {
 }
 
 type Result struct {
-	Present          *bool  `protobuf:"varint,1,opt,name=present" json:"present,omitempty"`
-	Valid            *bool  `protobuf:"varint,2,opt,name=valid" json:"valid,omitempty"`
-	XXX_unrecognized []byte `json:"-"`
+	Present          *bool         `protobuf:"varint,1,opt,name=present" json:"present,omitempty"`
+	Valid            *bool         `protobuf:"varint,2,opt,name=valid" json:"valid,omitempty"`
+	Path             []*LookupStep `protobuf:"bytes,3,rep,name=path" json:"path,omitempty"`
+	RecordUsed       *string       `protobuf:"bytes,4,opt,name=recordUsed" json:"recordUsed,omitempty"`
+	XXX_unrecognized []byte        `json:"-"`
 }
 
 func (m *Result) Reset()                    { *m = Result{} }
@@ -84,9 +87,65 @@ func (m *Result) GetValid() bool {
 	return false
 }
 
+func (m *Result) GetPath() []*LookupStep {
+	if m != nil {
+		return m.Path
+	}
+	return nil
+}
+
+func (m *Result) GetRecordUsed() string {
+	if m != nil && m.RecordUsed != nil {
+		return *m.RecordUsed
+	}
+	return ""
+}
+
+type LookupStep struct {
+	Name             *string  `protobuf:"bytes,1,opt,name=name" json:"name,omitempty"`
+	Aliases          []string `protobuf:"bytes,2,rep,name=aliases" json:"aliases,omitempty"`
+	Records          []string `protobuf:"bytes,3,rep,name=records" json:"records,omitempty"`
+	Error            *string  `protobuf:"bytes,4,opt,name=error" json:"error,omitempty"`
+	XXX_unrecognized []byte   `json:"-"`
+}
+
+func (m *LookupStep) Reset()                    { *m = LookupStep{} }
+func (m *LookupStep) String() string            { return proto.CompactTextString(m) }
+func (*LookupStep) ProtoMessage()               {}
+func (*LookupStep) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{2} }
+
+func (m *LookupStep) GetName() string {
+	if m != nil && m.Name != nil {
+		return *m.Name
+	}
+	return ""
+}
+
+func (m *LookupStep) GetAliases() []string {
+	if m != nil {
+		return m.Aliases
+	}
+	return nil
+}
+
+func (m *LookupStep) GetRecords() []string {
+	if m != nil {
+		return m.Records
+	}
+	return nil
+}
+
+func (m *LookupStep) GetError() string {
+	if m != nil && m.Error != nil {
+		return *m.Error
+	}
+	return ""
+}
+
 func init() {
 	proto.RegisterType((*Check)(nil), "Check")
 	proto.RegisterType((*Result)(nil), "Result")
+	proto.RegisterType((*LookupStep)(nil), "LookupStep")
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -164,15 +223,20 @@ var _CAAChecker_serviceDesc = grpc.ServiceDesc{
 func init() { proto.RegisterFile("caaChecker.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 156 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0xe2, 0x12, 0x48, 0x4e, 0x4c, 0x74,
-	0xce, 0x48, 0x4d, 0xce, 0x4e, 0x2d, 0xd2, 0x2b, 0x28, 0xca, 0x2f, 0xc9, 0x57, 0xd2, 0xe6, 0x62,
-	0x05, 0x0b, 0x08, 0xf1, 0x70, 0xb1, 0xe4, 0x25, 0xe6, 0xa6, 0x4a, 0x30, 0x2a, 0x30, 0x6a, 0x70,
-	0x0a, 0x89, 0x70, 0xf1, 0x64, 0x16, 0x17, 0x97, 0xa6, 0x16, 0xb9, 0xe4, 0xe7, 0x26, 0x66, 0xe6,
-	0x49, 0x30, 0x81, 0x44, 0x95, 0x34, 0xb8, 0xd8, 0x82, 0x52, 0x8b, 0x4b, 0x73, 0x4a, 0x84, 0xf8,
-	0xb9, 0xd8, 0x0b, 0x8a, 0x52, 0x8b, 0x53, 0xf3, 0x4a, 0xc0, 0x1a, 0x38, 0x84, 0x78, 0xb9, 0x58,
-	0xcb, 0x12, 0x73, 0x32, 0x53, 0xc0, 0x2a, 0x39, 0x8c, 0x8c, 0xb9, 0xb8, 0x9c, 0x1d, 0x1d, 0xa1,
-	0x56, 0x09, 0xa9, 0x72, 0x09, 0x84, 0x81, 0x24, 0xdd, 0xf2, 0x8b, 0x3c, 0x81, 0xa6, 0x26, 0xe6,
-	0x25, 0xa7, 0x0a, 0xb1, 0xe9, 0x81, 0x65, 0xa5, 0xd8, 0xf5, 0x20, 0x46, 0x2a, 0x31, 0x00, 0x02,
-	0x00, 0x00, 0xff, 0xff, 0xa4, 0xed, 0x44, 0x02, 0x9e, 0x00, 0x00, 0x00,
+	// 236 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0x54, 0x8f, 0x4f, 0x4b, 0xc3, 0x40,
+	0x10, 0xc5, 0x6d, 0x93, 0x36, 0xed, 0xb4, 0x52, 0x59, 0x3c, 0xac, 0x9e, 0x42, 0x40, 0x29, 0x88,
+	0x29, 0xd4, 0x4f, 0x50, 0x2a, 0x82, 0xe8, 0x49, 0x51, 0xcf, 0xc3, 0x66, 0xa0, 0x21, 0x7f, 0x76,
+	0x99, 0xd9, 0xf8, 0xf9, 0x25, 0xbb, 0x1e, 0xf4, 0xfa, 0xdb, 0xb7, 0xbf, 0x79, 0x0f, 0x6e, 0x4d,
+	0x57, 0xed, 0x0c, 0xe2, 0xbd, 0x39, 0x91, 0x69, 0x88, 0x77, 0x8e, 0xad, 0xb7, 0x23, 0x39, 0x46,
+	0x50, 0x06, 0x50, 0xdc, 0xc1, 0x2c, 0x00, 0xb5, 0x86, 0xb4, 0xc7, 0x8e, 0xf4, 0x24, 0x9f, 0x6c,
+	0x97, 0xea, 0x12, 0xd6, 0xb5, 0xc8, 0x40, 0xfc, 0x68, 0x3b, 0xac, 0x7b, 0x3d, 0x1d, 0x69, 0xf1,
+	0x05, 0xf3, 0x37, 0x92, 0xa1, 0xf5, 0x6a, 0x03, 0x99, 0x63, 0x12, 0xea, 0x7d, 0xf8, 0xb0, 0x50,
+	0xe7, 0x30, 0xfb, 0xc6, 0xb6, 0xae, 0x42, 0x72, 0xa1, 0xae, 0x20, 0x75, 0xe8, 0x4f, 0x3a, 0xc9,
+	0x93, 0xed, 0x6a, 0xbf, 0x2a, 0x5f, 0xad, 0x6d, 0x06, 0xf7, 0xee, 0xc9, 0x29, 0x05, 0xc0, 0x64,
+	0x2c, 0x57, 0x1f, 0x42, 0x95, 0x4e, 0x83, 0xf8, 0x05, 0xe0, 0x4f, 0xe2, 0x7f, 0x95, 0x0d, 0x64,
+	0xd8, 0xd6, 0x28, 0x24, 0x7a, 0x9a, 0x27, 0x11, 0x44, 0x81, 0x04, 0xfd, 0x72, 0xbc, 0x4d, 0xcc,
+	0x96, 0xa3, 0x6c, 0xff, 0x00, 0x70, 0x3c, 0x1c, 0x7e, 0x67, 0xaa, 0x1b, 0xb8, 0xf8, 0x1c, 0x8b,
+	0x3d, 0x59, 0x7e, 0x16, 0x19, 0xb0, 0x37, 0xa4, 0xe6, 0x65, 0x78, 0xbd, 0xce, 0xca, 0x38, 0xa7,
+	0x38, 0xfb, 0x19, 0x00, 0x2c, 0x77, 0x12, 0x03, 0x30, 0x01, 0x00, 0x00,
 }
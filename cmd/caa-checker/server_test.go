@@ -64,9 +64,18 @@ func TestChecking(t *testing.T) {
 		}
 	}
 
+	cname := "www.cname-present.com"
+	result, err := ccs.ValidForIssuance(ctx, &pb.Check{Name: &cname, IssuerDomain: &issuerDomain})
+	test.AssertNotError(t, err, "www.cname-present.com")
+	test.Assert(t, *result.Valid, "www.cname-present.com should be valid")
+	test.AssertEquals(t, len(result.Path), 2)
+	test.AssertEquals(t, result.Path[1].GetName(), "cname-present.com")
+	test.AssertDeepEquals(t, result.Path[1].Aliases, []string{"present.com."})
+	test.AssertEquals(t, result.GetRecordUsed(), result.Path[1].Records[0])
+
 	servfail := "servfail.com"
 	servfailPresent := "servfail.present.com"
-	result, err := ccs.ValidForIssuance(ctx, &pb.Check{Name: &servfail, IssuerDomain: &issuerDomain})
+	result, err = ccs.ValidForIssuance(ctx, &pb.Check{Name: &servfail, IssuerDomain: &issuerDomain})
 	test.AssertError(t, err, "servfail.com")
 	test.Assert(t, result == nil, "result should be nil")
 	test.AssertEquals(t, grpc.Code(err), bgrpc.DNSError)
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"time"
+
+	"github.com/letsencrypt/boulder/core"
+)
+
+// The kinds of certificate a ceremony signs
+const (
+	kindRoot         = "root"
+	kindIntermediate = "intermediate"
+	kindOCSPDelegate = "OCSP delegate"
+)
+
+var keyUsages = map[string]x509.KeyUsage{
+	"digital signature": x509.KeyUsageDigitalSignature,
+	"cert sign":         x509.KeyUsageCertSign,
+	"crl sign":          x509.KeyUsageCRLSign,
+}
+
+var extKeyUsages = map[string]x509.ExtKeyUsage{
+	"server auth":  x509.ExtKeyUsageServerAuth,
+	"client auth":  x509.ExtKeyUsageClientAuth,
+	"ocsp signing": x509.ExtKeyUsageOCSPSigning,
+}
+
+// id-pkix-ocsp-nocheck (RFC 6960, Section 4.2.2.2.1), which tells clients not
+// to check the revocation status of an OCSP delegate. Its value is NULL.
+var ocspNoCheckExtension = pkix.Extension{
+	Id:    asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 5},
+	Value: []byte{0x05, 0x00},
+}
+
+// makeTemplate builds the certificate of kind described by t, for pub.
+func makeTemplate(kind string, t certTemplate, pub crypto.PublicKey) (*x509.Certificate, error) {
+	serial, err := makeSerial(t.SerialNumber)
+	if err != nil {
+		return nil, err
+	}
+	notBefore, err := time.Parse(time.RFC3339, t.NotBefore)
+	if err != nil {
+		return nil, err
+	}
+	notAfter, err := time.Parse(time.RFC3339, t.NotAfter)
+	if err != nil {
+		return nil, err
+	}
+	skid, err := core.SubjectKeyID(pub)
+	if err != nil {
+		return nil, err
+	}
+
+	cert := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: t.CommonName},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		BasicConstraintsValid: true,
+		SubjectKeyId:          skid,
+	}
+	if t.Organization != "" {
+		cert.Subject.Organization = []string{t.Organization}
+	}
+	if t.Country != "" {
+		cert.Subject.Country = []string{t.Country}
+	}
+	if t.OCSPURL != "" {
+		cert.OCSPServer = []string{t.OCSPURL}
+	}
+	if t.CRLURL != "" {
+		cert.CRLDistributionPoints = []string{t.CRLURL}
+	}
+	if t.IssuerURL != "" {
+		cert.IssuingCertificateURL = []string{t.IssuerURL}
+	}
+	for _, policy := range t.Policies {
+		oid, err := core.ParseOID(policy)
+		if err != nil {
+			return nil, err
+		}
+		cert.PolicyIdentifiers = append(cert.PolicyIdentifiers, oid)
+	}
+	for _, name := range t.KeyUsages {
+		usage, ok := keyUsages[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown key usage %q", name)
+		}
+		cert.KeyUsage |= usage
+	}
+	for _, name := range t.ExtKeyUsages {
+		usage, ok := extKeyUsages[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown extended key usage %q", name)
+		}
+		cert.ExtKeyUsage = append(cert.ExtKeyUsage, usage)
+	}
+
+	switch kind {
+	case kindRoot, kindIntermediate:
+		cert.IsCA = true
+		if cert.KeyUsage == 0 {
+			cert.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+		}
+		if cert.KeyUsage&x509.KeyUsageCertSign == 0 {
+			return nil, fmt.Errorf("%s certificates must have the cert sign key usage", kind)
+		}
+		if kind == kindIntermediate {
+			cert.MaxPathLenZero = true
+		}
+	case kindOCSPDelegate:
+		if cert.KeyUsage == 0 {
+			cert.KeyUsage = x509.KeyUsageDigitalSignature
+		}
+		if len(cert.ExtKeyUsage) == 0 {
+			cert.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageOCSPSigning}
+		}
+		if len(cert.ExtKeyUsage) != 1 || cert.ExtKeyUsage[0] != x509.ExtKeyUsageOCSPSigning {
+			return nil, errors.New("OCSP delegate certificates must only have the OCSP signing extended key usage")
+		}
+		cert.ExtraExtensions = []pkix.Extension{ocspNoCheckExtension}
+	default:
+		return nil, fmt.Errorf("unknown certificate kind %q", kind)
+	}
+	return cert, nil
+}
+
+// makeSerial parses a hex serial, or generates a random one if it's empty.
+func makeSerial(serialHex string) (*big.Int, error) {
+	if serialHex == "" {
+		serialBytes := make([]byte, 16)
+		if _, err := rand.Read(serialBytes); err != nil {
+			return nil, err
+		}
+		// Clear the top bit, so the serial is positive once encoded.
+		serialBytes[0] &= 0x7f
+		return new(big.Int).SetBytes(serialBytes), nil
+	}
+	serialBytes, err := hex.DecodeString(serialHex)
+	if err != nil {
+		return nil, fmt.Errorf("invalid serial number: %s", err)
+	}
+	serial := new(big.Int).SetBytes(serialBytes)
+	if serial.Sign() == 0 || len(serialBytes) > 20 {
+		return nil, errors.New("serial number must be positive and at most 20 bytes")
+	}
+	return serial, nil
+}
+
+// signCertificate signs the certificate of kind described by t for pub, with
+// signer. issuer is nil for roots, which sign themselves. The signature is
+// checked before the certificate is returned.
+func signCertificate(kind string, t certTemplate, pub crypto.PublicKey, issuer *x509.Certificate, signer crypto.Signer) (*x509.Certificate, error) {
+	template, err := makeTemplate(kind, t, pub)
+	if err != nil {
+		return nil, err
+	}
+	parent := template
+	if issuer != nil {
+		parent = issuer
+		template.AuthorityKeyId = issuer.SubjectKeyId
+		if template.NotBefore.Before(issuer.NotBefore) || template.NotAfter.After(issuer.NotAfter) {
+			return nil, errors.New("certificate validity isn't within its issuer's")
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, pub, signer)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	if issuer == nil {
+		issuer = cert
+	}
+	if err = cert.CheckSignatureFrom(issuer); err != nil {
+		return nil, fmt.Errorf("signed certificate doesn't verify: %s", err)
+	}
+	return cert, nil
+}
+
+func readCertificate(path string) (*x509.Certificate, error) {
+	block, err := readPEM(path, "CERTIFICATE")
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+func readPublicKey(path string) (crypto.PublicKey, error) {
+	block, err := readPEM(path, "PUBLIC KEY")
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
+
+func readPEM(path, blockType string) (*pem.Block, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(contents)
+	if block == nil || block.Type != blockType {
+		return nil, fmt.Errorf("%s doesn't contain a PEM %s", path, blockType)
+	}
+	return block, nil
+}
+
+// writePEM writes der to path as a PEM block of blockType. It refuses to
+// overwrite existing files, so a ceremony can't clobber earlier output.
+func writePEM(path, blockType string, der []byte) error {
+	return writeNew(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}))
+}
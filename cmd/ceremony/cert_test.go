@@ -0,0 +1,97 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"testing"
+
+	"github.com/letsencrypt/boulder/test"
+)
+
+func TestMakeTemplate(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	test.AssertNotError(t, err, "Failed to generate key")
+	tmpl := certTemplate{
+		SerialNumber: "0102",
+		CommonName:   "Example",
+		Organization: "Example Org",
+		NotBefore:    "2016-09-01T00:00:00Z",
+		NotAfter:     "2026-09-01T00:00:00Z",
+		Policies:     []string{"2.23.140.1.2.1"},
+		OCSPURL:      "http://ocsp.example.com",
+	}
+
+	root, err := makeTemplate(kindRoot, tmpl, key.Public())
+	test.AssertNotError(t, err, "Failed to make root template")
+	test.Assert(t, root.IsCA && !root.MaxPathLenZero, "Root isn't an unconstrained CA")
+	test.AssertEquals(t, root.KeyUsage, x509.KeyUsageCertSign|x509.KeyUsageCRLSign)
+	test.AssertEquals(t, root.SerialNumber.Int64(), int64(0x0102))
+	test.AssertDeepEquals(t, root.Subject.Organization, []string{"Example Org"})
+	test.AssertEquals(t, len(root.SubjectKeyId), 20)
+	test.AssertDeepEquals(t, root.OCSPServer, []string{"http://ocsp.example.com"})
+	test.AssertEquals(t, root.PolicyIdentifiers[0].String(), "2.23.140.1.2.1")
+
+	intermediate, err := makeTemplate(kindIntermediate, tmpl, key.Public())
+	test.AssertNotError(t, err, "Failed to make intermediate template")
+	test.Assert(t, intermediate.IsCA && intermediate.MaxPathLenZero, "Intermediate can issue CAs")
+
+	delegate, err := makeTemplate(kindOCSPDelegate, tmpl, key.Public())
+	test.AssertNotError(t, err, "Failed to make OCSP delegate template")
+	test.Assert(t, !delegate.IsCA, "OCSP delegate is a CA")
+	test.AssertEquals(t, delegate.KeyUsage, x509.KeyUsageDigitalSignature)
+	test.AssertDeepEquals(t, delegate.ExtKeyUsage, []x509.ExtKeyUsage{x509.ExtKeyUsageOCSPSigning})
+	test.Assert(t, delegate.ExtraExtensions[0].Id.Equal(ocspNoCheckExtension.Id), "No ocsp-nocheck extension")
+
+	noSerial := tmpl
+	noSerial.SerialNumber = ""
+	random, err := makeTemplate(kindRoot, noSerial, key.Public())
+	test.AssertNotError(t, err, "Failed to make template with random serial")
+	test.Assert(t, random.SerialNumber.Sign() > 0, "Random serial isn't positive")
+
+	for _, c := range []struct {
+		kind   string
+		mutate func(*certTemplate)
+	}{
+		{"leaf", func(*certTemplate) {}},
+		{kindRoot, func(t *certTemplate) { t.SerialNumber = "00" }},
+		{kindRoot, func(t *certTemplate) { t.SerialNumber = "xyz" }},
+		{kindRoot, func(t *certTemplate) { t.Policies = []string{"2.x"} }},
+		{kindRoot, func(t *certTemplate) { t.KeyUsages = []string{"key encipherment"} }},
+		{kindRoot, func(t *certTemplate) { t.KeyUsages = []string{"digital signature"} }},
+		{kindIntermediate, func(t *certTemplate) { t.ExtKeyUsages = []string{"code signing"} }},
+		{kindOCSPDelegate, func(t *certTemplate) { t.ExtKeyUsages = []string{"server auth"} }},
+	} {
+		bad := tmpl
+		c.mutate(&bad)
+		_, err = makeTemplate(c.kind, bad, key.Public())
+		test.AssertError(t, err, "Made invalid template")
+	}
+}
+
+func TestSignCertificate(t *testing.T) {
+	rootKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	test.AssertNotError(t, err, "Failed to generate key")
+	intKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	test.AssertNotError(t, err, "Failed to generate key")
+	tmpl := certTemplate{
+		CommonName: "Example",
+		NotBefore:  "2016-09-01T00:00:00Z",
+		NotAfter:   "2026-09-01T00:00:00Z",
+	}
+
+	root, err := signCertificate(kindRoot, tmpl, rootKey.Public(), nil, rootKey)
+	test.AssertNotError(t, err, "Failed to sign root")
+	intermediate, err := signCertificate(kindIntermediate, tmpl, intKey.Public(), root, rootKey)
+	test.AssertNotError(t, err, "Failed to sign intermediate")
+	test.AssertByteEquals(t, intermediate.AuthorityKeyId, root.SubjectKeyId)
+
+	// The wrong key produces a signature that doesn't verify.
+	_, err = signCertificate(kindIntermediate, tmpl, intKey.Public(), root, intKey)
+	test.AssertError(t, err, "Signed intermediate with the wrong key")
+
+	tmpl.NotAfter = "2030-09-01T00:00:00Z"
+	_, err = signCertificate(kindIntermediate, tmpl, intKey.Public(), root, rootKey)
+	test.AssertError(t, err, "Signed intermediate outliving its issuer")
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ceremonyConfig is the YAML ceremony file. It names the PKCS#11 token that
+// holds the keys, and the steps to perform with them, in order.
+type ceremonyConfig struct {
+	PKCS11 pkcs11Config `yaml:"pkcs11"`
+	// TranscriptPath is the file every step is logged to. It is appended to,
+	// so a transcript can span several ceremonies.
+	TranscriptPath string `yaml:"transcriptPath"`
+	Steps          []step `yaml:"steps"`
+}
+
+type pkcs11Config struct {
+	Module     string `yaml:"module"`
+	TokenLabel string `yaml:"tokenLabel"`
+	PIN        string `yaml:"pin"`
+}
+
+// step is a single ceremony step. Exactly one of its fields must be set.
+type step struct {
+	GenerateKey  *keyStep  `yaml:"generateKey"`
+	Root         *certStep `yaml:"root"`
+	Intermediate *certStep `yaml:"intermediate"`
+	OCSPDelegate *certStep `yaml:"ocspDelegate"`
+	OCSPResponse *ocspStep `yaml:"ocspResponse"`
+}
+
+// keyStep generates a key pair on the token, and writes its public key to
+// PublicKeyPath as PEM.
+type keyStep struct {
+	Label string `yaml:"label"`
+	// Type is either "rsa" or "ecdsa"
+	Type string `yaml:"type"`
+	// RSABits is the modulus size of RSA keys
+	RSABits int `yaml:"rsaBits"`
+	// Curve is the curve of ECDSA keys: "P-256", "P-384" or "P-521"
+	Curve         string `yaml:"curve"`
+	PublicKeyPath string `yaml:"publicKeyPath"`
+}
+
+// certStep signs a certificate with the token key SigningKey. Roots sign their
+// own public key, which is SigningKey's. Intermediates and OCSP delegates sign
+// the PEM public key at PublicKeyPath, and are issued by the PEM certificate
+// at IssuerPath. The certificate is written to CertificatePath as PEM.
+type certStep struct {
+	SigningKey      string       `yaml:"signingKey"`
+	PublicKeyPath   string       `yaml:"publicKeyPath"`
+	IssuerPath      string       `yaml:"issuerPath"`
+	CertificatePath string       `yaml:"certificatePath"`
+	Template        certTemplate `yaml:"template"`
+}
+
+// certTemplate describes the contents of a certificate. The kind of
+// certificate being signed determines the basic constraints, and the key
+// usages if none are given.
+type certTemplate struct {
+	// SerialNumber is hex. If empty, a random serial is used.
+	SerialNumber string `yaml:"serialNumber"`
+	CommonName   string `yaml:"commonName"`
+	Organization string `yaml:"organization"`
+	Country      string `yaml:"country"`
+	// NotBefore and NotAfter are RFC 3339 timestamps
+	NotBefore    string   `yaml:"notBefore"`
+	NotAfter     string   `yaml:"notAfter"`
+	KeyUsages    []string `yaml:"keyUsages"`
+	ExtKeyUsages []string `yaml:"extKeyUsages"`
+	// Policies are the dotted certificate policy OIDs
+	Policies  []string `yaml:"policies"`
+	OCSPURL   string   `yaml:"ocspURL"`
+	CRLURL    string   `yaml:"crlURL"`
+	IssuerURL string   `yaml:"issuerURL"`
+}
+
+// ocspStep pre-signs an OCSP response for the PEM certificate at
+// CertificatePath, which was issued by the PEM certificate at IssuerPath. If
+// DelegatePath is set the response is signed by that OCSP delegate, whose key
+// is SigningKey, otherwise SigningKey is the issuer's key.
+type ocspStep struct {
+	SigningKey      string `yaml:"signingKey"`
+	IssuerPath      string `yaml:"issuerPath"`
+	DelegatePath    string `yaml:"delegatePath"`
+	CertificatePath string `yaml:"certificatePath"`
+	// Status is either "good" or "revoked"
+	Status string `yaml:"status"`
+	// ThisUpdate, NextUpdate and RevokedAt are RFC 3339 timestamps
+	ThisUpdate       string `yaml:"thisUpdate"`
+	NextUpdate       string `yaml:"nextUpdate"`
+	RevokedAt        string `yaml:"revokedAt"`
+	RevocationReason int    `yaml:"revocationReason"`
+	ResponsePath     string `yaml:"responsePath"`
+}
+
+// loadConfig reads and validates the ceremony file at path.
+func loadConfig(path string) (ceremonyConfig, error) {
+	var c ceremonyConfig
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return c, err
+	}
+	if err = yaml.Unmarshal(contents, &c); err != nil {
+		return c, err
+	}
+	return c, c.validate()
+}
+
+func (c ceremonyConfig) validate() error {
+	if c.PKCS11.Module == "" || c.PKCS11.TokenLabel == "" {
+		return errors.New("pkcs11 module and tokenLabel are required")
+	}
+	if c.TranscriptPath == "" {
+		return errors.New("transcriptPath is required")
+	}
+	if len(c.Steps) == 0 {
+		return errors.New("no steps")
+	}
+	for i, s := range c.Steps {
+		if err := s.validate(); err != nil {
+			return fmt.Errorf("step %d: %s", i+1, err)
+		}
+	}
+	return nil
+}
+
+func (s step) validate() error {
+	set := 0
+	var err error
+	if s.GenerateKey != nil {
+		set++
+		err = s.GenerateKey.validate()
+	}
+	if s.Root != nil {
+		set++
+		err = s.Root.validate(false)
+	}
+	if s.Intermediate != nil {
+		set++
+		err = s.Intermediate.validate(true)
+	}
+	if s.OCSPDelegate != nil {
+		set++
+		err = s.OCSPDelegate.validate(true)
+	}
+	if s.OCSPResponse != nil {
+		set++
+		err = s.OCSPResponse.validate()
+	}
+	if set != 1 {
+		return fmt.Errorf("exactly one kind of step must be given, got %d", set)
+	}
+	return err
+}
+
+func (k keyStep) validate() error {
+	if k.Label == "" || k.PublicKeyPath == "" {
+		return errors.New("label and publicKeyPath are required")
+	}
+	switch k.Type {
+	case "rsa":
+		if k.RSABits < 2048 {
+			return fmt.Errorf("rsaBits must be at least 2048, got %d", k.RSABits)
+		}
+	case "ecdsa":
+		if _, ok := curves[k.Curve]; !ok {
+			return fmt.Errorf("unsupported curve %q", k.Curve)
+		}
+	default:
+		return fmt.Errorf("unsupported key type %q", k.Type)
+	}
+	return nil
+}
+
+func (c certStep) validate(issued bool) error {
+	if c.SigningKey == "" || c.CertificatePath == "" {
+		return errors.New("signingKey and certificatePath are required")
+	}
+	if issued && (c.PublicKeyPath == "" || c.IssuerPath == "") {
+		return errors.New("publicKeyPath and issuerPath are required")
+	}
+	if !issued && (c.PublicKeyPath != "" || c.IssuerPath != "") {
+		return errors.New("roots sign their own key, so publicKeyPath and issuerPath must be empty")
+	}
+	return c.Template.validate()
+}
+
+func (t certTemplate) validate() error {
+	if t.CommonName == "" {
+		return errors.New("template commonName is required")
+	}
+	notBefore, err := time.Parse(time.RFC3339, t.NotBefore)
+	if err != nil {
+		return fmt.Errorf("template notBefore: %s", err)
+	}
+	notAfter, err := time.Parse(time.RFC3339, t.NotAfter)
+	if err != nil {
+		return fmt.Errorf("template notAfter: %s", err)
+	}
+	if !notAfter.After(notBefore) {
+		return errors.New("template notAfter must be after notBefore")
+	}
+	return nil
+}
+
+func (o ocspStep) validate() error {
+	if o.SigningKey == "" || o.IssuerPath == "" || o.CertificatePath == "" || o.ResponsePath == "" {
+		return errors.New("signingKey, issuerPath, certificatePath and responsePath are required")
+	}
+	switch o.Status {
+	case "good":
+	case "revoked":
+		if _, err := time.Parse(time.RFC3339, o.RevokedAt); err != nil {
+			return fmt.Errorf("revokedAt: %s", err)
+		}
+	default:
+		return fmt.Errorf("unsupported status %q", o.Status)
+	}
+	thisUpdate, err := time.Parse(time.RFC3339, o.ThisUpdate)
+	if err != nil {
+		return fmt.Errorf("thisUpdate: %s", err)
+	}
+	nextUpdate, err := time.Parse(time.RFC3339, o.NextUpdate)
+	if err != nil {
+		return fmt.Errorf("nextUpdate: %s", err)
+	}
+	if !nextUpdate.After(thisUpdate) {
+		return errors.New("nextUpdate must be after thisUpdate")
+	}
+	return nil
+}
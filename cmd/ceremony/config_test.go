@@ -0,0 +1,74 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/letsencrypt/boulder/test"
+)
+
+func TestLoadConfig(t *testing.T) {
+	f, err := ioutil.TempFile("", "ceremony")
+	test.AssertNotError(t, err, "Failed to create temporary file")
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(`
+pkcs11:
+  module: /usr/lib/softhsm/libsofthsm.so
+  tokenLabel: token_label
+  pin: 5678
+transcriptPath: transcript.log
+steps:
+  - generateKey:
+      label: root-key
+      type: ecdsa
+      curve: P-384
+      publicKeyPath: root-key.pem
+  - root:
+      signingKey: root-key
+      certificatePath: root.pem
+      template:
+        commonName: Example Root
+        notBefore: 2016-09-01T00:00:00Z
+        notAfter: 2036-09-01T00:00:00Z
+`)
+	test.AssertNotError(t, err, "Failed to write ceremony file")
+	f.Close()
+
+	c, err := loadConfig(f.Name())
+	test.AssertNotError(t, err, "Failed to load ceremony file")
+	test.AssertEquals(t, c.PKCS11.TokenLabel, "token_label")
+	test.AssertEquals(t, len(c.Steps), 2)
+	test.AssertEquals(t, c.Steps[0].GenerateKey.Curve, "P-384")
+	test.AssertEquals(t, c.Steps[1].Root.Template.CommonName, "Example Root")
+
+	_, err = loadConfig("/does/not/exist")
+	test.AssertError(t, err, "Loaded missing ceremony file")
+}
+
+func TestValidate(t *testing.T) {
+	valid := testCeremony("")
+	test.AssertNotError(t, valid.validate(), "Rejected valid ceremony")
+
+	for _, mutate := range []func(*ceremonyConfig){
+		func(c *ceremonyConfig) { c.PKCS11.Module = "" },
+		func(c *ceremonyConfig) { c.TranscriptPath = "" },
+		func(c *ceremonyConfig) { c.Steps = nil },
+		func(c *ceremonyConfig) { c.Steps[0] = step{} },
+		func(c *ceremonyConfig) { c.Steps[0].Root = c.Steps[3].Root },
+		func(c *ceremonyConfig) { c.Steps[0].GenerateKey.RSABits = 1024 },
+		func(c *ceremonyConfig) { c.Steps[1].GenerateKey.Curve = "P-224" },
+		func(c *ceremonyConfig) { c.Steps[1].GenerateKey.Type = "dsa" },
+		func(c *ceremonyConfig) { c.Steps[3].Root.IssuerPath = "issuer.pem" },
+		func(c *ceremonyConfig) { c.Steps[4].Intermediate.IssuerPath = "" },
+		func(c *ceremonyConfig) { c.Steps[4].Intermediate.Template.NotAfter = "2010-01-01T00:00:00Z" },
+		func(c *ceremonyConfig) { c.Steps[5].OCSPDelegate.Template.NotBefore = "yesterday" },
+		func(c *ceremonyConfig) { c.Steps[6].OCSPResponse.Status = "unknown" },
+		func(c *ceremonyConfig) { c.Steps[6].OCSPResponse.Status = "revoked" },
+		func(c *ceremonyConfig) { c.Steps[6].OCSPResponse.NextUpdate = c.Steps[6].OCSPResponse.ThisUpdate },
+	} {
+		c := testCeremony("")
+		mutate(&c)
+		test.AssertError(t, c.validate(), "Accepted invalid ceremony")
+	}
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/miekg/pkcs11"
+)
+
+// keyStore is where the ceremony's keys live. The token is the only real
+// implementation; tests use software keys.
+type keyStore interface {
+	// generate creates a key pair, and returns a signer for it
+	generate(k keyStep) (crypto.Signer, error)
+	// find returns a signer for the existing key pair with label
+	find(label string) (crypto.Signer, error)
+}
+
+type namedCurve struct {
+	curve elliptic.Curve
+	oid   asn1.ObjectIdentifier
+}
+
+var curves = map[string]namedCurve{
+	"P-256": {elliptic.P256(), asn1.ObjectIdentifier{1, 2, 840, 10045, 3, 1, 7}},
+	"P-384": {elliptic.P384(), asn1.ObjectIdentifier{1, 3, 132, 0, 34}},
+	"P-521": {elliptic.P521(), asn1.ObjectIdentifier{1, 3, 132, 0, 35}},
+}
+
+// DigestInfo prefixes for the hashes certificates and OCSP responses are
+// signed with (RFC 3447, Section 9.2)
+var hashPrefixes = map[crypto.Hash][]byte{
+	crypto.SHA256: {0x30, 0x31, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x01, 0x05, 0x00, 0x04, 0x20},
+	crypto.SHA384: {0x30, 0x41, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x02, 0x05, 0x00, 0x04, 0x30},
+	crypto.SHA512: {0x30, 0x51, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x03, 0x05, 0x00, 0x04, 0x40},
+}
+
+// pkcs11Ctx is the subset of pkcs11.Ctx's methods used once a session is
+// open, so a different implementation can be injected for testing.
+type pkcs11Ctx interface {
+	FindObjectsInit(sh pkcs11.SessionHandle, temp []*pkcs11.Attribute) error
+	FindObjects(sh pkcs11.SessionHandle, max int) ([]pkcs11.ObjectHandle, bool, error)
+	FindObjectsFinal(sh pkcs11.SessionHandle) error
+	GenerateKeyPair(sh pkcs11.SessionHandle, m []*pkcs11.Mechanism, public, private []*pkcs11.Attribute) (pkcs11.ObjectHandle, pkcs11.ObjectHandle, error)
+	GetAttributeValue(sh pkcs11.SessionHandle, o pkcs11.ObjectHandle, a []*pkcs11.Attribute) ([]*pkcs11.Attribute, error)
+	SignInit(sh pkcs11.SessionHandle, m []*pkcs11.Mechanism, o pkcs11.ObjectHandle) error
+	Sign(sh pkcs11.SessionHandle, message []byte) ([]byte, error)
+}
+
+// hsm is a logged in session with a PKCS#11 token.
+type hsm struct {
+	ctx     pkcs11Ctx
+	session pkcs11.SessionHandle
+}
+
+// openHSM loads the PKCS#11 module, and logs in to the token labelled
+// c.TokenLabel with a read/write session.
+func openHSM(c pkcs11Config) (*hsm, error) {
+	ctx := pkcs11.New(c.Module)
+	if ctx == nil {
+		return nil, fmt.Errorf("unable to load PKCS#11 module %q", c.Module)
+	}
+	if err := ctx.Initialize(); err != nil {
+		return nil, err
+	}
+	slots, err := ctx.GetSlotList(true)
+	if err != nil {
+		return nil, err
+	}
+	for _, slot := range slots {
+		info, err := ctx.GetTokenInfo(slot)
+		if err != nil {
+			return nil, err
+		}
+		if info.Label != c.TokenLabel {
+			continue
+		}
+		session, err := ctx.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION|pkcs11.CKF_RW_SESSION)
+		if err != nil {
+			return nil, err
+		}
+		if err = ctx.Login(session, pkcs11.CKU_USER, c.PIN); err != nil {
+			return nil, err
+		}
+		return &hsm{ctx: ctx, session: session}, nil
+	}
+	return nil, fmt.Errorf("no token labelled %q", c.TokenLabel)
+}
+
+// generate creates a key pair labelled k.Label on the token. It refuses to if
+// any object already has that label, since find could no longer tell the new
+// key from the old one.
+func (h *hsm) generate(k keyStep) (crypto.Signer, error) {
+	existing, err := h.findObjects([]*pkcs11.Attribute{pkcs11.NewAttribute(pkcs11.CKA_LABEL, k.Label)})
+	if err != nil {
+		return nil, err
+	}
+	if len(existing) > 0 {
+		return nil, fmt.Errorf("an object labelled %q already exists on the token", k.Label)
+	}
+
+	common := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_TOKEN, true),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, k.Label),
+	}
+	public := append([]*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_VERIFY, true),
+	}, common...)
+	private := append([]*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_PRIVATE, true),
+		pkcs11.NewAttribute(pkcs11.CKA_SENSITIVE, true),
+		pkcs11.NewAttribute(pkcs11.CKA_EXTRACTABLE, false),
+		pkcs11.NewAttribute(pkcs11.CKA_SIGN, true),
+	}, common...)
+
+	var mechanism *pkcs11.Mechanism
+	switch k.Type {
+	case "rsa":
+		mechanism = pkcs11.NewMechanism(pkcs11.CKM_RSA_PKCS_KEY_PAIR_GEN, nil)
+		public = append(public,
+			pkcs11.NewAttribute(pkcs11.CKA_MODULUS_BITS, k.RSABits),
+			pkcs11.NewAttribute(pkcs11.CKA_PUBLIC_EXPONENT, []byte{1, 0, 1}),
+		)
+	case "ecdsa":
+		curve, ok := curves[k.Curve]
+		if !ok {
+			return nil, fmt.Errorf("unsupported curve %q", k.Curve)
+		}
+		params, err := asn1.Marshal(curve.oid)
+		if err != nil {
+			return nil, err
+		}
+		mechanism = pkcs11.NewMechanism(pkcs11.CKM_EC_KEY_PAIR_GEN, nil)
+		public = append(public, pkcs11.NewAttribute(pkcs11.CKA_EC_PARAMS, params))
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Type)
+	}
+
+	pubHandle, privHandle, err := h.ctx.GenerateKeyPair(h.session, []*pkcs11.Mechanism{mechanism}, public, private)
+	if err != nil {
+		return nil, err
+	}
+	pub, err := h.publicKey(pubHandle)
+	if err != nil {
+		return nil, err
+	}
+	return &hsmSigner{hsm: h, handle: privHandle, pub: pub}, nil
+}
+
+func (h *hsm) find(label string) (crypto.Signer, error) {
+	privHandle, err := h.findObject(pkcs11.CKO_PRIVATE_KEY, label)
+	if err != nil {
+		return nil, err
+	}
+	pubHandle, err := h.findObject(pkcs11.CKO_PUBLIC_KEY, label)
+	if err != nil {
+		return nil, err
+	}
+	pub, err := h.publicKey(pubHandle)
+	if err != nil {
+		return nil, err
+	}
+	return &hsmSigner{hsm: h, handle: privHandle, pub: pub}, nil
+}
+
+// findObjects returns up to two of the objects matching template, which is
+// enough to tell whether there are none, one or several.
+func (h *hsm) findObjects(template []*pkcs11.Attribute) ([]pkcs11.ObjectHandle, error) {
+	if err := h.ctx.FindObjectsInit(h.session, template); err != nil {
+		return nil, err
+	}
+	handles, _, err := h.ctx.FindObjects(h.session, 2)
+	if err != nil {
+		return nil, err
+	}
+	if err = h.ctx.FindObjectsFinal(h.session); err != nil {
+		return nil, err
+	}
+	return handles, nil
+}
+
+// findObject returns the only object of class with label.
+func (h *hsm) findObject(class uint, label string) (pkcs11.ObjectHandle, error) {
+	handles, err := h.findObjects([]*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, class),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, label),
+	})
+	if err != nil {
+		return 0, err
+	}
+	if len(handles) != 1 {
+		return 0, fmt.Errorf("expected one object labelled %q, found %d", label, len(handles))
+	}
+	return handles[0], nil
+}
+
+// publicKey reads the RSA or ECDSA public key object handle from the token.
+func (h *hsm) publicKey(handle pkcs11.ObjectHandle) (crypto.PublicKey, error) {
+	attrs, err := h.ctx.GetAttributeValue(h.session, handle, []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, nil),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(attrs) == 0 || len(attrs[0].Value) == 0 {
+		return nil, errors.New("public key has no key type")
+	}
+
+	switch keyType := attrs[0].Value[0]; keyType {
+	case pkcs11.CKK_RSA:
+		attrs, err = h.ctx.GetAttributeValue(h.session, handle, []*pkcs11.Attribute{
+			pkcs11.NewAttribute(pkcs11.CKA_MODULUS, nil),
+			pkcs11.NewAttribute(pkcs11.CKA_PUBLIC_EXPONENT, nil),
+		})
+		if err != nil {
+			return nil, err
+		}
+		pub := &rsa.PublicKey{N: new(big.Int)}
+		for _, a := range attrs {
+			switch a.Type {
+			case pkcs11.CKA_MODULUS:
+				pub.N.SetBytes(a.Value)
+			case pkcs11.CKA_PUBLIC_EXPONENT:
+				pub.E = int(new(big.Int).SetBytes(a.Value).Int64())
+			}
+		}
+		if pub.N.Sign() == 0 || pub.E == 0 {
+			return nil, errors.New("RSA public key is missing its modulus or exponent")
+		}
+		return pub, nil
+	case pkcs11.CKK_EC:
+		attrs, err = h.ctx.GetAttributeValue(h.session, handle, []*pkcs11.Attribute{
+			pkcs11.NewAttribute(pkcs11.CKA_EC_PARAMS, nil),
+			pkcs11.NewAttribute(pkcs11.CKA_EC_POINT, nil),
+		})
+		if err != nil {
+			return nil, err
+		}
+		var params, point []byte
+		for _, a := range attrs {
+			switch a.Type {
+			case pkcs11.CKA_EC_PARAMS:
+				params = a.Value
+			case pkcs11.CKA_EC_POINT:
+				point = a.Value
+			}
+		}
+		return ecdsaPublicKey(params, point)
+	default:
+		return nil, fmt.Errorf("unsupported key type %d", keyType)
+	}
+}
+
+// ecdsaPublicKey decodes the CKA_EC_PARAMS and CKA_EC_POINT attributes of an
+// ECDSA public key.
+func ecdsaPublicKey(params, point []byte) (*ecdsa.PublicKey, error) {
+	var oid asn1.ObjectIdentifier
+	if _, err := asn1.Unmarshal(params, &oid); err != nil {
+		return nil, fmt.Errorf("parsing curve: %s", err)
+	}
+	var curve elliptic.Curve
+	for _, c := range curves {
+		if c.oid.Equal(oid) {
+			curve = c.curve
+		}
+	}
+	if curve == nil {
+		return nil, fmt.Errorf("unsupported curve %s", oid)
+	}
+	// Since PKCS#11 v2.20 the point is wrapped in an OCTET STRING, but some
+	// tokens still return it bare.
+	var unwrapped []byte
+	if rest, err := asn1.Unmarshal(point, &unwrapped); err == nil && len(rest) == 0 {
+		point = unwrapped
+	}
+	x, y := elliptic.Unmarshal(curve, point)
+	if x == nil {
+		return nil, errors.New("invalid EC point")
+	}
+	return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+}
+
+// hsmSigner is a crypto.Signer for a private key on the token.
+type hsmSigner struct {
+	hsm    *hsm
+	handle pkcs11.ObjectHandle
+	pub    crypto.PublicKey
+}
+
+func (s *hsmSigner) Public() crypto.PublicKey {
+	return s.pub
+}
+
+// Sign signs digest with PKCS#1 v1.5 for RSA keys, or ECDSA, returning the
+// signature in the form crypto/x509 expects.
+func (s *hsmSigner) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if len(digest) != opts.HashFunc().Size() {
+		return nil, fmt.Errorf("digest length %d doesn't match hash", len(digest))
+	}
+	var mechanism *pkcs11.Mechanism
+	input := digest
+	switch s.pub.(type) {
+	case *rsa.PublicKey:
+		prefix, ok := hashPrefixes[opts.HashFunc()]
+		if !ok {
+			return nil, errors.New("unsupported hash function")
+		}
+		mechanism = pkcs11.NewMechanism(pkcs11.CKM_RSA_PKCS, nil)
+		input = append(append([]byte{}, prefix...), digest...)
+	case *ecdsa.PublicKey:
+		mechanism = pkcs11.NewMechanism(pkcs11.CKM_ECDSA, nil)
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", s.pub)
+	}
+
+	if err := s.hsm.ctx.SignInit(s.hsm.session, []*pkcs11.Mechanism{mechanism}, s.handle); err != nil {
+		return nil, fmt.Errorf("sign init: %s", err)
+	}
+	sig, err := s.hsm.ctx.Sign(s.hsm.session, input)
+	if err != nil {
+		return nil, fmt.Errorf("sign: %s", err)
+	}
+	if _, ok := s.pub.(*ecdsa.PublicKey); ok {
+		// PKCS#11 returns r and s concatenated, but X.509 wants them as an
+		// ASN.1 SEQUENCE.
+		if len(sig) == 0 || len(sig)%2 != 0 {
+			return nil, fmt.Errorf("invalid ECDSA signature length %d", len(sig))
+		}
+		return asn1.Marshal(struct{ R, S *big.Int }{
+			R: new(big.Int).SetBytes(sig[:len(sig)/2]),
+			S: new(big.Int).SetBytes(sig[len(sig)/2:]),
+		})
+	}
+	return sig, nil
+}
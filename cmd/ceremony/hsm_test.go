@@ -0,0 +1,243 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"testing"
+
+	"github.com/miekg/pkcs11"
+
+	"github.com/letsencrypt/boulder/test"
+)
+
+type mockObject struct {
+	class uint
+	label string
+	key   crypto.Signer
+}
+
+// mockCtx is a pkcs11Ctx that generates software keys.
+type mockCtx struct {
+	objects []mockObject
+	found   []pkcs11.ObjectHandle
+	signing pkcs11.ObjectHandle
+}
+
+func attrValue(attrs []*pkcs11.Attribute, t uint) []byte {
+	for _, a := range attrs {
+		if a.Type == t {
+			return a.Value
+		}
+	}
+	return nil
+}
+
+func (m *mockCtx) GenerateKeyPair(_ pkcs11.SessionHandle, mechs []*pkcs11.Mechanism, public, private []*pkcs11.Attribute) (pkcs11.ObjectHandle, pkcs11.ObjectHandle, error) {
+	var key crypto.Signer
+	var err error
+	switch mechs[0].Mechanism {
+	case pkcs11.CKM_RSA_PKCS_KEY_PAIR_GEN:
+		bits := new(big.Int).SetBytes(reverse(attrValue(public, pkcs11.CKA_MODULUS_BITS)))
+		key, err = rsa.GenerateKey(rand.Reader, int(bits.Int64()))
+	case pkcs11.CKM_EC_KEY_PAIR_GEN:
+		var oid asn1.ObjectIdentifier
+		if _, err = asn1.Unmarshal(attrValue(public, pkcs11.CKA_EC_PARAMS), &oid); err != nil {
+			return 0, 0, err
+		}
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	default:
+		err = errors.New("unsupported mechanism")
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	label := string(attrValue(public, pkcs11.CKA_LABEL))
+	m.objects = append(m.objects,
+		mockObject{pkcs11.CKO_PUBLIC_KEY, label, key},
+		mockObject{pkcs11.CKO_PRIVATE_KEY, label, key})
+	return pkcs11.ObjectHandle(len(m.objects) - 2), pkcs11.ObjectHandle(len(m.objects) - 1), nil
+}
+
+// reverse turns a little endian CK_ULONG into big endian bytes.
+func reverse(b []byte) []byte {
+	r := make([]byte, len(b))
+	for i := range b {
+		r[len(b)-1-i] = b[i]
+	}
+	return r
+}
+
+func (m *mockCtx) FindObjectsInit(_ pkcs11.SessionHandle, temp []*pkcs11.Attribute) error {
+	m.found = nil
+	classAttr := attrValue(temp, pkcs11.CKA_CLASS)
+	class := new(big.Int).SetBytes(reverse(classAttr)).Uint64()
+	label := string(attrValue(temp, pkcs11.CKA_LABEL))
+	for i, o := range m.objects {
+		if (classAttr == nil || uint64(o.class) == class) && o.label == label {
+			m.found = append(m.found, pkcs11.ObjectHandle(i))
+		}
+	}
+	return nil
+}
+
+func (m *mockCtx) FindObjects(_ pkcs11.SessionHandle, _ int) ([]pkcs11.ObjectHandle, bool, error) {
+	return m.found, false, nil
+}
+
+func (m *mockCtx) FindObjectsFinal(_ pkcs11.SessionHandle) error {
+	return nil
+}
+
+func (m *mockCtx) GetAttributeValue(_ pkcs11.SessionHandle, o pkcs11.ObjectHandle, attrs []*pkcs11.Attribute) ([]*pkcs11.Attribute, error) {
+	var result []*pkcs11.Attribute
+	for _, a := range attrs {
+		switch pub := m.objects[o].key.Public().(type) {
+		case *rsa.PublicKey:
+			switch a.Type {
+			case pkcs11.CKA_KEY_TYPE:
+				result = append(result, pkcs11.NewAttribute(a.Type, []byte{pkcs11.CKK_RSA}))
+			case pkcs11.CKA_MODULUS:
+				result = append(result, pkcs11.NewAttribute(a.Type, pub.N.Bytes()))
+			case pkcs11.CKA_PUBLIC_EXPONENT:
+				result = append(result, pkcs11.NewAttribute(a.Type, big.NewInt(int64(pub.E)).Bytes()))
+			}
+		case *ecdsa.PublicKey:
+			switch a.Type {
+			case pkcs11.CKA_KEY_TYPE:
+				result = append(result, pkcs11.NewAttribute(a.Type, []byte{pkcs11.CKK_EC}))
+			case pkcs11.CKA_EC_PARAMS:
+				params, _ := asn1.Marshal(curves["P-256"].oid)
+				result = append(result, pkcs11.NewAttribute(a.Type, params))
+			case pkcs11.CKA_EC_POINT:
+				point, _ := asn1.Marshal(elliptic.Marshal(pub.Curve, pub.X, pub.Y))
+				result = append(result, pkcs11.NewAttribute(a.Type, point))
+			}
+		}
+	}
+	return result, nil
+}
+
+func (m *mockCtx) SignInit(_ pkcs11.SessionHandle, _ []*pkcs11.Mechanism, o pkcs11.ObjectHandle) error {
+	m.signing = o
+	return nil
+}
+
+func (m *mockCtx) Sign(_ pkcs11.SessionHandle, message []byte) ([]byte, error) {
+	switch key := m.objects[m.signing].key.(type) {
+	case *rsa.PrivateKey:
+		// message already has the DigestInfo prefix
+		return rsa.SignPKCS1v15(rand.Reader, key, crypto.Hash(0), message)
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, key, message)
+		if err != nil {
+			return nil, err
+		}
+		size := (key.Curve.Params().BitSize + 7) / 8
+		sig := make([]byte, 2*size)
+		copy(sig[size-len(r.Bytes()):size], r.Bytes())
+		copy(sig[2*size-len(s.Bytes()):], s.Bytes())
+		return sig, nil
+	}
+	return nil, errors.New("unsupported key")
+}
+
+func TestHSM(t *testing.T) {
+	h := &hsm{ctx: &mockCtx{}}
+	tmpl := certTemplate{
+		CommonName: "Example",
+		NotBefore:  "2016-09-01T00:00:00Z",
+		NotAfter:   "2026-09-01T00:00:00Z",
+	}
+
+	for _, k := range []keyStep{
+		{Label: "rsa", Type: "rsa", RSABits: 2048},
+		{Label: "ecdsa", Type: "ecdsa", Curve: "P-256"},
+	} {
+		generated, err := h.generate(k)
+		test.AssertNotError(t, err, "Failed to generate key")
+		found, err := h.find(k.Label)
+		test.AssertNotError(t, err, "Failed to find generated key")
+		test.AssertDeepEquals(t, found.Public(), generated.Public())
+
+		// Certificates signed on the token verify with its public key.
+		_, err = signCertificate(kindRoot, tmpl, found.Public(), nil, found)
+		test.AssertNotError(t, err, "Failed to sign with token key")
+
+		_, err = h.generate(k)
+		test.AssertError(t, err, "Generated a key with an existing label")
+	}
+
+	_, err := h.find("missing")
+	test.AssertError(t, err, "Found missing key")
+	_, err = h.generate(keyStep{Label: "dsa", Type: "dsa"})
+	test.AssertError(t, err, "Generated unsupported key type")
+}
+
+func TestECDSAPublicKey(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	test.AssertNotError(t, err, "Failed to generate key")
+	params, _ := asn1.Marshal(curves["P-384"].oid)
+	point := elliptic.Marshal(key.Curve, key.X, key.Y)
+	wrapped, _ := asn1.Marshal(point)
+
+	for _, p := range [][]byte{point, wrapped} {
+		pub, err := ecdsaPublicKey(params, p)
+		test.AssertNotError(t, err, "Failed to decode public key")
+		test.AssertDeepEquals(t, pub, &key.PublicKey)
+	}
+
+	p224, _ := asn1.Marshal(asn1.ObjectIdentifier{1, 3, 132, 0, 33})
+	_, err = ecdsaPublicKey(p224, wrapped)
+	test.AssertError(t, err, "Decoded key on unsupported curve")
+	_, err = ecdsaPublicKey(params, []byte{4, 1, 2})
+	test.AssertError(t, err, "Decoded invalid point")
+}
+
+// TestSoftHSM runs against the SoftHSM token set up by test/make-softhsm.sh,
+// when SOFTHSM_CONF points at its config.
+func TestSoftHSM(t *testing.T) {
+	module := "/usr/lib/softhsm/libsofthsm.so"
+	if os.Getenv("SOFTHSM_CONF") == "" {
+		t.Skip("SOFTHSM_CONF isn't set")
+	}
+	if _, err := os.Stat(module); err != nil {
+		t.Skipf("SoftHSM module isn't installed: %s", err)
+	}
+	h, err := openHSM(pkcs11Config{Module: module, TokenLabel: "token_label", PIN: "5678"})
+	test.AssertNotError(t, err, "Failed to open SoftHSM token")
+	tmpl := certTemplate{
+		CommonName: "Example",
+		NotBefore:  "2016-09-01T00:00:00Z",
+		NotAfter:   "2026-09-01T00:00:00Z",
+	}
+
+	// The token outlives the test, so labels must be new on every run.
+	suffix := make([]byte, 8)
+	_, err = rand.Read(suffix)
+	test.AssertNotError(t, err, "Failed to generate label suffix")
+	for _, k := range []keyStep{
+		{Label: fmt.Sprintf("ceremony-rsa-%x", suffix), Type: "rsa", RSABits: 2048},
+		{Label: fmt.Sprintf("ceremony-ecdsa-%x", suffix), Type: "ecdsa", Curve: "P-256"},
+	} {
+		generated, err := h.generate(k)
+		test.AssertNotError(t, err, "Failed to generate key on SoftHSM")
+		found, err := h.find(k.Label)
+		test.AssertNotError(t, err, "Failed to find generated key on SoftHSM")
+		test.AssertDeepEquals(t, found.Public(), generated.Public())
+
+		cert, err := signCertificate(kindRoot, tmpl, found.Public(), nil, found)
+		test.AssertNotError(t, err, "Failed to sign with SoftHSM key")
+		test.AssertNotError(t, cert.CheckSignatureFrom(cert), "Certificate signed by SoftHSM doesn't verify")
+
+		_, err = h.generate(k)
+		test.AssertError(t, err, "Generated a key with an existing label on SoftHSM")
+	}
+}
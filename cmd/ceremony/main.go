@@ -0,0 +1,240 @@
+package main
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/letsencrypt/boulder/cmd"
+)
+
+const usage = `
+name:
+  ceremony - Performs a key ceremony against a PKCS#11 token
+
+usage:
+  ceremony -config <ceremony.yaml>
+
+description:
+  Reads a YAML ceremony file and performs its steps in order, using keys on
+  the PKCS#11 token it names. Steps can generate keys on the token, self-sign
+  root certificates, sign intermediate and OCSP delegate certificates from
+  templates, and pre-sign OCSP responses. Every step, and its outcome, is
+  appended to the ceremony's transcript. Output files are never overwritten.
+
+  The ceremony stops at the first step that fails.
+`
+
+const configUsage = `
+Ceremony file (YAML), e.g.:
+
+pkcs11:
+  module: /usr/lib/softhsm/libsofthsm.so
+  tokenLabel: token_label
+  pin: 5678
+transcriptPath: ceremony-transcript.log
+steps:
+  - generateKey:
+      label: root-key
+      type: rsa
+      rsaBits: 4096
+      publicKeyPath: root-key.pem
+  - root:
+      signingKey: root-key
+      certificatePath: root.pem
+      template:
+        commonName: Example Root
+        notBefore: 2016-09-01T00:00:00Z
+        notAfter: 2036-09-01T00:00:00Z
+  - intermediate:
+      signingKey: root-key
+      publicKeyPath: intermediate-key.pem
+      issuerPath: root.pem
+      certificatePath: intermediate.pem
+      template:
+        commonName: Example Intermediate
+        notBefore: 2016-09-01T00:00:00Z
+        notAfter: 2021-09-01T00:00:00Z
+        extKeyUsages: [server auth, client auth]
+  - ocspResponse:
+      signingKey: root-key
+      issuerPath: root.pem
+      certificatePath: intermediate.pem
+      status: good
+      thisUpdate: 2016-09-01T00:00:00Z
+      nextUpdate: 2017-09-01T00:00:00Z
+      responsePath: intermediate-ocsp.der
+`
+
+// run performs the ceremony's steps in order, using keys from keys, and logs
+// each of them to transcript.
+func run(c ceremonyConfig, keys keyStore, transcript *log.Logger) error {
+	for i, s := range c.Steps {
+		var err error
+		switch {
+		case s.GenerateKey != nil:
+			err = generateKey(*s.GenerateKey, keys, transcript)
+		case s.Root != nil:
+			err = signCertificateStep(kindRoot, *s.Root, keys, transcript)
+		case s.Intermediate != nil:
+			err = signCertificateStep(kindIntermediate, *s.Intermediate, keys, transcript)
+		case s.OCSPDelegate != nil:
+			err = signCertificateStep(kindOCSPDelegate, *s.OCSPDelegate, keys, transcript)
+		case s.OCSPResponse != nil:
+			err = signOCSPResponseStep(*s.OCSPResponse, keys, transcript)
+		}
+		if err != nil {
+			transcript.Printf("Step %d failed: %s", i+1, err)
+			return fmt.Errorf("step %d: %s", i+1, err)
+		}
+		transcript.Printf("Step %d complete", i+1)
+	}
+	return nil
+}
+
+func generateKey(k keyStep, keys keyStore, transcript *log.Logger) error {
+	transcript.Printf("Generating %s key pair with label %q", k.Type, k.Label)
+	// Check before generating, so that a key pair isn't left on the token with
+	// nowhere to write its public key.
+	if _, err := os.Stat(k.PublicKeyPath); err == nil {
+		return fmt.Errorf("%s already exists", k.PublicKeyPath)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	signer, err := keys.generate(k)
+	if err != nil {
+		return err
+	}
+	der, err := x509.MarshalPKIXPublicKey(signer.Public())
+	if err != nil {
+		return err
+	}
+	if err = writePEM(k.PublicKeyPath, "PUBLIC KEY", der); err != nil {
+		return err
+	}
+	transcript.Printf("Generated key pair %q: public key SHA-256=[%x], written to %s",
+		k.Label, sha256.Sum256(der), k.PublicKeyPath)
+	return nil
+}
+
+func signCertificateStep(kind string, c certStep, keys keyStore, transcript *log.Logger) error {
+	transcript.Printf("Signing %s certificate %q with key %q", kind, c.Template.CommonName, c.SigningKey)
+	signer, err := keys.find(c.SigningKey)
+	if err != nil {
+		return err
+	}
+	var pub crypto.PublicKey
+	var issuer *x509.Certificate
+	if kind == kindRoot {
+		pub = signer.Public()
+	} else {
+		if pub, err = readPublicKey(c.PublicKeyPath); err != nil {
+			return err
+		}
+		if issuer, err = readCertificate(c.IssuerPath); err != nil {
+			return err
+		}
+		transcript.Printf("Issuer %q SHA-256=[%x], subject public key from %s",
+			issuer.Subject.CommonName, sha256.Sum256(issuer.Raw), c.PublicKeyPath)
+	}
+	cert, err := signCertificate(kind, c.Template, pub, issuer, signer)
+	if err != nil {
+		return err
+	}
+	if err = writePEM(c.CertificatePath, "CERTIFICATE", cert.Raw); err != nil {
+		return err
+	}
+	transcript.Printf("Signed %s certificate %q: serial=[%x] notBefore=[%s] notAfter=[%s] SHA-256=[%x], written to %s",
+		kind, cert.Subject.CommonName, cert.SerialNumber, cert.NotBefore, cert.NotAfter,
+		sha256.Sum256(cert.Raw), c.CertificatePath)
+	return nil
+}
+
+func signOCSPResponseStep(o ocspStep, keys keyStore, transcript *log.Logger) error {
+	transcript.Printf("Signing %s OCSP response for %s with key %q", o.Status, o.CertificatePath, o.SigningKey)
+	signer, err := keys.find(o.SigningKey)
+	if err != nil {
+		return err
+	}
+	issuer, err := readCertificate(o.IssuerPath)
+	if err != nil {
+		return err
+	}
+	cert, err := readCertificate(o.CertificatePath)
+	if err != nil {
+		return err
+	}
+	var delegate *x509.Certificate
+	if o.DelegatePath != "" {
+		if delegate, err = readCertificate(o.DelegatePath); err != nil {
+			return err
+		}
+	}
+	der, err := signOCSPResponse(o, issuer, delegate, cert, signer)
+	if err != nil {
+		return err
+	}
+	if err = writeNew(o.ResponsePath, der); err != nil {
+		return err
+	}
+	transcript.Printf("Signed %s OCSP response for serial=[%x]: thisUpdate=[%s] nextUpdate=[%s] SHA-256=[%x], written to %s",
+		o.Status, cert.SerialNumber, o.ThisUpdate, o.NextUpdate, sha256.Sum256(der), o.ResponsePath)
+	return nil
+}
+
+// writeNew writes contents to path, failing if path already exists.
+func writeNew(path string, contents []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(contents)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func main() {
+	configFile := flag.String("config", "", configUsage)
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "%s\n", usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if *configFile == "" {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	c, err := loadConfig(*configFile)
+	cmd.FailOnError(err, "Failed to load ceremony file")
+	contents, err := ioutil.ReadFile(*configFile)
+	cmd.FailOnError(err, "Failed to read ceremony file")
+
+	transcriptFile, err := os.OpenFile(c.TranscriptPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	cmd.FailOnError(err, "Failed to open transcript")
+	defer transcriptFile.Close()
+	transcript := log.New(io.MultiWriter(transcriptFile, os.Stdout), "", log.LstdFlags|log.LUTC)
+	transcript.Printf("Starting ceremony from %s SHA-256=[%x] with token %q",
+		*configFile, sha256.Sum256(contents), c.PKCS11.TokenLabel)
+
+	token, err := openHSM(c.PKCS11)
+	if err != nil {
+		transcript.Printf("Failed to open token: %s", err)
+	}
+	cmd.FailOnError(err, "Failed to open token")
+
+	err = run(c, token, transcript)
+	if err != nil {
+		transcript.Printf("Ceremony failed")
+	}
+	cmd.FailOnError(err, "Ceremony failed")
+	transcript.Printf("Ceremony complete")
+}
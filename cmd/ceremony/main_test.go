@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/letsencrypt/boulder/test"
+)
+
+// memKeyStore is a keyStore with software keys.
+type memKeyStore map[string]crypto.Signer
+
+func (m memKeyStore) generate(k keyStep) (crypto.Signer, error) {
+	if _, ok := m[k.Label]; ok {
+		return nil, fmt.Errorf("key %q already exists", k.Label)
+	}
+	var key crypto.Signer
+	var err error
+	switch k.Type {
+	case "rsa":
+		key, err = rsa.GenerateKey(rand.Reader, k.RSABits)
+	case "ecdsa":
+		key, err = ecdsa.GenerateKey(curves[k.Curve].curve, rand.Reader)
+	}
+	if err != nil {
+		return nil, err
+	}
+	m[k.Label] = key
+	return key, nil
+}
+
+func (m memKeyStore) find(label string) (crypto.Signer, error) {
+	key, ok := m[label]
+	if !ok {
+		return nil, fmt.Errorf("no key %q", label)
+	}
+	return key, nil
+}
+
+func testCeremony(dir string) ceremonyConfig {
+	path := func(name string) string { return filepath.Join(dir, name) }
+	validity := func(cn string) certTemplate {
+		return certTemplate{
+			CommonName: cn,
+			NotBefore:  "2016-09-01T00:00:00Z",
+			NotAfter:   "2026-09-01T00:00:00Z",
+		}
+	}
+	return ceremonyConfig{
+		PKCS11:         pkcs11Config{Module: "softhsm.so", TokenLabel: "token"},
+		TranscriptPath: path("transcript.log"),
+		Steps: []step{
+			{GenerateKey: &keyStep{Label: "root", Type: "rsa", RSABits: 2048, PublicKeyPath: path("root.pub")}},
+			{GenerateKey: &keyStep{Label: "int", Type: "ecdsa", Curve: "P-256", PublicKeyPath: path("int.pub")}},
+			{GenerateKey: &keyStep{Label: "ocsp", Type: "ecdsa", Curve: "P-256", PublicKeyPath: path("ocsp.pub")}},
+			{Root: &certStep{SigningKey: "root", CertificatePath: path("root.pem"), Template: validity("Root")}},
+			{Intermediate: &certStep{SigningKey: "root", PublicKeyPath: path("int.pub"), IssuerPath: path("root.pem"),
+				CertificatePath: path("int.pem"), Template: validity("Intermediate")}},
+			{OCSPDelegate: &certStep{SigningKey: "root", PublicKeyPath: path("ocsp.pub"), IssuerPath: path("root.pem"),
+				CertificatePath: path("ocsp.pem"), Template: validity("OCSP")}},
+			{OCSPResponse: &ocspStep{SigningKey: "ocsp", IssuerPath: path("root.pem"), DelegatePath: path("ocsp.pem"),
+				CertificatePath: path("int.pem"), Status: "good", ThisUpdate: "2016-09-01T00:00:00Z",
+				NextUpdate: "2017-09-01T00:00:00Z", ResponsePath: path("int-ocsp.der")}},
+		},
+	}
+}
+
+func TestRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ceremony")
+	test.AssertNotError(t, err, "Failed to create temporary directory")
+	defer os.RemoveAll(dir)
+
+	c := testCeremony(dir)
+	test.AssertNotError(t, c.validate(), "Test ceremony is invalid")
+	keys := memKeyStore{}
+	out := new(bytes.Buffer)
+	err = run(c, keys, log.New(out, "", 0))
+	test.AssertNotError(t, err, "Ceremony failed")
+	test.AssertEquals(t, strings.Count(out.String(), " complete\n"), len(c.Steps))
+
+	root, err := readCertificate(filepath.Join(dir, "root.pem"))
+	test.AssertNotError(t, err, "Failed to read root")
+	test.AssertNotError(t, root.CheckSignatureFrom(root), "Root isn't self-signed")
+	intermediate, err := readCertificate(filepath.Join(dir, "int.pem"))
+	test.AssertNotError(t, err, "Failed to read intermediate")
+	test.AssertNotError(t, intermediate.CheckSignatureFrom(root), "Intermediate isn't signed by root")
+	pub, err := readPublicKey(filepath.Join(dir, "int.pub"))
+	test.AssertNotError(t, err, "Failed to read intermediate public key")
+	test.AssertDeepEquals(t, intermediate.PublicKey, pub)
+
+	responseDER, err := ioutil.ReadFile(filepath.Join(dir, "int-ocsp.der"))
+	test.AssertNotError(t, err, "Failed to read OCSP response")
+	response, err := ocsp.ParseResponse(responseDER, root)
+	test.AssertNotError(t, err, "Failed to parse OCSP response")
+	test.AssertEquals(t, response.Status, ocsp.Good)
+	test.AssertEquals(t, response.SerialNumber.Cmp(intermediate.SerialNumber), 0)
+
+	// Running the same ceremony again fails at the first step, before any key
+	// is generated, and doesn't touch the earlier output.
+	out.Reset()
+	keys = memKeyStore{}
+	err = run(c, keys, log.New(out, "", 0))
+	test.AssertError(t, err, "Ceremony overwrote its earlier output")
+	test.Assert(t, strings.Contains(out.String(), "Step 1 failed"), "Failure not in transcript")
+	test.AssertEquals(t, len(keys), 0)
+	rootAgain, err := readCertificate(filepath.Join(dir, "root.pem"))
+	test.AssertNotError(t, err, "Failed to read root")
+	test.AssertByteEquals(t, rootAgain.Raw, root.Raw)
+}
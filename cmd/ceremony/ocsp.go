@@ -0,0 +1,69 @@
+package main
+
+import (
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// signOCSPResponse signs the OCSP response o describes for cert, issued by
+// issuer. If delegate isn't nil, signer is its key and the response includes
+// it, otherwise signer is the issuer's key. The response is parsed and its
+// signature checked before it is returned.
+func signOCSPResponse(o ocspStep, issuer, delegate, cert *x509.Certificate, signer crypto.Signer) ([]byte, error) {
+	if err := cert.CheckSignatureFrom(issuer); err != nil {
+		return nil, fmt.Errorf("certificate wasn't issued by issuer: %s", err)
+	}
+	thisUpdate, err := time.Parse(time.RFC3339, o.ThisUpdate)
+	if err != nil {
+		return nil, err
+	}
+	nextUpdate, err := time.Parse(time.RFC3339, o.NextUpdate)
+	if err != nil {
+		return nil, err
+	}
+
+	template := ocsp.Response{
+		SerialNumber: cert.SerialNumber,
+		ThisUpdate:   thisUpdate,
+		NextUpdate:   nextUpdate,
+		Status:       ocsp.Good,
+	}
+	if o.Status == "revoked" {
+		template.Status = ocsp.Revoked
+		template.RevocationReason = o.RevocationReason
+		template.RevokedAt, err = time.Parse(time.RFC3339, o.RevokedAt)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	responder := issuer
+	if delegate != nil {
+		if err = delegate.CheckSignatureFrom(issuer); err != nil {
+			return nil, fmt.Errorf("OCSP delegate wasn't issued by issuer: %s", err)
+		}
+		if nextUpdate.After(delegate.NotAfter) {
+			return nil, errors.New("response is valid for longer than its OCSP delegate")
+		}
+		responder = delegate
+		template.Certificate = delegate
+	}
+
+	der, err := ocsp.CreateResponse(issuer, responder, template, signer)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := ocsp.ParseResponse(der, issuer)
+	if err != nil {
+		return nil, fmt.Errorf("signed response doesn't verify: %s", err)
+	}
+	if parsed.Status != template.Status || parsed.SerialNumber.Cmp(cert.SerialNumber) != 0 {
+		return nil, errors.New("signed response doesn't match its template")
+	}
+	return der, nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/letsencrypt/boulder/test"
+)
+
+func TestSignOCSPResponse(t *testing.T) {
+	rootKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	test.AssertNotError(t, err, "Failed to generate key")
+	intKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	test.AssertNotError(t, err, "Failed to generate key")
+	tmpl := certTemplate{
+		CommonName: "Example",
+		NotBefore:  "2016-09-01T00:00:00Z",
+		NotAfter:   "2026-09-01T00:00:00Z",
+	}
+	root, err := signCertificate(kindRoot, tmpl, rootKey.Public(), nil, rootKey)
+	test.AssertNotError(t, err, "Failed to sign root")
+	intermediate, err := signCertificate(kindIntermediate, tmpl, intKey.Public(), root, rootKey)
+	test.AssertNotError(t, err, "Failed to sign intermediate")
+
+	o := ocspStep{
+		Status:           "revoked",
+		ThisUpdate:       "2017-01-01T00:00:00Z",
+		NextUpdate:       "2018-01-01T00:00:00Z",
+		RevokedAt:        "2016-12-01T00:00:00Z",
+		RevocationReason: 1,
+	}
+	der, err := signOCSPResponse(o, root, nil, intermediate, rootKey)
+	test.AssertNotError(t, err, "Failed to sign OCSP response")
+	response, err := ocsp.ParseResponse(der, root)
+	test.AssertNotError(t, err, "Failed to parse OCSP response")
+	test.AssertEquals(t, response.Status, ocsp.Revoked)
+	test.AssertEquals(t, response.RevocationReason, 1)
+
+	// Responses must be for certificates the issuer signed, and signed by the
+	// issuer's key.
+	_, err = signOCSPResponse(o, intermediate, nil, root, rootKey)
+	test.AssertError(t, err, "Signed OCSP response for another issuer's certificate")
+	_, err = signOCSPResponse(o, root, nil, intermediate, intKey)
+	test.AssertError(t, err, "Signed OCSP response with the wrong key")
+
+	// A delegate that expires before the response does is refused.
+	o.NextUpdate = "2027-01-01T00:00:00Z"
+	delegate, err := signCertificate(kindOCSPDelegate, tmpl, intKey.Public(), root, rootKey)
+	test.AssertNotError(t, err, "Failed to sign OCSP delegate")
+	_, err = signOCSPResponse(o, root, delegate, intermediate, intKey)
+	test.AssertError(t, err, "Signed OCSP response outliving its delegate")
+}
@@ -20,6 +20,7 @@ import (
 	blog "github.com/letsencrypt/boulder/log"
 	"github.com/letsencrypt/boulder/metrics"
 	"github.com/letsencrypt/boulder/policy"
+	"github.com/letsencrypt/boulder/precert"
 	"github.com/letsencrypt/boulder/sa"
 )
 
@@ -94,6 +95,7 @@ func newChecker(saDbMap certDB, clk clock.Clock, pa core.PolicyAuthority, period
 const (
 	getCertsCountQuery = "SELECT count(*) FROM certificates WHERE issued >= :issued AND expires >= :now"
 	getCertsQuery      = "SELECT * FROM certificates WHERE issued >= :issued AND expires >= :now AND serial > :lastSerial LIMIT :limit"
+	getPrecertQuery    = "SELECT der FROM precertificates WHERE serial = :serial"
 )
 
 func (c *certChecker) getCerts(unexpiredOnly bool) error {
@@ -196,9 +198,17 @@ func (c *certChecker) checkCert(cert core.Certificate) (problems []string) {
 		if parsedCert.IsCA {
 			problems = append(problems, "Certificate can sign other certificates")
 		}
-		// Check the cert has the correct validity period
+		// Check the cert has the correct validity period. Short-lived certs
+		// without OCSP may be valid for any period up to their maximum, and
+		// every other cert must have an OCSP URL.
 		validityPeriod := parsedCert.NotAfter.Sub(parsedCert.NotBefore)
-		if validityPeriod > expectedValidityPeriod {
+		if core.IsShortLived(parsedCert) {
+			if validityPeriod <= 0 {
+				problems = append(problems, "Certificate has a non-positive validity period")
+			}
+		} else if len(parsedCert.OCSPServer) == 0 {
+			problems = append(problems, fmt.Sprintf("Certificate has no OCSP URL, but a validity period longer than %s", core.MaxNoOCSPValidity))
+		} else if validityPeriod > expectedValidityPeriod {
 			problems = append(problems, fmt.Sprintf("Certificate has a validity period longer than %s", expectedValidityPeriod))
 		} else if validityPeriod < expectedValidityPeriod {
 			problems = append(problems, fmt.Sprintf("Certificate has a validity period shorter than %s", expectedValidityPeriod))
@@ -214,21 +224,63 @@ func (c *certChecker) checkCert(cert core.Certificate) (problems []string) {
 				fmt.Sprintf("Certificate has common name >64 characters long (%d)", len(parsedCert.Subject.CommonName)),
 			)
 		}
+		// Certificates for email addresses name them instead of DNS names
+		idType := core.IdentifierDNS
+		names := parsedCert.DNSNames
+		expectedEKU := []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+		if len(parsedCert.EmailAddresses) > 0 {
+			idType = core.IdentifierEmail
+			names = parsedCert.EmailAddresses
+			expectedEKU = []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection}
+		}
 		// Check that the PA is still willing to issue for each name in DNSNames + CommonName
-		for _, name := range append(parsedCert.DNSNames, parsedCert.Subject.CommonName) {
-			id := core.AcmeIdentifier{Type: core.IdentifierDNS, Value: name}
+		for _, name := range append(names, parsedCert.Subject.CommonName) {
+			id := core.AcmeIdentifier{Type: idType, Value: name}
 			if err = c.pa.WillingToIssue(id); err != nil {
 				problems = append(problems, fmt.Sprintf("Policy Authority isn't willing to issue for '%s': %s", name, err))
 			}
 		}
 		// Check the cert has the correct key usage extensions
-		if !reflect.DeepEqual(parsedCert.ExtKeyUsage, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}) {
+		if !reflect.DeepEqual(parsedCert.ExtKeyUsage, expectedEKU) {
 			problems = append(problems, "Certificate has incorrect key usage extensions")
 		}
+		// Check a cert with embedded SCTs matches the precert they were for
+		problems = append(problems, c.checkPrecertificate(cert)...)
 	}
 	return problems
 }
 
+// checkPrecertificate checks that a certificate with embedded SCTs matches the
+// stored precertificate that was submitted to CT logs for it.
+func (c *certChecker) checkPrecertificate(cert core.Certificate) (problems []string) {
+	parsedCert, err := x509.ParseCertificate(cert.DER)
+	if err != nil {
+		return nil
+	}
+	embedsSCTs := false
+	for _, ext := range parsedCert.Extensions {
+		if ext.Id.Equal(precert.OIDSCTList) {
+			embedsSCTs = true
+		}
+	}
+	if !embedsSCTs {
+		return nil
+	}
+	var precertDER []byte
+	err = c.dbMap.SelectOne(
+		&precertDER,
+		getPrecertQuery,
+		map[string]interface{}{"serial": core.SerialToString(parsedCert.SerialNumber)},
+	)
+	if err != nil {
+		return []string{fmt.Sprintf("Couldn't find precertificate: %s", err)}
+	}
+	if err = precert.Correspond(precertDER, cert.DER); err != nil {
+		return []string{fmt.Sprintf("Certificate doesn't match its precertificate: %s", err)}
+	}
+	return nil
+}
+
 type config struct {
 	CertChecker struct {
 		cmd.DBConfig
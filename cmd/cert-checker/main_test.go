@@ -9,6 +9,7 @@ import (
 	"log"
 	"math/big"
 	mrand "math/rand"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -19,6 +20,7 @@ import (
 	"github.com/letsencrypt/boulder/core"
 	blog "github.com/letsencrypt/boulder/log"
 	"github.com/letsencrypt/boulder/policy"
+	"github.com/letsencrypt/boulder/precert"
 	"github.com/letsencrypt/boulder/sa"
 	"github.com/letsencrypt/boulder/sa/satest"
 	"github.com/letsencrypt/boulder/test"
@@ -105,6 +107,7 @@ func TestCheckCert(t *testing.T) {
 		DNSNames:              []string{"example-a.com"},
 		SerialNumber:          serial,
 		BasicConstraintsValid: false,
+		OCSPServer:            []string{"http://example-a.com/ocsp"},
 	}
 	brokenCertDer, err := x509.CreateCertificate(rand.Reader, &rawCert, &rawCert, &testKey.PublicKey, testKey)
 	test.AssertNotError(t, err, "Couldn't create certificate")
@@ -171,6 +174,41 @@ func TestCheckCert(t *testing.T) {
 	cert.Issued = parsed.NotBefore
 	problems = checker.checkCert(cert)
 	test.AssertEquals(t, len(problems), 0)
+
+	// Certificates for email addresses need the email protection usage instead
+	rawCert.Subject.CommonName = "alice@example-a.com"
+	rawCert.DNSNames = nil
+	rawCert.EmailAddresses = []string{"alice@example-a.com"}
+	for _, eku := range []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageEmailProtection} {
+		rawCert.ExtKeyUsage = []x509.ExtKeyUsage{eku}
+		emailCertDer, err := x509.CreateCertificate(rand.Reader, &rawCert, &rawCert, &testKey.PublicKey, testKey)
+		test.AssertNotError(t, err, "Couldn't create certificate")
+		cert.Digest = core.Fingerprint256(emailCertDer)
+		cert.DER = emailCertDer
+		problems = checker.checkCert(cert)
+		if eku == x509.ExtKeyUsageEmailProtection {
+			test.AssertEquals(t, len(problems), 0)
+		} else {
+			test.AssertDeepEquals(t, problems, []string{"Certificate has incorrect key usage extensions"})
+		}
+	}
+	// Short-lived certificates have no OCSP URL, and a shorter validity period
+	rawCert.OCSPServer = nil
+	rawCert.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection}
+	for _, validity := range []time.Duration{core.MaxNoOCSPValidity, expectedValidityPeriod} {
+		rawCert.NotAfter = rawCert.NotBefore.Add(validity)
+		shortLivedDer, err := x509.CreateCertificate(rand.Reader, &rawCert, &rawCert, &testKey.PublicKey, testKey)
+		test.AssertNotError(t, err, "Couldn't create certificate")
+		cert.Digest = core.Fingerprint256(shortLivedDer)
+		cert.DER = shortLivedDer
+		cert.Expires = rawCert.NotAfter
+		problems = checker.checkCert(cert)
+		if validity == core.MaxNoOCSPValidity {
+			test.AssertEquals(t, len(problems), 0)
+		} else {
+			test.AssertDeepEquals(t, problems, []string{"Certificate has no OCSP URL, but a validity period longer than 168h0m0s"})
+		}
+	}
 }
 
 func TestGetAndProcessCerts(t *testing.T) {
@@ -271,6 +309,67 @@ func TestGetCertsEmptyResults(t *testing.T) {
 	test.AssertNotError(t, err, "Failed to retrieve certificates")
 }
 
+// precertDB is a certDB implementation that returns der when asked for a
+// precertificate, or an error if der is nil.
+type precertDB struct {
+	der []byte
+}
+
+func (db precertDB) SelectOne(output interface{}, _ string, _ ...interface{}) error {
+	if db.der == nil {
+		return fmt.Errorf("no rows")
+	}
+	outputPtr, _ := output.(*[]byte)
+	*outputPtr = db.der
+	return nil
+}
+
+func (db precertDB) Select(_ interface{}, _ string, _ ...interface{}) ([]interface{}, error) {
+	return nil, nil
+}
+
+func TestCheckPrecertificate(t *testing.T) {
+	testKey, _ := rsa.GenerateKey(rand.Reader, 1024)
+	rawCert := x509.Certificate{
+		Subject:      pkix.Name{CommonName: "example-a.com"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(expectedValidityPeriod),
+		DNSNames:     []string{"example-a.com"},
+		SerialNumber: big.NewInt(1337),
+	}
+	rawCert.ExtraExtensions = []pkix.Extension{precert.PoisonExtension}
+	precertDer, err := x509.CreateCertificate(rand.Reader, &rawCert, &rawCert, &testKey.PublicKey, testKey)
+	test.AssertNotError(t, err, "Couldn't create precertificate")
+	rawCert.ExtraExtensions = []pkix.Extension{{Id: precert.OIDSCTList, Value: []byte{0x04, 0x00}}}
+	certDer, err := x509.CreateCertificate(rand.Reader, &rawCert, &rawCert, &testKey.PublicKey, testKey)
+	test.AssertNotError(t, err, "Couldn't create certificate")
+	cert := core.Certificate{DER: certDer}
+
+	checker := newChecker(precertDB{der: precertDer}, clock.NewFake(), pa, expectedValidityPeriod)
+	test.AssertEquals(t, len(checker.checkPrecertificate(cert)), 0)
+
+	checker = newChecker(precertDB{}, clock.NewFake(), pa, expectedValidityPeriod)
+	problems := checker.checkPrecertificate(cert)
+	test.AssertEquals(t, len(problems), 1)
+	test.Assert(t, strings.HasPrefix(problems[0], "Couldn't find precertificate"), "Wrong problem")
+
+	// A precertificate for different names doesn't match
+	rawCert.DNSNames = []string{"example-b.com"}
+	rawCert.ExtraExtensions = []pkix.Extension{precert.PoisonExtension}
+	otherDer, err := x509.CreateCertificate(rand.Reader, &rawCert, &rawCert, &testKey.PublicKey, testKey)
+	test.AssertNotError(t, err, "Couldn't create precertificate")
+	checker = newChecker(precertDB{der: otherDer}, clock.NewFake(), pa, expectedValidityPeriod)
+	problems = checker.checkPrecertificate(cert)
+	test.AssertEquals(t, len(problems), 1)
+	test.Assert(t, strings.HasPrefix(problems[0], "Certificate doesn't match its precertificate"), "Wrong problem")
+
+	// Certificates without embedded SCTs aren't looked up at all
+	rawCert.ExtraExtensions = nil
+	plainDer, err := x509.CreateCertificate(rand.Reader, &rawCert, &rawCert, &testKey.PublicKey, testKey)
+	test.AssertNotError(t, err, "Couldn't create certificate")
+	test.AssertEquals(t, len(checker.checkPrecertificate(core.Certificate{DER: plainDer})), 0)
+}
+
 func TestSaveReport(t *testing.T) {
 	r := report{
 		begin:     time.Time{},
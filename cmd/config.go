@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"sort"
 	"strings"
 	"time"
 
@@ -64,6 +65,21 @@ func (d *DBConfig) URL() (string, error) {
 	return d.DBConnect, nil
 }
 
+// ReplicaConfig defines how to connect to a read replica of a database, and
+// when to read from the primary instead.
+type ReplicaConfig struct {
+	DBConfig
+
+	// MaxLag is how far the replica may fall behind the primary before reads
+	// are sent to the primary. Zero means the replica's lag isn't checked.
+	MaxLag ConfigDuration
+	// LagCheckPeriod is how often the replica's lag is checked.
+	LagCheckPeriod ConfigDuration
+
+	// FallbackOnError retries reads that fail on the replica on the primary.
+	FallbackOnError bool
+}
+
 type SMTPConfig struct {
 	PasswordConfig
 	Server   string
@@ -118,6 +134,9 @@ type CAConfig struct {
 
 	RSAProfile   string
 	ECDSAProfile string
+	// EmailProfile is the CFSSL profile used for certificates for email
+	// addresses. If empty, the CA doesn't issue them.
+	EmailProfile string
 	TestMode     bool
 	SerialPrefix int
 	// TODO(jsha): Remove Key field once we've migrated to Issuers
@@ -125,15 +144,34 @@ type CAConfig struct {
 	// Issuers contains configuration information for each issuer cert and key
 	// this CA knows about. The first in the list is used as the default.
 	Issuers []IssuerConfig
+	// KeyTypeIssuers maps subscriber key types ("RSA" or "ECDSA") to the
+	// common name of the issuer cert that signs certificates for them. Key
+	// types that aren't listed are signed by the default issuer.
+	KeyTypeIssuers map[string]string
+	// ProfileIssuers maps CFSSL profile names to the common name of the issuer
+	// cert that signs certificates using them. It takes precedence over
+	// KeyTypeIssuers.
+	ProfileIssuers map[string]string
 	// LifespanOCSP is how long OCSP responses are valid for; It should be longer
 	// than the minTimeToExpiry field for the OCSP Updater.
 	LifespanOCSP ConfigDuration
+	// OCSPDelegateWarning is how long before an issuer's OCSP delegate
+	// expires to warn that it needs rotating. Defaults to 30 days.
+	OCSPDelegateWarning ConfigDuration
 	// How long issued certificates are valid for, should match expiry field
 	// in cfssl config.
 	Expiry string
 	// The maximum number of subjectAltNames in a single certificate
 	MaxNames int
 	CFSSL    cfsslConfig.Config
+	// Profiles defines certificate profiles for the CA's native issuer. A
+	// profile named here is issued natively instead of through the CFSSL
+	// profile of the same name, so the two can be run side by side.
+	Profiles map[string]IssuanceProfileConfig
+	// Lint configures pre-issuance linting. If present, every certificate is
+	// first signed by a throwaway key and checked, and issuance is aborted if
+	// any enabled lint fails.
+	Lint *CALintConfig
 
 	MaxConcurrentRPCServerRequests int64
 
@@ -149,6 +187,43 @@ type CAConfig struct {
 	PublisherService *GRPCClientConfig
 }
 
+// CALintConfig configures the CA's pre-issuance linting.
+type CALintConfig struct {
+	// Names of lints not to run
+	Disabled []string
+	// The longest a certificate may be valid for. Zero means no limit.
+	MaxValidity ConfigDuration
+}
+
+// IssuanceProfileConfig describes the contents of certificates issued by the
+// CA's native issuer. Key usages are determined by the subscriber's key type.
+type IssuanceProfileConfig struct {
+	// How long certificates are valid for, counted from the time of issuance,
+	// and how far their notBefore is backdated.
+	Validity ConfigDuration
+	Backdate ConfigDuration
+	// Extended key usages: "server auth", "client auth" or "email protection"
+	ExtKeyUsages []string
+	// Certificate policy OIDs, in dotted form
+	Policies []string
+	// URLs for the authority information access and CRL distribution points
+	// extensions. OCSPURL is required unless NoOCSP is set, and the others
+	// may be empty.
+	IssuerURL string
+	OCSPURL   string
+	CRLURL    string
+	// Whether certificates may carry the Must Staple TLS Feature extension,
+	// when the CSR requests it and the CA has it enabled.
+	AllowMustStaple bool
+	// Whether certificates may carry an embedded SCT list
+	AllowSCTList bool
+	// Whether certificates are short-lived ones without OCSP. Such profiles
+	// can't have an OCSP URL or allow Must Staple, and their validity can be
+	// at most 7 days. No OCSP responses are ever signed for their
+	// certificates.
+	NoOCSP bool
+}
+
 // PAConfig specifies how a policy authority should connect to its
 // database, what policies it should enforce, and what challenges
 // it should offer.
@@ -187,6 +262,12 @@ type IssuerConfig struct {
 	File       string
 	PKCS11     *pkcs11key.Config
 	CertFile   string
+	// OCSPDelegateFile, if set, is a PEM file holding a delegated OCSP
+	// responder certificate for this issuer, followed by its private key. The
+	// delegate signs OCSP responses instead of the issuer key. The file is
+	// reloaded when it changes, so the delegate can be rotated without a
+	// restart.
+	OCSPDelegateFile string
 }
 
 // TLSConfig reprents certificates and a key for authenticated TLS.
@@ -209,8 +290,11 @@ type OCSPUpdaterConfig struct {
 	ServiceConfig
 	DBConfig
 
-	NewCertificateWindow     ConfigDuration
-	OldOCSPWindow            ConfigDuration
+	NewCertificateWindow ConfigDuration
+	OldOCSPWindow        ConfigDuration
+	// If either MissingSCTWindow or MissingSCTBatchSize is zero, certificates
+	// aren't scanned for missing SCT receipts. The Publisher's retry queue
+	// makes the scan unnecessary.
 	MissingSCTWindow         ConfigDuration
 	RevokedCertificateWindow ConfigDuration
 
@@ -233,6 +317,76 @@ type OCSPUpdaterConfig struct {
 	SignFailureBackoffMax    ConfigDuration
 
 	Publisher *GRPCClientConfig
+	// If set, certificates are checked for missing SCT receipts against the
+	// log policy the Publisher submits them under, rather than against
+	// Common.CT.Logs. It must match the Publisher's LogPolicy.
+	LogPolicy *CTLogPolicyConfig
+}
+
+// CRLUpdaterConfig provides the schedule, sharding and serving settings for
+// the CRL updater
+type CRLUpdaterConfig struct {
+	ServiceConfig
+	DBConfig
+
+	// The issuers to sign CRLs for
+	Issuers []CRLIssuerConfig
+
+	// How often to sign a new set of CRLs
+	UpdatePeriod ConfigDuration
+	// How long each CRL is valid for. This should be several times
+	// UpdatePeriod, so that a few failed updates don't leave relying parties
+	// without a current CRL.
+	CRLLifetime ConfigDuration
+
+	// The number of CRLs to split each issuer's revoked certificates across.
+	// Zero or one means a single, full CRL per issuer.
+	Shards int
+	// How to assign certificates to shards: "serial" (the default) or
+	// "expiry", in which case certificates expiring within the same
+	// ShardWidth are listed on the same CRL.
+	ShardBy    string
+	ShardWidth ConfigDuration
+
+	// How long a CRL is kept in the DB after it's signed. Zero means
+	// CRLLifetime, so that CRLs are pruned once they've expired.
+	CRLRetention ConfigDuration
+
+	// The number of old CRLs to delete from the DB at a time
+	BatchSize int
+
+	// The address to serve CRLs on, and the URL that address is reachable
+	// at. CRLs are served at BaseURL/<issuer name>/<shard>.crl
+	ListenAddress string
+	BaseURL       string
+}
+
+// CRLIssuerConfig names an issuer cert for the CRL updater
+type CRLIssuerConfig struct {
+	// Name is used in the issuer's CRL URLs
+	Name     string
+	CertFile string
+}
+
+// CTMonitorConfig provides the schedule and limits for the CT monitor, which
+// checks that the CT logs we submit to keep the promises made by their SCTs
+type CTMonitorConfig struct {
+	ServiceConfig
+
+	// How often to check each log
+	CheckPeriod ConfigDuration
+	// How long logs have to incorporate certificates into their trees after
+	// issuing SCTs for them. Defaults to 24 hours, the MMD of every log
+	// browsers currently trust.
+	MaximumMergeDelay ConfigDuration
+	// The number of SCTs to check the inclusion of, per log and check
+	BatchSize int
+	// How many checks an SCT's inclusion can fail to be checked in, for
+	// reasons other than the log's answer, before that failure is recorded
+	// as its result. Defaults to 3.
+	MaxCheckAttempts int
+	// How long to wait for each request to a log
+	Timeout ConfigDuration
 }
 
 // GoogleSafeBrowsingConfig is the JSON config struct for the VA's use of the
@@ -242,6 +396,20 @@ type GoogleSafeBrowsingConfig struct {
 	DataDir string
 }
 
+// SafeBrowsingSourceConfig configures one of several domain reputation
+// sources consulted by the VA. Exactly one of Google and Blocklist must be set.
+type SafeBrowsingSourceConfig struct {
+	// Name identifies the source in verdicts, logs and stats.
+	Name string
+	// FailClosed makes errors from this source fail the safety check, rather
+	// than the source being skipped.
+	FailClosed bool
+
+	Google *GoogleSafeBrowsingConfig
+	// Blocklist is the path to a blocklist file, or to a directory of them.
+	Blocklist string
+}
+
 // SyslogConfig defines the config for syslogging.
 type SyslogConfig struct {
 	StdoutLevel int
@@ -307,6 +475,99 @@ func (d *ConfigDuration) UnmarshalYAML(unmarshal func(interface{}) error) error
 type LogDescription struct {
 	URI string
 	Key string
+
+	// If set, the log is a temporal shard that only accepts certificates
+	// whose NotAfter is at or after NotAfterStart, and before NotAfterEnd.
+	// Either may be left unset, to leave that end of the window open.
+	NotAfterStart time.Time
+	NotAfterEnd   time.Time
+}
+
+// Covers returns whether the log accepts certificates expiring at notAfter.
+func (ld LogDescription) Covers(notAfter time.Time) bool {
+	if !ld.NotAfterStart.IsZero() && notAfter.Before(ld.NotAfterStart) {
+		return false
+	}
+	if !ld.NotAfterEnd.IsZero() && !notAfter.Before(ld.NotAfterEnd) {
+		return false
+	}
+	return true
+}
+
+type byNotAfterStart []LogDescription
+
+func (w byNotAfterStart) Len() int           { return len(w) }
+func (w byNotAfterStart) Swap(i, j int)      { w[i], w[j] = w[j], w[i] }
+func (w byNotAfterStart) Less(i, j int) bool { return w[i].NotAfterStart.Before(w[j].NotAfterStart) }
+
+// NotAfterGaps describes the ranges of NotAfter dates, from now onwards, of
+// certificates that none of logs accept, so that startup can warn about them.
+func NotAfterGaps(logs []LogDescription, now time.Time) []string {
+	if len(logs) == 0 {
+		return nil
+	}
+	windows := make(byNotAfterStart, len(logs))
+	copy(windows, logs)
+	sort.Sort(windows)
+
+	// covered is the time up to which every NotAfter is accepted by some log
+	covered := now
+	var gaps []string
+	for _, w := range windows {
+		if w.NotAfterStart.After(covered) {
+			gaps = append(gaps, fmt.Sprintf("no CT log accepts certificates expiring from %s until %s",
+				covered.Format(time.RFC3339), w.NotAfterStart.Format(time.RFC3339)))
+		}
+		if w.NotAfterEnd.IsZero() {
+			return gaps
+		}
+		if w.NotAfterEnd.After(covered) {
+			covered = w.NotAfterEnd
+		}
+	}
+	return append(gaps, fmt.Sprintf("no CT log accepts certificates expiring from %s onwards",
+		covered.Format(time.RFC3339)))
+}
+
+// CTLogPolicyConfig describes the CT logs the Publisher submits certificates
+// to, and which of them must issue SCTs for each certificate.
+type CTLogPolicyConfig struct {
+	// LogListFile is a JSON log list, in the format browsers publish theirs
+	// in, with the logs and their operators. It is reloaded when it changes.
+	LogListFile string
+	// Groups sorts the logs by operator. Each log is in the first group
+	// that matches it, and logs in no group aren't submitted to.
+	Groups []CTLogGroupConfig
+}
+
+// CTLogGroupConfig describes a group of CT logs, the logs of which are raced
+// against each other, until enough of them issue SCTs.
+type CTLogGroupConfig struct {
+	Name string
+	// Operators names the operators whose logs are in the group. If Exclude
+	// is set, the group has the logs of every other operator instead.
+	Operators []string
+	Exclude   bool
+	// MinSCTs is how many of the group's logs must issue SCTs for a
+	// certificate
+	MinSCTs int
+}
+
+// CTRetryQueueConfig configures the queue the Publisher retries failed
+// certificate submissions to CT logs from.
+type CTRetryQueueConfig struct {
+	// How often to look for submissions that are due to be retried, and how
+	// many to retry at a time
+	Period    ConfigDuration
+	BatchSize int
+	// The delay after the first failed attempt, which doubles after each
+	// further one, up to MaxBackoff
+	MinBackoff ConfigDuration
+	MaxBackoff ConfigDuration
+	// After MaxAttempts failures a submission is dead, and isn't retried
+	// until it is requeued with ct-requeue. Submissions that a log rejects
+	// die straight away.
+	MaxAttempts int
 }
 
 // GRPCClientConfig contains the information needed to talk to the gRPC service
@@ -341,3 +602,160 @@ type CAADistributedResolverConfig struct {
 	MaxFailures int
 	Proxies     []string
 }
+
+// DNSCacheConfig configures an in-process cache of DNS responses.
+type DNSCacheConfig struct {
+	// The maximum number of responses to hold in the cache.
+	MaxEntries int
+	// The longest a response will be cached for, regardless of its TTL.
+	MaxTTL ConfigDuration
+}
+
+// DNSUpstreamConfig describes an upstream DNS resolver and the transport used
+// to reach it.
+type DNSUpstreamConfig struct {
+	// Address is a host:port for the "tcp", "udp" and "tls" transports, and
+	// an https:// URL for the "https" transport.
+	Address string
+	// Transport is one of "tcp" (the default), "udp", "tls" (DNS over TLS) or
+	// "https" (DNS over HTTPS).
+	Transport string
+	// ServerName overrides the name used to verify the upstream's
+	// certificate.
+	ServerName string
+	// CACertFile, if set, is a PEM file of roots to trust for the upstream
+	// instead of the system roots.
+	CACertFile string
+	// PinnedSPKIHashes are base64 SHA-256 hashes of SubjectPublicKeyInfos,
+	// one of which must appear in the upstream's certificate chain.
+	PinnedSPKIHashes []string
+}
+
+// DNSServerHealthConfig configures tracking of upstream DNS server health so
+// that queries are steered away from failing or slow servers.
+type DNSServerHealthConfig struct {
+	// ErrorRateThreshold is the moving average fraction of failed exchanges
+	// (0 to 1) above which a server is avoided.
+	ErrorRateThreshold float64
+	// MaxLatency, if set, is the moving average latency above which a server
+	// is avoided.
+	MaxLatency ConfigDuration
+	// ProbeInterval is how often an avoided server is probed for recovery.
+	ProbeInterval ConfigDuration
+}
+
+// ValidationRetryConfig configures the retrying of validations that fail with
+// transient network errors such as timeouts, SERVFAILs and refused
+// connections.
+type ValidationRetryConfig struct {
+	// MaxAttempts is the total number of attempts, including the first.
+	MaxAttempts int
+	// Backoff is the delay before the first retry. Each later retry waits
+	// twice as long as the one before, up to MaxBackoff.
+	Backoff    ConfigDuration
+	MaxBackoff ConfigDuration
+}
+
+// HTTPValidationConfig configures redirect following and response handling
+// for http-01 validation. Zero values keep the defaults.
+type HTTPValidationConfig struct {
+	// MaxRedirects is the number of requests, counting the initial one, that
+	// a validation may make; a redirect that would need another request fails
+	// validation.
+	MaxRedirects int
+	// RedirectPorts and RedirectSchemes, if not empty, restrict the ports and
+	// URL schemes that redirects may target.
+	RedirectPorts   []int
+	RedirectSchemes []string
+	// RejectIPRedirects refuses redirects to IP address literals, and
+	// RejectReservedRedirects refuses redirects to hosts that resolve to
+	// private or reserved addresses.
+	RejectIPRedirects       bool
+	RejectReservedRedirects bool
+	// MaxBodySize is the size in bytes at which a challenge response is
+	// rejected.
+	MaxBodySize int64
+	// Whitespace is "trailing" (the default), "both" or "none", and selects
+	// the whitespace stripped from challenge responses.
+	Whitespace string
+}
+
+// EmailReplyConfig configures the sending of challenge emails and the
+// receiving of replies for email-reply-00 validation.
+type EmailReplyConfig struct {
+	SMTPConfig
+	// From is the address challenge emails are sent from. Replies to it must
+	// be relayed to ListenAddress, where they're received over SMTP.
+	From          string
+	ListenAddress string
+	// Hostname is the name the reply listener gives in its SMTP greeting.
+	Hostname string
+	// SecretFile contains the key used to derive the part of the token that
+	// is only sent by email.
+	SecretFile string
+	// Timeout is how long to wait for a reply.
+	Timeout ConfigDuration
+	// If set, replies must carry an Authentication-Results header from this
+	// authserv-id showing a valid DKIM signature from the address's domain.
+	AuthServID string
+}
+
+// VAConfig configures the Validation Authority. It is shared by boulder-va
+// and validation-debugger, so that the latter validates exactly as the VA
+// does.
+type VAConfig struct {
+	ServiceConfig
+
+	UserAgent string
+
+	IssuerDomain string
+
+	PortConfig PortConfig
+
+	MaxConcurrentRPCServerRequests int64
+
+	// If set, AAAA records are looked up too, and validation connects to
+	// IPv6 addresses first, falling back to IPv4 if that fails.
+	LookupIPv6 bool
+
+	GoogleSafeBrowsing *GoogleSafeBrowsingConfig
+
+	// If present, these domain reputation sources are consulted instead of
+	// GoogleSafeBrowsing alone.
+	SafeBrowsingSources []SafeBrowsingSourceConfig
+
+	CAAService *GRPCClientConfig
+
+	CAADistributedResolver *CAADistributedResolverConfig
+
+	// The number of times to try a DNS query (that has a temporary error)
+	// before giving up. May be short-circuited by deadlines. A zero value
+	// will be turned into 1.
+	DNSTries int
+
+	// Feature flag to enable enforcement of CAA SERVFAILs.
+	CAASERVFAILExceptions string
+
+	// If present, DNS responses other than those for DNS-01 challenges are
+	// cached in-process.
+	DNSCache *DNSCacheConfig
+
+	// If present, these upstream resolvers are used instead of
+	// Common.DNSResolver.
+	DNSUpstreams []DNSUpstreamConfig
+
+	// If present, queries are steered away from DNS servers that are
+	// failing or slow.
+	DNSServerHealth *DNSServerHealthConfig
+
+	// If present, validations that fail with transient network errors are
+	// retried.
+	ValidationRetries *ValidationRetryConfig
+
+	// If present, controls how http-01 validation follows redirects and
+	// reads challenge responses.
+	HTTPValidation *HTTPValidationConfig
+
+	// If present, email-reply-00 challenges are supported.
+	EmailReply *EmailReplyConfig
+}
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"testing"
+	"time"
 
 	"github.com/letsencrypt/boulder/test"
 )
@@ -47,3 +48,35 @@ func TestPasswordConfig(t *testing.T) {
 		test.AssertEquals(t, password, tc.expected)
 	}
 }
+
+func TestNotAfterWindows(t *testing.T) {
+	year := func(y int) time.Time { return time.Date(y, 1, 1, 0, 0, 0, 0, time.UTC) }
+	shard2017 := LogDescription{NotAfterStart: year(2017), NotAfterEnd: year(2018)}
+	test.Assert(t, shard2017.Covers(year(2017)), "Shard doesn't cover the start of its window")
+	test.Assert(t, !shard2017.Covers(year(2018)), "Shard covers the end of its window")
+	test.Assert(t, !shard2017.Covers(year(2016)), "Shard covers a time before its window")
+	test.Assert(t, LogDescription{}.Covers(year(2016)), "Unsharded log doesn't cover everything")
+
+	now := year(2016).Add(time.Hour)
+	tests := []struct {
+		logs []LogDescription
+		gaps int
+	}{
+		{logs: nil, gaps: 0},
+		{logs: []LogDescription{{}}, gaps: 0},
+		// Contiguous shards, ending with an open one
+		{logs: []LogDescription{{NotAfterStart: year(2018)}, shard2017, {NotAfterEnd: year(2017)}}, gaps: 0},
+		// Shards that start in the future, and end
+		{logs: []LogDescription{shard2017}, gaps: 2},
+		// A missing year between shards
+		{logs: []LogDescription{{NotAfterEnd: year(2017)}, {NotAfterStart: year(2018)}}, gaps: 1},
+		// Overlapping shards
+		{logs: []LogDescription{{NotAfterEnd: year(2018)}, shard2017}, gaps: 1},
+	}
+	for i, tc := range tests {
+		gaps := NotAfterGaps(tc.logs, now)
+		if len(gaps) != tc.gaps {
+			t.Errorf("case %d: expected %d gaps, got %q", i, tc.gaps, gaps)
+		}
+	}
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"bytes"
+	"crypto/x509"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cactus/go-statsd-client/statsd"
+	"github.com/jmhodges/clock"
+	"golang.org/x/net/context"
+
+	"github.com/letsencrypt/boulder/cmd"
+	"github.com/letsencrypt/boulder/core"
+	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/metrics"
+	"github.com/letsencrypt/boulder/rpc"
+	"github.com/letsencrypt/boulder/sa"
+)
+
+const clientName = "CRLUpdater"
+
+// crlDB is an interface collecting the gorp.DbMap functions that the CRL
+// updater relies on, so that tests can swap out the dbMap implementation.
+type crlDB interface {
+	SelectOne(holder interface{}, query string, args ...interface{}) error
+	Insert(list ...interface{}) error
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// issuer is an issuer cert that CRLs are signed for, along with the name used
+// for it in CRL URLs.
+type issuer struct {
+	name string
+	cert *x509.Certificate
+}
+
+// crlUpdater periodically has the CA sign a full set of CRLs for each issuer,
+// stores them, prunes old ones, and serves the most recent ones over HTTP.
+type crlUpdater struct {
+	dbMap crlDB
+	cac   core.CertificateAuthority
+	clk   clock.Clock
+	log   blog.Logger
+	stats statsd.Statter
+
+	issuers []issuer
+
+	updatePeriod time.Duration
+	lifetime     time.Duration
+	retention    time.Duration
+	sharding     core.CRLSharding
+	batchSize    int
+	baseURL      string
+}
+
+func newUpdater(
+	c cmd.CRLUpdaterConfig,
+	dbMap crlDB,
+	cac core.CertificateAuthority,
+	issuers []issuer,
+	clk clock.Clock,
+	stats statsd.Statter,
+	log blog.Logger,
+) (*crlUpdater, error) {
+	if len(issuers) == 0 {
+		return nil, errors.New("at least one issuer must be configured")
+	}
+	if c.UpdatePeriod.Duration <= 0 {
+		return nil, errors.New("updatePeriod must be positive")
+	}
+	if c.CRLLifetime.Duration <= c.UpdatePeriod.Duration {
+		return nil, errors.New("crlLifetime must be longer than updatePeriod")
+	}
+	if c.BatchSize <= 0 {
+		return nil, errors.New("batchSize must be positive")
+	}
+	retention := c.CRLRetention.Duration
+	if retention < 0 {
+		return nil, errors.New("crlRetention must not be negative")
+	}
+	if retention == 0 {
+		retention = c.CRLLifetime.Duration
+	}
+	shards := c.Shards
+	if shards < 1 {
+		shards = 1
+	}
+	shardBy := c.ShardBy
+	switch shardBy {
+	case "", "serial":
+		shardBy = "serial"
+	case "expiry":
+		if c.ShardWidth.Duration < time.Second {
+			return nil, errors.New("shardWidth must be at least a second when sharding by expiry")
+		}
+	default:
+		return nil, fmt.Errorf("unknown shardBy %q", c.ShardBy)
+	}
+	return &crlUpdater{
+		dbMap:        dbMap,
+		cac:          cac,
+		clk:          clk,
+		log:          log,
+		stats:        stats,
+		issuers:      issuers,
+		updatePeriod: c.UpdatePeriod.Duration,
+		lifetime:     c.CRLLifetime.Duration,
+		retention:    retention,
+		sharding: core.CRLSharding{
+			Shards: shards,
+			By:     shardBy,
+			Width:  c.ShardWidth.Duration,
+		},
+		batchSize: c.BatchSize,
+		baseURL:   strings.TrimRight(c.BaseURL, "/"),
+	}, nil
+}
+
+// crlURL returns the URL the given issuer's shard is served from.
+func (u *crlUpdater) crlURL(iss issuer, shard int) string {
+	return fmt.Sprintf("%s/%s/%d.crl", u.baseURL, iss.name, shard)
+}
+
+// updateCRLs has the CA sign a new CRL for each shard of each issuer, which
+// it does from the revoked certificates it reads from the SA, and stores
+// them. Every CRL is requested at once, so the CA reads the revoked
+// certificates once per update rather than once per CRL. Once every CRL is
+// stored it prunes those that are past retention.
+func (u *crlUpdater) updateCRLs(ctx context.Context) error {
+	thisUpdate := u.clk.Now()
+	var reqs []core.CRLSigningRequest
+	for _, iss := range u.issuers {
+		for shard := 0; shard < u.sharding.Shards; shard++ {
+			req := core.CRLSigningRequest{
+				IssuerCommonName: iss.cert.Subject.CommonName,
+				// Using the time as the CRL number keeps it increasing without
+				// any coordination between updaters.
+				Number:     thisUpdate.UnixNano(),
+				ThisUpdate: thisUpdate,
+				NextUpdate: thisUpdate.Add(u.lifetime),
+				Sharding:   u.sharding,
+				Shard:      shard,
+			}
+			if u.sharding.Shards > 1 {
+				req.IssuingDistributionPoint = u.crlURL(iss, shard)
+			}
+			reqs = append(reqs, req)
+		}
+	}
+	crls, err := u.cac.GenerateCRLs(ctx, reqs)
+	if err != nil {
+		return fmt.Errorf("failed to sign CRLs: %s", err)
+	}
+	for i, req := range reqs {
+		err = u.dbMap.Insert(&core.CRL{
+			Issuer:     req.IssuerCommonName,
+			Shard:      req.Shard,
+			Number:     req.Number,
+			ThisUpdate: req.ThisUpdate,
+			NextUpdate: req.NextUpdate,
+			CRL:        crls[i],
+		})
+		if err != nil {
+			return fmt.Errorf("failed to store CRL %d for %q: %s", req.Shard, req.IssuerCommonName, err)
+		}
+		u.stats.Inc("CRLUpdater.CRLsStored", 1, 1.0)
+	}
+	return u.pruneCRLs(thisUpdate)
+}
+
+// pruneCRLs deletes the stored CRLs signed more than u.retention before now,
+// u.batchSize at a time. The CRL number is the time the CRL was signed, so
+// this can use the index on issuer, shard and number. The CRLs just signed
+// are never old enough to be pruned, so every shard keeps a CRL to serve.
+func (u *crlUpdater) pruneCRLs(now time.Time) error {
+	cutoff := now.Add(-u.retention).UnixNano()
+	for _, iss := range u.issuers {
+		for shard := 0; shard < u.sharding.Shards; shard++ {
+			for {
+				result, err := u.dbMap.Exec(
+					`DELETE FROM crls
+					 WHERE issuer = ? AND shard = ? AND number < ?
+					 LIMIT ?`,
+					iss.cert.Subject.CommonName,
+					shard,
+					cutoff,
+					u.batchSize,
+				)
+				if err != nil {
+					return fmt.Errorf("failed to prune CRLs for shard %d of %q: %s", shard, iss.name, err)
+				}
+				pruned, err := result.RowsAffected()
+				if err != nil {
+					return err
+				}
+				u.stats.Inc("CRLUpdater.CRLsPruned", pruned, 1.0)
+				if pruned < int64(u.batchSize) {
+					break
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// loop updates the CRLs every updatePeriod, forever.
+func (u *crlUpdater) loop() {
+	for {
+		start := u.clk.Now()
+		err := u.updateCRLs(context.Background())
+		if err != nil {
+			u.log.AuditErr(fmt.Sprintf("Failed to update CRLs: %s", err))
+			u.stats.Inc("CRLUpdater.UpdateFailures", 1, 1.0)
+		} else {
+			u.stats.TimingDuration("CRLUpdater.UpdateLatency", u.clk.Now().Sub(start), 1.0)
+		}
+		u.clk.Sleep(u.updatePeriod - u.clk.Now().Sub(start))
+	}
+}
+
+// ServeHTTP serves the most recent CRL for the issuer and shard named by the
+// request path, /<issuer name>/<shard>.crl.
+func (u *crlUpdater) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if len(parts) != 2 || !strings.HasSuffix(parts[1], ".crl") {
+		http.NotFound(w, r)
+		return
+	}
+	shard, err := strconv.Atoi(strings.TrimSuffix(parts[1], ".crl"))
+	if err != nil || shard < 0 || shard >= u.sharding.Shards {
+		http.NotFound(w, r)
+		return
+	}
+	var iss *issuer
+	for i := range u.issuers {
+		if u.issuers[i].name == parts[0] {
+			iss = &u.issuers[i]
+		}
+	}
+	if iss == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	var crl core.CRL
+	err = u.dbMap.SelectOne(
+		&crl,
+		`SELECT * FROM crls
+		 WHERE issuer = :issuer AND shard = :shard
+		 ORDER BY number DESC
+		 LIMIT 1`,
+		map[string]interface{}{
+			"issuer": iss.cert.Subject.CommonName,
+			"shard":  shard,
+		},
+	)
+	if err == sql.ErrNoRows {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		u.log.AuditErr(fmt.Sprintf("Failed to look up CRL %d for %q: %s", shard, iss.name, err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// A newer CRL should be available one update period after this one was
+	// signed, so caches shouldn't hold on to it for longer than that, even
+	// though it remains valid until its nextUpdate.
+	maxAge := crl.ThisUpdate.Add(u.updatePeriod).Sub(u.clk.Now())
+	if maxAge < 0 {
+		maxAge = 0
+	}
+	w.Header().Set("Content-Type", "application/pkix-crl")
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(maxAge/time.Second)))
+	w.Header().Set("Expires", u.clk.Now().Add(maxAge).UTC().Format(http.TimeFormat))
+	w.Header().Set("ETag", fmt.Sprintf(`"%x"`, crl.Number))
+	http.ServeContent(w, r, "", crl.ThisUpdate, bytes.NewReader(crl.CRL))
+	u.stats.Inc("CRLUpdater.CRLsServed", 1, 1.0)
+}
+
+type config struct {
+	CRLUpdater cmd.CRLUpdaterConfig
+
+	Statsd cmd.StatsdConfig
+
+	Syslog cmd.SyslogConfig
+}
+
+func main() {
+	configFile := flag.String("config", "", "File path to the configuration file for this service")
+	flag.Parse()
+	if *configFile == "" {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	var c config
+	err := cmd.ReadJSONFile(*configFile, &c)
+	cmd.FailOnError(err, "Reading JSON config file into config structure")
+
+	conf := c.CRLUpdater
+
+	go cmd.DebugServer(conf.DebugAddr)
+
+	stats, auditlogger := cmd.StatsAndLogging(c.Statsd, c.Syslog)
+	defer auditlogger.AuditPanic()
+	auditlogger.Info(cmd.VersionString(clientName))
+
+	go cmd.ProfileCmd("CRL-Updater", stats)
+
+	var issuers []issuer
+	for _, ic := range conf.Issuers {
+		cert, err := core.LoadCert(ic.CertFile)
+		cmd.FailOnError(err, fmt.Sprintf("Couldn't load issuer cert %q", ic.CertFile))
+		issuers = append(issuers, issuer{name: ic.Name, cert: cert})
+	}
+
+	dbURL, err := conf.DBConfig.URL()
+	cmd.FailOnError(err, "Couldn't load DB URL")
+	dbMap, err := sa.NewDbMap(dbURL, conf.DBConfig.MaxDBConns)
+	cmd.FailOnError(err, "Could not connect to database")
+	err = sa.CheckSchemaVersions(dbMap, sa.SchemaVersions)
+	cmd.FailOnError(err, "Database hasn't been migrated")
+	go sa.ReportDbConnCount(dbMap, metrics.NewStatsdScope(stats, "CRLUpdater"))
+
+	cac, err := rpc.NewCertificateAuthorityClient(clientName, conf.AMQP, stats)
+	cmd.FailOnError(err, "Unable to create CA client")
+
+	updater, err := newUpdater(conf, dbMap, cac, issuers, clock.Default(), stats, auditlogger)
+	cmd.FailOnError(err, "Failed to create updater")
+
+	go updater.loop()
+
+	auditlogger.Info(fmt.Sprintf("Serving CRLs on %s", conf.ListenAddress))
+	err = http.ListenAndServe(conf.ListenAddress, updater)
+	cmd.FailOnError(err, "Error running HTTP server")
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"database/sql"
+	"database/sql/driver"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jmhodges/clock"
+	"golang.org/x/net/context"
+
+	"github.com/letsencrypt/boulder/cmd"
+	"github.com/letsencrypt/boulder/core"
+	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/mocks"
+	"github.com/letsencrypt/boulder/test"
+	oldx509 "github.com/letsencrypt/go/src/crypto/x509"
+)
+
+var ctx = context.Background()
+
+type mockCA struct {
+	calls    int
+	requests []core.CRLSigningRequest
+}
+
+func (ca *mockCA) IssueCertificate(_ context.Context, _ oldx509.CertificateRequest, _ int64) (core.Certificate, error) {
+	return core.Certificate{}, nil
+}
+
+func (ca *mockCA) IssuePrecertificate(_ context.Context, _ oldx509.CertificateRequest, _ int64) (core.Certificate, error) {
+	return core.Certificate{}, nil
+}
+
+func (ca *mockCA) IssueCertificateForPrecertificate(_ context.Context, _ []byte, _ [][]byte, _ int64) (core.Certificate, error) {
+	return core.Certificate{}, nil
+}
+
+func (ca *mockCA) GenerateOCSP(_ context.Context, _ core.OCSPSigningRequest) ([]byte, error) {
+	return nil, nil
+}
+
+func (ca *mockCA) GenerateCRLs(_ context.Context, reqs []core.CRLSigningRequest) ([][]byte, error) {
+	ca.calls++
+	ca.requests = append(ca.requests, reqs...)
+	crls := make([][]byte, len(reqs))
+	for i := range crls {
+		crls[i] = []byte{1, 2, 3}
+	}
+	return crls, nil
+}
+
+// mockDB keeps inserted CRLs in memory, and prunes them by number.
+type mockDB struct {
+	crls    []core.CRL
+	deletes int
+}
+
+func (db *mockDB) SelectOne(holder interface{}, query string, args ...interface{}) error {
+	params := args[0].(map[string]interface{})
+	var found *core.CRL
+	for i, crl := range db.crls {
+		if crl.Issuer == params["issuer"] && crl.Shard == params["shard"] {
+			found = &db.crls[i]
+		}
+	}
+	if found == nil {
+		return sql.ErrNoRows
+	}
+	*holder.(*core.CRL) = *found
+	return nil
+}
+
+func (db *mockDB) Insert(list ...interface{}) error {
+	for _, i := range list {
+		db.crls = append(db.crls, *i.(*core.CRL))
+	}
+	return nil
+}
+
+func (db *mockDB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	db.deletes++
+	issuer, shard, cutoff, limit := args[0].(string), args[1].(int), args[2].(int64), args[3].(int)
+	var kept []core.CRL
+	pruned := 0
+	for _, crl := range db.crls {
+		if crl.Issuer == issuer && crl.Shard == shard && crl.Number < cutoff && pruned < limit {
+			pruned++
+			continue
+		}
+		kept = append(kept, crl)
+	}
+	db.crls = kept
+	return driver.RowsAffected(pruned), nil
+}
+
+func makeIssuer(t *testing.T, cn string) (issuer, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	test.AssertNotError(t, err, "Failed to generate issuer key")
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: cn},
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	test.AssertNotError(t, err, "Failed to create issuer cert")
+	cert, err := x509.ParseCertificate(der)
+	test.AssertNotError(t, err, "Failed to parse issuer cert")
+	return issuer{name: cn, cert: cert}, key
+}
+
+func testConfig() cmd.CRLUpdaterConfig {
+	return cmd.CRLUpdaterConfig{
+		UpdatePeriod: cmd.ConfigDuration{Duration: time.Hour},
+		CRLLifetime:  cmd.ConfigDuration{Duration: 24 * time.Hour},
+		BatchSize:    2,
+		BaseURL:      "http://crl.example.com/",
+	}
+}
+
+func TestNewUpdater(t *testing.T) {
+	iss, _ := makeIssuer(t, "issuer")
+	issuers := []issuer{iss}
+	stats := mocks.NewStatter()
+
+	c := testConfig()
+	_, err := newUpdater(c, &mockDB{}, &mockCA{}, nil, clock.NewFake(), stats, blog.NewMock())
+	test.AssertError(t, err, "Created updater without issuers")
+
+	c = testConfig()
+	c.CRLLifetime = c.UpdatePeriod
+	_, err = newUpdater(c, &mockDB{}, &mockCA{}, issuers, clock.NewFake(), stats, blog.NewMock())
+	test.AssertError(t, err, "Created updater with CRLs that expire before they're replaced")
+
+	c = testConfig()
+	c.ShardBy = "color"
+	_, err = newUpdater(c, &mockDB{}, &mockCA{}, issuers, clock.NewFake(), stats, blog.NewMock())
+	test.AssertError(t, err, "Created updater with unknown shardBy")
+
+	c = testConfig()
+	c.ShardBy = "expiry"
+	_, err = newUpdater(c, &mockDB{}, &mockCA{}, issuers, clock.NewFake(), stats, blog.NewMock())
+	test.AssertError(t, err, "Created updater sharding by expiry without shardWidth")
+}
+
+func TestUpdateCRLs(t *testing.T) {
+	iss, _ := makeIssuer(t, "issuer")
+	fc := clock.NewFake()
+	fc.Add(time.Hour)
+	db := &mockDB{}
+	ca := &mockCA{}
+	stats := mocks.NewStatter()
+	c := testConfig()
+	c.Shards = 2
+	u, err := newUpdater(c, db, ca, []issuer{iss}, fc, stats, blog.NewMock())
+	test.AssertNotError(t, err, "Failed to create updater")
+
+	err = u.updateCRLs(ctx)
+	test.AssertNotError(t, err, "Failed to update CRLs")
+
+	// Every CRL is requested at once, so the CA reads revoked certificates
+	// once.
+	test.AssertEquals(t, ca.calls, 1)
+	test.AssertEquals(t, len(ca.requests), 2)
+	for i, req := range ca.requests {
+		test.AssertEquals(t, req.IssuerCommonName, "issuer")
+		test.AssertEquals(t, req.Number, fc.Now().UnixNano())
+		test.AssertEquals(t, req.NextUpdate, fc.Now().Add(24*time.Hour))
+		test.AssertEquals(t, req.Sharding, core.CRLSharding{Shards: 2, By: "serial"})
+		test.AssertEquals(t, req.Shard, i)
+	}
+	test.AssertEquals(t, ca.requests[0].IssuingDistributionPoint, "http://crl.example.com/issuer/0.crl")
+	test.AssertEquals(t, ca.requests[1].IssuingDistributionPoint, "http://crl.example.com/issuer/1.crl")
+
+	test.AssertEquals(t, len(db.crls), 2)
+	test.AssertEquals(t, db.crls[1].Issuer, "issuer")
+	test.AssertEquals(t, db.crls[1].Shard, 1)
+	test.AssertByteEquals(t, db.crls[1].CRL, []byte{1, 2, 3})
+	test.AssertEquals(t, stats.Counters["CRLUpdater.CRLsStored"], int64(2))
+}
+
+func TestPruneCRLs(t *testing.T) {
+	iss, _ := makeIssuer(t, "issuer")
+	fc := clock.NewFake()
+	fc.Add(48 * time.Hour)
+	db := &mockDB{}
+	stats := mocks.NewStatter()
+	c := testConfig()
+	u, err := newUpdater(c, db, &mockCA{}, []issuer{iss}, fc, stats, blog.NewMock())
+	test.AssertNotError(t, err, "Failed to create updater")
+	// Without a retention, CRLs are kept until they expire
+	test.AssertEquals(t, u.retention, 24*time.Hour)
+
+	// Three CRLs signed before the retention period, one at its start and one
+	// within it.
+	for _, age := range []time.Duration{27, 26, 25, 24, 1} {
+		signed := fc.Now().Add(-age * time.Hour)
+		db.crls = append(db.crls, core.CRL{Issuer: "issuer", Number: signed.UnixNano(), ThisUpdate: signed})
+	}
+
+	err = u.pruneCRLs(fc.Now())
+	test.AssertNotError(t, err, "Failed to prune CRLs")
+	// A full batch of two, then the last one
+	test.AssertEquals(t, db.deletes, 2)
+	test.AssertEquals(t, stats.Counters["CRLUpdater.CRLsPruned"], int64(3))
+	test.AssertEquals(t, len(db.crls), 2)
+	test.AssertEquals(t, db.crls[0].ThisUpdate, fc.Now().Add(-24*time.Hour))
+
+	c.CRLRetention = cmd.ConfigDuration{Duration: -time.Hour}
+	_, err = newUpdater(c, db, &mockCA{}, []issuer{iss}, fc, stats, blog.NewMock())
+	test.AssertError(t, err, "Created updater with negative retention")
+}
+
+func TestServeHTTP(t *testing.T) {
+	iss, _ := makeIssuer(t, "issuer")
+	fc := clock.NewFake()
+	fc.Add(time.Hour)
+	db := &mockDB{
+		crls: []core.CRL{{
+			Issuer:     "issuer",
+			Shard:      0,
+			Number:     10,
+			ThisUpdate: fc.Now().Add(-15 * time.Minute),
+			NextUpdate: fc.Now().Add(24 * time.Hour),
+			CRL:        []byte{1, 2, 3},
+		}},
+	}
+	c := testConfig()
+	c.Shards = 2
+	u, err := newUpdater(c, db, &mockCA{}, []issuer{iss}, fc, mocks.NewStatter(), blog.NewMock())
+	test.AssertNotError(t, err, "Failed to create updater")
+
+	get := func(path string, header http.Header) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("GET", "http://crl.example.com"+path, nil)
+		test.AssertNotError(t, err, "Failed to create request")
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		rw := httptest.NewRecorder()
+		u.ServeHTTP(rw, req)
+		return rw
+	}
+
+	rw := get("/issuer/0.crl", nil)
+	test.AssertEquals(t, rw.Code, http.StatusOK)
+	test.AssertByteEquals(t, rw.Body.Bytes(), []byte{1, 2, 3})
+	test.AssertEquals(t, rw.Header().Get("Content-Type"), "application/pkix-crl")
+	test.AssertEquals(t, rw.Header().Get("Cache-Control"), "public, max-age=2700")
+	test.AssertEquals(t, rw.Header().Get("Last-Modified"), db.crls[0].ThisUpdate.UTC().Format(http.TimeFormat))
+	test.AssertEquals(t, rw.Header().Get("ETag"), `"a"`)
+
+	rw = get("/issuer/0.crl", http.Header{"If-None-Match": {`"a"`}})
+	test.AssertEquals(t, rw.Code, http.StatusNotModified)
+
+	// Shard 1 hasn't been generated yet, and there's no shard 2.
+	for _, path := range []string{"/issuer/1.crl", "/issuer/2.crl", "/other/0.crl", "/issuer/0", "/issuer"} {
+		rw = get(path, nil)
+		test.AssertEquals(t, rw.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,518 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cactus/go-statsd-client/statsd"
+	ct "github.com/google/certificate-transparency/go"
+	ctClient "github.com/google/certificate-transparency/go/client"
+	"github.com/jmhodges/clock"
+	"golang.org/x/net/context"
+	"golang.org/x/net/context/ctxhttp"
+
+	"github.com/letsencrypt/boulder/cmd"
+	"github.com/letsencrypt/boulder/core"
+	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/merkle"
+	"github.com/letsencrypt/boulder/precert"
+	"github.com/letsencrypt/boulder/rpc"
+)
+
+const clientName = "CTMonitor"
+
+// ctLog is a CT log that is monitored, along with the ID its SCTs are stored
+// under.
+type ctLog struct {
+	uri      string
+	logID    string
+	client   *ctClient.LogClient
+	verifier *ct.SignatureVerifier
+}
+
+func newLog(ld cmd.LogDescription, hc *http.Client) (*ctLog, error) {
+	uri := strings.TrimRight(ld.URI, "/")
+	der, err := base64.StdEncoding.DecodeString(ld.Key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode public key of log %s: %s", uri, err)
+	}
+	pk, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key of log %s: %s", uri, err)
+	}
+	verifier, err := ct.NewSignatureVerifier(pk)
+	if err != nil {
+		return nil, err
+	}
+	// A log's ID is the hash of its public key (RFC 6962, Section 3.2)
+	logID := sha256.Sum256(der)
+	return &ctLog{
+		uri:      uri,
+		logID:    base64.StdEncoding.EncodeToString(logID[:]),
+		client:   ctClient.New(uri, hc),
+		verifier: verifier,
+	}, nil
+}
+
+// errNotFound is returned by getJSON when the log answers that it doesn't
+// have what was asked for.
+type errNotFound string
+
+func (e errNotFound) Error() string {
+	return string(e)
+}
+
+// getJSON makes a GET request to one of the log's RFC 6962 methods, and
+// decodes its JSON response into v.
+func (l *ctLog) getJSON(ctx context.Context, hc *http.Client, method string, params url.Values, v interface{}) error {
+	resp, err := ctxhttp.Get(ctx, hc, fmt.Sprintf("%s/ct/v1/%s?%s", l.uri, method, params.Encode()))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	switch {
+	case resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusNotFound:
+		return errNotFound(fmt.Sprintf("%s returned %d: %s", method, resp.StatusCode, body))
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("%s returned %d: %s", method, resp.StatusCode, body)
+	}
+	return json.Unmarshal(body, v)
+}
+
+// decodeHashes decodes the base64 encoded Merkle tree nodes of a proof
+func decodeHashes(encoded []string) ([]merkle.Hash, error) {
+	hashes := make([]merkle.Hash, len(encoded))
+	for i, e := range encoded {
+		b, err := base64.StdEncoding.DecodeString(e)
+		if err != nil {
+			return nil, err
+		}
+		if len(b) != len(hashes[i]) {
+			return nil, fmt.Errorf("proof node %d is %d bytes long", i, len(b))
+		}
+		copy(hashes[i][:], b)
+	}
+	return hashes, nil
+}
+
+// consistencyProof fetches the proof that the log's tree of size second
+// extends its tree of size first.
+func (l *ctLog) consistencyProof(ctx context.Context, hc *http.Client, first, second uint64) ([]merkle.Hash, error) {
+	var resp struct {
+		Consistency []string `json:"consistency"`
+	}
+	err := l.getJSON(ctx, hc, "get-sth-consistency", url.Values{
+		"first":  {fmt.Sprintf("%d", first)},
+		"second": {fmt.Sprintf("%d", second)},
+	}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return decodeHashes(resp.Consistency)
+}
+
+// inclusionProof fetches the index of the leaf with leafHash in the log's
+// tree of treeSize, and the audit path proving it's there.
+func (l *ctLog) inclusionProof(ctx context.Context, hc *http.Client, leafHash merkle.Hash, treeSize uint64) (uint64, []merkle.Hash, error) {
+	var resp struct {
+		LeafIndex uint64   `json:"leaf_index"`
+		AuditPath []string `json:"audit_path"`
+	}
+	err := l.getJSON(ctx, hc, "get-proof-by-hash", url.Values{
+		"hash":      {base64.StdEncoding.EncodeToString(leafHash[:])},
+		"tree_size": {fmt.Sprintf("%d", treeSize)},
+	}, &resp)
+	if err != nil {
+		return 0, nil, err
+	}
+	path, err := decodeHashes(resp.AuditPath)
+	return resp.LeafIndex, path, err
+}
+
+// monitor periodically checks that each log's tree heads are consistent
+// with each other, and that the logs include the certificates they issued
+// SCTs for within their maximum merge delay.
+type monitor struct {
+	sa    core.StorageAuthority
+	clk   clock.Clock
+	log   blog.Logger
+	stats statsd.Statter
+	hc    *http.Client
+
+	logs []*ctLog
+	// The issuers of our certificates, needed to work out the log entries of
+	// precertificates
+	issuers []*x509.Certificate
+
+	checkPeriod      time.Duration
+	mmd              time.Duration
+	batchSize        int
+	maxCheckAttempts int
+	// checkFailures counts the checks in a row that each SCT, by log ID and
+	// serial, couldn't be checked in
+	checkFailures map[string]int
+}
+
+func newMonitor(
+	c cmd.CTMonitorConfig,
+	logs []cmd.LogDescription,
+	issuers []*x509.Certificate,
+	sac core.StorageAuthority,
+	clk clock.Clock,
+	stats statsd.Statter,
+	log blog.Logger,
+) (*monitor, error) {
+	if c.CheckPeriod.Duration <= 0 {
+		return nil, errors.New("checkPeriod must be positive")
+	}
+	if c.BatchSize <= 0 {
+		return nil, errors.New("batchSize must be positive")
+	}
+	mmd := c.MaximumMergeDelay.Duration
+	if mmd == 0 {
+		mmd = 24 * time.Hour
+	}
+	timeout := c.Timeout.Duration
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+	maxCheckAttempts := c.MaxCheckAttempts
+	if maxCheckAttempts <= 0 {
+		maxCheckAttempts = 3
+	}
+	m := &monitor{
+		sa:               sac,
+		clk:              clk,
+		log:              log,
+		stats:            stats,
+		hc:               &http.Client{Timeout: timeout},
+		issuers:          issuers,
+		checkPeriod:      c.CheckPeriod.Duration,
+		mmd:              mmd,
+		batchSize:        c.BatchSize,
+		maxCheckAttempts: maxCheckAttempts,
+		checkFailures:    make(map[string]int),
+	}
+	for _, ld := range logs {
+		l, err := newLog(ld, m.hc)
+		if err != nil {
+			return nil, err
+		}
+		m.logs = append(m.logs, l)
+	}
+	return m, nil
+}
+
+// violation reports that a log broke its promises
+func (m *monitor) violation(l *ctLog, msg string) error {
+	err := fmt.Errorf("CT log %s misbehaved: %s", l.uri, msg)
+	// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+	m.log.AuditErr(err.Error())
+	m.stats.Inc("CTMonitor.Violations", 1, 1.0)
+	return err
+}
+
+// updateSTH fetches the log's current STH, checks that it's consistent with
+// the latest one stored, and stores it if it's newer. It returns the latest
+// verified STH, to check inclusions against.
+func (m *monitor) updateSTH(ctx context.Context, l *ctLog) (core.SignedTreeHead, error) {
+	fetched, err := l.client.GetSTH()
+	if err != nil {
+		return core.SignedTreeHead{}, fmt.Errorf("failed to fetch STH: %s", err)
+	}
+	err = l.verifier.VerifySTHSignature(*fetched)
+	if err != nil {
+		return core.SignedTreeHead{}, m.violation(l, fmt.Sprintf("STH for tree size %d has a bad signature: %s", fetched.TreeSize, err))
+	}
+	sig, err := ct.MarshalDigitallySigned(fetched.TreeHeadSignature)
+	if err != nil {
+		return core.SignedTreeHead{}, err
+	}
+	sth := core.SignedTreeHead{
+		LogID:     l.logID,
+		TreeSize:  fetched.TreeSize,
+		Timestamp: fetched.Timestamp,
+		RootHash:  fetched.SHA256RootHash[:],
+		Signature: sig,
+	}
+
+	prev, err := m.sa.GetLatestSTH(ctx, l.logID)
+	if _, ok := err.(core.NotFoundError); ok {
+		return sth, m.sa.AddSTH(ctx, sth)
+	} else if err != nil {
+		return core.SignedTreeHead{}, err
+	}
+
+	// Logs may serve an older STH than the one we stored, from a frontend
+	// that hasn't caught up yet, but it still has to be consistent with it.
+	older, newer := prev, sth
+	if sth.TreeSize < prev.TreeSize {
+		older, newer = sth, prev
+	}
+	var olderRoot, newerRoot merkle.Hash
+	copy(olderRoot[:], older.RootHash)
+	copy(newerRoot[:], newer.RootHash)
+	var proof []merkle.Hash
+	if older.TreeSize != newer.TreeSize {
+		proof, err = l.consistencyProof(ctx, m.hc, older.TreeSize, newer.TreeSize)
+		if _, ok := err.(errNotFound); ok {
+			return core.SignedTreeHead{}, m.violation(l, fmt.Sprintf("no consistency proof between tree sizes %d and %d: %s", older.TreeSize, newer.TreeSize, err))
+		} else if err != nil {
+			return core.SignedTreeHead{}, fmt.Errorf("failed to fetch consistency proof: %s", err)
+		}
+	}
+	err = merkle.VerifyConsistency(older.TreeSize, newer.TreeSize, olderRoot, newerRoot, proof)
+	if err != nil {
+		return core.SignedTreeHead{}, m.violation(l, fmt.Sprintf("STHs for tree sizes %d and %d are inconsistent: %s", older.TreeSize, newer.TreeSize, err))
+	}
+	switch {
+	case sth.TreeSize > prev.TreeSize:
+		return sth, m.sa.AddSTH(ctx, sth)
+	case sth.TreeSize == prev.TreeSize:
+		// The log hasn't grown, so there's no need to store another STH, but
+		// this one's later timestamp holds it to more of its SCTs.
+		return sth, nil
+	}
+	return prev, nil
+}
+
+// leafHash works out the Merkle tree leaf the log must have added for sct.
+// The SCT may have been issued for the certificate, or for its
+// precertificate, and only the one it was issued for matches its signature.
+// A precertificate's final certificate may never have been issued, if the RA
+// gave up on it, and then the SCT is checked against the precertificate
+// alone.
+func (m *monitor) leafHash(ctx context.Context, l *ctLog, sct core.SignedCertificateTimestamp) (merkle.Hash, error) {
+	isPrecert := false
+	cert, err := m.sa.GetCertificate(ctx, sct.CertificateSerial)
+	if _, ok := err.(core.NotFoundError); ok {
+		cert, err = m.sa.GetPrecertificate(ctx, sct.CertificateSerial)
+		isPrecert = true
+	}
+	if err != nil {
+		return merkle.Hash{}, err
+	}
+	parsed, err := x509.ParseCertificate(cert.DER)
+	if err != nil {
+		return merkle.Hash{}, err
+	}
+	sig, err := ct.UnmarshalDigitallySigned(bytes.NewReader(sct.Signature))
+	if err != nil {
+		return merkle.Hash{}, err
+	}
+	ctSCT := ct.SignedCertificateTimestamp{
+		SCTVersion: ct.Version(sct.SCTVersion),
+		Timestamp:  sct.Timestamp,
+		Extensions: sct.Extensions,
+		Signature:  *sig,
+	}
+
+	// The precertificate's entry is its TBSCertificate without the poison
+	// extension, which is the certificate's without the embedded SCTs, along
+	// with the hash of its issuer's key.
+	var entries []ct.TimestampedEntry
+	var tbs []byte
+	if isPrecert {
+		tbs, err = precert.TBSWithout(cert.DER, precert.OIDPoison)
+	} else {
+		entries = append(entries, ct.TimestampedEntry{
+			EntryType: ct.X509LogEntryType,
+			X509Entry: ct.ASN1Cert(cert.DER),
+		})
+		tbs, err = precert.TBSWithout(cert.DER, precert.OIDSCTList)
+	}
+	if err != nil {
+		return merkle.Hash{}, err
+	}
+	for _, issuer := range m.issuers {
+		if parsed.CheckSignatureFrom(issuer) == nil {
+			entries = append(entries, ct.TimestampedEntry{
+				EntryType: ct.PrecertLogEntryType,
+				PrecertEntry: ct.PreCert{
+					IssuerKeyHash:  sha256.Sum256(issuer.RawSubjectPublicKeyInfo),
+					TBSCertificate: tbs,
+				},
+			})
+		}
+	}
+	for _, entry := range entries {
+		entry.Extensions = sct.Extensions
+		logEntry := ct.LogEntry{Leaf: ct.MerkleTreeLeaf{
+			LeafType:         ct.TimestampedEntryLeafType,
+			TimestampedEntry: entry,
+		}}
+		if l.verifier.VerifySCTSignature(ctSCT, logEntry) != nil {
+			continue
+		}
+		// A v1 MerkleTreeLeaf is serialized exactly as the input to the SCT's
+		// signature is, since both its version and leaf type are zero, as are
+		// the SCT's version and signature type.
+		leaf, err := ct.SerializeSCTSignatureInput(ctSCT, logEntry)
+		if err != nil {
+			return merkle.Hash{}, err
+		}
+		return merkle.LeafHash(leaf), nil
+	}
+	return merkle.Hash{}, errors.New("SCT's signature matches neither the certificate nor its precertificate")
+}
+
+// checkInclusions checks that the log's tree of sth includes the
+// certificates of the SCTs it issued at least an MMD before sth was signed,
+// and records the results.
+func (m *monitor) checkInclusions(ctx context.Context, l *ctLog, sth core.SignedTreeHead) error {
+	signed := time.Unix(0, int64(sth.Timestamp)*int64(time.Millisecond))
+	receipts, err := m.sa.GetUncheckedSCTReceipts(ctx, l.logID, signed.Add(-m.mmd), m.batchSize)
+	if err != nil {
+		return fmt.Errorf("failed to get SCT receipts: %s", err)
+	}
+	for _, sct := range receipts {
+		inclusion, err := m.checkInclusion(ctx, l, sth, sct)
+		failureKey := l.logID + " " + sct.CertificateSerial
+		if err != nil {
+			// Failures that aren't the log's answer are retried in later
+			// checks, until there have been too many, so that an SCT that can
+			// never be checked doesn't hold up the ones after it.
+			m.checkFailures[failureKey]++
+			attempts := m.checkFailures[failureKey]
+			m.log.Warning(fmt.Sprintf("Couldn't check inclusion of serial %s in CT log %s (attempt %d of %d): %s",
+				sct.CertificateSerial, l.uri, attempts, m.maxCheckAttempts, err))
+			m.stats.Inc("CTMonitor.CheckFailures", 1, 1.0)
+			if attempts < m.maxCheckAttempts {
+				continue
+			}
+			inclusion.Problem = fmt.Sprintf("couldn't check inclusion in %d attempts: %s", attempts, err)
+		}
+		delete(m.checkFailures, failureKey)
+		err = m.sa.AddSCTInclusion(ctx, inclusion)
+		if err != nil {
+			return fmt.Errorf("failed to store inclusion result: %s", err)
+		}
+	}
+	return nil
+}
+
+// checkInclusion checks that the log's tree of sth includes the certificate
+// of sct. It returns an error only if the inclusion couldn't be checked, and
+// otherwise the result, which has a Problem if the log misbehaved.
+func (m *monitor) checkInclusion(ctx context.Context, l *ctLog, sth core.SignedTreeHead, sct core.SignedCertificateTimestamp) (core.SCTInclusion, error) {
+	inclusion := core.SCTInclusion{
+		CertificateSerial: sct.CertificateSerial,
+		LogID:             l.logID,
+		TreeSize:          sth.TreeSize,
+		Checked:           m.clk.Now(),
+	}
+	leafHash, err := m.leafHash(ctx, l, sct)
+	if err != nil {
+		return inclusion, fmt.Errorf("failed to find CT log entry: %s", err)
+	}
+	index, path, err := l.inclusionProof(ctx, m.hc, leafHash, sth.TreeSize)
+	if _, ok := err.(errNotFound); ok {
+		inclusion.Problem = m.violation(l, fmt.Sprintf("serial %s not included in tree of size %d within MMD: %s",
+			sct.CertificateSerial, sth.TreeSize, err)).Error()
+		return inclusion, nil
+	} else if err != nil {
+		return inclusion, fmt.Errorf("failed to fetch inclusion proof: %s", err)
+	}
+	var root merkle.Hash
+	copy(root[:], sth.RootHash)
+	if err = merkle.VerifyInclusion(leafHash, index, sth.TreeSize, path, root); err != nil {
+		inclusion.Problem = m.violation(l, fmt.Sprintf("bad inclusion proof for serial %s in tree of size %d: %s",
+			sct.CertificateSerial, sth.TreeSize, err)).Error()
+		return inclusion, nil
+	}
+	inclusion.Included = true
+	inclusion.LeafIndex = index
+	m.stats.Inc("CTMonitor.Inclusions", 1, 1.0)
+	return inclusion, nil
+}
+
+// checkLog checks the log's latest STH, and the inclusion of the SCTs it
+// issued in it.
+func (m *monitor) checkLog(ctx context.Context, l *ctLog) error {
+	sth, err := m.updateSTH(ctx, l)
+	if err != nil {
+		return err
+	}
+	return m.checkInclusions(ctx, l, sth)
+}
+
+// loop checks every log each checkPeriod, forever.
+func (m *monitor) loop() {
+	for {
+		start := m.clk.Now()
+		for _, l := range m.logs {
+			err := m.checkLog(context.Background(), l)
+			if err != nil {
+				m.log.Warning(fmt.Sprintf("Failed to check CT log %s: %s", l.uri, err))
+				m.stats.Inc("CTMonitor.CheckFailures", 1, 1.0)
+			}
+		}
+		m.stats.TimingDuration("CTMonitor.CheckLatency", m.clk.Now().Sub(start), 1.0)
+		m.clk.Sleep(m.checkPeriod - m.clk.Now().Sub(start))
+	}
+}
+
+type config struct {
+	CTMonitor cmd.CTMonitorConfig
+
+	Statsd cmd.StatsdConfig
+
+	Syslog cmd.SyslogConfig
+
+	Common struct {
+		CT struct {
+			Logs                       []cmd.LogDescription
+			IntermediateBundleFilename string
+		}
+	}
+}
+
+func main() {
+	configFile := flag.String("config", "", "File path to the configuration file for this service")
+	flag.Parse()
+	if *configFile == "" {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	var c config
+	err := cmd.ReadJSONFile(*configFile, &c)
+	cmd.FailOnError(err, "Reading JSON config file into config structure")
+
+	conf := c.CTMonitor
+
+	go cmd.DebugServer(conf.DebugAddr)
+
+	stats, auditlogger := cmd.StatsAndLogging(c.Statsd, c.Syslog)
+	defer auditlogger.AuditPanic()
+	auditlogger.Info(cmd.VersionString(clientName))
+
+	go cmd.ProfileCmd("CT-Monitor", stats)
+
+	issuers, err := core.LoadCertBundle(c.Common.CT.IntermediateBundleFilename)
+	cmd.FailOnError(err, "Failed to load CT submission bundle")
+
+	sac, err := rpc.NewStorageAuthorityClient(clientName, conf.AMQP, stats)
+	cmd.FailOnError(err, "Unable to create SA client")
+
+	m, err := newMonitor(conf, c.Common.CT.Logs, issuers, sac, clock.Default(), stats, auditlogger)
+	cmd.FailOnError(err, "Failed to create monitor")
+
+	m.loop()
+}
@@ -0,0 +1,459 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cactus/go-statsd-client/statsd"
+	ct "github.com/google/certificate-transparency/go"
+	"github.com/jmhodges/clock"
+	"golang.org/x/net/context"
+
+	"github.com/letsencrypt/boulder/cmd"
+	"github.com/letsencrypt/boulder/core"
+	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/merkle"
+	"github.com/letsencrypt/boulder/mocks"
+	"github.com/letsencrypt/boulder/precert"
+	"github.com/letsencrypt/boulder/test"
+)
+
+var ctx = context.Background()
+
+// fakeLog is a CT log backed by an in-memory Merkle tree. It serves STHs for
+// the tree as it was when publish was last called.
+type fakeLog struct {
+	t    *testing.T
+	clk  clock.FakeClock
+	key  *ecdsa.PrivateKey
+	tree merkle.Tree
+
+	size uint64
+	// forked makes the log serve a root that doesn't match its entries
+	forked bool
+}
+
+func newFakeLog(t *testing.T, clk clock.FakeClock) (*fakeLog, *httptest.Server, cmd.LogDescription) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	test.AssertNotError(t, err, "Failed to generate log key")
+	fl := &fakeLog{t: t, clk: clk, key: key}
+	srv := httptest.NewServer(fl)
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	test.AssertNotError(t, err, "Failed to marshal log key")
+	return fl, srv, cmd.LogDescription{URI: srv.URL, Key: base64.StdEncoding.EncodeToString(der)}
+}
+
+func (fl *fakeLog) sign(data []byte) ct.DigitallySigned {
+	hashed := sha256.Sum256(data)
+	var sig struct {
+		R, S *big.Int
+	}
+	var err error
+	sig.R, sig.S, err = ecdsa.Sign(rand.Reader, fl.key, hashed[:])
+	test.AssertNotError(fl.t, err, "Failed to sign")
+	der, err := asn1.Marshal(sig)
+	test.AssertNotError(fl.t, err, "Failed to marshal signature")
+	return ct.DigitallySigned{
+		HashAlgorithm:      ct.SHA256,
+		SignatureAlgorithm: ct.ECDSA,
+		Signature:          der,
+	}
+}
+
+// submit returns a receipt for entry, and adds it to the tree if merge is
+// set.
+func (fl *fakeLog) submit(serial string, entry ct.TimestampedEntry, merge bool) core.SignedCertificateTimestamp {
+	sct := ct.SignedCertificateTimestamp{
+		SCTVersion: ct.V1,
+		Timestamp:  uint64(fl.clk.Now().UnixNano() / int64(time.Millisecond)),
+	}
+	input, err := ct.SerializeSCTSignatureInput(sct, ct.LogEntry{Leaf: ct.MerkleTreeLeaf{
+		LeafType:         ct.TimestampedEntryLeafType,
+		TimestampedEntry: entry,
+	}})
+	test.AssertNotError(fl.t, err, "Failed to serialize SCT signature input")
+	sig, err := ct.MarshalDigitallySigned(fl.sign(input))
+	test.AssertNotError(fl.t, err, "Failed to marshal SCT signature")
+	if merge {
+		fl.tree.Append(input)
+	}
+	der, _ := x509.MarshalPKIXPublicKey(&fl.key.PublicKey)
+	logID := sha256.Sum256(der)
+	return core.SignedCertificateTimestamp{
+		SCTVersion:        uint8(ct.V1),
+		LogID:             base64.StdEncoding.EncodeToString(logID[:]),
+		Timestamp:         sct.Timestamp,
+		Signature:         sig,
+		CertificateSerial: serial,
+	}
+}
+
+// publish makes the log serve STHs for its current tree
+func (fl *fakeLog) publish() {
+	fl.size = fl.tree.Size()
+}
+
+func (fl *fakeLog) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var resp interface{}
+	params := r.URL.Query()
+	switch r.URL.Path {
+	case "/ct/v1/get-sth":
+		root := fl.tree.Root(fl.size)
+		if fl.forked {
+			root[0] ^= 1
+		}
+		sth := ct.SignedTreeHead{
+			Version:        ct.V1,
+			TreeSize:       fl.size,
+			Timestamp:      uint64(fl.clk.Now().UnixNano() / int64(time.Millisecond)),
+			SHA256RootHash: ct.SHA256Hash(root),
+		}
+		input, err := ct.SerializeSTHSignatureInput(sth)
+		test.AssertNotError(fl.t, err, "Failed to serialize STH signature input")
+		sig, err := fl.sign(input).Base64String()
+		test.AssertNotError(fl.t, err, "Failed to encode STH signature")
+		resp = map[string]interface{}{
+			"tree_size":           sth.TreeSize,
+			"timestamp":           sth.Timestamp,
+			"sha256_root_hash":    sth.SHA256RootHash.Base64String(),
+			"tree_head_signature": sig,
+		}
+	case "/ct/v1/get-sth-consistency":
+		first, _ := strconv.ParseUint(params.Get("first"), 10, 64)
+		second, _ := strconv.ParseUint(params.Get("second"), 10, 64)
+		resp = map[string]interface{}{"consistency": encode(fl.tree.ConsistencyProof(first, second))}
+	case "/ct/v1/get-proof-by-hash":
+		b, _ := base64.StdEncoding.DecodeString(params.Get("hash"))
+		var leafHash merkle.Hash
+		copy(leafHash[:], b)
+		size, _ := strconv.ParseUint(params.Get("tree_size"), 10, 64)
+		index, ok := fl.tree.Index(leafHash)
+		if !ok || index >= size {
+			http.Error(w, "no such leaf", http.StatusBadRequest)
+			return
+		}
+		resp = map[string]interface{}{
+			"leaf_index": index,
+			"audit_path": encode(fl.tree.InclusionProof(index, size)),
+		}
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	body, _ := json.Marshal(resp)
+	w.Write(body)
+}
+
+func encode(hashes []merkle.Hash) []string {
+	encoded := make([]string, len(hashes))
+	for i, h := range hashes {
+		encoded[i] = base64.StdEncoding.EncodeToString(h[:])
+	}
+	return encoded
+}
+
+// fakeSA keeps the certificates, receipts, inclusions and STHs the monitor
+// uses in memory.
+type fakeSA struct {
+	*mocks.StorageAuthority
+	certs      map[string]core.Certificate
+	precerts   map[string]core.Certificate
+	receipts   []core.SignedCertificateTimestamp
+	inclusions []core.SCTInclusion
+	sths       []core.SignedTreeHead
+}
+
+func (sa *fakeSA) GetCertificate(_ context.Context, serial string) (core.Certificate, error) {
+	cert, ok := sa.certs[serial]
+	if !ok {
+		return core.Certificate{}, core.NotFoundError("no certificate")
+	}
+	return cert, nil
+}
+
+func (sa *fakeSA) GetPrecertificate(_ context.Context, serial string) (core.Certificate, error) {
+	precert, ok := sa.precerts[serial]
+	if !ok {
+		return core.Certificate{}, core.NotFoundError("no precertificate")
+	}
+	return precert, nil
+}
+
+func (sa *fakeSA) GetUncheckedSCTReceipts(_ context.Context, logID string, issuedBefore time.Time, limit int) ([]core.SignedCertificateTimestamp, error) {
+	var unchecked []core.SignedCertificateTimestamp
+receipts:
+	for _, r := range sa.receipts {
+		if r.LogID != logID || r.Timestamp >= uint64(issuedBefore.UnixNano()/int64(time.Millisecond)) {
+			continue
+		}
+		for _, i := range sa.inclusions {
+			if i.LogID == logID && i.CertificateSerial == r.CertificateSerial {
+				continue receipts
+			}
+		}
+		if len(unchecked) < limit {
+			unchecked = append(unchecked, r)
+		}
+	}
+	return unchecked, nil
+}
+
+func (sa *fakeSA) AddSCTInclusion(_ context.Context, inclusion core.SCTInclusion) error {
+	sa.inclusions = append(sa.inclusions, inclusion)
+	return nil
+}
+
+func (sa *fakeSA) GetLatestSTH(_ context.Context, logID string) (core.SignedTreeHead, error) {
+	var latest *core.SignedTreeHead
+	for i, sth := range sa.sths {
+		if sth.LogID == logID && (latest == nil || sth.TreeSize >= latest.TreeSize) {
+			latest = &sa.sths[i]
+		}
+	}
+	if latest == nil {
+		return core.SignedTreeHead{}, core.NotFoundError("no STH")
+	}
+	return *latest, nil
+}
+
+func (sa *fakeSA) AddSTH(_ context.Context, sth core.SignedTreeHead) error {
+	sa.sths = append(sa.sths, sth)
+	return nil
+}
+
+func setup(t *testing.T) (*monitor, *fakeLog, *fakeSA, *blog.Mock, clock.FakeClock, func()) {
+	clk := clock.NewFake()
+	clk.Set(time.Date(2016, 9, 5, 12, 0, 0, 0, time.UTC))
+	fl, srv, ld := newFakeLog(t, clk)
+	sa := &fakeSA{StorageAuthority: mocks.NewStorageAuthority(clk), certs: make(map[string]core.Certificate), precerts: make(map[string]core.Certificate)}
+	log := blog.NewMock()
+	stats, _ := statsd.NewNoopClient(nil)
+	m, err := newMonitor(cmd.CTMonitorConfig{
+		CheckPeriod: cmd.ConfigDuration{Duration: time.Hour},
+		BatchSize:   10,
+	}, []cmd.LogDescription{ld}, nil, sa, clk, stats, log)
+	test.AssertNotError(t, err, "Failed to create monitor")
+	return m, fl, sa, log, clk, srv.Close
+}
+
+func TestUpdateSTH(t *testing.T) {
+	m, fl, sa, log, _, cleanup := setup(t)
+	defer cleanup()
+	l := m.logs[0]
+
+	// The first STH is stored as it is
+	fl.tree.Append([]byte{0})
+	fl.publish()
+	sth, err := m.updateSTH(ctx, l)
+	test.AssertNotError(t, err, "Failed to update STH")
+	test.AssertEquals(t, sth.TreeSize, uint64(1))
+	test.AssertEquals(t, len(sa.sths), 1)
+
+	// A larger consistent tree replaces it
+	for i := byte(1); i < 7; i++ {
+		fl.tree.Append([]byte{i})
+	}
+	fl.publish()
+	sth, err = m.updateSTH(ctx, l)
+	test.AssertNotError(t, err, "Failed to update STH")
+	test.AssertEquals(t, sth.TreeSize, uint64(7))
+	test.AssertEquals(t, len(sa.sths), 2)
+
+	// An older consistent tree doesn't
+	fl.size = 3
+	sth, err = m.updateSTH(ctx, l)
+	test.AssertNotError(t, err, "Failed to update STH")
+	test.AssertEquals(t, sth.TreeSize, uint64(7))
+	test.AssertEquals(t, len(sa.sths), 2)
+	test.AssertEquals(t, len(log.GetAllMatching("misbehaved")), 0)
+
+	// Neither does a tree that doesn't extend the stored one
+	fl.tree.Append([]byte{7})
+	fl.publish()
+	fl.forked = true
+	_, err = m.updateSTH(ctx, l)
+	test.AssertError(t, err, "Inconsistent STH was accepted")
+	test.AssertEquals(t, len(sa.sths), 2)
+	test.AssertEquals(t, len(log.GetAllMatching("misbehaved")), 1)
+
+	// Nor a different tree of the same size
+	fl.size = 7
+	_, err = m.updateSTH(ctx, l)
+	test.AssertError(t, err, "Forked STH was accepted")
+	test.AssertEquals(t, len(sa.sths), 2)
+	test.AssertEquals(t, len(log.GetAllMatching("misbehaved")), 2)
+}
+
+func TestCheckInclusions(t *testing.T) {
+	m, fl, sa, log, clk, cleanup := setup(t)
+	defer cleanup()
+
+	issuerKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	test.AssertNotError(t, err, "Failed to generate issuer key")
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "issuer"},
+		NotBefore:             clk.Now(),
+		NotAfter:              clk.Now().Add(time.Hour),
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &issuerKey.PublicKey, issuerKey)
+	test.AssertNotError(t, err, "Failed to create issuer")
+	issuer, err := x509.ParseCertificate(der)
+	test.AssertNotError(t, err, "Failed to parse issuer")
+	m.issuers = []*x509.Certificate{issuer}
+
+	var serials []string
+	for i := 2; i < 5; i++ {
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(int64(i)),
+			Subject:      pkix.Name{CommonName: "example.com"},
+			NotBefore:    clk.Now(),
+			NotAfter:     clk.Now().Add(time.Hour),
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, issuer, &issuerKey.PublicKey, issuerKey)
+		test.AssertNotError(t, err, "Failed to create certificate")
+		serial := core.SerialToString(template.SerialNumber)
+		sa.certs[serial] = core.Certificate{Serial: serial, DER: der}
+		serials = append(serials, serial)
+	}
+
+	// A precertificate whose certificate was never issued
+	precertTemplate := &x509.Certificate{
+		SerialNumber:    big.NewInt(5),
+		Subject:         pkix.Name{CommonName: "example.com"},
+		NotBefore:       clk.Now(),
+		NotAfter:        clk.Now().Add(time.Hour),
+		ExtraExtensions: []pkix.Extension{precert.PoisonExtension},
+	}
+	der, err = x509.CreateCertificate(rand.Reader, precertTemplate, issuer, &issuerKey.PublicKey, issuerKey)
+	test.AssertNotError(t, err, "Failed to create precertificate")
+	serial := core.SerialToString(precertTemplate.SerialNumber)
+	sa.precerts[serial] = core.Certificate{Serial: serial, DER: der}
+	serials = append(serials, serial)
+
+	tbs, err := precert.TBSWithout(sa.certs[serials[1]].DER, precert.OIDSCTList)
+	test.AssertNotError(t, err, "Failed to get TBSCertificate")
+	precertTBS, err := precert.TBSWithout(der, precert.OIDPoison)
+	test.AssertNotError(t, err, "Failed to get precertificate TBSCertificate")
+	sa.receipts = []core.SignedCertificateTimestamp{
+		// The certificate itself was logged
+		fl.submit(serials[0], ct.TimestampedEntry{
+			EntryType: ct.X509LogEntryType,
+			X509Entry: ct.ASN1Cert(sa.certs[serials[0]].DER),
+		}, true),
+		// Its precertificate was logged
+		fl.submit(serials[1], ct.TimestampedEntry{
+			EntryType: ct.PrecertLogEntryType,
+			PrecertEntry: ct.PreCert{
+				IssuerKeyHash:  sha256.Sum256(issuer.RawSubjectPublicKeyInfo),
+				TBSCertificate: tbs,
+			},
+		}, true),
+		// The log issued an SCT, but never merged the certificate
+		fl.submit(serials[2], ct.TimestampedEntry{
+			EntryType: ct.X509LogEntryType,
+			X509Entry: ct.ASN1Cert(sa.certs[serials[2]].DER),
+		}, false),
+		// Only the precertificate exists, and was logged
+		fl.submit(serials[3], ct.TimestampedEntry{
+			EntryType: ct.PrecertLogEntryType,
+			PrecertEntry: ct.PreCert{
+				IssuerKeyHash:  sha256.Sum256(issuer.RawSubjectPublicKeyInfo),
+				TBSCertificate: precertTBS,
+			},
+		}, true),
+	}
+	fl.publish()
+
+	// Nothing is checked before the MMD has passed
+	err = m.checkLog(ctx, m.logs[0])
+	test.AssertNotError(t, err, "Failed to check log")
+	test.AssertEquals(t, len(sa.inclusions), 0)
+
+	clk.Add(25 * time.Hour)
+	err = m.checkLog(ctx, m.logs[0])
+	test.AssertNotError(t, err, "Failed to check log")
+	test.AssertEquals(t, len(sa.inclusions), 4)
+	for i, inclusion := range sa.inclusions {
+		test.AssertEquals(t, inclusion.CertificateSerial, serials[i])
+		test.AssertEquals(t, inclusion.TreeSize, uint64(3))
+	}
+	test.Assert(t, sa.inclusions[0].Included, "Certificate wasn't included")
+	test.AssertEquals(t, sa.inclusions[0].LeafIndex, uint64(0))
+	test.Assert(t, sa.inclusions[1].Included, "Precertificate wasn't included")
+	test.AssertEquals(t, sa.inclusions[1].LeafIndex, uint64(1))
+	test.Assert(t, !sa.inclusions[2].Included, "Unmerged certificate was included")
+	test.Assert(t, sa.inclusions[2].Problem != "", "Unmerged certificate has no problem")
+	test.Assert(t, sa.inclusions[3].Included, "Precertificate without a certificate wasn't included")
+	test.AssertEquals(t, sa.inclusions[3].LeafIndex, uint64(2))
+	test.AssertEquals(t, len(log.GetAllMatching("misbehaved")), 1)
+
+	// Checked receipts aren't checked again
+	err = m.checkLog(ctx, m.logs[0])
+	test.AssertNotError(t, err, "Failed to check log")
+	test.AssertEquals(t, len(sa.inclusions), 4)
+}
+
+func TestCheckInclusionFailures(t *testing.T) {
+	m, fl, sa, log, clk, cleanup := setup(t)
+	defer cleanup()
+	m.batchSize = 1
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	test.AssertNotError(t, err, "Failed to generate key")
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		NotBefore:    clk.Now(),
+		NotAfter:     clk.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	test.AssertNotError(t, err, "Failed to create certificate")
+	serial := core.SerialToString(template.SerialNumber)
+	sa.certs[serial] = core.Certificate{Serial: serial, DER: der}
+	entry := ct.TimestampedEntry{EntryType: ct.X509LogEntryType, X509Entry: ct.ASN1Cert(der)}
+	sa.receipts = []core.SignedCertificateTimestamp{
+		// The SA has no certificate for this receipt, so its log entry can't
+		// be worked out.
+		fl.submit("000000000000000000000000000000000001", entry, false),
+		fl.submit(serial, entry, true),
+	}
+	fl.publish()
+	clk.Add(25 * time.Hour)
+
+	// The receipt that can't be checked is retried, holding up the next one
+	// until it's been tried maxCheckAttempts times.
+	for i := 1; i < m.maxCheckAttempts; i++ {
+		err = m.checkLog(ctx, m.logs[0])
+		test.AssertNotError(t, err, "Failed to check log")
+		test.AssertEquals(t, len(sa.inclusions), 0)
+	}
+	err = m.checkLog(ctx, m.logs[0])
+	test.AssertNotError(t, err, "Failed to check log")
+	test.AssertEquals(t, len(sa.inclusions), 1)
+	test.Assert(t, !sa.inclusions[0].Included, "Receipt that couldn't be checked was included")
+	test.Assert(t, strings.HasPrefix(sa.inclusions[0].Problem, "couldn't check inclusion"), "Wrong problem")
+	test.AssertEquals(t, len(m.checkFailures), 0)
+	test.AssertEquals(t, len(log.GetAllMatching("misbehaved")), 0)
+
+	err = m.checkLog(ctx, m.logs[0])
+	test.AssertNotError(t, err, "Failed to check log")
+	test.AssertEquals(t, len(sa.inclusions), 2)
+	test.Assert(t, sa.inclusions[1].Included, "Certificate wasn't included")
+}
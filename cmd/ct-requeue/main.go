@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"golang.org/x/net/context"
+
+	"github.com/letsencrypt/boulder/cmd"
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/rpc"
+)
+
+var usageString = `
+name:
+  ct-requeue - Inspects the Publisher's queue of failed CT log submissions, and requeues dead ones
+
+usage:
+  ct-requeue count --config <path>
+  ct-requeue requeue --config <path> [--serial <serial>] [--log-id <log-id>]
+
+command descriptions:
+  count      Prints the number of queued submissions in each status
+  requeue    Makes dead submissions pending again, so the Publisher retries them from
+             scratch. Without --serial or --log-id, every dead submission is requeued.
+`
+
+type config struct {
+	AMQP   cmd.AMQPConfig
+	Statsd cmd.StatsdConfig
+	Syslog cmd.SyslogConfig
+}
+
+type submissionQueue interface {
+	CountCTSubmissions(ctx context.Context) (map[core.CTSubmissionStatus]int64, error)
+	RequeueCTSubmissions(ctx context.Context, serial, logID string) (int64, error)
+}
+
+func printCounts(ctx context.Context, q submissionQueue, w io.Writer) error {
+	counts, err := q.CountCTSubmissions(ctx)
+	if err != nil {
+		return err
+	}
+	for _, status := range []core.CTSubmissionStatus{core.CTSubmissionPending, core.CTSubmissionDead} {
+		fmt.Fprintf(w, "%s: %d\n", status, counts[status])
+	}
+	return nil
+}
+
+func requeue(ctx context.Context, q submissionQueue, serial, logID string, w io.Writer) error {
+	requeued, err := q.RequeueCTSubmissions(ctx, serial, logID)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Requeued %d dead submissions\n", requeued)
+	return nil
+}
+
+func setup(configFile string) *rpc.StorageAuthorityClient {
+	configJSON, err := ioutil.ReadFile(configFile)
+	cmd.FailOnError(err, "Failed to read config file")
+	var conf config
+	err = json.Unmarshal(configJSON, &conf)
+	cmd.FailOnError(err, "Failed to parse config file")
+	stats, _ := cmd.StatsAndLogging(conf.Statsd, conf.Syslog)
+	sa, err := rpc.NewStorageAuthorityClient("ct-requeue", &conf.AMQP, stats)
+	cmd.FailOnError(err, "Failed to create SA client")
+	return sa
+}
+
+func main() {
+	if len(os.Args) <= 2 {
+		fmt.Fprint(os.Stderr, usageString)
+		os.Exit(1)
+	}
+
+	command := os.Args[1]
+	flagSet := flag.NewFlagSet(command, flag.ContinueOnError)
+	configFile := flagSet.String("config", "", "File path to the configuration file for this service")
+	serial := flagSet.String("serial", "", "Only requeue submissions of the certificate with this hex serial")
+	logID := flagSet.String("log-id", "", "Only requeue submissions to the log with this base64 encoded ID")
+	err := flagSet.Parse(os.Args[2:])
+	cmd.FailOnError(err, "Error parsing flagset")
+
+	usage := func() {
+		fmt.Fprintf(os.Stderr, "%s\nargs:", usageString)
+		flagSet.PrintDefaults()
+		os.Exit(1)
+	}
+
+	if *configFile == "" {
+		usage()
+	}
+
+	ctx := context.Background()
+	switch command {
+	case "count":
+		err = printCounts(ctx, setup(*configFile), os.Stdout)
+		cmd.FailOnError(err, "Failed to count queued submissions")
+
+	case "requeue":
+		err = requeue(ctx, setup(*configFile), *serial, *logID, os.Stdout)
+		cmd.FailOnError(err, "Failed to requeue submissions")
+
+	default:
+		usage()
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/test"
+)
+
+// mockQueue maps the serials of dead submissions to their logs
+type mockQueue struct {
+	dead map[string]string
+}
+
+func (q *mockQueue) CountCTSubmissions(ctx context.Context) (map[core.CTSubmissionStatus]int64, error) {
+	return map[core.CTSubmissionStatus]int64{
+		core.CTSubmissionPending: 3,
+		core.CTSubmissionDead:    int64(len(q.dead)),
+	}, nil
+}
+
+func (q *mockQueue) RequeueCTSubmissions(ctx context.Context, serial, logID string) (int64, error) {
+	var n int64
+	for s, l := range q.dead {
+		if (serial == "" || s == serial) && (logID == "" || l == logID) {
+			delete(q.dead, s)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func TestCount(t *testing.T) {
+	q := &mockQueue{dead: map[string]string{"01": "log"}}
+	var out bytes.Buffer
+	err := printCounts(context.Background(), q, &out)
+	test.AssertNotError(t, err, "Failed to print counts")
+	test.AssertEquals(t, out.String(), "pending: 3\ndead: 1\n")
+}
+
+func TestRequeue(t *testing.T) {
+	q := &mockQueue{dead: map[string]string{"01": "log", "02": "log", "03": "other log"}}
+	var out bytes.Buffer
+	err := requeue(context.Background(), q, "", "log", &out)
+	test.AssertNotError(t, err, "Failed to requeue")
+	test.AssertEquals(t, out.String(), "Requeued 2 dead submissions\n")
+	test.AssertEquals(t, len(q.dead), 1)
+}
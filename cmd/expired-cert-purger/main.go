@@ -0,0 +1,322 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cactus/go-statsd-client/statsd"
+	"github.com/jmhodges/clock"
+	"gopkg.in/gorp.v1"
+
+	"github.com/letsencrypt/boulder/cmd"
+	"github.com/letsencrypt/boulder/core"
+	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/metrics"
+	"github.com/letsencrypt/boulder/sa"
+)
+
+type ecpConfig struct {
+	ExpiredCertPurger struct {
+		cmd.DBConfig
+
+		Statsd cmd.StatsdConfig
+		Syslog cmd.SyslogConfig
+
+		GracePeriod cmd.ConfigDuration
+		BatchSize   int
+		// BatchPause is how long to wait between batches, to leave room for
+		// other queries and for replicas to catch up.
+		BatchPause cmd.ConfigDuration
+
+		// ArchiveDir is where the certificates are archived before they're
+		// purged, in a gzipped file per batch.
+		ArchiveDir string
+	}
+}
+
+// purgedTable is a table of per-certificate rows, and its column holding
+// their certificate's serial.
+type purgedTable struct {
+	name         string
+	serialColumn string
+}
+
+// purgedTables are the tables that a certificate is purged from, in the order
+// they're purged.
+var purgedTables = []purgedTable{
+	{"issuedNames", "serial"},
+	{"fqdnSets", "serial"},
+	{"ocspResponses", "serial"},
+	{"sctReceipts", "certificateSerial"},
+	{"sctInclusions", "certificateSerial"},
+	{"ctSubmissions", "certificateSerial"},
+	{"precertificates", "serial"},
+	{"certificateStatus", "serial"},
+	{"certificates", "serial"},
+}
+
+// archivedCertificate is what's archived of a purged certificate, one JSON
+// object per line. issuedNames and fqdnSets can be derived from it, and
+// sctInclusions and ctSubmissions only track CT monitoring and submission of
+// certificates that are long gone from use, so they aren't archived.
+type archivedCertificate struct {
+	Status core.CertificateStatus
+	// Certificate is nil if the status had no certificate
+	Certificate *core.Certificate
+	// Precertificate is nil if the certificate had no precertificate
+	Precertificate *core.Certificate
+	SCTReceipts    []core.SignedCertificateTimestamp
+	// OCSPResponses are every response signed for the certificate, which
+	// are a record of what was said about it, and can't be signed again.
+	OCSPResponses []core.OCSPResponse
+}
+
+type expiredCertPurger struct {
+	stats statsd.Statter
+	log   blog.Logger
+	clk   clock.Clock
+	db    *gorp.DbMap
+
+	batchSize  int64
+	batchPause time.Duration
+	archiveDir string
+}
+
+// archive writes the certificates to a gzipped file named name in the archive
+// directory, and syncs it to disk. The file is only given its name once it's
+// complete, so that an interrupted archive isn't mistaken for a good one.
+func (p *expiredCertPurger) archive(name string, certs []archivedCertificate) error {
+	tmp, err := ioutil.TempFile(p.archiveDir, name+".tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+	}()
+
+	gz := gzip.NewWriter(tmp)
+	encoder := json.NewEncoder(gz)
+	for _, cert := range certs {
+		if err = encoder.Encode(cert); err != nil {
+			return err
+		}
+	}
+	if err = gz.Close(); err != nil {
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(p.archiveDir, name))
+}
+
+// purgeBatch archives and purges up to batchSize certificates that expired
+// before purgeBefore, and returns how many it purged. Certificates are found
+// by the notAfter of their status, which the table is partitioned by, so
+// those whose notAfter hasn't been backfilled yet are left for later.
+func (p *expiredCertPurger) purgeBatch(purgeBefore time.Time, archiveName string) (int64, error) {
+	var statuses []core.CertificateStatus
+	_, err := p.db.Select(
+		&statuses,
+		`SELECT * FROM certificateStatus WHERE notAfter <= ? ORDER BY notAfter LIMIT ?`,
+		purgeBefore,
+		p.batchSize,
+	)
+	if err != nil || len(statuses) == 0 {
+		return 0, err
+	}
+
+	serials := make([]interface{}, len(statuses))
+	for i, status := range statuses {
+		serials[i] = status.Serial
+	}
+	inSerials := "(?" + strings.Repeat(", ?", len(serials)-1) + ")"
+
+	var certs []core.Certificate
+	_, err = p.db.Select(&certs, `SELECT * FROM certificates WHERE serial IN `+inSerials, serials...)
+	if err != nil {
+		return 0, err
+	}
+	certBySerial := make(map[string]*core.Certificate, len(certs))
+	for i := range certs {
+		certBySerial[certs[i].Serial] = &certs[i]
+	}
+	var precerts []core.Certificate
+	_, err = p.db.Select(
+		&precerts,
+		`SELECT registrationID, serial, der, issued, expires FROM precertificates WHERE serial IN `+inSerials,
+		serials...,
+	)
+	if err != nil {
+		return 0, err
+	}
+	precertBySerial := make(map[string]*core.Certificate, len(precerts))
+	for i := range precerts {
+		precertBySerial[precerts[i].Serial] = &precerts[i]
+	}
+	var receipts []core.SignedCertificateTimestamp
+	_, err = p.db.Select(&receipts, `SELECT * FROM sctReceipts WHERE certificateSerial IN `+inSerials, serials...)
+	if err != nil {
+		return 0, err
+	}
+	receiptsBySerial := make(map[string][]core.SignedCertificateTimestamp)
+	for _, receipt := range receipts {
+		receiptsBySerial[receipt.CertificateSerial] = append(receiptsBySerial[receipt.CertificateSerial], receipt)
+	}
+	var responses []core.OCSPResponse
+	_, err = p.db.Select(&responses, `SELECT * FROM ocspResponses WHERE serial IN `+inSerials+` ORDER BY id`, serials...)
+	if err != nil {
+		return 0, err
+	}
+	responsesBySerial := make(map[string][]core.OCSPResponse)
+	for _, response := range responses {
+		responsesBySerial[response.Serial] = append(responsesBySerial[response.Serial], response)
+	}
+
+	archived := make([]archivedCertificate, len(statuses))
+	for i, status := range statuses {
+		archived[i] = archivedCertificate{
+			Status:         status,
+			Certificate:    certBySerial[status.Serial],
+			Precertificate: precertBySerial[status.Serial],
+			SCTReceipts:    receiptsBySerial[status.Serial],
+			OCSPResponses:  responsesBySerial[status.Serial],
+		}
+	}
+	if err = p.archive(archiveName, archived); err != nil {
+		return 0, fmt.Errorf("archiving certificates: %s", err)
+	}
+
+	tx, err := p.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	for _, table := range purgedTables {
+		_, err = tx.Exec(`DELETE FROM `+table.name+` WHERE `+table.serialColumn+` IN `+inSerials, serials...)
+		if err != nil {
+			return 0, sa.Rollback(tx, err)
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	return int64(len(statuses)), nil
+}
+
+func (p *expiredCertPurger) purgeCerts(purgeBefore time.Time, yes bool) (int64, error) {
+	if !yes {
+		var count int
+		err := p.db.SelectOne(&count, `SELECT COUNT(1) FROM certificateStatus WHERE notAfter <= ?`, purgeBefore)
+		if err != nil {
+			return 0, err
+		}
+		reader := bufio.NewReader(os.Stdin)
+		for {
+			fmt.Fprintf(os.Stdout, "\nAbout to archive and purge %d certificates, proceed? [y/N]: ", count)
+			text, err := reader.ReadString('\n')
+			if err != nil {
+				return 0, err
+			}
+			text = strings.ToLower(text)
+			if text != "y\n" && text != "n\n" && text != "\n" {
+				continue
+			}
+			if text == "n\n" || text == "\n" {
+				os.Exit(0)
+			} else {
+				break
+			}
+		}
+	}
+
+	started := p.clk.Now().UTC().Format("20060102T150405Z")
+	rowsAffected := int64(0)
+	for batch := 1; ; batch++ {
+		archiveName := fmt.Sprintf("certificates-%s-%05d.json.gz", started, batch)
+		rows, err := p.purgeBatch(purgeBefore, archiveName)
+		if err != nil {
+			return rowsAffected, err
+		}
+
+		p.stats.Inc("CertificatesPurged", rows, 1.0)
+		rowsAffected += rows
+		p.log.Info(fmt.Sprintf("Progress: Archived to %s and purged %d (%d total) expired certificates", archiveName, rows, rowsAffected))
+
+		if rows < p.batchSize {
+			p.log.Info(fmt.Sprintf("Purged a total of %d expired certificates", rowsAffected))
+			return rowsAffected, nil
+		}
+		p.clk.Sleep(p.batchPause)
+	}
+}
+
+func main() {
+	yes := flag.Bool("yes", false, "Skips the purge confirmation")
+	configPath := flag.String("config", "config.json", "Path to Boulder configuration file")
+	flag.Parse()
+
+	configJSON, err := ioutil.ReadFile(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read config file '%s': %s\n", *configPath, err)
+		os.Exit(1)
+	}
+
+	var config ecpConfig
+	err = json.Unmarshal(configJSON, &config)
+	cmd.FailOnError(err, "Failed to parse config")
+	c := config.ExpiredCertPurger
+
+	// Set up logging
+	stats, auditlogger := cmd.StatsAndLogging(c.Statsd, c.Syslog)
+	auditlogger.Info(cmd.Version())
+
+	// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+	defer auditlogger.AuditPanic()
+
+	// Configure DB
+	dbURL, err := c.DBConfig.URL()
+	cmd.FailOnError(err, "Couldn't load DB URL")
+	dbMap, err := sa.NewDbMap(dbURL, c.DBConfig.MaxDBConns)
+	cmd.FailOnError(err, "Could not connect to database")
+	err = sa.CheckSchemaVersions(dbMap, sa.SchemaVersions)
+	cmd.FailOnError(err, "Database hasn't been migrated")
+	go sa.ReportDbConnCount(dbMap, metrics.NewStatsdScope(stats, "CertPurger"))
+
+	if c.GracePeriod.Duration <= 0 {
+		fmt.Fprintln(os.Stderr, "Grace period must be positive, refusing to purge certificates as soon as they expire, or before")
+		os.Exit(1)
+	}
+	if c.BatchSize <= 0 {
+		fmt.Fprintln(os.Stderr, "Batch size must be positive")
+		os.Exit(1)
+	}
+	if c.ArchiveDir == "" {
+		fmt.Fprintln(os.Stderr, "No archive directory, refusing to purge certificates without archiving them")
+		os.Exit(1)
+	}
+	err = os.MkdirAll(c.ArchiveDir, 0700)
+	cmd.FailOnError(err, "Failed to create archive directory")
+
+	purger := &expiredCertPurger{
+		stats:      stats,
+		log:        auditlogger,
+		clk:        cmd.Clock(),
+		db:         dbMap,
+		batchSize:  int64(c.BatchSize),
+		batchPause: c.BatchPause.Duration,
+		archiveDir: c.ArchiveDir,
+	}
+
+	purgeBefore := purger.clk.Now().Add(-c.GracePeriod.Duration)
+	_, err = purger.purgeCerts(purgeBefore, *yes)
+	cmd.FailOnError(err, "Failed to purge certificates")
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cactus/go-statsd-client/statsd"
+	"github.com/jmhodges/clock"
+	"golang.org/x/net/context"
+
+	"github.com/letsencrypt/boulder/core"
+	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/sa"
+	"github.com/letsencrypt/boulder/sa/satest"
+	"github.com/letsencrypt/boulder/test"
+	"github.com/letsencrypt/boulder/test/vars"
+)
+
+func readArchive(t *testing.T, filename string) []archivedCertificate {
+	f, err := os.Open(filename)
+	test.AssertNotError(t, err, "Failed to open archive")
+	defer func() { _ = f.Close() }()
+	gz, err := gzip.NewReader(f)
+	test.AssertNotError(t, err, "Failed to read archive")
+	var certs []archivedCertificate
+	decoder := json.NewDecoder(gz)
+	for decoder.More() {
+		var cert archivedCertificate
+		err = decoder.Decode(&cert)
+		test.AssertNotError(t, err, "Failed to decode archived certificate")
+		certs = append(certs, cert)
+	}
+	return certs
+}
+
+func TestArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "expired-cert-purger")
+	test.AssertNotError(t, err, "Failed to create archive directory")
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	p := expiredCertPurger{archiveDir: dir}
+	certs := []archivedCertificate{
+		{Status: core.CertificateStatus{Serial: "01"}, Certificate: &core.Certificate{Serial: "01", DER: []byte{1}}},
+		{Status: core.CertificateStatus{Serial: "02"}},
+	}
+	err = p.archive("archive.json.gz", certs)
+	test.AssertNotError(t, err, "Failed to archive certificates")
+
+	files, err := ioutil.ReadDir(dir)
+	test.AssertNotError(t, err, "Failed to list archive directory")
+	test.AssertEquals(t, len(files), 1)
+	test.AssertDeepEquals(t, readArchive(t, filepath.Join(dir, "archive.json.gz")), certs)
+}
+
+func TestPurgeCerts(t *testing.T) {
+	dbMap, err := sa.NewDbMap(vars.DBConnSAFullPerms, 0)
+	if err != nil {
+		t.Fatalf("Couldn't connect the database: %s", err)
+	}
+	log := blog.UseMock()
+	fc := clock.NewFake()
+	ssa, err := sa.NewSQLStorageAuthority(dbMap, fc, log)
+	if err != nil {
+		t.Fatalf("unable to create SQLStorageAuthority: %s", err)
+	}
+	cleanUp := test.ResetSATestDatabase(t)
+	defer cleanUp()
+	stats, _ := statsd.NewNoopClient(nil)
+	dir, err := ioutil.TempDir("", "expired-cert-purger")
+	test.AssertNotError(t, err, "Failed to create archive directory")
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	p := expiredCertPurger{stats, log, fc, dbMap, 1, time.Second, dir}
+
+	reg := satest.CreateWorkingRegistration(t, ssa)
+	var expires []time.Time
+	var serials []string
+	for _, filename := range []string{"www.eff.org.der", "test-cert.der"} {
+		der, err := ioutil.ReadFile(filepath.Join("../../sa", filename))
+		test.AssertNotError(t, err, "Couldn't read example cert DER")
+		serial, err := ssa.AddCertificate(context.Background(), der, reg.ID)
+		test.AssertNotError(t, err, "Couldn't add example cert")
+		cert, err := ssa.GetCertificate(context.Background(), serial)
+		test.AssertNotError(t, err, "Couldn't get example cert")
+		expires = append(expires, cert.Expires)
+		serials = append(serials, serial)
+	}
+	// Give the first certificate a row in every other table it's purged from
+	serial := serials[0]
+	err = ssa.AddSCTReceipt(context.Background(), core.SignedCertificateTimestamp{
+		SCTVersion:        0,
+		LogID:             "log",
+		Timestamp:         1337,
+		Signature:         []byte{1},
+		CertificateSerial: serial,
+	})
+	test.AssertNotError(t, err, "Couldn't add SCT receipt")
+	err = ssa.AddSCTInclusion(context.Background(), core.SCTInclusion{CertificateSerial: serial, LogID: "log", Checked: fc.Now()})
+	test.AssertNotError(t, err, "Couldn't add SCT inclusion")
+	err = ssa.AddCTSubmission(context.Background(), core.CTSubmission{
+		CertificateSerial: serial,
+		LogID:             "log",
+		Status:            core.CTSubmissionDead,
+		NextAttempt:       fc.Now(),
+	})
+	test.AssertNotError(t, err, "Couldn't add CT submission")
+	err = dbMap.Insert(&core.OCSPResponse{Serial: serial, CreatedAt: fc.Now(), Response: []byte{2}})
+	test.AssertNotError(t, err, "Couldn't add OCSP response")
+	_, err = dbMap.Exec(
+		"INSERT INTO precertificates (registrationID, serial, der, issued, expires) VALUES (?, ?, ?, ?, ?)",
+		reg.ID, serial, []byte{3}, fc.Now(), expires[0])
+	test.AssertNotError(t, err, "Couldn't add precertificate")
+
+	earliest, latest := expires[0], expires[1]
+	if latest.Before(earliest) {
+		earliest, latest = latest, earliest
+	}
+
+	rows, err := p.purgeCerts(earliest.Add(-time.Second), true)
+	test.AssertNotError(t, err, "purgeCerts failed")
+	test.AssertEquals(t, rows, int64(0))
+
+	rows, err = p.purgeCerts(earliest, true)
+	test.AssertNotError(t, err, "purgeCerts failed")
+	test.AssertEquals(t, rows, int64(1))
+
+	// Every batch waits before the next one
+	start := fc.Now()
+	rows, err = p.purgeCerts(latest, true)
+	test.AssertNotError(t, err, "purgeCerts failed")
+	test.AssertEquals(t, rows, int64(1))
+	test.AssertEquals(t, fc.Now(), start.Add(time.Second))
+
+	for _, table := range purgedTables {
+		count, err := dbMap.SelectInt("SELECT COUNT(1) FROM " + table.name)
+		test.AssertNotError(t, err, "Failed to count rows")
+		test.AssertEquals(t, count, int64(0))
+	}
+	archives, err := filepath.Glob(filepath.Join(dir, "certificates-*.json.gz"))
+	test.AssertNotError(t, err, "Failed to list archives")
+	var archived []archivedCertificate
+	for _, archive := range archives {
+		archived = append(archived, readArchive(t, archive)...)
+	}
+	test.AssertEquals(t, len(archived), 2)
+	for _, cert := range archived {
+		test.AssertNotNil(t, cert.Certificate, "Certificate wasn't archived")
+		if cert.Status.Serial != serial {
+			continue
+		}
+		test.AssertNotNil(t, cert.Precertificate, "Precertificate wasn't archived")
+		test.AssertByteEquals(t, cert.Precertificate.DER, []byte{3})
+		test.AssertEquals(t, len(cert.SCTReceipts), 1)
+		test.AssertEquals(t, len(cert.OCSPResponses), 1)
+		test.AssertByteEquals(t, cert.OCSPResponses[0].Response, []byte{2})
+	}
+}
@@ -65,6 +65,7 @@ func NewSourceFromDatabase(dbMap dbSelector, caKeyHash []byte, log blog.Logger)
 type dbResponse struct {
 	OCSPResponse    []byte
 	OCSPLastUpdated time.Time
+	NoOCSP          bool
 }
 
 // Response is called by the HTTP server to handle a new OCSP request.
@@ -86,7 +87,7 @@ func (src *DBSource) Response(req *ocsp.Request) ([]byte, bool) {
 	}()
 	err := src.dbMap.SelectOne(
 		&response,
-		"SELECT ocspResponse, ocspLastUpdated FROM certificateStatus WHERE serial = :serial",
+		"SELECT ocspResponse, ocspLastUpdated, noOCSP FROM certificateStatus WHERE serial = :serial",
 		map[string]interface{}{"serial": serialString},
 	)
 	if err != nil && err != sql.ErrNoRows {
@@ -95,6 +96,10 @@ func (src *DBSource) Response(req *ocsp.Request) ([]byte, bool) {
 	if err != nil {
 		return nil, false
 	}
+	if response.NoOCSP {
+		src.log.Debug(fmt.Sprintf("OCSP Response not sent (certificate is short-lived, without OCSP) for CA=%s, Serial=%s", hex.EncodeToString(src.caKeyHash), serialString))
+		return nil, false
+	}
 	if response.OCSPLastUpdated.IsZero() {
 		src.log.Debug(fmt.Sprintf("OCSP Response not sent (ocspLastUpdated is zero) for CA=%s, Serial=%s", hex.EncodeToString(src.caKeyHash), serialString))
 		return nil, false
@@ -195,6 +200,8 @@ func main() {
 		logger.Info(fmt.Sprintf("Loading OCSP Database for CA Cert: %s", c.Common.IssuerCert))
 		dbMap, err := sa.NewDbMap(dbConnect, config.DBConfig.MaxDBConns)
 		cmd.FailOnError(err, "Could not connect to database")
+		err = sa.CheckSchemaVersions(dbMap, sa.SchemaVersions)
+		cmd.FailOnError(err, "Database hasn't been migrated")
 		sa.SetSQLDebug(dbMap, logger)
 		go sa.ReportDbConnCount(dbMap, metrics.NewStatsdScope(stats, "OCSPResponder"))
 		source, err = makeDBSource(dbMap, c.Common.IssuerCert, logger)
@@ -19,7 +19,7 @@ import (
 
 var (
 	req      = mustRead("./testdata/ocsp.req")
-	resp     = dbResponse{mustRead("./testdata/ocsp.resp"), time.Now()}
+	resp     = dbResponse{mustRead("./testdata/ocsp.resp"), time.Now(), false}
 	stats, _ = statsd.NewNoopClient()
 )
 
@@ -88,6 +88,15 @@ func TestDBHandler(t *testing.T) {
 	if !bytes.Equal(w.Body.Bytes(), unauthorizedErrorResponse) {
 		t.Errorf("Mismatched body: want %#v, got %#v", unauthorizedErrorResponse, w.Body.Bytes())
 	}
+	// check response for a short-lived certificate without OCSP is ignored
+	resp.NoOCSP = true
+	defer func() { resp.NoOCSP = false }()
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest("POST", "/", bytes.NewReader(req))
+	h.ServeHTTP(w, r)
+	if !bytes.Equal(w.Body.Bytes(), unauthorizedErrorResponse) {
+		t.Errorf("Mismatched body: want %#v, got %#v", unauthorizedErrorResponse, w.Body.Bytes())
+	}
 }
 
 // mockSelector always returns the same certificateStatus
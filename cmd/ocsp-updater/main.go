@@ -22,6 +22,7 @@ import (
 	bgrpc "github.com/letsencrypt/boulder/grpc"
 	blog "github.com/letsencrypt/boulder/log"
 	"github.com/letsencrypt/boulder/metrics"
+	"github.com/letsencrypt/boulder/publisher"
 	pubPB "github.com/letsencrypt/boulder/publisher/proto"
 	"github.com/letsencrypt/boulder/rpc"
 	"github.com/letsencrypt/boulder/sa"
@@ -54,8 +55,8 @@ type OCSPUpdater struct {
 	ocspMinTimeToExpiry time.Duration
 	// Used to calculate how far back missing SCT receipts should be looked for
 	oldestIssuedSCT time.Duration
-	// Number of CT logs we expect to have receipts from
-	numLogs int
+	// Decides which certificates are missing SCT receipts
+	ctPolicy sctPolicy
 
 	loops []*looper
 
@@ -73,18 +74,16 @@ func newUpdater(
 	pub core.Publisher,
 	sac core.StorageAuthority,
 	config cmd.OCSPUpdaterConfig,
-	numLogs int,
+	ctPolicy sctPolicy,
 	issuerPath string,
 	log blog.Logger,
 ) (*OCSPUpdater, error) {
 	if config.NewCertificateBatchSize == 0 ||
-		config.OldOCSPBatchSize == 0 ||
-		config.MissingSCTBatchSize == 0 {
+		config.OldOCSPBatchSize == 0 {
 		return nil, fmt.Errorf("Loop batch sizes must be non-zero")
 	}
 	if config.NewCertificateWindow.Duration == 0 ||
-		config.OldOCSPWindow.Duration == 0 ||
-		config.MissingSCTWindow.Duration == 0 {
+		config.OldOCSPWindow.Duration == 0 {
 		return nil, fmt.Errorf("Loop window sizes must be non-zero")
 	}
 
@@ -96,7 +95,7 @@ func newUpdater(
 		log:                 log,
 		sac:                 sac,
 		pubc:                pub,
-		numLogs:             numLogs,
+		ctPolicy:            ctPolicy,
 		ocspMinTimeToExpiry: config.OCSPMinTimeToExpiry.Duration,
 		oldestIssuedSCT:     config.OldestIssuedSCT.Duration,
 	}
@@ -123,16 +122,20 @@ func newUpdater(
 			failureBackoffFactor: config.SignFailureBackoffFactor,
 			failureBackoffMax:    config.SignFailureBackoffMax.Duration,
 		},
-		// The missing SCT loop doesn't need to know about failureBackoffFactor or
-		// failureBackoffMax as it doesn't make any calls to the CA
-		{
+	}
+	// The missing SCT loop doesn't need to know about failureBackoffFactor or
+	// failureBackoffMax as it doesn't make any calls to the CA. It can be left
+	// out when the Publisher retries failed submissions from its queue.
+	if config.MissingSCTBatchSize != 0 &&
+		config.MissingSCTWindow.Duration != 0 {
+		updater.loops = append(updater.loops, &looper{
 			clk:       clk,
 			stats:     stats,
 			batchSize: config.MissingSCTBatchSize,
 			tickDur:   config.MissingSCTWindow.Duration,
 			tickFunc:  updater.missingReceiptsTick,
 			name:      "MissingSCTReceipts",
-		},
+		})
 	}
 	if config.RevokedCertificateBatchSize != 0 &&
 		config.RevokedCertificateWindow.Duration != 0 {
@@ -207,12 +210,12 @@ func (updater *OCSPUpdater) findStaleOCSPResponses(oldestLastUpdatedTime time.Ti
 	var statuses []core.CertificateStatus
 	_, err := updater.dbMap.Select(
 		&statuses,
+		// A NULL notAfter hasn't been backfilled yet, and could be unexpired
 		`SELECT cs.*
 			 FROM certificateStatus AS cs
-			 JOIN certificates AS cert
-			 ON cs.serial = cert.serial
 			 WHERE cs.ocspLastUpdated < :lastUpdate
-			 AND cert.expires > now()
+			 AND cs.noOCSP = 0
+			 AND (cs.notAfter > now() OR cs.notAfter IS NULL)
 			 ORDER BY cs.ocspLastUpdated ASC
 			 LIMIT :limit`,
 		map[string]interface{}{
@@ -232,6 +235,7 @@ func (updater *OCSPUpdater) getCertificatesWithMissingResponses(batchSize int) (
 		&statuses,
 		`SELECT * FROM certificateStatus
 			 WHERE ocspLastUpdated = 0
+			 AND noOCSP = 0
 			 LIMIT :limit`,
 		map[string]interface{}{
 			"limit": batchSize,
@@ -357,6 +361,7 @@ func (updater *OCSPUpdater) findRevokedCertificatesToUpdate(batchSize int) ([]co
 		`SELECT * FROM certificateStatus
 		 WHERE status = :revoked
 		 AND ocspLastUpdated <= revokedDate
+		 AND noOCSP = 0
 		 LIMIT :limit`,
 		map[string]interface{}{
 			"revoked": string(core.OCSPStatusRevoked),
@@ -456,14 +461,24 @@ func (updater *OCSPUpdater) getSerialsIssuedSince(since time.Time, batchSize int
 	return allSerials, nil
 }
 
-func (updater *OCSPUpdater) getNumberOfReceipts(serial string) (int, error) {
-	var count int
-	err := updater.dbMap.SelectOne(
-		&count,
-		"SELECT COUNT(id) FROM sctReceipts WHERE certificateSerial = :serial",
+// getReceiptLogIDs returns the IDs of the CT logs that SCT receipts are stored
+// from for the certificate with serial
+func (updater *OCSPUpdater) getReceiptLogIDs(serial string) ([]string, error) {
+	var logIDs []string
+	_, err := updater.dbMap.Select(
+		&logIDs,
+		"SELECT logID FROM sctReceipts WHERE certificateSerial = :serial",
 		map[string]interface{}{"serial": serial},
 	)
-	return count, err
+	return logIDs, err
+}
+
+// sctPolicy decides whether the SCT receipts stored for a certificate, from the
+// logs with IDs logIDs, are all those it should have. It's implemented by the
+// Publisher, so that certificates are checked against the same logs and group
+// minimums they're submitted under.
+type sctPolicy interface {
+	MissingSCTs(notAfter time.Time, logIDs []string) bool
 }
 
 // missingReceiptsTick looks for certificates without the correct number of SCT
@@ -478,12 +493,9 @@ func (updater *OCSPUpdater) missingReceiptsTick(ctx context.Context, batchSize i
 	}
 
 	for _, serial := range serials {
-		count, err := updater.getNumberOfReceipts(serial)
+		logIDs, err := updater.getReceiptLogIDs(serial)
 		if err != nil {
-			updater.log.AuditErr(fmt.Sprintf("Failed to get number of SCT receipts for certificate: %s", err))
-			continue
-		}
-		if count >= updater.numLogs {
+			updater.log.AuditErr(fmt.Sprintf("Failed to get SCT receipts for certificate: %s", err))
 			continue
 		}
 		cert, err := updater.sac.GetCertificate(ctx, serial)
@@ -491,6 +503,9 @@ func (updater *OCSPUpdater) missingReceiptsTick(ctx context.Context, batchSize i
 			updater.log.AuditErr(fmt.Sprintf("Failed to get certificate: %s", err))
 			continue
 		}
+		if !updater.ctPolicy.MissingSCTs(cert.Expires, logIDs) {
+			continue
+		}
 		_ = updater.pubc.SubmitToCT(ctx, cert.DER)
 	}
 	return nil
@@ -614,10 +629,26 @@ func main() {
 	cmd.FailOnError(err, "Couldn't load DB URL")
 	dbMap, err := sa.NewDbMap(dbURL, conf.DBConfig.MaxDBConns)
 	cmd.FailOnError(err, "Could not connect to database")
+	err = sa.CheckSchemaVersions(dbMap, sa.SchemaVersions)
+	cmd.FailOnError(err, "Database hasn't been migrated")
 	go sa.ReportDbConnCount(dbMap, metrics.NewStatsdScope(stats, "OCSPUpdater"))
 
 	cac, pubc, sac := setupClients(conf, stats)
 
+	// The Publisher decides which receipts are missing, but never submits
+	// anything itself; resubmissions go through pubc.
+	logs := make([]*publisher.Log, len(c.Common.CT.Logs))
+	for i, ld := range c.Common.CT.Logs {
+		logs[i], err = publisher.NewShardedLog(ld.URI, ld.Key, ld.NotAfterStart, ld.NotAfterEnd)
+		cmd.FailOnError(err, "Unable to parse CT log description")
+	}
+	ctPolicy := publisher.New(nil, logs, 0, auditlogger)
+	if conf.LogPolicy != nil {
+		err = ctPolicy.LoadLogPolicy(conf.LogPolicy.LogListFile, conf.LogPolicy.Groups)
+		cmd.FailOnError(err, "Failed to load CT log policy")
+		defer ctPolicy.Close()
+	}
+
 	updater, err := newUpdater(
 		stats,
 		clock.Default(),
@@ -627,7 +658,7 @@ func main() {
 		sac,
 		// Necessary evil for now
 		conf,
-		len(c.Common.CT.Logs),
+		ctPolicy,
 		c.Common.IssuerCert,
 		auditlogger,
 	)
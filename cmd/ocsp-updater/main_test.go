@@ -1,8 +1,12 @@
 package main
 
 import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
 	"database/sql"
 	"errors"
+	"math/big"
 	"testing"
 	"time"
 
@@ -30,11 +34,23 @@ func (ca *mockCA) IssueCertificate(_ context.Context, csr oldx509.CertificateReq
 	return core.Certificate{}, nil
 }
 
+func (ca *mockCA) IssuePrecertificate(_ context.Context, csr oldx509.CertificateRequest, regID int64) (core.Certificate, error) {
+	return core.Certificate{}, nil
+}
+
+func (ca *mockCA) IssueCertificateForPrecertificate(_ context.Context, _ []byte, _ [][]byte, _ int64) (core.Certificate, error) {
+	return core.Certificate{}, nil
+}
+
 func (ca *mockCA) GenerateOCSP(_ context.Context, xferObj core.OCSPSigningRequest) (ocsp []byte, err error) {
 	ocsp = []byte{1, 2, 3}
 	return
 }
 
+func (ca *mockCA) GenerateCRLs(_ context.Context, _ []core.CRLSigningRequest) ([][]byte, error) {
+	return nil, nil
+}
+
 type mockPub struct {
 	sa core.StorageAuthority
 }
@@ -56,6 +72,22 @@ func (p *mockPub) SubmitToCT(_ context.Context, _ []byte) error {
 	return p.sa.AddSCTReceipt(ctx, sct)
 }
 
+func (p *mockPub) SubmitPrecertToCT(_ context.Context, _ []byte) ([][]byte, error) {
+	return nil, nil
+}
+
+// sctPolicyFunc is an sctPolicy that calls itself
+type sctPolicyFunc func(notAfter time.Time, logIDs []string) bool
+
+func (f sctPolicyFunc) MissingSCTs(notAfter time.Time, logIDs []string) bool {
+	return f(notAfter, logIDs)
+}
+
+// bothMockLogs expects receipts from both of the logs mockPub submits to
+var bothMockLogs = sctPolicyFunc(func(_ time.Time, logIDs []string) bool {
+	return len(logIDs) < 2
+})
+
 var log = blog.UseMock()
 
 func setup(t *testing.T) (*OCSPUpdater, core.StorageAuthority, *gorp.DbMap, clock.FakeClock, func()) {
@@ -88,7 +120,7 @@ func setup(t *testing.T) (*OCSPUpdater, core.StorageAuthority, *gorp.DbMap, cloc
 			OldOCSPWindow:           cmd.ConfigDuration{Duration: time.Second},
 			MissingSCTWindow:        cmd.ConfigDuration{Duration: time.Second},
 		},
-		0,
+		nil,
 		"",
 		blog.NewMock(),
 	)
@@ -177,6 +209,21 @@ func TestFindStaleOCSPResponses(t *testing.T) {
 	certs, err = updater.findStaleOCSPResponses(earliest, 10)
 	test.AssertNotError(t, err, "Failed to find stale responses")
 	test.AssertEquals(t, len(certs), 0)
+
+	// Expired certificates are left alone, but ones whose expiry hasn't been
+	// backfilled aren't
+	_, err = updater.dbMap.Exec(
+		"UPDATE certificateStatus SET ocspLastUpdated = ?, notAfter = ?",
+		earliest.Add(-time.Hour), time.Now().Add(-time.Hour))
+	test.AssertNotError(t, err, "Failed to expire certificate status")
+	certs, err = updater.findStaleOCSPResponses(earliest, 10)
+	test.AssertNotError(t, err, "Failed to find stale responses")
+	test.AssertEquals(t, len(certs), 0)
+	_, err = updater.dbMap.Exec("UPDATE certificateStatus SET notAfter = NULL")
+	test.AssertNotError(t, err, "Failed to clear certificate status expiry")
+	certs, err = updater.findStaleOCSPResponses(earliest, 10)
+	test.AssertNotError(t, err, "Failed to find stale responses")
+	test.AssertEquals(t, len(certs), 1)
 }
 
 func TestGetCertificatesWithMissingResponses(t *testing.T) {
@@ -216,6 +263,47 @@ func TestFindRevokedCertificatesToUpdate(t *testing.T) {
 	test.AssertEquals(t, len(statuses), 1)
 }
 
+func TestShortLivedCertificatesSkipped(t *testing.T) {
+	updater, sa, _, fc, cleanUp := setup(t)
+	defer cleanUp()
+
+	reg := satest.CreateWorkingRegistration(t, sa)
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	test.AssertNotError(t, err, "Couldn't generate key")
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1337),
+		DNSNames:     []string{"short-lived.com"},
+		NotBefore:    now,
+		NotAfter:     now.Add(core.MaxNoOCSPValidity),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	test.AssertNotError(t, err, "Couldn't create certificate")
+	_, err = sa.AddCertificate(ctx, der, reg.ID)
+	test.AssertNotError(t, err, "Couldn't add short-lived certificate")
+	serial := core.SerialToString(template.SerialNumber)
+	status, err := sa.GetCertificateStatus(ctx, serial)
+	test.AssertNotError(t, err, "Couldn't get certificate status")
+	test.Assert(t, status.NoOCSP, "Short-lived certificate's status isn't marked noOCSP")
+
+	statuses, err := updater.getCertificatesWithMissingResponses(10)
+	test.AssertNotError(t, err, "Couldn't get status")
+	test.AssertEquals(t, len(statuses), 0)
+	statuses, err = updater.findStaleOCSPResponses(fc.Now().Add(-time.Hour), 10)
+	test.AssertNotError(t, err, "Failed to find stale responses")
+	test.AssertEquals(t, len(statuses), 0)
+
+	// Revocation is still recorded, but no response is generated for it.
+	err = sa.MarkCertificateRevoked(ctx, serial, core.RevocationCode(1))
+	test.AssertNotError(t, err, "Failed to revoke certificate")
+	status, err = sa.GetCertificateStatus(ctx, serial)
+	test.AssertNotError(t, err, "Couldn't get certificate status")
+	test.AssertEquals(t, status.Status, core.OCSPStatusRevoked)
+	statuses, err = updater.findRevokedCertificatesToUpdate(10)
+	test.AssertNotError(t, err, "Failed to find revoked certificates")
+	test.AssertEquals(t, len(statuses), 0)
+}
+
 func TestNewCertificateTick(t *testing.T) {
 	updater, sa, _, fc, cleanUp := setup(t)
 	defer cleanUp()
@@ -265,7 +353,7 @@ func TestMissingReceiptsTick(t *testing.T) {
 	_, err = sa.AddCertificate(ctx, parsedCert.Raw, reg.ID)
 	test.AssertNotError(t, err, "Couldn't add test-cert.pem")
 
-	updater.numLogs = 1
+	updater.ctPolicy = bothMockLogs
 	updater.oldestIssuedSCT = 2 * time.Hour
 
 	serials, err := updater.getSerialsIssuedSince(fc.Now().Add(-2*time.Hour), 1)
@@ -275,15 +363,64 @@ func TestMissingReceiptsTick(t *testing.T) {
 	err = updater.missingReceiptsTick(ctx, 5)
 	test.AssertNotError(t, err, "Failed to run missingReceiptsTick")
 
-	count, err := updater.getNumberOfReceipts("00")
-	test.AssertNotError(t, err, "Couldn't get number of receipts")
-	test.AssertEquals(t, count, 2)
+	logIDs, err := updater.getReceiptLogIDs("00")
+	test.AssertNotError(t, err, "Couldn't get SCT receipts")
+	test.AssertEquals(t, len(logIDs), 2)
 
-	// make sure we don't spin forever after reducing the
-	// number of logs we submit to
-	updater.numLogs = 1
+	// make sure we don't spin forever once the receipts
+	// are all there
 	err = updater.missingReceiptsTick(ctx, 10)
 	test.AssertNotError(t, err, "Failed to run missingReceiptsTick")
+	logIDs, err = updater.getReceiptLogIDs("00")
+	test.AssertNotError(t, err, "Couldn't get SCT receipts")
+	test.AssertEquals(t, len(logIDs), 2)
+}
+
+func TestMissingReceiptsTickPolicy(t *testing.T) {
+	updater, sa, _, fc, cleanUp := setup(t)
+	defer cleanUp()
+
+	reg := satest.CreateWorkingRegistration(t, sa)
+	parsedCert, err := core.LoadCert("test-cert.pem")
+	test.AssertNotError(t, err, "Couldn't read test certificate")
+	fc.Set(parsedCert.NotBefore.Add(time.Minute))
+	_, err = sa.AddCertificate(ctx, parsedCert.Raw, reg.ID)
+	test.AssertNotError(t, err, "Couldn't add test-cert.pem")
+	updater.oldestIssuedSCT = 2 * time.Hour
+
+	// Nothing is submitted while the policy has no receipts missing.
+	var notAfters []time.Time
+	var seen [][]string
+	missing := false
+	updater.ctPolicy = sctPolicyFunc(func(notAfter time.Time, logIDs []string) bool {
+		notAfters = append(notAfters, notAfter)
+		seen = append(seen, logIDs)
+		return missing
+	})
+	err = updater.missingReceiptsTick(ctx, 5)
+	test.AssertNotError(t, err, "Failed to run missingReceiptsTick")
+	logIDs, err := updater.getReceiptLogIDs("00")
+	test.AssertNotError(t, err, "Couldn't get SCT receipts")
+	test.AssertEquals(t, len(logIDs), 0)
+
+	// The certificate is resubmitted when the policy says receipts are
+	// missing, and the policy is given the certificate's NotAfter and the
+	// logs it has receipts from.
+	missing = true
+	err = updater.missingReceiptsTick(ctx, 5)
+	test.AssertNotError(t, err, "Failed to run missingReceiptsTick")
+	logIDs, err = updater.getReceiptLogIDs("00")
+	test.AssertNotError(t, err, "Couldn't get SCT receipts")
+	test.AssertEquals(t, len(logIDs), 2)
+	err = updater.missingReceiptsTick(ctx, 5)
+	test.AssertNotError(t, err, "Failed to run missingReceiptsTick")
+
+	test.AssertEquals(t, len(notAfters), 3)
+	for _, notAfter := range notAfters {
+		test.Assert(t, notAfter.Equal(parsedCert.NotAfter), "Policy wasn't given the certificate's NotAfter")
+	}
+	test.AssertEquals(t, len(seen[1]), 0)
+	test.AssertEquals(t, len(seen[2]), 2)
 }
 
 /*
@@ -318,7 +455,7 @@ func TestMissingReceiptsTickTerminate(t *testing.T) {
 	// conditions that cause the termination bug described in
 	// https://github.com/letsencrypt/boulder/issues/1872 are met
 	updater.dbMap = inexhaustibleDB{}
-	updater.numLogs = 1
+	updater.ctPolicy = bothMockLogs
 	updater.oldestIssuedSCT = 2 * time.Hour
 
 	// Note: Must use a batch size larger than the # of rows returned by
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/cactus/go-statsd-client/statsd"
+	"github.com/jmhodges/clock"
+	"golang.org/x/net/context"
+
+	"github.com/letsencrypt/boulder/cmd"
+	"github.com/letsencrypt/boulder/core"
+	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/va"
+)
+
+const clientName = "ValidationDebugger"
+
+// defaultTimeout matches the RPC timeout the RA gives the VA for a
+// validation.
+const defaultTimeout = 60 * time.Second
+
+const usageString = `
+usage:
+validation-debugger --config <path> --identifier <name> --type <challenge type> --token <token> --key-authorization <key authorization> [--timeout <duration>]
+
+Performs a single validation the way the VA configured by <path> would, and
+prints each DNS answer, HTTP response and TLS handshake made along the way,
+followed by the validation records (including the CAA decision) and the
+result. Like a validation requested by the RA, it is abandoned once the
+timeout passes. Nothing is written to the SA.
+
+args:
+`
+
+// config is the same as boulder-va's, so that its config file can be used
+// unchanged.
+type config struct {
+	VA cmd.VAConfig
+
+	Statsd cmd.StatsdConfig
+
+	Syslog cmd.SyslogConfig
+
+	Common struct {
+		DNSResolver               string
+		DNSTimeout                string
+		DNSAllowLoopbackAddresses bool
+	}
+}
+
+// printer writes the details of each network exchange made by the VA.
+type printer struct {
+	w io.Writer
+}
+
+func (p printer) DNS(qtype, name string, answers []string, err error) {
+	fmt.Fprintf(p.w, "DNS %s %s\n", qtype, name)
+	for _, answer := range answers {
+		fmt.Fprintf(p.w, "\t%s\n", answer)
+	}
+	if err != nil {
+		fmt.Fprintf(p.w, "\terror: %s\n", err)
+	}
+}
+
+func (p printer) HTTPResponse(resp *http.Response) {
+	fmt.Fprintf(p.w, "HTTP %s %s\n", resp.Request.Method, resp.Request.URL)
+	fmt.Fprintf(p.w, "\t%s %s\n", resp.Proto, resp.Status)
+	for name, values := range resp.Header {
+		for _, value := range values {
+			fmt.Fprintf(p.w, "\t%s: %s\n", name, value)
+		}
+	}
+	if resp.TLS != nil {
+		p.connectionState(*resp.TLS)
+	}
+}
+
+func (p printer) TLSHandshake(hostPort string, state tls.ConnectionState) {
+	fmt.Fprintf(p.w, "TLS %s\n", hostPort)
+	p.connectionState(state)
+}
+
+var tlsVersions = map[uint16]string{
+	tls.VersionSSL30: "SSL 3.0",
+	tls.VersionTLS10: "TLS 1.0",
+	tls.VersionTLS11: "TLS 1.1",
+	tls.VersionTLS12: "TLS 1.2",
+}
+
+func (p printer) connectionState(state tls.ConnectionState) {
+	version, ok := tlsVersions[state.Version]
+	if !ok {
+		version = fmt.Sprintf("0x%04x", state.Version)
+	}
+	fmt.Fprintf(p.w, "\tversion: %s, cipher suite: 0x%04x, server name: %q\n",
+		version, state.CipherSuite, state.ServerName)
+	for i, cert := range state.PeerCertificates {
+		fmt.Fprintf(p.w, "\tcertificate %d: subject %q, issuer %q, DNS names %v, not after %s\n",
+			i, cert.Subject.CommonName, cert.Issuer.CommonName, cert.DNSNames,
+			cert.NotAfter.Format(time.RFC3339))
+	}
+}
+
+// newVA builds a VA from c that validates challenges of challengeType and
+// prints each network exchange it makes to out.
+func newVA(c config, challengeType string, out io.Writer, stats statsd.Statter, logger blog.Logger) (*va.ValidationAuthorityImpl, error) {
+	// Receiving email-reply-00 replies means listening on the configured
+	// address, which is only worth doing when validating that challenge.
+	if challengeType != core.ChallengeTypeEmailReply00 {
+		c.VA.EmailReply = nil
+	}
+
+	dnsTimeout, err := time.ParseDuration(c.Common.DNSTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't parse DNS timeout: %s", err)
+	}
+	dnsConfig := va.DNSConfig{
+		Resolver:               c.Common.DNSResolver,
+		Timeout:                dnsTimeout,
+		AllowLoopbackAddresses: c.Common.DNSAllowLoopbackAddresses,
+	}
+	// Safe browsing isn't consulted during validation, so it isn't set up.
+	vai, err := va.NewFromConfig(c.VA, dnsConfig, nil, stats, clock.Default(), logger)
+	if err != nil {
+		return nil, err
+	}
+	vai.SetTracer(printer{out})
+	return vai, nil
+}
+
+// validate performs a single validation of challenge for identifier, giving
+// up after timeout, and prints the validation records and the result to out.
+func validate(vai *va.ValidationAuthorityImpl, identifier string, challenge core.Challenge, timeout time.Duration, out io.Writer) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	records, err := vai.PerformValidation(ctx, identifier, challenge, core.Authorization{})
+
+	recordsJSON, jsonErr := json.MarshalIndent(records, "", "  ")
+	if jsonErr != nil {
+		return fmt.Errorf("couldn't marshal validation records: %s", jsonErr)
+	}
+	fmt.Fprintf(out, "Validation records:\n%s\n", recordsJSON)
+	if err != nil {
+		fmt.Fprintf(out, "Validation failed: %s\n", err)
+		return err
+	}
+	fmt.Fprintln(out, "Validation succeeded")
+	return nil
+}
+
+func main() {
+	configFile := flag.String("config", "", "File path to the boulder-va configuration file")
+	identifier := flag.String("identifier", "", "Identifier to validate: a DNS name, or an email address for email-reply-00")
+	challengeType := flag.String("type", core.ChallengeTypeHTTP01, "Challenge type")
+	token := flag.String("token", "", "Challenge token")
+	keyAuthorization := flag.String("key-authorization", "", "Key authorization provided by the client")
+	timeout := flag.Duration("timeout", defaultTimeout, "How long to wait for the validation to finish")
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usageString)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if *configFile == "" || *identifier == "" || *token == "" || *keyAuthorization == "" || *timeout <= 0 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	if !core.ValidChallenge(*challengeType) {
+		cmd.FailOnError(fmt.Errorf("unknown challenge type %q", *challengeType), "Invalid challenge type")
+	}
+
+	var c config
+	err := cmd.ReadJSONFile(*configFile, &c)
+	cmd.FailOnError(err, "Reading JSON config file into config structure")
+
+	stats, logger := cmd.StatsAndLogging(c.Statsd, c.Syslog)
+	defer logger.AuditPanic()
+	logger.Info(cmd.VersionString(clientName))
+
+	vai, err := newVA(c, *challengeType, os.Stdout, stats, logger)
+	cmd.FailOnError(err, "Unable to create VA")
+
+	challenge := core.Challenge{
+		Type:                     *challengeType,
+		Status:                   core.StatusPending,
+		Token:                    *token,
+		ProvidedKeyAuthorization: *keyAuthorization,
+	}
+	if err = validate(vai, *identifier, challenge, *timeout, os.Stdout); err != nil {
+		os.Exit(1)
+	}
+}
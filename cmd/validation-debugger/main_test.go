@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cactus/go-statsd-client/statsd"
+	"github.com/miekg/dns"
+
+	"github.com/letsencrypt/boulder/cmd"
+	"github.com/letsencrypt/boulder/core"
+	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/test"
+)
+
+const (
+	token            = "LoqXcYV8q5ONbJQxbmR7SCTNo3tiAXDfowyjxAjEuX0"
+	keyAuthorization = token + ".9jg46WB3rR_AHD-EBXdN7cBkH1WOu0tA3M9fm21mqTI"
+)
+
+// dnsServer answers A queries for every name with 127.0.0.1, and every other
+// query with an empty answer, so that there is no CAA record to stop
+// issuance. Queries for slow.example.com aren't answered until release is
+// closed.
+func dnsServer(t *testing.T, release chan struct{}) (string, func()) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	test.AssertNotError(t, err, "listening for DNS")
+	server := &dns.Server{
+		Listener: l,
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+			if r.Question[0].Name == "slow.example.com." {
+				<-release
+				return
+			}
+			m := new(dns.Msg)
+			m.SetReply(r)
+			for _, q := range r.Question {
+				if q.Qtype == dns.TypeA {
+					m.Answer = append(m.Answer, &dns.A{
+						Hdr: dns.RR_Header{Name: q.Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+						A:   net.ParseIP("127.0.0.1"),
+					})
+				}
+			}
+			_ = w.WriteMsg(m)
+		}),
+	}
+	go func() { _ = server.ActivateAndServe() }()
+	return l.Addr().String(), func() { _ = server.Shutdown() }
+}
+
+// loadConfig writes a boulder-va config that resolves names with resolver
+// and fetches HTTP-01 challenges from httpPort, and reads it back.
+func loadConfig(t *testing.T, resolver, httpPort string) config {
+	f, err := ioutil.TempFile("", "va-config")
+	test.AssertNotError(t, err, "Failed to create config file")
+	defer os.Remove(f.Name())
+	fmt.Fprintf(f, `{
+		"va": {
+			"userAgent": "boulder",
+			"portConfig": {"httpPort": %s},
+			"dnsTries": 1,
+			"issuerDomain": "happy-hacker-ca.invalid"
+		},
+		"common": {
+			"dnsResolver": %q,
+			"dnsTimeout": "10s",
+			"dnsAllowLoopbackAddresses": true
+		}
+	}`, httpPort, resolver)
+	f.Close()
+
+	var c config
+	err = cmd.ReadJSONFile(f.Name(), &c)
+	test.AssertNotError(t, err, "Failed to read config")
+	return c
+}
+
+func TestValidate(t *testing.T) {
+	release := make(chan struct{})
+	resolver, stop := dnsServer(t, release)
+	defer stop()
+	defer close(release)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/.well-known/acme-challenge/"+token {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, keyAuthorization)
+	}))
+	defer srv.Close()
+	_, port, err := net.SplitHostPort(srv.Listener.Addr().String())
+	test.AssertNotError(t, err, "Failed to split test server address")
+
+	c := loadConfig(t, resolver, port)
+	stats, _ := statsd.NewNoopClient(nil)
+	var out bytes.Buffer
+	vai, err := newVA(c, core.ChallengeTypeHTTP01, &out, stats, blog.NewMock())
+	test.AssertNotError(t, err, "Failed to create VA")
+
+	challenge := core.Challenge{
+		Type:                     core.ChallengeTypeHTTP01,
+		Status:                   core.StatusPending,
+		Token:                    token,
+		ProvidedKeyAuthorization: keyAuthorization,
+	}
+	err = validate(vai, "example.com", challenge, time.Minute, &out)
+	test.AssertNotError(t, err, "Validation failed")
+	test.Assert(t, strings.Contains(out.String(), "DNS A/AAAA example.com\n\t127.0.0.1\n"), "Address lookup wasn't printed")
+	test.Assert(t, strings.Contains(out.String(), "DNS CAA example.com"), "CAA lookup wasn't printed")
+	test.Assert(t, strings.Contains(out.String(), "HTTP GET "), "HTTP request wasn't printed")
+	test.Assert(t, strings.HasSuffix(out.String(), "Validation succeeded\n"), "Result wasn't printed")
+
+	// A key authorization that doesn't match what the server returns fails.
+	out.Reset()
+	challenge.ProvidedKeyAuthorization = token + ".wrong"
+	err = validate(vai, "example.com", challenge, time.Minute, &out)
+	test.AssertError(t, err, "Validation with the wrong key authorization succeeded")
+	test.Assert(t, strings.Contains(out.String(), "Validation failed: "), "Failure wasn't printed")
+
+	// A resolver that never answers is given up on once the timeout passes,
+	// well before the DNS timeout.
+	challenge.ProvidedKeyAuthorization = keyAuthorization
+	done := make(chan error, 1)
+	go func() {
+		done <- validate(vai, "slow.example.com", challenge, 100*time.Millisecond, ioutil.Discard)
+	}()
+	select {
+	case err = <-done:
+		test.AssertError(t, err, "Validation against a resolver that never answers succeeded")
+	case <-time.After(5 * time.Second):
+		t.Fatal("Validation wasn't abandoned once the timeout passed")
+	}
+}
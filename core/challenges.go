@@ -22,3 +22,8 @@ func TLSSNIChallenge01() Challenge {
 func DNSChallenge01() Challenge {
 	return newChallenge(ChallengeTypeDNS01)
 }
+
+// EmailReplyChallenge00 constructs a random email-reply-00 challenge
+func EmailReplyChallenge00() Challenge {
+	return newChallenge(ChallengeTypeEmailReply00)
+}
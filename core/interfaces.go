@@ -78,7 +78,13 @@ type RegistrationAuthority interface {
 type CertificateAuthority interface {
 	// [RegistrationAuthority]
 	IssueCertificate(ctx context.Context, csr oldx509.CertificateRequest, regID int64) (Certificate, error)
+	// [RegistrationAuthority]
+	IssuePrecertificate(ctx context.Context, csr oldx509.CertificateRequest, regID int64) (Certificate, error)
+	// [RegistrationAuthority]
+	IssueCertificateForPrecertificate(ctx context.Context, precertDER []byte, scts [][]byte, regID int64) (Certificate, error)
 	GenerateOCSP(ctx context.Context, ocspReq OCSPSigningRequest) ([]byte, error)
+	// [CRLUpdater]
+	GenerateCRLs(ctx context.Context, crlReqs []CRLSigningRequest) ([][]byte, error)
 }
 
 // PolicyAuthority defines the public interface for the Boulder PA
@@ -94,12 +100,25 @@ type StorageGetter interface {
 	GetAuthorization(ctx context.Context, authzID string) (Authorization, error)
 	GetValidAuthorizations(ctx context.Context, regID int64, domains []string, now time.Time) (map[string]*Authorization, error)
 	GetCertificate(ctx context.Context, serial string) (Certificate, error)
+	GetPrecertificate(ctx context.Context, serial string) (Certificate, error)
 	GetCertificateStatus(ctx context.Context, serial string) (CertificateStatus, error)
 	CountCertificatesRange(ctx context.Context, earliest, latest time.Time) (int64, error)
 	CountCertificatesByNames(ctx context.Context, domains []string, earliest, latest time.Time) (countByDomain map[string]int, err error)
 	CountRegistrationsByIP(ctx context.Context, ip net.IP, earliest, latest time.Time) (int, error)
 	CountPendingAuthorizations(ctx context.Context, regID int64) (int, error)
 	GetSCTReceipt(ctx context.Context, serial, logID string) (SignedCertificateTimestamp, error)
+	// GetUncheckedSCTReceipts returns up to limit of the SCTs logID issued
+	// before the given time, oldest first, whose inclusion hasn't been checked
+	GetUncheckedSCTReceipts(ctx context.Context, logID string, issuedBefore time.Time, limit int) ([]SignedCertificateTimestamp, error)
+	GetLatestSTH(ctx context.Context, logID string) (SignedTreeHead, error)
+	// GetDueCTSubmissions returns up to limit of the pending CT submissions
+	// whose next attempt is due at now, most overdue first
+	GetDueCTSubmissions(ctx context.Context, now time.Time, limit int) ([]CTSubmission, error)
+	CountCTSubmissions(ctx context.Context) (map[CTSubmissionStatus]int64, error)
+	// GetRevokedCertificates returns up to limit of the revoked certificates
+	// that haven't expired at now and whose serials sort after the given one,
+	// in serial order
+	GetRevokedCertificates(ctx context.Context, after string, now time.Time, limit int) ([]RevokedCertificate, error)
 	CountFQDNSets(ctx context.Context, window time.Duration, domains []string) (count int64, err error)
 	FQDNSetExists(ctx context.Context, domains []string) (exists bool, err error)
 }
@@ -113,7 +132,19 @@ type StorageAdder interface {
 	FinalizeAuthorization(ctx context.Context, authz Authorization) error
 	MarkCertificateRevoked(ctx context.Context, serial string, reasonCode RevocationCode) error
 	AddCertificate(ctx context.Context, der []byte, regID int64) (digest string, err error)
+	AddPrecertificate(ctx context.Context, der []byte, regID int64) error
+	// ClaimPrecertificate atomically marks a precertificate as having its
+	// final certificate issued, failing if it already was
+	ClaimPrecertificate(ctx context.Context, serial string) error
 	AddSCTReceipt(ctx context.Context, sct SignedCertificateTimestamp) error
+	AddSCTInclusion(ctx context.Context, inclusion SCTInclusion) error
+	AddSTH(ctx context.Context, sth SignedTreeHead) error
+	AddCTSubmission(ctx context.Context, sub CTSubmission) error
+	UpdateCTSubmission(ctx context.Context, sub CTSubmission) error
+	RemoveCTSubmission(ctx context.Context, id int64) error
+	// RequeueCTSubmissions makes dead CT submissions pending again, with no
+	// failed attempts. An empty serial or logID matches any.
+	RequeueCTSubmissions(ctx context.Context, serial, logID string) (int64, error)
 	RevokeAuthorizationsByDomain(ctx context.Context, domain AcmeIdentifier) (finalized, pending int64, err error)
 }
 
@@ -128,4 +159,7 @@ type StorageAuthority interface {
 // Publisher defines the public interface for the Boulder Publisher
 type Publisher interface {
 	SubmitToCT(ctx context.Context, der []byte) error
+	// SubmitPrecertToCT returns the TLS encoded SCTs that logs issued for the
+	// precertificate
+	SubmitPrecertToCT(ctx context.Context, der []byte) ([][]byte, error)
 }
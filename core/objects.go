@@ -5,6 +5,7 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"math/big"
 	"net"
 	"strings"
 	"time"
@@ -29,6 +30,9 @@ type IdentifierType string
 // OCSPStatus defines the state of OCSP for a domain
 type OCSPStatus string
 
+// CTSubmissionStatus defines the state of a queued CT log submission
+type CTSubmissionStatus string
+
 // These statuses are the states of authorizations
 const (
 	StatusUnknown    = AcmeStatus("unknown")    // Unknown status; the default
@@ -41,7 +45,8 @@ const (
 
 // These types are the available identification mechanisms
 const (
-	IdentifierDNS = IdentifierType("dns")
+	IdentifierDNS   = IdentifierType("dns")
+	IdentifierEmail = IdentifierType("email")
 )
 
 // The types of ACME resources
@@ -60,11 +65,19 @@ const (
 	OCSPStatusRevoked = OCSPStatus("revoked")
 )
 
+// These statuses are the states of queued CT log submissions. Submissions are
+// removed from the queue once the log issues an SCT.
+const (
+	CTSubmissionPending = CTSubmissionStatus("pending") // Waiting to be retried
+	CTSubmissionDead    = CTSubmissionStatus("dead")    // Given up on until requeued
+)
+
 // These types are the available challenges
 const (
-	ChallengeTypeHTTP01   = "http-01"
-	ChallengeTypeTLSSNI01 = "tls-sni-01"
-	ChallengeTypeDNS01    = "dns-01"
+	ChallengeTypeHTTP01       = "http-01"
+	ChallengeTypeTLSSNI01     = "tls-sni-01"
+	ChallengeTypeDNS01        = "dns-01"
+	ChallengeTypeEmailReply00 = "email-reply-00"
 )
 
 // ValidChallenge tests whether the provided string names a known challenge
@@ -75,6 +88,8 @@ func ValidChallenge(name string) bool {
 	case ChallengeTypeTLSSNI01:
 		fallthrough
 	case ChallengeTypeDNS01:
+		fallthrough
+	case ChallengeTypeEmailReply00:
 		return true
 
 	default:
@@ -88,6 +103,11 @@ const TLSSNISuffix = "acme.invalid"
 // DNSPrefix is attached to DNS names in DNS challenges
 const DNSPrefix = "_acme-challenge"
 
+// MaxNoOCSPValidity is the longest a short-lived certificate, which has no
+// OCSP URL, may be valid for. Such certificates never get OCSP responses, so
+// revoking one only reaches relying parties that check CRLs.
+const MaxNoOCSPValidity = 7 * 24 * time.Hour
+
 // An AcmeIdentifier encodes an identifier that can
 // be validated by ACME.  The protocol allows for different
 // types of identifier to be supported (DNS names, IP
@@ -235,6 +255,42 @@ type ValidationRecord struct {
 	Port              string   `json:"port"`
 	AddressesResolved []net.IP `json:"addressesResolved"`
 	AddressUsed       net.IP   `json:"addressUsed"`
+	// The addresses connected to, in order, when connecting to the preferred
+	// address failed and another address was tried. AddressUsed is the last
+	// of them.
+	AddressesTried []net.IP `json:"addressesTried,omitempty"`
+
+	// CAA only. Set on the first record of a validation, and describes the
+	// CAA check performed for Hostname.
+	CAALookup     []CAALookupStep `json:"caaLookup,omitempty"`
+	CAARecordUsed string          `json:"caaRecordUsed,omitempty"`
+
+	// Set on the first record of a validation that was retried, and describes
+	// each earlier attempt, all of which failed with a transient error.
+	PreviousAttempts []ValidationAttempt `json:"previousAttempts,omitempty"`
+}
+
+// ValidationAttempt records a validation attempt that failed and was retried.
+type ValidationAttempt struct {
+	// When the attempt started
+	Time time.Time `json:"time"`
+	// The records produced by the attempt, if any
+	Records []ValidationRecord `json:"records,omitempty"`
+	// Why the attempt failed
+	Error *probs.ProblemDetails `json:"error,omitempty"`
+}
+
+// CAALookupStep records the CAA query made for a single name while climbing
+// the DNS tree to find the relevant CAA RRset for an identifier.
+type CAALookupStep struct {
+	// The name queried
+	Name string `json:"name"`
+	// The targets of any CNAMEs followed by the resolver, in order
+	Aliases []string `json:"aliases,omitempty"`
+	// The CAA records found, in presentation format
+	Records []string `json:"records,omitempty"`
+	// The error encountered, if any
+	Error string `json:"error,omitempty"`
 }
 
 func looksLikeKeyAuthorization(str string) error {
@@ -336,6 +392,13 @@ func (ch Challenge) RecordsSane() bool {
 			return false
 		}
 		return true
+	case ChallengeTypeEmailReply00:
+		if len(ch.ValidationRecord) > 1 {
+			return false
+		}
+		if !strings.HasPrefix(ch.ValidationRecord[0].URL, "mailto:") || ch.ValidationRecord[0].Hostname == "" {
+			return false
+		}
 	default: // Unsupported challenge type
 		return false
 	}
@@ -521,13 +584,24 @@ type CertificateStatus struct {
 	// The encoded and signed OCSP response.
 	OCSPResponse []byte `db:"ocspResponse"`
 
+	// noOCSP: true iff the certificate is short-lived (see IsShortLived), so
+	//   OCSP responses are never generated or served for it. Its revocation
+	//   is still recorded here.
+	NoOCSP bool `db:"noOCSP"`
+
+	// notAfter: The certificate's expiry, which the table can be purged and
+	//   partitioned by. It's nil for certificates added before it was, until
+	//   they're backfilled.
+	NotAfter *time.Time `db:"notAfter"`
+
 	LockCol int64 `json:"-"`
 }
 
 // OCSPResponse is a (large) table of OCSP responses. This contains all
 // historical OCSP responses we've signed, is append-only, and is likely to get
 // quite large.
-// It must be administratively truncated outside of Boulder.
+// The responses of long expired certificates are archived and deleted by
+// expired-cert-purger.
 type OCSPResponse struct {
 	ID int `db:"id"`
 
@@ -541,18 +615,31 @@ type OCSPResponse struct {
 	Response []byte `db:"response"`
 }
 
-// CRL is a large table of signed CRLs. This contains all historical CRLs
-// we've signed, is append-only, and is likely to get quite large.
-// It must be administratively truncated outside of Boulder.
+// CRL is a table of signed CRLs. The CRL updater appends a CRL for each
+// shard of each issuer on every update, and prunes those that were signed
+// longer ago than its configured retention.
 type CRL struct {
-	// serial: Same as certificate serial.
-	Serial string `db:"serial"`
+	ID int64 `db:"id"`
 
-	// createdAt: The date the CRL was signed.
-	CreatedAt time.Time `db:"createdAt"`
+	// issuer: The common name of the issuer cert the CRL is for.
+	Issuer string `db:"issuer"`
+
+	// shard: Which of the issuer's CRL shards this is. Zero when the CRLs
+	// aren't sharded.
+	Shard int `db:"shard"`
+
+	// number: The CRL number, which increases with each CRL for the same
+	// issuer.
+	Number int64 `db:"number"`
+
+	// thisUpdate: The date the CRL was signed.
+	ThisUpdate time.Time `db:"thisUpdate"`
+
+	// nextUpdate: The date by which the next CRL will be signed.
+	NextUpdate time.Time `db:"nextUpdate"`
 
 	// crl: The encoded and signed CRL.
-	CRL string `db:"crl"`
+	CRL []byte `db:"crl"`
 }
 
 // OCSPSigningRequest is a transfer object representing an OCSP Signing Request
@@ -563,6 +650,56 @@ type OCSPSigningRequest struct {
 	RevokedAt time.Time
 }
 
+// RevokedCertificate is a transfer object representing a revoked certificate
+// that hasn't yet expired, to be listed on a CRL
+type RevokedCertificate struct {
+	Serial        string         `db:"serial"`
+	RevokedDate   time.Time      `db:"revokedDate"`
+	RevokedReason RevocationCode `db:"revokedReason"`
+	Expires       time.Time      `db:"expires"`
+	DER           []byte         `db:"der"`
+}
+
+// CRLSharding describes how an issuer's revoked certificates are split across
+// several CRLs.
+type CRLSharding struct {
+	// Shards is the number of CRLs. Zero or one means a single, full CRL.
+	Shards int
+	// By is how certificates are assigned to shards: "serial" (the default)
+	// or "expiry", in which case certificates expiring within the same Width
+	// are listed on the same CRL.
+	By    string
+	Width time.Duration
+}
+
+// ShardFor returns the index of the shard that lists the certificate with the
+// given serial and expiry. A certificate always maps to the same shard, so it
+// stays on the same CRL until it expires.
+func (s CRLSharding) ShardFor(serial *big.Int, expires time.Time) int {
+	if s.Shards <= 1 {
+		return 0
+	}
+	if s.By == "expiry" {
+		return int((expires.Unix() / int64(s.Width/time.Second)) % int64(s.Shards))
+	}
+	return int(new(big.Int).Mod(serial, big.NewInt(int64(s.Shards))).Int64())
+}
+
+// CRLSigningRequest is a transfer object representing a CRL Signing Request.
+// The CA lists the issuer's revoked certificates that fall in Shard, reading
+// them from the SA itself. IssuingDistributionPoint, if set, is the URL the
+// CRL will be served from, and is required when an issuer's revoked
+// certificates are split across several CRLs.
+type CRLSigningRequest struct {
+	IssuerCommonName         string
+	Number                   int64
+	ThisUpdate               time.Time
+	NextUpdate               time.Time
+	IssuingDistributionPoint string
+	Sharding                 CRLSharding
+	Shard                    int
+}
+
 // SignedCertificateTimestamp is the internal representation of ct.SignedCertificateTimestamp
 // that is used to maintain backwards compatibility with our old CT implementation.
 type SignedCertificateTimestamp struct {
@@ -585,6 +722,50 @@ type SignedCertificateTimestamp struct {
 	LockCol int64
 }
 
+// SignedTreeHead is a CT log's signed tree head, as verified by the CT
+// monitor. Each STH stored for a log is consistent with the one before it.
+type SignedTreeHead struct {
+	ID int64 `db:"id"`
+	// The ID of the log, as in SignedCertificateTimestamp
+	LogID     string `db:"logID"`
+	TreeSize  uint64 `db:"treeSize"`
+	Timestamp uint64 `db:"timestamp"`
+	RootHash  []byte `db:"rootHash"`
+	// The log's TLS encoded signature over the tree head
+	Signature []byte `db:"signature"`
+}
+
+// SCTInclusion is the result of checking that a CT log incorporated a
+// certificate it issued an SCT for into its tree, after its maximum merge
+// delay.
+type SCTInclusion struct {
+	ID                int64  `db:"id"`
+	CertificateSerial string `db:"certificateSerial"`
+	LogID             string `db:"logID"`
+	// Whether the log proved the certificate's inclusion in the tree of size
+	// TreeSize, at LeafIndex. If not, Problem says why.
+	Included  bool      `db:"included"`
+	LeafIndex uint64    `db:"leafIndex"`
+	TreeSize  uint64    `db:"treeSize"`
+	Problem   string    `db:"problem"`
+	Checked   time.Time `db:"checked"`
+}
+
+// CTSubmission is a failed submission of a certificate to a CT log, queued to
+// be retried until the log issues an SCT for it.
+type CTSubmission struct {
+	ID                int64  `db:"id"`
+	CertificateSerial string `db:"certificateSerial"`
+	LogID             string `db:"logID"`
+	// Whether it's the certificate's precertificate that's submitted
+	Precertificate bool               `db:"precertificate"`
+	Status         CTSubmissionStatus `db:"status"`
+	// The number of times submission has failed, and why it last did
+	Attempts    int       `db:"attempts"`
+	LastError   string    `db:"lastError"`
+	NextAttempt time.Time `db:"nextAttempt"`
+}
+
 // RevocationCode is used to specify a certificate revocation reason
 type RevocationCode int
 
@@ -6,6 +6,7 @@ import (
 	"math/big"
 	"net"
 	"testing"
+	"time"
 
 	"github.com/square/go-jose"
 
@@ -128,6 +129,19 @@ func TestRecordSanityCheckOnUnsupportChallengeType(t *testing.T) {
 	test.Assert(t, !chall.RecordsSane(), "Record with unsupported challenge type should not be sane")
 }
 
+func TestRecordSanityCheckEmailReply(t *testing.T) {
+	chall := Challenge{Type: ChallengeTypeEmailReply00, ValidationRecord: []ValidationRecord{
+		{URL: "mailto:alice@example.com", Hostname: "example.com"},
+	}}
+	test.Assert(t, chall.RecordsSane(), "email-reply-00 record should be sane")
+
+	chall.ValidationRecord[0].URL = "http://example.com/"
+	test.Assert(t, !chall.RecordsSane(), "email-reply-00 record without mailto URL should not be sane")
+
+	chall.ValidationRecord = append(chall.ValidationRecord, chall.ValidationRecord[0])
+	test.Assert(t, !chall.RecordsSane(), "email-reply-00 with two records should not be sane")
+}
+
 func TestChallengeSanityCheck(t *testing.T) {
 	// Make a temporary account key
 	var accountKey *jose.JsonWebKey
@@ -173,3 +187,18 @@ func TestJSONBufferUnmarshal(t *testing.T) {
 	err := json.Unmarshal(notValidBase64, &testStruct)
 	test.Assert(t, err != nil, "Should have choked on invalid base64")
 }
+
+func TestCRLShardFor(t *testing.T) {
+	sharding := CRLSharding{}
+	test.AssertEquals(t, sharding.ShardFor(big.NewInt(7), time.Time{}), 0)
+
+	sharding = CRLSharding{Shards: 4, By: "serial"}
+	test.AssertEquals(t, sharding.ShardFor(big.NewInt(6), time.Time{}), 2)
+	test.AssertEquals(t, sharding.ShardFor(big.NewInt(7), time.Time{}), 3)
+
+	sharding = CRLSharding{Shards: 4, By: "expiry", Width: time.Hour}
+	expires := time.Unix(0, 0).Add(5 * time.Hour)
+	test.AssertEquals(t, sharding.ShardFor(big.NewInt(6), expires), 1)
+	test.AssertEquals(t, sharding.ShardFor(big.NewInt(6), expires.Add(59*time.Minute)), 1)
+	test.AssertEquals(t, sharding.ShardFor(big.NewInt(6), expires.Add(time.Hour)), 2)
+}
@@ -12,6 +12,8 @@ It has these top-level messages:
 	Challenge
 	ValidationRecord
 	ProblemDetails
+	CAALookupStep
+	ValidationAttempt
 */
 package proto
 
@@ -104,13 +106,17 @@ func (m *Challenge) GetError() *ProblemDetails {
 }
 
 type ValidationRecord struct {
-	Hostname          *string  `protobuf:"bytes,1,opt,name=hostname" json:"hostname,omitempty"`
-	Port              *string  `protobuf:"bytes,2,opt,name=port" json:"port,omitempty"`
-	AddressesResolved [][]byte `protobuf:"bytes,3,rep,name=addressesResolved" json:"addressesResolved,omitempty"`
-	AddressUsed       []byte   `protobuf:"bytes,4,opt,name=addressUsed" json:"addressUsed,omitempty"`
-	Authorities       []string `protobuf:"bytes,5,rep,name=authorities" json:"authorities,omitempty"`
-	Url               *string  `protobuf:"bytes,6,opt,name=url" json:"url,omitempty"`
-	XXX_unrecognized  []byte   `json:"-"`
+	Hostname          *string              `protobuf:"bytes,1,opt,name=hostname" json:"hostname,omitempty"`
+	Port              *string              `protobuf:"bytes,2,opt,name=port" json:"port,omitempty"`
+	AddressesResolved [][]byte             `protobuf:"bytes,3,rep,name=addressesResolved" json:"addressesResolved,omitempty"`
+	AddressUsed       []byte               `protobuf:"bytes,4,opt,name=addressUsed" json:"addressUsed,omitempty"`
+	Authorities       []string             `protobuf:"bytes,5,rep,name=authorities" json:"authorities,omitempty"`
+	Url               *string              `protobuf:"bytes,6,opt,name=url" json:"url,omitempty"`
+	CaaLookup         []*CAALookupStep     `protobuf:"bytes,7,rep,name=caaLookup" json:"caaLookup,omitempty"`
+	CaaRecordUsed     *string              `protobuf:"bytes,8,opt,name=caaRecordUsed" json:"caaRecordUsed,omitempty"`
+	PreviousAttempts  []*ValidationAttempt `protobuf:"bytes,9,rep,name=previousAttempts" json:"previousAttempts,omitempty"`
+	AddressesTried    [][]byte             `protobuf:"bytes,10,rep,name=addressesTried" json:"addressesTried,omitempty"`
+	XXX_unrecognized  []byte               `json:"-"`
 }
 
 func (m *ValidationRecord) Reset()                    { *m = ValidationRecord{} }
@@ -160,6 +166,34 @@ func (m *ValidationRecord) GetUrl() string {
 	return ""
 }
 
+func (m *ValidationRecord) GetCaaLookup() []*CAALookupStep {
+	if m != nil {
+		return m.CaaLookup
+	}
+	return nil
+}
+
+func (m *ValidationRecord) GetCaaRecordUsed() string {
+	if m != nil && m.CaaRecordUsed != nil {
+		return *m.CaaRecordUsed
+	}
+	return ""
+}
+
+func (m *ValidationRecord) GetPreviousAttempts() []*ValidationAttempt {
+	if m != nil {
+		return m.PreviousAttempts
+	}
+	return nil
+}
+
+func (m *ValidationRecord) GetAddressesTried() [][]byte {
+	if m != nil {
+		return m.AddressesTried
+	}
+	return nil
+}
+
 type ProblemDetails struct {
 	ProblemType      *string `protobuf:"bytes,1,opt,name=problemType" json:"problemType,omitempty"`
 	Detail           *string `protobuf:"bytes,2,opt,name=detail" json:"detail,omitempty"`
@@ -193,34 +227,118 @@ func (m *ProblemDetails) GetHttpStatus() int32 {
 	return 0
 }
 
+type CAALookupStep struct {
+	Name             *string  `protobuf:"bytes,1,opt,name=name" json:"name,omitempty"`
+	Aliases          []string `protobuf:"bytes,2,rep,name=aliases" json:"aliases,omitempty"`
+	Records          []string `protobuf:"bytes,3,rep,name=records" json:"records,omitempty"`
+	Error            *string  `protobuf:"bytes,4,opt,name=error" json:"error,omitempty"`
+	XXX_unrecognized []byte   `json:"-"`
+}
+
+func (m *CAALookupStep) Reset()                    { *m = CAALookupStep{} }
+func (m *CAALookupStep) String() string            { return proto1.CompactTextString(m) }
+func (*CAALookupStep) ProtoMessage()               {}
+func (*CAALookupStep) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{3} }
+
+func (m *CAALookupStep) GetName() string {
+	if m != nil && m.Name != nil {
+		return *m.Name
+	}
+	return ""
+}
+
+func (m *CAALookupStep) GetAliases() []string {
+	if m != nil {
+		return m.Aliases
+	}
+	return nil
+}
+
+func (m *CAALookupStep) GetRecords() []string {
+	if m != nil {
+		return m.Records
+	}
+	return nil
+}
+
+func (m *CAALookupStep) GetError() string {
+	if m != nil && m.Error != nil {
+		return *m.Error
+	}
+	return ""
+}
+
+type ValidationAttempt struct {
+	Time             *int64              `protobuf:"varint,1,opt,name=time" json:"time,omitempty"`
+	Records          []*ValidationRecord `protobuf:"bytes,2,rep,name=records" json:"records,omitempty"`
+	Error            *ProblemDetails     `protobuf:"bytes,3,opt,name=error" json:"error,omitempty"`
+	XXX_unrecognized []byte              `json:"-"`
+}
+
+func (m *ValidationAttempt) Reset()                    { *m = ValidationAttempt{} }
+func (m *ValidationAttempt) String() string            { return proto1.CompactTextString(m) }
+func (*ValidationAttempt) ProtoMessage()               {}
+func (*ValidationAttempt) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{4} }
+
+func (m *ValidationAttempt) GetTime() int64 {
+	if m != nil && m.Time != nil {
+		return *m.Time
+	}
+	return 0
+}
+
+func (m *ValidationAttempt) GetRecords() []*ValidationRecord {
+	if m != nil {
+		return m.Records
+	}
+	return nil
+}
+
+func (m *ValidationAttempt) GetError() *ProblemDetails {
+	if m != nil {
+		return m.Error
+	}
+	return nil
+}
+
 func init() {
 	proto1.RegisterType((*Challenge)(nil), "core.Challenge")
 	proto1.RegisterType((*ValidationRecord)(nil), "core.ValidationRecord")
 	proto1.RegisterType((*ProblemDetails)(nil), "core.ProblemDetails")
+	proto1.RegisterType((*CAALookupStep)(nil), "core.CAALookupStep")
+	proto1.RegisterType((*ValidationAttempt)(nil), "core.ValidationAttempt")
 }
 
 func init() { proto1.RegisterFile("core/proto/core.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 309 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0x64, 0x51, 0xcb, 0x4e, 0x02, 0x41,
-	0x10, 0xcc, 0xb2, 0x2c, 0xb8, 0xbd, 0x48, 0x60, 0x7d, 0x64, 0xbc, 0x11, 0xbc, 0x70, 0x82, 0xc8,
-	0x1f, 0xf8, 0xb8, 0x78, 0x33, 0xf8, 0x38, 0x78, 0x1b, 0x9d, 0x8e, 0x3b, 0x61, 0xd8, 0xd9, 0xcc,
-	0x34, 0x24, 0x78, 0xf6, 0xcf, 0xfc, 0x31, 0xe7, 0xb1, 0x98, 0x18, 0x6f, 0x5d, 0x55, 0xdd, 0x93,
-	0xaa, 0x1a, 0x38, 0x7b, 0xd7, 0x06, 0x17, 0x8d, 0xd1, 0xa4, 0x17, 0x7e, 0x9c, 0x87, 0xb1, 0xec,
-	0xfa, 0x79, 0xfa, 0x9d, 0x40, 0x7e, 0x5b, 0x71, 0xa5, 0xb0, 0xfe, 0xc0, 0x12, 0xa0, 0x23, 0x05,
-	0x4b, 0x26, 0xc9, 0x2c, 0x2d, 0x07, 0xd0, 0xa5, 0x7d, 0x83, 0xac, 0xe3, 0x50, 0x5e, 0x0e, 0xa1,
-	0x67, 0x89, 0xd3, 0xd6, 0xb2, 0x5e, 0xc0, 0x05, 0xa4, 0x5b, 0x23, 0x59, 0x1e, 0xc0, 0x31, 0x64,
-	0xa4, 0xd7, 0x58, 0xb3, 0x34, 0x40, 0x06, 0xa3, 0x35, 0xee, 0xaf, 0xb7, 0x54, 0x69, 0x23, 0x3f,
-	0x39, 0x49, 0x5d, 0xb3, 0x2c, 0x28, 0x57, 0x30, 0xde, 0x71, 0x25, 0x45, 0xe0, 0x0c, 0x3a, 0x07,
-	0xc2, 0x32, 0x98, 0xa4, 0xb3, 0x62, 0x79, 0x3e, 0x0f, 0xde, 0x5e, 0x7e, 0xe5, 0x55, 0x90, 0xcb,
-	0x4b, 0xc8, 0xd0, 0x18, 0x6d, 0x58, 0xdf, 0xbd, 0x50, 0x2c, 0x4f, 0xe3, 0xda, 0x83, 0xd1, 0x6f,
-	0x0a, 0x37, 0x77, 0x48, 0x5c, 0x2a, 0x3b, 0xfd, 0x4a, 0x60, 0xf4, 0xef, 0x72, 0x04, 0x47, 0x95,
-	0xb6, 0x54, 0xf3, 0x0d, 0x86, 0x48, 0xb9, 0x8f, 0xd4, 0x68, 0x43, 0x6d, 0xa4, 0x0b, 0x18, 0x73,
-	0x21, 0x0c, 0x5a, 0x8b, 0x76, 0x85, 0x56, 0xab, 0x1d, 0x0a, 0x97, 0x20, 0x9d, 0x0d, 0xca, 0x13,
-	0x28, 0x5a, 0xe9, 0xd9, 0x3a, 0xb2, 0xeb, 0xf6, 0x23, 0x19, 0x33, 0x91, 0x44, 0xeb, 0x12, 0xa5,
-	0x87, 0x1e, 0x54, 0x2c, 0x65, 0x7a, 0x0f, 0xc3, 0xbf, 0xc6, 0xfc, 0x4d, 0x13, 0x99, 0x27, 0xdf,
-	0x65, 0x72, 0xe8, 0x52, 0x04, 0xbd, 0x35, 0xe2, 0x6a, 0xaf, 0x88, 0x9a, 0xc7, 0xd8, 0xaf, 0xef,
-	0x30, 0xbb, 0xe9, 0xbf, 0x66, 0xe1, 0x9b, 0x7e, 0x02, 0x00, 0x00, 0xff, 0xff, 0x1c, 0xa6, 0xad,
-	0x9d, 0xbe, 0x01, 0x00, 0x00,
+	// 439 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0x8c, 0x92, 0xcf, 0x6e, 0xd3, 0x40,
+	0x10, 0xc6, 0x65, 0x6f, 0x1c, 0xd7, 0x93, 0x3f, 0x4d, 0xb6, 0xb4, 0x2c, 0x37, 0xcb, 0x48, 0xe0,
+	0x53, 0x2b, 0xfa, 0x06, 0xa1, 0x5c, 0x90, 0x10, 0x42, 0x6d, 0xe1, 0xc0, 0x6d, 0x89, 0x47, 0x64,
+	0x15, 0x27, 0xbb, 0xda, 0x1d, 0x47, 0x0a, 0x0f, 0xc1, 0x4b, 0xf1, 0x62, 0xc8, 0x63, 0xa7, 0x50,
+	0x22, 0xa4, 0xde, 0x66, 0xe6, 0xb3, 0x67, 0xe7, 0xfb, 0xcd, 0xc0, 0xf9, 0xd2, 0x7a, 0xbc, 0x72,
+	0xde, 0x92, 0xbd, 0x6a, 0xc3, 0x4b, 0x0e, 0xe5, 0xa0, 0x8d, 0x8b, 0x5f, 0x11, 0x64, 0x37, 0x2b,
+	0x5d, 0xd7, 0xb8, 0xfd, 0x8e, 0x12, 0x20, 0x36, 0x95, 0x8a, 0xf2, 0xa8, 0x14, 0x72, 0x0c, 0x03,
+	0xda, 0x3b, 0x54, 0x71, 0x1e, 0x95, 0x99, 0x9c, 0xc2, 0x30, 0x90, 0xa6, 0x26, 0xa8, 0x21, 0xe7,
+	0x23, 0x10, 0x8d, 0x37, 0x2a, 0xe3, 0x64, 0x02, 0x09, 0xd9, 0x35, 0x6e, 0x95, 0xe0, 0x54, 0xc1,
+	0x6c, 0x8d, 0xfb, 0x45, 0x43, 0x2b, 0xeb, 0xcd, 0x0f, 0x4d, 0xc6, 0x6e, 0x55, 0xc2, 0xca, 0x1b,
+	0x98, 0xef, 0x74, 0x6d, 0x2a, 0xae, 0x79, 0x5c, 0x5a, 0x5f, 0x05, 0x05, 0xb9, 0x28, 0x47, 0xd7,
+	0x17, 0x97, 0x3c, 0xdb, 0x97, 0x07, 0xf9, 0x96, 0x65, 0xf9, 0x12, 0x12, 0xf4, 0xde, 0x7a, 0x95,
+	0xe6, 0x51, 0x39, 0xba, 0x7e, 0xd6, 0x7d, 0xf6, 0xc9, 0xdb, 0x6f, 0x35, 0x6e, 0xde, 0x21, 0x69,
+	0x53, 0x87, 0xe2, 0x67, 0x0c, 0xb3, 0xa3, 0x3f, 0x67, 0x70, 0xb2, 0xb2, 0x81, 0xb6, 0x7a, 0x83,
+	0x6c, 0x29, 0x6b, 0x2d, 0x39, 0xeb, 0xa9, 0xb7, 0xf4, 0x02, 0xe6, 0xba, 0xaa, 0x3c, 0x86, 0x80,
+	0xe1, 0x16, 0x83, 0xad, 0x77, 0x58, 0x29, 0x91, 0x8b, 0x72, 0x2c, 0xcf, 0x60, 0xd4, 0x4b, 0x9f,
+	0x03, 0x56, 0x6a, 0x90, 0x47, 0x7d, 0xb1, 0xf3, 0x44, 0x06, 0x83, 0x4a, 0x72, 0x71, 0xe0, 0x50,
+	0xf7, 0x50, 0x5e, 0x41, 0xb6, 0xd4, 0xfa, 0x83, 0xb5, 0xeb, 0xc6, 0xa9, 0x94, 0x6d, 0x9d, 0x75,
+	0xf3, 0xde, 0x2c, 0x16, 0x5d, 0xf9, 0x8e, 0xd0, 0xc9, 0x73, 0x98, 0x2c, 0xb5, 0xee, 0xc6, 0xe4,
+	0x07, 0x4e, 0x7a, 0x3a, 0x33, 0xe7, 0x71, 0x67, 0x6c, 0x13, 0x16, 0x44, 0xb8, 0x71, 0x14, 0x54,
+	0xc6, 0x5d, 0x9e, 0xff, 0x0b, 0xa7, 0xd7, 0xe5, 0x05, 0x4c, 0x1f, 0x3c, 0xdc, 0x7b, 0x83, 0x15,
+	0xd3, 0x1c, 0x17, 0xef, 0x61, 0xfa, 0x18, 0x51, 0x3b, 0xbd, 0xeb, 0x2a, 0xf7, 0x7b, 0x77, 0x00,
+	0x32, 0x85, 0x61, 0xc5, 0x7a, 0x8f, 0x44, 0x02, 0xac, 0x88, 0xdc, 0x5d, 0xb7, 0xe9, 0x76, 0x9b,
+	0x49, 0xf1, 0x11, 0x26, 0x8f, 0xa7, 0x1f, 0xc3, 0xe0, 0x2f, 0xa6, 0xa7, 0x90, 0xea, 0xda, 0xe8,
+	0x80, 0x41, 0xc5, 0x4c, 0xe4, 0x14, 0xd2, 0xc3, 0x66, 0x05, 0x17, 0x26, 0x87, 0x0d, 0xb6, 0x18,
+	0xb3, 0xc2, 0xc2, 0xfc, 0xd8, 0x47, 0x7b, 0x6c, 0xa6, 0xef, 0x29, 0xe4, 0xeb, 0x3f, 0x2d, 0xe2,
+	0xa7, 0x1d, 0x87, 0xf8, 0xff, 0x71, 0xbc, 0x4d, 0xbf, 0x26, 0x7c, 0xf1, 0xbf, 0x07, 0x00, 0xe9,
+	0xc5, 0x8c, 0x93, 0x09, 0x03, 0x00, 0x00,
 }
@@ -3,8 +3,11 @@ package core
 import (
 	"crypto"
 	"crypto/rand"
+	"crypto/sha1"
 	"crypto/sha256"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
@@ -20,6 +23,7 @@ import (
 	"net/url"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 	"unicode"
@@ -381,9 +385,51 @@ func LoadCert(filename string) (cert *x509.Certificate, err error) {
 	return
 }
 
+// IsShortLived returns true if cert is a short-lived certificate without OCSP:
+// it has no OCSP URL, and is valid for at most MaxNoOCSPValidity. OCSP
+// responses are never generated or served for such certificates.
+func IsShortLived(cert *x509.Certificate) bool {
+	return len(cert.OCSPServer) == 0 && cert.NotAfter.Sub(cert.NotBefore) <= MaxNoOCSPValidity
+}
+
 // retryJitter is used to prevent bunched retried queries from falling into lockstep
 const retryJitter = 0.2
 
+// ParseOID parses an object identifier in dotted decimal form, such as
+// "2.23.140.1.2.1".
+func ParseOID(dotted string) (asn1.ObjectIdentifier, error) {
+	var oid asn1.ObjectIdentifier
+	for _, arc := range strings.Split(dotted, ".") {
+		n, err := strconv.Atoi(arc)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid OID %q", dotted)
+		}
+		oid = append(oid, n)
+	}
+	if len(oid) < 2 {
+		return nil, fmt.Errorf("invalid OID %q", dotted)
+	}
+	return oid, nil
+}
+
+// SubjectKeyID returns the SHA-1 hash of the subjectPublicKey bits of pub
+// (RFC 5280, Section 4.2.1.2, method 1).
+func SubjectKeyID(pub crypto.PublicKey) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+	var spki struct {
+		Algorithm        pkix.AlgorithmIdentifier
+		SubjectPublicKey asn1.BitString
+	}
+	if _, err = asn1.Unmarshal(der, &spki); err != nil {
+		return nil, err
+	}
+	hash := sha1.Sum(spki.SubjectPublicKey.Bytes)
+	return hash[:], nil
+}
+
 // RetryBackoff calculates a backoff time based on number of retries, will always
 // add jitter so requests that start in unison won't fall into lockstep. Because of
 // this the returned duration can always be larger than the maximum by a factor of
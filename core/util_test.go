@@ -1,6 +1,8 @@
 package core
 
 import (
+	"crypto/x509"
+	"encoding/asn1"
 	"encoding/json"
 	"fmt"
 	"math"
@@ -9,6 +11,7 @@ import (
 	"reflect"
 	"sort"
 	"testing"
+	"time"
 
 	"github.com/square/go-jose"
 
@@ -161,3 +164,24 @@ func TestProblemDetailsFromError(t *testing.T) {
 	p := ProblemDetailsForError(expected, "k")
 	test.AssertDeepEquals(t, expected, p)
 }
+
+func TestIsShortLived(t *testing.T) {
+	now := time.Now()
+	cert := &x509.Certificate{NotBefore: now, NotAfter: now.Add(MaxNoOCSPValidity)}
+	test.Assert(t, IsShortLived(cert), "Certificate without OCSP URL isn't short-lived")
+	cert.OCSPServer = []string{"http://example.com/ocsp"}
+	test.Assert(t, !IsShortLived(cert), "Certificate with OCSP URL is short-lived")
+	cert.OCSPServer = nil
+	cert.NotAfter = cert.NotAfter.Add(time.Second)
+	test.Assert(t, !IsShortLived(cert), "Long-lived certificate is short-lived")
+}
+
+func TestParseOID(t *testing.T) {
+	oid, err := ParseOID("2.23.140.1.2.1")
+	test.AssertNotError(t, err, "Failed to parse OID")
+	test.Assert(t, oid.Equal(asn1.ObjectIdentifier{2, 23, 140, 1, 2, 1}), "Wrong OID")
+	for _, bad := range []string{"", "2", "2..1", "2.-1", "2.x"} {
+		_, err = ParseOID(bad)
+		test.AssertError(t, err, fmt.Sprintf("Parsed invalid OID %q", bad))
+	}
+}
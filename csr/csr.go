@@ -31,8 +31,9 @@ var badSignatureAlgorithms = map[oldx509.SignatureAlgorithm]bool{
 }
 
 // VerifyCSR checks the validity of a x509.CertificateRequest. Before doing checks it normalizes
-// the CSR which lowers the case of DNS names and subject CN, and if forceCNFromSAN is true it
-// will hoist a DNS name into the CN if it is empty.
+// the CSR which lowers the case of DNS names, email addresses and subject CN, and if
+// forceCNFromSAN is true it will hoist a DNS name or email address into the CN if it is empty.
+// A CSR may request either DNS names or email addresses, but not both.
 func VerifyCSR(csr *oldx509.CertificateRequest, maxNames int, keyPolicy *goodkey.KeyPolicy, pa core.PolicyAuthority, forceCNFromSAN bool, regID int64) error {
 	normalizeCSR(csr, forceCNFromSAN)
 	key, ok := csr.PublicKey.(crypto.PublicKey)
@@ -50,15 +51,21 @@ func VerifyCSR(csr *oldx509.CertificateRequest, maxNames int, keyPolicy *goodkey
 	if err := csr.CheckSignature(); err != nil {
 		return errors.New("invalid signature on CSR")
 	}
-	if len(csr.DNSNames) == 0 && csr.Subject.CommonName == "" {
+	if len(csr.DNSNames) == 0 && len(csr.EmailAddresses) == 0 && csr.Subject.CommonName == "" {
 		return errors.New("at least one DNS name is required")
 	}
+	if len(csr.DNSNames) > 0 && len(csr.EmailAddresses) > 0 {
+		return errors.New("CSR cannot contain both DNS names and email addresses")
+	}
 	if len(csr.Subject.CommonName) > maxCNLength {
 		return fmt.Errorf("CN was longer than %d bytes", maxCNLength)
 	}
 	if maxNames > 0 && len(csr.DNSNames) > maxNames {
 		return fmt.Errorf("CSR contains more than %d DNS names", maxNames)
 	}
+	if maxNames > 0 && len(csr.EmailAddresses) > maxNames {
+		return fmt.Errorf("CSR contains more than %d email addresses", maxNames)
+	}
 	badNames := []string{}
 	for _, name := range csr.DNSNames {
 		if err := pa.WillingToIssue(core.AcmeIdentifier{
@@ -68,22 +75,39 @@ func VerifyCSR(csr *oldx509.CertificateRequest, maxNames int, keyPolicy *goodkey
 			badNames = append(badNames, name)
 		}
 	}
+	for _, address := range csr.EmailAddresses {
+		if err := pa.WillingToIssue(core.AcmeIdentifier{
+			Type:  core.IdentifierEmail,
+			Value: address,
+		}); err != nil {
+			badNames = append(badNames, address)
+		}
+	}
 	if len(badNames) > 0 {
 		return fmt.Errorf("policy forbids issuing for: %s", strings.Join(badNames, ", "))
 	}
 	return nil
 }
 
-// normalizeCSR deduplicates and lowers the case of dNSNames and the subject CN.
-// If forceCNFromSAN is true it will also hoist a dNSName into the CN if it is empty.
+// normalizeCSR deduplicates and lowers the case of dNSNames, email addresses and
+// the subject CN. A CN containing "@" is treated as an email address rather than
+// a DNS name. If forceCNFromSAN is true it will also hoist a dNSName, or failing
+// that an email address, into the CN if it is empty.
 func normalizeCSR(csr *oldx509.CertificateRequest, forceCNFromSAN bool) {
 	if forceCNFromSAN && csr.Subject.CommonName == "" {
 		if len(csr.DNSNames) > 0 {
 			csr.Subject.CommonName = csr.DNSNames[0]
+		} else if len(csr.EmailAddresses) > 0 {
+			csr.Subject.CommonName = csr.EmailAddresses[0]
 		}
+	} else if strings.Contains(csr.Subject.CommonName, "@") {
+		csr.EmailAddresses = append(csr.EmailAddresses, csr.Subject.CommonName)
 	} else if csr.Subject.CommonName != "" {
 		csr.DNSNames = append(csr.DNSNames, csr.Subject.CommonName)
 	}
 	csr.Subject.CommonName = strings.ToLower(csr.Subject.CommonName)
 	csr.DNSNames = core.UniqueLowerNames(csr.DNSNames)
+	if len(csr.EmailAddresses) > 0 {
+		csr.EmailAddresses = core.UniqueLowerNames(csr.EmailAddresses)
+	}
 }
@@ -52,6 +52,19 @@ func TestVerifyCSR(t *testing.T) {
 	signedReqWithBadName := new(oldx509.CertificateRequest)
 	*signedReqWithBadName = *signedReq
 	signedReqWithBadName.DNSNames = []string{"bad-name.com"}
+	signedReqWithMixedNames := new(oldx509.CertificateRequest)
+	*signedReqWithMixedNames = *signedReq
+	signedReqWithMixedNames.DNSNames = []string{"a.com"}
+	signedReqWithMixedNames.EmailAddresses = []string{"alice@a.com"}
+	signedReqWithEmails := new(oldx509.CertificateRequest)
+	*signedReqWithEmails = *signedReq
+	signedReqWithEmails.EmailAddresses = []string{"alice@a.com", "bob@a.com"}
+	signedReqWithBadEmail := new(oldx509.CertificateRequest)
+	*signedReqWithBadEmail = *signedReq
+	signedReqWithBadEmail.EmailAddresses = []string{"alice@a.com", "bad-name.com"}
+	signedReqWithEmailCN := new(oldx509.CertificateRequest)
+	*signedReqWithEmailCN = *signedReq
+	signedReqWithEmailCN.Subject.CommonName = "Alice@a.com"
 
 	cases := []struct {
 		csr           *oldx509.CertificateRequest
@@ -117,6 +130,38 @@ func TestVerifyCSR(t *testing.T) {
 			0,
 			errors.New("policy forbids issuing for: bad-name.com"),
 		},
+		{
+			signedReqWithMixedNames,
+			2,
+			testingPolicy,
+			&mockPA{},
+			0,
+			errors.New("CSR cannot contain both DNS names and email addresses"),
+		},
+		{
+			signedReqWithEmails,
+			1,
+			testingPolicy,
+			&mockPA{},
+			0,
+			errors.New("CSR contains more than 1 email addresses"),
+		},
+		{
+			signedReqWithBadEmail,
+			2,
+			testingPolicy,
+			&mockPA{},
+			0,
+			errors.New("policy forbids issuing for: bad-name.com"),
+		},
+		{
+			signedReqWithEmailCN,
+			1,
+			testingPolicy,
+			&mockPA{},
+			0,
+			nil,
+		},
 	}
 
 	for _, c := range cases {
@@ -169,3 +214,19 @@ func TestNormalizeCSR(t *testing.T) {
 		test.AssertDeepEquals(t, c.expectedNames, c.expectedNames)
 	}
 }
+
+func TestNormalizeCSREmail(t *testing.T) {
+	csr := &oldx509.CertificateRequest{
+		Subject:        pkix.Name{CommonName: "Alice@A.com"},
+		EmailAddresses: []string{"alice@a.com", "Bob@a.com"},
+	}
+	normalizeCSR(csr, false)
+	test.AssertEquals(t, csr.Subject.CommonName, "alice@a.com")
+	test.AssertDeepEquals(t, csr.EmailAddresses, []string{"alice@a.com", "bob@a.com"})
+	test.AssertEquals(t, len(csr.DNSNames), 0)
+
+	csr = &oldx509.CertificateRequest{EmailAddresses: []string{"Bob@a.com"}}
+	normalizeCSR(csr, true)
+	test.AssertEquals(t, csr.Subject.CommonName, "bob@a.com")
+	test.AssertDeepEquals(t, csr.EmailAddresses, []string{"bob@a.com"})
+}
@@ -7,6 +7,7 @@ package grpc
 
 import (
 	"net"
+	"time"
 
 	"github.com/square/go-jose"
 	"google.golang.org/grpc/codes"
@@ -122,6 +123,28 @@ func validationRecordToPB(record core.ValidationRecord) (*corepb.ValidationRecor
 	if err != nil {
 		return nil, err
 	}
+	var addrsTried [][]byte
+	for _, v := range record.AddressesTried {
+		addrsTried = append(addrsTried, []byte(v))
+	}
+	var caaLookup []*corepb.CAALookupStep
+	for _, step := range record.CAALookup {
+		step := step
+		caaLookup = append(caaLookup, &corepb.CAALookupStep{
+			Name:    &step.Name,
+			Aliases: step.Aliases,
+			Records: step.Records,
+			Error:   &step.Error,
+		})
+	}
+	var previousAttempts []*corepb.ValidationAttempt
+	for _, attempt := range record.PreviousAttempts {
+		pbAttempt, err := validationAttemptToPB(attempt)
+		if err != nil {
+			return nil, err
+		}
+		previousAttempts = append(previousAttempts, pbAttempt)
+	}
 	return &corepb.ValidationRecord{
 		Hostname:          &record.Hostname,
 		Port:              &record.Port,
@@ -129,6 +152,10 @@ func validationRecordToPB(record core.ValidationRecord) (*corepb.ValidationRecor
 		AddressUsed:       addrUsed,
 		Authorities:       record.Authorities,
 		Url:               &record.URL,
+		CaaLookup:         caaLookup,
+		CaaRecordUsed:     &record.CAARecordUsed,
+		PreviousAttempts:  previousAttempts,
+		AddressesTried:    addrsTried,
 	}, nil
 }
 
@@ -148,6 +175,27 @@ func pbToValidationRecord(in *corepb.ValidationRecord) (record core.ValidationRe
 	if err != nil {
 		return
 	}
+	var addrsTried []net.IP
+	for _, v := range in.AddressesTried {
+		addrsTried = append(addrsTried, net.IP(v))
+	}
+	var caaLookup []core.CAALookupStep
+	for _, step := range in.CaaLookup {
+		caaLookup = append(caaLookup, core.CAALookupStep{
+			Name:    step.GetName(),
+			Aliases: step.Aliases,
+			Records: step.Records,
+			Error:   step.GetError(),
+		})
+	}
+	var previousAttempts []core.ValidationAttempt
+	for _, pbAttempt := range in.PreviousAttempts {
+		attempt, err := pbToValidationAttempt(pbAttempt)
+		if err != nil {
+			return core.ValidationRecord{}, err
+		}
+		previousAttempts = append(previousAttempts, attempt)
+	}
 	return core.ValidationRecord{
 		Hostname:          *in.Hostname,
 		Port:              *in.Port,
@@ -155,6 +203,54 @@ func pbToValidationRecord(in *corepb.ValidationRecord) (record core.ValidationRe
 		AddressUsed:       addrUsed,
 		Authorities:       in.Authorities,
 		URL:               *in.Url,
+		CAALookup:         caaLookup,
+		CAARecordUsed:     in.GetCaaRecordUsed(),
+		PreviousAttempts:  previousAttempts,
+		AddressesTried:    addrsTried,
+	}, nil
+}
+
+func validationAttemptToPB(attempt core.ValidationAttempt) (*corepb.ValidationAttempt, error) {
+	records := make([]*corepb.ValidationRecord, len(attempt.Records))
+	for i, v := range attempt.Records {
+		record, err := validationRecordToPB(v)
+		if err != nil {
+			return nil, err
+		}
+		records[i] = record
+	}
+	prob, err := problemDetailsToPB(attempt.Error)
+	if err != nil {
+		return nil, err
+	}
+	t := attempt.Time.UnixNano()
+	return &corepb.ValidationAttempt{
+		Time:    &t,
+		Records: records,
+		Error:   prob,
+	}, nil
+}
+
+func pbToValidationAttempt(in *corepb.ValidationAttempt) (core.ValidationAttempt, error) {
+	if in == nil || in.Time == nil {
+		return core.ValidationAttempt{}, ErrMissingParameters
+	}
+	var records []core.ValidationRecord
+	for _, v := range in.Records {
+		record, err := pbToValidationRecord(v)
+		if err != nil {
+			return core.ValidationAttempt{}, err
+		}
+		records = append(records, record)
+	}
+	prob, err := pbToProblemDetails(in.Error)
+	if err != nil {
+		return core.ValidationAttempt{}, err
+	}
+	return core.ValidationAttempt{
+		Time:    time.Unix(0, *in.Time),
+		Records: records,
+		Error:   prob,
 	}, nil
 }
 
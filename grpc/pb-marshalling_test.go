@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"net"
 	"testing"
+	"time"
 
 	"github.com/square/go-jose"
 
@@ -139,6 +140,40 @@ func TestValidationRecord(t *testing.T) {
 	recon, err := pbToValidationRecord(pb)
 	test.AssertNotError(t, err, "pbToValidationRecord failed")
 	test.AssertDeepEquals(t, recon, vr)
+
+	vr.CAALookup = []core.CAALookupStep{
+		{Name: "www.host", Error: "SERVFAIL"},
+		{Name: "host", Aliases: []string{"other."}, Records: []string{"other.\t0\tIN\tCAA\t0 issue \"ca.com\""}},
+	}
+	vr.CAARecordUsed = vr.CAALookup[1].Records[0]
+	pb, err = validationRecordToPB(vr)
+	test.AssertNotError(t, err, "validationRecordToPB failed")
+	recon, err = pbToValidationRecord(pb)
+	test.AssertNotError(t, err, "pbToValidationRecord failed")
+	test.AssertDeepEquals(t, recon, vr)
+
+	vr.PreviousAttempts = []core.ValidationAttempt{
+		{Time: time.Unix(0, 1000), Error: probs.ConnectionFailure("timeout")},
+		{
+			Time:    time.Unix(0, 2000),
+			Records: []core.ValidationRecord{{Hostname: "host", Port: "80", AddressesResolved: []net.IP{ip}, AddressUsed: ip, URL: "url"}},
+			Error:   probs.ConnectionFailure("connection refused"),
+		},
+	}
+	pb, err = validationRecordToPB(vr)
+	test.AssertNotError(t, err, "validationRecordToPB failed")
+	recon, err = pbToValidationRecord(pb)
+	test.AssertNotError(t, err, "pbToValidationRecord failed")
+	test.AssertDeepEquals(t, recon, vr)
+
+	ip6 := net.ParseIP("2001:db8::1")
+	vr.AddressesResolved = []net.IP{ip, ip6}
+	vr.AddressesTried = []net.IP{ip6, ip}
+	pb, err = validationRecordToPB(vr)
+	test.AssertNotError(t, err, "validationRecordToPB failed")
+	recon, err = pbToValidationRecord(pb)
+	test.AssertNotError(t, err, "pbToValidationRecord failed")
+	test.AssertDeepEquals(t, recon, vr)
 }
 
 func TestValidationResult(t *testing.T) {
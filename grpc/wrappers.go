@@ -106,6 +106,17 @@ func (pc *PublisherClientWrapper) SubmitToCT(ctx context.Context, der []byte) er
 	return err
 }
 
+// SubmitPrecertToCT makes a call to the gRPC version of the publisher
+func (pc *PublisherClientWrapper) SubmitPrecertToCT(ctx context.Context, der []byte) ([][]byte, error) {
+	localCtx, cancel := context.WithTimeout(ctx, pc.timeout)
+	defer cancel()
+	resp, err := pc.inner.SubmitPrecertToCT(localCtx, &pubPB.Request{Der: der})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Sct, nil
+}
+
 // PublisherServerWrapper is a wrapper required to bridge the differences between the
 // gRPC and previous AMQP interfaces
 type PublisherServerWrapper struct {
@@ -125,3 +136,16 @@ func (pub *PublisherServerWrapper) SubmitToCT(ctx context.Context, request *pubP
 	}
 	return &pubPB.Empty{}, pub.inner.SubmitToCT(ctx, request.Der)
 }
+
+// SubmitPrecertToCT calls the same method on the wrapped publisher.Impl since
+// their interfaces are different
+func (pub *PublisherServerWrapper) SubmitPrecertToCT(ctx context.Context, request *pubPB.Request) (*pubPB.SCTs, error) {
+	if request == nil || request.Der == nil {
+		return nil, errors.New("incomplete SubmitPrecertToCT gRPC message")
+	}
+	scts, err := pub.inner.SubmitPrecertToCT(ctx, request.Der)
+	if err != nil {
+		return nil, err
+	}
+	return &pubPB.SCTs{Sct: scts}, nil
+}
@@ -0,0 +1,141 @@
+// Package lint checks certificates for problems before they are issued. The
+// CA builds each certificate twice: once signed by a throwaway key that no one
+// trusts, which is checked by a Linter, and, only if that passes, once for
+// real.
+package lint
+
+import (
+	"crypto/x509"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/goodkey"
+)
+
+// Context holds what lints need to know besides the certificate itself.
+type Context struct {
+	// The policy names in the certificate must satisfy
+	PA core.PolicyAuthority
+	// The policy the certificate's public key must satisfy
+	KeyPolicy *goodkey.KeyPolicy
+	// The longest a certificate may be valid for. Zero means no limit.
+	MaxValidity time.Duration
+}
+
+// A Lint is a single named check of a certificate. Check returns an error
+// describing the problem if the certificate fails it.
+type Lint struct {
+	Name        string
+	Description string
+	Check       func(cert *x509.Certificate, ctx *Context) error
+}
+
+var (
+	registryMu sync.Mutex
+	registry   = make(map[string]*Lint)
+)
+
+// Register makes a lint available to Linters. It panics if a lint with the
+// same name is already registered, or if the lint has no name or check.
+func Register(l Lint) {
+	if l.Name == "" || l.Check == nil {
+		panic("lint: Register called with an incomplete lint")
+	}
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := registry[l.Name]; ok {
+		panic(fmt.Sprintf("lint: Register called twice for %q", l.Name))
+	}
+	registry[l.Name] = &l
+}
+
+// Names returns the names of all registered lints, sorted.
+func Names() []string {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	var names []string
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Linter runs every registered lint except those disabled.
+type Linter struct {
+	lints       []*Lint
+	keyPolicy   *goodkey.KeyPolicy
+	maxValidity time.Duration
+}
+
+// New returns a Linter that runs all registered lints except those named in
+// disabled. It is an error to disable a lint that doesn't exist, since that
+// is most likely a typo that would leave the intended lint enabled.
+func New(disabled []string, keyPolicy *goodkey.KeyPolicy, maxValidity time.Duration) (*Linter, error) {
+	skip := make(map[string]bool)
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	for _, name := range disabled {
+		if _, ok := registry[name]; !ok {
+			return nil, fmt.Errorf("can't disable unknown lint %q", name)
+		}
+		skip[name] = true
+	}
+	l := &Linter{keyPolicy: keyPolicy, maxValidity: maxValidity}
+	for name, lint := range registry {
+		if !skip[name] {
+			l.lints = append(l.lints, lint)
+		}
+	}
+	sort.Sort(byName(l.lints))
+	return l, nil
+}
+
+type byName []*Lint
+
+func (b byName) Len() int           { return len(b) }
+func (b byName) Less(i, j int) bool { return b[i].Name < b[j].Name }
+func (b byName) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+
+// Error lists the lints a certificate failed, and why.
+type Error struct {
+	// Failures maps lint names to the problems they found
+	Failures map[string]string
+}
+
+func (e *Error) Error() string {
+	var names []string
+	for name := range e.Failures {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var parts []string
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf("%s: %s", name, e.Failures[name]))
+	}
+	return "certificate failed lints: " + strings.Join(parts, "; ")
+}
+
+// Check runs the lints against cert, using pa for name policy, and returns an
+// *Error if any of them fail.
+func (l *Linter) Check(cert *x509.Certificate, pa core.PolicyAuthority) error {
+	ctx := &Context{
+		PA:          pa,
+		KeyPolicy:   l.keyPolicy,
+		MaxValidity: l.maxValidity,
+	}
+	failures := make(map[string]string)
+	for _, lint := range l.lints {
+		if err := lint.Check(cert, ctx); err != nil {
+			failures[lint.Name] = err.Error()
+		}
+	}
+	if len(failures) > 0 {
+		return &Error{Failures: failures}
+	}
+	return nil
+}
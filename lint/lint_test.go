@@ -0,0 +1,116 @@
+package lint
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/goodkey"
+	"github.com/letsencrypt/boulder/test"
+)
+
+// mockPA refuses to issue for the names in bad.
+type mockPA struct {
+	bad map[string]bool
+}
+
+func (pa *mockPA) WillingToIssue(id core.AcmeIdentifier) error {
+	if pa.bad[id.Value] {
+		return core.MalformedRequestError("policy forbids issuing for name")
+	}
+	return nil
+}
+
+func (pa *mockPA) ChallengesFor(_ core.AcmeIdentifier) ([]core.Challenge, [][]int) {
+	return nil, nil
+}
+
+// makeCert returns a certificate that passes every lint, after applying
+// mutate to its template.
+func makeCert(t *testing.T, mutate func(*x509.Certificate)) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	test.AssertNotError(t, err, "Failed to generate key")
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "not-example.com"},
+		NotBefore:             now,
+		NotAfter:              now.Add(90 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              []string{"not-example.com", "www.not-example.com"},
+		OCSPServer:            []string{"http://not-example.com/ocsp"},
+	}
+	if mutate != nil {
+		mutate(template)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	test.AssertNotError(t, err, "Failed to create certificate")
+	cert, err := x509.ParseCertificate(der)
+	test.AssertNotError(t, err, "Failed to parse certificate")
+	return cert
+}
+
+func TestRegister(t *testing.T) {
+	defer func() {
+		test.Assert(t, recover() != nil, "Registering a duplicate lint didn't panic")
+	}()
+	Register(Lint{
+		Name:  "cn_in_sans",
+		Check: func(*x509.Certificate, *Context) error { return nil },
+	})
+}
+
+func TestNew(t *testing.T) {
+	names := Names()
+	test.Assert(t, len(names) > 0, "No lints registered")
+
+	linter, err := New(nil, nil, 0)
+	test.AssertNotError(t, err, "Failed to create linter")
+	test.AssertEquals(t, len(linter.lints), len(names))
+
+	linter, err = New([]string{"cn_in_sans"}, nil, 0)
+	test.AssertNotError(t, err, "Failed to create linter")
+	test.AssertEquals(t, len(linter.lints), len(names)-1)
+	for _, l := range linter.lints {
+		test.Assert(t, l.Name != "cn_in_sans", "Disabled lint still enabled")
+	}
+
+	_, err = New([]string{"cn_in_sanz"}, nil, 0)
+	test.AssertError(t, err, "Disabled unknown lint")
+}
+
+func TestCheck(t *testing.T) {
+	keyPolicy := goodkey.NewKeyPolicy()
+	linter, err := New(nil, &keyPolicy, 90*24*time.Hour)
+	test.AssertNotError(t, err, "Failed to create linter")
+	pa := &mockPA{}
+
+	test.AssertNotError(t, linter.Check(makeCert(t, nil), pa), "Good certificate failed lints")
+
+	cert := makeCert(t, func(c *x509.Certificate) {
+		c.Subject.CommonName = "example.org"
+		c.NotAfter = c.NotBefore.Add(100 * 24 * time.Hour)
+	})
+	err = linter.Check(cert, pa)
+	test.AssertError(t, err, "Bad certificate passed lints")
+	var lintErr *Error
+	test.Assert(t, errors.As(err, &lintErr), "Wrong error type")
+	test.AssertEquals(t, len(lintErr.Failures), 2)
+	_, ok := lintErr.Failures["cn_in_sans"]
+	test.Assert(t, ok, "cn_in_sans didn't fail")
+	_, ok = lintErr.Failures["validity_length"]
+	test.Assert(t, ok, "validity_length didn't fail")
+
+	linter, err = New([]string{"cn_in_sans", "validity_length"}, &keyPolicy, 90*24*time.Hour)
+	test.AssertNotError(t, err, "Failed to create linter")
+	test.AssertNotError(t, linter.Check(cert, pa), "Disabled lints still failed")
+}
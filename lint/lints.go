@@ -0,0 +1,144 @@
+package lint
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/letsencrypt/boulder/core"
+)
+
+func init() {
+	Register(Lint{
+		Name:        "san_present",
+		Description: "The certificate must have at least one DNS name or email address",
+		Check:       checkSANPresent,
+	})
+	Register(Lint{
+		Name:        "cn_in_sans",
+		Description: "The subject common name, if any, must also be a subject alternative name",
+		Check:       checkCNInSANs,
+	})
+	Register(Lint{
+		Name:        "validity_length",
+		Description: "The validity period must be positive and no longer than the configured maximum",
+		Check:       checkValidityLength,
+	})
+	Register(Lint{
+		Name:        "ocsp_url",
+		Description: "The certificate must have an OCSP URL, unless it is short-lived",
+		Check:       checkOCSPURL,
+	})
+	Register(Lint{
+		Name:        "ext_key_usage",
+		Description: "The certificate must not be a CA, and its extended key usages must match its names",
+		Check:       checkExtKeyUsage,
+	})
+	Register(Lint{
+		Name:        "key_policy",
+		Description: "The subject public key must satisfy the key policy",
+		Check:       checkKeyPolicy,
+	})
+	Register(Lint{
+		Name:        "name_policy",
+		Description: "Every name in the certificate must be acceptable to the policy authority",
+		Check:       checkNamePolicy,
+	})
+}
+
+func checkSANPresent(cert *x509.Certificate, _ *Context) error {
+	if len(cert.DNSNames) == 0 && len(cert.EmailAddresses) == 0 {
+		return errors.New("no DNS names or email addresses")
+	}
+	return nil
+}
+
+func checkCNInSANs(cert *x509.Certificate, _ *Context) error {
+	cn := cert.Subject.CommonName
+	if cn == "" {
+		return nil
+	}
+	for _, name := range cert.DNSNames {
+		if name == cn {
+			return nil
+		}
+	}
+	for _, email := range cert.EmailAddresses {
+		if email == cn {
+			return nil
+		}
+	}
+	return fmt.Errorf("common name %q is not a subject alternative name", cn)
+}
+
+func checkValidityLength(cert *x509.Certificate, ctx *Context) error {
+	validity := cert.NotAfter.Sub(cert.NotBefore)
+	if validity <= 0 {
+		return fmt.Errorf("notAfter %s is not after notBefore %s", cert.NotAfter, cert.NotBefore)
+	}
+	if ctx.MaxValidity > 0 && validity > ctx.MaxValidity {
+		return fmt.Errorf("validity %s is longer than the maximum %s", validity, ctx.MaxValidity)
+	}
+	return nil
+}
+
+func checkOCSPURL(cert *x509.Certificate, _ *Context) error {
+	if len(cert.OCSPServer) == 0 && !core.IsShortLived(cert) {
+		return fmt.Errorf("no OCSP URL, and validity is longer than %s", core.MaxNoOCSPValidity)
+	}
+	return nil
+}
+
+func checkExtKeyUsage(cert *x509.Certificate, _ *Context) error {
+	if cert.IsCA {
+		return errors.New("certificate is a CA")
+	}
+	if len(cert.ExtKeyUsage) == 0 {
+		return errors.New("no extended key usages")
+	}
+	has := make(map[x509.ExtKeyUsage]bool)
+	for _, eku := range cert.ExtKeyUsage {
+		if eku == x509.ExtKeyUsageAny {
+			return errors.New("extended key usage includes anyExtendedKeyUsage")
+		}
+		has[eku] = true
+	}
+	if len(cert.DNSNames) > 0 && !has[x509.ExtKeyUsageServerAuth] {
+		return errors.New("DNS names without the server auth extended key usage")
+	}
+	if len(cert.EmailAddresses) > 0 && !has[x509.ExtKeyUsageEmailProtection] {
+		return errors.New("email addresses without the email protection extended key usage")
+	}
+	return nil
+}
+
+func checkKeyPolicy(cert *x509.Certificate, ctx *Context) error {
+	if ctx.KeyPolicy == nil {
+		return nil
+	}
+	return ctx.KeyPolicy.GoodKey(cert.PublicKey)
+}
+
+func checkNamePolicy(cert *x509.Certificate, ctx *Context) error {
+	if ctx.PA == nil {
+		return nil
+	}
+	var problems []string
+	for _, name := range cert.DNSNames {
+		ident := core.AcmeIdentifier{Type: core.IdentifierDNS, Value: name}
+		if err := ctx.PA.WillingToIssue(ident); err != nil {
+			problems = append(problems, fmt.Sprintf("%q: %s", name, err))
+		}
+	}
+	for _, email := range cert.EmailAddresses {
+		ident := core.AcmeIdentifier{Type: core.IdentifierEmail, Value: email}
+		if err := ctx.PA.WillingToIssue(ident); err != nil {
+			problems = append(problems, fmt.Sprintf("%q: %s", email, err))
+		}
+	}
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, ", "))
+	}
+	return nil
+}
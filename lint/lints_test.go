@@ -0,0 +1,110 @@
+package lint
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/goodkey"
+	"github.com/letsencrypt/boulder/test"
+)
+
+func TestCheckSANPresent(t *testing.T) {
+	test.AssertNotError(t, checkSANPresent(makeCert(t, nil), &Context{}), "Rejected certificate with SANs")
+	cert := makeCert(t, func(c *x509.Certificate) {
+		c.DNSNames = nil
+	})
+	test.AssertError(t, checkSANPresent(cert, &Context{}), "Accepted certificate without SANs")
+	cert = makeCert(t, func(c *x509.Certificate) {
+		c.DNSNames = nil
+		c.EmailAddresses = []string{"someone@not-example.com"}
+	})
+	test.AssertNotError(t, checkSANPresent(cert, &Context{}), "Rejected certificate with an email SAN")
+}
+
+func TestCheckCNInSANs(t *testing.T) {
+	test.AssertNotError(t, checkCNInSANs(makeCert(t, nil), &Context{}), "Rejected CN in SANs")
+	cert := makeCert(t, func(c *x509.Certificate) {
+		c.Subject.CommonName = ""
+	})
+	test.AssertNotError(t, checkCNInSANs(cert, &Context{}), "Rejected empty CN")
+	cert = makeCert(t, func(c *x509.Certificate) {
+		c.Subject.CommonName = "NOT-example.com"
+	})
+	test.AssertError(t, checkCNInSANs(cert, &Context{}), "Accepted CN not in SANs")
+	cert = makeCert(t, func(c *x509.Certificate) {
+		c.Subject.CommonName = "someone@not-example.com"
+		c.EmailAddresses = []string{"someone@not-example.com"}
+	})
+	test.AssertNotError(t, checkCNInSANs(cert, &Context{}), "Rejected CN matching an email SAN")
+}
+
+func TestCheckValidityLength(t *testing.T) {
+	ctx := &Context{MaxValidity: 90 * 24 * time.Hour}
+	test.AssertNotError(t, checkValidityLength(makeCert(t, nil), ctx), "Rejected 90 day certificate")
+	long := makeCert(t, func(c *x509.Certificate) {
+		c.NotAfter = c.NotAfter.Add(time.Second)
+	})
+	test.AssertError(t, checkValidityLength(long, ctx), "Accepted overly long certificate")
+	test.AssertNotError(t, checkValidityLength(long, &Context{}), "Rejected certificate without a maximum")
+	backwards := makeCert(t, func(c *x509.Certificate) {
+		c.NotAfter = c.NotBefore.Add(-time.Hour)
+	})
+	test.AssertError(t, checkValidityLength(backwards, &Context{}), "Accepted certificate that expires before it's valid")
+}
+
+func TestCheckOCSPURL(t *testing.T) {
+	test.AssertNotError(t, checkOCSPURL(makeCert(t, nil), &Context{}), "Rejected certificate with an OCSP URL")
+	cert := makeCert(t, func(c *x509.Certificate) {
+		c.OCSPServer = nil
+	})
+	test.AssertError(t, checkOCSPURL(cert, &Context{}), "Accepted long-lived certificate without an OCSP URL")
+	cert = makeCert(t, func(c *x509.Certificate) {
+		c.OCSPServer = nil
+		c.NotAfter = c.NotBefore.Add(core.MaxNoOCSPValidity)
+	})
+	test.AssertNotError(t, checkOCSPURL(cert, &Context{}), "Rejected short-lived certificate without an OCSP URL")
+}
+
+func TestCheckExtKeyUsage(t *testing.T) {
+	test.AssertNotError(t, checkExtKeyUsage(makeCert(t, nil), &Context{}), "Rejected server auth certificate")
+	for _, mutate := range []func(*x509.Certificate){
+		func(c *x509.Certificate) { c.IsCA = true },
+		func(c *x509.Certificate) { c.ExtKeyUsage = nil },
+		func(c *x509.Certificate) { c.ExtKeyUsage = append(c.ExtKeyUsage, x509.ExtKeyUsageAny) },
+		func(c *x509.Certificate) { c.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth} },
+		func(c *x509.Certificate) { c.EmailAddresses = []string{"someone@not-example.com"} },
+	} {
+		test.AssertError(t, checkExtKeyUsage(makeCert(t, mutate), &Context{}), "Accepted bad extended key usage")
+	}
+}
+
+func TestCheckKeyPolicy(t *testing.T) {
+	keyPolicy := goodkey.NewKeyPolicy()
+	ctx := &Context{KeyPolicy: &keyPolicy}
+	test.AssertNotError(t, checkKeyPolicy(makeCert(t, nil), ctx), "Rejected P-256 key")
+
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	test.AssertNotError(t, err, "Failed to generate key")
+	cert := makeCert(t, nil)
+	cert.PublicKey = key.Public()
+	test.AssertError(t, checkKeyPolicy(cert, ctx), "Accepted 1024 bit RSA key")
+	test.AssertNotError(t, checkKeyPolicy(cert, &Context{}), "Checked key without a key policy")
+}
+
+func TestCheckNamePolicy(t *testing.T) {
+	ctx := &Context{PA: &mockPA{bad: map[string]bool{"www.not-example.com": true}}}
+	test.AssertError(t, checkNamePolicy(makeCert(t, nil), ctx), "Accepted forbidden name")
+	cert := makeCert(t, func(c *x509.Certificate) {
+		c.DNSNames = []string{"not-example.com"}
+	})
+	test.AssertNotError(t, checkNamePolicy(cert, ctx), "Rejected allowed name")
+	cert = makeCert(t, func(c *x509.Certificate) {
+		c.DNSNames = nil
+		c.EmailAddresses = []string{"www.not-example.com"}
+	})
+	test.AssertError(t, checkNamePolicy(cert, ctx), "Accepted forbidden email address")
+}
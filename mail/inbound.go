@@ -0,0 +1,213 @@
+package mail
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	blog "github.com/letsencrypt/boulder/log"
+)
+
+const (
+	// maxInboundMessageSize is the largest message an Inbox accepts. Replies
+	// to validation emails are short.
+	maxInboundMessageSize = 64 * 1024
+	// inboundTimeout bounds each SMTP session.
+	inboundTimeout = 5 * time.Minute
+)
+
+var (
+	inboundMailFrom = regexp.MustCompile(`(?i)^MAIL FROM:\s*<([^>]*)>`)
+	inboundRcptTo   = regexp.MustCompile(`(?i)^RCPT TO:\s*<([^>]*)>`)
+)
+
+// Message is an email received by an Inbox.
+type Message struct {
+	// The envelope sender and recipients
+	MailFrom string
+	RcptTo   []string
+	// The parsed header, and the undecoded body with "\n" line endings
+	Header mail.Header
+	Body   []byte
+}
+
+type subscriber struct {
+	match func(*Message) bool
+	ch    chan *Message
+}
+
+// Inbox is a minimal SMTP server that accepts mail for a fixed set of
+// addresses and hands each message to any subscriber that wants it. Messages
+// no subscriber wants are logged and dropped. It is meant to sit behind an
+// MTA that relays replies to it, and doesn't implement TLS or
+// authentication itself.
+type Inbox struct {
+	hostname  string
+	addresses map[string]bool
+	log       blog.Logger
+
+	mu          sync.Mutex
+	subscribers map[*subscriber]bool
+}
+
+// NewInbox returns an Inbox that accepts mail for addresses and identifies
+// itself as hostname.
+func NewInbox(hostname string, addresses []string, logger blog.Logger) *Inbox {
+	in := &Inbox{
+		hostname:    hostname,
+		addresses:   make(map[string]bool),
+		log:         logger,
+		subscribers: make(map[*subscriber]bool),
+	}
+	for _, addr := range addresses {
+		in.addresses[strings.ToLower(addr)] = true
+	}
+	return in
+}
+
+// Subscribe returns a channel on which each later message for which match
+// returns true is delivered, and a function that cancels the subscription.
+// A message that arrives while an earlier one is still unread is dropped.
+func (in *Inbox) Subscribe(match func(*Message) bool) (<-chan *Message, func()) {
+	sub := &subscriber{match: match, ch: make(chan *Message, 1)}
+	in.mu.Lock()
+	in.subscribers[sub] = true
+	in.mu.Unlock()
+	return sub.ch, func() {
+		in.mu.Lock()
+		delete(in.subscribers, sub)
+		in.mu.Unlock()
+	}
+}
+
+func (in *Inbox) deliver(msg *Message) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	delivered := false
+	for sub := range in.subscribers {
+		if !sub.match(msg) {
+			continue
+		}
+		select {
+		case sub.ch <- msg:
+			delivered = true
+		default:
+		}
+	}
+	if !delivered {
+		in.log.Info(fmt.Sprintf("Inbox: dropped unexpected message from %s with subject %q",
+			msg.MailFrom, msg.Header.Get("Subject")))
+	}
+}
+
+// Serve accepts SMTP connections on l until it fails.
+func (in *Inbox) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go in.handleConn(conn)
+	}
+}
+
+func (in *Inbox) handleConn(conn net.Conn) {
+	defer func() {
+		_ = conn.Close()
+	}()
+	_ = conn.SetDeadline(time.Now().Add(inboundTimeout))
+	tc := textproto.NewConn(conn)
+	reply := func(format string, args ...interface{}) bool {
+		return tc.PrintfLine(format, args...) == nil
+	}
+
+	if !reply("220 %s ESMTP", in.hostname) {
+		return
+	}
+	var from string
+	var rcpts []string
+	for {
+		line, err := tc.ReadLine()
+		if err != nil {
+			return
+		}
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		ok := true
+		switch verb {
+		case "HELO", "EHLO":
+			from, rcpts = "", nil
+			ok = reply("250 %s", in.hostname)
+		case "MAIL":
+			matches := inboundMailFrom.FindStringSubmatch(line)
+			if matches == nil {
+				ok = reply("501 Syntax error in MAIL")
+				break
+			}
+			from, rcpts = matches[1], nil
+			ok = reply("250 OK")
+		case "RCPT":
+			matches := inboundRcptTo.FindStringSubmatch(line)
+			if matches == nil {
+				ok = reply("501 Syntax error in RCPT")
+			} else if !in.addresses[strings.ToLower(matches[1])] {
+				ok = reply("550 No such user")
+			} else {
+				rcpts = append(rcpts, matches[1])
+				ok = reply("250 OK")
+			}
+		case "DATA":
+			if len(rcpts) == 0 {
+				ok = reply("503 No valid recipients")
+				break
+			}
+			if !reply("354 End data with <CR><LF>.<CR><LF>") {
+				return
+			}
+			dr := tc.DotReader()
+			data, err := ioutil.ReadAll(io.LimitReader(dr, maxInboundMessageSize+1))
+			if err != nil {
+				return
+			}
+			if len(data) > maxInboundMessageSize {
+				// Discard the rest of the message before replying.
+				if _, err := io.Copy(ioutil.Discard, dr); err != nil {
+					return
+				}
+				ok = reply("552 Message too large")
+			} else if msg, err := mail.ReadMessage(bytes.NewReader(data)); err != nil {
+				ok = reply("554 Malformed message")
+			} else {
+				body, _ := ioutil.ReadAll(msg.Body)
+				in.deliver(&Message{
+					MailFrom: from,
+					RcptTo:   rcpts,
+					Header:   msg.Header,
+					Body:     body,
+				})
+				ok = reply("250 OK")
+			}
+			from, rcpts = "", nil
+		case "RSET":
+			from, rcpts = "", nil
+			ok = reply("250 OK")
+		case "NOOP":
+			ok = reply("250 OK")
+		case "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			ok = reply("502 Command not implemented")
+		}
+		if !ok {
+			return
+		}
+	}
+}
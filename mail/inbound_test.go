@@ -0,0 +1,55 @@
+package mail
+
+import (
+	"net"
+	"net/smtp"
+	"strings"
+	"testing"
+	"time"
+
+	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/test"
+)
+
+func TestInbox(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	test.AssertNotError(t, err, "listen")
+	defer func() { _ = l.Close() }()
+
+	inbox := NewInbox("acme.example.com", []string{"Replies@acme.example.com"}, blog.NewMock())
+	go func() { _ = inbox.Serve(l) }()
+
+	ch, cancel := inbox.Subscribe(func(msg *Message) bool {
+		return strings.Contains(msg.Header.Get("Subject"), "token")
+	})
+	defer cancel()
+
+	send := func(to, subject string) error {
+		msg := "From: alice@example.com\r\nSubject: " + subject + "\r\n\r\nbody\r\n.leading dot\r\n"
+		return smtp.SendMail(l.Addr().String(), nil, "alice@example.com", []string{to}, []byte(msg))
+	}
+
+	// Mail for other addresses is refused.
+	err = send("bob@acme.example.com", "Re: token")
+	test.AssertError(t, err, "mail for unknown address accepted")
+
+	// Mail nobody is waiting for is dropped.
+	err = send("replies@acme.example.com", "Re: something else")
+	test.AssertNotError(t, err, "sending mail")
+
+	err = send("replies@acme.example.com", "Re: token")
+	test.AssertNotError(t, err, "sending mail")
+	select {
+	case msg := <-ch:
+		test.AssertEquals(t, msg.MailFrom, "alice@example.com")
+		test.AssertEquals(t, msg.Header.Get("Subject"), "Re: token")
+		test.AssertEquals(t, string(msg.Body), "body\n.leading dot\n")
+	case <-time.After(5 * time.Second):
+		t.Fatal("message wasn't delivered")
+	}
+	select {
+	case msg := <-ch:
+		t.Fatalf("unexpected message delivered: %v", msg.Header)
+	default:
+	}
+}
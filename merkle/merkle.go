@@ -0,0 +1,219 @@
+// Package merkle implements the Merkle tree hashing of RFC 6962, Section 2.1,
+// which Certificate Transparency logs use to prove that they have included an
+// entry, and that each version of their tree extends the one before it.
+package merkle
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+// Hash is a node of a Merkle tree
+type Hash [sha256.Size]byte
+
+// LeafHash returns the hash of a leaf with the given contents
+func LeafHash(leaf []byte) Hash {
+	return sha256.Sum256(append([]byte{0}, leaf...))
+}
+
+// hashChildren returns the hash of an interior node with the given children
+func hashChildren(left, right Hash) Hash {
+	return sha256.Sum256(append(append([]byte{1}, left[:]...), right[:]...))
+}
+
+// VerifyInclusion checks that proof is an audit path showing that the leaf
+// with leafHash is at index in the tree of size treeSize with root.
+func VerifyInclusion(leafHash Hash, index, treeSize uint64, proof []Hash, root Hash) error {
+	if index >= treeSize {
+		return fmt.Errorf("leaf index %d is outside a tree of size %d", index, treeSize)
+	}
+	// This is the verification algorithm of RFC 6962bis, Section 2.1.3.2.
+	fn, sn := index, treeSize-1
+	r := leafHash
+	for _, p := range proof {
+		if sn == 0 {
+			return errors.New("audit path is too long")
+		}
+		if fn&1 == 1 || fn == sn {
+			r = hashChildren(p, r)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			r = hashChildren(r, p)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	if sn != 0 {
+		return errors.New("audit path is too short")
+	}
+	if r != root {
+		return errors.New("audit path doesn't lead to the tree's root")
+	}
+	return nil
+}
+
+// VerifyConsistency checks that proof shows that the tree of size2 with root2
+// extends the tree of size1 with root1, without changing any of its entries.
+func VerifyConsistency(size1, size2 uint64, root1, root2 Hash, proof []Hash) error {
+	switch {
+	case size1 > size2:
+		return fmt.Errorf("tree shrank from size %d to %d", size1, size2)
+	case size1 == size2:
+		if len(proof) != 0 {
+			return errors.New("consistency proof between trees of the same size isn't empty")
+		}
+		if root1 != root2 {
+			return errors.New("trees of the same size have different roots")
+		}
+		return nil
+	case size1 == 0:
+		// Every tree extends the empty one.
+		return nil
+	case len(proof) == 0:
+		return errors.New("consistency proof is empty")
+	}
+
+	// This is the verification algorithm of RFC 6962bis, Section 2.1.4.2.
+	// When the old tree is complete, its root is the first node of the proof,
+	// and is left out.
+	if size1&(size1-1) == 0 {
+		proof = append([]Hash{root1}, proof...)
+	}
+	fn, sn := size1-1, size2-1
+	for fn&1 == 1 {
+		fn >>= 1
+		sn >>= 1
+	}
+	fr, sr := proof[0], proof[0]
+	for _, c := range proof[1:] {
+		if sn == 0 {
+			return errors.New("consistency proof is too long")
+		}
+		if fn&1 == 1 || fn == sn {
+			fr = hashChildren(c, fr)
+			sr = hashChildren(c, sr)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			sr = hashChildren(sr, c)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	if sn != 0 {
+		return errors.New("consistency proof is too short")
+	}
+	if fr != root1 {
+		return errors.New("consistency proof doesn't lead to the old tree's root")
+	}
+	if sr != root2 {
+		return errors.New("consistency proof doesn't lead to the new tree's root")
+	}
+	return nil
+}
+
+// Tree is an in-memory Merkle tree, which can produce proofs about any of
+// its versions. It recomputes hashes rather than storing them, so it's only
+// suitable for small trees, like those of test logs.
+type Tree struct {
+	leaves []Hash
+}
+
+// Append adds a leaf with the given contents to the tree, and returns its
+// index.
+func (t *Tree) Append(leaf []byte) uint64 {
+	t.leaves = append(t.leaves, LeafHash(leaf))
+	return uint64(len(t.leaves) - 1)
+}
+
+// Size returns the number of leaves in the tree
+func (t *Tree) Size() uint64 {
+	return uint64(len(t.leaves))
+}
+
+// Index returns the index of the first leaf with leafHash, if there is one.
+func (t *Tree) Index(leafHash Hash) (uint64, bool) {
+	for i, h := range t.leaves {
+		if h == leafHash {
+			return uint64(i), true
+		}
+	}
+	return 0, false
+}
+
+// Root returns the root of the tree when it had size leaves
+func (t *Tree) Root(size uint64) Hash {
+	return root(t.leaves[:size])
+}
+
+// InclusionProof returns the audit path for the leaf at index in the tree of
+// the given size.
+func (t *Tree) InclusionProof(index, size uint64) []Hash {
+	return path(index, t.leaves[:size])
+}
+
+// ConsistencyProof returns the proof that the tree of size2 extends the tree
+// of size1.
+func (t *Tree) ConsistencyProof(size1, size2 uint64) []Hash {
+	if size1 == 0 || size1 >= size2 {
+		return nil
+	}
+	return subproof(size1, t.leaves[:size2], true)
+}
+
+// split returns the size of the left subtree of a tree of n > 1 leaves, the
+// largest power of two smaller than n.
+func split(n uint64) uint64 {
+	k := uint64(1)
+	for k<<1 < n {
+		k <<= 1
+	}
+	return k
+}
+
+// root is MTH of RFC 6962, Section 2.1
+func root(leaves []Hash) Hash {
+	switch len(leaves) {
+	case 0:
+		return sha256.Sum256(nil)
+	case 1:
+		return leaves[0]
+	}
+	k := split(uint64(len(leaves)))
+	return hashChildren(root(leaves[:k]), root(leaves[k:]))
+}
+
+// path is PATH of RFC 6962, Section 2.1.1
+func path(m uint64, leaves []Hash) []Hash {
+	n := uint64(len(leaves))
+	if n <= 1 {
+		return nil
+	}
+	k := split(n)
+	if m < k {
+		return append(path(m, leaves[:k]), root(leaves[k:]))
+	}
+	return append(path(m-k, leaves[k:]), root(leaves[:k]))
+}
+
+// subproof is SUBPROOF of RFC 6962, Section 2.1.2
+func subproof(m uint64, leaves []Hash, complete bool) []Hash {
+	n := uint64(len(leaves))
+	if m == n {
+		if complete {
+			return nil
+		}
+		return []Hash{root(leaves)}
+	}
+	k := split(n)
+	if m <= k {
+		return append(subproof(m, leaves[:k], complete), root(leaves[k:]))
+	}
+	return append(subproof(m-k, leaves[k:], false), root(leaves[:k]))
+}
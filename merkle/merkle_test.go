@@ -0,0 +1,105 @@
+package merkle
+
+import (
+	"encoding/hex"
+	"fmt"
+	"testing"
+
+	"github.com/letsencrypt/boulder/test"
+)
+
+func makeTree(size int) *Tree {
+	t := &Tree{}
+	for i := 0; i < size; i++ {
+		t.Append([]byte(fmt.Sprintf("leaf %d", i)))
+	}
+	return t
+}
+
+func TestRoot(t *testing.T) {
+	// The test vectors of the certificate-transparency project, for a tree of
+	// the leaves "", 00, 10, 2021, 3031, 40414243, 5051525354555657 and
+	// 606162636465666768696a6b6c6d6e6f.
+	leaves := []string{"", "00", "10", "2021", "3031", "40414243",
+		"5051525354555657", "606162636465666768696a6b6c6d6e6f"}
+	roots := []string{
+		"6e340b9cffb37a989ca544e6bb780a2c78901d3fb33738768511a30617afa01d",
+		"fac54203e7cc696cf0dfcb42c92a1d9dbaf70ad9e621f4bd8d98662f00e3c125",
+		"aeb6bcfe274b70a14fb067a5e5578264db0fa9b51af5e0ba159158f329e06e77",
+		"d37ee418976dd95753c1c73862b9398fa2a2cf9b4ff0fdfe8b30cd95209614b7",
+		"4e3bbb1f7b478dcfe71fb631631519a3bca12c9aefca1612bfce4c13a86264d4",
+		"76e67dadbcdf1e10e1b74ddc608abd2f98dfb16fbce75277b5232a127f2087ef",
+		"ddb89be403809e325750d3d263cd78929c2942b7942a34b77e122c9594a74c8c",
+		"5dc9da79a70659a9ad559cb701ded9a2ab9d823aad2f4960cfe370eff4604328",
+	}
+	tree := &Tree{}
+	empty := tree.Root(0)
+	test.AssertEquals(t, hex.EncodeToString(empty[:]), "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855")
+	for i, leaf := range leaves {
+		contents, _ := hex.DecodeString(leaf)
+		tree.Append(contents)
+		r := tree.Root(tree.Size())
+		test.AssertEquals(t, hex.EncodeToString(r[:]), roots[i])
+	}
+}
+
+func TestInclusionProofs(t *testing.T) {
+	tree := makeTree(20)
+	for size := uint64(1); size <= tree.Size(); size++ {
+		root := tree.Root(size)
+		for index := uint64(0); index < size; index++ {
+			proof := tree.InclusionProof(index, size)
+			err := VerifyInclusion(tree.leaves[index], index, size, proof, root)
+			test.AssertNotError(t, err, fmt.Sprintf("Inclusion of %d in %d failed", index, size))
+
+			err = VerifyInclusion(tree.leaves[index], index, size, proof, tree.Root(size-1))
+			test.AssertError(t, err, "Proof verified for the wrong root")
+			if size > 1 {
+				err = VerifyInclusion(tree.leaves[(index+1)%size], index, size, proof, root)
+				test.AssertError(t, err, "Proof verified for the wrong leaf")
+				err = VerifyInclusion(tree.leaves[index], (index+1)%size, size, proof, root)
+				test.AssertError(t, err, "Proof verified for the wrong index")
+				err = VerifyInclusion(tree.leaves[index], index, size, proof[1:], root)
+				test.AssertError(t, err, "Truncated proof verified")
+			}
+		}
+	}
+	err := VerifyInclusion(tree.leaves[0], 5, 5, nil, tree.Root(5))
+	test.AssertError(t, err, "Index outside the tree verified")
+}
+
+func TestConsistencyProofs(t *testing.T) {
+	tree := makeTree(20)
+	for size2 := uint64(1); size2 <= tree.Size(); size2++ {
+		root2 := tree.Root(size2)
+		for size1 := uint64(0); size1 <= size2; size1++ {
+			root1 := tree.Root(size1)
+			proof := tree.ConsistencyProof(size1, size2)
+			err := VerifyConsistency(size1, size2, root1, root2, proof)
+			test.AssertNotError(t, err, fmt.Sprintf("Consistency of %d with %d failed", size1, size2))
+
+			if size1 == 0 || size1 == size2 {
+				continue
+			}
+			err = VerifyConsistency(size1, size2, tree.Root(size1-1), root2, proof)
+			test.AssertError(t, err, "Proof verified for the wrong old root")
+			err = VerifyConsistency(size1, size2, root1, tree.Root(size2-1), proof)
+			test.AssertError(t, err, "Proof verified for the wrong new root")
+			err = VerifyConsistency(size1, size2, root1, root2, proof[1:])
+			test.AssertError(t, err, "Truncated proof verified")
+		}
+	}
+	err := VerifyConsistency(5, 4, tree.Root(5), tree.Root(4), nil)
+	test.AssertError(t, err, "Shrinking tree verified")
+	err = VerifyConsistency(5, 5, tree.Root(5), tree.Root(4), nil)
+	test.AssertError(t, err, "Trees of the same size with different roots verified")
+}
+
+func TestIndex(t *testing.T) {
+	tree := makeTree(5)
+	index, ok := tree.Index(LeafHash([]byte("leaf 3")))
+	test.Assert(t, ok, "Leaf not found")
+	test.AssertEquals(t, index, uint64(3))
+	_, ok = tree.Index(LeafHash([]byte("leaf 5")))
+	test.Assert(t, !ok, "Missing leaf found")
+}
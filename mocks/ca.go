@@ -32,11 +32,26 @@ func (ca *MockCA) IssueCertificate(ctx context.Context, csr oldx509.CertificateR
 	}, nil
 }
 
+// IssuePrecertificate is a mock
+func (ca *MockCA) IssuePrecertificate(ctx context.Context, csr oldx509.CertificateRequest, regID int64) (core.Certificate, error) {
+	return ca.IssueCertificate(ctx, csr, regID)
+}
+
+// IssueCertificateForPrecertificate is a mock
+func (ca *MockCA) IssueCertificateForPrecertificate(ctx context.Context, precertDER []byte, scts [][]byte, regID int64) (core.Certificate, error) {
+	return ca.IssueCertificate(ctx, oldx509.CertificateRequest{}, regID)
+}
+
 // GenerateOCSP is a mock
 func (ca *MockCA) GenerateOCSP(ctx context.Context, xferObj core.OCSPSigningRequest) (ocsp []byte, err error) {
 	return
 }
 
+// GenerateCRLs is a mock
+func (ca *MockCA) GenerateCRLs(ctx context.Context, xferObjs []core.CRLSigningRequest) (crls [][]byte, err error) {
+	return
+}
+
 // RevokeCertificate is a mock
 func (ca *MockCA) RevokeCertificate(ctx context.Context, serial string, reasonCode core.RevocationCode) (err error) {
 	return
@@ -194,6 +194,11 @@ func (sa *StorageAuthority) GetCertificate(_ context.Context, serial string) (co
 	}
 }
 
+// GetPrecertificate is a mock
+func (sa *StorageAuthority) GetPrecertificate(_ context.Context, serial string) (core.Certificate, error) {
+	return core.Certificate{}, core.NotFoundError("No precertificate")
+}
+
 // GetCertificateStatus is a mock
 func (sa *StorageAuthority) GetCertificateStatus(_ context.Context, serial string) (core.CertificateStatus, error) {
 	// Serial ee == 238.crt
@@ -215,6 +220,16 @@ func (sa *StorageAuthority) AddCertificate(_ context.Context, certDER []byte, re
 	return
 }
 
+// AddPrecertificate is a mock
+func (sa *StorageAuthority) AddPrecertificate(_ context.Context, der []byte, regID int64) error {
+	return nil
+}
+
+// ClaimPrecertificate is a mock
+func (sa *StorageAuthority) ClaimPrecertificate(_ context.Context, serial string) error {
+	return nil
+}
+
 // FinalizeAuthorization is a mock
 func (sa *StorageAuthority) FinalizeAuthorization(_ context.Context, authz core.Authorization) (err error) {
 	return
@@ -258,6 +273,61 @@ func (sa *StorageAuthority) AddSCTReceipt(_ context.Context, sct core.SignedCert
 	return
 }
 
+// GetUncheckedSCTReceipts is a mock
+func (sa *StorageAuthority) GetUncheckedSCTReceipts(_ context.Context, logID string, issuedBefore time.Time, limit int) ([]core.SignedCertificateTimestamp, error) {
+	return nil, nil
+}
+
+// AddSCTInclusion is a mock
+func (sa *StorageAuthority) AddSCTInclusion(_ context.Context, inclusion core.SCTInclusion) error {
+	return nil
+}
+
+// GetLatestSTH is a mock
+func (sa *StorageAuthority) GetLatestSTH(_ context.Context, logID string) (core.SignedTreeHead, error) {
+	return core.SignedTreeHead{}, core.NotFoundError("no STHs")
+}
+
+// AddSTH is a mock
+func (sa *StorageAuthority) AddSTH(_ context.Context, sth core.SignedTreeHead) error {
+	return nil
+}
+
+// AddCTSubmission is a mock
+func (sa *StorageAuthority) AddCTSubmission(_ context.Context, sub core.CTSubmission) error {
+	return nil
+}
+
+// GetDueCTSubmissions is a mock
+func (sa *StorageAuthority) GetDueCTSubmissions(_ context.Context, now time.Time, limit int) ([]core.CTSubmission, error) {
+	return nil, nil
+}
+
+// GetRevokedCertificates is a mock
+func (sa *StorageAuthority) GetRevokedCertificates(_ context.Context, after string, now time.Time, limit int) ([]core.RevokedCertificate, error) {
+	return nil, nil
+}
+
+// UpdateCTSubmission is a mock
+func (sa *StorageAuthority) UpdateCTSubmission(_ context.Context, sub core.CTSubmission) error {
+	return nil
+}
+
+// RemoveCTSubmission is a mock
+func (sa *StorageAuthority) RemoveCTSubmission(_ context.Context, id int64) error {
+	return nil
+}
+
+// CountCTSubmissions is a mock
+func (sa *StorageAuthority) CountCTSubmissions(_ context.Context) (map[core.CTSubmissionStatus]int64, error) {
+	return map[core.CTSubmissionStatus]int64{}, nil
+}
+
+// RequeueCTSubmissions is a mock
+func (sa *StorageAuthority) RequeueCTSubmissions(_ context.Context, serial, logID string) (int64, error) {
+	return 0, nil
+}
+
 // CountFQDNSets is a mock
 func (sa *StorageAuthority) CountFQDNSets(_ context.Context, since time.Duration, names []string) (int64, error) {
 	return 0, nil
@@ -321,6 +391,11 @@ func (*Publisher) SubmitToCT(_ context.Context, der []byte) error {
 	return nil
 }
 
+// SubmitPrecertToCT is a mock
+func (*Publisher) SubmitPrecertToCT(_ context.Context, der []byte) ([][]byte, error) {
+	return nil, nil
+}
+
 // Statter is a stat counter that is a no-op except for locally handling Inc
 // calls (which are most of what we use).
 type Statter struct {
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"math/rand"
 	"net"
+	"net/mail"
 	"regexp"
 	"strings"
 	"sync"
@@ -137,8 +138,14 @@ var (
 	errLabelTooShort       = probs.Malformed("DNS label is too short")
 	errLabelTooLong        = probs.Malformed("DNS label is too long")
 	errIDNNotSupported     = probs.UnsupportedIdentifier("Internationalized domain names (starting with xn--) not yet supported")
+	errInvalidEmail        = probs.Malformed("Invalid email address")
+	errEmailTooLong        = probs.Malformed("Email address too long")
 )
 
+// maxEmailIdentifierLength is the longest email address that can be used as
+// a path in SMTP, per RFC 5321 section 4.5.3.1.3.
+const maxEmailIdentifierLength = 254
+
 // WillingToIssue determines whether the CA is willing to issue for the provided
 // identifier. It expects domains in id to be lowercase to prevent mismatched
 // cases breaking queries.
@@ -158,12 +165,43 @@ var (
 //  * MUST NOT be a label-wise suffix match for a name on the black list,
 //    where comparison is case-independent (normalized to lower case)
 //
+// Email identifiers MUST be a bare, lowercase ASCII address whose domain
+// meets the criteria above.
+//
 // If WillingToIssue returns an error, it will be of type MalformedRequestError.
 func (pa *AuthorityImpl) WillingToIssue(id core.AcmeIdentifier) error {
-	if id.Type != core.IdentifierDNS {
+	switch id.Type {
+	case core.IdentifierDNS:
+		return pa.willingToIssueDNS(id.Value)
+	case core.IdentifierEmail:
+		return pa.willingToIssueEmail(id.Value)
+	default:
 		return errInvalidIdentifier
 	}
-	domain := id.Value
+}
+
+func (pa *AuthorityImpl) willingToIssueEmail(address string) error {
+	if len(address) > maxEmailIdentifierLength {
+		return errEmailTooLong
+	}
+	parsed, err := mail.ParseAddress(address)
+	if err != nil || parsed.Name != "" || parsed.Address != address {
+		return errInvalidEmail
+	}
+	at := strings.LastIndex(address, "@")
+	local := address[:at]
+	if local == "" {
+		return errInvalidEmail
+	}
+	for _, ch := range []byte(local) {
+		if ch > 0x7e || ch < 0x21 || (ch >= 'A' && ch <= 'Z') {
+			return errInvalidEmail
+		}
+	}
+	return pa.willingToIssueDNS(address[at+1:])
+}
+
+func (pa *AuthorityImpl) willingToIssueDNS(domain string) error {
 
 	if domain == "" {
 		return errEmptyName
@@ -257,6 +295,14 @@ func (pa *AuthorityImpl) checkHostLists(domain string) error {
 func (pa *AuthorityImpl) ChallengesFor(identifier core.AcmeIdentifier) ([]core.Challenge, [][]int) {
 	challenges := []core.Challenge{}
 
+	// Email addresses can only be validated by email.
+	if identifier.Type == core.IdentifierEmail {
+		if !pa.enabledChallenges[core.ChallengeTypeEmailReply00] {
+			return challenges, [][]int{}
+		}
+		return []core.Challenge{core.EmailReplyChallenge00()}, [][]int{{0}}
+	}
+
 	if pa.enabledChallenges[core.ChallengeTypeHTTP01] {
 		challenges = append(challenges, core.HTTPChallenge01())
 	}
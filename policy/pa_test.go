@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"io/ioutil"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/letsencrypt/boulder/core"
@@ -181,6 +182,38 @@ func TestWillingToIssue(t *testing.T) {
 	}
 }
 
+func TestWillingToIssueEmail(t *testing.T) {
+	pa := paImpl(t)
+	err := pa.loadHostnamePolicy([]byte(`{"Blacklist": ["highvalue.com"]}`))
+	test.AssertNotError(t, err, "Couldn't load rules")
+
+	testCases := []struct {
+		address string
+		err     error
+	}{
+		{"alice@example.com", nil},
+		{"alice+tag@mail.example.com", nil},
+		{"Alice@example.com", errInvalidEmail},
+		{"Alice <alice@example.com>", errInvalidEmail},
+		{"<alice@example.com>", errInvalidEmail},
+		{`"alice"@example.com`, errInvalidEmail},
+		{"@example.com", errInvalidEmail},
+		{"alice", errInvalidEmail},
+		{"al\u00efce@example.com", errInvalidEmail},
+		{strings.Repeat("a", 250) + "@example.com", errEmailTooLong},
+		{"alice@com", errTooFewLabels},
+		{"alice@co.uk", errICANNTLD},
+		{"alice@zombo.com.", errInvalidEmail},
+		{"alice@highvalue.com", errBlacklisted},
+	}
+	for _, tc := range testCases {
+		err := pa.WillingToIssue(core.AcmeIdentifier{Type: core.IdentifierEmail, Value: tc.address})
+		if err != tc.err {
+			t.Errorf("WillingToIssue(%q) = %v, expected %v", tc.address, err, tc.err)
+		}
+	}
+}
+
 var accountKeyJSON = `{
   "kty":"RSA",
   "n":"yNWVhtYEKJR21y9xsHV-PD_bYwbXSeNuFal46xYxVfRL5mqha7vttvjB_vc7Xg2RvgCxHPCqoxgMPTzHrZT75LjCwIW2K_klBYN8oYvTwwmeSkAz6ut7ZxPv-nZaT5TJhGk0NT2kh_zSpdriEJ_3vW-mqxYbbBmpvHqsa1_zx9fSuHYctAZJWzxzUZXykbWMWQZpEiE0J4ajj51fInEzVn7VxV-mzfMyboQjujPh7aNJxAWSq4oQEJJDgWwSh9leyoJoPpONHxh5nEE5AjE01FkGICSxjpZsF-w8hOTI3XXohUdu29Se26k2B0PolDSuj0GIQU6-W9TdLXSjBb2SpQ",
@@ -208,6 +241,24 @@ func TestChallengesFor(t *testing.T) {
 	test.AssertDeepEquals(t, expectedCombos, combinations)
 }
 
+func TestChallengesForEmail(t *testing.T) {
+	pa := paImpl(t)
+	email := core.AcmeIdentifier{Type: core.IdentifierEmail, Value: "alice@example.com"}
+
+	challenges, combinations := pa.ChallengesFor(email)
+	test.AssertEquals(t, len(challenges), 0)
+	test.AssertEquals(t, len(combinations), 0)
+
+	pa.enabledChallenges = map[string]bool{
+		core.ChallengeTypeHTTP01:       true,
+		core.ChallengeTypeEmailReply00: true,
+	}
+	challenges, combinations = pa.ChallengesFor(email)
+	test.AssertEquals(t, len(challenges), 1)
+	test.AssertEquals(t, challenges[0].Type, core.ChallengeTypeEmailReply00)
+	test.AssertDeepEquals(t, combinations, [][]int{{0}})
+}
+
 func TestExtractDomainIANASuffix_Valid(t *testing.T) {
 	testCases := []struct {
 		domain, want string
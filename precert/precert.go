@@ -0,0 +1,160 @@
+// Package precert works with the Certificate Transparency precertificates
+// described in RFC 6962, Section 3.1. A precertificate is identical to the
+// certificate that is later issued for it, except that it carries a critical
+// poison extension in place of the final certificate's embedded SCT list.
+package precert
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+)
+
+var (
+	// OIDPoison identifies the critical extension that makes a certificate a
+	// precertificate
+	OIDPoison = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 3}
+	// OIDSCTList identifies the extension that embeds SCTs in a certificate
+	OIDSCTList = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}
+
+	// PoisonExtension is the extension added to precertificates. Its value is
+	// an ASN.1 NULL.
+	PoisonExtension = pkix.Extension{
+		Id:       OIDPoison,
+		Critical: true,
+		Value:    []byte{0x05, 0x00},
+	}
+)
+
+// IsPrecertificate returns true if cert has the poison extension.
+func IsPrecertificate(cert *x509.Certificate) bool {
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(OIDPoison) {
+			return true
+		}
+	}
+	return false
+}
+
+// The [3] EXPLICIT tag of the extensions field of a TBSCertificate
+const extensionsTag = 3
+
+// TBSWithout returns the DER encoded TBSCertificate of certDER with the
+// extension identified by oid removed. Everything else is left byte for byte
+// as it was, so the result can be compared between certificates, or signed
+// over as a CT log does for precertificates.
+func TBSWithout(certDER []byte, oid asn1.ObjectIdentifier) ([]byte, error) {
+	var cert struct {
+		TBS                asn1.RawValue
+		SignatureAlgorithm asn1.RawValue
+		Signature          asn1.BitString
+	}
+	rest, err := asn1.Unmarshal(certDER, &cert)
+	if err != nil {
+		return nil, err
+	} else if len(rest) > 0 {
+		return nil, errors.New("trailing data after certificate")
+	}
+
+	// Walk the TBSCertificate's fields, keeping all but the extensions as
+	// they are.
+	var fields []asn1.RawValue
+	inner := cert.TBS.Bytes
+	for len(inner) > 0 {
+		var field asn1.RawValue
+		inner, err = asn1.Unmarshal(inner, &field)
+		if err != nil {
+			return nil, err
+		}
+		if field.Class == asn1.ClassContextSpecific && field.Tag == extensionsTag {
+			var exts []asn1.RawValue
+			if _, err := asn1.Unmarshal(field.Bytes, &exts); err != nil {
+				return nil, err
+			}
+			var kept []asn1.RawValue
+			for _, raw := range exts {
+				var ext pkix.Extension
+				if _, err := asn1.Unmarshal(raw.FullBytes, &ext); err != nil {
+					return nil, err
+				}
+				if !ext.Id.Equal(oid) {
+					kept = append(kept, raw)
+				}
+			}
+			if len(kept) == 0 {
+				continue
+			}
+			extsDER, err := asn1.Marshal(kept)
+			if err != nil {
+				return nil, err
+			}
+			field = asn1.RawValue{
+				Class:      asn1.ClassContextSpecific,
+				Tag:        extensionsTag,
+				IsCompound: true,
+				Bytes:      extsDER,
+			}
+		}
+		fields = append(fields, field)
+	}
+	fieldsDER := new(bytes.Buffer)
+	for _, field := range fields {
+		fieldDER, err := asn1.Marshal(field)
+		if err != nil {
+			return nil, err
+		}
+		fieldsDER.Write(fieldDER)
+	}
+	return asn1.Marshal(asn1.RawValue{
+		Class:      asn1.ClassUniversal,
+		Tag:        asn1.TagSequence,
+		IsCompound: true,
+		Bytes:      fieldsDER.Bytes(),
+	})
+}
+
+// Correspond returns an error unless certDER is the final certificate for the
+// precertificate precertDER: the two must be identical once the precert's
+// poison and the certificate's SCT list extensions are removed.
+func Correspond(precertDER, certDER []byte) error {
+	precert, err := x509.ParseCertificate(precertDER)
+	if err != nil {
+		return fmt.Errorf("parsing precertificate: %s", err)
+	}
+	if !IsPrecertificate(precert) {
+		return errors.New("precertificate doesn't have the poison extension")
+	}
+	precertTBS, err := TBSWithout(precertDER, OIDPoison)
+	if err != nil {
+		return fmt.Errorf("parsing precertificate: %s", err)
+	}
+	certTBS, err := TBSWithout(certDER, OIDSCTList)
+	if err != nil {
+		return fmt.Errorf("parsing certificate: %s", err)
+	}
+	if !bytes.Equal(precertTBS, certTBS) {
+		return errors.New("certificate doesn't match precertificate")
+	}
+	return nil
+}
+
+// SCTList returns the TLS encoded SignedCertificateTimestampList (RFC 6962,
+// Section 3.3) of scts, each of which is a TLS encoded
+// SignedCertificateTimestamp.
+func SCTList(scts [][]byte) ([]byte, error) {
+	var list []byte
+	for _, sct := range scts {
+		if len(sct) == 0 || len(sct) > 0xffff {
+			return nil, fmt.Errorf("invalid SCT length %d", len(sct))
+		}
+		list = append(list, byte(len(sct)>>8), byte(len(sct)))
+		list = append(list, sct...)
+	}
+	if len(list) == 0 || len(list) > 0xffff {
+		return nil, fmt.Errorf("invalid SCT list length %d", len(list))
+	}
+	return append([]byte{byte(len(list) >> 8), byte(len(list))}, list...), nil
+}
@@ -0,0 +1,115 @@
+package precert
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/boulder/test"
+)
+
+var sctListExtension = pkix.Extension{
+	Id:    OIDSCTList,
+	Value: []byte{0x04, 0x03, 0x00, 0x01, 0x00},
+}
+
+// makePair returns a precertificate and the matching final certificate,
+// after applying mutate to the final certificate's template.
+func makePair(t *testing.T, mutate func(*x509.Certificate)) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	test.AssertNotError(t, err, "Failed to generate key")
+	now := time.Now()
+	template := func() *x509.Certificate {
+		return &x509.Certificate{
+			SerialNumber:          big.NewInt(1337),
+			Subject:               pkix.Name{CommonName: "not-example.com"},
+			NotBefore:             now,
+			NotAfter:              now.Add(time.Hour),
+			BasicConstraintsValid: true,
+			DNSNames:              []string{"not-example.com"},
+		}
+	}
+
+	precertTemplate := template()
+	precertTemplate.ExtraExtensions = []pkix.Extension{PoisonExtension}
+	precertDER, err := x509.CreateCertificate(rand.Reader, precertTemplate, precertTemplate, key.Public(), key)
+	test.AssertNotError(t, err, "Failed to create precertificate")
+
+	certTemplate := template()
+	certTemplate.ExtraExtensions = []pkix.Extension{sctListExtension}
+	if mutate != nil {
+		mutate(certTemplate)
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, certTemplate, precertTemplate, key.Public(), key)
+	test.AssertNotError(t, err, "Failed to create certificate")
+	return precertDER, certDER
+}
+
+func TestIsPrecertificate(t *testing.T) {
+	precertDER, certDER := makePair(t, nil)
+	precert, err := x509.ParseCertificate(precertDER)
+	test.AssertNotError(t, err, "Failed to parse precertificate")
+	test.Assert(t, IsPrecertificate(precert), "Precertificate not recognized")
+	cert, err := x509.ParseCertificate(certDER)
+	test.AssertNotError(t, err, "Failed to parse certificate")
+	test.Assert(t, !IsPrecertificate(cert), "Certificate recognized as precertificate")
+}
+
+func TestTBSWithout(t *testing.T) {
+	precertDER, _ := makePair(t, nil)
+	precert, err := x509.ParseCertificate(precertDER)
+	test.AssertNotError(t, err, "Failed to parse precertificate")
+
+	// Removing an extension that isn't there leaves the TBS unchanged.
+	tbs, err := TBSWithout(precertDER, OIDSCTList)
+	test.AssertNotError(t, err, "Failed to strip extension")
+	test.AssertByteEquals(t, tbs, precert.RawTBSCertificate)
+
+	tbs, err = TBSWithout(precertDER, OIDPoison)
+	test.AssertNotError(t, err, "Failed to strip poison")
+	test.Assert(t, len(tbs) < len(precert.RawTBSCertificate), "Poison not removed")
+	var parsed asn1.RawValue
+	rest, err := asn1.Unmarshal(tbs, &parsed)
+	test.AssertNotError(t, err, "Stripped TBS isn't valid DER")
+	test.AssertEquals(t, len(rest), 0)
+
+	_, err = TBSWithout([]byte{0x30, 0x00}, OIDPoison)
+	test.AssertError(t, err, "Stripped extension from garbage")
+}
+
+func TestCorrespond(t *testing.T) {
+	precertDER, certDER := makePair(t, nil)
+	test.AssertNotError(t, Correspond(precertDER, certDER), "Matching pair didn't correspond")
+
+	// A certificate isn't a precertificate for itself.
+	test.AssertError(t, Correspond(certDER, certDER), "Certificate without poison accepted as precertificate")
+
+	for _, mutate := range []func(*x509.Certificate){
+		func(c *x509.Certificate) { c.SerialNumber = big.NewInt(1338) },
+		func(c *x509.Certificate) { c.DNSNames = append(c.DNSNames, "www.not-example.com") },
+		func(c *x509.Certificate) { c.NotAfter = c.NotAfter.Add(time.Second) },
+		func(c *x509.Certificate) {
+			c.ExtraExtensions = append(c.ExtraExtensions, pkix.Extension{Id: asn1.ObjectIdentifier{1, 2, 3}, Value: []byte{0x05, 0x00}})
+		},
+	} {
+		precertDER, certDER := makePair(t, mutate)
+		test.AssertError(t, Correspond(precertDER, certDER), "Mismatched pair corresponded")
+	}
+}
+
+func TestSCTList(t *testing.T) {
+	list, err := SCTList([][]byte{{1, 2, 3}, {4}})
+	test.AssertNotError(t, err, "Failed to build SCT list")
+	test.AssertByteEquals(t, list, []byte{0, 8, 0, 3, 1, 2, 3, 0, 1, 4})
+
+	_, err = SCTList(nil)
+	test.AssertError(t, err, "Built empty SCT list")
+	_, err = SCTList([][]byte{{}})
+	test.AssertError(t, err, "Built SCT list with an empty SCT")
+}
@@ -0,0 +1,262 @@
+package publisher
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	ct "github.com/google/certificate-transparency/go"
+	"golang.org/x/net/context"
+
+	"github.com/letsencrypt/boulder/cmd"
+)
+
+// logList is the JSON log list format that browsers publish their known CT
+// logs in, e.g. https://www.gstatic.com/ct/log_list/log_list.json
+type logList struct {
+	Operators []struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	} `json:"operators"`
+	Logs []struct {
+		Description string `json:"description"`
+		Key         string `json:"key"`
+		// Log URLs usually have no scheme, in which case they're HTTPS
+		URL        string `json:"url"`
+		OperatedBy []int  `json:"operated_by"`
+		// If set, the log is no longer trusted, and isn't submitted to
+		DisqualifiedAt int64 `json:"disqualified_at"`
+		// If set, the log is a temporal shard, which only accepts
+		// certificates expiring in the interval
+		TemporalInterval *struct {
+			StartInclusive time.Time `json:"start_inclusive"`
+			EndExclusive   time.Time `json:"end_exclusive"`
+		} `json:"temporal_interval"`
+	} `json:"logs"`
+}
+
+// logGroup is a set of CT logs, of which at least minSCTs must issue SCTs for
+// a certificate to satisfy a logPolicy. Its logs are raced against each other.
+type logGroup struct {
+	name    string
+	logs    []*Log
+	minSCTs int
+}
+
+// logPolicy says which CT logs a certificate is submitted to, and which of
+// them must issue SCTs for it. Each log is in at most one group.
+type logPolicy struct {
+	groups []*logGroup
+	// Whether submissions that don't satisfy the policy fail. Only policies
+	// loaded from a log list are enforced.
+	enforced bool
+}
+
+// newLogPolicy builds a policy from a JSON log list and the groups to sort its
+// logs into. Each log is put in the first group that matches its operators,
+// and logs that match no group, or are disqualified, are left out.
+func newLogPolicy(contents []byte, groups []cmd.CTLogGroupConfig) (*logPolicy, error) {
+	if len(groups) == 0 {
+		return nil, errors.New("a CT log policy needs at least one group")
+	}
+	var list logList
+	if err := json.Unmarshal(contents, &list); err != nil {
+		return nil, fmt.Errorf("failed to parse log list: %s", err)
+	}
+	operators := make(map[int]string)
+	for _, o := range list.Operators {
+		operators[o.ID] = o.Name
+	}
+
+	p := &logPolicy{enforced: true}
+	for _, gc := range groups {
+		if gc.MinSCTs < 1 {
+			return nil, fmt.Errorf("group %q must require at least one SCT", gc.Name)
+		}
+		p.groups = append(p.groups, &logGroup{name: gc.Name, minSCTs: gc.MinSCTs})
+	}
+	for _, l := range list.Logs {
+		if l.DisqualifiedAt != 0 {
+			continue
+		}
+		var names []string
+		for _, id := range l.OperatedBy {
+			name, ok := operators[id]
+			if !ok {
+				return nil, fmt.Errorf("log %q has unknown operator %d", l.Description, id)
+			}
+			names = append(names, name)
+		}
+		i := matchGroup(groups, names)
+		if i < 0 {
+			continue
+		}
+		uri := l.URL
+		if !strings.Contains(uri, "://") {
+			uri = "https://" + uri
+		}
+		var notAfterStart, notAfterEnd time.Time
+		if l.TemporalInterval != nil {
+			notAfterStart = l.TemporalInterval.StartInclusive
+			notAfterEnd = l.TemporalInterval.EndExclusive
+		}
+		ctLog, err := NewShardedLog(uri, l.Key, notAfterStart, notAfterEnd)
+		if err != nil {
+			return nil, fmt.Errorf("log %q: %s", l.Description, err)
+		}
+		p.groups[i].logs = append(p.groups[i].logs, ctLog)
+	}
+	for _, g := range p.groups {
+		if len(g.logs) < g.minSCTs {
+			return nil, fmt.Errorf("group %q requires %d SCTs, but has only %d logs", g.name, g.minSCTs, len(g.logs))
+		}
+	}
+	return p, nil
+}
+
+// forNotAfter returns the policy restricted to the logs that accept
+// certificates expiring at notAfter. A group that is left with fewer logs than
+// the SCTs it requires can't be satisfied.
+func (p *logPolicy) forNotAfter(notAfter time.Time) *logPolicy {
+	restricted := &logPolicy{enforced: p.enforced}
+	for _, g := range p.groups {
+		rg := &logGroup{name: g.name, minSCTs: g.minSCTs}
+		for _, ctLog := range g.logs {
+			if ctLog.covers(notAfter) {
+				rg.logs = append(rg.logs, ctLog)
+			}
+		}
+		restricted.groups = append(restricted.groups, rg)
+	}
+	return restricted
+}
+
+// missingSCTs returns the names of the groups that the SCTs from the logs
+// with IDs logIDs don't satisfy. A group with fewer logs than the SCTs it
+// requires is satisfied by an SCT from each of them, since submitting again
+// can't get it more.
+func (p *logPolicy) missingSCTs(logIDs []string) []string {
+	have := make(map[string]bool)
+	for _, id := range logIDs {
+		have[id] = true
+	}
+	var missing []string
+	for _, g := range p.groups {
+		needed := g.minSCTs
+		if len(g.logs) < needed {
+			needed = len(g.logs)
+		}
+		for _, ctLog := range g.logs {
+			if have[ctLog.id] {
+				needed--
+			}
+		}
+		if needed > 0 {
+			missing = append(missing, g.name)
+		}
+	}
+	return missing
+}
+
+// notAfterGaps describes the ranges of NotAfter dates, from now onwards, of
+// certificates that none of the group's logs accept.
+func (g *logGroup) notAfterGaps(now time.Time) []string {
+	var descriptions []cmd.LogDescription
+	for _, ctLog := range g.logs {
+		descriptions = append(descriptions, ctLog.description())
+	}
+	return cmd.NotAfterGaps(descriptions, now)
+}
+
+// matchGroup returns the index of the first group whose operators match a log
+// operated by operators, or -1 if none do.
+func matchGroup(groups []cmd.CTLogGroupConfig, operators []string) int {
+	for i, g := range groups {
+		listed := false
+		for _, name := range operators {
+			for _, groupOperator := range g.Operators {
+				if name == groupOperator {
+					listed = true
+				}
+			}
+		}
+		if listed != g.Exclude {
+			return i
+		}
+	}
+	return -1
+}
+
+// submitFunc submits a certificate to ctLog, and returns the log's verified
+// SCT for it.
+type submitFunc func(ctx context.Context, ctLog *Log) (*ct.SignedCertificateTimestamp, error)
+
+// submissionResult is the outcome of submitting a certificate under a policy.
+type submissionResult struct {
+	// The SCTs issued by each group's winning logs, in the order of the
+	// policy's groups
+	scts []*ct.SignedCertificateTimestamp
+	// Whether every group got the SCTs it requires
+	satisfied bool
+	// The names of the groups that didn't
+	unsatisfied []string
+}
+
+// submit submits a certificate to every group of the policy in parallel.
+func (p *logPolicy) submit(ctx context.Context, submit submitFunc) submissionResult {
+	groupSCTs := make([][]*ct.SignedCertificateTimestamp, len(p.groups))
+	done := make(chan struct{})
+	for i, g := range p.groups {
+		go func(i int, g *logGroup) {
+			groupSCTs[i] = g.race(ctx, submit)
+			done <- struct{}{}
+		}(i, g)
+	}
+	for range p.groups {
+		<-done
+	}
+
+	result := submissionResult{satisfied: true}
+	for i, g := range p.groups {
+		result.scts = append(result.scts, groupSCTs[i]...)
+		if len(groupSCTs[i]) < g.minSCTs {
+			result.satisfied = false
+			result.unsatisfied = append(result.unsatisfied, g.name)
+		}
+	}
+	return result
+}
+
+// race submits a certificate to all of the group's logs at once, and returns
+// the first minSCTs SCTs they issue, cancelling the remaining submissions. If
+// too few logs issue SCTs, it returns the ones that did.
+func (g *logGroup) race(ctx context.Context, submit submitFunc) []*ct.SignedCertificateTimestamp {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	type result struct {
+		sct *ct.SignedCertificateTimestamp
+		err error
+	}
+	// Buffered, so the losers' submissions can finish after race returns.
+	results := make(chan result, len(g.logs))
+	for _, ctLog := range g.logs {
+		go func(ctLog *Log) {
+			sct, err := submit(ctx, ctLog)
+			results <- result{sct, err}
+		}(ctLog)
+	}
+	var scts []*ct.SignedCertificateTimestamp
+	for range g.logs {
+		r := <-results
+		if r.err != nil {
+			continue
+		}
+		scts = append(scts, r.sct)
+		if len(scts) == g.minSCTs {
+			break
+		}
+	}
+	return scts
+}
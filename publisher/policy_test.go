@@ -0,0 +1,319 @@
+package publisher
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	ct "github.com/google/certificate-transparency/go"
+
+	"github.com/letsencrypt/boulder/cmd"
+	"github.com/letsencrypt/boulder/precert"
+	"github.com/letsencrypt/boulder/test"
+)
+
+// testListLog describes a log for makeLogList
+type testListLog struct {
+	url          string
+	operator     int
+	disqualified bool
+	// If set, the log is a shard for certificates expiring in the year
+	year int
+}
+
+// makeLogList returns a JSON log list of logs, all with k's public key, run by
+// the operators "Google" (0), "Other" (1) and "Third" (2).
+func makeLogList(t *testing.T, k *ecdsa.PrivateKey, logs []testListLog) []byte {
+	der, err := x509.MarshalPKIXPublicKey(&k.PublicKey)
+	test.AssertNotError(t, err, "Failed to marshal key")
+	type listLog struct {
+		Description    string `json:"description"`
+		Key            string `json:"key"`
+		URL            string `json:"url"`
+		OperatedBy     []int  `json:"operated_by"`
+		DisqualifiedAt int64  `json:"disqualified_at,omitempty"`
+		// Set for shards
+		TemporalInterval map[string]time.Time `json:"temporal_interval,omitempty"`
+	}
+	list := struct {
+		Operators []map[string]interface{} `json:"operators"`
+		Logs      []listLog                `json:"logs"`
+	}{
+		Operators: []map[string]interface{}{
+			{"name": "Google", "id": 0},
+			{"name": "Other", "id": 1},
+			{"name": "Third", "id": 2},
+		},
+	}
+	for i, l := range logs {
+		ll := listLog{
+			Description: fmt.Sprintf("log %d", i),
+			Key:         base64.StdEncoding.EncodeToString(der),
+			URL:         l.url,
+			OperatedBy:  []int{l.operator},
+		}
+		if l.disqualified {
+			ll.DisqualifiedAt = 1475000000
+		}
+		if l.year != 0 {
+			ll.TemporalInterval = map[string]time.Time{
+				"start_inclusive": time.Date(l.year, 1, 1, 0, 0, 0, 0, time.UTC),
+				"end_exclusive":   time.Date(l.year+1, 1, 1, 0, 0, 0, 0, time.UTC),
+			}
+		}
+		list.Logs = append(list.Logs, ll)
+	}
+	contents, err := json.Marshal(list)
+	test.AssertNotError(t, err, "Failed to marshal log list")
+	return contents
+}
+
+// googleAndOtherGroups requires an SCT from a Google log, and one from any
+// other log.
+var googleAndOtherGroups = []cmd.CTLogGroupConfig{
+	{Name: "Google", Operators: []string{"Google"}, MinSCTs: 1},
+	{Name: "non-Google", Operators: []string{"Google"}, Exclude: true, MinSCTs: 1},
+}
+
+func TestNewLogPolicy(t *testing.T) {
+	_, _, k := setup(t)
+	contents := makeLogList(t, k, []testListLog{
+		{url: "ct.googleapis.com/a/", operator: 0},
+		{url: "ct.googleapis.com/b/", operator: 0},
+		{url: "http://other.example.com", operator: 1},
+		{url: "https://third.example.com", operator: 2},
+		{url: "gone.example.com", operator: 1, disqualified: true},
+	})
+	policy, err := newLogPolicy(contents, googleAndOtherGroups)
+	test.AssertNotError(t, err, "Failed to load policy")
+	test.Assert(t, policy.enforced, "Loaded policy isn't enforced")
+	test.AssertEquals(t, len(policy.groups), 2)
+	google, other := policy.groups[0], policy.groups[1]
+	test.AssertEquals(t, google.name, "Google")
+	test.AssertEquals(t, len(google.logs), 2)
+	test.AssertEquals(t, google.logs[0].uri, "https://ct.googleapis.com/a")
+	test.AssertEquals(t, other.name, "non-Google")
+	test.AssertEquals(t, len(other.logs), 2)
+	test.AssertEquals(t, other.logs[0].uri, "http://other.example.com")
+	test.AssertEquals(t, other.logs[1].uri, "https://third.example.com")
+
+	// Logs are only in the first group that matches them.
+	policy, err = newLogPolicy(contents, []cmd.CTLogGroupConfig{
+		{Name: "Other", Operators: []string{"Other"}, MinSCTs: 1},
+		{Name: "all", Operators: nil, Exclude: true, MinSCTs: 3},
+	})
+	test.AssertNotError(t, err, "Failed to load policy")
+	test.AssertEquals(t, len(policy.groups[0].logs), 1)
+	test.AssertEquals(t, len(policy.groups[1].logs), 3)
+
+	for _, groups := range [][]cmd.CTLogGroupConfig{
+		nil,
+		{{Name: "none", Operators: []string{"Google"}, MinSCTs: 0}},
+		{{Name: "too many", Operators: []string{"Google"}, MinSCTs: 3}},
+		{{Name: "empty", Operators: []string{"Nobody"}, MinSCTs: 1}},
+	} {
+		_, err = newLogPolicy(contents, groups)
+		test.AssertError(t, err, "Loaded invalid policy")
+	}
+
+	_, err = newLogPolicy([]byte("{"), googleAndOtherGroups)
+	test.AssertError(t, err, "Loaded invalid log list")
+	unknown := makeLogList(t, k, []testListLog{{url: "ct.example.com", operator: 5}})
+	_, err = newLogPolicy(unknown, googleAndOtherGroups)
+	test.AssertError(t, err, "Loaded log with unknown operator")
+}
+
+func TestPolicyRace(t *testing.T) {
+	pub, leaf, k := setup(t)
+
+	fast := logSrv(leaf.Raw, k)
+	defer fast.Close()
+	// slow doesn't answer until the test is over, so a group that waited for
+	// it would never finish.
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer slow.Close()
+	defer close(release)
+	broken := errorLogSrv()
+	defer broken.Close()
+
+	contents := makeLogList(t, k, []testListLog{
+		{url: fast.URL, operator: 0},
+		{url: slow.URL, operator: 0},
+		{url: broken.URL, operator: 1},
+	})
+	policy, err := newLogPolicy(contents, googleAndOtherGroups)
+	test.AssertNotError(t, err, "Failed to load policy")
+	pub.policy = policy
+
+	log.Clear()
+	done := make(chan error, 1)
+	go func() {
+		done <- pub.SubmitToCT(ctx, leaf.Raw)
+	}()
+	select {
+	case err = <-done:
+		// broken is the only non-Google log, so the policy isn't satisfied.
+		test.AssertError(t, err, "Certificate submission didn't satisfy the policy, but succeeded")
+		test.Assert(t, strings.Contains(err.Error(), "non-Google"), "Error doesn't name the unsatisfied group")
+	case <-time.After(5 * time.Second):
+		t.Fatal("Submission waited for the slow log, after the fast one issued an SCT")
+	}
+	test.AssertEquals(t, len(log.GetAllMatching("Failed to submit certificate to CT log at "+broken.URL)), 1)
+	test.AssertEquals(t, len(log.GetAllMatching("CT log policy not satisfied .*non-Google")), 1)
+	test.AssertEquals(t, len(log.GetAllMatching("Failed .*"+slow.URL)), 0)
+}
+
+func TestSubmitPrecertWithPolicy(t *testing.T) {
+	pub, _, k := setup(t)
+	precertDER, issuerDER := makePrecert(t)
+	pub.issuerBundle = append(pub.issuerBundle, ct.ASN1Cert(issuerDER))
+	issuer, err := x509.ParseCertificate(issuerDER)
+	test.AssertNotError(t, err, "Failed to parse issuer")
+	tbs, err := precert.TBSWithout(precertDER, precert.OIDPoison)
+	test.AssertNotError(t, err, "Failed to strip poison")
+
+	sct := createSignedPrecertSCT(tbs, sha256.Sum256(issuer.RawSubjectPublicKeyInfo), k)
+	m := http.NewServeMux()
+	m.HandleFunc("/ct/v1/add-pre-chain", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, sct)
+	})
+	googleSrv := httptest.NewServer(m)
+	defer googleSrv.Close()
+	otherSrv := httptest.NewServer(m)
+	defer otherSrv.Close()
+	badSrv := badLogSrv()
+	defer badSrv.Close()
+
+	// Both groups get an SCT.
+	contents := makeLogList(t, k, []testListLog{
+		{url: googleSrv.URL, operator: 0},
+		{url: otherSrv.URL, operator: 1},
+		{url: badSrv.URL, operator: 2},
+	})
+	f, err := ioutil.TempFile("", "log-list")
+	test.AssertNotError(t, err, "Failed to create log list file")
+	defer os.Remove(f.Name())
+	_, err = f.Write(contents)
+	test.AssertNotError(t, err, "Failed to write log list file")
+	f.Close()
+	err = pub.LoadLogPolicy(f.Name(), googleAndOtherGroups)
+	test.AssertNotError(t, err, "Failed to load policy")
+	// Stop reloading before the log list is removed.
+	defer pub.Close()
+	scts, err := pub.SubmitPrecertToCT(ctx, precertDER)
+	test.AssertNotError(t, err, "Precertificate submission failed")
+	test.AssertEquals(t, len(scts), 2)
+
+	// Only the non-Google log that issues bad SCTs is left, so the policy
+	// can't be satisfied.
+	contents = makeLogList(t, k, []testListLog{
+		{url: googleSrv.URL, operator: 0},
+		{url: badSrv.URL, operator: 2},
+	})
+	policy, err := newLogPolicy(contents, googleAndOtherGroups)
+	test.AssertNotError(t, err, "Failed to load policy")
+	pub.policy = policy
+	_, err = pub.SubmitPrecertToCT(ctx, precertDER)
+	test.AssertError(t, err, "Precertificate submission didn't satisfy the policy, but succeeded")
+
+	// Without a policy, it's up to the caller whether there are enough SCTs.
+	pub.policy = nil
+	pub.ctLogs = policy.groups[0].logs
+	pub.ctLogs = append(pub.ctLogs, policy.groups[1].logs...)
+	scts, err = pub.SubmitPrecertToCT(ctx, precertDER)
+	test.AssertNotError(t, err, "Precertificate submission without a policy failed")
+	test.AssertEquals(t, len(scts), 1)
+}
+
+func TestShardedPolicy(t *testing.T) {
+	pub, _, k := setup(t)
+	contents := makeLogList(t, k, []testListLog{
+		{url: "google2017.example.com", operator: 0, year: 2017},
+		{url: "google2018.example.com", operator: 0, year: 2018},
+		{url: "other.example.com", operator: 1},
+		{url: "other2018.example.com", operator: 1, year: 2018},
+	})
+	policy, err := newLogPolicy(contents, googleAndOtherGroups)
+	test.AssertNotError(t, err, "Failed to load policy")
+	test.AssertEquals(t, len(policy.groups[0].notAfterGaps(time.Date(2016, 6, 1, 0, 0, 0, 0, time.UTC))), 2)
+	test.AssertEquals(t, len(policy.groups[1].notAfterGaps(time.Date(2016, 6, 1, 0, 0, 0, 0, time.UTC))), 0)
+
+	// Certificates are only routed to the shards for the year they expire in.
+	restricted := policy.forNotAfter(time.Date(2018, 3, 1, 0, 0, 0, 0, time.UTC))
+	test.Assert(t, restricted.enforced, "Restricted policy isn't enforced")
+	test.AssertEquals(t, len(restricted.groups[0].logs), 1)
+	test.AssertEquals(t, restricted.groups[0].logs[0].uri, "https://google2018.example.com")
+	test.AssertEquals(t, len(restricted.groups[1].logs), 2)
+	// Nor are they routed to any shard when none covers them, so the policy
+	// can't be satisfied.
+	restricted = policy.forNotAfter(time.Date(2019, 3, 1, 0, 0, 0, 0, time.UTC))
+	test.AssertEquals(t, len(restricted.groups[0].logs), 0)
+	test.AssertEquals(t, len(restricted.groups[1].logs), 1)
+	test.AssertEquals(t, restricted.groups[1].logs[0].uri, "https://other.example.com")
+
+	// Without a policy, the logs passed to New are routed the same way.
+	pub.ctLogs = policy.groups[0].logs
+	test.AssertEquals(t, len(pub.currentPolicy(time.Date(2017, 3, 1, 0, 0, 0, 0, time.UTC)).groups), 1)
+	test.AssertEquals(t, len(pub.currentPolicy(time.Date(2019, 3, 1, 0, 0, 0, 0, time.UTC)).groups), 0)
+}
+
+func TestMissingSCTs(t *testing.T) {
+	pub, _, k := setup(t)
+	contents := makeLogList(t, k, []testListLog{
+		{url: "google.example.com", operator: 0},
+		{url: "google2018.example.com", operator: 0, year: 2018},
+		{url: "other.example.com", operator: 1},
+		{url: "third.example.com", operator: 2},
+	})
+	policy, err := newLogPolicy(contents, []cmd.CTLogGroupConfig{
+		{Name: "Google", Operators: []string{"Google"}, MinSCTs: 2},
+		{Name: "non-Google", Operators: []string{"Google"}, Exclude: true, MinSCTs: 1},
+	})
+	test.AssertNotError(t, err, "Failed to load policy")
+	// The test logs all share a key, so give them distinct IDs.
+	for _, g := range policy.groups {
+		for _, ctLog := range g.logs {
+			ctLog.id = ctLog.uri
+		}
+	}
+	pub.policy = policy
+
+	in2018 := time.Date(2018, 3, 1, 0, 0, 0, 0, time.UTC)
+	in2019 := time.Date(2019, 3, 1, 0, 0, 0, 0, time.UTC)
+	google := "https://google.example.com"
+	google2018 := "https://google2018.example.com"
+	other := "https://other.example.com"
+
+	test.Assert(t, pub.MissingSCTs(in2018, nil), "No SCTs satisfied the policy")
+	test.Assert(t, pub.MissingSCTs(in2018, []string{google, other}), "Too few Google SCTs satisfied the policy")
+	test.Assert(t, pub.MissingSCTs(in2018, []string{google, google2018}), "No non-Google SCT satisfied the policy")
+	test.Assert(t, pub.MissingSCTs(in2018, []string{google, google, other}), "Duplicate SCTs satisfied the policy")
+	test.Assert(t, !pub.MissingSCTs(in2018, []string{google, google2018, other}), "Policy wasn't satisfied")
+	// Only one Google log accepts certificates expiring in 2019, so its SCT
+	// is as many as submitting again could get.
+	test.Assert(t, !pub.MissingSCTs(in2019, []string{google, other}), "Policy wasn't satisfied by every covering log")
+	test.AssertDeepEquals(t, policy.forNotAfter(in2019).missingSCTs([]string{other}), []string{"Google"})
+	// SCTs from logs outside the policy don't count.
+	test.Assert(t, pub.MissingSCTs(in2019, []string{google, "unknown"}), "Unknown log's SCT satisfied the policy")
+
+	// Without a policy, every log passed to New that accepts the
+	// certificate is expected to have issued an SCT.
+	pub.policy = nil
+	pub.ctLogs = policy.groups[0].logs
+	test.Assert(t, pub.MissingSCTs(in2018, []string{google}), "Shard's SCT wasn't missing")
+	test.Assert(t, !pub.MissingSCTs(in2018, []string{google, google2018}), "SCTs were missing")
+	test.Assert(t, !pub.MissingSCTs(in2019, []string{google}), "SCTs were missing")
+}
@@ -11,6 +11,7 @@ It is generated from these files:
 It has these top-level messages:
 	Request
 	Empty
+	SCTs
 */
 package publisher
 
@@ -60,9 +61,27 @@ func (m *Empty) String() string            { return proto.CompactTextString(m) }
 func (*Empty) ProtoMessage()               {}
 func (*Empty) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{1} }
 
+type SCTs struct {
+	Sct              [][]byte `protobuf:"bytes,1,rep,name=sct" json:"sct,omitempty"`
+	XXX_unrecognized []byte   `json:"-"`
+}
+
+func (m *SCTs) Reset()                    { *m = SCTs{} }
+func (m *SCTs) String() string            { return proto.CompactTextString(m) }
+func (*SCTs) ProtoMessage()               {}
+func (*SCTs) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{2} }
+
+func (m *SCTs) GetSct() [][]byte {
+	if m != nil {
+		return m.Sct
+	}
+	return nil
+}
+
 func init() {
 	proto.RegisterType((*Request)(nil), "Request")
 	proto.RegisterType((*Empty)(nil), "Empty")
+	proto.RegisterType((*SCTs)(nil), "SCTs")
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -77,6 +96,7 @@ const _ = grpc.SupportPackageIsVersion3
 
 type PublisherClient interface {
 	SubmitToCT(ctx context.Context, in *Request, opts ...grpc.CallOption) (*Empty, error)
+	SubmitPrecertToCT(ctx context.Context, in *Request, opts ...grpc.CallOption) (*SCTs, error)
 }
 
 type publisherClient struct {
@@ -96,10 +116,20 @@ func (c *publisherClient) SubmitToCT(ctx context.Context, in *Request, opts ...g
 	return out, nil
 }
 
+func (c *publisherClient) SubmitPrecertToCT(ctx context.Context, in *Request, opts ...grpc.CallOption) (*SCTs, error) {
+	out := new(SCTs)
+	err := grpc.Invoke(ctx, "/Publisher/SubmitPrecertToCT", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // Server API for Publisher service
 
 type PublisherServer interface {
 	SubmitToCT(context.Context, *Request) (*Empty, error)
+	SubmitPrecertToCT(context.Context, *Request) (*SCTs, error)
 }
 
 func RegisterPublisherServer(s *grpc.Server, srv PublisherServer) {
@@ -124,6 +154,24 @@ func _Publisher_SubmitToCT_Handler(srv interface{}, ctx context.Context, dec fun
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Publisher_SubmitPrecertToCT_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Request)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PublisherServer).SubmitPrecertToCT(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Publisher/SubmitPrecertToCT",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PublisherServer).SubmitPrecertToCT(ctx, req.(*Request))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var _Publisher_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "Publisher",
 	HandlerType: (*PublisherServer)(nil),
@@ -132,6 +180,10 @@ var _Publisher_serviceDesc = grpc.ServiceDesc{
 			MethodName: "SubmitToCT",
 			Handler:    _Publisher_SubmitToCT_Handler,
 		},
+		{
+			MethodName: "SubmitPrecertToCT",
+			Handler:    _Publisher_SubmitPrecertToCT_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: fileDescriptor0,
@@ -140,12 +192,14 @@ var _Publisher_serviceDesc = grpc.ServiceDesc{
 func init() { proto.RegisterFile("publisher.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 107 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0xe2, 0xe2, 0x2f, 0x28, 0x4d, 0xca,
+	// 140 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0x03, 0xe3, 0xe2, 0x2f, 0x28, 0x4d, 0xca,
 	0xc9, 0x2c, 0xce, 0x48, 0x2d, 0xd2, 0x2b, 0x28, 0xca, 0x2f, 0xc9, 0x57, 0x12, 0xe3, 0x62, 0x0f,
 	0x4a, 0x2d, 0x2c, 0x4d, 0x2d, 0x2e, 0x11, 0xe2, 0xe6, 0x62, 0x4e, 0x49, 0x2d, 0x92, 0x60, 0x54,
-	0x60, 0xd4, 0xe0, 0x51, 0x62, 0xe7, 0x62, 0x75, 0xcd, 0x2d, 0x28, 0xa9, 0x34, 0xd2, 0xe5, 0xe2,
-	0x0c, 0x80, 0xe9, 0x11, 0x52, 0xe0, 0xe2, 0x0a, 0x2e, 0x4d, 0xca, 0xcd, 0x2c, 0x09, 0xc9, 0x77,
-	0x0e, 0x11, 0xe2, 0xd0, 0x83, 0x6a, 0x95, 0x62, 0xd3, 0x03, 0x2b, 0x56, 0x62, 0x00, 0x04, 0x00,
-	0x00, 0xff, 0xff, 0x19, 0x50, 0xa9, 0x22, 0x61, 0x00, 0x00, 0x00,
+	0x60, 0xd4, 0xe0, 0x51, 0x62, 0xe7, 0x62, 0x75, 0xcd, 0x2d, 0x28, 0xa9, 0x54, 0x12, 0xe6, 0x62,
+	0x09, 0x76, 0x0e, 0x29, 0x06, 0xc9, 0x16, 0x27, 0x97, 0x00, 0x65, 0x99, 0x35, 0x78, 0x8c, 0x42,
+	0xb9, 0x38, 0x03, 0x60, 0x06, 0x09, 0x29, 0x70, 0x71, 0x05, 0x97, 0x26, 0xe5, 0x66, 0x96, 0x84,
+	0xe4, 0x3b, 0x87, 0x08, 0x71, 0xe8, 0x41, 0xcd, 0x93, 0x62, 0xd3, 0x83, 0x98, 0xc0, 0x20, 0xa4,
+	0xc6, 0x25, 0x08, 0x51, 0x11, 0x50, 0x94, 0x9a, 0x9c, 0x5a, 0x84, 0xae, 0x90, 0x55, 0x0f, 0x64,
+	0x83, 0x12, 0x03, 0x00, 0xce, 0xef, 0x85, 0x4a, 0x9e, 0x00, 0x00, 0x00,
 }
@@ -1,30 +1,51 @@
 package publisher
 
 import (
+	"crypto/sha256"
 	"crypto/x509"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	ct "github.com/google/certificate-transparency/go"
 	ctClient "github.com/google/certificate-transparency/go/client"
 	"golang.org/x/net/context"
 
+	"github.com/letsencrypt/boulder/cmd"
 	"github.com/letsencrypt/boulder/core"
 	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/precert"
+	"github.com/letsencrypt/boulder/reloader"
 )
 
 // Log contains the CT client and signature verifier for a particular CT log
 type Log struct {
-	uri      string
+	uri string
+	// The log's ID, the base64 encoded hash of its public key, which its SCTs
+	// are stored under
+	id       string
 	client   *ctClient.LogClient
 	verifier *ct.SignatureVerifier
+
+	// If either is set, the log is a temporal shard, which only accepts
+	// certificates whose NotAfter is in [notAfterStart, notAfterEnd)
+	notAfterStart time.Time
+	notAfterEnd   time.Time
 }
 
 // NewLog returns an initialized Log struct
 func NewLog(uri, b64PK string) (*Log, error) {
+	return NewShardedLog(uri, b64PK, time.Time{}, time.Time{})
+}
+
+// NewShardedLog returns an initialized Log struct for a log that only accepts
+// certificates whose NotAfter is at or after notAfterStart, and before
+// notAfterEnd. A zero time leaves that end of the window open.
+func NewShardedLog(uri, b64PK string, notAfterStart, notAfterEnd time.Time) (*Log, error) {
 	if strings.HasSuffix(uri, "/") {
 		uri = uri[0 : len(uri)-1]
 	}
@@ -43,8 +64,77 @@ func NewLog(uri, b64PK string) (*Log, error) {
 	if err != nil {
 		return nil, err
 	}
+	id := sha256.Sum256(pkBytes)
+
+	return &Log{
+		uri:           uri,
+		id:            base64.StdEncoding.EncodeToString(id[:]),
+		client:        client,
+		verifier:      verifier,
+		notAfterStart: notAfterStart,
+		notAfterEnd:   notAfterEnd,
+	}, nil
+}
+
+// description returns the log's description, as it would be configured
+func (l *Log) description() cmd.LogDescription {
+	return cmd.LogDescription{URI: l.uri, NotAfterStart: l.notAfterStart, NotAfterEnd: l.notAfterEnd}
+}
+
+// covers returns whether the log accepts certificates expiring at notAfter
+func (l *Log) covers(notAfter time.Time) bool {
+	return l.description().Covers(notAfter)
+}
 
-	return &Log{uri, client, verifier}, nil
+// httpStatusError is a log answering a submission with an HTTP status that
+// the CT client doesn't retry.
+type httpStatusError struct {
+	statusCode int
+	err        error
+}
+
+func (e httpStatusError) Error() string {
+	return e.err.Error()
+}
+
+// statusError returns err as an httpStatusError if it's the CT client
+// reporting the status a log answered with, which it only does in its message.
+func statusError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var statusCode int
+	if _, scanErr := fmt.Sscanf(err.Error(), "got HTTP Status %d", &statusCode); scanErr != nil {
+		return err
+	}
+	return httpStatusError{statusCode: statusCode, err: err}
+}
+
+// addChain submits a certificate chain to the log.
+func (l *Log) addChain(ctx context.Context, chain []ct.ASN1Cert) (*ct.SignedCertificateTimestamp, error) {
+	sct, err := l.client.AddChainWithContext(ctx, chain)
+	return sct, statusError(err)
+}
+
+// addPreChain submits a precertificate chain to the log. The CT client has no
+// context aware version of AddPreChain, so this stops waiting for it, rather
+// than cancelling it, when ctx expires.
+func (l *Log) addPreChain(ctx context.Context, chain []ct.ASN1Cert) (*ct.SignedCertificateTimestamp, error) {
+	type result struct {
+		sct *ct.SignedCertificateTimestamp
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		sct, err := l.client.AddPreChain(chain)
+		done <- result{sct, statusError(err)}
+	}()
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case r := <-done:
+		return r.sct, r.err
+	}
 }
 
 type ctSubmissionRequest struct {
@@ -59,6 +149,16 @@ type Impl struct {
 	ctLogs            []*Log
 	submissionTimeout time.Duration
 
+	// policyMu protects policy, which is replaced whenever its log list is
+	// reloaded
+	policyMu sync.RWMutex
+	policy   *logPolicy
+	// policyReloader reloads policy's log list, until Close stops it
+	policyReloader *reloader.Reloader
+
+	// If set, failed submissions are queued in the SA to be retried
+	queue *retryQueue
+
 	SA core.StorageAuthority
 }
 
@@ -76,59 +176,265 @@ func New(bundle []ct.ASN1Cert, logs []*Log, submissionTimeout time.Duration, log
 	}
 }
 
-// SubmitToCT will submit the certificate represented by certDER to any CT
-// logs configured in pub.CT.Logs (AMQP RPC method).
+// LoadLogPolicy loads the CT logs to submit to from the JSON log list in
+// filename, sorted into groups, each of which must issue some number of SCTs
+// for a certificate. The log list is reloaded whenever it changes. Once a
+// policy is loaded the logs passed to New are no longer used, and precertificate
+// submissions fail unless they satisfy the policy. Close stops the reloading.
+func (pub *Impl) LoadLogPolicy(filename string, groups []cmd.CTLogGroupConfig) error {
+	r, err := reloader.New(filename, func(contents []byte) error {
+		policy, err := newLogPolicy(contents, groups)
+		if err != nil {
+			return err
+		}
+		pub.policyMu.Lock()
+		pub.policy = policy
+		pub.policyMu.Unlock()
+		for _, g := range policy.groups {
+			pub.log.Info(fmt.Sprintf("Loaded CT log group %q from %s: %d logs, %d SCTs required",
+				g.name, filename, len(g.logs), g.minSCTs))
+			for _, gap := range g.notAfterGaps(time.Now()) {
+				pub.log.Warning(fmt.Sprintf("CT log group %q: %s", g.name, gap))
+			}
+		}
+		return nil
+	}, func(err error) {
+		pub.log.Err(fmt.Sprintf("Failed to reload CT log list from %s: %s", filename, err))
+	})
+	if err != nil {
+		return err
+	}
+	pub.Close()
+	pub.policyReloader = r
+	return nil
+}
+
+// Close stops reloading the log list loaded by LoadLogPolicy, if there is one.
+// The policy last loaded stays in use.
+func (pub *Impl) Close() {
+	if pub.policyReloader != nil {
+		pub.policyReloader.Stop()
+		pub.policyReloader = nil
+	}
+}
+
+// currentPolicy returns the loaded policy, or, if there isn't one, a policy
+// that submits to every log passed to New and doesn't fail when they do. Only
+// logs that accept certificates expiring at notAfter are included.
+func (pub *Impl) currentPolicy(notAfter time.Time) *logPolicy {
+	pub.policyMu.RLock()
+	policy := pub.policy
+	pub.policyMu.RUnlock()
+	if policy != nil {
+		return policy.forNotAfter(notAfter)
+	}
+	policy = &logPolicy{}
+	for _, ctLog := range pub.ctLogs {
+		if !ctLog.covers(notAfter) {
+			continue
+		}
+		policy.groups = append(policy.groups, &logGroup{name: ctLog.uri, logs: []*Log{ctLog}, minSCTs: 1})
+	}
+	return policy
+}
+
+// MissingSCTs reports whether the SCTs stored for a certificate expiring at
+// notAfter, issued by the logs with IDs logIDs, fall short of what the current
+// policy would get for it, so that it should be submitted again.
+func (pub *Impl) MissingSCTs(notAfter time.Time, logIDs []string) bool {
+	return len(pub.currentPolicy(notAfter).missingSCTs(logIDs)) > 0
+}
+
+// SubmitToCT will submit the certificate represented by certDER to the CT
+// logs of the current policy that accept its NotAfter (AMQP RPC method). If a
+// policy is loaded, and the SCTs don't satisfy it, it returns an error.
 func (pub *Impl) SubmitToCT(ctx context.Context, der []byte) error {
 	cert, err := x509.ParseCertificate(der)
 	if err != nil {
 		pub.log.AuditErr(fmt.Sprintf("Failed to parse certificate: %s", err))
 		return err
 	}
+	serial := core.SerialToString(cert.SerialNumber)
 
 	localCtx, cancel := context.WithTimeout(ctx, pub.submissionTimeout)
 	defer cancel()
-	chain := append([]ct.ASN1Cert{der}, pub.issuerBundle...)
-	for _, ctLog := range pub.ctLogs {
-		sct, err := ctLog.client.AddChainWithContext(localCtx, chain)
+	policy := pub.currentPolicy(cert.NotAfter)
+	failures := newSubmissionFailures()
+	result := policy.submit(localCtx, func(ctx context.Context, ctLog *Log) (*ct.SignedCertificateTimestamp, error) {
+		sct, err := pub.submitCert(ctx, ctLog, der, serial)
 		if err != nil {
-			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
-			pub.log.AuditErr(fmt.Sprintf("Failed to submit certificate to CT log at %s: %s", ctLog.uri, err))
-			continue
+			failures.add(ctx, ctLog, err)
 		}
+		return sct, err
+	})
+	if pub.queue != nil {
+		pub.enqueueFailures(ctx, policy, result, failures, serial, false)
+	}
+	return pub.checkPolicy(policy, result, serial)
+}
 
-		err = ctLog.verifier.VerifySCTSignature(*sct, ct.LogEntry{
-			Leaf: ct.MerkleTreeLeaf{
-				LeafType: ct.TimestampedEntryLeafType,
-				TimestampedEntry: ct.TimestampedEntry{
-					X509Entry: ct.ASN1Cert(der),
-					EntryType: ct.X509LogEntryType,
-				},
+// submitCert submits the certificate der, with serial, to ctLog, and stores
+// the SCT the log issues for it.
+func (pub *Impl) submitCert(ctx context.Context, ctLog *Log, der []byte, serial string) (*ct.SignedCertificateTimestamp, error) {
+	chain := append([]ct.ASN1Cert{der}, pub.issuerBundle...)
+	entry := ct.LogEntry{
+		Leaf: ct.MerkleTreeLeaf{
+			LeafType: ct.TimestampedEntryLeafType,
+			TimestampedEntry: ct.TimestampedEntry{
+				X509Entry: ct.ASN1Cert(der),
+				EntryType: ct.X509LogEntryType,
 			},
-		})
+		},
+	}
+	sct, err := ctLog.addChain(ctx, chain)
+	if err != nil {
+		pub.auditSubmissionErr(ctx, fmt.Sprintf("Failed to submit certificate to CT log at %s: %s", ctLog.uri, err))
+		return nil, err
+	}
+	return sct, pub.verifyAndStoreSCT(ctx, ctLog, sct, entry, serial)
+}
+
+// SubmitPrecertToCT will submit the precertificate represented by der to the
+// CT logs of the current policy that accept its NotAfter with add-pre-chain,
+// store the SCTs they return, and return them TLS encoded, ready to be
+// embedded in the final certificate. If a policy is loaded, and the SCTs don't
+// satisfy it, it returns an error. Otherwise logs that fail are skipped, so
+// fewer SCTs than logs may be returned, and it is up to the caller to decide
+// how many are enough.
+func (pub *Impl) SubmitPrecertToCT(ctx context.Context, der []byte) ([][]byte, error) {
+	cert, entry, err := pub.precertEntry(der)
+	if err != nil {
+		return nil, err
+	}
+	serial := core.SerialToString(cert.SerialNumber)
+
+	localCtx, cancel := context.WithTimeout(ctx, pub.submissionTimeout)
+	defer cancel()
+	policy := pub.currentPolicy(cert.NotAfter)
+	failures := newSubmissionFailures()
+	result := policy.submit(localCtx, func(ctx context.Context, ctLog *Log) (*ct.SignedCertificateTimestamp, error) {
+		sct, err := pub.submitPrecert(ctx, ctLog, der, entry, serial)
 		if err != nil {
-			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
-			pub.log.AuditErr(fmt.Sprintf("Failed to verify SCT receipt: %s", err))
-			continue
+			failures.add(ctx, ctLog, err)
 		}
+		return sct, err
+	})
+	if pub.queue != nil {
+		pub.enqueueFailures(ctx, policy, result, failures, serial, true)
+	}
 
-		internalSCT, err := sctToInternal(sct, core.SerialToString(cert.SerialNumber))
+	var scts [][]byte
+	for _, sct := range result.scts {
+		serialized, err := ct.SerializeSCT(*sct)
 		if err != nil {
 			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
-			pub.log.AuditErr(fmt.Sprintf("Failed to convert SCT receipt: %s", err))
+			pub.log.AuditErr(fmt.Sprintf("Failed to serialize SCT receipt: %s", err))
 			continue
 		}
+		scts = append(scts, serialized)
+	}
+	if err = pub.checkPolicy(policy, result, serial); err != nil {
+		return nil, err
+	}
+	return scts, nil
+}
 
-		err = pub.SA.AddSCTReceipt(localCtx, internalSCT)
-		if err != nil {
-			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
-			pub.log.AuditErr(fmt.Sprintf("Failed to store SCT receipt in database: %s", err))
-			continue
+// precertEntry parses the precertificate der, and returns it along with the
+// log entry that logs sign over for it: its TBSCertificate without the poison,
+// and the hash of its issuer's key (RFC 6962, Section 3.2).
+func (pub *Impl) precertEntry(der []byte) (*x509.Certificate, ct.LogEntry, error) {
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		pub.log.AuditErr(fmt.Sprintf("Failed to parse precertificate: %s", err))
+		return nil, ct.LogEntry{}, err
+	}
+	if !precert.IsPrecertificate(cert) {
+		return nil, ct.LogEntry{}, errors.New("certificate isn't a precertificate")
+	}
+	tbs, err := precert.TBSWithout(der, precert.OIDPoison)
+	if err != nil {
+		return nil, ct.LogEntry{}, err
+	}
+	for _, issuerDER := range pub.issuerBundle {
+		issuer, err := x509.ParseCertificate(issuerDER)
+		if err == nil && cert.CheckSignatureFrom(issuer) == nil {
+			return cert, ct.LogEntry{
+				Leaf: ct.MerkleTreeLeaf{
+					LeafType: ct.TimestampedEntryLeafType,
+					TimestampedEntry: ct.TimestampedEntry{
+						PrecertEntry: ct.PreCert{
+							IssuerKeyHash:  sha256.Sum256(issuer.RawSubjectPublicKeyInfo),
+							TBSCertificate: tbs,
+						},
+						EntryType: ct.PrecertLogEntryType,
+					},
+				},
+			}, nil
 		}
 	}
+	return nil, ct.LogEntry{}, errors.New("precertificate wasn't signed by any issuer in the bundle")
+}
+
+// submitPrecert submits the precertificate der, with serial, to ctLog, and
+// stores the SCT the log issues for entry.
+func (pub *Impl) submitPrecert(ctx context.Context, ctLog *Log, der []byte, entry ct.LogEntry, serial string) (*ct.SignedCertificateTimestamp, error) {
+	chain := append([]ct.ASN1Cert{der}, pub.issuerBundle...)
+	sct, err := ctLog.addPreChain(ctx, chain)
+	if err != nil {
+		pub.auditSubmissionErr(ctx, fmt.Sprintf("Failed to submit precertificate to CT log at %s: %s", ctLog.uri, err))
+		return nil, err
+	}
+	return sct, pub.verifyAndStoreSCT(ctx, ctLog, sct, entry, serial)
+}
+
+// verifyAndStoreSCT checks the signature on the SCT ctLog issued for entry,
+// and stores it as a receipt for the certificate with serial.
+func (pub *Impl) verifyAndStoreSCT(ctx context.Context, ctLog *Log, sct *ct.SignedCertificateTimestamp, entry ct.LogEntry, serial string) error {
+	err := ctLog.verifier.VerifySCTSignature(*sct, entry)
+	if err != nil {
+		// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+		pub.log.AuditErr(fmt.Sprintf("Failed to verify SCT receipt: %s", err))
+		return err
+	}
 
+	internalSCT, err := sctToInternal(sct, serial)
+	if err != nil {
+		// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+		pub.log.AuditErr(fmt.Sprintf("Failed to convert SCT receipt: %s", err))
+		return err
+	}
+
+	err = pub.SA.AddSCTReceipt(ctx, internalSCT)
+	if err != nil {
+		pub.auditSubmissionErr(ctx, fmt.Sprintf("Failed to store SCT receipt in database: %s", err))
+		return err
+	}
 	return nil
 }
 
+// auditSubmissionErr logs a failure to submit to a log, unless the submission
+// was cancelled because other logs in its group already issued enough SCTs.
+func (pub *Impl) auditSubmissionErr(ctx context.Context, msg string) {
+	if ctx.Err() == context.Canceled {
+		return
+	}
+	// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+	pub.log.AuditErr(msg)
+}
+
+// checkPolicy returns an error if policy is enforced, and the submission of
+// the certificate with serial, which had result, didn't satisfy it.
+func (pub *Impl) checkPolicy(policy *logPolicy, result submissionResult, serial string) error {
+	if !policy.enforced || result.satisfied {
+		return nil
+	}
+	err := fmt.Errorf("CT log policy not satisfied for serial %s: too few SCTs from groups %s",
+		serial, strings.Join(result.unsatisfied, ", "))
+	// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+	pub.log.AuditErr(err.Error())
+	return err
+}
+
 func sctToInternal(sct *ct.SignedCertificateTimestamp, serial string) (core.SignedCertificateTimestamp, error) {
 	sig, err := ct.MarshalDigitallySigned(sct.Signature)
 	if err != nil {
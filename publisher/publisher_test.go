@@ -1,11 +1,13 @@
 package publisher
 
 import (
+	"bytes"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/sha256"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/asn1"
 	"encoding/base64"
 	"encoding/json"
@@ -26,6 +28,7 @@ import (
 
 	blog "github.com/letsencrypt/boulder/log"
 	"github.com/letsencrypt/boulder/mocks"
+	"github.com/letsencrypt/boulder/precert"
 	"github.com/letsencrypt/boulder/test"
 )
 
@@ -177,6 +180,43 @@ func createSignedSCT(leaf []byte, k *ecdsa.PrivateKey) string {
 	return string(jsonSCT)
 }
 
+func createSignedPrecertSCT(tbs []byte, issuerKeyHash [32]byte, k *ecdsa.PrivateKey) string {
+	rawKey, _ := x509.MarshalPKIXPublicKey(&k.PublicKey)
+	pkHash := sha256.Sum256(rawKey)
+	sct := ct.SignedCertificateTimestamp{
+		SCTVersion: ct.V1,
+		LogID:      pkHash,
+		Timestamp:  1337,
+	}
+	serialized, _ := ct.SerializeSCTSignatureInput(sct, ct.LogEntry{
+		Leaf: ct.MerkleTreeLeaf{
+			LeafType: ct.TimestampedEntryLeafType,
+			TimestampedEntry: ct.TimestampedEntry{
+				PrecertEntry: ct.PreCert{
+					IssuerKeyHash:  issuerKeyHash,
+					TBSCertificate: tbs,
+				},
+				EntryType: ct.PrecertLogEntryType,
+			},
+		},
+	})
+	hashed := sha256.Sum256(serialized)
+	var ecdsaSig struct {
+		R, S *big.Int
+	}
+	ecdsaSig.R, ecdsaSig.S, _ = ecdsa.Sign(rand.Reader, k, hashed[:])
+	sig, _ := asn1.Marshal(ecdsaSig)
+
+	ds := ct.DigitallySigned{
+		HashAlgorithm:      ct.SHA256,
+		SignatureAlgorithm: ct.ECDSA,
+		Signature:          sig,
+	}
+	dsString, _ := ds.Base64String()
+	return fmt.Sprintf(`{"sct_version":0,"id":"%s","timestamp":1337,"signature":"%s"}`,
+		base64.StdEncoding.EncodeToString(pkHash[:]), dsString)
+}
+
 func logSrv(leaf []byte, k *ecdsa.PrivateKey) *httptest.Server {
 	sct := createSignedSCT(leaf, k)
 	m := http.NewServeMux()
@@ -402,3 +442,80 @@ func TestBadServer(t *testing.T) {
 	test.AssertNotError(t, err, "Certificate submission failed")
 	test.AssertEquals(t, len(log.GetAllMatching("Failed to verify SCT receipt")), 1)
 }
+
+// makePrecert returns a precertificate and the issuer that signed it, both DER
+// encoded.
+func makePrecert(t *testing.T) ([]byte, []byte) {
+	issuerKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	test.AssertNotError(t, err, "Failed to generate issuer key")
+	issuerTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "precert issuer"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	issuerDER, err := x509.CreateCertificate(rand.Reader, issuerTemplate, issuerTemplate, issuerKey.Public(), issuerKey)
+	test.AssertNotError(t, err, "Failed to create issuer")
+	issuer, err := x509.ParseCertificate(issuerDER)
+	test.AssertNotError(t, err, "Failed to parse issuer")
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	test.AssertNotError(t, err, "Failed to generate key")
+	template := &x509.Certificate{
+		SerialNumber:    big.NewInt(1337),
+		NotBefore:       time.Now(),
+		NotAfter:        time.Now().Add(time.Hour),
+		DNSNames:        []string{"not-example.com"},
+		ExtraExtensions: []pkix.Extension{precert.PoisonExtension},
+	}
+	precertDER, err := x509.CreateCertificate(rand.Reader, template, issuer, key.Public(), issuerKey)
+	test.AssertNotError(t, err, "Failed to create precertificate")
+	return precertDER, issuerDER
+}
+
+func TestSubmitPrecert(t *testing.T) {
+	pub, leaf, k := setup(t)
+	precertDER, issuerDER := makePrecert(t)
+	issuer, err := x509.ParseCertificate(issuerDER)
+	test.AssertNotError(t, err, "Failed to parse issuer")
+	tbs, err := precert.TBSWithout(precertDER, precert.OIDPoison)
+	test.AssertNotError(t, err, "Failed to strip poison")
+
+	// Precertificates must come from an issuer in the bundle.
+	_, err = pub.SubmitPrecertToCT(ctx, precertDER)
+	test.AssertError(t, err, "Submitted precertificate from unknown issuer")
+	pub.issuerBundle = append(pub.issuerBundle, ct.ASN1Cert(issuerDER))
+
+	_, err = pub.SubmitPrecertToCT(ctx, leaf.Raw)
+	test.AssertError(t, err, "Submitted certificate as precertificate")
+
+	sct := createSignedPrecertSCT(tbs, sha256.Sum256(issuer.RawSubjectPublicKeyInfo), k)
+	m := http.NewServeMux()
+	m.HandleFunc("/ct/v1/add-pre-chain", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, sct)
+	})
+	srv := httptest.NewServer(m)
+	defer srv.Close()
+	port, err := getPort(srv)
+	test.AssertNotError(t, err, "Failed to get test server port")
+	addLog(t, pub, port, &k.PublicKey)
+	badSrv := badLogSrv()
+	defer badSrv.Close()
+	port, err = getPort(badSrv)
+	test.AssertNotError(t, err, "Failed to get test server port")
+	addLog(t, pub, port, &k.PublicKey)
+
+	log.Clear()
+	scts, err := pub.SubmitPrecertToCT(ctx, precertDER)
+	test.AssertNotError(t, err, "Precertificate submission failed")
+	test.AssertEquals(t, len(log.GetAllMatching("Failed to verify SCT receipt")), 1)
+	test.AssertEquals(t, len(scts), 1)
+	parsed, err := ct.DeserializeSCT(bytes.NewReader(scts[0]))
+	test.AssertNotError(t, err, "Failed to parse returned SCT")
+	rawKey, _ := x509.MarshalPKIXPublicKey(&k.PublicKey)
+	test.AssertEquals(t, parsed.LogID, ct.SHA256Hash(sha256.Sum256(rawKey)))
+	test.AssertEquals(t, parsed.Timestamp, uint64(1337))
+}
@@ -0,0 +1,262 @@
+package publisher
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/cactus/go-statsd-client/statsd"
+	"github.com/jmhodges/clock"
+	"golang.org/x/net/context"
+
+	"github.com/letsencrypt/boulder/cmd"
+	"github.com/letsencrypt/boulder/core"
+)
+
+// retryQueue retries failed submissions of certificates to CT logs from the
+// SA, backing off exponentially, until the logs issue SCTs, or the
+// submissions die.
+type retryQueue struct {
+	clk   clock.Clock
+	stats statsd.Statter
+
+	period      time.Duration
+	batchSize   int
+	minBackoff  time.Duration
+	maxBackoff  time.Duration
+	maxAttempts int
+}
+
+// EnableRetryQueue makes the Publisher queue the submissions of certificates
+// to CT logs that fail in the SA, to be retried by RetryQueueLoop. Only logs
+// in groups that didn't get enough SCTs are retried.
+func (pub *Impl) EnableRetryQueue(c cmd.CTRetryQueueConfig, clk clock.Clock, stats statsd.Statter) error {
+	switch {
+	case c.Period.Duration <= 0:
+		return errors.New("retry queue period must be positive")
+	case c.BatchSize <= 0:
+		return errors.New("retry queue batch size must be positive")
+	case c.MinBackoff.Duration <= 0 || c.MaxBackoff.Duration < c.MinBackoff.Duration:
+		return errors.New("retry queue backoff must be positive, and its maximum no less than its minimum")
+	case c.MaxAttempts <= 0:
+		return errors.New("retry queue must allow at least one attempt")
+	}
+	pub.queue = &retryQueue{
+		clk:         clk,
+		stats:       stats,
+		period:      c.Period.Duration,
+		batchSize:   c.BatchSize,
+		minBackoff:  c.MinBackoff.Duration,
+		maxBackoff:  c.MaxBackoff.Duration,
+		maxAttempts: c.MaxAttempts,
+	}
+	return nil
+}
+
+// backoff returns how long to wait before retrying a submission that has
+// failed attempts times.
+func (q *retryQueue) backoff(attempts int) time.Duration {
+	backoff := q.minBackoff
+	for i := 1; i < attempts && backoff < q.maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > q.maxBackoff {
+		backoff = q.maxBackoff
+	}
+	return backoff
+}
+
+// rejected returns whether err is a log refusing a certificate, rather than
+// failing to process it. Logs answer a bad certificate with a 4xx status, and
+// resubmitting it won't help, but 429 just means they're busy.
+func rejected(err error) bool {
+	statusErr, ok := err.(httpStatusError)
+	return ok && statusErr.statusCode >= 400 && statusErr.statusCode < 500 &&
+		statusErr.statusCode != http.StatusTooManyRequests
+}
+
+// submissionFailures collects the logs that failed to issue SCTs while a
+// certificate was submitted under a policy, and why.
+type submissionFailures struct {
+	sync.Mutex
+	errs map[*Log]error
+}
+
+func newSubmissionFailures() *submissionFailures {
+	return &submissionFailures{errs: make(map[*Log]error)}
+}
+
+// add records that ctLog failed with err, unless its submission was
+// cancelled because other logs in its group already issued enough SCTs.
+func (f *submissionFailures) add(ctx context.Context, ctLog *Log, err error) {
+	if ctx.Err() == context.Canceled {
+		return
+	}
+	f.Lock()
+	defer f.Unlock()
+	f.errs[ctLog] = err
+}
+
+// enqueueFailures queues the submissions of the certificate, or
+// precertificate, with serial to the logs that failed in the groups of policy
+// that result didn't satisfy.
+func (pub *Impl) enqueueFailures(ctx context.Context, policy *logPolicy, result submissionResult, failures *submissionFailures, serial string, precertificate bool) {
+	failures.Lock()
+	defer failures.Unlock()
+	for _, g := range policy.groups {
+		unsatisfied := false
+		for _, name := range result.unsatisfied {
+			unsatisfied = unsatisfied || name == g.name
+		}
+		if !unsatisfied {
+			continue
+		}
+		for _, ctLog := range g.logs {
+			err, failed := failures.errs[ctLog]
+			if !failed {
+				continue
+			}
+			sub := core.CTSubmission{
+				CertificateSerial: serial,
+				LogID:             ctLog.id,
+				Precertificate:    precertificate,
+				Status:            core.CTSubmissionPending,
+				Attempts:          1,
+				LastError:         err.Error(),
+				NextAttempt:       pub.queue.clk.Now().Add(pub.queue.backoff(1)),
+			}
+			if rejected(err) {
+				pub.killSubmission(&sub, ctLog.uri)
+			}
+			if err := pub.SA.AddCTSubmission(ctx, sub); err != nil {
+				// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+				pub.log.AuditErr(fmt.Sprintf("Failed to queue submission of serial %s to CT log at %s: %s", serial, ctLog.uri, err))
+				continue
+			}
+			pub.queue.stats.Inc("Publisher.RetryQueue.Queued", 1, 1.0)
+		}
+	}
+}
+
+// killSubmission marks sub as dead, so it won't be retried until it's
+// requeued.
+func (pub *Impl) killSubmission(sub *core.CTSubmission, uri string) {
+	sub.Status = core.CTSubmissionDead
+	// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+	pub.log.AuditErr(fmt.Sprintf("Gave up submitting serial %s to CT log at %s after %d attempts: %s",
+		sub.CertificateSerial, uri, sub.Attempts, sub.LastError))
+	pub.queue.stats.Inc("Publisher.RetryQueue.Died", 1, 1.0)
+}
+
+// findLog returns the configured log with id, if there is one.
+func (pub *Impl) findLog(id string) *Log {
+	pub.policyMu.RLock()
+	policy := pub.policy
+	pub.policyMu.RUnlock()
+	logs := pub.ctLogs
+	if policy != nil {
+		logs = nil
+		for _, g := range policy.groups {
+			logs = append(logs, g.logs...)
+		}
+	}
+	for _, ctLog := range logs {
+		if ctLog.id == id {
+			return ctLog
+		}
+	}
+	return nil
+}
+
+// resubmit submits the certificate or precertificate of sub to ctLog again.
+func (pub *Impl) resubmit(ctx context.Context, ctLog *Log, sub core.CTSubmission) error {
+	localCtx, cancel := context.WithTimeout(ctx, pub.submissionTimeout)
+	defer cancel()
+	if !sub.Precertificate {
+		cert, err := pub.SA.GetCertificate(ctx, sub.CertificateSerial)
+		if err != nil {
+			return err
+		}
+		_, err = pub.submitCert(localCtx, ctLog, cert.DER, sub.CertificateSerial)
+		return err
+	}
+	precert, err := pub.SA.GetPrecertificate(ctx, sub.CertificateSerial)
+	if err != nil {
+		return err
+	}
+	_, entry, err := pub.precertEntry(precert.DER)
+	if err != nil {
+		return err
+	}
+	_, err = pub.submitPrecert(localCtx, ctLog, precert.DER, entry, sub.CertificateSerial)
+	return err
+}
+
+// retrySubmission resubmits the certificate or precertificate of sub to its
+// log. If the log issues an SCT, the submission is removed from the queue,
+// and otherwise it is put back with a longer backoff, or dies.
+func (pub *Impl) retrySubmission(ctx context.Context, sub core.CTSubmission) error {
+	ctLog := pub.findLog(sub.LogID)
+	var err error
+	if ctLog == nil {
+		err = fmt.Errorf("CT log %s is no longer configured", sub.LogID)
+	} else {
+		err = pub.resubmit(ctx, ctLog, sub)
+	}
+	if err == nil {
+		pub.queue.stats.Inc("Publisher.RetryQueue.Succeeded", 1, 1.0)
+		return pub.SA.RemoveCTSubmission(ctx, sub.ID)
+	}
+
+	sub.Attempts++
+	sub.LastError = err.Error()
+	if ctLog == nil || rejected(err) || sub.Attempts >= pub.queue.maxAttempts {
+		uri := sub.LogID
+		if ctLog != nil {
+			uri = ctLog.uri
+		}
+		pub.killSubmission(&sub, uri)
+	} else {
+		sub.NextAttempt = pub.queue.clk.Now().Add(pub.queue.backoff(sub.Attempts))
+		pub.queue.stats.Inc("Publisher.RetryQueue.Failed", 1, 1.0)
+	}
+	return pub.SA.UpdateCTSubmission(ctx, sub)
+}
+
+// retryQueueTick reports the depth of the queue, and retries a batch of the
+// submissions that are due.
+func (pub *Impl) retryQueueTick(ctx context.Context) error {
+	counts, err := pub.SA.CountCTSubmissions(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to count queued CT submissions: %s", err)
+	}
+	pub.queue.stats.Gauge("Publisher.RetryQueue.Pending", counts[core.CTSubmissionPending], 1.0)
+	pub.queue.stats.Gauge("Publisher.RetryQueue.Dead", counts[core.CTSubmissionDead], 1.0)
+
+	subs, err := pub.SA.GetDueCTSubmissions(ctx, pub.queue.clk.Now(), pub.queue.batchSize)
+	if err != nil {
+		return fmt.Errorf("failed to get due CT submissions: %s", err)
+	}
+	for _, sub := range subs {
+		err = pub.retrySubmission(ctx, sub)
+		if err != nil {
+			return fmt.Errorf("failed to update queued CT submission %d: %s", sub.ID, err)
+		}
+	}
+	return nil
+}
+
+// RetryQueueLoop retries the queued submissions that are due once a period,
+// forever. It must only be called once EnableRetryQueue has been.
+func (pub *Impl) RetryQueueLoop() {
+	for {
+		start := pub.queue.clk.Now()
+		err := pub.retryQueueTick(context.Background())
+		if err != nil {
+			pub.log.Warning(err.Error())
+		}
+		pub.queue.clk.Sleep(pub.queue.period - pub.queue.clk.Now().Sub(start))
+	}
+}
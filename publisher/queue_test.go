@@ -0,0 +1,303 @@
+package publisher
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cactus/go-statsd-client/statsd"
+	ct "github.com/google/certificate-transparency/go"
+	"github.com/jmhodges/clock"
+	"golang.org/x/net/context"
+
+	"github.com/letsencrypt/boulder/cmd"
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/mocks"
+	"github.com/letsencrypt/boulder/precert"
+	"github.com/letsencrypt/boulder/test"
+)
+
+// queueSA keeps the queued submissions in memory, and serves a single
+// certificate and precertificate.
+type queueSA struct {
+	*mocks.StorageAuthority
+	cert    core.Certificate
+	precert core.Certificate
+	subs    map[int64]core.CTSubmission
+	next    int64
+}
+
+func (sa *queueSA) GetCertificate(_ context.Context, serial string) (core.Certificate, error) {
+	if serial != sa.cert.Serial {
+		return core.Certificate{}, core.NotFoundError("no certificate")
+	}
+	return sa.cert, nil
+}
+
+func (sa *queueSA) GetPrecertificate(_ context.Context, serial string) (core.Certificate, error) {
+	if serial != sa.precert.Serial {
+		return core.Certificate{}, core.NotFoundError("no precertificate")
+	}
+	return sa.precert, nil
+}
+
+func (sa *queueSA) AddCTSubmission(_ context.Context, sub core.CTSubmission) error {
+	sa.next++
+	sub.ID = sa.next
+	sa.subs[sub.ID] = sub
+	return nil
+}
+
+func (sa *queueSA) GetDueCTSubmissions(_ context.Context, now time.Time, limit int) ([]core.CTSubmission, error) {
+	var due []core.CTSubmission
+	for _, sub := range sa.subs {
+		if sub.Status == core.CTSubmissionPending && !sub.NextAttempt.After(now) && len(due) < limit {
+			due = append(due, sub)
+		}
+	}
+	return due, nil
+}
+
+func (sa *queueSA) UpdateCTSubmission(_ context.Context, sub core.CTSubmission) error {
+	sa.subs[sub.ID] = sub
+	return nil
+}
+
+func (sa *queueSA) RemoveCTSubmission(_ context.Context, id int64) error {
+	delete(sa.subs, id)
+	return nil
+}
+
+// statusLogSrv issues SCTs for leaf while *status is 200, and fails with
+// *status otherwise.
+func statusLogSrv(leaf []byte, k *ecdsa.PrivateKey, status *int) *httptest.Server {
+	sct := createSignedSCT(leaf, k)
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if *status != http.StatusOK {
+			w.WriteHeader(*status)
+			return
+		}
+		fmt.Fprint(w, sct)
+	}))
+}
+
+func setupQueue(t *testing.T, status *int) (*Impl, *queueSA, clock.FakeClock, func()) {
+	pub, leaf, k := setup(t)
+	server := statusLogSrv(leaf.Raw, k, status)
+	port, err := getPort(server)
+	test.AssertNotError(t, err, "Failed to get test server port")
+	addLog(t, pub, port, &k.PublicKey)
+
+	clk := clock.NewFake()
+	stats, _ := statsd.NewNoopClient(nil)
+	err = pub.EnableRetryQueue(cmd.CTRetryQueueConfig{
+		Period:      cmd.ConfigDuration{Duration: time.Minute},
+		BatchSize:   10,
+		MinBackoff:  cmd.ConfigDuration{Duration: time.Minute},
+		MaxBackoff:  cmd.ConfigDuration{Duration: 3 * time.Minute},
+		MaxAttempts: 4,
+	}, clk, stats)
+	test.AssertNotError(t, err, "Failed to enable retry queue")
+
+	sa := &queueSA{
+		StorageAuthority: mocks.NewStorageAuthority(clk),
+		cert:             core.Certificate{Serial: core.SerialToString(leaf.SerialNumber), DER: leaf.Raw},
+		subs:             make(map[int64]core.CTSubmission),
+	}
+	pub.SA = sa
+	return pub, sa, clk, server.Close
+}
+
+func TestRejected(t *testing.T) {
+	status := http.StatusOK
+	pub, sa, _, cleanup := setupQueue(t, &status)
+	defer cleanup()
+
+	chain := []ct.ASN1Cert{sa.cert.DER}
+	for _, tc := range []struct {
+		status   int
+		rejected bool
+	}{
+		{http.StatusBadRequest, true},
+		{http.StatusTooManyRequests, false},
+		{http.StatusInternalServerError, false},
+		{http.StatusGatewayTimeout, false},
+	} {
+		status = tc.status
+		_, err := pub.ctLogs[0].addChain(ctx, chain)
+		test.AssertError(t, err, fmt.Sprintf("Submission succeeded with status %d", tc.status))
+		statusErr, ok := err.(httpStatusError)
+		test.Assert(t, ok, fmt.Sprintf("Status %d wasn't an httpStatusError: %s", tc.status, err))
+		test.AssertEquals(t, statusErr.statusCode, tc.status)
+		test.AssertEquals(t, rejected(err), tc.rejected)
+	}
+
+	// Errors that aren't an answer from the log are never rejections
+	test.Assert(t, !rejected(errors.New("got HTTP Status 400: but not from the log")), "Untyped error was a rejection")
+}
+
+func TestBackoff(t *testing.T) {
+	q := retryQueue{minBackoff: time.Minute, maxBackoff: 5 * time.Minute}
+	for attempts, expected := range []time.Duration{time.Minute, time.Minute, 2 * time.Minute, 4 * time.Minute, 5 * time.Minute, 5 * time.Minute} {
+		test.AssertEquals(t, q.backoff(attempts), expected)
+	}
+}
+
+func TestEnqueueFailures(t *testing.T) {
+	status := http.StatusGatewayTimeout
+	pub, sa, clk, cleanup := setupQueue(t, &status)
+	defer cleanup()
+
+	// A log that's down gets a pending submission
+	err := pub.SubmitToCT(ctx, sa.cert.DER)
+	test.AssertNotError(t, err, "Certificate submission failed")
+	test.AssertEquals(t, len(sa.subs), 1)
+	sub := sa.subs[1]
+	test.AssertEquals(t, sub.CertificateSerial, sa.cert.Serial)
+	test.AssertEquals(t, sub.LogID, pub.ctLogs[0].id)
+	test.AssertEquals(t, sub.Status, core.CTSubmissionPending)
+	test.AssertEquals(t, sub.Attempts, 1)
+	test.AssertEquals(t, sub.NextAttempt, clk.Now().Add(time.Minute))
+
+	// A log that rejects the certificate gets a dead one
+	status = http.StatusBadRequest
+	log.Clear()
+	err = pub.SubmitToCT(ctx, sa.cert.DER)
+	test.AssertNotError(t, err, "Certificate submission failed")
+	test.AssertEquals(t, len(sa.subs), 2)
+	test.AssertEquals(t, sa.subs[2].Status, core.CTSubmissionDead)
+	test.AssertEquals(t, len(log.GetAllMatching("Gave up submitting")), 1)
+
+	// And a log that issues an SCT gets none
+	status = http.StatusOK
+	err = pub.SubmitToCT(ctx, sa.cert.DER)
+	test.AssertNotError(t, err, "Certificate submission failed")
+	test.AssertEquals(t, len(sa.subs), 2)
+}
+
+func TestRetryQueueTick(t *testing.T) {
+	status := http.StatusInternalServerError
+	pub, sa, clk, cleanup := setupQueue(t, &status)
+	defer cleanup()
+
+	err := pub.SubmitToCT(ctx, sa.cert.DER)
+	test.AssertNotError(t, err, "Certificate submission failed")
+	test.AssertEquals(t, len(sa.subs), 1)
+
+	// Nothing is retried before it's due
+	err = pub.retryQueueTick(ctx)
+	test.AssertNotError(t, err, "Retry queue tick failed")
+	test.AssertEquals(t, sa.subs[1].Attempts, 1)
+
+	// Each failed retry backs off further, until the submission dies
+	log.Clear()
+	for _, backoff := range []time.Duration{2 * time.Minute, 3 * time.Minute} {
+		clk.Set(sa.subs[1].NextAttempt)
+		err = pub.retryQueueTick(ctx)
+		test.AssertNotError(t, err, "Retry queue tick failed")
+		test.AssertEquals(t, sa.subs[1].Status, core.CTSubmissionPending)
+		test.AssertEquals(t, sa.subs[1].NextAttempt, clk.Now().Add(backoff))
+	}
+	clk.Set(sa.subs[1].NextAttempt)
+	err = pub.retryQueueTick(ctx)
+	test.AssertNotError(t, err, "Retry queue tick failed")
+	test.AssertEquals(t, sa.subs[1].Status, core.CTSubmissionDead)
+	test.AssertEquals(t, sa.subs[1].Attempts, 4)
+	test.AssertEquals(t, len(log.GetAllMatching("Gave up submitting")), 1)
+
+	// Dead submissions aren't retried
+	clk.Add(time.Hour)
+	status = http.StatusOK
+	err = pub.retryQueueTick(ctx)
+	test.AssertNotError(t, err, "Retry queue tick failed")
+	test.AssertEquals(t, sa.subs[1].Attempts, 4)
+
+	// Once requeued, a successful retry removes the submission
+	sub := sa.subs[1]
+	sub.Status = core.CTSubmissionPending
+	sub.Attempts = 0
+	sa.subs[1] = sub
+	err = pub.retryQueueTick(ctx)
+	test.AssertNotError(t, err, "Retry queue tick failed")
+	test.AssertEquals(t, len(sa.subs), 0)
+}
+
+func TestRetryRemovedLog(t *testing.T) {
+	status := http.StatusInternalServerError
+	pub, sa, _, cleanup := setupQueue(t, &status)
+	defer cleanup()
+
+	sa.subs[1] = core.CTSubmission{
+		ID:                1,
+		CertificateSerial: sa.cert.Serial,
+		LogID:             "removed log",
+		Status:            core.CTSubmissionPending,
+		Attempts:          1,
+	}
+	err := pub.retryQueueTick(ctx)
+	test.AssertNotError(t, err, "Retry queue tick failed")
+	test.AssertEquals(t, sa.subs[1].Status, core.CTSubmissionDead)
+}
+
+func TestEnqueuePrecertFailures(t *testing.T) {
+	status := http.StatusInternalServerError
+	pub, sa, clk, cleanup := setupQueue(t, &status)
+	defer cleanup()
+
+	precertDER, issuerDER := makePrecert(t)
+	issuer, err := x509.ParseCertificate(issuerDER)
+	test.AssertNotError(t, err, "Failed to parse issuer")
+	pub.issuerBundle = append(pub.issuerBundle, ct.ASN1Cert(issuerDER))
+	tbs, err := precert.TBSWithout(precertDER, precert.OIDPoison)
+	test.AssertNotError(t, err, "Failed to strip poison")
+	sa.precert = core.Certificate{Serial: core.SerialToString(big.NewInt(1337)), DER: precertDER}
+
+	// Swap the queue's log for one that issues SCTs for the precertificate
+	k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	test.AssertNotError(t, err, "Failed to generate log key")
+	sct := createSignedPrecertSCT(tbs, sha256.Sum256(issuer.RawSubjectPublicKeyInfo), k)
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+		fmt.Fprint(w, sct)
+	}))
+	defer srv.Close()
+	port, err := getPort(srv)
+	test.AssertNotError(t, err, "Failed to get test server port")
+	pub.ctLogs = nil
+	addLog(t, pub, port, &k.PublicKey)
+
+	// A failed precertificate submission is queued as one
+	scts, err := pub.SubmitPrecertToCT(ctx, precertDER)
+	test.AssertNotError(t, err, "Precertificate submission failed")
+	test.AssertEquals(t, len(scts), 0)
+	test.AssertEquals(t, len(sa.subs), 1)
+	sub := sa.subs[1]
+	test.AssertEquals(t, sub.CertificateSerial, sa.precert.Serial)
+	test.AssertEquals(t, sub.LogID, pub.ctLogs[0].id)
+	test.Assert(t, sub.Precertificate, "Submission wasn't queued as a precertificate")
+	test.AssertEquals(t, sub.Status, core.CTSubmissionPending)
+
+	// And is retried as a precertificate, which removes it once the log
+	// issues an SCT
+	status = http.StatusOK
+	paths = nil
+	clk.Set(sub.NextAttempt)
+	err = pub.retryQueueTick(ctx)
+	test.AssertNotError(t, err, "Retry queue tick failed")
+	test.AssertEquals(t, len(sa.subs), 0)
+	test.AssertDeepEquals(t, paths, []string{"/ct/v1/add-pre-chain"})
+}
@@ -46,6 +46,7 @@ type RegistrationAuthorityImpl struct {
 	VA          core.ValidationAuthority
 	SA          core.StorageAuthority
 	PA          core.PolicyAuthority
+	Publisher   core.Publisher
 	stats       statsd.Statter
 	DNSResolver bdns.DNSResolver
 	clk         clock.Clock
@@ -62,6 +63,9 @@ type RegistrationAuthorityImpl struct {
 	maxNames                     int
 	forceCNFromSAN               bool
 	reuseValidAuthz              bool
+	// If non-zero, certificates for DNS names are issued by way of a
+	// precertificate, and must embed at least this many SCTs.
+	precertificateSCTs int
 
 	regByIPStats         metrics.Scope
 	pendAuthByRegIDStats metrics.Scope
@@ -81,6 +85,7 @@ func NewRegistrationAuthorityImpl(
 	reuseValidAuthz bool,
 	authorizationLifetime time.Duration,
 	pendingAuthorizationLifetime time.Duration,
+	precertificateSCTs int,
 ) *RegistrationAuthorityImpl {
 	scope := metrics.NewStatsdScope(stats, "RA")
 	ra := &RegistrationAuthorityImpl{
@@ -96,6 +101,7 @@ func NewRegistrationAuthorityImpl(
 		maxNames:                     maxNames,
 		forceCNFromSAN:               forceCNFromSAN,
 		reuseValidAuthz:              reuseValidAuthz,
+		precertificateSCTs:           precertificateSCTs,
 		regByIPStats:                 scope.NewScope("RA", "RateLimit", "RegistrationsByIP"),
 		pendAuthByRegIDStats:         scope.NewScope("RA", "RateLimit", "PendingAuthorizationsByRegID"),
 		certsForDomainStats:          scope.NewScope("RA", "RateLimit", "CertificatesForDomain"),
@@ -360,6 +366,7 @@ func (ra *RegistrationAuthorityImpl) NewAuthorization(ctx context.Context, reque
 			return authz, outErr
 		}
 		if !isSafeResp.GetIsSafe() {
+			ra.log.Info(fmt.Sprintf("%s was listed on %s", identifier.Value, isSafeResp.GetList()))
 			return authz, core.UnauthorizedError(fmt.Sprintf("%#v was considered an unsafe domain by a third-party API", identifier.Value))
 		}
 	}
@@ -439,7 +446,8 @@ func (ra *RegistrationAuthorityImpl) NewAuthorization(ctx context.Context, reque
 //		* notBefore is not more than 24 hours ago
 //		* BasicConstraintsValid is true
 //		* IsCA is false
-//		* ExtKeyUsage only contains ExtKeyUsageServerAuth & ExtKeyUsageClientAuth
+//		* ExtKeyUsage only contains ExtKeyUsageServerAuth & ExtKeyUsageClientAuth,
+//		  or ExtKeyUsageEmailProtection for certificates for email addresses
 //		* Subject only contains CommonName & Names
 func (ra *RegistrationAuthorityImpl) MatchesCSR(cert core.Certificate, csr *oldx509.CertificateRequest) (err error) {
 	parsedCertificate, err := x509.ParseCertificate([]byte(cert.DER))
@@ -447,10 +455,13 @@ func (ra *RegistrationAuthorityImpl) MatchesCSR(cert core.Certificate, csr *oldx
 		return
 	}
 
-	// Check issued certificate matches what was expected from the CSR
+	// Check issued certificate matches what was expected from the CSR. The CN
+	// of a certificate for email addresses is one of those addresses rather
+	// than a DNS name.
+	isEmail := len(csr.EmailAddresses) > 0
 	hostNames := make([]string, len(csr.DNSNames))
 	copy(hostNames, csr.DNSNames)
-	if len(csr.Subject.CommonName) > 0 {
+	if len(csr.Subject.CommonName) > 0 && !isEmail {
 		hostNames = append(hostNames, csr.Subject.CommonName)
 	}
 	hostNames = core.UniqueLowerNames(hostNames)
@@ -468,7 +479,7 @@ func (ra *RegistrationAuthorityImpl) MatchesCSR(cert core.Certificate, csr *oldx
 	parsedNames := parsedCertificate.DNSNames
 	sort.Strings(parsedNames)
 	sort.Strings(hostNames)
-	if !reflect.DeepEqual(parsedNames, hostNames) {
+	if len(parsedNames) != len(hostNames) || (len(hostNames) > 0 && !reflect.DeepEqual(parsedNames, hostNames)) {
 		err = core.InternalServerError("Generated certificate DNSNames don't match CSR DNSNames")
 		return
 	}
@@ -500,7 +511,11 @@ func (ra *RegistrationAuthorityImpl) MatchesCSR(cert core.Certificate, csr *oldx
 		err = core.InternalServerError("Generated certificate can sign other certificates")
 		return
 	}
-	if !reflect.DeepEqual(parsedCertificate.ExtKeyUsage, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}) {
+	expectedEKU := []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+	if isEmail {
+		expectedEKU = []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection}
+	}
+	if !reflect.DeepEqual(parsedCertificate.ExtKeyUsage, expectedEKU) {
 		err = core.InternalServerError("Generated certificate doesn't have correct key usage extensions")
 		return
 	}
@@ -579,12 +594,17 @@ func (ra *RegistrationAuthorityImpl) NewCertificate(ctx context.Context, req cor
 		return emptyCert, err
 	}
 
-	logEvent.CommonName = csr.Subject.CommonName
-	logEvent.Names = csr.DNSNames
+	// Validate that authorization key is authorized for all domains, or all
+	// email addresses. VerifyCSR ensures a CSR doesn't request both.
+	requested := csr.DNSNames
+	if len(csr.EmailAddresses) > 0 {
+		requested = csr.EmailAddresses
+	}
+	names := make([]string, len(requested))
+	copy(names, requested)
 
-	// Validate that authorization key is authorized for all domains
-	names := make([]string, len(csr.DNSNames))
-	copy(names, csr.DNSNames)
+	logEvent.CommonName = csr.Subject.CommonName
+	logEvent.Names = names
 
 	if len(names) == 0 {
 		err = core.UnauthorizedError("CSR has no names in it")
@@ -616,7 +636,7 @@ func (ra *RegistrationAuthorityImpl) NewCertificate(ctx context.Context, req cor
 	logEvent.VerifiedFields = []string{"subject.commonName", "subjectAltName"}
 
 	// Create the certificate and log the result
-	if cert, err = ra.CA.IssueCertificate(ctx, *csr, regID); err != nil {
+	if cert, err = ra.issueCertificate(ctx, csr, regID); err != nil {
 		logEvent.Error = err.Error()
 		return emptyCert, err
 	}
@@ -650,13 +670,41 @@ func (ra *RegistrationAuthorityImpl) NewCertificate(ctx context.Context, req cor
 	return cert, nil
 }
 
+// issueCertificate has the CA issue a certificate for csr. If precertificates
+// are enabled, and the CSR has no email addresses, the CA first issues a
+// precertificate, which the Publisher submits to CT logs, and then the final
+// certificate with the logs' SCTs embedded.
+func (ra *RegistrationAuthorityImpl) issueCertificate(ctx context.Context, csr *oldx509.CertificateRequest, regID int64) (core.Certificate, error) {
+	if ra.precertificateSCTs == 0 || len(csr.EmailAddresses) > 0 {
+		return ra.CA.IssueCertificate(ctx, *csr, regID)
+	}
+
+	precert, err := ra.CA.IssuePrecertificate(ctx, *csr, regID)
+	if err != nil {
+		return core.Certificate{}, err
+	}
+	scts, err := ra.Publisher.SubmitPrecertToCT(ctx, precert.DER)
+	if err != nil {
+		return core.Certificate{}, err
+	}
+	if len(scts) < ra.precertificateSCTs {
+		ra.stats.Inc("RA.PrecertificateSCTsMissing", 1, 1.0)
+		return core.Certificate{}, core.InternalServerError(fmt.Sprintf(
+			"Got %d SCTs for precertificate, but %d are required", len(scts), ra.precertificateSCTs))
+	}
+	return ra.CA.IssueCertificateForPrecertificate(ctx, precert.DER, scts, regID)
+}
+
 // domainsForRateLimiting transforms a list of FQDNs into a list of eTLD+1's
-// for the purpose of rate limiting. It also de-duplicates the output
-// domains.
+// for the purpose of rate limiting. Email addresses are counted against the
+// eTLD+1 of their domain. It also de-duplicates the output domains.
 func domainsForRateLimiting(names []string) ([]string, error) {
 	domainsMap := make(map[string]struct{}, len(names))
 	var domains []string
 	for _, name := range names {
+		if at := strings.LastIndex(name, "@"); at >= 0 {
+			name = name[at+1:]
+		}
 		domain, err := publicsuffix.Domain(name)
 		if err != nil {
 			// The only possible errors are:
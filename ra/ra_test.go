@@ -242,7 +242,7 @@ func initAuthorities(t *testing.T) (*DummyValidationAuthority, *sa.SQLStorageAut
 	ra := NewRegistrationAuthorityImpl(fc,
 		log,
 		stats,
-		1, testKeyPolicy, 0, true, false, 300*24*time.Hour, 7*24*time.Hour)
+		1, testKeyPolicy, 0, true, false, 300*24*time.Hour, 7*24*time.Hour, 0)
 	ra.SA = ssa
 	ra.VA = va
 	ra.CA = ca
@@ -844,6 +844,66 @@ func TestNewCertificate(t *testing.T) {
 	test.AssertNotError(t, err, "Failed to parse certificate")
 }
 
+type precertCA struct {
+	mocks.MockCA
+	precerts int
+	scts     [][]byte
+}
+
+func (ca *precertCA) IssuePrecertificate(ctx context.Context, csr oldx509.CertificateRequest, regID int64) (core.Certificate, error) {
+	ca.precerts++
+	return ca.MockCA.IssuePrecertificate(ctx, csr, regID)
+}
+
+func (ca *precertCA) IssueCertificateForPrecertificate(ctx context.Context, precertDER []byte, scts [][]byte, regID int64) (core.Certificate, error) {
+	ca.scts = scts
+	return ca.MockCA.IssueCertificateForPrecertificate(ctx, precertDER, scts, regID)
+}
+
+type sctPublisher struct {
+	mocks.Publisher
+	scts [][]byte
+}
+
+func (pub *sctPublisher) SubmitPrecertToCT(_ context.Context, _ []byte) ([][]byte, error) {
+	return pub.scts, nil
+}
+
+func TestIssueCertificateWithPrecertificate(t *testing.T) {
+	stats, _ := statsd.NewNoopClient()
+	ra := NewRegistrationAuthorityImpl(clock.NewFake(),
+		log,
+		stats,
+		1, testKeyPolicy, 0, true, false, 300*24*time.Hour, 7*24*time.Hour, 2)
+	ca := &precertCA{MockCA: mocks.MockCA{PEM: eeCertPEM}}
+	pub := &sctPublisher{scts: [][]byte{{1}, {2}}}
+	ra.CA = ca
+	ra.Publisher = pub
+
+	block, _ := pem.Decode(CSRPEM)
+	csr, err := oldx509.ParseCertificateRequest(block.Bytes)
+	test.AssertNotError(t, err, "Failed to parse CSR")
+	_, err = ra.issueCertificate(ctx, csr, 1)
+	test.AssertNotError(t, err, "Failed to issue certificate with precertificate")
+	test.AssertEquals(t, ca.precerts, 1)
+	test.AssertDeepEquals(t, ca.scts, pub.scts)
+
+	// Too few SCTs fail issuance before the final certificate is signed.
+	ca.scts = nil
+	pub.scts = [][]byte{{1}}
+	_, err = ra.issueCertificate(ctx, csr, 1)
+	test.AssertError(t, err, "Issued certificate with too few SCTs")
+	test.Assert(t, ca.scts == nil, "Final certificate issued with too few SCTs")
+
+	// Certificates for email addresses don't go through CT.
+	ca.precerts = 0
+	emailCSR := *csr
+	emailCSR.EmailAddresses = []string{"admin@not-example.com"}
+	_, err = ra.issueCertificate(ctx, &emailCSR, 1)
+	test.AssertNotError(t, err, "Failed to issue email certificate")
+	test.AssertEquals(t, ca.precerts, 0)
+}
+
 func TestTotalCertRateLimit(t *testing.T) {
 	_, sa, ra, fc, cleanUp := initAuthorities(t)
 	defer cleanUp()
@@ -953,6 +1013,12 @@ func TestDomainsForRateLimiting(t *testing.T) {
 	test.AssertEquals(t, domains[0], "github.io")
 	test.AssertEquals(t, domains[1], "foo.github.io")
 	test.AssertEquals(t, domains[2], "bar.github.io")
+
+	domains, err = domainsForRateLimiting([]string{"alice@example.com", "bob@mail.example.com", "www.example.co.uk"})
+	test.AssertNotError(t, err, "failed on email addresses")
+	test.AssertEquals(t, len(domains), 2)
+	test.AssertEquals(t, domains[0], "example.com")
+	test.AssertEquals(t, domains[1], "example.co.uk")
 }
 
 func TestRateLimitLiveReload(t *testing.T) {
@@ -47,25 +47,43 @@ const (
 	MethodPerformValidation                 = "PerformValidation"                 // VA
 	MethodIsSafeDomain                      = "IsSafeDomain"                      // VA
 	MethodIssueCertificate                  = "IssueCertificate"                  // CA
+	MethodIssuePrecertificate               = "IssuePrecertificate"               // CA
+	MethodIssueCertificateForPrecertificate = "IssueCertificateForPrecertificate" // CA
 	MethodGenerateOCSP                      = "GenerateOCSP"                      // CA
+	MethodGenerateCRLs                      = "GenerateCRLs"                      // CA
 	MethodGetRegistration                   = "GetRegistration"                   // SA
 	MethodGetRegistrationByKey              = "GetRegistrationByKey"              // RA, SA
 	MethodGetAuthorization                  = "GetAuthorization"                  // SA
 	MethodGetValidAuthorizations            = "GetValidAuthorizations"            // SA
 	MethodGetCertificate                    = "GetCertificate"                    // SA
+	MethodGetPrecertificate                 = "GetPrecertificate"                 // SA
 	MethodGetCertificateStatus              = "GetCertificateStatus"              // SA
 	MethodMarkCertificateRevoked            = "MarkCertificateRevoked"            // SA
 	MethodNewPendingAuthorization           = "NewPendingAuthorization"           // SA
 	MethodUpdatePendingAuthorization        = "UpdatePendingAuthorization"        // SA
 	MethodFinalizeAuthorization             = "FinalizeAuthorization"             // SA
 	MethodAddCertificate                    = "AddCertificate"                    // SA
+	MethodAddPrecertificate                 = "AddPrecertificate"                 // SA
+	MethodClaimPrecertificate               = "ClaimPrecertificate"               // SA
 	MethodCountCertificatesRange            = "CountCertificatesRange"            // SA
 	MethodCountCertificatesByNames          = "CountCertificatesByNames"          // SA
 	MethodCountRegistrationsByIP            = "CountRegistrationsByIP"            // SA
 	MethodCountPendingAuthorizations        = "CountPendingAuthorizations"        // SA
 	MethodGetSCTReceipt                     = "GetSCTReceipt"                     // SA
 	MethodAddSCTReceipt                     = "AddSCTReceipt"                     // SA
+	MethodGetUncheckedSCTReceipts           = "GetUncheckedSCTReceipts"           // SA
+	MethodAddSCTInclusion                   = "AddSCTInclusion"                   // SA
+	MethodGetLatestSTH                      = "GetLatestSTH"                      // SA
+	MethodAddSTH                            = "AddSTH"                            // SA
+	MethodAddCTSubmission                   = "AddCTSubmission"                   // SA
+	MethodGetDueCTSubmissions               = "GetDueCTSubmissions"               // SA
+	MethodGetRevokedCertificates            = "GetRevokedCertificates"            // SA
+	MethodUpdateCTSubmission                = "UpdateCTSubmission"                // SA
+	MethodRemoveCTSubmission                = "RemoveCTSubmission"                // SA
+	MethodCountCTSubmissions                = "CountCTSubmissions"                // SA
+	MethodRequeueCTSubmissions              = "RequeueCTSubmissions"              // SA
 	MethodSubmitToCT                        = "SubmitToCT"                        // Pub
+	MethodSubmitPrecertToCT                 = "SubmitPrecertToCT"                 // Pub
 	MethodRevokeAuthorizationsByDomain      = "RevokeAuthorizationsByDomain"      // SA
 	MethodCountFQDNSets                     = "CountFQDNSets"                     // SA
 	MethodFQDNSetExists                     = "FQDNSetExists"                     // SA
@@ -116,6 +134,12 @@ type issueCertificateRequest struct {
 	RegID int64
 }
 
+type issueCertificateForPrecertificateRequest struct {
+	Precert []byte
+	SCTs    [][]byte
+	RegID   int64
+}
+
 type addCertificateRequest struct {
 	Bytes []byte
 	RegID int64
@@ -186,6 +210,36 @@ type fqdnSetExistsRequest struct {
 	Names []string
 }
 
+type getUncheckedSCTReceiptsRequest struct {
+	LogID        string
+	IssuedBefore time.Time
+	Limit        int
+}
+
+type getLatestSTHRequest struct {
+	LogID string
+}
+
+type getDueCTSubmissionsRequest struct {
+	Now   time.Time
+	Limit int
+}
+
+type getRevokedCertificatesRequest struct {
+	After string
+	Now   time.Time
+	Limit int
+}
+
+type removeCTSubmissionRequest struct {
+	ID int64
+}
+
+type requeueCTSubmissionsRequest struct {
+	Serial string
+	LogID  string
+}
+
 // Response structs
 type caaResponse struct {
 	Present bool
@@ -202,6 +256,10 @@ type countFQDNSetsResponse struct {
 	Count int64
 }
 
+type requeueCTSubmissionsResponse struct {
+	Requeued int64
+}
+
 type fqdnSetExistsResponse struct {
 	Exists bool
 }
@@ -616,6 +674,21 @@ func NewPublisherServer(rpc Server, impl core.Publisher) (err error) {
 		return
 	})
 
+	rpc.Handle(MethodSubmitPrecertToCT, func(ctx context.Context, req []byte) (response []byte, err error) {
+		scts, err := impl.SubmitPrecertToCT(ctx, req)
+		if err != nil {
+			return
+		}
+
+		response, err = json.Marshal(scts)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodSubmitPrecertToCT, err, req)
+			return
+		}
+		return
+	})
+
 	return nil
 }
 
@@ -636,6 +709,17 @@ func (pub PublisherClient) SubmitToCT(ctx context.Context, der []byte) (err erro
 	return
 }
 
+// SubmitPrecertToCT sends a request to submit a precertificate to CT logs
+func (pub PublisherClient) SubmitPrecertToCT(ctx context.Context, der []byte) (scts [][]byte, err error) {
+	jsonResponse, err := pub.rpc.DispatchSync(MethodSubmitPrecertToCT, der)
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(jsonResponse, &scts)
+	return
+}
+
 // NewCertificateAuthorityServer constructs an RPC server
 //
 // CertificateAuthorityClient / Server
@@ -672,6 +756,61 @@ func NewCertificateAuthorityServer(rpc Server, impl core.CertificateAuthority) (
 		return
 	})
 
+	rpc.Handle(MethodIssuePrecertificate, func(ctx context.Context, req []byte) (response []byte, err error) {
+		var icReq issueCertificateRequest
+		err = json.Unmarshal(req, &icReq)
+		if err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodIssuePrecertificate, err, req)
+			return
+		}
+
+		csr, err := oldx509.ParseCertificateRequest(icReq.Bytes)
+		if err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodIssuePrecertificate, err, req)
+			return
+		}
+
+		precert, err := impl.IssuePrecertificate(ctx, *csr, icReq.RegID)
+		if err != nil {
+			return
+		}
+
+		response, err = json.Marshal(precert)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodIssuePrecertificate, err, req)
+			return
+		}
+
+		return
+	})
+
+	rpc.Handle(MethodIssueCertificateForPrecertificate, func(ctx context.Context, req []byte) (response []byte, err error) {
+		var icReq issueCertificateForPrecertificateRequest
+		err = json.Unmarshal(req, &icReq)
+		if err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodIssueCertificateForPrecertificate, err, req)
+			return
+		}
+
+		cert, err := impl.IssueCertificateForPrecertificate(ctx, icReq.Precert, icReq.SCTs, icReq.RegID)
+		if err != nil {
+			return
+		}
+
+		response, err = json.Marshal(cert)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodIssueCertificateForPrecertificate, err, req)
+			return
+		}
+
+		return
+	})
+
 	rpc.Handle(MethodGenerateOCSP, func(ctx context.Context, req []byte) (response []byte, err error) {
 		var xferObj core.OCSPSigningRequest
 		err = json.Unmarshal(req, &xferObj)
@@ -689,6 +828,22 @@ func NewCertificateAuthorityServer(rpc Server, impl core.CertificateAuthority) (
 		return
 	})
 
+	rpc.Handle(MethodGenerateCRLs, func(ctx context.Context, req []byte) (response []byte, err error) {
+		var xferObjs []core.CRLSigningRequest
+		err = json.Unmarshal(req, &xferObjs)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodGenerateCRLs, err, req)
+			return
+		}
+
+		crls, err := impl.GenerateCRLs(ctx, xferObjs)
+		if err != nil {
+			return
+		}
+		return json.Marshal(crls)
+	})
+
 	return nil
 }
 
@@ -722,6 +877,46 @@ func (cac CertificateAuthorityClient) IssueCertificate(ctx context.Context, csr
 	return
 }
 
+// IssuePrecertificate sends a request to issue a precertificate
+func (cac CertificateAuthorityClient) IssuePrecertificate(ctx context.Context, csr oldx509.CertificateRequest, regID int64) (precert core.Certificate, err error) {
+	var icReq issueCertificateRequest
+	icReq.Bytes = csr.Raw
+	icReq.RegID = regID
+	data, err := json.Marshal(icReq)
+	if err != nil {
+		return
+	}
+
+	jsonResponse, err := cac.rpc.DispatchSync(MethodIssuePrecertificate, data)
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(jsonResponse, &precert)
+	return
+}
+
+// IssueCertificateForPrecertificate sends a request to issue the final
+// certificate for a precertificate, embedding scts
+func (cac CertificateAuthorityClient) IssueCertificateForPrecertificate(ctx context.Context, precertDER []byte, scts [][]byte, regID int64) (cert core.Certificate, err error) {
+	data, err := json.Marshal(issueCertificateForPrecertificateRequest{
+		Precert: precertDER,
+		SCTs:    scts,
+		RegID:   regID,
+	})
+	if err != nil {
+		return
+	}
+
+	jsonResponse, err := cac.rpc.DispatchSync(MethodIssueCertificateForPrecertificate, data)
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(jsonResponse, &cert)
+	return
+}
+
 // GenerateOCSP sends a request to generate an OCSP response
 func (cac CertificateAuthorityClient) GenerateOCSP(ctx context.Context, signRequest core.OCSPSigningRequest) (resp []byte, err error) {
 	data, err := json.Marshal(signRequest)
@@ -742,6 +937,30 @@ func (cac CertificateAuthorityClient) GenerateOCSP(ctx context.Context, signRequ
 	return
 }
 
+// GenerateCRLs sends a request to generate a set of CRLs
+func (cac CertificateAuthorityClient) GenerateCRLs(ctx context.Context, signRequests []core.CRLSigningRequest) (crls [][]byte, err error) {
+	data, err := json.Marshal(signRequests)
+	if err != nil {
+		// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+		errorCondition(MethodGenerateCRLs, err, signRequests)
+		return
+	}
+
+	resp, err := cac.rpc.DispatchSync(MethodGenerateCRLs, data)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(resp, &crls)
+	if err != nil {
+		return
+	}
+	if len(crls) != len(signRequests) {
+		err = fmt.Errorf("Failure at Signer: %d CRLs for %d requests", len(crls), len(signRequests))
+		return
+	}
+	return
+}
+
 // NewStorageAuthorityServer constructs an RPC server
 func NewStorageAuthorityServer(rpc Server, impl core.StorageAuthority) error {
 	rpc.Handle(MethodUpdateRegistration, func(ctx context.Context, req []byte) (response []byte, err error) {
@@ -855,6 +1074,24 @@ func NewStorageAuthorityServer(rpc Server, impl core.StorageAuthority) error {
 		return
 	})
 
+	rpc.Handle(MethodAddPrecertificate, func(ctx context.Context, req []byte) (response []byte, err error) {
+		var acReq addCertificateRequest
+		err = json.Unmarshal(req, &acReq)
+		if err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodAddPrecertificate, err, req)
+			return
+		}
+
+		err = impl.AddPrecertificate(ctx, acReq.Bytes, acReq.RegID)
+		return
+	})
+
+	rpc.Handle(MethodClaimPrecertificate, func(ctx context.Context, req []byte) (response []byte, err error) {
+		err = impl.ClaimPrecertificate(ctx, string(req))
+		return
+	})
+
 	rpc.Handle(MethodNewRegistration, func(ctx context.Context, req []byte) (response []byte, err error) {
 		var registration core.Registration
 		err = json.Unmarshal(req, &registration)
@@ -955,6 +1192,22 @@ func NewStorageAuthorityServer(rpc Server, impl core.StorageAuthority) error {
 		return jsonResponse, nil
 	})
 
+	rpc.Handle(MethodGetPrecertificate, func(ctx context.Context, req []byte) (response []byte, err error) {
+		precert, err := impl.GetPrecertificate(ctx, string(req))
+		if err != nil {
+			return
+		}
+
+		jsonResponse, err := json.Marshal(precert)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodGetPrecertificate, err, req)
+			return
+		}
+
+		return jsonResponse, nil
+	})
+
 	rpc.Handle(MethodGetCertificateStatus, func(ctx context.Context, req []byte) (response []byte, err error) {
 		status, err := impl.GetCertificateStatus(ctx, string(req))
 		if err != nil {
@@ -1075,6 +1328,170 @@ func NewStorageAuthorityServer(rpc Server, impl core.StorageAuthority) error {
 		return nil, impl.AddSCTReceipt(ctx, core.SignedCertificateTimestamp(sct))
 	})
 
+	rpc.Handle(MethodGetUncheckedSCTReceipts, func(ctx context.Context, req []byte) (response []byte, err error) {
+		var r getUncheckedSCTReceiptsRequest
+		err = json.Unmarshal(req, &r)
+		if err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodGetUncheckedSCTReceipts, err, req)
+			return
+		}
+
+		receipts, err := impl.GetUncheckedSCTReceipts(ctx, r.LogID, r.IssuedBefore, r.Limit)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodGetUncheckedSCTReceipts, err, req)
+			return
+		}
+		return json.Marshal(receipts)
+	})
+
+	rpc.Handle(MethodAddSCTInclusion, func(ctx context.Context, req []byte) (response []byte, err error) {
+		var inclusion core.SCTInclusion
+		err = json.Unmarshal(req, &inclusion)
+		if err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodAddSCTInclusion, err, req)
+			return
+		}
+
+		return nil, impl.AddSCTInclusion(ctx, inclusion)
+	})
+
+	rpc.Handle(MethodGetLatestSTH, func(ctx context.Context, req []byte) (response []byte, err error) {
+		var r getLatestSTHRequest
+		err = json.Unmarshal(req, &r)
+		if err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodGetLatestSTH, err, req)
+			return
+		}
+
+		sth, err := impl.GetLatestSTH(ctx, r.LogID)
+		if err != nil {
+			// NotFoundError is expected for logs that haven't been checked yet,
+			// so it isn't an error condition.
+			if _, ok := err.(core.NotFoundError); !ok {
+				// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+				errorCondition(MethodGetLatestSTH, err, req)
+			}
+			return
+		}
+		return json.Marshal(sth)
+	})
+
+	rpc.Handle(MethodAddSTH, func(ctx context.Context, req []byte) (response []byte, err error) {
+		var sth core.SignedTreeHead
+		err = json.Unmarshal(req, &sth)
+		if err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodAddSTH, err, req)
+			return
+		}
+
+		return nil, impl.AddSTH(ctx, sth)
+	})
+
+	rpc.Handle(MethodAddCTSubmission, func(ctx context.Context, req []byte) (response []byte, err error) {
+		var sub core.CTSubmission
+		err = json.Unmarshal(req, &sub)
+		if err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodAddCTSubmission, err, req)
+			return
+		}
+
+		return nil, impl.AddCTSubmission(ctx, sub)
+	})
+
+	rpc.Handle(MethodGetDueCTSubmissions, func(ctx context.Context, req []byte) (response []byte, err error) {
+		var r getDueCTSubmissionsRequest
+		err = json.Unmarshal(req, &r)
+		if err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodGetDueCTSubmissions, err, req)
+			return
+		}
+
+		subs, err := impl.GetDueCTSubmissions(ctx, r.Now, r.Limit)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodGetDueCTSubmissions, err, req)
+			return
+		}
+		return json.Marshal(subs)
+	})
+
+	rpc.Handle(MethodGetRevokedCertificates, func(ctx context.Context, req []byte) (response []byte, err error) {
+		var r getRevokedCertificatesRequest
+		err = json.Unmarshal(req, &r)
+		if err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodGetRevokedCertificates, err, req)
+			return
+		}
+
+		revoked, err := impl.GetRevokedCertificates(ctx, r.After, r.Now, r.Limit)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodGetRevokedCertificates, err, req)
+			return
+		}
+		return json.Marshal(revoked)
+	})
+
+	rpc.Handle(MethodUpdateCTSubmission, func(ctx context.Context, req []byte) (response []byte, err error) {
+		var sub core.CTSubmission
+		err = json.Unmarshal(req, &sub)
+		if err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodUpdateCTSubmission, err, req)
+			return
+		}
+
+		return nil, impl.UpdateCTSubmission(ctx, sub)
+	})
+
+	rpc.Handle(MethodRemoveCTSubmission, func(ctx context.Context, req []byte) (response []byte, err error) {
+		var r removeCTSubmissionRequest
+		err = json.Unmarshal(req, &r)
+		if err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodRemoveCTSubmission, err, req)
+			return
+		}
+
+		return nil, impl.RemoveCTSubmission(ctx, r.ID)
+	})
+
+	rpc.Handle(MethodCountCTSubmissions, func(ctx context.Context, req []byte) (response []byte, err error) {
+		counts, err := impl.CountCTSubmissions(ctx)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodCountCTSubmissions, err, req)
+			return
+		}
+		return json.Marshal(counts)
+	})
+
+	rpc.Handle(MethodRequeueCTSubmissions, func(ctx context.Context, req []byte) (response []byte, err error) {
+		var r requeueCTSubmissionsRequest
+		err = json.Unmarshal(req, &r)
+		if err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodRequeueCTSubmissions, err, req)
+			return
+		}
+
+		requeued, err := impl.RequeueCTSubmissions(ctx, r.Serial, r.LogID)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodRequeueCTSubmissions, err, req)
+			return
+		}
+		return json.Marshal(requeueCTSubmissionsResponse{requeued})
+	})
+
 	rpc.Handle(MethodCountFQDNSets, func(ctx context.Context, req []byte) (response []byte, err error) {
 		var r countFQDNsRequest
 		err = json.Unmarshal(req, &r)
@@ -1217,6 +1634,17 @@ func (cac StorageAuthorityClient) GetCertificate(ctx context.Context, id string)
 	return
 }
 
+// GetPrecertificate sends a request to get a precertificate by its serial
+func (cac StorageAuthorityClient) GetPrecertificate(ctx context.Context, serial string) (precert core.Certificate, err error) {
+	jsonPrecert, err := cac.rpc.DispatchSync(MethodGetPrecertificate, []byte(serial))
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(jsonPrecert, &precert)
+	return
+}
+
 // GetCertificateStatus sends a request to obtain the current status of a
 // certificate by ID
 func (cac StorageAuthorityClient) GetCertificateStatus(ctx context.Context, id string) (status core.CertificateStatus, err error) {
@@ -1356,6 +1784,27 @@ func (cac StorageAuthorityClient) AddCertificate(ctx context.Context, cert []byt
 	return
 }
 
+// AddPrecertificate sends a request to store a precertificate
+func (cac StorageAuthorityClient) AddPrecertificate(ctx context.Context, precert []byte, regID int64) (err error) {
+	data, err := json.Marshal(addCertificateRequest{
+		Bytes: precert,
+		RegID: regID,
+	})
+	if err != nil {
+		return
+	}
+
+	_, err = cac.rpc.DispatchSync(MethodAddPrecertificate, data)
+	return
+}
+
+// ClaimPrecertificate sends a request to mark a precertificate as having its
+// final certificate issued
+func (cac StorageAuthorityClient) ClaimPrecertificate(ctx context.Context, serial string) (err error) {
+	_, err = cac.rpc.DispatchSync(MethodClaimPrecertificate, []byte(serial))
+	return
+}
+
 // CountCertificatesRange sends a request to count the number of certificates
 // issued in  a certain time range
 func (cac StorageAuthorityClient) CountCertificatesRange(ctx context.Context, start, end time.Time) (count int64, err error) {
@@ -1459,6 +1908,162 @@ func (cac StorageAuthorityClient) AddSCTReceipt(ctx context.Context, sct core.Si
 	return
 }
 
+// GetUncheckedSCTReceipts returns SCTs issued by a log whose inclusion in the
+// log hasn't been checked yet.
+func (cac StorageAuthorityClient) GetUncheckedSCTReceipts(ctx context.Context, logID string, issuedBefore time.Time, limit int) (receipts []core.SignedCertificateTimestamp, err error) {
+	data, err := json.Marshal(getUncheckedSCTReceiptsRequest{
+		LogID:        logID,
+		IssuedBefore: issuedBefore,
+		Limit:        limit,
+	})
+	if err != nil {
+		return
+	}
+
+	response, err := cac.rpc.DispatchSync(MethodGetUncheckedSCTReceipts, data)
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(response, &receipts)
+	return
+}
+
+// AddSCTInclusion records the result of checking an SCT's inclusion in its log.
+func (cac StorageAuthorityClient) AddSCTInclusion(ctx context.Context, inclusion core.SCTInclusion) (err error) {
+	data, err := json.Marshal(inclusion)
+	if err != nil {
+		return
+	}
+
+	_, err = cac.rpc.DispatchSync(MethodAddSCTInclusion, data)
+	return
+}
+
+// GetLatestSTH returns the largest verified signed tree head of a log.
+func (cac StorageAuthorityClient) GetLatestSTH(ctx context.Context, logID string) (sth core.SignedTreeHead, err error) {
+	data, err := json.Marshal(getLatestSTHRequest{LogID: logID})
+	if err != nil {
+		return
+	}
+
+	response, err := cac.rpc.DispatchSync(MethodGetLatestSTH, data)
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(response, &sth)
+	return
+}
+
+// AddSTH stores a verified signed tree head of a log.
+func (cac StorageAuthorityClient) AddSTH(ctx context.Context, sth core.SignedTreeHead) (err error) {
+	data, err := json.Marshal(sth)
+	if err != nil {
+		return
+	}
+
+	_, err = cac.rpc.DispatchSync(MethodAddSTH, data)
+	return
+}
+
+// AddCTSubmission queues a failed CT submission to be retried.
+func (cac StorageAuthorityClient) AddCTSubmission(ctx context.Context, sub core.CTSubmission) (err error) {
+	data, err := json.Marshal(sub)
+	if err != nil {
+		return
+	}
+
+	_, err = cac.rpc.DispatchSync(MethodAddCTSubmission, data)
+	return
+}
+
+// GetDueCTSubmissions returns up to limit of the pending CT submissions whose
+// next attempt is due at now.
+func (cac StorageAuthorityClient) GetDueCTSubmissions(ctx context.Context, now time.Time, limit int) (subs []core.CTSubmission, err error) {
+	data, err := json.Marshal(getDueCTSubmissionsRequest{Now: now, Limit: limit})
+	if err != nil {
+		return
+	}
+
+	response, err := cac.rpc.DispatchSync(MethodGetDueCTSubmissions, data)
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(response, &subs)
+	return
+}
+
+// GetRevokedCertificates returns up to limit of the revoked certificates that
+// haven't expired at now and whose serials sort after the given one.
+func (cac StorageAuthorityClient) GetRevokedCertificates(ctx context.Context, after string, now time.Time, limit int) (revoked []core.RevokedCertificate, err error) {
+	data, err := json.Marshal(getRevokedCertificatesRequest{After: after, Now: now, Limit: limit})
+	if err != nil {
+		return
+	}
+
+	response, err := cac.rpc.DispatchSync(MethodGetRevokedCertificates, data)
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(response, &revoked)
+	return
+}
+
+// UpdateCTSubmission records the outcome of retrying a queued CT submission.
+func (cac StorageAuthorityClient) UpdateCTSubmission(ctx context.Context, sub core.CTSubmission) (err error) {
+	data, err := json.Marshal(sub)
+	if err != nil {
+		return
+	}
+
+	_, err = cac.rpc.DispatchSync(MethodUpdateCTSubmission, data)
+	return
+}
+
+// RemoveCTSubmission removes a CT submission from the queue.
+func (cac StorageAuthorityClient) RemoveCTSubmission(ctx context.Context, id int64) (err error) {
+	data, err := json.Marshal(removeCTSubmissionRequest{ID: id})
+	if err != nil {
+		return
+	}
+
+	_, err = cac.rpc.DispatchSync(MethodRemoveCTSubmission, data)
+	return
+}
+
+// CountCTSubmissions returns the number of queued CT submissions in each
+// status.
+func (cac StorageAuthorityClient) CountCTSubmissions(ctx context.Context) (counts map[core.CTSubmissionStatus]int64, err error) {
+	response, err := cac.rpc.DispatchSync(MethodCountCTSubmissions, nil)
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(response, &counts)
+	return
+}
+
+// RequeueCTSubmissions makes dead CT submissions pending again, and returns
+// how many were.
+func (cac StorageAuthorityClient) RequeueCTSubmissions(ctx context.Context, serial, logID string) (int64, error) {
+	data, err := json.Marshal(requeueCTSubmissionsRequest{Serial: serial, LogID: logID})
+	if err != nil {
+		return 0, err
+	}
+
+	response, err := cac.rpc.DispatchSync(MethodRequeueCTSubmissions, data)
+	if err != nil {
+		return 0, err
+	}
+
+	var r requeueCTSubmissionsResponse
+	err = json.Unmarshal(response, &r)
+	return r.Requeued, err
+}
+
 // CountFQDNSets reutrns the number of currently valid sets with hash |setHash|
 func (cac StorageAuthorityClient) CountFQDNSets(ctx context.Context, window time.Duration, names []string) (int64, error) {
 	data, err := json.Marshal(countFQDNsRequest{window, names})
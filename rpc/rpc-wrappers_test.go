@@ -90,3 +90,55 @@ func TestGenerateOCSP(t *testing.T) {
 	_, err := client.GenerateOCSP(ctx, req)
 	test.AssertError(t, err, "Should have failed at signer")
 }
+
+func TestGenerateCRLs(t *testing.T) {
+	mock := &MockRPCClient{}
+
+	client := CertificateAuthorityClient{mock}
+
+	reqs := []core.CRLSigningRequest{{IssuerCommonName: "happy hacker fake CA"}}
+
+	mock.NextResp = []byte(`[]`)
+	_, err := client.GenerateCRLs(ctx, reqs)
+	test.AssertError(t, err, "Should have failed at signer")
+	test.AssertEquals(t, "GenerateCRLs", mock.LastMethod)
+
+	mock.NextResp = []byte(`["AQID"]`)
+	crls, err := client.GenerateCRLs(ctx, reqs)
+	test.AssertNotError(t, err, "Failed to generate CRLs")
+	test.AssertEquals(t, len(crls), 1)
+	test.AssertByteEquals(t, crls[0], []byte{1, 2, 3})
+}
+
+func TestGetLatestSTH(t *testing.T) {
+	mock := &MockRPCClient{}
+
+	client := StorageAuthorityClient{mock}
+
+	mock.NextResp = []byte(`{"LogID":"log","TreeSize":5}`)
+	sth, err := client.GetLatestSTH(ctx, "log")
+	test.AssertNotError(t, err, "Failed to get STH")
+	test.AssertEquals(t, "GetLatestSTH", mock.LastMethod)
+	test.AssertEquals(t, string(mock.LastBody), `{"LogID":"log"}`)
+	test.AssertEquals(t, sth.TreeSize, uint64(5))
+}
+
+func TestCTSubmissionQueue(t *testing.T) {
+	mock := &MockRPCClient{}
+
+	client := StorageAuthorityClient{mock}
+
+	mock.NextResp = []byte(`{"pending":3,"dead":1}`)
+	counts, err := client.CountCTSubmissions(ctx)
+	test.AssertNotError(t, err, "Failed to count CT submissions")
+	test.AssertEquals(t, "CountCTSubmissions", mock.LastMethod)
+	test.AssertEquals(t, counts[core.CTSubmissionPending], int64(3))
+	test.AssertEquals(t, counts[core.CTSubmissionDead], int64(1))
+
+	mock.NextResp = []byte(`{"Requeued":2}`)
+	n, err := client.RequeueCTSubmissions(ctx, "", "log")
+	test.AssertNotError(t, err, "Failed to requeue CT submissions")
+	test.AssertEquals(t, "RequeueCTSubmissions", mock.LastMethod)
+	test.AssertEquals(t, string(mock.LastBody), `{"Serial":"","LogID":"log"}`)
+	test.AssertEquals(t, n, int64(2))
+}
@@ -0,0 +1,32 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Nothing has ever written to the old crls table, whose columns can't hold a
+-- whole CRL.
+DROP TABLE `crls`;
+
+CREATE TABLE `crls` (
+       `id` BIGINT(20) NOT NULL AUTO_INCREMENT,
+       -- Common name of the issuer cert the CRL is for
+       `issuer` VARCHAR(255) NOT NULL,
+       `shard` INT(11) NOT NULL,
+       `number` BIGINT(20) NOT NULL,
+       `thisUpdate` DATETIME NOT NULL,
+       `nextUpdate` DATETIME NOT NULL,
+       `crl` MEDIUMBLOB NOT NULL,
+       PRIMARY KEY (`id`),
+       KEY `issuer_shard_number_idx` (`issuer`, `shard`, `number`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE `crls`;
+
+CREATE TABLE `crls` (
+  `serial` varchar(255) NOT NULL,
+  `createdAt` datetime NOT NULL,
+  `crl` varchar(255) NOT NULL,
+  PRIMARY KEY (`serial`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
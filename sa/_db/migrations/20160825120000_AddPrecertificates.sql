@@ -0,0 +1,20 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+CREATE TABLE `precertificates` (
+       `id` BIGINT(20) NOT NULL AUTO_INCREMENT,
+       `registrationID` BIGINT(20) NOT NULL,
+       `serial` VARCHAR(255) NOT NULL,
+       `der` MEDIUMBLOB NOT NULL,
+       `issued` DATETIME NOT NULL,
+       `expires` DATETIME NOT NULL,
+       PRIMARY KEY (`id`),
+       UNIQUE KEY `serial_idx` (`serial`),
+       KEY `regId_precertificates_idx` (`registrationID`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE `precertificates`;
@@ -0,0 +1,33 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+CREATE TABLE `signedTreeHeads` (
+       `id` BIGINT(20) NOT NULL AUTO_INCREMENT,
+       `logID` VARCHAR(255) NOT NULL,
+       `treeSize` BIGINT(20) UNSIGNED NOT NULL,
+       `timestamp` BIGINT(20) UNSIGNED NOT NULL,
+       `rootHash` VARBINARY(32) NOT NULL,
+       `signature` BLOB NOT NULL,
+       PRIMARY KEY (`id`),
+       KEY `logID_treeSize_idx` (`logID`, `treeSize`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE `sctInclusions` (
+       `id` BIGINT(20) NOT NULL AUTO_INCREMENT,
+       `certificateSerial` VARCHAR(255) NOT NULL,
+       `logID` VARCHAR(255) NOT NULL,
+       `included` TINYINT(1) NOT NULL,
+       `leafIndex` BIGINT(20) UNSIGNED NOT NULL,
+       `treeSize` BIGINT(20) UNSIGNED NOT NULL,
+       `problem` TEXT NOT NULL,
+       `checked` DATETIME NOT NULL,
+       PRIMARY KEY (`id`),
+       UNIQUE KEY `certificateSerial_logID` (`certificateSerial`, `logID`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE `sctInclusions`;
+DROP TABLE `signedTreeHeads`;
@@ -0,0 +1,21 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+CREATE TABLE `ctSubmissions` (
+       `id` BIGINT(20) NOT NULL AUTO_INCREMENT,
+       `certificateSerial` VARCHAR(255) NOT NULL,
+       `logID` VARCHAR(255) NOT NULL,
+       `status` VARCHAR(255) NOT NULL,
+       `attempts` INT(11) NOT NULL,
+       `lastError` TEXT NOT NULL,
+       `nextAttempt` DATETIME NOT NULL,
+       PRIMARY KEY (`id`),
+       UNIQUE KEY `certificateSerial_logID` (`certificateSerial`, `logID`),
+       KEY `status_nextAttempt_idx` (`status`, `nextAttempt`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE `ctSubmissions`;
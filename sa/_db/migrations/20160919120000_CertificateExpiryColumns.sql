@@ -0,0 +1,37 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Every table of per-certificate rows gets a date to purge and partition it
+-- by. certificates, issuedNames and fqdnSets already have one, but
+-- certificateStatus has to be backfilled from certificates. Its notAfter is
+-- NULL-able, since SAs that predate it keep adding certificates while the
+-- backfill runs. 20160921120000 makes it NOT NULL once they're gone.
+--
+-- The tables aren't partitioned, nor their keys changed for it, yet. MySQL
+-- needs the partitioning column in every unique key, primary keys included,
+-- and the SA relies on the unique keys on serial to refuse duplicate
+-- certificates. Those keys can only take notAfter once it's NOT NULL, and the
+-- SA has to check serials are unique itself first.
+ALTER TABLE `certificateStatus` ADD COLUMN `notAfter` DATETIME DEFAULT NULL;
+-- The index comes before the backfill, so that each batch finds the rows
+-- still to fill through it rather than scanning past those already filled.
+CREATE INDEX `notAfter_certificateStatus_idx` ON `certificateStatus` (`notAfter`);
+
+-- +boulder Batched
+UPDATE `certificateStatus` SET `notAfter` = (
+  SELECT `expires` FROM `certificates` WHERE `certificates`.`serial` = `certificateStatus`.`serial`
+) WHERE `notAfter` IS NULL AND `serial` IN (SELECT `serial` FROM `certificates`);
+
+CREATE INDEX `expires_certificates_idx` ON `certificates` (`expires`);
+CREATE INDEX `expires_fqdnSets_idx` ON `fqdnSets` (`expires`);
+-- The purger deletes the names of expired certificates by serial
+CREATE INDEX `serial_issuedNames_idx` ON `issuedNames` (`serial`);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP INDEX `serial_issuedNames_idx` ON `issuedNames`;
+DROP INDEX `expires_fqdnSets_idx` ON `fqdnSets`;
+DROP INDEX `expires_certificates_idx` ON `certificates`;
+DROP INDEX `notAfter_certificateStatus_idx` ON `certificateStatus`;
+ALTER TABLE `certificateStatus` DROP COLUMN `notAfter`;
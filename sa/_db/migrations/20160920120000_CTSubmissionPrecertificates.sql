@@ -0,0 +1,17 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- A precertificate shares its certificate's serial, so both can be queued for
+-- the same log.
+ALTER TABLE `ctSubmissions`
+      ADD COLUMN `precertificate` TINYINT(1) NOT NULL DEFAULT 0 AFTER `logID`,
+      DROP INDEX `certificateSerial_logID`,
+      ADD UNIQUE KEY `certificateSerial_logID_precertificate` (`certificateSerial`, `logID`, `precertificate`);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+ALTER TABLE `ctSubmissions`
+      DROP INDEX `certificateSerial_logID_precertificate`,
+      ADD UNIQUE KEY `certificateSerial_logID` (`certificateSerial`, `logID`),
+      DROP COLUMN `precertificate`;
@@ -0,0 +1,26 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Only apply this once every SA sets certificateStatus.notAfter: SAs that
+-- predate 20160919120000 can't add certificates after it. The statuses they
+-- added since that migration's backfill are backfilled first.
+
+-- +boulder Batched
+UPDATE `certificateStatus` SET `notAfter` = (
+  SELECT `expires` FROM `certificates` WHERE `certificates`.`serial` = `certificateStatus`.`serial`
+) WHERE `notAfter` IS NULL AND `serial` IN (SELECT `serial` FROM `certificates`);
+
+-- Statuses left without a notAfter have no certificate to backfill it from,
+-- and would stop the column becoming NOT NULL part way through. There is
+-- nothing to sign OCSP responses for or purge them by, so they are deleted.
+-- boulder-db logs how many.
+-- +boulder Batched
+DELETE FROM `certificateStatus` WHERE `notAfter` IS NULL AND `serial` NOT IN (SELECT `serial` FROM `certificates`);
+
+ALTER TABLE `certificateStatus` MODIFY COLUMN `notAfter` DATETIME NOT NULL;
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+-- Deleted statuses aren't restored.
+ALTER TABLE `certificateStatus` MODIFY COLUMN `notAfter` DATETIME DEFAULT NULL;
@@ -0,0 +1,67 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Partition the tables of per-certificate rows by date, so that the rows of
+-- long expired certificates can be dropped a partition at a time. MySQL needs
+-- the partitioning column in every unique key, so the keys on serial alone
+-- become keys on serial and date, and the SA checks serials are unique itself.
+-- Partitioned tables can't have foreign keys either, so certificates loses the
+-- one on registrationID, though not its index. issuedNames has no expiry, and
+-- is partitioned by notBefore instead.
+--
+-- Only apply this once every SA checks serials are unique before adding a
+-- certificate, and after 20160921120000.
+--
+-- Each table starts with a partition per year, and one for every later date.
+-- Split that one with REORGANIZE PARTITION before certificates reach it.
+
+ALTER TABLE `certificates` DROP FOREIGN KEY `regId_certificates`;
+ALTER TABLE `certificates` DROP PRIMARY KEY, ADD PRIMARY KEY (`serial`, `expires`);
+ALTER TABLE `certificates` PARTITION BY RANGE COLUMNS(`expires`) (
+  PARTITION `p2015` VALUES LESS THAN ('2016-01-01'),
+  PARTITION `p2016` VALUES LESS THAN ('2017-01-01'),
+  PARTITION `p2017` VALUES LESS THAN ('2018-01-01'),
+  PARTITION `pMax` VALUES LESS THAN (MAXVALUE)
+);
+
+ALTER TABLE `certificateStatus` DROP PRIMARY KEY, ADD PRIMARY KEY (`serial`, `notAfter`);
+ALTER TABLE `certificateStatus` PARTITION BY RANGE COLUMNS(`notAfter`) (
+  PARTITION `p2015` VALUES LESS THAN ('2016-01-01'),
+  PARTITION `p2016` VALUES LESS THAN ('2017-01-01'),
+  PARTITION `p2017` VALUES LESS THAN ('2018-01-01'),
+  PARTITION `pMax` VALUES LESS THAN (MAXVALUE)
+);
+
+ALTER TABLE `issuedNames` DROP PRIMARY KEY, ADD PRIMARY KEY (`id`, `notBefore`);
+ALTER TABLE `issuedNames` PARTITION BY RANGE COLUMNS(`notBefore`) (
+  PARTITION `p2015` VALUES LESS THAN ('2016-01-01'),
+  PARTITION `p2016` VALUES LESS THAN ('2017-01-01'),
+  PARTITION `p2017` VALUES LESS THAN ('2018-01-01'),
+  PARTITION `pMax` VALUES LESS THAN (MAXVALUE)
+);
+
+ALTER TABLE `fqdnSets` DROP INDEX `serial`, ADD INDEX `serial_fqdnSets_idx` (`serial`);
+ALTER TABLE `fqdnSets` DROP PRIMARY KEY, ADD PRIMARY KEY (`id`, `expires`);
+ALTER TABLE `fqdnSets` PARTITION BY RANGE COLUMNS(`expires`) (
+  PARTITION `p2015` VALUES LESS THAN ('2016-01-01'),
+  PARTITION `p2016` VALUES LESS THAN ('2017-01-01'),
+  PARTITION `p2017` VALUES LESS THAN ('2018-01-01'),
+  PARTITION `pMax` VALUES LESS THAN (MAXVALUE)
+);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+ALTER TABLE `fqdnSets` REMOVE PARTITIONING;
+ALTER TABLE `fqdnSets` DROP PRIMARY KEY, ADD PRIMARY KEY (`id`);
+ALTER TABLE `fqdnSets` DROP INDEX `serial_fqdnSets_idx`, ADD UNIQUE INDEX `serial` (`serial`);
+
+ALTER TABLE `issuedNames` REMOVE PARTITIONING;
+ALTER TABLE `issuedNames` DROP PRIMARY KEY, ADD PRIMARY KEY (`id`);
+
+ALTER TABLE `certificateStatus` REMOVE PARTITIONING;
+ALTER TABLE `certificateStatus` DROP PRIMARY KEY, ADD PRIMARY KEY (`serial`);
+
+ALTER TABLE `certificates` REMOVE PARTITIONING;
+ALTER TABLE `certificates` DROP PRIMARY KEY, ADD PRIMARY KEY (`serial`);
+ALTER TABLE `certificates` ADD CONSTRAINT `regId_certificates` FOREIGN KEY (`registrationID`) REFERENCES `registrations` (`id`) ON DELETE NO ACTION ON UPDATE NO ACTION;
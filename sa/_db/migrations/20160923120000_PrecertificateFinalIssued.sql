@@ -0,0 +1,11 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- finalIssued is set when a CA claims a precertificate to sign its final
+-- certificate, so that only one is ever signed for it.
+ALTER TABLE `precertificates` ADD COLUMN `finalIssued` TINYINT(1) NOT NULL DEFAULT 0;
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+ALTER TABLE `precertificates` DROP COLUMN `finalIssued`;
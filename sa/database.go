@@ -177,8 +177,12 @@ func initTables(dbMap *gorp.DbMap) {
 	dbMap.AddTableWithName(challModel{}, "challenges").SetKeys(true, "ID").SetVersionCol("LockCol")
 	dbMap.AddTableWithName(issuedNameModel{}, "issuedNames").SetKeys(true, "ID")
 	dbMap.AddTableWithName(core.Certificate{}, "certificates").SetKeys(false, "Serial")
+	dbMap.AddTableWithName(precertificateModel{}, "precertificates").SetKeys(true, "ID")
 	dbMap.AddTableWithName(core.CertificateStatus{}, "certificateStatus").SetKeys(false, "Serial").SetVersionCol("LockCol")
-	dbMap.AddTableWithName(core.CRL{}, "crls").SetKeys(false, "Serial")
+	dbMap.AddTableWithName(core.CRL{}, "crls").SetKeys(true, "ID")
 	dbMap.AddTableWithName(core.SignedCertificateTimestamp{}, "sctReceipts").SetKeys(true, "ID").SetVersionCol("LockCol")
+	dbMap.AddTableWithName(core.SCTInclusion{}, "sctInclusions").SetKeys(true, "ID")
+	dbMap.AddTableWithName(core.SignedTreeHead{}, "signedTreeHeads").SetKeys(true, "ID")
+	dbMap.AddTableWithName(core.CTSubmission{}, "ctSubmissions").SetKeys(true, "ID")
 	dbMap.AddTableWithName(core.FQDNSet{}, "fqdnSets").SetKeys(true, "ID")
 }
@@ -0,0 +1,599 @@
+package sa
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmhodges/clock"
+	gorp "gopkg.in/gorp.v1"
+
+	blog "github.com/letsencrypt/boulder/log"
+)
+
+// SchemaVersions are the versions of the migrations in sa/_db/migrations that
+// this SA needs applied to its database, oldest first. Every new migration
+// must be added here, or to deferredSchemaVersions.
+var SchemaVersions = []int64{
+	20150818171317,
+	20150826211856,
+	20150827160921,
+	20150827201311,
+	20150828005159,
+	20150828155940,
+	20150828161056,
+	20150828163255,
+	20150904105711,
+	20150904120119,
+	20150904121736,
+	20150904132303,
+	20150904143114,
+	20150904144656,
+	20150916173200,
+	20150922165824,
+	20150925184726,
+	20150929135041,
+	20151002162726,
+	20151003141825,
+	20151008234926,
+	20151009155300,
+	20151015112508,
+	20151025174914,
+	20151221212759,
+	20160202135920,
+	20160601135920,
+	20160602142227,
+	20160818120000,
+	20160825120000,
+	20160901120000,
+	20160905120000,
+	20160912120000,
+	20160919120000,
+	20160920120000,
+	20160923120000,
+}
+
+// deferredSchemaVersions are the versions of the migrations that can't be
+// applied until this SA has replaced every older one, such as those making a
+// column it's the first to write NOT NULL. This SA runs with or without them,
+// and they move to SchemaVersions in a later release.
+var deferredSchemaVersions = []int64{
+	20160921120000,
+	20160922120000,
+}
+
+const (
+	// migrationTable records the migrations applied to a database, along with
+	// the checksums of their files at the time.
+	migrationTable = "schemaMigrations"
+	// gooseTable is where goose recorded the migrations it applied, before
+	// boulder-db took over.
+	gooseTable = "goose_db_version"
+
+	// Migrations are goose SQL files, which boulder-db runs itself so goose
+	// can still apply them to development databases.
+	directiveUp             = "-- +goose Up"
+	directiveDown           = "-- +goose Down"
+	directiveStatementBegin = "-- +goose StatementBegin"
+	directiveStatementEnd   = "-- +goose StatementEnd"
+	// directiveBatched marks the following statement as a batched backfill.
+	// goose ignores it, and runs the statement once.
+	directiveBatched = "-- +boulder Batched"
+
+	// defaultBatchSize is how many rows each run of a batched statement
+	// affects, unless the Migrator is told otherwise.
+	defaultBatchSize = 1000
+)
+
+// MigrationStatement is a single SQL statement of a migration.
+type MigrationStatement struct {
+	SQL string
+	// Batched statements are run with a LIMIT over and over until they affect
+	// no rows. They are for backfills that would otherwise lock a large table
+	// for as long as they run. Each is an UPDATE or DELETE of the rows still to
+	// be backfilled, without a LIMIT of its own, so that goose, which runs it
+	// once, backfills every row in one go.
+	Batched bool
+}
+
+// checkBatched returns an error if stmt can't be run in batches.
+func checkBatched(stmt string) error {
+	words := strings.Fields(strings.ToUpper(strings.TrimSuffix(stmt, ";")))
+	if len(words) == 0 || (words[0] != "UPDATE" && words[0] != "DELETE") {
+		return errors.New("batched statement isn't an UPDATE or DELETE")
+	}
+	for _, word := range words {
+		if word == "LIMIT" {
+			return errors.New("batched statement has a LIMIT, which boulder-db adds itself")
+		}
+	}
+	return nil
+}
+
+// Migration is a schema change, parsed from a goose SQL file named
+// <version>_<name>.sql.
+type Migration struct {
+	Version  int64
+	Name     string
+	Checksum string
+	Up       []MigrationStatement
+	Down     []MigrationStatement
+}
+
+// ParseMigration parses the contents of the migration file with the given
+// name.
+func ParseMigration(filename string, contents []byte) (*Migration, error) {
+	base := filepath.Base(filename)
+	if !strings.HasSuffix(base, ".sql") {
+		return nil, fmt.Errorf("migration %q is not a .sql file", filename)
+	}
+	parts := strings.SplitN(strings.TrimSuffix(base, ".sql"), "_", 2)
+	version, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || len(parts) != 2 || version <= 0 {
+		return nil, fmt.Errorf("migration %q is not named <version>_<name>.sql", filename)
+	}
+	m := &Migration{
+		Version:  version,
+		Name:     parts[1],
+		Checksum: fmt.Sprintf("%x", sha256.Sum256(contents)),
+	}
+
+	var section *[]MigrationStatement
+	var buf bytes.Buffer
+	var batched, inStatement bool
+	scanner := bufio.NewScanner(bytes.NewReader(contents))
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		trimmed := strings.TrimSpace(text)
+		switch {
+		case trimmed == directiveUp:
+			section = &m.Up
+			continue
+		case trimmed == directiveDown:
+			section = &m.Down
+			continue
+		case trimmed == directiveStatementBegin:
+			inStatement = true
+			continue
+		case trimmed == directiveBatched:
+			batched = true
+			continue
+		case trimmed == directiveStatementEnd:
+			inStatement = false
+		case trimmed == "" && buf.Len() == 0:
+			continue
+		case strings.HasPrefix(trimmed, "--") && !inStatement:
+			continue
+		default:
+			if section == nil {
+				return nil, fmt.Errorf("%s:%d: SQL outside of an Up or Down section", filename, line)
+			}
+			buf.WriteString(text)
+			buf.WriteString("\n")
+			if inStatement || !strings.HasSuffix(trimmed, ";") {
+				continue
+			}
+		}
+		stmt := MigrationStatement{SQL: strings.TrimSpace(buf.String()), Batched: batched}
+		if batched {
+			if err := checkBatched(stmt.SQL); err != nil {
+				return nil, fmt.Errorf("%s:%d: %s", filename, line, err)
+			}
+		}
+		*section = append(*section, stmt)
+		buf.Reset()
+		batched = false
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if buf.Len() != 0 || inStatement {
+		return nil, fmt.Errorf("%s: unterminated statement at end of file", filename)
+	}
+	if len(m.Up) == 0 {
+		return nil, fmt.Errorf("%s: migration has no Up statements", filename)
+	}
+	return m, nil
+}
+
+type byVersion []*Migration
+
+func (v byVersion) Len() int           { return len(v) }
+func (v byVersion) Less(i, j int) bool { return v[i].Version < v[j].Version }
+func (v byVersion) Swap(i, j int)      { v[i], v[j] = v[j], v[i] }
+
+// LoadMigrations parses every migration file in dir, and returns them oldest
+// first.
+func LoadMigrations(dir string) ([]*Migration, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.sql"))
+	if err != nil {
+		return nil, err
+	}
+	var migrations []*Migration
+	for _, f := range files {
+		contents, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		m, err := ParseMigration(f, contents)
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, m)
+	}
+	sort.Sort(byVersion(migrations))
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].Version == migrations[i-1].Version {
+			return nil, fmt.Errorf("migrations %s and %s share version %d",
+				migrations[i-1].Name, migrations[i].Name, migrations[i].Version)
+		}
+	}
+	return migrations, nil
+}
+
+// appliedMigration is a row of the migration history table.
+type appliedMigration struct {
+	Version   int64
+	Name      string
+	Checksum  string
+	AppliedAt time.Time
+}
+
+// MigrationStatus describes whether a migration has been applied to the
+// database.
+type MigrationStatus struct {
+	Version int64
+	Name    string
+	// AppliedAt is nil if the migration hasn't been applied.
+	AppliedAt *time.Time
+	// Modified is true if the migration's file has changed since it was
+	// applied.
+	Modified bool
+	// Missing is true if the migration has been applied, but there's no
+	// longer a file for it.
+	Missing bool
+}
+
+// Migrator applies and rolls back migrations, keeping a checksummed history of
+// the migrations applied to its database. MySQL can't roll back schema
+// changes, so Migrator doesn't try to run migrations in transactions: a
+// migration that fails part way through has to be repaired by hand, and isn't
+// recorded as applied.
+type Migrator struct {
+	dbMap      *gorp.DbMap
+	migrations []*Migration
+	clk        clock.Clock
+	log        blog.Logger
+
+	// BatchSize is the LIMIT given to each run of a batched statement.
+	BatchSize int
+	// BatchPause is how long to wait between runs of a batched statement, to
+	// leave room for other queries and for replicas to catch up.
+	BatchPause time.Duration
+
+	table      string
+	gooseTable string
+}
+
+// NewMigrator creates a Migrator that applies migrations, which must be
+// sorted oldest first, to the database behind dbMap.
+func NewMigrator(dbMap *gorp.DbMap, migrations []*Migration, clk clock.Clock, log blog.Logger) *Migrator {
+	return &Migrator{
+		dbMap:      dbMap,
+		migrations: migrations,
+		clk:        clk,
+		log:        log,
+		BatchSize:  defaultBatchSize,
+		table:      migrationTable,
+		gooseTable: gooseTable,
+	}
+}
+
+// history creates the migration history table if need be, and returns the
+// migrations it records, by version. A database that was migrated by goose is
+// assumed to have been migrated with today's migration files, and its history
+// is copied from goose's the first time.
+func (m *Migrator) history() (map[int64]appliedMigration, error) {
+	_, err := m.dbMap.Exec(fmt.Sprintf("CREATE TABLE IF NOT EXISTS `%s` ("+
+		"`version` BIGINT NOT NULL, "+
+		"`name` VARCHAR(255) NOT NULL, "+
+		"`checksum` CHAR(64) NOT NULL, "+
+		"`appliedAt` DATETIME NOT NULL, "+
+		"PRIMARY KEY (`version`)"+
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8", m.table))
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []appliedMigration
+	_, err = m.dbMap.Select(&rows, fmt.Sprintf("SELECT version, name, checksum, appliedAt FROM `%s`", m.table))
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		rows, err = m.gooseHistory()
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range rows {
+			if err = m.record(a); err != nil {
+				return nil, err
+			}
+			m.log.Info(fmt.Sprintf("Imported migration %d (%s) from goose's history", a.Version, a.Name))
+		}
+	}
+
+	history := make(map[int64]appliedMigration, len(rows))
+	for _, a := range rows {
+		history[a.Version] = a
+	}
+	return history, nil
+}
+
+// gooseHistory returns the migrations applied by goose, if there's a goose
+// history table. For each version, goose's most recent row says whether it's
+// applied.
+func (m *Migrator) gooseHistory() ([]appliedMigration, error) {
+	if m.gooseTable == "" {
+		return nil, nil
+	}
+	var gooseRows []struct {
+		VersionID int64
+		IsApplied bool
+		Tstamp    *time.Time
+	}
+	_, err := m.dbMap.Select(&gooseRows, fmt.Sprintf(
+		"SELECT version_id AS VersionID, is_applied AS IsApplied, tstamp AS Tstamp FROM `%s` ORDER BY id DESC", m.gooseTable))
+	if isNoSuchTable(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[int64]bool)
+	var applied []appliedMigration
+	for _, g := range gooseRows {
+		// Version 0 is the row goose starts its history with
+		if g.VersionID == 0 || seen[g.VersionID] {
+			continue
+		}
+		seen[g.VersionID] = true
+		if !g.IsApplied {
+			continue
+		}
+		migration := m.find(g.VersionID)
+		if migration == nil {
+			return nil, fmt.Errorf("goose applied migration %d, which has no migration file", g.VersionID)
+		}
+		a := appliedMigration{
+			Version:   migration.Version,
+			Name:      migration.Name,
+			Checksum:  migration.Checksum,
+			AppliedAt: m.clk.Now(),
+		}
+		if g.Tstamp != nil {
+			a.AppliedAt = *g.Tstamp
+		}
+		applied = append(applied, a)
+	}
+	return applied, nil
+}
+
+func (m *Migrator) find(version int64) *Migration {
+	for _, migration := range m.migrations {
+		if migration.Version == version {
+			return migration
+		}
+	}
+	return nil
+}
+
+func (m *Migrator) record(a appliedMigration) error {
+	_, err := m.dbMap.Exec(fmt.Sprintf(
+		"INSERT INTO `%s` (version, name, checksum, appliedAt) VALUES (?, ?, ?, ?)", m.table),
+		a.Version, a.Name, a.Checksum, a.AppliedAt)
+	return err
+}
+
+// Status reports on every migration, either applied or not, oldest first.
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	history, err := m.history()
+	if err != nil {
+		return nil, err
+	}
+	var statuses []MigrationStatus
+	for _, migration := range m.migrations {
+		s := MigrationStatus{Version: migration.Version, Name: migration.Name}
+		if a, ok := history[migration.Version]; ok {
+			appliedAt := a.AppliedAt
+			s.AppliedAt = &appliedAt
+			s.Modified = a.Checksum != migration.Checksum
+			delete(history, migration.Version)
+		}
+		statuses = append(statuses, s)
+	}
+	for _, a := range history {
+		appliedAt := a.AppliedAt
+		statuses = append(statuses, MigrationStatus{
+			Version:   a.Version,
+			Name:      a.Name,
+			AppliedAt: &appliedAt,
+			Missing:   true,
+		})
+	}
+	sort.Sort(statusesByVersion(statuses))
+	return statuses, nil
+}
+
+type statusesByVersion []MigrationStatus
+
+func (v statusesByVersion) Len() int           { return len(v) }
+func (v statusesByVersion) Less(i, j int) bool { return v[i].Version < v[j].Version }
+func (v statusesByVersion) Swap(i, j int)      { v[i], v[j] = v[j], v[i] }
+
+// checkHistory refuses to migrate a database whose applied migrations don't
+// match the migration files, since its schema can't be known.
+func checkHistory(statuses []MigrationStatus) error {
+	for _, s := range statuses {
+		if s.Modified {
+			return fmt.Errorf("migration %d (%s) has changed since it was applied", s.Version, s.Name)
+		}
+		if s.Missing {
+			return fmt.Errorf("migration %d (%s) was applied, but its file is missing", s.Version, s.Name)
+		}
+	}
+	return nil
+}
+
+// Up applies every pending migration up to and including version target,
+// oldest first, or every pending migration if target is zero. It returns the
+// number of migrations applied.
+func (m *Migrator) Up(target int64) (int, error) {
+	statuses, err := m.Status()
+	if err != nil {
+		return 0, err
+	}
+	if err = checkHistory(statuses); err != nil {
+		return 0, err
+	}
+	applied := 0
+	for _, s := range statuses {
+		if s.AppliedAt != nil || (target != 0 && s.Version > target) {
+			continue
+		}
+		migration := m.find(s.Version)
+		if err = m.run(migration, migration.Up); err != nil {
+			return applied, fmt.Errorf("applying migration %d (%s): %s", migration.Version, migration.Name, err)
+		}
+		err = m.record(appliedMigration{
+			Version:   migration.Version,
+			Name:      migration.Name,
+			Checksum:  migration.Checksum,
+			AppliedAt: m.clk.Now(),
+		})
+		if err != nil {
+			return applied, err
+		}
+		m.log.Info(fmt.Sprintf("Applied migration %d (%s)", migration.Version, migration.Name))
+		applied++
+	}
+	return applied, nil
+}
+
+// Down rolls back every applied migration newer than version target, newest
+// first. It returns the number of migrations rolled back.
+func (m *Migrator) Down(target int64) (int, error) {
+	statuses, err := m.Status()
+	if err != nil {
+		return 0, err
+	}
+	if err = checkHistory(statuses); err != nil {
+		return 0, err
+	}
+	rolledBack := 0
+	for i := len(statuses) - 1; i >= 0; i-- {
+		s := statuses[i]
+		if s.AppliedAt == nil || s.Version <= target {
+			continue
+		}
+		migration := m.find(s.Version)
+		if len(migration.Down) == 0 {
+			return rolledBack, fmt.Errorf("migration %d (%s) can't be rolled back", migration.Version, migration.Name)
+		}
+		if err = m.run(migration, migration.Down); err != nil {
+			return rolledBack, fmt.Errorf("rolling back migration %d (%s): %s", migration.Version, migration.Name, err)
+		}
+		_, err = m.dbMap.Exec(fmt.Sprintf("DELETE FROM `%s` WHERE version = ?", m.table), migration.Version)
+		if err != nil {
+			return rolledBack, err
+		}
+		m.log.Info(fmt.Sprintf("Rolled back migration %d (%s)", migration.Version, migration.Name))
+		rolledBack++
+	}
+	return rolledBack, nil
+}
+
+func (m *Migrator) run(migration *Migration, statements []MigrationStatement) error {
+	for _, stmt := range statements {
+		if !stmt.Batched {
+			if _, err := m.dbMap.Exec(stmt.SQL); err != nil {
+				return err
+			}
+			continue
+		}
+		batchSQL := fmt.Sprintf("%s LIMIT %d", strings.TrimSuffix(stmt.SQL, ";"), m.BatchSize)
+		var total int64
+		for {
+			result, err := m.dbMap.Exec(batchSQL)
+			if err != nil {
+				return err
+			}
+			n, err := result.RowsAffected()
+			if err != nil {
+				return err
+			}
+			if n == 0 {
+				break
+			}
+			total += n
+			m.log.Info(fmt.Sprintf("Migration %d (%s): batched statement has affected %d rows", migration.Version, migration.Name, total))
+			m.clk.Sleep(m.BatchPause)
+		}
+	}
+	return nil
+}
+
+// CheckSchemaVersions returns an error unless every migration version in
+// expected has been applied to the database. Services call it at startup, so
+// they don't run against a database that hasn't been migrated for them yet.
+// Every version is checked, rather than just the newest, since migrations can
+// be applied out of order, like an older one merged after a newer one was
+// applied.
+func CheckSchemaVersions(dbMap *gorp.DbMap, expected []int64) error {
+	return checkSchemaVersions(dbMap, migrationTable, expected)
+}
+
+func checkSchemaVersions(dbMap *gorp.DbMap, table string, expected []int64) error {
+	var rows []struct {
+		Version int64
+	}
+	_, err := dbMap.Select(&rows, fmt.Sprintf("SELECT version AS Version FROM `%s`", table))
+	if isNoSuchTable(err) {
+		return errors.New("database has no migration history; run boulder-db up")
+	} else if err != nil {
+		return err
+	}
+	applied := make(map[int64]bool, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = true
+	}
+	var missing []string
+	for _, version := range expected {
+		if !applied[version] {
+			missing = append(missing, strconv.FormatInt(version, 10))
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("database is missing migrations %s; run boulder-db up", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+func isNoSuchTable(err error) bool {
+	if err == nil || err == sql.ErrNoRows {
+		return false
+	}
+	mysqlErr, ok := err.(*mysql.MySQLError)
+	// ER_NO_SUCH_TABLE
+	return ok && mysqlErr.Number == 1146
+}
@@ -0,0 +1,224 @@
+package sa
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jmhodges/clock"
+
+	"github.com/letsencrypt/boulder/test"
+	"github.com/letsencrypt/boulder/test/vars"
+)
+
+func TestParseMigration(t *testing.T) {
+	m, err := ParseMigration("_db/migrations/20160101120000_Example.sql", []byte(`
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+CREATE TABLE example (
+  id BIGINT NOT NULL,
+  done TINYINT(1) NOT NULL
+);
+
+-- +boulder Batched
+UPDATE example SET done = 1 WHERE done = 0;
+
+-- +goose StatementBegin
+CREATE TRIGGER t BEFORE INSERT ON example FOR EACH ROW BEGIN
+  SET NEW.done = 0;
+END;
+-- +goose StatementEnd
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+DROP TABLE example;
+`))
+	test.AssertNotError(t, err, "Failed to parse migration")
+	test.AssertEquals(t, m.Version, int64(20160101120000))
+	test.AssertEquals(t, m.Name, "Example")
+	test.AssertEquals(t, len(m.Checksum), 64)
+	test.AssertEquals(t, len(m.Up), 3)
+	test.AssertEquals(t, m.Up[0].SQL, "CREATE TABLE example (\n  id BIGINT NOT NULL,\n  done TINYINT(1) NOT NULL\n);")
+	test.Assert(t, !m.Up[0].Batched, "Plain statement was batched")
+	test.AssertEquals(t, m.Up[1].SQL, "UPDATE example SET done = 1 WHERE done = 0;")
+	test.Assert(t, m.Up[1].Batched, "Batched statement wasn't batched")
+	test.AssertEquals(t, m.Up[2].SQL, "CREATE TRIGGER t BEFORE INSERT ON example FOR EACH ROW BEGIN\n  SET NEW.done = 0;\nEND;")
+	test.AssertEquals(t, len(m.Down), 1)
+	test.AssertEquals(t, m.Down[0].SQL, "DROP TABLE example;")
+
+	_, err = ParseMigration("Example.sql", []byte("-- +goose Up\nSELECT 1;\n"))
+	test.AssertError(t, err, "Parsed a migration without a version")
+	_, err = ParseMigration("1_Example.sql", []byte("SELECT 1;\n"))
+	test.AssertError(t, err, "Parsed SQL outside of a section")
+	_, err = ParseMigration("1_Example.sql", []byte("-- +goose Up\nSELECT 1\n"))
+	test.AssertError(t, err, "Parsed an unterminated statement")
+	_, err = ParseMigration("1_Example.sql", []byte("-- +goose Up\n-- +boulder Batched\nUPDATE example SET done = 1 LIMIT 10;\n"))
+	test.AssertError(t, err, "Parsed a batched statement with its own LIMIT")
+	_, err = ParseMigration("1_Example.sql", []byte("-- +goose Up\n-- +boulder Batched\nALTER TABLE example DROP COLUMN done;\n"))
+	test.AssertError(t, err, "Parsed a batched statement that isn't an UPDATE or DELETE")
+}
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := LoadMigrations("_db/migrations")
+	test.AssertNotError(t, err, "Failed to load migrations")
+	test.Assert(t, len(migrations) > 0, "No migrations loaded")
+	for i := 1; i < len(migrations); i++ {
+		test.Assert(t, migrations[i-1].Version < migrations[i].Version, "Migrations out of order")
+	}
+	// Deferred migrations can be older than required ones added after them,
+	// so only the set of versions is compared.
+	versions := make(map[int64]bool)
+	for _, v := range append(append([]int64{}, SchemaVersions...), deferredSchemaVersions...) {
+		versions[v] = true
+	}
+	test.AssertEquals(t, len(migrations), len(versions))
+	for _, m := range migrations {
+		test.Assert(t, versions[m.Version], fmt.Sprintf("Migration %d isn't in SchemaVersions or deferredSchemaVersions", m.Version))
+	}
+}
+
+func TestMigrator(t *testing.T) {
+	dbMap, err := NewDbMap(vars.DBConnSAFullPerms, 0)
+	test.AssertNotError(t, err, "Failed to create dbMap")
+	cleanUp := func() {
+		_, _ = dbMap.Exec("DROP TABLE IF EXISTS migrateTest")
+		_, _ = dbMap.Exec("DROP TABLE IF EXISTS testSchemaMigrations")
+	}
+	cleanUp()
+	defer cleanUp()
+
+	var migrations []*Migration
+	for i, contents := range []string{`
+-- +goose Up
+CREATE TABLE migrateTest (id BIGINT NOT NULL, done TINYINT(1) NOT NULL);
+INSERT INTO migrateTest VALUES (1, 0), (2, 0), (3, 0), (4, 0), (5, 0);
+-- +goose Down
+DROP TABLE migrateTest;
+`, `
+-- +goose Up
+-- +boulder Batched
+UPDATE migrateTest SET done = 1 WHERE done = 0;
+-- +goose Down
+UPDATE migrateTest SET done = 0;
+`} {
+		m, err := ParseMigration(fmt.Sprintf("%d_Test.sql", i+1), []byte(contents))
+		test.AssertNotError(t, err, "Failed to parse migration")
+		migrations = append(migrations, m)
+	}
+
+	fc := clock.NewFake()
+	migrator := NewMigrator(dbMap, migrations, fc, log)
+	migrator.BatchSize = 2
+	migrator.BatchPause = time.Second
+	migrator.table = "testSchemaMigrations"
+	migrator.gooseTable = ""
+
+	err = checkSchemaVersions(dbMap, migrator.table, []int64{1, 2})
+	test.AssertError(t, err, "Schema check passed without a migration history")
+
+	applied, err := migrator.Up(1)
+	test.AssertNotError(t, err, "Failed to migrate up")
+	test.AssertEquals(t, applied, 1)
+	err = checkSchemaVersions(dbMap, migrator.table, []int64{1, 2})
+	test.AssertError(t, err, "Schema check passed on an old database")
+
+	log.Clear()
+	start := fc.Now()
+	applied, err = migrator.Up(0)
+	test.AssertNotError(t, err, "Failed to migrate up")
+	test.AssertEquals(t, applied, 1)
+	done, err := dbMap.SelectInt("SELECT COUNT(*) FROM migrateTest WHERE done = 1")
+	test.AssertNotError(t, err, "Failed to count backfilled rows")
+	test.AssertEquals(t, done, int64(5))
+	test.AssertEquals(t, len(log.GetAllMatching("batched statement has affected")), 3)
+	test.AssertEquals(t, fc.Now(), start.Add(3*time.Second))
+	err = checkSchemaVersions(dbMap, migrator.table, []int64{1, 2})
+	test.AssertNotError(t, err, "Schema check failed on a migrated database")
+
+	// Every version has to be applied, not just the newest
+	_, err = dbMap.Exec("DELETE FROM testSchemaMigrations WHERE version = 1")
+	test.AssertNotError(t, err, "Failed to remove migration from history")
+	err = checkSchemaVersions(dbMap, migrator.table, []int64{1, 2})
+	test.AssertError(t, err, "Schema check passed with an older migration missing")
+	_, err = dbMap.Exec("INSERT INTO testSchemaMigrations (version, name, checksum, appliedAt) VALUES (1, 'Test', ?, ?)",
+		migrations[0].Checksum, fc.Now())
+	test.AssertNotError(t, err, "Failed to restore migration history")
+
+	statuses, err := migrator.Status()
+	test.AssertNotError(t, err, "Failed to get status")
+	test.AssertEquals(t, len(statuses), 2)
+	for _, s := range statuses {
+		test.Assert(t, s.AppliedAt != nil, "Migration wasn't applied")
+	}
+
+	// A migration that has changed since it was applied blocks migrating
+	checksum := migrations[1].Checksum
+	migrations[1].Checksum = "changed"
+	statuses, err = migrator.Status()
+	test.AssertNotError(t, err, "Failed to get status")
+	test.Assert(t, statuses[1].Modified, "Changed migration wasn't reported")
+	_, err = migrator.Down(0)
+	test.AssertError(t, err, "Rolled back a changed migration")
+	migrations[1].Checksum = checksum
+
+	rolledBack, err := migrator.Down(0)
+	test.AssertNotError(t, err, "Failed to migrate down")
+	test.AssertEquals(t, rolledBack, 2)
+	statuses, err = migrator.Status()
+	test.AssertNotError(t, err, "Failed to get status")
+	for _, s := range statuses {
+		test.Assert(t, s.AppliedAt == nil, "Migration wasn't rolled back")
+	}
+}
+
+func TestMigrateOrphanCertificateStatus(t *testing.T) {
+	dbMap, err := NewDbMap(vars.DBConnSAFullPerms, 0)
+	test.AssertNotError(t, err, "Failed to create dbMap")
+	cleanUp := func() {
+		_, _ = dbMap.Exec("DROP TABLE IF EXISTS migrateTestStatus")
+		_, _ = dbMap.Exec("DROP TABLE IF EXISTS migrateTestCertificates")
+		_, _ = dbMap.Exec("DROP TABLE IF EXISTS testSchemaMigrations")
+	}
+	cleanUp()
+	defer cleanUp()
+
+	// The real migration is run against copies of the tables it changes, as
+	// they were before it.
+	filename := "20160921120000_CertificateStatusNotAfterNotNull.sql"
+	contents, err := ioutil.ReadFile(filepath.Join("_db", "migrations", filename))
+	test.AssertNotError(t, err, "Failed to read migration")
+	contents = bytes.Replace(contents, []byte("`certificateStatus`"), []byte("`migrateTestStatus`"), -1)
+	contents = bytes.Replace(contents, []byte("`certificates`"), []byte("`migrateTestCertificates`"), -1)
+	migration, err := ParseMigration(filename, contents)
+	test.AssertNotError(t, err, "Failed to parse migration")
+
+	for _, stmt := range []string{
+		"CREATE TABLE migrateTestCertificates (serial VARCHAR(255) NOT NULL PRIMARY KEY, expires DATETIME NOT NULL)",
+		"CREATE TABLE migrateTestStatus (serial VARCHAR(255) NOT NULL PRIMARY KEY, notAfter DATETIME DEFAULT NULL)",
+		"INSERT INTO migrateTestCertificates VALUES ('00', '2016-10-01 00:00:00'), ('01', '2016-11-01 00:00:00')",
+		// 02's certificate is missing, so there's nothing to backfill it from
+		"INSERT INTO migrateTestStatus VALUES ('00', '2016-10-01 00:00:00'), ('01', NULL), ('02', NULL)",
+	} {
+		_, err = dbMap.Exec(stmt)
+		test.AssertNotError(t, err, fmt.Sprintf("Failed to set up tables: %s", stmt))
+	}
+
+	migrator := NewMigrator(dbMap, []*Migration{migration}, clock.NewFake(), log)
+	migrator.table = "testSchemaMigrations"
+	migrator.gooseTable = ""
+	applied, err := migrator.Up(0)
+	test.AssertNotError(t, err, "Failed to migrate with a status that has no certificate")
+	test.AssertEquals(t, applied, 1)
+
+	count, err := dbMap.SelectInt("SELECT COUNT(*) FROM migrateTestStatus")
+	test.AssertNotError(t, err, "Failed to count statuses")
+	test.AssertEquals(t, count, int64(2))
+	count, err = dbMap.SelectInt("SELECT COUNT(*) FROM migrateTestStatus WHERE serial = '01' AND notAfter = '2016-11-01 00:00:00'")
+	test.AssertNotError(t, err, "Failed to count backfilled statuses")
+	test.AssertEquals(t, count, int64(1))
+}
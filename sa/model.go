@@ -21,6 +21,20 @@ type issuedNameModel struct {
 	Serial       string    `db:"serial"`
 }
 
+// precertificateModel is the description of a precertificate in the database.
+// Precertificates are kept only to check final certificates against, so
+// unlike certificates they have no status. FinalIssued is set once a CA has
+// claimed the precertificate to sign its final certificate.
+type precertificateModel struct {
+	ID             int64     `db:"id"`
+	RegistrationID int64     `db:"registrationID"`
+	Serial         string    `db:"serial"`
+	DER            []byte    `db:"der"`
+	Issued         time.Time `db:"issued"`
+	Expires        time.Time `db:"expires"`
+	FinalIssued    bool      `db:"finalIssued"`
+}
+
 // regModel is the description of a core.Registration in the database.
 type regModel struct {
 	ID        int64           `db:"id"`
@@ -0,0 +1,148 @@
+package sa
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	gorp "gopkg.in/gorp.v1"
+
+	"github.com/letsencrypt/boulder/metrics"
+)
+
+var errReplicationStopped = errors.New("replica isn't replicating")
+
+// replica is a read replica of the SA's database. Reads that can stand to be a
+// little stale, like the counts behind rate limits, are sent to it to take load
+// off the primary.
+//
+// Authorizations and registrations are read back straight after they're
+// written, often by a different SA than the one that wrote them, so they are
+// always read from the primary.
+type replica struct {
+	dbMap    *gorp.DbMap
+	maxLag   time.Duration
+	fallback bool
+	stats    metrics.Scope
+
+	mu sync.RWMutex
+	// lagging is true while the replica is further behind the primary than
+	// maxLag, or its lag couldn't be checked.
+	lagging bool
+}
+
+// SetReplica makes the SA send reads that tolerate staleness to the replica
+// behind dbMap. If maxLag is non-zero, those reads go to the primary until
+// ReplicaLagLoop has found the replica to be at most maxLag behind. If fallback
+// is true, reads that fail on the replica are retried on the primary.
+func (ssa *SQLStorageAuthority) SetReplica(dbMap *gorp.DbMap, maxLag time.Duration, fallback bool, stats metrics.Scope) {
+	SetSQLDebug(dbMap, ssa.log)
+	ssa.replica = &replica{
+		dbMap:    dbMap,
+		maxLag:   maxLag,
+		fallback: fallback,
+		stats:    stats,
+		lagging:  maxLag > 0,
+	}
+}
+
+// ReplicaLagLoop checks the replica's lag every period, forever.
+func (ssa *SQLStorageAuthority) ReplicaLagLoop(period time.Duration) {
+	for {
+		ssa.checkReplicaLag()
+		time.Sleep(period)
+	}
+}
+
+func (ssa *SQLStorageAuthority) checkReplicaLag() {
+	r := ssa.replica
+	lag, err := replicationLag(r.dbMap)
+	if err != nil {
+		ssa.log.Warning(fmt.Sprintf("Couldn't check replica lag, reading from the primary: %s", err))
+	} else {
+		r.stats.Gauge("ReplicaLag", int64(lag/time.Second))
+	}
+	lagging := err != nil || lag > r.maxLag
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if lagging && !r.lagging {
+		ssa.log.Warning(fmt.Sprintf("Replica is %s behind, reading from the primary", lag))
+	} else if !lagging && r.lagging {
+		ssa.log.Info(fmt.Sprintf("Replica is %s behind, reading from the replica", lag))
+	}
+	r.lagging = lagging
+}
+
+// replicationLag returns how far the database behind dbMap is behind its
+// primary. A database that isn't a replica isn't behind at all.
+func replicationLag(dbMap *gorp.DbMap) (time.Duration, error) {
+	rows, err := dbMap.Db.Query("SHOW SLAVE STATUS")
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = rows.Close() }()
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+	if !rows.Next() {
+		return 0, rows.Err()
+	}
+	values := make([]sql.RawBytes, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err = rows.Scan(dest...); err != nil {
+		return 0, err
+	}
+	for i, column := range columns {
+		if column != "Seconds_Behind_Master" {
+			continue
+		}
+		// Seconds_Behind_Master is NULL when replication isn't running
+		if values[i] == nil {
+			return 0, errReplicationStopped
+		}
+		seconds, err := strconv.ParseInt(string(values[i]), 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(seconds) * time.Second, nil
+	}
+	return 0, errors.New("SHOW SLAVE STATUS has no Seconds_Behind_Master")
+}
+
+// readFromReplica runs read against the replica, if there is one and it's
+// caught up, and otherwise against the primary. A read that finds nothing on
+// the replica is retried on the primary, since what it's looking for may not
+// have been replicated yet. If fallback is enabled, so is a read that fails.
+func (ssa *SQLStorageAuthority) readFromReplica(method string, read func(gorp.SqlExecutor) error) error {
+	r := ssa.replica
+	if r == nil {
+		return read(ssa.dbMap)
+	}
+	r.mu.RLock()
+	lagging := r.lagging
+	r.mu.RUnlock()
+	if lagging {
+		r.stats.Inc(method+".Primary", 1)
+		return read(ssa.dbMap)
+	}
+
+	err := read(r.dbMap)
+	if err == sql.ErrNoRows {
+		r.stats.Inc(method+".NotFoundOnReplica", 1)
+		return read(ssa.dbMap)
+	} else if err != nil && r.fallback {
+		r.stats.Inc(method+".Fallback", 1)
+		ssa.log.Warning(fmt.Sprintf("%s failed on the replica, retrying on the primary: %s", method, err))
+		return read(ssa.dbMap)
+	}
+	r.stats.Inc(method+".Replica", 1)
+	return err
+}
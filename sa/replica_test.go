@@ -0,0 +1,94 @@
+package sa
+
+import (
+	"database/sql"
+	"errors"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/jmhodges/clock"
+	gorp "gopkg.in/gorp.v1"
+
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/metrics"
+	"github.com/letsencrypt/boulder/sa/satest"
+	"github.com/letsencrypt/boulder/test"
+	"github.com/letsencrypt/boulder/test/vars"
+)
+
+func TestReadFromReplica(t *testing.T) {
+	primary, replicaMap := &gorp.DbMap{}, &gorp.DbMap{}
+	ssa := &SQLStorageAuthority{dbMap: primary, clk: clock.NewFake(), log: log}
+
+	// read records which databases it's run against, and fails on the replica
+	// with replicaErr
+	var used []*gorp.DbMap
+	var replicaErr error
+	read := func(db gorp.SqlExecutor) error {
+		used = append(used, db.(*gorp.DbMap))
+		if db == replicaMap {
+			return replicaErr
+		}
+		return nil
+	}
+	assertUsed := func(expected ...*gorp.DbMap) {
+		test.AssertDeepEquals(t, used, expected)
+		used = nil
+	}
+
+	// Without a replica, reads go to the primary
+	err := ssa.readFromReplica("Test", read)
+	test.AssertNotError(t, err, "Read failed")
+	assertUsed(primary)
+
+	// Until its lag has been checked, so do they with a replica
+	ssa.SetReplica(replicaMap, time.Second, false, metrics.NewNoopScope())
+	err = ssa.readFromReplica("Test", read)
+	test.AssertNotError(t, err, "Read failed")
+	assertUsed(primary)
+
+	ssa.replica.lagging = false
+	err = ssa.readFromReplica("Test", read)
+	test.AssertNotError(t, err, "Read failed")
+	assertUsed(replicaMap)
+
+	// Reads that find nothing on the replica are retried on the primary
+	replicaErr = sql.ErrNoRows
+	err = ssa.readFromReplica("Test", read)
+	test.AssertNotError(t, err, "Read failed")
+	assertUsed(replicaMap, primary)
+
+	// Reads that fail on the replica are only retried with fallback enabled
+	replicaErr = errors.New("replica is down")
+	err = ssa.readFromReplica("Test", read)
+	test.AssertEquals(t, err, replicaErr)
+	assertUsed(replicaMap)
+
+	ssa.replica.fallback = true
+	err = ssa.readFromReplica("Test", read)
+	test.AssertNotError(t, err, "Read failed")
+	assertUsed(replicaMap, primary)
+}
+
+func TestReplicaGetCertificate(t *testing.T) {
+	sa, _, cleanUp := initSA(t)
+	defer cleanUp()
+
+	replicaMap, err := NewDbMap(vars.DBConnSA, 0)
+	test.AssertNotError(t, err, "Failed to create replica dbMap")
+	sa.SetReplica(replicaMap, 0, false, metrics.NewNoopScope())
+
+	reg := satest.CreateWorkingRegistration(t, sa)
+	certDER, err := ioutil.ReadFile("www.eff.org.der")
+	test.AssertNotError(t, err, "Couldn't read example cert DER")
+	_, err = sa.AddCertificate(ctx, certDER, reg.ID)
+	test.AssertNotError(t, err, "Couldn't add www.eff.org.der")
+
+	cert, err := sa.GetCertificate(ctx, "000000000000000000000000000000021bd4")
+	test.AssertNotError(t, err, "Couldn't get www.eff.org.der")
+	test.AssertByteEquals(t, cert.DER, certDER)
+
+	_, err = sa.GetCertificate(ctx, "000000000000000000000000000000000000")
+	test.AssertEquals(t, err, core.NotFoundError("No certificate found for 000000000000000000000000000000000000"))
+}
@@ -24,9 +24,10 @@ import (
 
 // SQLStorageAuthority defines a Storage Authority
 type SQLStorageAuthority struct {
-	dbMap *gorp.DbMap
-	clk   clock.Clock
-	log   blog.Logger
+	dbMap   *gorp.DbMap
+	replica *replica
+	clk     clock.Clock
+	log     blog.Logger
 }
 
 func digest256(data []byte) []byte {
@@ -211,7 +212,11 @@ func (ssa *SQLStorageAuthority) GetValidAuthorizations(ctx context.Context, regi
 	params := make([]interface{}, len(names))
 	qmarks := make([]string, len(names))
 	for i, name := range names {
+		// Names containing "@" are email addresses rather than DNS names.
 		id := core.AcmeIdentifier{Type: core.IdentifierDNS, Value: name}
+		if strings.Contains(name, "@") {
+			id.Type = core.IdentifierEmail
+		}
 		idJSON, err := json.Marshal(id)
 		if err != nil {
 			return nil, err
@@ -239,7 +244,7 @@ func (ssa *SQLStorageAuthority) GetValidAuthorizations(ctx context.Context, regi
 		if auth.Expires == nil {
 			continue
 		}
-		if auth.Identifier.Type != core.IdentifierDNS {
+		if auth.Identifier.Type != core.IdentifierDNS && auth.Identifier.Type != core.IdentifierEmail {
 			return nil, fmt.Errorf("unknown identifier type: %q on authz id %q", auth.Identifier.Type, auth.ID)
 		}
 		existing, present := byName[auth.Identifier.Value]
@@ -304,21 +309,23 @@ func ipRange(ip net.IP) (net.IP, net.IP) {
 func (ssa *SQLStorageAuthority) CountRegistrationsByIP(ctx context.Context, ip net.IP, earliest time.Time, latest time.Time) (int, error) {
 	var count int64
 	beginIP, endIP := ipRange(ip)
-	err := ssa.dbMap.SelectOne(
-		&count,
-		`SELECT COUNT(1) FROM registrations
-		 WHERE 
-		 :beginIP <= initialIP AND
-		 initialIP < :endIP AND
-		 :earliest < createdAt AND
-		 createdAt <= :latest`,
-		map[string]interface{}{
-			"ip":       ip.String(),
-			"earliest": earliest,
-			"latest":   latest,
-			"beginIP":  []byte(beginIP),
-			"endIP":    []byte(endIP),
-		})
+	err := ssa.readFromReplica("CountRegistrationsByIP", func(db gorp.SqlExecutor) error {
+		return db.SelectOne(
+			&count,
+			`SELECT COUNT(1) FROM registrations
+			 WHERE 
+			 :beginIP <= initialIP AND
+			 initialIP < :endIP AND
+			 :earliest < createdAt AND
+			 createdAt <= :latest`,
+			map[string]interface{}{
+				"ip":       ip.String(),
+				"earliest": earliest,
+				"latest":   latest,
+				"beginIP":  []byte(beginIP),
+				"endIP":    []byte(endIP),
+			})
+	})
 	if err != nil {
 		return -1, err
 	}
@@ -342,14 +349,17 @@ func (t TooManyCertificatesError) Error() string {
 // TooManyCertificatesError.
 func (ssa *SQLStorageAuthority) CountCertificatesByNames(ctx context.Context, domains []string, earliest, latest time.Time) (map[string]int, error) {
 	ret := make(map[string]int, len(domains))
-	for _, domain := range domains {
-		currentCount, err := ssa.countCertificatesByName(domain, earliest, latest)
-		if err != nil {
-			return ret, err
+	err := ssa.readFromReplica("CountCertificatesByNames", func(db gorp.SqlExecutor) error {
+		for _, domain := range domains {
+			currentCount, err := countCertificatesByName(db, domain, earliest, latest)
+			if err != nil {
+				return err
+			}
+			ret[domain] = currentCount
 		}
-		ret[domain] = currentCount
-	}
-	return ret, nil
+		return nil
+	})
+	return ret, err
 }
 
 // countCertificatesByNames returns, for a single domain, the count of
@@ -358,13 +368,13 @@ func (ssa *SQLStorageAuthority) CountCertificatesByNames(ctx context.Context, do
 // The highest count this function can return is 10,000. If there are more
 // certificates than that matching one of the provided domain names, it will return
 // TooManyCertificatesError.
-func (ssa *SQLStorageAuthority) countCertificatesByName(domain string, earliest, latest time.Time) (int, error) {
+func countCertificatesByName(db gorp.SqlExecutor, domain string, earliest, latest time.Time) (int, error) {
 	var count int64
 	const max = 10000
 	var serials []struct {
 		Serial string
 	}
-	_, err := ssa.dbMap.Select(
+	_, err := db.Select(
 		&serials,
 		`SELECT serial from issuedNames
 		 WHERE (reversedName = :reversedDomain OR
@@ -400,13 +410,20 @@ func (ssa *SQLStorageAuthority) GetCertificate(ctx context.Context, serial strin
 		return core.Certificate{}, err
 	}
 
-	certObj, err := ssa.dbMap.Get(core.Certificate{}, serial)
-	if err != nil {
-		return core.Certificate{}, err
-	}
-	if certObj == nil {
+	var certObj interface{}
+	err := ssa.readFromReplica("GetCertificate", func(db gorp.SqlExecutor) error {
+		var err error
+		certObj, err = db.Get(core.Certificate{}, serial)
+		if err == nil && certObj == nil {
+			return sql.ErrNoRows
+		}
+		return err
+	})
+	if err == sql.ErrNoRows {
 		ssa.log.Debug(fmt.Sprintf("Nil cert for %s", serial))
 		return core.Certificate{}, core.NotFoundError(fmt.Sprintf("No certificate found for %s", serial))
+	} else if err != nil {
+		return core.Certificate{}, err
 	}
 
 	certPtr, ok := certObj.(*core.Certificate)
@@ -741,6 +758,8 @@ func (ssa *SQLStorageAuthority) AddCertificate(ctx context.Context, certDER []by
 		Serial:             serial,
 		RevokedDate:        time.Time{},
 		RevokedReason:      0,
+		NoOCSP:             core.IsShortLived(parsedCertificate),
+		NotAfter:           &parsedCertificate.NotAfter,
 		LockCol:            0,
 	}
 
@@ -749,7 +768,12 @@ func (ssa *SQLStorageAuthority) AddCertificate(ctx context.Context, certDER []by
 		return
 	}
 
-	// TODO Verify that the serial number doesn't yet exist
+	err = checkSerialUnused(tx, serial)
+	if err != nil {
+		err = Rollback(tx, err)
+		return
+	}
+
 	err = tx.Insert(cert)
 	if err != nil {
 		err = Rollback(tx, err)
@@ -784,33 +808,128 @@ func (ssa *SQLStorageAuthority) AddCertificate(ctx context.Context, certDER []by
 	return
 }
 
+// checkSerialUnused returns an error if a certificate with serial is already
+// stored. The certificate tables are partitioned by date, and MySQL can't keep
+// serials unique across partitions, so the SA has to. The read locks the
+// serial's place in the primary key until tx ends, so that a concurrent
+// AddCertificate of the same serial can't commit too.
+func checkSerialUnused(tx *gorp.Transaction, serial string) error {
+	var count int64
+	err := tx.SelectOne(
+		&count,
+		"SELECT COUNT(1) FROM certificates WHERE serial = :serial FOR UPDATE",
+		map[string]interface{}{"serial": serial},
+	)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return fmt.Errorf("Certificate with serial %s already exists", serial)
+	}
+	return nil
+}
+
+// AddPrecertificate stores a precertificate, so the final certificate issued
+// for it can later be checked against it.
+func (ssa *SQLStorageAuthority) AddPrecertificate(ctx context.Context, der []byte, regID int64) error {
+	parsed, err := x509.ParseCertificate(der)
+	if err != nil {
+		return err
+	}
+	return ssa.dbMap.Insert(&precertificateModel{
+		RegistrationID: regID,
+		Serial:         core.SerialToString(parsed.SerialNumber),
+		DER:            der,
+		Issued:         ssa.clk.Now(),
+		Expires:        parsed.NotAfter,
+	})
+}
+
+// GetPrecertificate returns the precertificate with the given serial. It is
+// always read from the primary, since it's needed just after it's stored.
+func (ssa *SQLStorageAuthority) GetPrecertificate(ctx context.Context, serial string) (core.Certificate, error) {
+	if !core.ValidSerial(serial) {
+		return core.Certificate{}, fmt.Errorf("Invalid precertificate serial %s", serial)
+	}
+	var model precertificateModel
+	err := ssa.dbMap.SelectOne(
+		&model,
+		`SELECT * FROM precertificates WHERE serial = ?`,
+		serial,
+	)
+	if err == sql.ErrNoRows {
+		return core.Certificate{}, core.NotFoundError(fmt.Sprintf("No precertificate found for %s", serial))
+	}
+	if err != nil {
+		return core.Certificate{}, err
+	}
+	return core.Certificate{
+		RegistrationID: model.RegistrationID,
+		Serial:         model.Serial,
+		DER:            model.DER,
+		Issued:         model.Issued,
+		Expires:        model.Expires,
+	}, nil
+}
+
+// ClaimPrecertificate marks the precertificate with the given serial as having
+// its final certificate issued. The update is conditional on the mark not
+// already being set, so that of any number of concurrent claims for a
+// precertificate only one succeeds, and only one final certificate is signed
+// for it. A precertificate that doesn't exist or was already claimed is a
+// NotFoundError.
+func (ssa *SQLStorageAuthority) ClaimPrecertificate(ctx context.Context, serial string) error {
+	if !core.ValidSerial(serial) {
+		return fmt.Errorf("Invalid precertificate serial %s", serial)
+	}
+	result, err := ssa.dbMap.Exec(
+		`UPDATE precertificates SET finalIssued = 1 WHERE serial = ? AND finalIssued = 0`,
+		serial,
+	)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n != 1 {
+		return core.NotFoundError(fmt.Sprintf("No unclaimed precertificate found for %s", serial))
+	}
+	return nil
+}
+
 // CountCertificatesRange returns the number of certificates issued in a specific
 // date range
 func (ssa *SQLStorageAuthority) CountCertificatesRange(ctx context.Context, start, end time.Time) (count int64, err error) {
-	err = ssa.dbMap.SelectOne(
-		&count,
-		`SELECT COUNT(1) FROM certificates
-		WHERE issued >= :windowLeft
-		AND issued < :windowRight`,
-		map[string]interface{}{
-			"windowLeft":  start,
-			"windowRight": end,
-		},
-	)
+	err = ssa.readFromReplica("CountCertificatesRange", func(db gorp.SqlExecutor) error {
+		return db.SelectOne(
+			&count,
+			`SELECT COUNT(1) FROM certificates
+			WHERE issued >= :windowLeft
+			AND issued < :windowRight`,
+			map[string]interface{}{
+				"windowLeft":  start,
+				"windowRight": end,
+			},
+		)
+	})
 	return count, err
 }
 
 // CountPendingAuthorizations returns the number of pending, unexpired
 // authorizations for the give registration.
 func (ssa *SQLStorageAuthority) CountPendingAuthorizations(ctx context.Context, regID int64) (count int, err error) {
-	err = ssa.dbMap.SelectOne(&count,
-		`SELECT count(1) FROM pendingAuthorizations
-		 WHERE registrationID = :regID AND
-				expires > :now`,
-		map[string]interface{}{
-			"regID": regID,
-			"now":   ssa.clk.Now(),
-		})
+	err = ssa.readFromReplica("CountPendingAuthorizations", func(db gorp.SqlExecutor) error {
+		return db.SelectOne(&count,
+			`SELECT count(1) FROM pendingAuthorizations
+			 WHERE registrationID = :regID AND
+					expires > :now`,
+			map[string]interface{}{
+				"regID": regID,
+				"now":   ssa.clk.Now(),
+			})
+	})
 	return
 }
 
@@ -854,6 +973,185 @@ func (ssa *SQLStorageAuthority) AddSCTReceipt(ctx context.Context, sct core.Sign
 	return err
 }
 
+// GetUncheckedSCTReceipts returns up to limit of the SCT receipts issued by
+// the log with logID before issuedBefore, oldest first, for which no
+// inclusion check has been recorded.
+func (ssa *SQLStorageAuthority) GetUncheckedSCTReceipts(ctx context.Context, logID string, issuedBefore time.Time, limit int) ([]core.SignedCertificateTimestamp, error) {
+	var receipts []core.SignedCertificateTimestamp
+	_, err := ssa.dbMap.Select(
+		&receipts,
+		`SELECT s.* FROM sctReceipts AS s
+		 LEFT JOIN sctInclusions AS i
+		 ON i.certificateSerial = s.certificateSerial AND i.logID = s.logID
+		 WHERE s.logID = :logID
+		 AND s.timestamp < :before
+		 AND i.id IS NULL
+		 ORDER BY s.timestamp ASC
+		 LIMIT :limit`,
+		map[string]interface{}{
+			"logID": logID,
+			// SCT timestamps are in milliseconds since the epoch
+			"before": issuedBefore.UnixNano() / int64(time.Millisecond),
+			"limit":  limit,
+		},
+	)
+	return receipts, err
+}
+
+// AddSCTInclusion records the result of checking that a log included a
+// certificate it issued an SCT for. Each SCT's inclusion is only checked once.
+func (ssa *SQLStorageAuthority) AddSCTInclusion(ctx context.Context, inclusion core.SCTInclusion) error {
+	return ssa.dbMap.Insert(&inclusion)
+}
+
+// GetLatestSTH returns the largest signed tree head stored for the log with
+// logID.
+func (ssa *SQLStorageAuthority) GetLatestSTH(ctx context.Context, logID string) (core.SignedTreeHead, error) {
+	var sth core.SignedTreeHead
+	err := ssa.dbMap.SelectOne(
+		&sth,
+		`SELECT * FROM signedTreeHeads
+		 WHERE logID = :logID
+		 ORDER BY treeSize DESC, timestamp DESC
+		 LIMIT 1`,
+		map[string]interface{}{"logID": logID},
+	)
+	if err == sql.ErrNoRows {
+		return sth, core.NotFoundError(fmt.Sprintf("No signed tree head found for log %s", logID))
+	}
+	return sth, err
+}
+
+// AddSTH stores a signed tree head that has been verified to be consistent
+// with the log's previous one.
+func (ssa *SQLStorageAuthority) AddSTH(ctx context.Context, sth core.SignedTreeHead) error {
+	return ssa.dbMap.Insert(&sth)
+}
+
+// AddCTSubmission queues a failed CT submission to be retried. If the
+// certificate's submission to the log is already queued, the existing entry
+// is kept as it is.
+func (ssa *SQLStorageAuthority) AddCTSubmission(ctx context.Context, sub core.CTSubmission) error {
+	sub.ID = 0
+	err := ssa.dbMap.Insert(&sub)
+	if err != nil && strings.HasPrefix(err.Error(), "Error 1062: Duplicate entry") {
+		return nil
+	}
+	return err
+}
+
+// GetDueCTSubmissions returns up to limit of the pending CT submissions whose
+// next attempt is due at now, most overdue first.
+func (ssa *SQLStorageAuthority) GetDueCTSubmissions(ctx context.Context, now time.Time, limit int) ([]core.CTSubmission, error) {
+	var subs []core.CTSubmission
+	_, err := ssa.dbMap.Select(
+		&subs,
+		`SELECT * FROM ctSubmissions
+		 WHERE status = :status
+		 AND nextAttempt <= :now
+		 ORDER BY nextAttempt ASC
+		 LIMIT :limit`,
+		map[string]interface{}{
+			"status": string(core.CTSubmissionPending),
+			"now":    now,
+			"limit":  limit,
+		},
+	)
+	return subs, err
+}
+
+// GetRevokedCertificates returns up to limit of the revoked certificates that
+// haven't expired at now and whose serials sort after the given one, in serial
+// order. It reads from the replica, if there is one, since a CRL missing a
+// very recent revocation will be corrected by the next one.
+func (ssa *SQLStorageAuthority) GetRevokedCertificates(ctx context.Context, after string, now time.Time, limit int) ([]core.RevokedCertificate, error) {
+	var revoked []core.RevokedCertificate
+	err := ssa.readFromReplica("GetRevokedCertificates", func(db gorp.SqlExecutor) error {
+		revoked = nil
+		_, err := db.Select(
+			&revoked,
+			`SELECT cs.serial, cs.revokedDate, cs.revokedReason, cert.expires, cert.der
+			 FROM certificateStatus AS cs
+			 JOIN certificates AS cert
+			 ON cs.serial = cert.serial
+			 WHERE cs.status = :status
+			 AND cert.expires > :now
+			 AND cs.serial > :after
+			 ORDER BY cs.serial ASC
+			 LIMIT :limit`,
+			map[string]interface{}{
+				"status": string(core.OCSPStatusRevoked),
+				"now":    now,
+				"after":  after,
+				"limit":  limit,
+			},
+		)
+		return err
+	})
+	return revoked, err
+}
+
+// UpdateCTSubmission records the outcome of retrying a queued CT submission
+// that failed again.
+func (ssa *SQLStorageAuthority) UpdateCTSubmission(ctx context.Context, sub core.CTSubmission) error {
+	n, err := ssa.dbMap.Update(&sub)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return core.NotFoundError(fmt.Sprintf("No CT submission found with ID %d", sub.ID))
+	}
+	return nil
+}
+
+// RemoveCTSubmission removes a CT submission from the queue, once the log has
+// issued an SCT for it.
+func (ssa *SQLStorageAuthority) RemoveCTSubmission(ctx context.Context, id int64) error {
+	_, err := ssa.dbMap.Exec("DELETE FROM ctSubmissions WHERE id = ?", id)
+	return err
+}
+
+// CountCTSubmissions returns the number of queued CT submissions in each
+// status.
+func (ssa *SQLStorageAuthority) CountCTSubmissions(ctx context.Context) (map[core.CTSubmissionStatus]int64, error) {
+	var rows []struct {
+		Status string
+		Count  int64
+	}
+	_, err := ssa.dbMap.Select(
+		&rows,
+		`SELECT status AS Status, COUNT(*) AS Count FROM ctSubmissions GROUP BY status`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[core.CTSubmissionStatus]int64)
+	for _, r := range rows {
+		counts[core.CTSubmissionStatus(r.Status)] = r.Count
+	}
+	return counts, nil
+}
+
+// RequeueCTSubmissions makes the dead CT submissions of the certificate with
+// serial to the log with logID pending again, due now, with no failed
+// attempts. An empty serial or logID matches any, and the number of
+// submissions requeued is returned.
+func (ssa *SQLStorageAuthority) RequeueCTSubmissions(ctx context.Context, serial, logID string) (int64, error) {
+	result, err := ssa.dbMap.Exec(
+		`UPDATE ctSubmissions
+		 SET status = ?, attempts = 0, nextAttempt = ?
+		 WHERE status = ?
+		 AND (? = '' OR certificateSerial = ?)
+		 AND (? = '' OR logID = ?)`,
+		string(core.CTSubmissionPending), ssa.clk.Now(), string(core.CTSubmissionDead),
+		serial, serial, logID, logID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 func hashNames(names []string) []byte {
 	names = core.UniqueLowerNames(names)
 	hash := sha256.Sum256([]byte(strings.Join(names, ",")))
@@ -892,14 +1190,16 @@ func addIssuedNames(tx execable, cert *x509.Certificate) error {
 // |window|
 func (ssa *SQLStorageAuthority) CountFQDNSets(ctx context.Context, window time.Duration, names []string) (int64, error) {
 	var count int64
-	err := ssa.dbMap.SelectOne(
-		&count,
-		`SELECT COUNT(1) FROM fqdnSets
-		WHERE setHash = ?
-		AND issued > ?`,
-		hashNames(names),
-		ssa.clk.Now().Add(-window),
-	)
+	err := ssa.readFromReplica("CountFQDNSets", func(db gorp.SqlExecutor) error {
+		return db.SelectOne(
+			&count,
+			`SELECT COUNT(1) FROM fqdnSets
+			WHERE setHash = ?
+			AND issued > ?`,
+			hashNames(names),
+			ssa.clk.Now().Add(-window),
+		)
+	})
 	return count, err
 }
 
@@ -907,12 +1207,14 @@ func (ssa *SQLStorageAuthority) CountFQDNSets(ctx context.Context, window time.D
 // exists in the database
 func (ssa *SQLStorageAuthority) FQDNSetExists(ctx context.Context, names []string) (bool, error) {
 	var count int64
-	err := ssa.dbMap.SelectOne(
-		&count,
-		`SELECT COUNT(1) FROM fqdnSets
-		WHERE setHash = ?
-		LIMIT 1`,
-		hashNames(names),
-	)
+	err := ssa.readFromReplica("FQDNSetExists", func(db gorp.SqlExecutor) error {
+		return db.SelectOne(
+			&count,
+			`SELECT COUNT(1) FROM fqdnSets
+			WHERE setHash = ?
+			LIMIT 1`,
+			hashNames(names),
+		)
+	})
 	return count > 0, err
 }
@@ -269,6 +269,35 @@ func TestGetValidAuthorizationsBasic(t *testing.T) {
 	test.AssertEquals(t, result.RegistrationID, reg.ID)
 }
 
+func TestGetValidAuthorizationsEmail(t *testing.T) {
+	sa, clk, cleanUp := initSA(t)
+	defer cleanUp()
+
+	reg := satest.CreateWorkingRegistration(t, sa)
+	authz, err := sa.NewPendingAuthorization(ctx, core.Authorization{RegistrationID: reg.ID, Challenges: []core.Challenge{{}}})
+	test.AssertNotError(t, err, "Couldn't create new pending authorization")
+	exp := clk.Now().AddDate(0, 0, 1)
+	authz.Identifier = core.AcmeIdentifier{Type: core.IdentifierEmail, Value: "alice@example.org"}
+	authz.Expires = &exp
+	authz.Challenges = []core.Challenge{{Type: core.ChallengeTypeEmailReply00, Status: core.StatusValid, Token: "THISWOULDNTBEAGOODTOKEN"}}
+	authz.Status = core.StatusValid
+	err = sa.FinalizeAuthorization(ctx, authz)
+	test.AssertNotError(t, err, "Couldn't finalize pending authorization with ID "+authz.ID)
+
+	// A DNS authorization for the address's domain isn't an email authorization.
+	domainAuthz := CreateDomainAuthWithRegID(t, "example.org", sa, reg.ID)
+	domainAuthz.Status = core.StatusValid
+	err = sa.FinalizeAuthorization(ctx, domainAuthz)
+	test.AssertNotError(t, err, "Couldn't finalize pending authorization with ID "+domainAuthz.ID)
+
+	authzMap, err := sa.GetValidAuthorizations(ctx, reg.ID, []string{"alice@example.org", "bob@example.org"}, clk.Now())
+	test.AssertNotError(t, err, "Error getting valid authorizations")
+	test.AssertEquals(t, len(authzMap), 1)
+	result := authzMap["alice@example.org"]
+	test.AssertEquals(t, result.ID, authz.ID)
+	test.AssertEquals(t, result.Identifier.Type, core.IdentifierEmail)
+}
+
 // Ensure we get the latest valid authorization for an ident
 func TestGetValidAuthorizationsDuplicate(t *testing.T) {
 	sa, clk, cleanUp := initSA(t)
@@ -387,6 +416,8 @@ func TestAddCertificate(t *testing.T) {
 	test.Assert(t, !certificateStatus.SubscriberApproved, "SubscriberApproved should be false")
 	test.Assert(t, certificateStatus.Status == core.OCSPStatusGood, "OCSP Status should be good")
 	test.Assert(t, certificateStatus.OCSPLastUpdated.IsZero(), "OCSPLastUpdated should be nil")
+	test.AssertNotNil(t, certificateStatus.NotAfter, "NotAfter should be set")
+	test.AssertEquals(t, *certificateStatus.NotAfter, retrievedCert.Expires)
 
 	// Test cert generated locally by Boulder / CFSSL, names [example.com,
 	// www.example.com, admin.example.com]
@@ -409,6 +440,68 @@ func TestAddCertificate(t *testing.T) {
 	test.Assert(t, certificateStatus2.OCSPLastUpdated.IsZero(), "OCSPLastUpdated should be nil")
 }
 
+func TestAddCertificateDuplicate(t *testing.T) {
+	sa, _, cleanUp := initSA(t)
+	defer cleanUp()
+
+	reg := satest.CreateWorkingRegistration(t, sa)
+	certDER, err := ioutil.ReadFile("www.eff.org.der")
+	test.AssertNotError(t, err, "Couldn't read example cert DER")
+
+	_, err = sa.AddCertificate(ctx, certDER, reg.ID)
+	test.AssertNotError(t, err, "Couldn't add www.eff.org.der")
+	// The partitioned tables have no unique key on serial, so it's the SA
+	// that refuses to store the certificate again.
+	_, err = sa.AddCertificate(ctx, certDER, reg.ID)
+	test.AssertError(t, err, "Added www.eff.org.der twice")
+
+	for _, table := range []string{"certificates", "certificateStatus", "fqdnSets"} {
+		count, err := sa.dbMap.SelectInt(
+			fmt.Sprintf("SELECT COUNT(1) FROM %s WHERE serial = ?", table),
+			"000000000000000000000000000000021bd4",
+		)
+		test.AssertNotError(t, err, "Couldn't count rows")
+		test.AssertEquals(t, count, int64(1))
+	}
+}
+
+func TestAddPrecertificate(t *testing.T) {
+	sa, _, cleanUp := initSA(t)
+	defer cleanUp()
+
+	reg := satest.CreateWorkingRegistration(t, sa)
+
+	// Any certificate will do; the SA doesn't check for the poison extension.
+	certDER, err := ioutil.ReadFile("www.eff.org.der")
+	test.AssertNotError(t, err, "Couldn't read example cert DER")
+
+	err = sa.AddPrecertificate(ctx, certDER, reg.ID)
+	test.AssertNotError(t, err, "Couldn't add precertificate")
+
+	precert, err := sa.GetPrecertificate(ctx, "000000000000000000000000000000021bd4")
+	test.AssertNotError(t, err, "Couldn't get precertificate")
+	test.AssertByteEquals(t, precert.DER, certDER)
+	test.AssertEquals(t, precert.RegistrationID, reg.ID)
+
+	_, err = sa.GetPrecertificate(ctx, "000000000000000000000000000000000000")
+	test.AssertEquals(t, err, core.NotFoundError("No precertificate found for 000000000000000000000000000000000000"))
+
+	// Precertificates are stored apart from certificates.
+	_, err = sa.GetCertificate(ctx, "000000000000000000000000000000021bd4")
+	test.AssertError(t, err, "Precertificate stored as a certificate")
+
+	err = sa.AddPrecertificate(ctx, certDER, reg.ID)
+	test.AssertError(t, err, "Added the same precertificate twice")
+
+	// A precertificate can only be claimed once.
+	err = sa.ClaimPrecertificate(ctx, "000000000000000000000000000000021bd4")
+	test.AssertNotError(t, err, "Couldn't claim precertificate")
+	err = sa.ClaimPrecertificate(ctx, "000000000000000000000000000000021bd4")
+	test.AssertEquals(t, err, core.NotFoundError("No unclaimed precertificate found for 000000000000000000000000000000021bd4"))
+	err = sa.ClaimPrecertificate(ctx, "000000000000000000000000000000000000")
+	test.AssertEquals(t, err, core.NotFoundError("No unclaimed precertificate found for 000000000000000000000000000000000000"))
+}
+
 func TestCountCertificatesByNames(t *testing.T) {
 	sa, clk, cleanUp := initSA(t)
 	defer cleanUp()
@@ -520,6 +613,147 @@ func TestGetSCTReceipt(t *testing.T) {
 	test.Assert(t, sqlSCT.CertificateSerial == sct.CertificateSerial, "Invalid certificate serial")
 }
 
+func TestSCTInclusions(t *testing.T) {
+	sigBytes, err := base64.StdEncoding.DecodeString(sctSignature)
+	test.AssertNotError(t, err, "Failed to decode SCT signature")
+	sct := core.SignedCertificateTimestamp{
+		SCTVersion:        sctVersion,
+		LogID:             sctLogID,
+		Timestamp:         sctTimestamp,
+		Signature:         sigBytes,
+		CertificateSerial: sctCertSerial,
+	}
+	sa, fc, cleanup := initSA(t)
+	defer cleanup()
+	err = sa.AddSCTReceipt(ctx, sct)
+	test.AssertNotError(t, err, "Failed to add SCT receipt")
+
+	issued := time.Unix(0, sctTimestamp*int64(time.Millisecond))
+	receipts, err := sa.GetUncheckedSCTReceipts(ctx, sctLogID, issued, 10)
+	test.AssertNotError(t, err, "Failed to get unchecked receipts")
+	test.AssertEquals(t, len(receipts), 0)
+	receipts, err = sa.GetUncheckedSCTReceipts(ctx, "another log", issued.Add(time.Second), 10)
+	test.AssertNotError(t, err, "Failed to get unchecked receipts")
+	test.AssertEquals(t, len(receipts), 0)
+	receipts, err = sa.GetUncheckedSCTReceipts(ctx, sctLogID, issued.Add(time.Second), 10)
+	test.AssertNotError(t, err, "Failed to get unchecked receipts")
+	test.AssertEquals(t, len(receipts), 1)
+	test.AssertEquals(t, receipts[0].CertificateSerial, sctCertSerial)
+
+	err = sa.AddSCTInclusion(ctx, core.SCTInclusion{
+		CertificateSerial: sctCertSerial,
+		LogID:             sctLogID,
+		Included:          true,
+		LeafIndex:         4,
+		TreeSize:          10,
+		Checked:           fc.Now(),
+	})
+	test.AssertNotError(t, err, "Failed to add SCT inclusion")
+	receipts, err = sa.GetUncheckedSCTReceipts(ctx, sctLogID, issued.Add(time.Second), 10)
+	test.AssertNotError(t, err, "Failed to get unchecked receipts")
+	test.AssertEquals(t, len(receipts), 0)
+}
+
+func TestSTHs(t *testing.T) {
+	sa, _, cleanup := initSA(t)
+	defer cleanup()
+
+	_, err := sa.GetLatestSTH(ctx, sctLogID)
+	test.AssertEquals(t, err, core.NotFoundError(fmt.Sprintf("No signed tree head found for log %s", sctLogID)))
+
+	for _, size := range []uint64{5, 10, 7} {
+		err = sa.AddSTH(ctx, core.SignedTreeHead{
+			LogID:     sctLogID,
+			TreeSize:  size,
+			Timestamp: size,
+			RootHash:  make([]byte, 32),
+			Signature: []byte{1},
+		})
+		test.AssertNotError(t, err, "Failed to add STH")
+	}
+	sth, err := sa.GetLatestSTH(ctx, sctLogID)
+	test.AssertNotError(t, err, "Failed to get latest STH")
+	test.AssertEquals(t, sth.TreeSize, uint64(10))
+}
+
+func TestCTSubmissions(t *testing.T) {
+	sa, fc, cleanup := initSA(t)
+	defer cleanup()
+
+	for _, serial := range []string{"01", "02"} {
+		err := sa.AddCTSubmission(ctx, core.CTSubmission{
+			CertificateSerial: serial,
+			LogID:             sctLogID,
+			Status:            core.CTSubmissionPending,
+			Attempts:          1,
+			LastError:         "log unavailable",
+			NextAttempt:       fc.Now().Add(time.Hour),
+		})
+		test.AssertNotError(t, err, "Failed to add CT submission")
+	}
+	// Queueing a submission twice is fine, and leaves the first one alone
+	err := sa.AddCTSubmission(ctx, core.CTSubmission{
+		CertificateSerial: "01",
+		LogID:             sctLogID,
+		Status:            core.CTSubmissionPending,
+		NextAttempt:       fc.Now(),
+	})
+	test.AssertNotError(t, err, "Failed to add duplicate CT submission")
+
+	// But the certificate's precertificate is queued on its own
+	err = sa.AddCTSubmission(ctx, core.CTSubmission{
+		CertificateSerial: "01",
+		LogID:             sctLogID,
+		Precertificate:    true,
+		Status:            core.CTSubmissionPending,
+		NextAttempt:       fc.Now().Add(24 * time.Hour),
+	})
+	test.AssertNotError(t, err, "Failed to add precertificate CT submission")
+	subs, err := sa.GetDueCTSubmissions(ctx, fc.Now().Add(24*time.Hour), 10)
+	test.AssertNotError(t, err, "Failed to get due CT submissions")
+	test.AssertEquals(t, len(subs), 3)
+	for _, sub := range subs {
+		if sub.Precertificate {
+			err = sa.RemoveCTSubmission(ctx, sub.ID)
+			test.AssertNotError(t, err, "Failed to remove precertificate CT submission")
+		}
+	}
+
+	subs, err = sa.GetDueCTSubmissions(ctx, fc.Now(), 10)
+	test.AssertNotError(t, err, "Failed to get due CT submissions")
+	test.AssertEquals(t, len(subs), 0)
+
+	fc.Add(time.Hour)
+	subs, err = sa.GetDueCTSubmissions(ctx, fc.Now(), 10)
+	test.AssertNotError(t, err, "Failed to get due CT submissions")
+	test.AssertEquals(t, len(subs), 2)
+	test.AssertEquals(t, subs[0].Attempts, 1)
+
+	subs[0].Status = core.CTSubmissionDead
+	subs[0].Attempts = 2
+	err = sa.UpdateCTSubmission(ctx, subs[0])
+	test.AssertNotError(t, err, "Failed to update CT submission")
+	err = sa.RemoveCTSubmission(ctx, subs[1].ID)
+	test.AssertNotError(t, err, "Failed to remove CT submission")
+
+	counts, err := sa.CountCTSubmissions(ctx)
+	test.AssertNotError(t, err, "Failed to count CT submissions")
+	test.AssertEquals(t, counts[core.CTSubmissionPending], int64(0))
+	test.AssertEquals(t, counts[core.CTSubmissionDead], int64(1))
+
+	n, err := sa.RequeueCTSubmissions(ctx, "", "another log")
+	test.AssertNotError(t, err, "Failed to requeue CT submissions")
+	test.AssertEquals(t, n, int64(0))
+	n, err = sa.RequeueCTSubmissions(ctx, subs[0].CertificateSerial, "")
+	test.AssertNotError(t, err, "Failed to requeue CT submissions")
+	test.AssertEquals(t, n, int64(1))
+
+	subs, err = sa.GetDueCTSubmissions(ctx, fc.Now(), 10)
+	test.AssertNotError(t, err, "Failed to get due CT submissions")
+	test.AssertEquals(t, len(subs), 1)
+	test.AssertEquals(t, subs[0].Attempts, 0)
+}
+
 func TestMarkCertificateRevoked(t *testing.T) {
 	sa, fc, cleanUp := initSA(t)
 	defer cleanUp()
@@ -556,6 +790,47 @@ func TestMarkCertificateRevoked(t *testing.T) {
 	}
 }
 
+func TestGetRevokedCertificates(t *testing.T) {
+	sa, fc, cleanUp := initSA(t)
+	defer cleanUp()
+
+	reg := satest.CreateWorkingRegistration(t, sa)
+	certDER, err := ioutil.ReadFile("www.eff.org.der")
+	test.AssertNotError(t, err, "Couldn't read example cert DER")
+	_, err = sa.AddCertificate(ctx, certDER, reg.ID)
+	test.AssertNotError(t, err, "Couldn't add www.eff.org.der")
+	serial := "000000000000000000000000000000021bd4"
+	cert, err := sa.GetCertificate(ctx, serial)
+	test.AssertNotError(t, err, "Couldn't get www.eff.org.der")
+	now := cert.Expires.Add(-time.Hour)
+
+	revoked, err := sa.GetRevokedCertificates(ctx, "", now, 10)
+	test.AssertNotError(t, err, "GetRevokedCertificates failed")
+	test.AssertEquals(t, len(revoked), 0)
+
+	err = sa.MarkCertificateRevoked(ctx, serial, core.RevocationCode(1))
+	test.AssertNotError(t, err, "MarkCertificateRevoked failed")
+
+	revoked, err = sa.GetRevokedCertificates(ctx, "", now, 10)
+	test.AssertNotError(t, err, "GetRevokedCertificates failed")
+	test.AssertEquals(t, len(revoked), 1)
+	test.AssertEquals(t, revoked[0].Serial, serial)
+	test.AssertEquals(t, revoked[0].RevokedReason, core.RevocationCode(1))
+	test.Assert(t, revoked[0].RevokedDate.Equal(fc.Now()), "Wrong revocation date")
+	test.Assert(t, revoked[0].Expires.Equal(cert.Expires), "Wrong expiry")
+	test.AssertByteEquals(t, revoked[0].DER, certDER)
+
+	// Paging past the last serial finds nothing more
+	revoked, err = sa.GetRevokedCertificates(ctx, serial, now, 10)
+	test.AssertNotError(t, err, "GetRevokedCertificates failed")
+	test.AssertEquals(t, len(revoked), 0)
+
+	// Nor are expired certificates returned
+	revoked, err = sa.GetRevokedCertificates(ctx, "", cert.Expires, 10)
+	test.AssertNotError(t, err, "GetRevokedCertificates failed")
+	test.AssertEquals(t, len(revoked), 0)
+}
+
 func TestCountCertificates(t *testing.T) {
 	sa, fc, cleanUp := initSA(t)
 	defer cleanUp()
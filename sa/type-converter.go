@@ -33,6 +33,8 @@ func (tc BoulderTypeConverter) ToDb(val interface{}) (interface{}, error) {
 		return string(t), nil
 	case core.OCSPStatus:
 		return string(t), nil
+	case core.CTSubmissionStatus:
+		return string(t), nil
 	default:
 		return val, nil
 	}
@@ -98,6 +100,21 @@ func (tc BoulderTypeConverter) FromDb(target interface{}) (gorp.CustomScanner, b
 			return nil
 		}
 		return gorp.CustomScanner{Holder: new(string), Target: target, Binder: binder}, true
+	case *core.CTSubmissionStatus:
+		binder := func(holder, target interface{}) error {
+			s, ok := holder.(*string)
+			if !ok {
+				return fmt.Errorf("FromDb: Unable to convert %T to *string", holder)
+			}
+			st, ok := target.(*core.CTSubmissionStatus)
+			if !ok {
+				return fmt.Errorf("FromDb: Unable to convert %T to *core.CTSubmissionStatus", target)
+			}
+
+			*st = core.CTSubmissionStatus(*s)
+			return nil
+		}
+		return gorp.CustomScanner{Holder: new(string), Target: target, Binder: binder}, true
 	default:
 		return gorp.CustomScanner{}, false
 	}
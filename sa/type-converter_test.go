@@ -121,3 +121,25 @@ func TestAcmeURLSlice(t *testing.T) {
 	err = scanner.Binder(&marshaled, &out)
 	test.AssertMarshaledEquals(t, au, out)
 }
+
+func TestCTSubmissionStatus(t *testing.T) {
+	tc := BoulderTypeConverter{}
+
+	var status, out core.CTSubmissionStatus
+	status = core.CTSubmissionDead
+
+	marshaledI, err := tc.ToDb(status)
+	test.AssertNotError(t, err, "Could not ToDb")
+
+	scanner, ok := tc.FromDb(&out)
+	test.Assert(t, ok, "FromDb failed")
+	if !ok {
+		t.FailNow()
+		return
+	}
+
+	marshaled := marshaledI.(string)
+	err = scanner.Binder(&marshaled, &out)
+	test.AssertNotError(t, err, "Could not bind")
+	test.AssertEquals(t, out, status)
+}
@@ -28,7 +28,8 @@ for dbenv in $DBENVS; do
 
   echo "created empty ${db} database"
 
-  goose -path=./sa/_db/ -env=$dbenv up || die "unable to migrate ${db}"
+  go run ./cmd/boulder-db/main.go up --config test/boulder-db.json \
+    --db-connect "mysql+tcp://root@boulder-mysql:3306/${db}" || die "unable to migrate ${db}"
   echo "migrated ${db} database"
 
   # With MYSQL_CONTAINER, patch the GRANT statements to
@@ -1,6 +1,7 @@
 // This is a test server that implements the subset of RFC6962 APIs needed to
-// run Boulder's CT log submission code. Currently it only implements add-chain.
-// This is used by startservers.py.
+// run Boulder's CT log submission and monitoring code: add-chain,
+// add-pre-chain, get-sth, get-sth-consistency and get-proof-by-hash. This is
+// used by startservers.py.
 package main
 
 import (
@@ -16,13 +17,38 @@ import (
 	"log"
 	"math/big"
 	"net/http"
+	"net/url"
 	"os"
+	"strconv"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	ct "github.com/google/certificate-transparency/go"
+
+	"github.com/letsencrypt/boulder/merkle"
+	"github.com/letsencrypt/boulder/precert"
 )
 
-func createSignedSCT(leaf []byte, k *ecdsa.PrivateKey) []byte {
+func sign(data []byte, k *ecdsa.PrivateKey) ct.DigitallySigned {
+	hashed := sha256.Sum256(data)
+	var ecdsaSig struct {
+		R, S *big.Int
+	}
+	ecdsaSig.R, ecdsaSig.S, _ = ecdsa.Sign(rand.Reader, k, hashed[:])
+	sig, _ := asn1.Marshal(ecdsaSig)
+
+	return ct.DigitallySigned{
+		HashAlgorithm:      ct.SHA256,
+		SignatureAlgorithm: ct.ECDSA,
+		Signature:          sig,
+	}
+}
+
+// createSignedSCT returns the JSON encoded SCT for entry, and the
+// MerkleTreeLeaf it promises to add to the log, which is serialized exactly
+// as the SCT's signature input is.
+func createSignedSCT(entry ct.TimestampedEntry, k *ecdsa.PrivateKey) ([]byte, []byte) {
 	rawKey, _ := x509.MarshalPKIXPublicKey(&k.PublicKey)
 	pkHash := sha256.Sum256(rawKey)
 	sct := ct.SignedCertificateTimestamp{
@@ -32,25 +58,11 @@ func createSignedSCT(leaf []byte, k *ecdsa.PrivateKey) []byte {
 	}
 	serialized, _ := ct.SerializeSCTSignatureInput(sct, ct.LogEntry{
 		Leaf: ct.MerkleTreeLeaf{
-			LeafType: ct.TimestampedEntryLeafType,
-			TimestampedEntry: ct.TimestampedEntry{
-				X509Entry: ct.ASN1Cert(leaf),
-				EntryType: ct.X509LogEntryType,
-			},
+			LeafType:         ct.TimestampedEntryLeafType,
+			TimestampedEntry: entry,
 		},
 	})
-	hashed := sha256.Sum256(serialized)
-	var ecdsaSig struct {
-		R, S *big.Int
-	}
-	ecdsaSig.R, ecdsaSig.S, _ = ecdsa.Sign(rand.Reader, k, hashed[:])
-	sig, _ := asn1.Marshal(ecdsaSig)
-
-	ds := ct.DigitallySigned{
-		HashAlgorithm:      ct.SHA256,
-		SignatureAlgorithm: ct.ECDSA,
-		Signature:          sig,
-	}
+	ds := sign(serialized, k)
 
 	var jsonSCTObj struct {
 		SCTVersion ct.Version `json:"sct_version"`
@@ -65,7 +77,7 @@ func createSignedSCT(leaf []byte, k *ecdsa.PrivateKey) []byte {
 	jsonSCTObj.Signature, _ = ds.Base64String()
 
 	jsonSCT, _ := json.Marshal(jsonSCTObj)
-	return jsonSCT
+	return jsonSCT, serialized
 }
 
 type ctSubmissionRequest struct {
@@ -75,11 +87,109 @@ type ctSubmissionRequest struct {
 type integrationSrv struct {
 	submissions int64
 	key         *ecdsa.PrivateKey
+
+	// Submissions are merged into the tree immediately, so the log never
+	// needs its MMD.
+	treeMu sync.Mutex
+	tree   merkle.Tree
+}
+
+// writeJSON writes v as the response, or a 400 if err is set
+func writeJSON(w http.ResponseWriter, v interface{}, err error) {
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	body, _ := json.Marshal(v)
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+// treeSize parses the named tree size parameter, which has to be no larger
+// than the tree.
+func (is *integrationSrv) treeSize(params url.Values, name string) (uint64, error) {
+	size, err := strconv.ParseUint(params.Get(name), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("bad %s: %s", name, err)
+	}
+	if size > is.tree.Size() {
+		return 0, fmt.Errorf("%s %d is larger than the tree", name, size)
+	}
+	return size, nil
+}
+
+func encodeHashes(hashes []merkle.Hash) []string {
+	encoded := make([]string, len(hashes))
+	for i, h := range hashes {
+		encoded[i] = base64.StdEncoding.EncodeToString(h[:])
+	}
+	return encoded
+}
+
+func (is *integrationSrv) getSTH() (interface{}, error) {
+	sth := ct.SignedTreeHead{
+		Version:        ct.V1,
+		TreeSize:       is.tree.Size(),
+		Timestamp:      uint64(time.Now().UnixNano() / int64(time.Millisecond)),
+		SHA256RootHash: ct.SHA256Hash(is.tree.Root(is.tree.Size())),
+	}
+	serialized, err := ct.SerializeSTHSignatureInput(sth)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := sign(serialized, is.key).Base64String()
+	if err != nil {
+		return nil, err
+	}
+	return struct {
+		TreeSize          uint64 `json:"tree_size"`
+		Timestamp         uint64 `json:"timestamp"`
+		SHA256RootHash    string `json:"sha256_root_hash"`
+		TreeHeadSignature string `json:"tree_head_signature"`
+	}{sth.TreeSize, sth.Timestamp, sth.SHA256RootHash.Base64String(), sig}, nil
+}
+
+func (is *integrationSrv) getConsistency(params url.Values) (interface{}, error) {
+	first, err := is.treeSize(params, "first")
+	if err != nil {
+		return nil, err
+	}
+	second, err := is.treeSize(params, "second")
+	if err != nil {
+		return nil, err
+	}
+	if first > second {
+		return nil, fmt.Errorf("first %d is larger than second %d", first, second)
+	}
+	return struct {
+		Consistency []string `json:"consistency"`
+	}{encodeHashes(is.tree.ConsistencyProof(first, second))}, nil
+}
+
+func (is *integrationSrv) getProofByHash(params url.Values) (interface{}, error) {
+	size, err := is.treeSize(params, "tree_size")
+	if err != nil {
+		return nil, err
+	}
+	b, err := base64.StdEncoding.DecodeString(params.Get("hash"))
+	if err != nil || len(b) != sha256.Size {
+		return nil, fmt.Errorf("bad hash %q", params.Get("hash"))
+	}
+	var leafHash merkle.Hash
+	copy(leafHash[:], b)
+	index, ok := is.tree.Index(leafHash)
+	if !ok || index >= size {
+		return nil, fmt.Errorf("no leaf with hash %q in tree of size %d", params.Get("hash"), size)
+	}
+	return struct {
+		LeafIndex uint64   `json:"leaf_index"`
+		AuditPath []string `json:"audit_path"`
+	}{index, encodeHashes(is.tree.InclusionProof(index, size))}, nil
 }
 
 func (is *integrationSrv) handler(w http.ResponseWriter, r *http.Request) {
 	switch r.URL.Path {
-	case "/ct/v1/add-chain":
+	case "/ct/v1/add-chain", "/ct/v1/add-pre-chain":
 		if r.Method != "POST" {
 			http.NotFound(w, r)
 			return
@@ -105,11 +215,68 @@ func (is *integrationSrv) handler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		w.WriteHeader(http.StatusOK)
+		entry := ct.TimestampedEntry{
+			X509Entry: ct.ASN1Cert(leaf),
+			EntryType: ct.X509LogEntryType,
+		}
+		if r.URL.Path == "/ct/v1/add-pre-chain" {
+			// Precertificates are logged as their TBSCertificate without the
+			// poison, along with the hash of their issuer's key.
+			if len(addChainReq.Chain) < 2 {
+				w.WriteHeader(400)
+				return
+			}
+			issuerDER, err := base64.StdEncoding.DecodeString(addChainReq.Chain[1])
+			if err != nil {
+				w.WriteHeader(400)
+				return
+			}
+			issuer, err := x509.ParseCertificate(issuerDER)
+			if err != nil {
+				w.WriteHeader(400)
+				return
+			}
+			tbs, err := precert.TBSWithout(leaf, precert.OIDPoison)
+			if err != nil {
+				w.WriteHeader(400)
+				return
+			}
+			entry = ct.TimestampedEntry{
+				EntryType: ct.PrecertLogEntryType,
+				PrecertEntry: ct.PreCert{
+					IssuerKeyHash:  sha256.Sum256(issuer.RawSubjectPublicKeyInfo),
+					TBSCertificate: tbs,
+				},
+			}
+		}
+
 		// id is a sha256 of a random EC key. Generate your own with:
 		// openssl ecparam -name prime256v1 -genkey -outform der | openssl sha256 -binary | base64
-		w.Write(createSignedSCT(leaf, is.key))
+		sct, leaf := createSignedSCT(entry, is.key)
+		is.treeMu.Lock()
+		is.tree.Append(leaf)
+		is.treeMu.Unlock()
+		w.WriteHeader(http.StatusOK)
+		w.Write(sct)
 		atomic.AddInt64(&is.submissions, 1)
+	case "/ct/v1/get-sth", "/ct/v1/get-sth-consistency", "/ct/v1/get-proof-by-hash":
+		if r.Method != "GET" {
+			http.NotFound(w, r)
+			return
+		}
+		is.treeMu.Lock()
+		defer is.treeMu.Unlock()
+		var resp interface{}
+		var err error
+		switch r.URL.Path {
+		case "/ct/v1/get-sth":
+			resp, err = is.getSTH()
+		case "/ct/v1/get-sth-consistency":
+			resp, err = is.getConsistency(r.URL.Query())
+		default:
+			resp, err = is.getProofByHash(r.URL.Query())
+		}
+		writeJSON(w, resp, err)
 	case "/submissions":
 		if r.Method != "GET" {
 			http.NotFound(w, r)
@@ -27,9 +27,9 @@ type CleanUpDB interface {
 // that will delete all rows again and close the database.
 // "Tables available" means all tables that can be seen in the MariaDB
 // configuration by the database user except for ones that are
-// configuration only like goose_db_version (for migrations) or
-// the ones describing the internal configuration of the server. To be
-// used only in test code.
+// configuration only like goose_db_version and schemaMigrations (for
+// migrations) or the ones describing the internal configuration of
+// the server. To be used only in test code.
 func ResetSATestDatabase(t testing.TB) func() {
 	return resetTestDatabase(t, "sa")
 }
@@ -100,11 +100,11 @@ func deleteEverythingInAllTables(db CleanUpDB) error {
 // allTableNamesInDB returns the names of the tables available to the
 // CleanUpDB passed in. "Tables available" means all tables that can
 // be seen in the MariaDB configuration by the database user except
-// for ones that are configuration only like goose_db_version (for
-// migrations) or the ones describing the internal configuration of
-// the server. To be used only in test code.
+// for ones that are configuration only like goose_db_version and
+// schemaMigrations (for migrations) or the ones describing the
+// internal configuration of the server. To be used only in test code.
 func allTableNamesInDB(db CleanUpDB) ([]string, error) {
-	r, err := db.Query("select table_name from information_schema.tables t where t.table_schema = DATABASE() and t.table_name != 'goose_db_version';")
+	r, err := db.Query("select table_name from information_schema.tables t where t.table_schema = DATABASE() and t.table_name not in ('goose_db_version', 'schemaMigrations');")
 	if err != nil {
 		return nil, err
 	}
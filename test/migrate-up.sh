@@ -9,13 +9,12 @@ cd $(dirname $0)/..
 
 source test/db-common.sh
 
-for svc in $SERVICES; do
-  for dbenv in $DBENVS; do
-    db="boulder_${svc}_${dbenv}"
+for dbenv in $DBENVS; do
+  db="boulder_sa_${dbenv}"
 
-    goose -path=./$svc/_db/ -env=$dbenv up || die "unable to migrate ${db}"
-    echo "migrated ${db} database"
-  done
+  go run ./cmd/boulder-db/main.go up --config test/boulder-db.json \
+    --db-connect "mysql+tcp://root@boulder-mysql:3306/${db}" || die "unable to migrate ${db}"
+  echo "migrated ${db} database"
 done
 echo "migrated all databases"
 
@@ -18,12 +18,14 @@
 -- These lines require MariaDB 10.1
 CREATE USER IF NOT EXISTS 'policy'@'localhost';
 CREATE USER IF NOT EXISTS 'sa'@'localhost';
+CREATE USER IF NOT EXISTS 'sa_ro'@'localhost';
 CREATE USER IF NOT EXISTS 'ocsp_resp'@'localhost';
 CREATE USER IF NOT EXISTS 'revoker'@'localhost';
 CREATE USER IF NOT EXISTS 'importer'@'localhost';
 CREATE USER IF NOT EXISTS 'mailer'@'localhost';
 CREATE USER IF NOT EXISTS 'cert_checker'@'localhost';
 CREATE USER IF NOT EXISTS 'ocsp_update'@'localhost';
+CREATE USER IF NOT EXISTS 'crl_update'@'localhost';
 CREATE USER IF NOT EXISTS 'test_setup'@'localhost';
 CREATE USER IF NOT EXISTS 'purger'@'localhost';
 
@@ -32,23 +34,43 @@ GRANT SELECT,INSERT,UPDATE ON authz TO 'sa'@'localhost';
 GRANT SELECT,INSERT,UPDATE,DELETE ON pendingAuthorizations TO 'sa'@'localhost';
 GRANT SELECT(id,Lockcol) ON pendingAuthorizations TO 'sa'@'localhost';
 GRANT SELECT,INSERT ON certificates TO 'sa'@'localhost';
+GRANT SELECT,INSERT,UPDATE ON precertificates TO 'sa'@'localhost';
 GRANT SELECT,INSERT,UPDATE ON certificateStatus TO 'sa'@'localhost';
 GRANT SELECT,INSERT ON issuedNames TO 'sa'@'localhost';
 GRANT SELECT,INSERT ON sctReceipts TO 'sa'@'localhost';
+GRANT SELECT,INSERT ON sctInclusions TO 'sa'@'localhost';
+GRANT SELECT,INSERT ON signedTreeHeads TO 'sa'@'localhost';
+GRANT SELECT,INSERT,UPDATE,DELETE ON ctSubmissions TO 'sa'@'localhost';
 GRANT INSERT ON ocspResponses TO 'sa'@'localhost';
 GRANT SELECT,INSERT,UPDATE ON registrations TO 'sa'@'localhost';
 GRANT SELECT,INSERT,UPDATE ON challenges TO 'sa'@'localhost';
 GRANT SELECT,INSERT on fqdnSets TO 'sa'@'localhost';
+GRANT SELECT ON schemaMigrations TO 'sa'@'localhost';
+
+-- Storage Authority read replica
+GRANT SELECT ON registrations TO 'sa_ro'@'localhost';
+GRANT SELECT ON pendingAuthorizations TO 'sa_ro'@'localhost';
+GRANT SELECT ON certificates TO 'sa_ro'@'localhost';
+GRANT SELECT ON certificateStatus TO 'sa_ro'@'localhost';
+GRANT SELECT ON issuedNames TO 'sa_ro'@'localhost';
+GRANT SELECT ON fqdnSets TO 'sa_ro'@'localhost';
+GRANT REPLICATION CLIENT ON *.* TO 'sa_ro'@'localhost';
 
 -- OCSP Responder
 GRANT SELECT ON certificateStatus TO 'ocsp_resp'@'localhost';
 GRANT SELECT ON ocspResponses TO 'ocsp_resp'@'localhost';
+GRANT SELECT ON schemaMigrations TO 'ocsp_resp'@'localhost';
 
 -- OCSP Generator Tool (Updater)
 GRANT INSERT ON ocspResponses TO 'ocsp_update'@'localhost';
 GRANT SELECT ON certificates TO 'ocsp_update'@'localhost';
 GRANT SELECT,UPDATE ON certificateStatus TO 'ocsp_update'@'localhost';
 GRANT SELECT ON sctReceipts TO 'ocsp_update'@'localhost';
+GRANT SELECT ON schemaMigrations TO 'ocsp_update'@'localhost';
+
+-- CRL Updater
+GRANT SELECT,INSERT,DELETE ON crls TO 'crl_update'@'localhost';
+GRANT SELECT ON schemaMigrations TO 'crl_update'@'localhost';
 
 -- Revoker Tool
 GRANT SELECT ON registrations TO 'revoker'@'localhost';
@@ -66,9 +88,22 @@ GRANT SELECT ON fqdnSets TO 'mailer'@'localhost';
 
 -- Cert checker
 GRANT SELECT ON certificates TO 'cert_checker'@'localhost';
+GRANT SELECT ON precertificates TO 'cert_checker'@'localhost';
 
 -- Expired authorization purger
 GRANT SELECT,DELETE ON pendingAuthorizations TO 'purger'@'localhost';
 
+-- Expired certificate purger
+GRANT SELECT,DELETE ON certificates TO 'purger'@'localhost';
+GRANT SELECT,DELETE ON certificateStatus TO 'purger'@'localhost';
+GRANT SELECT,DELETE ON issuedNames TO 'purger'@'localhost';
+GRANT SELECT,DELETE ON fqdnSets TO 'purger'@'localhost';
+GRANT SELECT,DELETE ON ocspResponses TO 'purger'@'localhost';
+GRANT SELECT,DELETE ON sctReceipts TO 'purger'@'localhost';
+GRANT SELECT,DELETE ON sctInclusions TO 'purger'@'localhost';
+GRANT SELECT,DELETE ON ctSubmissions TO 'purger'@'localhost';
+GRANT SELECT,DELETE ON precertificates TO 'purger'@'localhost';
+GRANT SELECT ON schemaMigrations TO 'purger'@'localhost';
+
 -- Test setup and teardown
 GRANT ALL PRIVILEGES ON * to 'test_setup'@'localhost';
@@ -54,6 +54,8 @@ def start(race_detection):
         'boulder-va --config %s' % os.path.join(default_config_dir, "va.json"),
         'boulder-publisher --config %s' % os.path.join(default_config_dir, "publisher.json"),
         'ocsp-updater --config %s' % os.path.join(default_config_dir, "ocsp-updater.json"),
+        'crl-updater --config %s' % os.path.join(default_config_dir, "crl-updater.json"),
+        'ct-monitor --config %s' % os.path.join(default_config_dir, "ct-monitor.json"),
         'ocsp-responder --config %s' % os.path.join(default_config_dir, "ocsp-responder.json"),
         'ct-test-srv',
         'dns-test-srv',
@@ -0,0 +1,184 @@
+package va
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/reloader"
+)
+
+// hashPrefixTag introduces a hash prefix entry in a blocklist file.
+const hashPrefixTag = "sha256:"
+
+// minHashPrefixLen is the shortest hash prefix, in hex digits, accepted in a
+// blocklist file. Shorter prefixes would block too many unrelated domains.
+const minHashPrefixLen = 8
+
+type blocklistEntries struct {
+	domains      map[string]bool
+	hashPrefixes []string
+}
+
+// Blocklist is a SafeBrowsing implementation backed by local files. Each file
+// lists one entry per line: either a domain name, which blocks that domain and
+// all of its subdomains, or "sha256:" followed by a hex prefix of the SHA-256
+// hash of a domain name, which does the same without revealing the domain.
+// Blank lines and lines starting with "#" are ignored.
+//
+// IsListed reports the base name of the file an entry was found in as the
+// list name.
+type Blocklist struct {
+	log       blog.Logger
+	reloaders []*reloader.Reloader
+
+	mu    sync.RWMutex
+	files map[string]*blocklistEntries
+}
+
+// NewBlocklist loads the blocklist file at path, or every regular file in the
+// directory at path, and keeps them up to date using a reloader until Close is
+// called. Files added to a directory after NewBlocklist returns are not picked
+// up.
+func NewBlocklist(path string, logger blog.Logger) (*Blocklist, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	filenames := []string{path}
+	if info.IsDir() {
+		filenames, err = blocklistFiles(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+	bl := &Blocklist{
+		log:   logger,
+		files: make(map[string]*blocklistEntries),
+	}
+	for _, filename := range filenames {
+		filename := filename
+		name := filepath.Base(filename)
+		r, err := reloader.New(filename, func(b []byte) error {
+			return bl.load(name, b)
+		}, func(err error) {
+			bl.log.AuditErr(fmt.Sprintf("error loading blocklist %s: %s", filename, err))
+		})
+		if err != nil {
+			bl.Close()
+			return nil, fmt.Errorf("loading blocklist %s: %s", filename, err)
+		}
+		bl.reloaders = append(bl.reloaders, r)
+	}
+	return bl, nil
+}
+
+// Close stops reloading the blocklist files. The entries last loaded stay in
+// use.
+func (bl *Blocklist) Close() {
+	for _, r := range bl.reloaders {
+		r.Stop()
+	}
+	bl.reloaders = nil
+}
+
+func blocklistFiles(dir string) ([]string, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var filenames []string
+	for _, info := range infos {
+		if !info.Mode().IsRegular() || strings.HasPrefix(info.Name(), ".") {
+			continue
+		}
+		filenames = append(filenames, filepath.Join(dir, info.Name()))
+	}
+	if len(filenames) == 0 {
+		return nil, fmt.Errorf("no blocklist files in %s", dir)
+	}
+	return filenames, nil
+}
+
+// load replaces the entries for the named file with those parsed from b.
+func (bl *Blocklist) load(name string, b []byte) error {
+	entries, err := parseBlocklist(b)
+	if err != nil {
+		return err
+	}
+	bl.mu.Lock()
+	defer bl.mu.Unlock()
+	bl.files[name] = entries
+	bl.log.Info(fmt.Sprintf("loaded blocklist %s: %d domains, %d hash prefixes",
+		name, len(entries.domains), len(entries.hashPrefixes)))
+	return nil
+}
+
+func parseBlocklist(b []byte) (*blocklistEntries, error) {
+	entries := &blocklistEntries{domains: make(map[string]bool)}
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for line := 1; scanner.Scan(); line++ {
+		entry := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+		if strings.HasPrefix(entry, hashPrefixTag) {
+			prefix := strings.TrimPrefix(entry, hashPrefixTag)
+			if _, err := hex.DecodeString(prefix); err != nil || len(prefix) < minHashPrefixLen {
+				return nil, fmt.Errorf("line %d: invalid hash prefix %q", line, prefix)
+			}
+			entries.hashPrefixes = append(entries.hashPrefixes, prefix)
+			continue
+		}
+		entries.domains[strings.TrimSuffix(entry, ".")] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// IsListed returns the name of the first blocklist file, in lexical order,
+// that lists domain or one of its parent domains.
+func (bl *Blocklist) IsListed(domain string) (string, error) {
+	domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+	labels := strings.Split(domain, ".")
+	var names, hashes []string
+	for i := range labels {
+		name := strings.Join(labels[i:], ".")
+		hash := sha256.Sum256([]byte(name))
+		names = append(names, name)
+		hashes = append(hashes, hex.EncodeToString(hash[:]))
+	}
+
+	bl.mu.RLock()
+	defer bl.mu.RUnlock()
+	var files []string
+	for file := range bl.files {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		entries := bl.files[file]
+		for i, name := range names {
+			if entries.domains[name] {
+				return file, nil
+			}
+			for _, prefix := range entries.hashPrefixes {
+				if strings.HasPrefix(hashes[i], prefix) {
+					return file, nil
+				}
+			}
+		}
+	}
+	return "", nil
+}
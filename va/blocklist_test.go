@@ -0,0 +1,90 @@
+package va
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/test"
+)
+
+func writeBlocklist(t *testing.T, dir, name, contents string) string {
+	filename := filepath.Join(dir, name)
+	err := ioutil.WriteFile(filename, []byte(contents), 0644)
+	test.AssertNotError(t, err, "writing blocklist")
+	return filename
+}
+
+func TestBlocklist(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blocklist")
+	test.AssertNotError(t, err, "creating temp dir")
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	hash := sha256.Sum256([]byte("hashed.com"))
+	writeBlocklist(t, dir, "phishing.txt", "# phishing domains\n\nBad.com.\n")
+	writeBlocklist(t, dir, "hashes.txt", "sha256:"+hex.EncodeToString(hash[:6])+"\n")
+	writeBlocklist(t, dir, ".hidden", "good.com\n")
+
+	bl, err := NewBlocklist(dir, blog.NewMock())
+	test.AssertNotError(t, err, "NewBlocklist failed")
+	test.AssertEquals(t, len(bl.reloaders), 2)
+
+	testCases := []struct {
+		domain string
+		list   string
+	}{
+		{"bad.com", "phishing.txt"},
+		{"www.BAD.com", "phishing.txt"},
+		{"notbad.com", ""},
+		{"hashed.com", "hashes.txt"},
+		{"a.hashed.com", "hashes.txt"},
+		{"good.com", ""},
+	}
+	for _, tc := range testCases {
+		list, err := bl.IsListed(tc.domain)
+		test.AssertNotError(t, err, tc.domain)
+		test.AssertEquals(t, list, tc.list)
+	}
+
+	// A reload replaces that file's entries.
+	err = bl.load("phishing.txt", []byte("other.com\n"))
+	test.AssertNotError(t, err, "reloading blocklist")
+	list, _ := bl.IsListed("bad.com")
+	test.AssertEquals(t, list, "")
+	list, _ = bl.IsListed("other.com")
+	test.AssertEquals(t, list, "phishing.txt")
+
+	// A single file can be loaded too.
+	bl.Close()
+	test.AssertEquals(t, len(bl.reloaders), 0)
+	bl, err = NewBlocklist(filepath.Join(dir, "phishing.txt"), blog.NewMock())
+	test.AssertNotError(t, err, "NewBlocklist failed")
+	list, _ = bl.IsListed("bad.com")
+	test.AssertEquals(t, list, "phishing.txt")
+
+	// Closed blocklists keep their entries.
+	bl.Close()
+	list, _ = bl.IsListed("bad.com")
+	test.AssertEquals(t, list, "phishing.txt")
+}
+
+func TestBlocklistErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blocklist")
+	test.AssertNotError(t, err, "creating temp dir")
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	_, err = NewBlocklist(dir, blog.NewMock())
+	test.AssertError(t, err, "NewBlocklist succeeded on an empty directory")
+	_, err = NewBlocklist(filepath.Join(dir, "missing.txt"), blog.NewMock())
+	test.AssertError(t, err, "NewBlocklist succeeded on a missing file")
+
+	for _, contents := range []string{"sha256:abc\n", "sha256:not-hex-at-all\n"} {
+		filename := writeBlocklist(t, dir, "bad.txt", contents)
+		_, err = NewBlocklist(filename, blog.NewMock())
+		test.AssertError(t, err, contents)
+	}
+}
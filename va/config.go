@@ -0,0 +1,239 @@
+package va
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	netmail "net/mail"
+	"strings"
+	"time"
+
+	"github.com/cactus/go-statsd-client/statsd"
+	"github.com/jmhodges/clock"
+
+	"github.com/letsencrypt/boulder/bdns"
+	"github.com/letsencrypt/boulder/cdr"
+	"github.com/letsencrypt/boulder/cmd"
+	caaPB "github.com/letsencrypt/boulder/cmd/caa-checker/proto"
+	bgrpc "github.com/letsencrypt/boulder/grpc"
+	blog "github.com/letsencrypt/boulder/log"
+	bmail "github.com/letsencrypt/boulder/mail"
+	"github.com/letsencrypt/boulder/metrics"
+)
+
+// DNSConfig holds the DNS settings that the VA shares with other services.
+type DNSConfig struct {
+	// The resolver to query, unless the VA config has DNSUpstreams
+	Resolver string
+	Timeout  time.Duration
+	// AllowLoopbackAddresses is only for testing.
+	AllowLoopbackAddresses bool
+}
+
+// NewFromConfig constructs a ValidationAuthorityImpl and its DNS resolver as
+// configured by c. If c configures email-reply-00 validation, it also starts
+// listening for replies. Safe browsing is set up by the caller, since
+// validation doesn't use it.
+func NewFromConfig(c cmd.VAConfig, dnsConfig DNSConfig, sbc SafeBrowsing, stats statsd.Statter, clk clock.Clock, logger blog.Logger) (*ValidationAuthorityImpl, error) {
+	pc := &cmd.PortConfig{
+		HTTPPort:  80,
+		HTTPSPort: 443,
+		TLSPort:   443,
+	}
+	if c.PortConfig.HTTPPort != 0 {
+		pc.HTTPPort = c.PortConfig.HTTPPort
+	}
+	if c.PortConfig.HTTPSPort != 0 {
+		pc.HTTPSPort = c.PortConfig.HTTPSPort
+	}
+	if c.PortConfig.TLSPort != 0 {
+		pc.TLSPort = c.PortConfig.TLSPort
+	}
+
+	var caaClient caaPB.CAACheckerClient
+	if c.CAAService != nil {
+		conn, err := bgrpc.ClientSetup(c.CAAService)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create connection to CAA service: %s", err)
+		}
+		caaClient = caaPB.NewCAACheckerClient(conn)
+	}
+
+	scoped := metrics.NewStatsdScope(stats, "VA", "DNS")
+
+	var cdrClient *cdr.CAADistributedResolver
+	if c.CAADistributedResolver != nil {
+		var err error
+		cdrClient, err = cdr.New(
+			scoped,
+			c.CAADistributedResolver.Timeout.Duration,
+			c.CAADistributedResolver.MaxFailures,
+			c.CAADistributedResolver.Proxies,
+			logger)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create CAADistributedResolver: %s", err)
+		}
+	}
+
+	r, err := newDNSResolver(c, dnsConfig, scoped, clk)
+	if err != nil {
+		return nil, err
+	}
+
+	vai := NewValidationAuthorityImpl(
+		pc,
+		sbc,
+		caaClient,
+		cdrClient,
+		r,
+		c.UserAgent,
+		c.IssuerDomain,
+		stats,
+		clk,
+		logger)
+	if c.ValidationRetries != nil {
+		vai.RetryPolicy = RetryPolicy{
+			MaxAttempts: c.ValidationRetries.MaxAttempts,
+			Backoff:     c.ValidationRetries.Backoff.Duration,
+			MaxBackoff:  c.ValidationRetries.MaxBackoff.Duration,
+		}
+	}
+	if hc := c.HTTPValidation; hc != nil {
+		whitespace := WhitespaceHandling(hc.Whitespace)
+		switch whitespace {
+		case "", TrimTrailing, TrimBoth, TrimNone:
+		default:
+			return nil, fmt.Errorf("unknown whitespace handling %q", hc.Whitespace)
+		}
+		vai.HTTPPolicy = HTTPPolicy{
+			MaxRedirects:            hc.MaxRedirects,
+			RedirectPorts:           hc.RedirectPorts,
+			RedirectSchemes:         hc.RedirectSchemes,
+			RejectIPRedirects:       hc.RejectIPRedirects,
+			RejectReservedRedirects: hc.RejectReservedRedirects,
+			MaxBodySize:             hc.MaxBodySize,
+			Whitespace:              whitespace,
+		}
+	}
+	if c.EmailReply != nil {
+		vai.EmailReply, err = newEmailReply(c.EmailReply, stats, logger)
+		if err != nil {
+			return nil, fmt.Errorf("failed to set up email-reply-00 validation: %s", err)
+		}
+	}
+	return vai, nil
+}
+
+func newDNSResolver(c cmd.VAConfig, dnsConfig DNSConfig, scoped metrics.Scope, clk clock.Clock) (*bdns.DNSResolverImpl, error) {
+	dnsTries := c.DNSTries
+	if dnsTries < 1 {
+		dnsTries = 1
+	}
+	caaSERVFAILExceptions, err := bdns.ReadHostList(c.CAASERVFAILExceptions)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read CAASERVFAILExceptions file: %s", err)
+	}
+	var r *bdns.DNSResolverImpl
+	if !dnsConfig.AllowLoopbackAddresses {
+		r = bdns.NewDNSResolverImpl(
+			dnsConfig.Timeout,
+			[]string{dnsConfig.Resolver},
+			caaSERVFAILExceptions,
+			scoped,
+			clk,
+			dnsTries)
+	} else {
+		r = bdns.NewTestDNSResolverImpl(dnsConfig.Timeout, []string{dnsConfig.Resolver}, scoped, clk, dnsTries)
+	}
+	r.LookupIPv6 = c.LookupIPv6
+	if len(c.DNSUpstreams) > 0 {
+		upstreams, err := loadDNSUpstreams(c.DNSUpstreams)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't load DNS upstreams: %s", err)
+		}
+		err = r.SetUpstreams(upstreams)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't configure DNS upstreams: %s", err)
+		}
+	}
+	if c.DNSServerHealth != nil {
+		r.TrackServerHealth(bdns.ServerHealthConfig{
+			ErrorRateThreshold: c.DNSServerHealth.ErrorRateThreshold,
+			MaxLatency:         c.DNSServerHealth.MaxLatency.Duration,
+			ProbeInterval:      c.DNSServerHealth.ProbeInterval.Duration,
+		})
+	}
+	if c.DNSCache != nil {
+		r.Cache = bdns.NewDNSCache(
+			c.DNSCache.MaxEntries,
+			c.DNSCache.MaxTTL.Duration,
+			clk,
+			scoped)
+	}
+	return r, nil
+}
+
+func loadDNSUpstreams(configs []cmd.DNSUpstreamConfig) ([]bdns.Upstream, error) {
+	var upstreams []bdns.Upstream
+	for _, uc := range configs {
+		u := bdns.Upstream{
+			Address:          uc.Address,
+			Transport:        bdns.Transport(uc.Transport),
+			ServerName:       uc.ServerName,
+			PinnedSPKIHashes: uc.PinnedSPKIHashes,
+		}
+		if uc.CACertFile != "" {
+			pemBytes, err := ioutil.ReadFile(uc.CACertFile)
+			if err != nil {
+				return nil, err
+			}
+			u.RootCAs = x509.NewCertPool()
+			if ok := u.RootCAs.AppendCertsFromPEM(pemBytes); !ok {
+				return nil, fmt.Errorf("no certificates found in %q", uc.CACertFile)
+			}
+		}
+		upstreams = append(upstreams, u)
+	}
+	return upstreams, nil
+}
+
+// newEmailReply builds the mailer and reply inbox for email-reply-00
+// validation from config, and starts receiving replies.
+func newEmailReply(config *cmd.EmailReplyConfig, stats statsd.Statter, logger blog.Logger) (*EmailReply, error) {
+	from, err := netmail.ParseAddress(config.From)
+	if err != nil {
+		return nil, err
+	}
+	password, err := config.PasswordConfig.Pass()
+	if err != nil {
+		return nil, err
+	}
+	secret, err := ioutil.ReadFile(config.SecretFile)
+	if err != nil {
+		return nil, err
+	}
+	secret = []byte(strings.TrimSpace(string(secret)))
+	if len(secret) == 0 {
+		return nil, errors.New("email-reply-00 secret is empty")
+	}
+
+	l, err := net.Listen("tcp", config.ListenAddress)
+	if err != nil {
+		return nil, err
+	}
+	inbox := bmail.NewInbox(config.Hostname, []string{from.Address}, logger)
+	go func() {
+		err := inbox.Serve(l)
+		cmd.FailOnError(err, "Email reply listener failed")
+	}()
+
+	return &EmailReply{
+		Mailer:     bmail.New(config.Server, config.Port, config.Username, password, *from, stats),
+		Inbox:      inbox,
+		Secret:     secret,
+		Timeout:    config.Timeout.Duration,
+		AuthServID: config.AuthServID,
+	}, nil
+}
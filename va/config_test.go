@@ -0,0 +1,47 @@
+package va
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jmhodges/clock"
+
+	"github.com/letsencrypt/boulder/cmd"
+	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/mocks"
+	"github.com/letsencrypt/boulder/test"
+)
+
+func TestNewFromConfig(t *testing.T) {
+	dnsConfig := DNSConfig{Resolver: "127.0.0.1:8053", Timeout: time.Second}
+	c := cmd.VAConfig{
+		PortConfig: cmd.PortConfig{HTTPPort: 5002},
+		ValidationRetries: &cmd.ValidationRetryConfig{
+			MaxAttempts: 2,
+			Backoff:     cmd.ConfigDuration{Duration: time.Second},
+		},
+		HTTPValidation: &cmd.HTTPValidationConfig{
+			MaxRedirects: 3,
+			Whitespace:   "both",
+		},
+	}
+
+	vai, err := NewFromConfig(c, dnsConfig, nil, mocks.NewStatter(), clock.NewFake(), blog.NewMock())
+	test.AssertNotError(t, err, "NewFromConfig failed")
+	test.AssertEquals(t, vai.httpPort, 5002)
+	test.AssertEquals(t, vai.httpsPort, 443)
+	test.AssertEquals(t, vai.tlsPort, 443)
+	test.AssertEquals(t, vai.RetryPolicy.MaxAttempts, 2)
+	test.AssertEquals(t, vai.HTTPPolicy.MaxRedirects, 3)
+	test.AssertEquals(t, vai.HTTPPolicy.Whitespace, TrimBoth)
+	test.Assert(t, vai.EmailReply == nil, "email-reply-00 configured")
+
+	c.HTTPValidation.Whitespace = "some"
+	_, err = NewFromConfig(c, dnsConfig, nil, mocks.NewStatter(), clock.NewFake(), blog.NewMock())
+	test.AssertError(t, err, "accepted unknown whitespace handling")
+
+	c.HTTPValidation = nil
+	c.CAASERVFAILExceptions = "/does/not/exist"
+	_, err = NewFromConfig(c, dnsConfig, nil, mocks.NewStatter(), clock.NewFake(), blog.NewMock())
+	test.AssertError(t, err, "accepted missing CAA SERVFAIL exceptions file")
+}
@@ -0,0 +1,110 @@
+package va
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/letsencrypt/boulder/core"
+)
+
+// fallbackTimeout is how long a dialer waits to connect to a preferred IPv6
+// address before falling back to IPv4. It leaves most of validationTimeout
+// for the fallback connection and the request made over it.
+var fallbackTimeout = validationTimeout / 2
+
+// dialer connects to the address chosen for a single validation request. If
+// that fails and a fallback address is set, it tries the fallback too, and
+// records both attempts in its validation record. Dial may be called from
+// the HTTP transport's goroutines, so record is protected by mu once the
+// dialer is in use.
+type dialer struct {
+	mu       sync.Mutex
+	record   core.ValidationRecord
+	fallback net.IP
+	// deadline is the deadline of the validation the dialer is used for, or
+	// zero if it has none. No connection attempt runs past it.
+	deadline time.Time
+}
+
+// attemptDeadline returns the deadline for a connection attempt starting at
+// now, given the deadline of the whole validation, which is zero if there is
+// none. An attempt with a fallback after it gets at most half the time left,
+// leaving the rest for the fallback.
+func attemptDeadline(now, deadline time.Time, hasFallback bool) time.Time {
+	timeout := validationTimeout
+	if hasFallback {
+		timeout = fallbackTimeout
+	}
+	attempt := now.Add(timeout)
+	if deadline.IsZero() {
+		return attempt
+	}
+	if hasFallback {
+		deadline = now.Add(deadline.Sub(now) / 2)
+	}
+	if deadline.Before(attempt) {
+		return deadline
+	}
+	return attempt
+}
+
+// Dial connects to the dialer's preferred address, or its fallback address if
+// that fails. Both arguments are ignored in favor of the dialer's record.
+func (d *dialer) Dial(_, _ string) (net.Conn, error) {
+	addrs := d.addresses()
+	d.mu.Lock()
+	port := d.record.Port
+	deadline := d.deadline
+	d.mu.Unlock()
+
+	var conn net.Conn
+	var err error
+	var tried []net.IP
+	for i, addr := range addrs {
+		realDialer := net.Dialer{Deadline: attemptDeadline(time.Now(), deadline, i < len(addrs)-1)}
+		conn, err = realDialer.Dial("tcp", net.JoinHostPort(addr.String(), port))
+
+		tried = append(tried, addr)
+		d.mu.Lock()
+		d.record.AddressUsed = addr
+		if len(tried) > 1 {
+			d.record.AddressesTried = tried
+		}
+		d.mu.Unlock()
+		if err == nil {
+			return conn, nil
+		}
+	}
+	return nil, err
+}
+
+// addresses returns every address the dialer may connect to, the preferred
+// one first.
+func (d *dialer) addresses() []net.IP {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	addrs := []net.IP{d.record.AddressUsed}
+	if d.fallback != nil {
+		addrs = append(addrs, d.fallback)
+	}
+	return addrs
+}
+
+// Record returns a copy of the dialer's validation record.
+func (d *dialer) Record() core.ValidationRecord {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.record
+}
+
+// firstAddr returns the first IPv4 address in addrs if v4 is true, and the
+// first IPv6 address otherwise. It returns nil if there is no such address.
+func firstAddr(addrs []net.IP, v4 bool) net.IP {
+	for _, addr := range addrs {
+		if (addr.To4() != nil) == v4 {
+			return addr
+		}
+	}
+	return nil
+}
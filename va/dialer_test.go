@@ -0,0 +1,128 @@
+package va
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/letsencrypt/boulder/bdns"
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/test"
+)
+
+// dualStackResolver resolves every name to an IPv4 and an IPv6 loopback
+// address. Test servers only listen on IPv4, so connections to the IPv6
+// address fail.
+type dualStackResolver struct {
+	bdns.MockDNSResolver
+}
+
+func (dsr *dualStackResolver) LookupHost(_ context.Context, _ string) ([]net.IP, error) {
+	return []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("::1")}, nil
+}
+
+func TestFirstAddr(t *testing.T) {
+	v4, v6 := net.ParseIP("192.0.2.1"), net.ParseIP("2001:db8::1")
+	test.AssertEquals(t, firstAddr([]net.IP{v4, v6}, false).String(), v6.String())
+	test.AssertEquals(t, firstAddr([]net.IP{v4, v6}, true).String(), v4.String())
+	test.Assert(t, firstAddr([]net.IP{v4}, false) == nil, "found IPv6 address")
+}
+
+func TestAttemptDeadline(t *testing.T) {
+	now := time.Now()
+	// Without a validation deadline each attempt gets its own timeout.
+	test.AssertEquals(t, attemptDeadline(now, time.Time{}, true), now.Add(fallbackTimeout))
+	test.AssertEquals(t, attemptDeadline(now, time.Time{}, false), now.Add(validationTimeout))
+
+	// A close validation deadline is split between the preferred address and
+	// the fallback, and caps the last attempt.
+	deadline := now.Add(4 * time.Second)
+	test.AssertEquals(t, attemptDeadline(now, deadline, true), now.Add(2*time.Second))
+	test.AssertEquals(t, attemptDeadline(now, deadline, false), deadline)
+
+	// A distant one changes nothing.
+	deadline = now.Add(time.Hour)
+	test.AssertEquals(t, attemptDeadline(now, deadline, true), now.Add(fallbackTimeout))
+	test.AssertEquals(t, attemptDeadline(now, deadline, false), now.Add(validationTimeout))
+}
+
+func TestDialRespectsDeadline(t *testing.T) {
+	hs := httpSrv(t, expectedToken)
+	defer hs.Close()
+	port, err := getPort(hs)
+	test.AssertNotError(t, err, "failed to get test server port")
+	va, _, _ := setup()
+	va.dnsResolver = &dualStackResolver{}
+
+	// Neither the IPv6 attempt nor the fallback is made once the validation's
+	// deadline has passed.
+	expired, cancel := context.WithDeadline(ctx, time.Now().Add(-time.Second))
+	defer cancel()
+	d, prob := va.resolveAndConstructDialer(expired, "localhost", port)
+	test.Assert(t, prob == nil, "resolveAndConstructDialer failed")
+	_, err = d.Dial("tcp", "")
+	test.AssertError(t, err, "Dial succeeded after the deadline")
+	test.AssertEquals(t, len(d.Record().AddressesTried), 2)
+}
+
+func TestGetAddrPrefersIPv6(t *testing.T) {
+	va, _, _ := setup()
+	va.dnsResolver = &dualStackResolver{}
+	addr, all, prob := va.getAddr(ctx, "localhost")
+	test.Assert(t, prob == nil, "getAddr failed")
+	test.AssertEquals(t, addr.String(), "::1")
+	test.AssertEquals(t, len(all), 2)
+
+	d, prob := va.resolveAndConstructDialer(ctx, "localhost", 80)
+	test.Assert(t, prob == nil, "resolveAndConstructDialer failed")
+	test.AssertEquals(t, d.record.AddressUsed.String(), "::1")
+	test.AssertEquals(t, d.fallback.String(), "127.0.0.1")
+}
+
+func TestHTTPIPv4Fallback(t *testing.T) {
+	hs := httpSrv(t, expectedToken)
+	defer hs.Close()
+	port, err := getPort(hs)
+	test.AssertNotError(t, err, "failed to get test server port")
+	va, _, _ := setup()
+	va.httpPort = port
+	va.dnsResolver = &dualStackResolver{}
+
+	chall := core.HTTPChallenge01()
+	setChallengeToken(&chall, expectedToken)
+	records, prob := va.validateHTTP01(ctx, ident, chall)
+	test.Assert(t, prob == nil, "validation failed")
+	test.AssertEquals(t, len(records), 1)
+	test.AssertEquals(t, records[0].AddressUsed.String(), "127.0.0.1")
+	test.AssertEquals(t, len(records[0].AddressesTried), 2)
+	test.AssertEquals(t, records[0].AddressesTried[0].String(), "::1")
+	test.AssertEquals(t, records[0].AddressesTried[1].String(), "127.0.0.1")
+
+	// Each hop of a redirect falls back separately.
+	setChallengeToken(&chall, pathMoved)
+	records, prob = va.validateHTTP01(ctx, ident, chall)
+	test.Assert(t, prob == nil, "validation failed")
+	test.AssertEquals(t, len(records), 2)
+	for _, record := range records {
+		test.AssertEquals(t, record.AddressUsed.String(), "127.0.0.1")
+		test.AssertEquals(t, len(record.AddressesTried), 2)
+	}
+}
+
+func TestHTTPNoFallbackNeeded(t *testing.T) {
+	hs := httpSrv(t, expectedToken)
+	defer hs.Close()
+	port, err := getPort(hs)
+	test.AssertNotError(t, err, "failed to get test server port")
+	va, _, _ := setup()
+	va.httpPort = port
+
+	chall := core.HTTPChallenge01()
+	setChallengeToken(&chall, expectedToken)
+	records, prob := va.validateHTTP01(ctx, ident, chall)
+	test.Assert(t, prob == nil, "validation failed")
+	test.AssertEquals(t, records[0].AddressUsed.String(), "127.0.0.1")
+	test.Assert(t, records[0].AddressesTried == nil, "recorded addresses tried without a fallback")
+}
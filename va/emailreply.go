@@ -0,0 +1,253 @@
+package va
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/letsencrypt/boulder/core"
+	bmail "github.com/letsencrypt/boulder/mail"
+	"github.com/letsencrypt/boulder/probs"
+)
+
+const (
+	emailReplySubjectPrefix = "ACME: "
+	emailReplyBegin         = "-----BEGIN ACME RESPONSE-----"
+	emailReplyEnd           = "-----END ACME RESPONSE-----"
+
+	// maxReplyBodySize bounds how much of a decoded reply body is searched
+	// for the response.
+	maxReplyBodySize = 64 * 1024
+)
+
+var emailReplyBody = `This is an automatically generated ACME challenge for the email address %s.
+
+If you didn't ask for a certificate for this address, you can ignore this
+message. Otherwise, your ACME client needs to reply to it to complete the
+challenge.
+`
+
+// EmailReply sends the challenge emails for email-reply-00 validation and
+// receives the replies. If a ValidationAuthorityImpl's EmailReply is nil,
+// email-reply-00 challenges fail as unsupported.
+type EmailReply struct {
+	// Mailer sends challenge emails. Its From address must be one that Inbox
+	// receives mail for. It is only used for one message at a time.
+	Mailer bmail.Mailer
+	// Inbox receives the replies to challenge emails.
+	Inbox *bmail.Inbox
+	// Secret keys the derivation of the token part that is only sent by
+	// email, so that it can't be computed from the challenge object.
+	Secret []byte
+	// Timeout bounds how long to wait for a reply. If zero, only the
+	// validation's deadline applies.
+	Timeout time.Duration
+	// AuthServID, if set, is the authserv-id of the Authentication-Results
+	// header that the receiving MTA adds to replies. A reply is then only
+	// accepted if that header shows a DKIM signature from the address's
+	// domain that passed verification.
+	AuthServID string
+
+	mu sync.Mutex
+}
+
+// tokenPart1 derives the first part of the email-reply-00 token, which is
+// sent in the subject of the challenge email.
+func (er *EmailReply) tokenPart1(token string) string {
+	mac := hmac.New(sha256.New, er.Secret)
+	_, _ = mac.Write([]byte(token))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:16])
+}
+
+func (er *EmailReply) send(to, subject, body string) error {
+	er.mu.Lock()
+	defer er.mu.Unlock()
+	if err := er.Mailer.Connect(); err != nil {
+		return err
+	}
+	defer func() {
+		_ = er.Mailer.Close()
+	}()
+	return er.Mailer.SendMail([]string{to}, subject, body)
+}
+
+// isReply returns true if msg is from address and answers the challenge
+// email with the given subject.
+func isReply(msg *bmail.Message, address, subject string) bool {
+	from, err := mail.ParseAddress(msg.Header.Get("From"))
+	if err != nil || !strings.EqualFold(from.Address, address) {
+		return false
+	}
+	return strings.Contains(msg.Header.Get("Subject"), subject)
+}
+
+// replyText returns the decoded text of a reply: the whole body for a
+// single-part message, or the first text/plain part of a multipart one.
+func replyText(header textHeader, body io.Reader) ([]byte, error) {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err == nil && strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := mr.NextPart()
+			if err != nil {
+				return nil, err
+			}
+			partType, _, err := mime.ParseMediaType(part.Header.Get("Content-Type"))
+			if err != nil || partType == "text/plain" {
+				return replyText(part.Header, part)
+			}
+		}
+	}
+
+	switch strings.ToLower(header.Get("Content-Transfer-Encoding")) {
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, &newlineStripper{r: body})
+	}
+	return ioutil.ReadAll(io.LimitReader(body, maxReplyBodySize))
+}
+
+// textHeader is implemented by both mail.Header and textproto.MIMEHeader.
+type textHeader interface {
+	Get(string) string
+}
+
+// newlineStripper removes line breaks from base64 bodies, which
+// base64.NewDecoder doesn't accept.
+type newlineStripper struct {
+	r io.Reader
+}
+
+func (ns *newlineStripper) Read(p []byte) (int, error) {
+	n, err := ns.r.Read(p)
+	out := p[:0]
+	for _, b := range p[:n] {
+		if b != '\r' && b != '\n' {
+			out = append(out, b)
+		}
+	}
+	return len(out), err
+}
+
+// replyResponse extracts the response from between the begin and end lines in
+// a reply's text, with all whitespace removed. It returns "" if there is none.
+func replyResponse(text []byte) string {
+	begin := bytes.Index(text, []byte(emailReplyBegin))
+	if begin < 0 {
+		return ""
+	}
+	text = text[begin+len(emailReplyBegin):]
+	end := bytes.Index(text, []byte(emailReplyEnd))
+	if end < 0 {
+		return ""
+	}
+	// Lines quoted by a mail client may start with ">".
+	text = bytes.Replace(text[:end], []byte(">"), nil, -1)
+	return string(bytes.Join(bytes.Fields(text), nil))
+}
+
+// dkimPassed returns true if header has an Authentication-Results field from
+// authServID that reports a passing DKIM signature from domain.
+func dkimPassed(header mail.Header, authServID, domain string) bool {
+	for _, value := range header["Authentication-Results"] {
+		results := strings.Split(value, ";")
+		id := strings.Fields(results[0])
+		if len(id) == 0 || !strings.EqualFold(id[0], authServID) {
+			continue
+		}
+		for _, result := range results[1:] {
+			fields := strings.Fields(result)
+			if len(fields) == 0 || !strings.EqualFold(fields[0], "dkim=pass") {
+				continue
+			}
+			for _, property := range fields[1:] {
+				if strings.EqualFold(property, "header.d="+domain) ||
+					strings.EqualFold(property, "header.i=@"+domain) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func (va *ValidationAuthorityImpl) validateEmailReply00(ctx context.Context, identifier core.AcmeIdentifier, challenge core.Challenge) ([]core.ValidationRecord, *probs.ProblemDetails) {
+	if identifier.Type != core.IdentifierEmail {
+		va.log.Info(fmt.Sprintf("Identifier type for email-reply-00 challenge was not email: %s", identifier))
+		return nil, probs.Malformed("Identifier type for email-reply-00 was not email")
+	}
+	er := va.EmailReply
+	if er == nil {
+		return nil, probs.Malformed("email-reply-00 challenges are not supported")
+	}
+	address := identifier.Value
+	at := strings.LastIndex(address, "@")
+	if at < 0 {
+		return nil, probs.Malformed("Invalid email address")
+	}
+	domain := address[at+1:]
+	records := []core.ValidationRecord{{
+		URL:      "mailto:" + address,
+		Hostname: domain,
+	}}
+
+	// The key authorization for email-reply-00 is the token part sent by
+	// email followed by the usual key authorization for the challenge token.
+	part1 := er.tokenPart1(challenge.Token)
+	subject := emailReplySubjectPrefix + part1
+	h := sha256.Sum256([]byte(part1 + challenge.ProvidedKeyAuthorization))
+	expected := base64.RawURLEncoding.EncodeToString(h[:])
+
+	// Subscribe before sending so that a fast reply isn't missed.
+	replies, cancel := er.Inbox.Subscribe(func(msg *bmail.Message) bool {
+		return isReply(msg, address, subject)
+	})
+	defer cancel()
+
+	if err := er.send(address, subject, fmt.Sprintf(emailReplyBody, address)); err != nil {
+		va.log.Warning(fmt.Sprintf("Failed to send email-reply-00 challenge to %s: %s", address, err))
+		return records, probs.ServerInternal("Failed to send challenge email")
+	}
+	va.stats.Inc("VA.EmailReply.Sent", 1, 1.0)
+
+	if er.Timeout > 0 {
+		var cancelCtx context.CancelFunc
+		ctx, cancelCtx = context.WithTimeout(ctx, er.Timeout)
+		defer cancelCtx()
+	}
+	var msg *bmail.Message
+	select {
+	case msg = <-replies:
+	case <-ctx.Done():
+		va.stats.Inc("VA.EmailReply.Timeout", 1, 1.0)
+		return records, probs.Unauthorized(fmt.Sprintf("No reply to the challenge email sent to %s", address))
+	}
+
+	if er.AuthServID != "" && !dkimPassed(msg.Header, er.AuthServID, domain) {
+		return records, probs.Unauthorized(fmt.Sprintf("Reply from %s didn't have a valid DKIM signature", address))
+	}
+	text, err := replyText(msg.Header, bytes.NewReader(msg.Body))
+	if err != nil {
+		va.log.Info(fmt.Sprintf("Failed to decode email-reply-00 reply from %s: %s", address, err))
+		return records, probs.Unauthorized(fmt.Sprintf("Couldn't decode reply from %s", address))
+	}
+	if subtle.ConstantTimeCompare([]byte(replyResponse(text)), []byte(expected)) != 1 {
+		return records, probs.Unauthorized(fmt.Sprintf("Correct value not found in reply from %s", address))
+	}
+	return records, nil
+}
@@ -0,0 +1,219 @@
+package va
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/boulder/core"
+	blog "github.com/letsencrypt/boulder/log"
+	bmail "github.com/letsencrypt/boulder/mail"
+	"github.com/letsencrypt/boulder/mocks"
+	"github.com/letsencrypt/boulder/probs"
+	"github.com/letsencrypt/boulder/test"
+)
+
+const (
+	replyAddress = "acme-challenge@ca.example.com"
+	emailAddress = "alice@example.com"
+)
+
+// replyingMailer records challenge emails like mocks.Mailer, and calls reply
+// in the background for each of them.
+type replyingMailer struct {
+	*mocks.Mailer
+	reply func(to, subject string)
+}
+
+func (m *replyingMailer) SendMail(to []string, subject, body string) error {
+	if m.reply != nil {
+		go m.reply(to[0], subject)
+	}
+	return m.Mailer.SendMail(to, subject, body)
+}
+
+// emailReplySetup returns a VA whose EmailReply receives replies on a real
+// Inbox, and a function that sends the given message to that Inbox.
+func emailReplySetup(t *testing.T) (*ValidationAuthorityImpl, *replyingMailer, func(from, msg string), func()) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	test.AssertNotError(t, err, "listen")
+	inbox := bmail.NewInbox("ca.example.com", []string{replyAddress}, blog.NewMock())
+	go func() { _ = inbox.Serve(l) }()
+
+	mailer := &replyingMailer{Mailer: &mocks.Mailer{}}
+	va, _, _ := setup()
+	va.EmailReply = &EmailReply{
+		Mailer:  mailer,
+		Inbox:   inbox,
+		Secret:  []byte("secret"),
+		Timeout: 2 * time.Second,
+	}
+	send := func(from, msg string) {
+		// Replies are sent from the mailer's goroutines, so don't use t.Fatal.
+		if err := smtp.SendMail(l.Addr().String(), nil, from, []string{replyAddress}, []byte(msg)); err != nil {
+			t.Errorf("sending reply: %s", err)
+		}
+	}
+	return va, mailer, send, func() { _ = l.Close() }
+}
+
+// emailResponse returns the response for a challenge email with subject.
+func emailResponse(subject string, chall core.Challenge) string {
+	part1 := strings.TrimPrefix(subject, emailReplySubjectPrefix)
+	h := sha256.Sum256([]byte(part1 + chall.ProvidedKeyAuthorization))
+	return base64.RawURLEncoding.EncodeToString(h[:])
+}
+
+func replyMessage(from, subject, headers, response string) string {
+	return fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: Re: %s\r\n%s\r\n"+
+		"Thanks!\r\n\r\n%s\r\n%s\r\n%s\r\n",
+		from, replyAddress, subject, headers, emailReplyBegin, response, emailReplyEnd)
+}
+
+func TestEmailReply00(t *testing.T) {
+	va, mailer, send, cleanUp := emailReplySetup(t)
+	defer cleanUp()
+
+	chall := core.EmailReplyChallenge00()
+	setChallengeToken(&chall, core.NewToken())
+	mailer.reply = func(to, subject string) {
+		send(to, replyMessage(to, subject, "", emailResponse(subject, chall)))
+	}
+
+	records, err := va.PerformValidation(ctx, emailAddress, chall, core.Authorization{})
+	test.AssertNotError(t, err, "validation failed")
+	test.AssertEquals(t, len(records), 1)
+	test.AssertEquals(t, records[0].URL, "mailto:"+emailAddress)
+	test.AssertEquals(t, records[0].Hostname, "example.com")
+
+	test.AssertEquals(t, len(mailer.Messages), 1)
+	test.AssertEquals(t, mailer.Messages[0].To, emailAddress)
+	subject := mailer.Messages[0].Subject
+	test.Assert(t, strings.HasPrefix(subject, emailReplySubjectPrefix), "subject doesn't carry the token part")
+	test.Assert(t, !strings.Contains(subject, chall.Token), "subject contains the challenge token")
+
+	// The token part sent by email doesn't change between attempts.
+	mailer.Clear()
+	_, err = va.PerformValidation(ctx, emailAddress, chall, core.Authorization{})
+	test.AssertNotError(t, err, "validation failed")
+	test.AssertEquals(t, mailer.Messages[0].Subject, subject)
+}
+
+func TestEmailReply00Failures(t *testing.T) {
+	va, mailer, send, cleanUp := emailReplySetup(t)
+	defer cleanUp()
+	va.EmailReply.Timeout = 200 * time.Millisecond
+
+	chall := core.EmailReplyChallenge00()
+	setChallengeToken(&chall, core.NewToken())
+	ident := core.AcmeIdentifier{Type: core.IdentifierEmail, Value: emailAddress}
+
+	// No reply
+	_, prob := va.validateEmailReply00(ctx, ident, chall)
+	test.AssertEquals(t, prob.Type, probs.UnauthorizedProblem)
+	test.Assert(t, strings.Contains(prob.Detail, "No reply"), "wrong problem detail: "+prob.Detail)
+
+	// Replies from other addresses are ignored.
+	mailer.reply = func(to, subject string) {
+		send("mallory@example.com", replyMessage("mallory@example.com", subject, "", emailResponse(subject, chall)))
+	}
+	_, prob = va.validateEmailReply00(ctx, ident, chall)
+	test.Assert(t, strings.Contains(prob.Detail, "No reply"), "wrong problem detail: "+prob.Detail)
+
+	// Wrong response
+	mailer.reply = func(to, subject string) {
+		send(to, replyMessage(to, subject, "", "wrong"))
+	}
+	_, prob = va.validateEmailReply00(ctx, ident, chall)
+	test.AssertEquals(t, prob.Type, probs.UnauthorizedProblem)
+	test.Assert(t, strings.Contains(prob.Detail, "Correct value not found"), "wrong problem detail: "+prob.Detail)
+
+	// Wrong identifier type
+	_, prob = va.validateEmailReply00(ctx, core.AcmeIdentifier{Type: core.IdentifierDNS, Value: "example.com"}, chall)
+	test.AssertEquals(t, prob.Type, probs.MalformedProblem)
+
+	// Not configured
+	va.EmailReply = nil
+	_, prob = va.validateEmailReply00(ctx, ident, chall)
+	test.AssertEquals(t, prob.Type, probs.MalformedProblem)
+}
+
+func TestEmailReply00DKIM(t *testing.T) {
+	va, mailer, send, cleanUp := emailReplySetup(t)
+	defer cleanUp()
+	va.EmailReply.AuthServID = "mx.ca.example.com"
+	va.EmailReply.Timeout = time.Second
+
+	chall := core.EmailReplyChallenge00()
+	setChallengeToken(&chall, core.NewToken())
+	ident := core.AcmeIdentifier{Type: core.IdentifierEmail, Value: emailAddress}
+
+	headers := ""
+	mailer.reply = func(to, subject string) {
+		send(to, replyMessage(to, subject, headers, emailResponse(subject, chall)))
+	}
+
+	_, prob := va.validateEmailReply00(ctx, ident, chall)
+	test.AssertEquals(t, prob.Type, probs.UnauthorizedProblem)
+	test.Assert(t, strings.Contains(prob.Detail, "DKIM"), "wrong problem detail: "+prob.Detail)
+
+	headers = "Authentication-Results: mx.ca.example.com; dkim=pass header.d=example.com header.s=sel\r\n"
+	_, prob = va.validateEmailReply00(ctx, ident, chall)
+	test.Assert(t, prob == nil, "validation failed")
+}
+
+func TestDKIMPassed(t *testing.T) {
+	testCases := []struct {
+		results []string
+		passed  bool
+	}{
+		{nil, false},
+		{[]string{"mx.ca.example.com; dkim=pass header.d=example.com"}, true},
+		{[]string{"mx.ca.example.com 1; spf=pass smtp.mailfrom=example.com;\r\n dkim=pass header.i=@example.com"}, true},
+		{[]string{"mx.ca.example.com; dkim=fail header.d=example.com"}, false},
+		{[]string{"mx.ca.example.com; dkim=pass header.d=other.example.com"}, false},
+		{[]string{"mx.attacker.com; dkim=pass header.d=example.com"}, false},
+		{[]string{"mx.attacker.com; dkim=fail", "mx.ca.example.com; dkim=pass header.d=Example.com"}, true},
+	}
+	for _, tc := range testCases {
+		header := mail.Header{}
+		if tc.results != nil {
+			header["Authentication-Results"] = tc.results
+		}
+		test.AssertEquals(t, dkimPassed(header, "mx.ca.example.com", "example.com"), tc.passed)
+	}
+}
+
+func TestReplyText(t *testing.T) {
+	response := emailReplyBegin + "\nabc\ndef\n" + emailReplyEnd + "\n"
+	testCases := []struct {
+		name    string
+		message string
+	}{
+		{"plain", "\n" + response},
+		{"quoted", "\n> " + emailReplyBegin + "\n> abc\n> def\n> " + emailReplyEnd + "\n"},
+		{"quoted-printable", "Content-Transfer-Encoding: quoted-printable\n\n" +
+			strings.Replace(response, "-----BEGIN", "-----BEGIN=\n", 1)},
+		{"base64", "Content-Transfer-Encoding: base64\n\n" +
+			base64.StdEncoding.EncodeToString([]byte(response))[:40] + "\n" +
+			base64.StdEncoding.EncodeToString([]byte(response))[40:] + "\n"},
+		{"multipart", "Content-Type: multipart/alternative; boundary=b\n\n" +
+			"--b\nContent-Type: text/html\n\n<p>html</p>\n" +
+			"--b\nContent-Type: text/plain\nContent-Transfer-Encoding: quoted-printable\n\n" + response +
+			"--b--\n"},
+	}
+	for _, tc := range testCases {
+		msg, err := mail.ReadMessage(strings.NewReader("Subject: Re: x\n" + tc.message))
+		test.AssertNotError(t, err, tc.name)
+		text, err := replyText(msg.Header, msg.Body)
+		test.AssertNotError(t, err, tc.name)
+		test.AssertEquals(t, replyResponse(text), "abcdef")
+	}
+	test.AssertEquals(t, replyResponse([]byte(emailReplyBegin+"\nabc\n")), "")
+}
@@ -3,6 +3,8 @@
 package va
 
 import (
+	"fmt"
+
 	safebrowsing "github.com/letsencrypt/go-safe-browsing-api"
 	"golang.org/x/net/context"
 
@@ -10,17 +12,19 @@ import (
 	vaPB "github.com/letsencrypt/boulder/va/proto"
 )
 
-// SafeBrowsing is an interface for an third-party safe browing API client.
+// SafeBrowsing is an interface for a domain reputation source, such as a
+// third-party safe browsing API client or a Blocklist.
 type SafeBrowsing interface {
 	// IsListed returns a non-empty string if the domain was bad. Specifically,
-	// that list is which Google Safe Browsing list the domain was found on.
+	// that string names the list the domain was found on.
 	IsListed(url string) (list string, err error)
 }
 
 // IsSafeDomain returns true if the domain given is determined to be safe by an
 // third-party safe browsing API. It's meant be called by the RA before pending
 // authorization creation. If no third-party client was provided, it fails open
-// and increments a Skips metric.
+// and increments a Skips metric. If the domain is unsafe, the response names
+// the list it was found on.
 func (va *ValidationAuthorityImpl) IsSafeDomain(ctx context.Context, req *vaPB.IsSafeDomainRequest) (*vaPB.IsDomainSafe, error) {
 	if req == nil || req.Domain == nil {
 		return nil, bgrpc.ErrMissingParameters
@@ -46,8 +50,9 @@ func (va *ValidationAuthorityImpl) IsSafeDomain(ctx context.Context, req *vaPB.I
 	status := (list == "")
 	if status {
 		va.stats.Inc("VA.IsSafeDomain.Status.Good", 1, 1.0)
-	} else {
-		va.stats.Inc("VA.IsSafeDomain.Status.Bad", 1, 1.0)
+		return &vaPB.IsDomainSafe{IsSafe: &status}, nil
 	}
-	return &vaPB.IsDomainSafe{IsSafe: &status}, nil
+	va.stats.Inc("VA.IsSafeDomain.Status.Bad", 1, 1.0)
+	va.log.AuditInfo(fmt.Sprintf("IsSafeDomain: %s is listed on %s", *req.Domain, list))
+	return &vaPB.IsDomainSafe{IsSafe: &status, List: &list}, nil
 }
@@ -59,6 +59,9 @@ func TestIsSafeDomain(t *testing.T) {
 	if resp.GetIsSafe() {
 		t.Errorf("bad.com: want false, got %t", resp.GetIsSafe())
 	}
+	if resp.GetList() != "bad" {
+		t.Errorf("bad.com: want list %q, got %q", "bad", resp.GetList())
+	}
 
 	domain = "errorful.com"
 	resp, err = va.IsSafeDomain(ctx, &vaPB.IsSafeDomainRequest{Domain: &domain})
@@ -0,0 +1,129 @@
+package va
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// WhitespaceHandling selects which whitespace is stripped from an http-01
+// challenge response before it is compared with the key authorization.
+type WhitespaceHandling string
+
+const (
+	// TrimTrailing strips trailing whitespace only. It is the default.
+	TrimTrailing = WhitespaceHandling("trailing")
+	// TrimBoth strips leading and trailing whitespace.
+	TrimBoth = WhitespaceHandling("both")
+	// TrimNone requires the response to match exactly.
+	TrimNone = WhitespaceHandling("none")
+)
+
+// HTTPPolicy controls how http-01 validation follows redirects and reads the
+// challenge response. The zero value of each field keeps the VA's historical
+// behavior.
+type HTTPPolicy struct {
+	// MaxRedirects is the number of requests, counting the initial one, that
+	// a validation may make; a redirect that would need another request fails
+	// validation. Zero means the default of 10.
+	MaxRedirects int
+	// RedirectPorts, if not empty, are the only ports a redirect may target.
+	RedirectPorts []int
+	// RedirectSchemes, if not empty, are the only URL schemes a redirect may
+	// use. Schemes other than http and https are never followed.
+	RedirectSchemes []string
+	// RejectIPRedirects refuses redirects to URLs whose host is an IP
+	// address literal.
+	RejectIPRedirects bool
+	// RejectReservedRedirects refuses redirects to hosts that resolve to a
+	// private or otherwise reserved address.
+	RejectReservedRedirects bool
+	// MaxBodySize is the size in bytes at which a challenge response is
+	// rejected. Zero means the default of 128.
+	MaxBodySize int64
+	// Whitespace selects the whitespace stripped from the response. Empty
+	// means TrimTrailing.
+	Whitespace WhitespaceHandling
+}
+
+// redirectError is returned from the redirect checker when a redirect is
+// refused by policy, so that fetchHTTP can report the reason.
+type redirectError string
+
+func (e redirectError) Error() string {
+	return string(e)
+}
+
+// refusedRedirect returns the redirectError wrapped in err, if any.
+func refusedRedirect(err error) (redirectError, bool) {
+	if urlErr, ok := err.(*url.Error); ok {
+		err = urlErr.Err
+	}
+	redirectErr, ok := err.(redirectError)
+	return redirectErr, ok
+}
+
+func (p HTTPPolicy) maxRedirects() int {
+	if p.MaxRedirects > 0 {
+		return p.MaxRedirects
+	}
+	return maxRedirect
+}
+
+func (p HTTPPolicy) maxBodySize() int64 {
+	if p.MaxBodySize > 0 {
+		return p.MaxBodySize
+	}
+	return maxResponseSize
+}
+
+// trim strips whitespace from body according to p.Whitespace.
+func (p HTTPPolicy) trim(body string) string {
+	switch p.Whitespace {
+	case TrimNone:
+		return body
+	case TrimBoth:
+		return strings.Trim(body, whitespaceCutset)
+	default:
+		return strings.TrimRight(body, whitespaceCutset)
+	}
+}
+
+// checkRedirectURL returns a redirectError if p doesn't allow a redirect to
+// u, which targets port.
+func (p HTTPPolicy) checkRedirectURL(u *url.URL, port int) error {
+	scheme := strings.ToLower(u.Scheme)
+	if len(p.RedirectSchemes) > 0 && !containsFold(p.RedirectSchemes, scheme) {
+		return redirectError(fmt.Sprintf("redirect to disallowed scheme %q", scheme))
+	}
+	if len(p.RedirectPorts) > 0 {
+		allowed := false
+		for _, allowedPort := range p.RedirectPorts {
+			if port == allowedPort {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return redirectError(fmt.Sprintf("redirect to disallowed port %d", port))
+		}
+	}
+	host := u.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if p.RejectIPRedirects && net.ParseIP(strings.Trim(host, "[]")) != nil {
+		return redirectError(fmt.Sprintf("redirect to IP address %s", host))
+	}
+	return nil
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
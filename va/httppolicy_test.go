@@ -0,0 +1,172 @@
+package va
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/letsencrypt/boulder/bdns"
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/probs"
+	"github.com/letsencrypt/boulder/test"
+)
+
+func TestHTTPPolicyTrim(t *testing.T) {
+	body := " \tbody\n\r "
+	test.AssertEquals(t, HTTPPolicy{}.trim(body), " \tbody")
+	test.AssertEquals(t, HTTPPolicy{Whitespace: TrimTrailing}.trim(body), " \tbody")
+	test.AssertEquals(t, HTTPPolicy{Whitespace: TrimBoth}.trim(body), "body")
+	test.AssertEquals(t, HTTPPolicy{Whitespace: TrimNone}.trim(body), body)
+}
+
+func TestHTTPPolicyRedirects(t *testing.T) {
+	hs := httpSrv(t, expectedToken)
+	defer hs.Close()
+	port, err := getPort(hs)
+	test.AssertNotError(t, err, "failed to get test server port")
+
+	testCases := []struct {
+		name    string
+		policy  HTTPPolicy
+		token   string
+		hops    int
+		problem string
+	}{
+		{
+			name:  "default policy",
+			token: pathReLookup,
+			hops:  2,
+		},
+		{
+			name:    "too many redirects",
+			policy:  HTTPPolicy{MaxRedirects: 1},
+			token:   pathFound,
+			hops:    2,
+			problem: "Too many redirects",
+		},
+		{
+			// pathFound redirects twice, which makes as many requests as
+			// MaxRedirects before the last redirect.
+			name:    "exactly MaxRedirects hops",
+			policy:  HTTPPolicy{MaxRedirects: 2},
+			token:   pathFound,
+			hops:    3,
+			problem: "Too many redirects",
+		},
+		{
+			name:   "fewer than MaxRedirects hops",
+			policy: HTTPPolicy{MaxRedirects: 3},
+			token:  pathFound,
+			hops:   3,
+		},
+		{
+			name:    "disallowed port",
+			policy:  HTTPPolicy{RedirectPorts: []int{80, 443}},
+			token:   pathReLookup,
+			hops:    2,
+			problem: "disallowed port",
+		},
+		{
+			name:    "disallowed scheme",
+			policy:  HTTPPolicy{RedirectSchemes: []string{"https"}},
+			token:   pathReLookup,
+			hops:    2,
+			problem: `disallowed scheme "http"`,
+		},
+		{
+			name:    "IP literal",
+			policy:  HTTPPolicy{RejectIPRedirects: true},
+			token:   pathRedirectIP,
+			hops:    2,
+			problem: "redirect to IP address 127.0.0.1",
+		},
+		{
+			name:    "reserved address",
+			policy:  HTTPPolicy{RejectReservedRedirects: true},
+			token:   pathReLookup,
+			hops:    2,
+			problem: "resolves to reserved address 127.0.0.1",
+		},
+	}
+	for _, tc := range testCases {
+		va, _, _ := setup()
+		va.httpPort = port
+		va.HTTPPolicy = tc.policy
+
+		chall := core.HTTPChallenge01()
+		setChallengeToken(&chall, tc.token)
+		records, prob := va.validateHTTP01(ctx, ident, chall)
+		if tc.problem == "" {
+			test.Assert(t, prob == nil, tc.name)
+		} else {
+			test.Assert(t, prob != nil, tc.name)
+			test.AssertEquals(t, prob.Type, probs.UnauthorizedProblem)
+			test.Assert(t, strings.Contains(prob.Detail, tc.problem), prob.Detail)
+		}
+		// Every hop, including a refused one, has its own record.
+		test.AssertEquals(t, len(records), tc.hops)
+		test.Assert(t, records[len(records)-1].URL != records[0].URL, tc.name)
+	}
+}
+
+// publicV6Resolver resolves the validated name to the IPv4 loopback address,
+// and every other name to a public IPv6 address, which is preferred, and the
+// IPv4 loopback address to fall back to.
+type publicV6Resolver struct {
+	bdns.MockDNSResolver
+}
+
+func (r *publicV6Resolver) LookupHost(_ context.Context, hostname string) ([]net.IP, error) {
+	if hostname == ident.Value {
+		return []net.IP{net.ParseIP("127.0.0.1")}, nil
+	}
+	return []net.IP{net.ParseIP("2606:4700::1"), net.ParseIP("127.0.0.1")}, nil
+}
+
+func TestHTTPPolicyReservedFallback(t *testing.T) {
+	hs := httpSrv(t, expectedToken)
+	defer hs.Close()
+	port, err := getPort(hs)
+	test.AssertNotError(t, err, "failed to get test server port")
+	va, _, _ := setup()
+	va.httpPort = port
+	va.dnsResolver = &publicV6Resolver{}
+	va.HTTPPolicy = HTTPPolicy{RejectReservedRedirects: true}
+
+	// The redirect target's preferred address is public, but the dialer
+	// could fall back to a reserved one
+	chall := core.HTTPChallenge01()
+	setChallengeToken(&chall, pathReLookup)
+	records, prob := va.validateHTTP01(ctx, ident, chall)
+	test.Assert(t, prob != nil, "redirect with a reserved fallback address was followed")
+	test.AssertEquals(t, prob.Type, probs.UnauthorizedProblem)
+	test.Assert(t, strings.Contains(prob.Detail, "resolves to reserved address 127.0.0.1"), prob.Detail)
+	test.AssertEquals(t, len(records), 2)
+	test.AssertEquals(t, records[1].AddressUsed.String(), "2606:4700::1")
+}
+
+func TestHTTPPolicyBody(t *testing.T) {
+	hs := httpSrv(t, expectedToken)
+	defer hs.Close()
+	port, err := getPort(hs)
+	test.AssertNotError(t, err, "failed to get test server port")
+	va, _, _ := setup()
+	va.httpPort = port
+	chall := core.HTTPChallenge01()
+	setChallengeToken(&chall, expectedToken)
+
+	va.HTTPPolicy = HTTPPolicy{MaxBodySize: 64}
+	_, prob := va.validateHTTP01(ctx, ident, chall)
+	test.Assert(t, prob != nil, "oversized response was accepted")
+
+	// The test server pads its responses with whitespace.
+	va.HTTPPolicy = HTTPPolicy{Whitespace: TrimNone}
+	_, prob = va.validateHTTP01(ctx, ident, chall)
+	test.Assert(t, prob != nil, "response with whitespace was accepted")
+
+	va.HTTPPolicy = HTTPPolicy{Whitespace: TrimBoth, MaxBodySize: 256}
+	_, prob = va.validateHTTP01(ctx, ident, chall)
+	test.Assert(t, prob == nil, "valid response was rejected")
+}
@@ -56,8 +56,9 @@ func (m *IsSafeDomainRequest) GetDomain() string {
 }
 
 type IsDomainSafe struct {
-	IsSafe           *bool  `protobuf:"varint,1,opt,name=isSafe" json:"isSafe,omitempty"`
-	XXX_unrecognized []byte `json:"-"`
+	IsSafe           *bool   `protobuf:"varint,1,opt,name=isSafe" json:"isSafe,omitempty"`
+	List             *string `protobuf:"bytes,2,opt,name=list" json:"list,omitempty"`
+	XXX_unrecognized []byte  `json:"-"`
 }
 
 func (m *IsDomainSafe) Reset()                    { *m = IsDomainSafe{} }
@@ -72,6 +73,13 @@ func (m *IsDomainSafe) GetIsSafe() bool {
 	return false
 }
 
+func (m *IsDomainSafe) GetList() string {
+	if m != nil && m.List != nil {
+		return *m.List
+	}
+	return ""
+}
+
 type PerformValidationRequest struct {
 	Domain           *string         `protobuf:"bytes,1,opt,name=domain" json:"domain,omitempty"`
 	Challenge        *core.Challenge `protobuf:"bytes,2,opt,name=challenge" json:"challenge,omitempty"`
@@ -271,25 +279,25 @@ var _VA_serviceDesc = grpc.ServiceDesc{
 func init() { proto1.RegisterFile("va/proto/va.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 311 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0x74, 0x91, 0x4f, 0x4f, 0xc2, 0x30,
-	0x18, 0xc6, 0x61, 0x04, 0x81, 0x57, 0x51, 0xa8, 0xa8, 0x0b, 0x21, 0xc6, 0x34, 0x11, 0x3d, 0x8d,
-	0x84, 0xab, 0x27, 0x74, 0x97, 0x1d, 0x4c, 0x88, 0x26, 0x1c, 0xbc, 0xd5, 0xad, 0x40, 0x93, 0x8e,
-	0x6a, 0xdb, 0xed, 0xe0, 0x67, 0xf0, 0x43, 0xdb, 0x3f, 0x53, 0x88, 0xca, 0xad, 0x7b, 0x7e, 0x4f,
-	0xdf, 0xf7, 0xe9, 0x33, 0xe8, 0x97, 0x64, 0xf2, 0x26, 0x85, 0x16, 0x93, 0x92, 0x44, 0xee, 0x80,
-	0x82, 0x92, 0x0c, 0xcf, 0x52, 0x21, 0x69, 0x05, 0xec, 0xd1, 0x23, 0x7c, 0x0d, 0xa7, 0x89, 0x7a,
-	0x26, 0x4b, 0x1a, 0x8b, 0x9c, 0xb0, 0xcd, 0x13, 0x7d, 0x2f, 0xa8, 0xd2, 0xe8, 0x18, 0x0e, 0x32,
-	0x27, 0x84, 0xf5, 0xab, 0xfa, 0x6d, 0x07, 0x5f, 0xc2, 0x51, 0xa2, 0xbc, 0xc5, 0x9a, 0x2d, 0x67,
-	0xee, 0x9a, 0xe3, 0x6d, 0xcc, 0x21, 0x9c, 0x53, 0xb9, 0x14, 0x32, 0x5f, 0x10, 0xce, 0x32, 0xa2,
-	0x99, 0xd8, 0x37, 0x0b, 0x61, 0xe8, 0xa4, 0x6b, 0xc2, 0x39, 0xdd, 0xac, 0x68, 0x18, 0x18, 0xe9,
-	0x70, 0x7a, 0x12, 0xb9, 0x48, 0x0f, 0xdf, 0x32, 0x1a, 0x41, 0x93, 0x14, 0x7a, 0xfd, 0x11, 0x36,
-	0x1c, 0xef, 0x46, 0xe6, 0x2d, 0x33, 0x2b, 0x3c, 0x52, 0x4d, 0xf0, 0x18, 0x3a, 0x3f, 0x1f, 0x08,
-	0x20, 0x60, 0x59, 0x35, 0xba, 0x0b, 0x4d, 0x49, 0x57, 0x49, 0xec, 0xc6, 0x36, 0x70, 0x0a, 0xbd,
-	0xdd, 0x38, 0xaa, 0xe0, 0x1a, 0xdd, 0x40, 0x4b, 0x52, 0xb3, 0x2d, 0x53, 0xe6, 0x4e, 0xc3, 0xcc,
-	0x3e, 0xf7, 0xbb, 0x77, 0x8d, 0x16, 0xa3, 0x31, 0xb4, 0x4d, 0x45, 0xaf, 0x9c, 0xe6, 0xaa, 0x4a,
-	0x39, 0xf0, 0xce, 0xb9, 0x57, 0x63, 0xb3, 0x9c, 0x71, 0x35, 0xfd, 0xac, 0x43, 0xb0, 0x98, 0xa1,
-	0x3b, 0xdb, 0xd0, 0xb6, 0x48, 0x74, 0x61, 0x23, 0xff, 0x53, 0xed, 0xb0, 0xe7, 0xc1, 0xb6, 0x4c,
-	0x5c, 0x43, 0x09, 0xf4, 0xff, 0xd4, 0x87, 0x46, 0xd6, 0xb8, 0xaf, 0xd5, 0xe1, 0xc0, 0xd2, 0xdf,
-	0xaf, 0xc3, 0xb5, 0xfb, 0xd6, 0x4b, 0xd3, 0xfd, 0xd9, 0xaf, 0x00, 0x00, 0x00, 0xff, 0xff, 0x7d,
-	0xf6, 0x5c, 0x13, 0x08, 0x02, 0x00, 0x00,
+	// 316 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0x74, 0x91, 0xc1, 0x4f, 0xc2, 0x30,
+	0x14, 0xc6, 0xd9, 0x10, 0x81, 0x07, 0x28, 0x54, 0xd4, 0x85, 0x70, 0x20, 0x4d, 0x44, 0x0e, 0x66,
+	0x24, 0x5c, 0x3d, 0xa1, 0x5c, 0x76, 0x30, 0x21, 0x9a, 0x70, 0xf0, 0x56, 0xb7, 0x07, 0x34, 0x29,
+	0x14, 0xdb, 0xb2, 0x83, 0x7f, 0x83, 0x7f, 0xb4, 0x69, 0x8b, 0x42, 0x54, 0x6e, 0x6f, 0xdf, 0xef,
+	0x7b, 0x6f, 0xdf, 0xbe, 0x41, 0x2b, 0x67, 0xc3, 0x8d, 0x92, 0x46, 0x0e, 0x73, 0x16, 0xbb, 0x81,
+	0x84, 0x39, 0xeb, 0x5c, 0xa6, 0x52, 0xe1, 0x0e, 0xd8, 0xd1, 0x23, 0x7a, 0x03, 0x17, 0x89, 0x7e,
+	0x61, 0x73, 0x9c, 0xc8, 0x15, 0xe3, 0xeb, 0x67, 0x7c, 0xdf, 0xa2, 0x36, 0xe4, 0x0c, 0x4e, 0x33,
+	0x27, 0x44, 0x41, 0x2f, 0x18, 0x54, 0xe9, 0x1d, 0xd4, 0x13, 0xed, 0x2d, 0xd6, 0x6c, 0x39, 0x77,
+	0x6b, 0x8e, 0x57, 0x48, 0x1d, 0x4e, 0x04, 0xd7, 0x26, 0x0a, 0x9d, 0x5b, 0x40, 0x34, 0x45, 0x35,
+	0x97, 0x6a, 0x35, 0x63, 0x82, 0x67, 0xcc, 0x70, 0x79, 0xec, 0x32, 0xa1, 0x50, 0x4d, 0x97, 0x4c,
+	0x08, 0x5c, 0x2f, 0xd0, 0xad, 0xd7, 0x46, 0xe7, 0xb1, 0x0b, 0xf8, 0xf8, 0x2d, 0x93, 0x2e, 0x94,
+	0xd8, 0xd6, 0x2c, 0x3f, 0xa2, 0xa2, 0xe3, 0x8d, 0x38, 0x67, 0xf1, 0xd8, 0x0a, 0x4f, 0x68, 0x18,
+	0xed, 0x43, 0xf5, 0xe7, 0x81, 0x00, 0x84, 0x3c, 0xdb, 0x9d, 0x6e, 0x40, 0x49, 0xe1, 0x22, 0x99,
+	0xb8, 0xb3, 0x45, 0x9a, 0x42, 0xf3, 0x30, 0x8e, 0xde, 0x0a, 0x43, 0x6e, 0xa1, 0xac, 0x30, 0x95,
+	0x2a, 0xd3, 0x51, 0xd0, 0x2b, 0x0e, 0x6a, 0xa3, 0x2b, 0xff, 0xee, 0x43, 0xa3, 0xc5, 0xa4, 0x0f,
+	0x95, 0x8d, 0x92, 0x6f, 0x02, 0x57, 0x7a, 0x97, 0xb2, 0xed, 0x9d, 0x53, 0xaf, 0x4e, 0xd0, 0x30,
+	0x2e, 0xf4, 0xe8, 0x33, 0x80, 0x70, 0x36, 0x26, 0xf7, 0xb6, 0xaf, 0x7d, 0xad, 0xe4, 0xda, 0x46,
+	0xfe, 0xa7, 0xe8, 0x4e, 0xd3, 0x83, 0x7d, 0xb5, 0xb4, 0x40, 0x12, 0x68, 0xfd, 0xa9, 0x8f, 0x74,
+	0xad, 0xf1, 0x58, 0xab, 0x9d, 0xb6, 0xa5, 0xbf, 0xbf, 0x8e, 0x16, 0x1e, 0xca, 0xaf, 0x25, 0xf7,
+	0x9f, 0xbf, 0x06, 0x00, 0xa4, 0x6c, 0xb3, 0xde, 0x16, 0x02, 0x00, 0x00,
 }
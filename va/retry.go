@@ -0,0 +1,169 @@
+package va
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/letsencrypt/boulder/bdns"
+	"github.com/letsencrypt/boulder/caa"
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/probs"
+)
+
+// retryBackoffFactor is the factor by which the delay between successive
+// validation attempts grows.
+const retryBackoffFactor = 2
+
+// RetryPolicy controls how validations that fail with transient network
+// errors are retried.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts made, including the first.
+	// Values below 2 disable retries.
+	MaxAttempts int
+	// Backoff is the delay before the first retry. Later retries wait
+	// exponentially longer, up to MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+type attemptKey struct{}
+
+// attempt holds facts about a single validation attempt that can't be
+// recovered from the problem it produces.
+type attempt struct {
+	transient bool
+}
+
+// noteError classifies an error encountered during the validation attempt
+// carried by ctx, if any. It must be called wherever an error from the network
+// is turned into a problem.
+func noteError(ctx context.Context, err error) {
+	if a, ok := ctx.Value(attemptKey{}).(*attempt); ok && isTransient(err) {
+		a.transient = true
+	}
+}
+
+// isTransient returns true for errors that a later attempt might not
+// encounter: DNS timeouts and SERVFAILs, and connections that time out, are
+// refused or are reset.
+func isTransient(err error) bool {
+	if urlErr, ok := err.(*url.Error); ok {
+		err = urlErr.Err
+	}
+	switch e := err.(type) {
+	case *bdns.DNSError:
+		return e.Temporary()
+	case bdns.DNSError:
+		return e.Temporary()
+	case *net.OpError:
+		if e.Timeout() {
+			return true
+		}
+		inner := e.Err
+		if sysErr, ok := inner.(*os.SyscallError); ok {
+			inner = sysErr.Err
+		}
+		return inner == syscall.ECONNREFUSED || inner == syscall.ECONNRESET
+	case net.Error:
+		return e.Timeout()
+	}
+	return false
+}
+
+// withRetries calls op, retrying according to va.RetryPolicy for as long as
+// attempts fail with transient errors and there is time left before ctx's
+// deadline. It returns the problem from the last attempt. Retries are counted
+// in stats under statPrefix, and described in the log by desc.
+func (va *ValidationAuthorityImpl) withRetries(ctx context.Context, statPrefix, desc string, op func(context.Context) *probs.ProblemDetails) *probs.ProblemDetails {
+	for i := 1; ; i++ {
+		a := &attempt{}
+		prob := op(context.WithValue(ctx, attemptKey{}, a))
+		if prob == nil || !a.transient || i >= va.RetryPolicy.MaxAttempts {
+			return prob
+		}
+
+		backoff := core.RetryBackoff(i, va.RetryPolicy.Backoff, va.RetryPolicy.MaxBackoff, retryBackoffFactor)
+		if deadline, ok := ctx.Deadline(); ok && !va.clk.Now().Add(backoff).Before(deadline) {
+			va.stats.Inc(statPrefix+".RetriesAbandoned", 1, 1.0)
+			return prob
+		}
+		va.log.Info(fmt.Sprintf("%s attempt %d failed with transient error, retrying in %s: %s",
+			desc, i, backoff, prob))
+		va.stats.Inc(statPrefix+".Retries", 1, 1.0)
+		if !va.sleep(ctx, backoff) {
+			va.stats.Inc(statPrefix+".RetriesAbandoned", 1, 1.0)
+			return prob
+		}
+	}
+}
+
+// sleep waits for d to pass on va.clk, and returns false if ctx is done
+// first.
+func (va *ValidationAuthorityImpl) sleep(ctx context.Context, d time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		va.clk.Sleep(d)
+		close(done)
+	}()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-done:
+		return true
+	}
+}
+
+// validateChallengeWithRetries calls validateChallenge with retries, as
+// described by withRetries. The records of earlier attempts are attached to
+// the first record of the last one.
+func (va *ValidationAuthorityImpl) validateChallengeWithRetries(ctx context.Context, identifier core.AcmeIdentifier, challenge core.Challenge) ([]core.ValidationRecord, *probs.ProblemDetails) {
+	var records []core.ValidationRecord
+	var previous []core.ValidationAttempt
+	var last *core.ValidationAttempt
+	desc := fmt.Sprintf("%s [%s]", challenge.Type, identifier)
+	prob := va.withRetries(ctx, "VA.Validations", desc, func(ctx context.Context) *probs.ProblemDetails {
+		if last != nil {
+			previous = append(previous, *last)
+		}
+		start := va.clk.Now()
+		var prob *probs.ProblemDetails
+		records, prob = va.validateChallenge(ctx, identifier, challenge)
+		last = &core.ValidationAttempt{
+			Time:    start,
+			Records: records,
+			Error:   prob,
+		}
+		return prob
+	})
+	return attachAttempts(identifier, records, previous), prob
+}
+
+// checkCAAWithRetries calls checkCAA with retries, as described by
+// withRetries.
+func (va *ValidationAuthorityImpl) checkCAAWithRetries(ctx context.Context, identifier core.AcmeIdentifier) (*caa.Result, *probs.ProblemDetails) {
+	var result *caa.Result
+	desc := fmt.Sprintf("CAA check [%s]", identifier)
+	prob := va.withRetries(ctx, "VA.CAA", desc, func(ctx context.Context) *probs.ProblemDetails {
+		var prob *probs.ProblemDetails
+		result, prob = va.checkCAA(ctx, identifier)
+		return prob
+	})
+	return result, prob
+}
+
+func attachAttempts(identifier core.AcmeIdentifier, records []core.ValidationRecord, previous []core.ValidationAttempt) []core.ValidationRecord {
+	if len(previous) == 0 {
+		return records
+	}
+	if len(records) == 0 {
+		records = []core.ValidationRecord{{Hostname: identifier.Value}}
+	}
+	records[0].PreviousAttempts = previous
+	return records
+}
@@ -0,0 +1,200 @@
+package va
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/jmhodges/clock"
+	"github.com/miekg/dns"
+	"golang.org/x/net/context"
+
+	"github.com/letsencrypt/boulder/bdns"
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/probs"
+	"github.com/letsencrypt/boulder/test"
+)
+
+// flakyResolver fails the first failures TXT lookups with err, and answers
+// the rest as the mock resolver does.
+type flakyResolver struct {
+	bdns.MockDNSResolver
+	sync.Mutex
+	failures int
+	err      error
+	lookups  int
+}
+
+func (fr *flakyResolver) LookupTXT(ctx context.Context, hostname string) ([]string, []string, error) {
+	fr.Lock()
+	defer fr.Unlock()
+	fr.lookups++
+	if fr.lookups <= fr.failures {
+		return nil, nil, fr.err
+	}
+	return fr.MockDNSResolver.LookupTXT(ctx, hostname)
+}
+
+// flakyCAAResolver fails the first failures CAA lookups of name with err, and
+// answers the rest as the mock resolver does.
+type flakyCAAResolver struct {
+	bdns.MockDNSResolver
+	sync.Mutex
+	name     string
+	failures int
+	err      error
+	lookups  int
+}
+
+func (fr *flakyCAAResolver) LookupCAA(ctx context.Context, hostname string) ([]*dns.CAA, []dns.RR, error) {
+	fr.Lock()
+	defer fr.Unlock()
+	if hostname != fr.name {
+		return fr.MockDNSResolver.LookupCAA(ctx, hostname)
+	}
+	fr.lookups++
+	if fr.lookups <= fr.failures {
+		return nil, nil, fr.err
+	}
+	return fr.MockDNSResolver.LookupCAA(ctx, hostname)
+}
+
+func retryTestVA(resolver bdns.DNSResolver, clk clock.Clock) *ValidationAuthorityImpl {
+	va, _, _ := setup()
+	va.dnsResolver = resolver
+	va.clk = clk
+	va.RetryPolicy = RetryPolicy{
+		MaxAttempts: 3,
+		Backoff:     time.Second,
+		MaxBackoff:  10 * time.Second,
+	}
+	return va
+}
+
+func goodDNS01() core.Challenge {
+	chall := core.DNSChallenge01()
+	chall.Token = expectedToken
+	chall.ProvidedKeyAuthorization = expectedKeyAuthorization
+	return chall
+}
+
+func TestIsTransient(t *testing.T) {
+	testCases := []struct {
+		err      error
+		expected bool
+	}{
+		{bdns.MockTimeoutError(), true},
+		{&url.Error{Op: "Get", URL: "http://example.com", Err: bdns.MockTimeoutError()}, true},
+		{&net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}, true},
+		{&net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ECONNRESET)}, true},
+		{&net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.EHOSTUNREACH)}, false},
+		{errors.New("Too many redirects"), false},
+	}
+	for _, tc := range testCases {
+		test.AssertEquals(t, isTransient(tc.err), tc.expected)
+	}
+}
+
+func TestValidationRetrySucceeds(t *testing.T) {
+	clk := clock.NewFake()
+	resolver := &flakyResolver{failures: 2, err: bdns.MockTimeoutError()}
+	va := retryTestVA(resolver, clk)
+
+	start := clk.Now()
+	records, prob := va.PerformValidation(ctx, "good-dns01.com", goodDNS01(), core.Authorization{})
+	test.Assert(t, prob == nil, "validation failed")
+	test.AssertEquals(t, resolver.lookups, 3)
+	test.Assert(t, clk.Now().Sub(start) >= time.Second, "didn't back off between attempts")
+
+	test.AssertEquals(t, len(records), 1)
+	test.AssertEquals(t, len(records[0].PreviousAttempts), 2)
+	for _, attempt := range records[0].PreviousAttempts {
+		test.Assert(t, attempt.Error != nil, "failed attempt has no error")
+	}
+}
+
+func TestValidationRetryExhausted(t *testing.T) {
+	resolver := &flakyResolver{failures: 10, err: bdns.MockTimeoutError()}
+	va := retryTestVA(resolver, clock.NewFake())
+
+	records, prob := va.PerformValidation(ctx, "good-dns01.com", goodDNS01(), core.Authorization{})
+	test.Assert(t, prob != nil, "validation succeeded")
+	test.AssertEquals(t, resolver.lookups, 3)
+	test.AssertEquals(t, len(records), 1)
+	test.AssertEquals(t, records[0].Hostname, "good-dns01.com")
+	test.AssertEquals(t, len(records[0].PreviousAttempts), 2)
+}
+
+func TestValidationNoRetry(t *testing.T) {
+	// Errors that aren't transient aren't retried.
+	resolver := &flakyResolver{failures: 1, err: errors.New("something permanent")}
+	va := retryTestVA(resolver, clock.NewFake())
+	records, prob := va.PerformValidation(ctx, "good-dns01.com", goodDNS01(), core.Authorization{})
+	test.Assert(t, prob != nil, "validation succeeded")
+	test.AssertEquals(t, resolver.lookups, 1)
+	test.AssertEquals(t, len(records), 0)
+
+	// Neither are any errors when retries are disabled.
+	resolver = &flakyResolver{failures: 1, err: bdns.MockTimeoutError()}
+	va = retryTestVA(resolver, clock.NewFake())
+	va.RetryPolicy = RetryPolicy{}
+	_, prob = va.PerformValidation(ctx, "good-dns01.com", goodDNS01(), core.Authorization{})
+	test.Assert(t, prob != nil, "validation succeeded")
+	test.AssertEquals(t, resolver.lookups, 1)
+
+	// Nor is a failure when backing off would run past the deadline.
+	resolver = &flakyResolver{failures: 1, err: bdns.MockTimeoutError()}
+	va = retryTestVA(resolver, clock.Default())
+	va.RetryPolicy.Backoff = time.Hour
+	va.RetryPolicy.MaxBackoff = time.Hour
+	deadlineCtx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	_, prob = va.PerformValidation(deadlineCtx, "good-dns01.com", goodDNS01(), core.Authorization{})
+	test.Assert(t, prob != nil, "validation succeeded")
+	test.AssertEquals(t, resolver.lookups, 1)
+}
+
+func TestValidationRetryCancelled(t *testing.T) {
+	// Cancelling the request stops the wait for the next attempt.
+	resolver := &flakyResolver{failures: 10, err: bdns.MockTimeoutError()}
+	va := retryTestVA(resolver, clock.Default())
+	va.RetryPolicy.Backoff = time.Hour
+	va.RetryPolicy.MaxBackoff = time.Hour
+	cancelCtx, cancel := context.WithCancel(ctx)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	done := make(chan *probs.ProblemDetails, 1)
+	go func() {
+		_, prob := va.validateChallengeWithRetries(cancelCtx, core.AcmeIdentifier{Type: core.IdentifierDNS, Value: "good-dns01.com"}, goodDNS01())
+		done <- prob
+	}()
+	select {
+	case prob := <-done:
+		test.Assert(t, prob != nil, "validation succeeded")
+	case <-time.After(5 * time.Second):
+		t.Fatal("validation didn't stop when its context was cancelled")
+	}
+	test.AssertEquals(t, resolver.lookups, 1)
+}
+
+func TestCAARetry(t *testing.T) {
+	resolver := &flakyCAAResolver{name: "good-dns01.com", failures: 2, err: bdns.MockTimeoutError()}
+	va := retryTestVA(resolver, clock.NewFake())
+	_, prob := va.PerformValidation(ctx, "good-dns01.com", goodDNS01(), core.Authorization{})
+	test.Assert(t, prob == nil, "validation failed")
+	test.AssertEquals(t, resolver.lookups, 3)
+
+	// A CAA check that keeps failing fails the validation.
+	resolver = &flakyCAAResolver{name: "good-dns01.com", failures: 10, err: bdns.MockTimeoutError()}
+	va = retryTestVA(resolver, clock.NewFake())
+	_, prob = va.PerformValidation(ctx, "good-dns01.com", goodDNS01(), core.Authorization{})
+	test.Assert(t, prob != nil, "validation succeeded")
+	test.AssertEquals(t, resolver.lookups, 3)
+}
@@ -0,0 +1,93 @@
+package va
+
+import (
+	"fmt"
+	"sync"
+
+	safebrowsing "github.com/letsencrypt/go-safe-browsing-api"
+
+	"github.com/letsencrypt/boulder/metrics"
+)
+
+// SafeBrowsingSource is a named SafeBrowsing client used by a
+// CompositeSafeBrowsing.
+type SafeBrowsingSource struct {
+	Name   string
+	Client SafeBrowsing
+	// FailClosed determines what happens when Client returns an error. If
+	// true the error is returned, which makes IsSafeDomain fail. Otherwise the
+	// source is skipped.
+	FailClosed bool
+}
+
+// CompositeSafeBrowsing is a SafeBrowsing implementation that consults several
+// sources at once. A domain is listed if any source lists it, in which case
+// IsListed returns the listing source's name and list, separated by a slash.
+type CompositeSafeBrowsing struct {
+	sources []SafeBrowsingSource
+	stats   metrics.Scope
+}
+
+// NewCompositeSafeBrowsing returns a CompositeSafeBrowsing that consults
+// sources. When several sources list a domain, the first in sources is
+// reported.
+func NewCompositeSafeBrowsing(sources []SafeBrowsingSource, stats metrics.Scope) *CompositeSafeBrowsing {
+	return &CompositeSafeBrowsing{
+		sources: sources,
+		stats:   stats.NewScope("SafeBrowsing"),
+	}
+}
+
+// wrapSourceError names the source that returned err. Only fail-closed
+// sources' errors are returned, so ErrOutOfDateHashes is wrapped too: callers
+// treat it as the domain being safe, which would make the source fail open.
+func wrapSourceError(name string, err error) error {
+	return fmt.Errorf("checking %s: %s", name, err)
+}
+
+type sourceVerdict struct {
+	list string
+	err  error
+}
+
+// IsListed queries every source in parallel. A listing by any source takes
+// precedence over errors from other sources, since it is conclusive whatever
+// they would have said. Of the fail-closed sources' errors, the first that
+// isn't ErrOutOfDateHashes is returned if there is one, since it says more
+// about what's wrong.
+func (c *CompositeSafeBrowsing) IsListed(domain string) (string, error) {
+	verdicts := make([]sourceVerdict, len(c.sources))
+	var wg sync.WaitGroup
+	for i, source := range c.sources {
+		wg.Add(1)
+		go func(source SafeBrowsingSource, v *sourceVerdict) {
+			defer wg.Done()
+			v.list, v.err = source.Client.IsListed(domain)
+		}(source, &verdicts[i])
+	}
+	wg.Wait()
+
+	var failure error
+	var failureOutOfDate bool
+	for i, v := range verdicts {
+		source := c.sources[i]
+		if v.err != nil {
+			if source.FailClosed {
+				c.stats.Inc(source.Name+".Errors.FailedClosed", 1)
+				outOfDate := v.err == safebrowsing.ErrOutOfDateHashes
+				if failure == nil || (failureOutOfDate && !outOfDate) {
+					failure = wrapSourceError(source.Name, v.err)
+					failureOutOfDate = outOfDate
+				}
+			} else {
+				c.stats.Inc(source.Name+".Errors.FailedOpen", 1)
+			}
+			continue
+		}
+		if v.list != "" {
+			c.stats.Inc(source.Name+".Listed", 1)
+			return source.Name + "/" + v.list, nil
+		}
+	}
+	return "", failure
+}
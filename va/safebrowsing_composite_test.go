@@ -0,0 +1,87 @@
+package va
+
+import (
+	"errors"
+	"testing"
+
+	safebrowsing "github.com/letsencrypt/go-safe-browsing-api"
+
+	"github.com/letsencrypt/boulder/metrics"
+	"github.com/letsencrypt/boulder/test"
+)
+
+// staticSafeBrowsing lists the domains in its map on the given list, and fails
+// for every other domain if err is set.
+type staticSafeBrowsing struct {
+	listed map[string]string
+	err    error
+}
+
+func (s staticSafeBrowsing) IsListed(domain string) (string, error) {
+	if list, ok := s.listed[domain]; ok {
+		return list, nil
+	}
+	return "", s.err
+}
+
+func TestCompositeSafeBrowsing(t *testing.T) {
+	broken := errors.New("broken")
+	c := NewCompositeSafeBrowsing([]SafeBrowsingSource{
+		{
+			Name:   "google",
+			Client: staticSafeBrowsing{listed: map[string]string{"malware.com": "goog-malware-shavar"}, err: broken},
+		},
+		{
+			Name:       "compliance",
+			Client:     staticSafeBrowsing{listed: map[string]string{"phish.com": "phishing.txt", "malware.com": "phishing.txt"}},
+			FailClosed: true,
+		},
+	}, metrics.NewNoopScope())
+
+	// The first source in order is reported when several list a domain.
+	list, err := c.IsListed("malware.com")
+	test.AssertNotError(t, err, "IsListed failed")
+	test.AssertEquals(t, list, "google/goog-malware-shavar")
+
+	// A fail-open source's error doesn't hide a listing by another source.
+	list, err = c.IsListed("phish.com")
+	test.AssertNotError(t, err, "IsListed failed")
+	test.AssertEquals(t, list, "compliance/phishing.txt")
+
+	// Nor does it cause a failure on its own.
+	list, err = c.IsListed("good.com")
+	test.AssertNotError(t, err, "IsListed failed")
+	test.AssertEquals(t, list, "")
+
+	// A fail-closed source's error does.
+	c = NewCompositeSafeBrowsing([]SafeBrowsingSource{
+		{Name: "google", Client: staticSafeBrowsing{}},
+		{Name: "compliance", Client: staticSafeBrowsing{err: broken}, FailClosed: true},
+	}, metrics.NewNoopScope())
+	_, err = c.IsListed("good.com")
+	test.AssertError(t, err, "IsListed should have failed closed")
+
+	// Out of date hashes from a fail-closed source fail too, rather than
+	// passing the sentinel that callers treat as safe.
+	c = NewCompositeSafeBrowsing([]SafeBrowsingSource{
+		{Name: "google", Client: staticSafeBrowsing{err: safebrowsing.ErrOutOfDateHashes}, FailClosed: true},
+	}, metrics.NewNoopScope())
+	_, err = c.IsListed("good.com")
+	test.AssertError(t, err, "IsListed should have failed closed")
+	test.Assert(t, err != safebrowsing.ErrOutOfDateHashes, "Out of date hashes were passed through")
+
+	// And a real error from a later source takes precedence over them.
+	c = NewCompositeSafeBrowsing([]SafeBrowsingSource{
+		{Name: "google", Client: staticSafeBrowsing{err: safebrowsing.ErrOutOfDateHashes}, FailClosed: true},
+		{Name: "compliance", Client: staticSafeBrowsing{err: broken}, FailClosed: true},
+	}, metrics.NewNoopScope())
+	_, err = c.IsListed("good.com")
+	test.AssertEquals(t, err.Error(), "checking compliance: broken")
+
+	// A fail-open source's out of date hashes are skipped like any error.
+	c = NewCompositeSafeBrowsing([]SafeBrowsingSource{
+		{Name: "google", Client: staticSafeBrowsing{err: safebrowsing.ErrOutOfDateHashes}},
+	}, metrics.NewNoopScope())
+	_, err = c.IsListed("good.com")
+	test.AssertNotError(t, err, "IsListed failed on a fail-open source")
+}
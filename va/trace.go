@@ -0,0 +1,74 @@
+package va
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+
+	"github.com/miekg/dns"
+	"golang.org/x/net/context"
+
+	"github.com/letsencrypt/boulder/bdns"
+)
+
+// Tracer is told the details of each network exchange the VA makes while
+// validating. It is meant for debugging tools; the VA doesn't need one.
+type Tracer interface {
+	// DNS is called after each DNS query, with the answers in presentation
+	// format.
+	DNS(qtype, name string, answers []string, err error)
+	// HTTPResponse is called for each HTTP response, including redirects.
+	// The response body must not be read.
+	HTTPResponse(resp *http.Response)
+	// TLSHandshake is called after each TLS handshake made directly by the
+	// VA, rather than by an HTTP request.
+	TLSHandshake(hostPort string, state tls.ConnectionState)
+}
+
+// SetTracer makes the VA report the details of its network exchanges to t,
+// including the DNS queries made through its resolver.
+func (va *ValidationAuthorityImpl) SetTracer(t Tracer) {
+	va.tracer = t
+	va.dnsResolver = &tracingResolver{DNSResolver: va.dnsResolver, tracer: t}
+}
+
+// tracingResolver reports the results of each query to a Tracer.
+type tracingResolver struct {
+	bdns.DNSResolver
+	tracer Tracer
+}
+
+func (tr *tracingResolver) LookupTXT(ctx context.Context, hostname string) ([]string, []string, error) {
+	txts, authorities, err := tr.DNSResolver.LookupTXT(ctx, hostname)
+	tr.tracer.DNS("TXT", hostname, txts, err)
+	return txts, authorities, err
+}
+
+func (tr *tracingResolver) LookupHost(ctx context.Context, hostname string) ([]net.IP, error) {
+	addrs, err := tr.DNSResolver.LookupHost(ctx, hostname)
+	var answers []string
+	for _, addr := range addrs {
+		answers = append(answers, addr.String())
+	}
+	tr.tracer.DNS("A/AAAA", hostname, answers, err)
+	return addrs, err
+}
+
+func (tr *tracingResolver) LookupCAA(ctx context.Context, hostname string) ([]*dns.CAA, []dns.RR, error) {
+	caas, aliases, err := tr.DNSResolver.LookupCAA(ctx, hostname)
+	var answers []string
+	for _, alias := range aliases {
+		answers = append(answers, alias.String())
+	}
+	for _, caa := range caas {
+		answers = append(answers, caa.String())
+	}
+	tr.tracer.DNS("CAA", hostname, answers, err)
+	return caas, aliases, err
+}
+
+func (tr *tracingResolver) LookupMX(ctx context.Context, hostname string) ([]string, error) {
+	mxs, err := tr.DNSResolver.LookupMX(ctx, hostname)
+	tr.tracer.DNS("MX", hostname, mxs, err)
+	return mxs, err
+}
@@ -0,0 +1,61 @@
+package va
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/test"
+)
+
+// recordingTracer records a line for each event it is told about.
+type recordingTracer struct {
+	events []string
+}
+
+func (rt *recordingTracer) DNS(qtype, name string, answers []string, err error) {
+	rt.events = append(rt.events, fmt.Sprintf("DNS %s %s %v %v", qtype, name, answers, err))
+}
+
+func (rt *recordingTracer) HTTPResponse(resp *http.Response) {
+	rt.events = append(rt.events, fmt.Sprintf("HTTP %s %d", resp.Request.URL.Path, resp.StatusCode))
+}
+
+func (rt *recordingTracer) TLSHandshake(hostPort string, state tls.ConnectionState) {
+	rt.events = append(rt.events, fmt.Sprintf("TLS %s %d", hostPort, len(state.PeerCertificates)))
+}
+
+func TestTracerHTTP(t *testing.T) {
+	hs := httpSrv(t, expectedToken)
+	defer hs.Close()
+	port, err := getPort(hs)
+	test.AssertNotError(t, err, "failed to get test server port")
+	va, _, _ := setup()
+	va.httpPort = port
+	tracer := &recordingTracer{}
+	va.SetTracer(tracer)
+
+	chall := core.HTTPChallenge01()
+	setChallengeToken(&chall, pathMoved)
+	_, prob := va.validateHTTP01(ctx, ident, chall)
+	test.Assert(t, prob == nil, "validation failed")
+	test.AssertDeepEquals(t, tracer.events, []string{
+		"DNS A/AAAA localhost [127.0.0.1] <nil>",
+		"HTTP /.well-known/acme-challenge/" + pathMoved + " 301",
+		"DNS A/AAAA localhost [127.0.0.1] <nil>",
+		"HTTP /.well-known/acme-challenge/" + pathValid + " 200",
+	})
+}
+
+func TestTracerDNS(t *testing.T) {
+	va, _, _ := setup()
+	tracer := &recordingTracer{}
+	va.SetTracer(tracer)
+
+	chall := createChallenge(core.ChallengeTypeDNS01)
+	_, prob := va.validateDNS01(ctx, core.AcmeIdentifier{Type: core.IdentifierDNS, Value: "servfail.com"}, chall)
+	test.Assert(t, prob != nil, "validation succeeded")
+	test.AssertDeepEquals(t, tracer.events, []string{"DNS TXT _acme-challenge.servfail.com [] SERVFAIL"})
+}
@@ -14,7 +14,6 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/cactus/go-statsd-client/statsd"
@@ -23,6 +22,7 @@ import (
 	"golang.org/x/net/context"
 
 	"github.com/letsencrypt/boulder/bdns"
+	"github.com/letsencrypt/boulder/caa"
 	"github.com/letsencrypt/boulder/cdr"
 	"github.com/letsencrypt/boulder/cmd"
 	"github.com/letsencrypt/boulder/core"
@@ -58,6 +58,19 @@ type ValidationAuthorityImpl struct {
 	clk          clock.Clock
 	caaClient    caaPB.CAACheckerClient
 	caaDR        *cdr.CAADistributedResolver
+	tracer       Tracer
+
+	// RetryPolicy controls the retrying of validations that fail with
+	// transient errors. The zero value disables retries.
+	RetryPolicy RetryPolicy
+
+	// HTTPPolicy controls redirect following and response handling for
+	// http-01 validation.
+	HTTPPolicy HTTPPolicy
+
+	// EmailReply sends and receives the emails for email-reply-00
+	// validation. If nil, those challenges are not supported.
+	EmailReply *EmailReply
 }
 
 // NewValidationAuthorityImpl constructs a new VA
@@ -100,15 +113,14 @@ type verificationRequestEvent struct {
 	Error             string                  `json:",omitempty"`
 }
 
-// getAddr will query for all A records associated with hostname and return the
-// preferred address, the first net.IP in the addrs slice, and all addresses resolved.
-// This is the same choice made by the Go internal resolution library used by
-// net/http, except we only send A queries and accept IPv4 addresses.
-// TODO(#593): Add IPv6 support
+// getAddr will query for all A and AAAA records associated with hostname and
+// return the preferred address and all addresses resolved. The first IPv6
+// address is preferred if there is one, and the first IPv4 address otherwise.
 func (va ValidationAuthorityImpl) getAddr(ctx context.Context, hostname string) (net.IP, []net.IP, *probs.ProblemDetails) {
 	addrs, err := va.dnsResolver.LookupHost(ctx, hostname)
 	if err != nil {
 		va.log.Debug(fmt.Sprintf("%s DNS failure: %s", hostname, err))
+		noteError(ctx, err)
 		problem := bdns.ProblemDetailsFromDNSError(err)
 		return net.IP{}, nil, problem
 	}
@@ -120,28 +132,27 @@ func (va ValidationAuthorityImpl) getAddr(ctx context.Context, hostname string)
 		return net.IP{}, nil, problem
 	}
 	addr := addrs[0]
+	if v6 := firstAddr(addrs, false); v6 != nil {
+		addr = v6
+	}
 	va.log.Debug(fmt.Sprintf("Resolved addresses for %s [using %s]: %s", hostname, addr, addrs))
 	return addr, addrs, nil
 }
 
-type dialer struct {
-	record core.ValidationRecord
-}
-
-func (d *dialer) Dial(_, _ string) (net.Conn, error) {
-	realDialer := net.Dialer{Timeout: validationTimeout}
-	return realDialer.Dial("tcp", net.JoinHostPort(d.record.AddressUsed.String(), d.record.Port))
-}
-
-// resolveAndConstructDialer gets the preferred address using va.getAddr and returns
-// the chosen address and dialer for that address and correct port.
-func (va *ValidationAuthorityImpl) resolveAndConstructDialer(ctx context.Context, name string, port int) (dialer, *probs.ProblemDetails) {
-	d := dialer{
+// resolveAndConstructDialer gets the preferred address using va.getAddr and
+// returns a dialer for that address and the correct port. If the preferred
+// address is IPv6 and an IPv4 address was also resolved, the dialer falls
+// back to the IPv4 address when it can't connect to the IPv6 one.
+func (va *ValidationAuthorityImpl) resolveAndConstructDialer(ctx context.Context, name string, port int) (*dialer, *probs.ProblemDetails) {
+	d := &dialer{
 		record: core.ValidationRecord{
 			Hostname: name,
 			Port:     strconv.Itoa(port),
 		},
 	}
+	if deadline, ok := ctx.Deadline(); ok {
+		d.deadline = deadline
+	}
 
 	addr, allAddrs, err := va.getAddr(ctx, name)
 	if err != nil {
@@ -149,6 +160,9 @@ func (va *ValidationAuthorityImpl) resolveAndConstructDialer(ctx context.Context
 	}
 	d.record.AddressesResolved = allAddrs
 	d.record.AddressUsed = addr
+	if addr.To4() == nil {
+		d.fallback = firstAddr(allAddrs, true)
+	}
 	return d, nil
 }
 
@@ -189,11 +203,20 @@ func (va *ValidationAuthorityImpl) fetchHTTP(ctx context.Context, identifier cor
 		httpRequest.Header["User-Agent"] = []string{va.userAgent}
 	}
 
-	dialer, prob := va.resolveAndConstructDialer(ctx, host, port)
-	dialer.record.URL = url.String()
-	validationRecords := []core.ValidationRecord{dialer.record}
+	// hops holds the dialer for the original request and for each redirect,
+	// each of which contributes a validation record.
+	hop, prob := va.resolveAndConstructDialer(ctx, host, port)
+	hop.record.URL = url.String()
+	hops := []*dialer{hop}
+	validationRecords := func() []core.ValidationRecord {
+		records := make([]core.ValidationRecord, len(hops))
+		for i, hop := range hops {
+			records[i] = hop.Record()
+		}
+		return records
+	}
 	if prob != nil {
-		return nil, validationRecords, prob
+		return nil, validationRecords(), prob
 	}
 
 	tr := &http.Transport{
@@ -205,7 +228,7 @@ func (va *ValidationAuthorityImpl) fetchHTTP(ctx context.Context, identifier cor
 		DisableKeepAlives: true,
 		// Intercept Dial in order to connect to the IP address we
 		// select.
-		Dial: dialer.Dial,
+		Dial: hop.Dial,
 	}
 
 	// Some of our users use mod_security. Mod_security sees a lack of Accept
@@ -220,10 +243,9 @@ func (va *ValidationAuthorityImpl) fetchHTTP(ctx context.Context, identifier cor
 	httpRequest.Header.Set("Accept", "*/*")
 
 	logRedirect := func(req *http.Request, via []*http.Request) error {
-		if len(validationRecords) >= maxRedirect {
-			return fmt.Errorf("Too many redirects")
+		if va.tracer != nil && req.Response != nil {
+			va.tracer.HTTPResponse(req.Response)
 		}
-
 		// Set Accept header for mod_security (see the other place the header is
 		// set)
 		req.Header.Set("Accept", "*/*")
@@ -248,14 +270,39 @@ func (va *ValidationAuthorityImpl) fetchHTTP(ctx context.Context, identifier cor
 			reqPort = 80
 		}
 
-		dialer, err := va.resolveAndConstructDialer(ctx, reqHost, reqPort)
-		dialer.record.URL = req.URL.String()
-		validationRecords = append(validationRecords, dialer.record)
+		var refusal error
+		if len(hops) >= va.HTTPPolicy.maxRedirects() {
+			refusal = redirectError("Too many redirects")
+		} else {
+			refusal = va.HTTPPolicy.checkRedirectURL(req.URL, reqPort)
+		}
+		if refusal != nil {
+			hops = append(hops, &dialer{record: core.ValidationRecord{
+				URL:      req.URL.String(),
+				Hostname: reqHost,
+				Port:     strconv.Itoa(reqPort),
+			}})
+			return refusal
+		}
+
+		hop, err := va.resolveAndConstructDialer(ctx, reqHost, reqPort)
+		hop.record.URL = req.URL.String()
+		hops = append(hops, hop)
 		if err != nil {
 			return err
 		}
-		tr.Dial = dialer.Dial
-		va.log.Debug(fmt.Sprintf("%s [%s] redirect from %q to %q [%s]", challenge.Type, identifier, via[len(via)-1].URL.String(), req.URL.String(), dialer.record.AddressUsed))
+		if va.HTTPPolicy.RejectReservedRedirects {
+			// The dialer connects to its fallback address if the preferred
+			// one fails, so both have to be allowed.
+			for _, addr := range hop.addresses() {
+				if bdns.IsReservedIP(addr) {
+					return redirectError(fmt.Sprintf("redirect to %s, which resolves to reserved address %s",
+						reqHost, addr))
+				}
+			}
+		}
+		tr.Dial = hop.Dial
+		va.log.Debug(fmt.Sprintf("%s [%s] redirect from %q to %q [%s]", challenge.Type, identifier, via[len(via)-1].URL.String(), req.URL.String(), hop.record.AddressUsed))
 		return nil
 	}
 	client := http.Client{
@@ -266,59 +313,78 @@ func (va *ValidationAuthorityImpl) fetchHTTP(ctx context.Context, identifier cor
 	httpResponse, err := client.Do(httpRequest)
 	if err != nil {
 		va.log.Info(fmt.Sprintf("HTTP request to %s failed. err=[%#v] errStr=[%s]", url, err, err))
-		return nil, validationRecords,
+		if redirectErr, ok := refusedRedirect(err); ok {
+			va.stats.Inc("VA.HTTP.RedirectRefused", 1, 1.0)
+			return nil, validationRecords(), probs.Unauthorized(
+				fmt.Sprintf("Refused to follow redirect from %s: %s", url, redirectErr))
+		}
+		noteError(ctx, err)
+		return nil, validationRecords(),
 			parseHTTPConnError(fmt.Sprintf("Could not connect to %s", url), err)
 	}
 
-	body, err := ioutil.ReadAll(&io.LimitedReader{R: httpResponse.Body, N: maxResponseSize})
+	if va.tracer != nil {
+		va.tracer.HTTPResponse(httpResponse)
+	}
+
+	maxBodySize := va.HTTPPolicy.maxBodySize()
+	body, err := ioutil.ReadAll(&io.LimitedReader{R: httpResponse.Body, N: maxBodySize})
 	closeErr := httpResponse.Body.Close()
 	if err == nil {
 		err = closeErr
 	}
 	if err != nil {
 		va.log.Info(fmt.Sprintf("Error reading HTTP response body from %s. err=[%#v] errStr=[%s]", url.String(), err, err))
-		return nil, validationRecords, probs.Unauthorized(fmt.Sprintf("Error reading HTTP response body: %v", err))
+		noteError(ctx, err)
+		return nil, validationRecords(), probs.Unauthorized(fmt.Sprintf("Error reading HTTP response body: %v", err))
 	}
 	// io.LimitedReader will silently truncate a Reader so if the
-	// resulting payload is the same size as maxResponseSize fail
-	if len(body) >= maxResponseSize {
-		return nil, validationRecords, probs.Unauthorized(fmt.Sprintf("Invalid response from %s: \"%s\"", url.String(), body))
+	// resulting payload is the same size as maxBodySize fail
+	if int64(len(body)) >= maxBodySize {
+		return nil, validationRecords(), probs.Unauthorized(fmt.Sprintf("Invalid response from %s: \"%s\"", url.String(), body))
 	}
 
 	if httpResponse.StatusCode != 200 {
 		va.log.Info(fmt.Sprintf("Non-200 status code from HTTP: %s returned %d", url.String(), httpResponse.StatusCode))
-		return nil, validationRecords, probs.Unauthorized(fmt.Sprintf("Invalid response from %s [%s]: %d",
-			url.String(), dialer.record.AddressUsed, httpResponse.StatusCode))
+		return nil, validationRecords(), probs.Unauthorized(fmt.Sprintf("Invalid response from %s [%s]: %d",
+			url.String(), hops[len(hops)-1].Record().AddressUsed, httpResponse.StatusCode))
 	}
 
-	return body, validationRecords, nil
+	return body, validationRecords(), nil
 }
 
 func (va *ValidationAuthorityImpl) validateTLSWithZName(ctx context.Context, identifier core.AcmeIdentifier, challenge core.Challenge, zName string) ([]core.ValidationRecord, *probs.ProblemDetails) {
-	addr, allAddrs, problem := va.getAddr(ctx, identifier.Value)
-	validationRecords := []core.ValidationRecord{
-		{
-			Hostname:          identifier.Value,
-			AddressesResolved: allAddrs,
-			AddressUsed:       addr,
-		},
-	}
+	dialer, problem := va.resolveAndConstructDialer(ctx, identifier.Value, va.tlsPort)
 	if problem != nil {
-		return validationRecords, problem
+		return []core.ValidationRecord{dialer.Record()}, problem
 	}
 
 	// Make a connection with SNI = nonceName
-	portString := strconv.Itoa(va.tlsPort)
-	hostPort := net.JoinHostPort(addr.String(), portString)
-	validationRecords[0].Port = portString
-	va.log.Info(fmt.Sprintf("%s [%s] Attempting to validate for %s %s", challenge.Type, identifier, hostPort, zName))
-	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: validationTimeout}, "tcp", hostPort, &tls.Config{
-		ServerName:         zName,
-		InsecureSkipVerify: true,
-	})
+	va.log.Info(fmt.Sprintf("%s [%s] Attempting to validate for %s %s", challenge.Type, identifier,
+		net.JoinHostPort(dialer.record.AddressUsed.String(), dialer.record.Port), zName))
+	rawConn, err := dialer.Dial("tcp", "")
+	validationRecords := []core.ValidationRecord{dialer.Record()}
+	hostPort := net.JoinHostPort(validationRecords[0].AddressUsed.String(), validationRecords[0].Port)
+	var conn *tls.Conn
+	if err == nil {
+		conn = tls.Client(rawConn, &tls.Config{
+			ServerName:         zName,
+			InsecureSkipVerify: true,
+		})
+		// The dialer's timeout doesn't cover the handshake, so set a deadline
+		// for it as tls.DialWithDialer would.
+		err = rawConn.SetDeadline(time.Now().Add(validationTimeout))
+		if err == nil {
+			err = conn.Handshake()
+		}
+		if err != nil {
+			_ = rawConn.Close()
+		}
+	}
 
 	if err != nil {
 		va.log.Info(fmt.Sprintf("TLS-01 connection failure for %s. err=[%#v] errStr=[%s]", identifier, err, err))
+		noteError(ctx, err)
 		return validationRecords,
 			parseHTTPConnError(fmt.Sprintf("Failed to connect to %s for TLS-SNI-01 challenge", hostPort), err)
 	}
@@ -326,6 +392,9 @@ func (va *ValidationAuthorityImpl) validateTLSWithZName(ctx context.Context, ide
 	defer func() {
 		_ = conn.Close()
 	}()
+	if va.tracer != nil {
+		va.tracer.TLSHandshake(hostPort, conn.ConnectionState())
+	}
 
 	// Check that zName is a dNSName SAN in the server's certificate
 	certs := conn.ConnectionState().PeerCertificates
@@ -359,7 +428,7 @@ func (va *ValidationAuthorityImpl) validateHTTP01(ctx context.Context, identifie
 		return validationRecords, prob
 	}
 
-	payload := strings.TrimRight(string(body), whitespaceCutset)
+	payload := va.HTTPPolicy.trim(string(body))
 
 	if payload != challenge.ProvidedKeyAuthorization {
 		errString := fmt.Sprintf("The key authorization file from the server did not match this challenge [%v] != [%v]",
@@ -425,6 +494,7 @@ func (va *ValidationAuthorityImpl) validateDNS01(ctx context.Context, identifier
 
 	if err != nil {
 		va.log.Info(fmt.Sprintf("Failed to lookup txt records for %s. err=[%#v] errStr=[%s]", identifier, err, err))
+		noteError(ctx, err)
 
 		return nil, bdns.ProblemDetailsFromDNSError(err)
 	}
@@ -442,100 +512,142 @@ func (va *ValidationAuthorityImpl) validateDNS01(ctx context.Context, identifier
 	return nil, probs.Unauthorized("Correct value not found for DNS challenge")
 }
 
-func (va *ValidationAuthorityImpl) checkCAA(ctx context.Context, identifier core.AcmeIdentifier) *probs.ProblemDetails {
+// checkCAA checks whether the CAA records for identifier permit issuance. It
+// returns a description of the check, which is nil if the check could not be
+// performed at all, and a problem if issuance is not permitted.
+func (va *ValidationAuthorityImpl) checkCAA(ctx context.Context, identifier core.AcmeIdentifier) (*caa.Result, *probs.ProblemDetails) {
+	var result *caa.Result
 	var prob *probs.ProblemDetails
 	if va.caaClient != nil {
-		prob = va.checkCAAService(ctx, identifier)
+		result, prob = va.checkCAAService(ctx, identifier)
 	} else {
-		prob = va.checkCAAInternal(ctx, identifier)
+		result, prob = va.checkCAAInternal(ctx, identifier)
 	}
 	if va.caaDR != nil && prob != nil && prob.Type == probs.ConnectionProblem {
 		return va.checkGPDNS(ctx, identifier)
 	}
-	return prob
+	return result, prob
 }
 
-func (va *ValidationAuthorityImpl) checkCAAInternal(ctx context.Context, ident core.AcmeIdentifier) *probs.ProblemDetails {
-	present, valid, err := va.checkCAARecords(ctx, ident)
+func (va *ValidationAuthorityImpl) checkCAAInternal(ctx context.Context, ident core.AcmeIdentifier) (*caa.Result, *probs.ProblemDetails) {
+	result, err := va.checkCAARecords(ctx, ident)
 	if err != nil {
-		return bdns.ProblemDetailsFromDNSError(err)
+		noteError(ctx, err)
+		return result, bdns.ProblemDetailsFromDNSError(err)
 	}
 	// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
 	va.log.AuditInfo(fmt.Sprintf(
-		"Checked CAA records for %s, [Present: %t, Valid for issuance: %t]",
+		"Checked CAA records for %s, [Present: %t, Valid for issuance: %t, Record used: %q]",
 		ident.Value,
-		present,
-		valid,
+		result.Present,
+		result.Valid,
+		result.RecordUsed,
 	))
-	if !valid {
-		return probs.ConnectionFailure(fmt.Sprintf("CAA record for %s prevents issuance", ident.Value))
+	if !result.Valid {
+		return result, probs.ConnectionFailure(fmt.Sprintf("CAA record for %s prevents issuance", ident.Value))
 	}
-	return nil
+	return result, nil
 }
 
-func (va *ValidationAuthorityImpl) checkCAAService(ctx context.Context, ident core.AcmeIdentifier) *probs.ProblemDetails {
+func (va *ValidationAuthorityImpl) checkCAAService(ctx context.Context, ident core.AcmeIdentifier) (*caa.Result, *probs.ProblemDetails) {
 	r, err := va.caaClient.ValidForIssuance(ctx, &caaPB.Check{Name: &ident.Value, IssuerDomain: &va.issuerDomain})
 	if err != nil {
 		va.log.Warning(fmt.Sprintf("grpc: error calling ValidForIssuance: %s", err))
-		return bgrpc.ErrorToProb(err)
+		return nil, bgrpc.ErrorToProb(err)
 	}
 	if r.Present == nil || r.Valid == nil {
 		va.log.AuditErr("gRPC: communication failure: response is missing fields")
-		return &probs.ProblemDetails{
+		return nil, &probs.ProblemDetails{
 			Type:   probs.ServerInternalProblem,
 			Detail: "Internal communication failure",
 		}
 	}
+	result := &caa.Result{
+		Present:    *r.Present,
+		Valid:      *r.Valid,
+		RecordUsed: r.GetRecordUsed(),
+	}
+	for _, step := range r.Path {
+		result.Path = append(result.Path, core.CAALookupStep{
+			Name:    step.GetName(),
+			Aliases: step.Aliases,
+			Records: step.Records,
+			Error:   step.GetError(),
+		})
+	}
 	// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
 	va.log.AuditInfo(fmt.Sprintf(
-		"Checked CAA records for %s, [Present: %t, Valid for issuance: %t]",
+		"Checked CAA records for %s, [Present: %t, Valid for issuance: %t, Record used: %q]",
 		ident.Value,
-		*r.Present,
-		*r.Valid,
+		result.Present,
+		result.Valid,
+		result.RecordUsed,
 	))
-	if !*r.Valid {
-		return probs.ConnectionFailure(fmt.Sprintf("CAA record for %s prevents issuance", ident.Value))
+	if !result.Valid {
+		return result, probs.ConnectionFailure(fmt.Sprintf("CAA record for %s prevents issuance", ident.Value))
 	}
-	return nil
+	return result, nil
 }
 
-func (va *ValidationAuthorityImpl) checkGPDNS(ctx context.Context, identifier core.AcmeIdentifier) *probs.ProblemDetails {
-	results := va.parallelCAALookup(ctx, identifier.Value, va.caaDR.LookupCAA)
-	set, err := parseResults(results)
+func (va *ValidationAuthorityImpl) checkGPDNS(ctx context.Context, identifier core.AcmeIdentifier) (*caa.Result, *probs.ProblemDetails) {
+	// The distributed resolver collapses any aliases into the records it
+	// returns, so the path it produces has none.
+	lookup := func(ctx context.Context, name string) ([]*dns.CAA, []dns.RR, error) {
+		records, err := va.caaDR.LookupCAA(ctx, name)
+		return records, nil, err
+	}
+	result, err := caa.Check(ctx, lookup, identifier.Value, va.issuerDomain)
 	if err != nil {
-		return probs.ConnectionFailure(err.Error())
+		return result, probs.ConnectionFailure(err.Error())
 	}
-	present, valid := va.validateCAASet(set)
+	va.recordCAAStats(result)
 	va.log.AuditInfo(fmt.Sprintf(
-		"Checked CAA records for %s using GPDNS, [Present: %t, Valid for issuance: %t]",
+		"Checked CAA records for %s using GPDNS, [Present: %t, Valid for issuance: %t, Record used: %q]",
 		identifier.Value,
-		present,
-		valid,
+		result.Present,
+		result.Valid,
+		result.RecordUsed,
 	))
-	if !valid {
-		return &probs.ProblemDetails{
+	if !result.Valid {
+		return result, &probs.ProblemDetails{
 			Type:   probs.ConnectionProblem,
 			Detail: fmt.Sprintf("CAA records prevents issuance for %s", identifier.Value),
 		}
 	}
-	return nil
+	return result, nil
+}
+
+type caaOutcome struct {
+	result *caa.Result
+	prob   *probs.ProblemDetails
 }
 
 func (va *ValidationAuthorityImpl) validateChallengeAndCAA(ctx context.Context, identifier core.AcmeIdentifier, challenge core.Challenge) ([]core.ValidationRecord, *probs.ProblemDetails) {
-	ch := make(chan *probs.ProblemDetails, 1)
+	// CAA only governs issuance for DNS names.
+	if identifier.Type == core.IdentifierEmail {
+		return va.validateChallengeWithRetries(ctx, identifier, challenge)
+	}
+
+	ch := make(chan caaOutcome, 1)
 	go func() {
-		ch <- va.checkCAA(ctx, identifier)
+		result, prob := va.checkCAAWithRetries(ctx, identifier)
+		ch <- caaOutcome{result, prob}
 	}()
 
 	// TODO(#1292): send into another goroutine
-	validationRecords, err := va.validateChallenge(ctx, identifier, challenge)
+	validationRecords, err := va.validateChallengeWithRetries(ctx, identifier, challenge)
 	if err != nil {
 		return validationRecords, err
 	}
 
-	caaProblem := <-ch
-	if caaProblem != nil {
-		return validationRecords, caaProblem
+	caaOut := <-ch
+	if caaOut.result != nil && len(validationRecords) > 0 {
+		// Keep a record of which CAA records, if any, permitted issuance.
+		validationRecords[0].CAALookup = caaOut.result.Path
+		validationRecords[0].CAARecordUsed = caaOut.result.RecordUsed
+	}
+	if caaOut.prob != nil {
+		return validationRecords, caaOut.prob
 	}
 	return validationRecords, nil
 }
@@ -551,6 +663,8 @@ func (va *ValidationAuthorityImpl) validateChallenge(ctx context.Context, identi
 		return va.validateTLSSNI01(ctx, identifier, challenge)
 	case core.ChallengeTypeDNS01:
 		return va.validateDNS01(ctx, identifier, challenge)
+	case core.ChallengeTypeEmailReply00:
+		return va.validateEmailReply00(ctx, identifier, challenge)
 	}
 	return nil, probs.Malformed(fmt.Sprintf("invalid challenge type %s", challenge.Type))
 }
@@ -567,7 +681,11 @@ func (va *ValidationAuthorityImpl) PerformValidation(ctx context.Context, domain
 	}
 	vStart := va.clk.Now()
 
-	records, prob := va.validateChallengeAndCAA(ctx, core.AcmeIdentifier{Type: "dns", Value: domain}, challenge)
+	identifier := core.AcmeIdentifier{Type: core.IdentifierDNS, Value: domain}
+	if challenge.Type == core.ChallengeTypeEmailReply00 {
+		identifier.Type = core.IdentifierEmail
+	}
+	records, prob := va.validateChallengeAndCAA(ctx, identifier, challenge)
 
 	logEvent.ValidationRecords = records
 	challenge.ValidationRecord = records
@@ -603,175 +721,26 @@ func (va *ValidationAuthorityImpl) PerformValidation(ctx context.Context, domain
 	}
 }
 
-// CAASet consists of filtered CAA records
-type CAASet struct {
-	Issue     []*dns.CAA
-	Issuewild []*dns.CAA
-	Iodef     []*dns.CAA
-	Unknown   []*dns.CAA
-}
-
-// returns true if any CAA records have unknown tag properties and are flagged critical.
-func (caaSet CAASet) criticalUnknown() bool {
-	if len(caaSet.Unknown) > 0 {
-		for _, caaRecord := range caaSet.Unknown {
-			// The critical flag is the bit with significance 128. However, many CAA
-			// record users have misinterpreted the RFC and concluded that the bit
-			// with significance 1 is the critical bit. This is sufficiently
-			// widespread that that bit must reasonably be considered an alias for
-			// the critical bit. The remaining bits are 0/ignore as proscribed by the
-			// RFC.
-			if (caaRecord.Flag & (128 | 1)) != 0 {
-				return true
-			}
-		}
-	}
-
-	return false
-}
-
-// Filter CAA records by property
-func newCAASet(CAAs []*dns.CAA) *CAASet {
-	var filtered CAASet
-
-	for _, caaRecord := range CAAs {
-		switch caaRecord.Tag {
-		case "issue":
-			filtered.Issue = append(filtered.Issue, caaRecord)
-		case "issuewild":
-			filtered.Issuewild = append(filtered.Issuewild, caaRecord)
-		case "iodef":
-			filtered.Iodef = append(filtered.Iodef, caaRecord)
-		default:
-			filtered.Unknown = append(filtered.Unknown, caaRecord)
-		}
-	}
-
-	return &filtered
-}
-
-type caaResult struct {
-	records []*dns.CAA
-	err     error
-}
-
-func parseResults(results []caaResult) (*CAASet, error) {
-	// Return first result
-	for _, res := range results {
-		if res.err != nil {
-			return nil, res.err
-		}
-		if len(res.records) > 0 {
-			return newCAASet(res.records), nil
-		}
-	}
-	return nil, nil
-}
-
-func (va *ValidationAuthorityImpl) parallelCAALookup(ctx context.Context, name string, lookuper func(context.Context, string) ([]*dns.CAA, error)) []caaResult {
-	labels := strings.Split(name, ".")
-	results := make([]caaResult, len(labels))
-	var wg sync.WaitGroup
-
-	for i := 0; i < len(labels); i++ {
-		// Start the concurrent DNS lookup.
-		wg.Add(1)
-		go func(name string, r *caaResult) {
-			r.records, r.err = lookuper(ctx, name)
-			wg.Done()
-		}(strings.Join(labels[i:], "."), &results[i])
-	}
-
-	wg.Wait()
-	return results
-}
-
-func (va *ValidationAuthorityImpl) getCAASet(ctx context.Context, hostname string) (*CAASet, error) {
-	hostname = strings.TrimRight(hostname, ".")
-
-	// See RFC 6844 "Certification Authority Processing" for pseudocode.
-	// Essentially: check CAA records for the FDQN to be issued, and all
-	// parent domains.
-	//
-	// The lookups are performed in parallel in order to avoid timing out
-	// the RPC call.
-	//
-	// We depend on our resolver to snap CNAME and DNAME records.
-	results := va.parallelCAALookup(ctx, hostname, va.dnsResolver.LookupCAA)
-	return parseResults(results)
-}
-
-func (va *ValidationAuthorityImpl) checkCAARecords(ctx context.Context, identifier core.AcmeIdentifier) (present, valid bool, err error) {
-	hostname := strings.ToLower(identifier.Value)
-	caaSet, err := va.getCAASet(ctx, hostname)
+func (va *ValidationAuthorityImpl) checkCAARecords(ctx context.Context, identifier core.AcmeIdentifier) (*caa.Result, error) {
+	// See RFC 8659 Section 3 for the algorithm. Our resolver follows any
+	// aliases it meets at each level and reports them so that the full
+	// lookup path can be recorded.
+	result, err := caa.Check(ctx, va.dnsResolver.LookupCAA, identifier.Value, va.issuerDomain)
 	if err != nil {
-		return false, false, err
+		return result, err
 	}
-	present, valid = va.validateCAASet(caaSet)
-	return present, valid, nil
+	va.recordCAAStats(result)
+	return result, nil
 }
 
-func (va *ValidationAuthorityImpl) validateCAASet(caaSet *CAASet) (present, valid bool) {
-	if caaSet == nil {
-		// No CAA records found, can issue
-		va.stats.Inc("VA.CAA.None", 1, 1.0)
-		return false, true
-	}
-
-	// Record stats on directives not currently processed.
-	if len(caaSet.Iodef) > 0 {
-		va.stats.Inc("VA.CAA.WithIodef", 1, 1.0)
-	}
-
-	if caaSet.criticalUnknown() {
-		// Contains unknown critical directives.
-		va.stats.Inc("VA.CAA.UnknownCritical", 1, 1.0)
-		return true, false
-	}
-
-	if len(caaSet.Unknown) > 0 {
-		va.stats.Inc("VA.CAA.WithUnknownNoncritical", 1, 1.0)
-	}
-
-	if len(caaSet.Issue) == 0 {
-		// Although CAA records exist, none of them pertain to issuance in this case.
-		// (e.g. there is only an issuewild directive, but we are checking for a
-		// non-wildcard identifier, or there is only an iodef or non-critical unknown
-		// directive.)
-		va.stats.Inc("VA.CAA.NoneRelevant", 1, 1.0)
-		return true, true
-	}
-
-	// There are CAA records pertaining to issuance in our case. Note that this
-	// includes the case of the unsatisfiable CAA record value ";", used to
-	// prevent issuance by any CA under any circumstance.
-	//
-	// Our CAA identity must be found in the chosen checkSet.
-	for _, caa := range caaSet.Issue {
-		if extractIssuerDomain(caa) == va.issuerDomain {
-			va.stats.Inc("VA.CAA.Authorized", 1, 1.0)
-			return true, true
+func (va *ValidationAuthorityImpl) recordCAAStats(result *caa.Result) {
+	if result.Set != nil {
+		if len(result.Set.Iodef) > 0 {
+			va.stats.Inc("VA.CAA.WithIodef", 1, 1.0)
+		}
+		if len(result.Set.Unknown) > 0 && result.Reason != caa.ReasonUnknownCritical {
+			va.stats.Inc("VA.CAA.WithUnknownNoncritical", 1, 1.0)
 		}
 	}
-
-	// The list of authorized issuers is non-empty, but we are not in it. Fail.
-	va.stats.Inc("VA.CAA.Unauthorized", 1, 1.0)
-	return true, false
-}
-
-// Given a CAA record, assume that the Value is in the issue/issuewild format,
-// that is, a domain name with zero or more additional key-value parameters.
-// Returns the domain name, which may be "" (unsatisfiable).
-func extractIssuerDomain(caa *dns.CAA) string {
-	v := caa.Value
-	v = strings.Trim(v, " \t") // Value can start and end with whitespace.
-	idx := strings.IndexByte(v, ';')
-	if idx < 0 {
-		return v // no parameters; domain only
-	}
-
-	// Currently, ignore parameters. Unfortunately, the RFC makes no statement on
-	// whether any parameters are critical. Treat unknown parameters as
-	// non-critical.
-	return strings.Trim(v[0:idx], " \t")
+	va.stats.Inc("VA.CAA."+result.Reason, 1, 1.0)
 }
@@ -9,7 +9,6 @@ import (
 	"crypto/x509/pkix"
 	"encoding/base64"
 	"encoding/hex"
-	"errors"
 	"fmt"
 	"math/big"
 	"net"
@@ -22,7 +21,6 @@ import (
 	"time"
 
 	"github.com/jmhodges/clock"
-	"github.com/miekg/dns"
 	"github.com/square/go-jose"
 	"golang.org/x/net/context"
 
@@ -74,6 +72,7 @@ const path404 = "404"
 const pathFound = "GBq8SwWq3JsbREFdCamk5IX3KLsxW5ULeGs98Ajl_UM"
 const pathMoved = "5J4FIMrWNfmvHZo-QpKZngmuhqZGwRm21-oEgUDstJM"
 const pathRedirectPort = "port-redirect"
+const pathRedirectIP = "ip-redirect"
 const pathWait = "wait"
 const pathWaitLong = "wait-long"
 const pathReLookup = "7e-P57coLM7D3woNTp_xbJrtlkDYy6PWf3mSSbLwCr4"
@@ -131,6 +130,11 @@ func httpSrv(t *testing.T, token string) *httptest.Server {
 		} else if strings.HasSuffix(r.URL.Path, pathRedirectPort) {
 			t.Logf("HTTPSRV: Got a port redirect req\n")
 			http.Redirect(w, r, "http://other.valid:8080/path", 302)
+		} else if strings.HasSuffix(r.URL.Path, pathRedirectIP) {
+			t.Logf("HTTPSRV: Got an IP redirect req\n")
+			port, err := getPort(server)
+			test.AssertNotError(t, err, "failed to get server test port")
+			http.Redirect(w, r, fmt.Sprintf("http://127.0.0.1:%d/path", port), 302)
 		} else if r.Header.Get("User-Agent") == rejectUserAgent {
 			w.WriteHeader(http.StatusBadRequest)
 			w.Write([]byte("found trap User-Agent"))
@@ -566,7 +570,7 @@ func TestValidateTLSSNINotSane(t *testing.T) {
 
 func TestCAATimeout(t *testing.T) {
 	va, _, _ := setup()
-	err := va.checkCAA(ctx, core.AcmeIdentifier{Type: core.IdentifierDNS, Value: "caa-timeout.com"})
+	_, err := va.checkCAA(ctx, core.AcmeIdentifier{Type: core.IdentifierDNS, Value: "caa-timeout.com"})
 	if err.Type != probs.ConnectionProblem {
 		t.Errorf("Expected timeout error type %s, got %s", probs.ConnectionProblem, err.Type)
 	}
@@ -609,39 +613,56 @@ func TestCAAChecking(t *testing.T) {
 
 	va, _, _ := setup()
 	for _, caaTest := range tests {
-		present, valid, err := va.checkCAARecords(ctx, core.AcmeIdentifier{Type: "dns", Value: caaTest.Domain})
+		result, err := va.checkCAARecords(ctx, core.AcmeIdentifier{Type: "dns", Value: caaTest.Domain})
 		if err != nil {
 			t.Errorf("checkCAARecords error for %s: %s", caaTest.Domain, err)
+			continue
 		}
-		if present != caaTest.Present {
-			t.Errorf("checkCAARecords presence mismatch for %s: got %t expected %t", caaTest.Domain, present, caaTest.Present)
+		if result.Present != caaTest.Present {
+			t.Errorf("checkCAARecords presence mismatch for %s: got %t expected %t", caaTest.Domain, result.Present, caaTest.Present)
 		}
-		if valid != caaTest.Valid {
-			t.Errorf("checkCAARecords validity mismatch for %s: got %t expected %t", caaTest.Domain, valid, caaTest.Valid)
+		if result.Valid != caaTest.Valid {
+			t.Errorf("checkCAARecords validity mismatch for %s: got %t expected %t", caaTest.Domain, result.Valid, caaTest.Valid)
 		}
 	}
 
-	present, valid, err := va.checkCAARecords(ctx, core.AcmeIdentifier{Type: "dns", Value: "servfail.com"})
+	result, err := va.checkCAARecords(ctx, core.AcmeIdentifier{Type: "dns", Value: "servfail.com"})
 	test.AssertError(t, err, "servfail.com")
-	test.Assert(t, !present, "Present should be false")
-	test.Assert(t, !valid, "Valid should be false")
+	test.Assert(t, !result.Present, "Present should be false")
+	test.Assert(t, !result.Valid, "Valid should be false")
 
-	_, _, err = va.checkCAARecords(ctx, core.AcmeIdentifier{Type: "dns", Value: "servfail.com"})
+	_, err = va.checkCAARecords(ctx, core.AcmeIdentifier{Type: "dns", Value: "servfail.com"})
 	if err == nil {
 		t.Errorf("Should have returned error on CAA lookup, but did not: %s", "servfail.com")
 	}
 
-	present, valid, err = va.checkCAARecords(ctx, core.AcmeIdentifier{Type: "dns", Value: "servfail.present.com"})
+	result, err = va.checkCAARecords(ctx, core.AcmeIdentifier{Type: "dns", Value: "servfail.present.com"})
 	test.AssertError(t, err, "servfail.present.com")
-	test.Assert(t, !present, "Present should be false")
-	test.Assert(t, !valid, "Valid should be false")
+	test.Assert(t, !result.Present, "Present should be false")
+	test.Assert(t, !result.Valid, "Valid should be false")
 
-	_, _, err = va.checkCAARecords(ctx, core.AcmeIdentifier{Type: "dns", Value: "servfail.present.com"})
+	_, err = va.checkCAARecords(ctx, core.AcmeIdentifier{Type: "dns", Value: "servfail.present.com"})
 	if err == nil {
 		t.Errorf("Should have returned error on CAA lookup, but did not: %s", "servfail.present.com")
 	}
 }
 
+func TestCAALookupPath(t *testing.T) {
+	va, _, _ := setup()
+	result, err := va.checkCAARecords(ctx, core.AcmeIdentifier{Type: "dns", Value: "www.cname-present.com"})
+	test.AssertNotError(t, err, "checkCAARecords failed")
+	test.Assert(t, result.Present, "Present should be true")
+	test.Assert(t, result.Valid, "Valid should be true")
+	test.AssertEquals(t, len(result.Path), 2)
+	test.AssertEquals(t, result.Path[0].Name, "www.cname-present.com")
+	test.AssertEquals(t, len(result.Path[0].Records), 0)
+	test.AssertEquals(t, result.Path[1].Name, "cname-present.com")
+	test.AssertDeepEquals(t, result.Path[1].Aliases, []string{"present.com."})
+	test.AssertEquals(t, len(result.Path[1].Records), 1)
+	test.AssertEquals(t, result.RecordUsed, result.Path[1].Records[0])
+	test.Assert(t, strings.Contains(result.RecordUsed, "letsencrypt.org"), "wrong record used")
+}
+
 func TestPerformValidationInvalid(t *testing.T) {
 	va, stats, _ := setup()
 	chalDNS := createChallenge(core.ChallengeTypeDNS01)
@@ -656,9 +677,14 @@ func TestPerformValidationValid(t *testing.T) {
 	chalDNS := core.DNSChallenge01()
 	chalDNS.Token = expectedToken
 	chalDNS.ProvidedKeyAuthorization = expectedKeyAuthorization
-	_, prob := va.PerformValidation(context.Background(), "good-dns01.com", chalDNS, core.Authorization{})
+	records, prob := va.PerformValidation(context.Background(), "good-dns01.com", chalDNS, core.Authorization{})
 	test.Assert(t, prob == nil, fmt.Sprintf("validation failed: %#v", prob))
 	test.AssertEquals(t, stats.TimingDurationCalls[0].Metric, "VA.Validations.dns-01.valid")
+	// The CAA lookup path is attached to the first validation record.
+	test.AssertEquals(t, len(records[0].CAALookup), 2)
+	test.AssertEquals(t, records[0].CAALookup[0].Name, "good-dns01.com")
+	test.AssertEquals(t, records[0].CAALookup[1].Name, "com")
+	test.AssertEquals(t, records[0].CAARecordUsed, "")
 }
 
 func TestDNSValidationFailure(t *testing.T) {
@@ -860,30 +886,12 @@ func TestCheckCAAFallback(t *testing.T) {
 		clock.Default(),
 		logger)
 
-	prob := va.checkCAA(ctx, core.AcmeIdentifier{Value: "bad-local-resolver.com", Type: "dns"})
+	_, prob := va.checkCAA(ctx, core.AcmeIdentifier{Value: "bad-local-resolver.com", Type: "dns"})
 	test.Assert(t, prob == nil, fmt.Sprintf("returned ProblemDetails was non-nil: %#v", prob))
 
 	va.caaDR = nil
-	prob = va.checkCAA(ctx, core.AcmeIdentifier{Value: "bad-local-resolver.com", Type: "dns"})
+	_, prob = va.checkCAA(ctx, core.AcmeIdentifier{Value: "bad-local-resolver.com", Type: "dns"})
 	test.Assert(t, prob != nil, "returned ProblemDetails was nil")
 	test.AssertEquals(t, prob.Type, probs.ConnectionProblem)
 	test.AssertEquals(t, prob.Detail, "server failure at resolver")
 }
-
-func TestParseResults(t *testing.T) {
-	r := []caaResult{}
-	s, err := parseResults(r)
-	test.Assert(t, s == nil, "set is not nil")
-	test.Assert(t, err == nil, "error is not nil")
-	test.AssertNotError(t, err, "no error should be returned")
-	r = []caaResult{{nil, errors.New("")}, {[]*dns.CAA{&dns.CAA{Value: "test"}}, nil}}
-	s, err = parseResults(r)
-	test.Assert(t, s == nil, "set is not nil")
-	test.AssertEquals(t, err.Error(), "")
-	expected := dns.CAA{Value: "other-test"}
-	r = []caaResult{{[]*dns.CAA{&expected}, nil}, {[]*dns.CAA{&dns.CAA{Value: "test"}}, nil}}
-	s, err = parseResults(r)
-	test.AssertEquals(t, len(s.Unknown), 1)
-	test.Assert(t, s.Unknown[0] == &expected, "Incorrect record returned")
-	test.AssertNotError(t, err, "no error should be returned")
-}
@@ -625,7 +625,8 @@ func TestIssueCertificate(t *testing.T) {
 		true,
 		false,
 		300*24*time.Hour,
-		7*24*time.Hour)
+		7*24*time.Hour,
+		0)
 	ra.SA = mocks.NewStorageAuthority(fc)
 	ra.CA = &mocks.MockCA{
 		PEM: mockCertPEM,